@@ -1,28 +1,32 @@
 package flow
 
+import "context"
+
+// Actor runs flows on behalf of a caller through a FlowFacade, passing the
+// caller's context to it.
 type Actor interface {
-	RegisterRepo(repo string, actions []string, workflows []string) error
-	RunRepoFlows(repo string, token string) error
-	RunCustomFlow(repo string, flowType string, name string, token string, params map[string]string) error
+	RegisterRepo(ctx context.Context, repo string, actions []string, workflows []string) error
+	RunRepoFlows(ctx context.Context, repo string, token string) error
+	RunCustomFlow(ctx context.Context, repo string, flowType string, name string, token string, params map[string]string) error
 }
 
 type actorImpl struct {
-	flowFacade facade.FlowFacade
+	flowFacade FlowFacade
 }
 
 // NewActor creates a new Actor instance.
-func NewActor(flowFacade facade.FlowFacade) Actor {
+func NewActor(flowFacade FlowFacade) Actor {
 	return &actorImpl{flowFacade: flowFacade}
 }
 
-func (a *actorImpl) RegisterRepo(repo string, actions []string, workflows []string) error {
-	return a.flowFacade.RegisterRepo(repo, actions, workflows)
+func (a *actorImpl) RegisterRepo(ctx context.Context, repo string, actions []string, workflows []string) error {
+	return a.flowFacade.RegisterRepo(ctx, repo, actions, workflows)
 }
 
-func (a *actorImpl) RunRepoFlows(repo string, token string) error {
-	return a.flowFacade.TriggerRepoFlows(repo, token)
+func (a *actorImpl) RunRepoFlows(ctx context.Context, repo string, token string) error {
+	return a.flowFacade.TriggerRepoFlows(ctx, repo, token)
 }
 
-func (a *actorImpl) RunCustomFlow(repo string, flowType string, name string, token string, params map[string]string) error {
-	return a.flowFacade.TriggerCustomFlow(repo, flowType, name, token, params)
-}
\ No newline at end of file
+func (a *actorImpl) RunCustomFlow(ctx context.Context, repo string, flowType string, name string, token string, params map[string]string) error {
+	return a.flowFacade.TriggerCustomFlow(ctx, repo, flowType, name, token, params)
+}
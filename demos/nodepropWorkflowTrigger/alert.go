@@ -0,0 +1,267 @@
+package flow
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Alert kinds.
+const (
+	AlertFailureRate = "failure_rate"
+	AlertDeadLetters = "dead_letters"
+)
+
+// Alert monitor defaults.
+const (
+	DefaultAlertInterval = time.Minute
+	DefaultAlertWindow   = 15 * time.Minute
+)
+
+// AlertRule is a threshold on the dispatch history or the dead-letter
+// queue. Each rule sets either FailureRate or DeadLetters.
+type AlertRule struct {
+	Name string `yaml:"name" json:"name"`
+	// Repo, if set, limits FailureRate to one owner/repo.
+	Repo string `yaml:"repo,omitempty" json:"repo,omitempty"`
+	// FailureRate fires when more than this fraction, between 0 and 1, of
+	// the dispatches completed in Window failed.
+	FailureRate float64 `yaml:"failure_rate,omitempty" json:"failure_rate,omitempty"`
+	// Window is how far back FailureRate looks; 0 means DefaultAlertWindow.
+	Window time.Duration `yaml:"window,omitempty" json:"window,omitempty"`
+	// MinDispatches is the fewest completed dispatches in Window for
+	// FailureRate to apply, so a single failure does not page; 0 means 1.
+	MinDispatches int `yaml:"min_dispatches,omitempty" json:"min_dispatches,omitempty"`
+	// DeadLetters fires when at least this many dead letters are pending.
+	DeadLetters int `yaml:"dead_letters,omitempty" json:"dead_letters,omitempty"`
+}
+
+// Validate checks that r is named and sets exactly one threshold.
+func (r AlertRule) Validate() error {
+	switch {
+	case r.Name == "":
+		return errors.New("alert rule has no name")
+	case r.FailureRate < 0 || r.FailureRate > 1:
+		return fmt.Errorf("alert %s: failure_rate must be between 0 and 1", r.Name)
+	case r.DeadLetters < 0:
+		return fmt.Errorf("alert %s: dead_letters must not be negative", r.Name)
+	case (r.FailureRate > 0) == (r.DeadLetters > 0):
+		return fmt.Errorf("alert %s: set one of failure_rate and dead_letters", r.Name)
+	}
+	return nil
+}
+
+// Alert reports that a rule's threshold was crossed or, with Resolved,
+// that it no longer is.
+type Alert struct {
+	Rule string `json:"rule"`
+	// Kind is AlertFailureRate or AlertDeadLetters.
+	Kind     string `json:"kind"`
+	Resolved bool   `json:"resolved,omitempty"`
+	Repo     string `json:"repo,omitempty"`
+	// Value is the failure rate or the number of pending dead letters, and
+	// Threshold the rule's limit for it.
+	Value     float64 `json:"value"`
+	Threshold float64 `json:"threshold"`
+	// Failed and Completed count the dispatches a failure rate is made of.
+	Failed    int           `json:"failed,omitempty"`
+	Completed int           `json:"completed,omitempty"`
+	Window    time.Duration `json:"-"`
+	Time      time.Time     `json:"time"`
+}
+
+// Summary is a one-line plain-text description of a.
+func (a Alert) Summary() string {
+	scope := "all repositories"
+	if a.Repo != "" {
+		scope = a.Repo
+	}
+	var s string
+	switch a.Kind {
+	case AlertFailureRate:
+		s = fmt.Sprintf("%.0f%% of dispatches to %s failed in the last %s (%d of %d; threshold %.0f%%)",
+			a.Value*100, scope, a.Window, a.Failed, a.Completed, a.Threshold*100)
+	case AlertDeadLetters:
+		s = fmt.Sprintf("%.0f dead letters are waiting to be replayed (threshold %.0f)", a.Value, a.Threshold)
+	default:
+		s = fmt.Sprintf("%s is %g (threshold %g)", a.Kind, a.Value, a.Threshold)
+	}
+	if a.Resolved {
+		return "Resolved " + a.Rule + ": " + s
+	}
+	return "Alert " + a.Rule + ": " + s
+}
+
+// Alerter delivers alerts to an on-call or chat service.
+type Alerter interface {
+	Alert(ctx context.Context, a Alert) error
+}
+
+// AlertMonitor checks its rules against the history and dead letters of a
+// correlator. An alert is sent when a rule's threshold is crossed and again,
+// resolved, once it clears; it is not repeated while the rule stays over
+// its threshold.
+type AlertMonitor struct {
+	Rules       []AlertRule
+	History     HistoryStore
+	DeadLetters DeadLetterStore
+	Alerters    []Alerter
+	// Interval is the time between checks; 0 means DefaultAlertInterval.
+	Interval time.Duration
+	// Logger receives failed checks and deliveries; nil means slog.Default().
+	Logger Logger
+	// Clock, if set, replaces the system clock for checks and the windows
+	// rules look back over.
+	Clock Clock
+
+	firing map[string]bool
+}
+
+// NewAlertMonitor creates a monitor for the history and dead letters of c.
+func NewAlertMonitor(c *RunCorrelator, rules []AlertRule, alerters ...Alerter) *AlertMonitor {
+	return &AlertMonitor{Rules: rules, History: c.History, DeadLetters: c.DeadLetters, Alerters: alerters, Clock: c.Clock}
+}
+
+// Run checks the rules every Interval until ctx is cancelled.
+func (m *AlertMonitor) Run(ctx context.Context) {
+	interval := m.Interval
+	if interval <= 0 {
+		interval = DefaultAlertInterval
+	}
+	clock := ClockOr(m.Clock)
+	for {
+		if err := m.Check(ctx); err != nil {
+			LoggerOr(m.Logger).Error("alert check failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-clock.After(interval):
+		}
+	}
+}
+
+// Check evaluates every rule once and sends the alerts that changed state.
+// Errors evaluating rules or delivering alerts are joined; a rule whose
+// alert could not be delivered to every alerter is sent again next time.
+func (m *AlertMonitor) Check(ctx context.Context) error {
+	if m.firing == nil {
+		m.firing = map[string]bool{}
+	}
+	now := ClockOr(m.Clock).Now()
+	var errs []error
+	for _, r := range m.Rules {
+		a, over, err := m.evaluate(r, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("alert %s: %w", r.Name, err))
+			continue
+		}
+		if over == m.firing[r.Name] {
+			continue
+		}
+		a.Resolved = !over
+		if err := m.send(ctx, a); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		m.firing[r.Name] = over
+	}
+	return errors.Join(errs...)
+}
+
+// evaluate measures r at now and reports whether it is over its threshold.
+func (m *AlertMonitor) evaluate(r AlertRule, now time.Time) (Alert, bool, error) {
+	a := Alert{Rule: r.Name, Repo: r.Repo, Time: now.UTC()}
+	if r.DeadLetters > 0 {
+		a.Kind, a.Repo, a.Threshold = AlertDeadLetters, "", float64(r.DeadLetters)
+		if m.DeadLetters == nil {
+			return a, false, errors.New("no dead-letter store")
+		}
+		all, err := m.DeadLetters.List()
+		if err != nil {
+			return a, false, err
+		}
+		for _, d := range all {
+			if d.Pending() {
+				a.Value++
+			}
+		}
+		return a, a.Value >= a.Threshold, nil
+	}
+
+	a.Kind, a.Threshold, a.Window = AlertFailureRate, r.FailureRate, r.Window
+	if a.Window <= 0 {
+		a.Window = DefaultAlertWindow
+	}
+	recs, err := QueryHistory(m.History, HistoryQuery{Repo: r.Repo, Since: now.Add(-a.Window), Status: HistoryCompleted})
+	if err != nil {
+		return a, false, err
+	}
+	for _, rec := range recs {
+		a.Completed++
+		if rec.Failed() {
+			a.Failed++
+		}
+	}
+	if a.Completed == 0 || a.Completed < r.MinDispatches {
+		return a, false, nil
+	}
+	a.Value = float64(a.Failed) / float64(a.Completed)
+	return a, a.Value > a.Threshold, nil
+}
+
+func (m *AlertMonitor) send(ctx context.Context, a Alert) error {
+	var errs []error
+	for _, al := range m.Alerters {
+		actx, cancel := context.WithTimeout(ctx, notifyTimeout)
+		if err := al.Alert(actx, a); err != nil {
+			errs = append(errs, fmt.Errorf("alert %s: %w", a.Rule, err))
+		}
+		cancel()
+	}
+	return errors.Join(errs...)
+}
+
+// WebhookAlerter posts each alert as JSON to a URL, with the alert's
+// Summary in a summary field.
+type WebhookAlerter struct {
+	URL string
+	// Headers are added to every request, e.g. an Authorization header.
+	Headers    map[string]string
+	HTTPClient *http.Client
+}
+
+// Alert posts a to the webhook.
+func (w *WebhookAlerter) Alert(ctx context.Context, a Alert) error {
+	body, err := json.Marshal(struct {
+		Alert
+		Summary string `json:"summary"`
+	}{a, a.Summary()})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := httpClientOr(w.HTTPClient).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("alert webhook: unexpected status code: %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package flow_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+// alertRecorder is an Alerter keeping what it was sent, failing with err
+// if set.
+type alertRecorder struct {
+	alerts []flow.Alert
+	err    error
+}
+
+func (r *alertRecorder) Alert(_ context.Context, a flow.Alert) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.alerts = append(r.alerts, a)
+	return nil
+}
+
+func TestAlertRuleValidate(t *testing.T) {
+	tests := []struct {
+		rule    flow.AlertRule
+		wantErr string
+	}{
+		{rule: flow.AlertRule{Name: "r", FailureRate: 0.5}},
+		{rule: flow.AlertRule{Name: "r", FailureRate: 1}},
+		{rule: flow.AlertRule{Name: "r", DeadLetters: 1}},
+		{rule: flow.AlertRule{FailureRate: 0.5}, wantErr: "no name"},
+		{rule: flow.AlertRule{Name: "r", FailureRate: 1.5}, wantErr: "between 0 and 1"},
+		{rule: flow.AlertRule{Name: "r", FailureRate: -0.1}, wantErr: "between 0 and 1"},
+		{rule: flow.AlertRule{Name: "r", DeadLetters: -1}, wantErr: "must not be negative"},
+		{rule: flow.AlertRule{Name: "r"}, wantErr: "set one of"},
+		{rule: flow.AlertRule{Name: "r", FailureRate: 0.5, DeadLetters: 1}, wantErr: "set one of"},
+	}
+	for _, tt := range tests {
+		err := tt.rule.Validate()
+		if (err == nil) != (tt.wantErr == "") || (err != nil && !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("Validate(%+v) = %v, want %q", tt.rule, err, tt.wantErr)
+		}
+	}
+}
+
+func TestAlertSummary(t *testing.T) {
+	tests := []struct {
+		a    flow.Alert
+		want string
+	}{
+		{
+			a:    flow.Alert{Rule: "failing", Kind: flow.AlertFailureRate, Value: 0.5, Threshold: 0.25, Failed: 2, Completed: 4, Window: 30 * time.Minute},
+			want: "Alert failing: 50% of dispatches to all repositories failed in the last 30m0s (2 of 4; threshold 25%)",
+		},
+		{
+			a:    flow.Alert{Rule: "site", Kind: flow.AlertFailureRate, Repo: "o/r", Resolved: true, Window: time.Hour},
+			want: "Resolved site: 0% of dispatches to o/r failed in the last 1h0m0s (0 of 0; threshold 0%)",
+		},
+		{
+			a:    flow.Alert{Rule: "dlq", Kind: flow.AlertDeadLetters, Value: 12, Threshold: 10},
+			want: "Alert dlq: 12 dead letters are waiting to be replayed (threshold 10)",
+		},
+		{a: flow.Alert{Rule: "x", Kind: "other", Value: 1.5, Threshold: 1}, want: "Alert x: other is 1.5 (threshold 1)"},
+	}
+	for _, tt := range tests {
+		if got := tt.a.Summary(); got != tt.want {
+			t.Errorf("Summary() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestAlertMonitor(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	clock := nodeproptest.NewClock(start)
+	dir := t.TempDir()
+	c := &flow.RunCorrelator{
+		History:     flow.NewFileHistoryStore(filepath.Join(dir, "history.json")),
+		DeadLetters: flow.NewFileDeadLetterStore(filepath.Join(dir, "deadletters.json")),
+		Clock:       clock,
+	}
+	var sent alertRecorder
+	m := flow.NewAlertMonitor(c, []flow.AlertRule{
+		{Name: "failing", FailureRate: 0.4, Window: 10 * time.Minute, MinDispatches: 3},
+		{Name: "failing-site", Repo: "o/site", FailureRate: 0.4},
+		{Name: "dlq", DeadLetters: 2},
+	}, &sent)
+
+	var n int
+	complete := func(repo, conclusion string) {
+		n++
+		rec := flow.DispatchRecord{ID: string(rune('a' + n)), Repo: repo, DispatchedAt: clock.Now(), Status: "completed", Conclusion: conclusion}
+		if err := c.History.Append(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// check runs the monitor and returns "rule" or "rule resolved" for
+	// each alert sent.
+	check := func() []string {
+		t.Helper()
+		sent.alerts = nil
+		if err := m.Check(context.Background()); err != nil {
+			t.Fatalf("Check() error = %v", err)
+		}
+		var out []string
+		for _, a := range sent.alerts {
+			s := a.Rule
+			if a.Resolved {
+				s += " resolved"
+			}
+			out = append(out, s)
+		}
+		return out
+	}
+	steps := []struct {
+		name string
+		do   func()
+		want string
+	}{
+		{name: "nothing yet", do: func() {}},
+		{name: "below min dispatches", do: func() { complete("o/api", "failure"); complete("o/api", "failure") }},
+		{name: "over both rates", do: func() { complete("o/site", "failure") }, want: "failing,failing-site"},
+		{name: "not repeated", do: func() { complete("o/api", "success") }},
+		{name: "site recovers", do: func() { complete("o/site", "success"); complete("o/site", "success") }, want: "failing-site resolved"},
+		{name: "window passes", do: func() { clock.Advance(11 * time.Minute) }, want: "failing resolved"},
+		{name: "dead letters", do: func() {
+			c.DeadLetters.Add(flow.DeadLetter{ID: "x"})
+			c.DeadLetters.Add(flow.DeadLetter{ID: "y"})
+		}, want: "dlq"},
+		{name: "replayed", do: func() { c.DeadLetters.Update(flow.DeadLetter{ID: "x", ReplayedAs: "z"}) }, want: "dlq resolved"},
+	}
+	for _, step := range steps {
+		step.do()
+		if got := strings.Join(check(), ","); got != step.want {
+			t.Errorf("%s: sent %q, want %q", step.name, got, step.want)
+		}
+	}
+}
+
+func TestAlertMonitorRetriesDelivery(t *testing.T) {
+	clock := nodeproptest.NewClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	dls := flow.NewFileDeadLetterStore(filepath.Join(t.TempDir(), "deadletters.json"))
+	dls.Add(flow.DeadLetter{ID: "x"})
+	failing := &alertRecorder{err: errors.New("pager down")}
+	var ok alertRecorder
+	m := &flow.AlertMonitor{Rules: []flow.AlertRule{{Name: "dlq", DeadLetters: 1}}, DeadLetters: dls, Alerters: []flow.Alerter{&ok, failing}, Clock: clock}
+
+	if err := m.Check(context.Background()); err == nil || !strings.Contains(err.Error(), "pager down") {
+		t.Fatalf("Check() error = %v", err)
+	}
+	failing.err = nil
+	if err := m.Check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(ok.alerts) != 2 || len(failing.alerts) != 1 {
+		t.Errorf("sent %d and %d alerts, want the alert sent again to both", len(ok.alerts), len(failing.alerts))
+	}
+
+	noStore := &flow.AlertMonitor{Rules: []flow.AlertRule{{Name: "dlq", DeadLetters: 1}}, Clock: clock}
+	if err := noStore.Check(context.Background()); err == nil || !strings.Contains(err.Error(), "no dead-letter store") {
+		t.Errorf("Check() without a store error = %v", err)
+	}
+}
+
+func TestWebhookAlerter(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{name: "accepted", status: http.StatusAccepted},
+		{name: "rejected", status: http.StatusForbidden, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got map[string]interface{}
+			var auth string
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				auth = r.Header.Get("Authorization")
+				json.NewDecoder(r.Body).Decode(&got)
+				w.WriteHeader(tt.status)
+			}))
+			defer ts.Close()
+			w := &flow.WebhookAlerter{URL: ts.URL, Headers: map[string]string{"Authorization": "Bearer t"}}
+			a := flow.Alert{Rule: "dlq", Kind: flow.AlertDeadLetters, Value: 3, Threshold: 2}
+
+			err := w.Alert(context.Background(), a)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Alert() error = %v", err)
+			}
+			if got["rule"] != "dlq" || got["kind"] != flow.AlertDeadLetters || got["summary"] != a.Summary() || auth != "Bearer t" {
+				t.Errorf("posted %v with Authorization %q", got, auth)
+			}
+		})
+	}
+}
@@ -0,0 +1,383 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ApprovalState is the stage an Approval is in.
+type ApprovalState string
+
+const (
+	ApprovalPending  ApprovalState = "pending"
+	ApprovalApproved ApprovalState = "approved"
+	ApprovalRejected ApprovalState = "rejected"
+	// ApprovalExpired is the state of a pending approval nobody decided
+	// before its ExpiresAt.
+	ApprovalExpired ApprovalState = "expired"
+)
+
+// DefaultApprovalTTL is how long a held dispatch waits for a decision.
+const DefaultApprovalTTL = 72 * time.Hour
+
+// approvalLockTTL bounds how long a crashed replica can block a decision.
+const approvalLockTTL = time.Minute
+
+var (
+	// ErrApprovalDecided is returned when deciding an approval that is no
+	// longer pending.
+	ErrApprovalDecided = errors.New("already decided")
+	// ErrNotApprover is returned when someone who may not decide an
+	// approval tries to.
+	ErrNotApprover = errors.New("not an approver")
+)
+
+// ApprovalPolicy says whether dispatches to a repository must be approved,
+// and who may approve them; no approvers means anyone but the requester.
+// *RepositoryRegistry implements it with the requires_approval and
+// approvers fields of its entries.
+type ApprovalPolicy interface {
+	ApprovalRule(repo string) (required bool, approvers []string)
+}
+
+// ApprovalDecision is one entry in an approval's audit trail.
+type ApprovalDecision struct {
+	By       string    `json:"by"`
+	Approved bool      `json:"approved"`
+	Comment  string    `json:"comment,omitempty"`
+	At       time.Time `json:"at"`
+}
+
+// Approval is a dispatch held until an approver allows or rejects it.
+type Approval struct {
+	ID             string            `json:"id"`
+	Repo           string            `json:"repo"`
+	Workflow       string            `json:"workflow"`
+	Ref            string            `json:"ref"`
+	Inputs         map[string]string `json:"inputs,omitempty"`
+	IdempotencyKey string            `json:"idempotency_key,omitempty"`
+	Schedule       string            `json:"schedule,omitempty"`
+	ScheduledFor   time.Time         `json:"scheduled_for,omitempty"`
+	RequestedBy    string            `json:"requested_by,omitempty"`
+	RequestedAt    time.Time         `json:"requested_at"`
+	ExpiresAt      time.Time         `json:"expires_at"`
+	// Approvers are the identities that may decide, as the policy named
+	// them when the dispatch was held.
+	Approvers []string           `json:"approvers,omitempty"`
+	State     ApprovalState      `json:"state"`
+	Decisions []ApprovalDecision `json:"decisions,omitempty"`
+	// DispatchID is the dispatch made once approved; Error is set instead
+	// if GitHub rejected it.
+	DispatchID string `json:"dispatch_id,omitempty"`
+	Error      string `json:"error,omitempty"`
+	// CorrelationID is the operation the held dispatch belongs to; the
+	// approved dispatch keeps it.
+	CorrelationID string `json:"correlation_id,omitempty"`
+}
+
+// CurrentState returns the approval's state at now, which is
+// ApprovalExpired for a pending approval past its ExpiresAt.
+func (a *Approval) CurrentState(now time.Time) ApprovalState {
+	if a.State == ApprovalPending && now.After(a.ExpiresAt) {
+		return ApprovalExpired
+	}
+	return a.State
+}
+
+// checkDecider returns an error wrapping ErrNotApprover if by may not
+// decide a.
+func (a *Approval) checkDecider(by string, approve bool) error {
+	// Requesters may withdraw their own dispatches, not approve them.
+	if approve && a.RequestedBy != "" && by == a.RequestedBy {
+		return fmt.Errorf("%w: %s requested approval %s", ErrNotApprover, by, a.ID)
+	}
+	if len(a.Approvers) == 0 {
+		return nil
+	}
+	for _, ap := range a.Approvers {
+		if ap == by {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s is not among the approvers of %s", ErrNotApprover, by, a.ID)
+}
+
+// ApprovalRequiredError is returned by Submit when a dispatch was held for
+// approval instead of being sent.
+type ApprovalRequiredError struct {
+	Approval Approval
+}
+
+func (e *ApprovalRequiredError) Error() string {
+	return fmt.Sprintf("dispatch of %s in %s awaits approval %s", e.Approval.Workflow, e.Approval.Repo, e.Approval.ID)
+}
+
+// ApprovalStore persists approvals.
+type ApprovalStore interface {
+	Add(a Approval) error
+	Update(a Approval) error
+	List() ([]Approval, error)
+}
+
+// FindApproval returns the approval with the given ID.
+func FindApproval(s ApprovalStore, id string) (Approval, bool, error) {
+	all, err := s.List()
+	if err != nil {
+		return Approval{}, false, err
+	}
+	for _, a := range all {
+		if a.ID == id {
+			return a, true, nil
+		}
+	}
+	return Approval{}, false, nil
+}
+
+// FileApprovalStore keeps approvals in a JSON file.
+type FileApprovalStore struct {
+	Path string
+	mu   sync.Mutex
+}
+
+// NewFileApprovalStore creates a FileApprovalStore backed by path.
+func NewFileApprovalStore(path string) *FileApprovalStore {
+	return &FileApprovalStore{Path: path}
+}
+
+// DefaultApprovalPath returns the per-user location of the approvals file.
+func DefaultApprovalPath() string {
+	return filepath.Join(filepath.Dir(DefaultHistoryPath()), "approvals.json")
+}
+
+// Add stores a new approval.
+func (s *FileApprovalStore) Add(a Approval) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all, err := s.load()
+	if err != nil {
+		return err
+	}
+	return s.save(append(all, a))
+}
+
+// Update replaces the approval with the same ID.
+func (s *FileApprovalStore) Update(a Approval) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all, err := s.load()
+	if err != nil {
+		return err
+	}
+	for i := range all {
+		if all[i].ID == a.ID {
+			all[i] = a
+			return s.save(all)
+		}
+	}
+	return fmt.Errorf("approval %s not found", a.ID)
+}
+
+// List returns every approval, newest first.
+func (s *FileApprovalStore) List() ([]Approval, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].RequestedAt.After(all[j].RequestedAt) })
+	return all, nil
+}
+
+func (s *FileApprovalStore) load() ([]Approval, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read approvals: %w", err)
+	}
+	var all []Approval
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, fmt.Errorf("failed to parse approvals %s: %w", s.Path, err)
+	}
+	return all, nil
+}
+
+func (s *FileApprovalStore) save(all []Approval) error {
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal approvals: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o755); err != nil {
+		return fmt.Errorf("failed to create approvals dir: %w", err)
+	}
+	tmp := s.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write approvals: %w", err)
+	}
+	return os.Rename(tmp, s.Path)
+}
+
+// holdForApproval returns, as an *ApprovalRequiredError, the approval
+// holding req if c.ApprovalPolicy requires one. A request with the
+// idempotency key of an undecided approval is held by that approval rather
+// than a new one.
+func (c *RunCorrelator) holdForApproval(req DispatchRequest) error {
+	if c.Approvals == nil || c.ApprovalPolicy == nil || req.Approval != "" {
+		return nil
+	}
+	required, approvers := c.ApprovalPolicy.ApprovalRule(req.Repo)
+	if !required {
+		return nil
+	}
+	now := ClockOr(c.Clock).Now().UTC()
+	if req.IdempotencyKey != "" {
+		all, err := c.Approvals.List()
+		if err != nil {
+			return err
+		}
+		for _, a := range all {
+			if a.Repo != req.Repo || a.IdempotencyKey != req.IdempotencyKey {
+				continue
+			}
+			switch a.CurrentState(now) {
+			case ApprovalPending:
+				return &ApprovalRequiredError{Approval: a}
+			case ApprovalRejected:
+				return fmt.Errorf("dispatch of %s in %s was rejected in approval %s", req.Workflow, req.Repo, a.ID)
+			}
+		}
+	}
+
+	id, err := newDispatchID()
+	if err != nil {
+		return err
+	}
+	ttl := c.ApprovalTTL
+	if ttl <= 0 {
+		ttl = DefaultApprovalTTL
+	}
+	a := Approval{
+		ID:             id,
+		Repo:           req.Repo,
+		Workflow:       req.Workflow,
+		Ref:            req.Ref,
+		Inputs:         req.Inputs,
+		IdempotencyKey: req.IdempotencyKey,
+		Schedule:       req.Schedule,
+		ScheduledFor:   req.ScheduledFor,
+		RequestedBy:    req.RequestedBy,
+		RequestedAt:    now,
+		ExpiresAt:      now.Add(ttl),
+		Approvers:      approvers,
+		State:          ApprovalPending,
+		CorrelationID:  req.CorrelationID,
+	}
+	if err := c.Approvals.Add(a); err != nil {
+		return fmt.Errorf("failed to hold dispatch for approval: %w", err)
+	}
+	c.Events.Publish(Event{Type: EventApprovalRequested, ApprovalID: a.ID, CorrelationID: a.CorrelationID, Repo: a.Repo, Workflow: a.Workflow, Actor: a.RequestedBy})
+	return &ApprovalRequiredError{Approval: a}
+}
+
+// Approve records by's approval of a held dispatch and sends it. The
+// approval is returned with the dispatch; if GitHub rejects the dispatch,
+// the approval keeps the error and the dispatch is dead-lettered as usual.
+func (c *RunCorrelator) Approve(ctx context.Context, id, by, comment string) (*Approval, *DispatchRecord, error) {
+	a, err := c.decide(ctx, id, by, comment, true)
+	if err != nil {
+		return a, nil, err
+	}
+	key := a.IdempotencyKey
+	if key == "" {
+		key = "approval:" + a.ID
+	}
+	rec, err := c.Submit(ctx, DispatchRequest{
+		Repo:           a.Repo,
+		Workflow:       a.Workflow,
+		Ref:            a.Ref,
+		Inputs:         a.Inputs,
+		IdempotencyKey: key,
+		Schedule:       a.Schedule,
+		ScheduledFor:   a.ScheduledFor,
+		RequestedBy:    a.RequestedBy,
+		Approval:       a.ID,
+		CorrelationID:  a.CorrelationID,
+	})
+	if rec != nil {
+		a.DispatchID = rec.ID
+	}
+	if err != nil && !errors.Is(err, ErrAlreadyDispatched) {
+		a.Error = err.Error()
+	}
+	if uerr := c.Approvals.Update(*a); uerr != nil && err == nil {
+		err = fmt.Errorf("dispatched %s but failed to update approval: %w", rec.ID, uerr)
+	}
+	return a, rec, err
+}
+
+// Reject records by's rejection of a held dispatch, which is then never
+// sent.
+func (c *RunCorrelator) Reject(ctx context.Context, id, by, comment string) (*Approval, error) {
+	return c.decide(ctx, id, by, comment, false)
+}
+
+// decide moves a pending approval to approved or rejected, appending the
+// decision to its audit trail.
+func (c *RunCorrelator) decide(ctx context.Context, id, by, comment string, approve bool) (*Approval, error) {
+	if c.Approvals == nil {
+		return nil, errors.New("no approval store configured")
+	}
+	if c.Locker != nil {
+		lock, err := c.Locker.Acquire(ctx, "approval:"+id, approvalLockTTL)
+		if errors.Is(err, ErrLockHeld) {
+			return nil, fmt.Errorf("%w: approval %s is being decided", ErrApprovalDecided, id)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to lock approval: %w", err)
+		}
+		defer lock.Release(context.Background())
+	}
+	c.approvalMu.Lock()
+	defer c.approvalMu.Unlock()
+
+	a, ok, err := FindApproval(c.Approvals, id)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("approval %s not found", id)
+	}
+	now := ClockOr(c.Clock).Now().UTC()
+	if state := a.CurrentState(now); state != ApprovalPending {
+		if state == ApprovalExpired && a.State != state {
+			a.State = state
+			if err := c.Approvals.Update(a); err != nil {
+				return nil, err
+			}
+		}
+		return &a, fmt.Errorf("%w: approval %s is %s", ErrApprovalDecided, id, state)
+	}
+	if err := a.checkDecider(by, approve); err != nil {
+		return &a, err
+	}
+	a.Decisions = append(a.Decisions, ApprovalDecision{By: by, Approved: approve, Comment: comment, At: now})
+	a.State = ApprovalRejected
+	e := Event{Type: EventRejected, ApprovalID: a.ID, CorrelationID: a.CorrelationID, Repo: a.Repo, Workflow: a.Workflow, Actor: by}
+	if approve {
+		a.State, e.Type = ApprovalApproved, EventApproved
+	}
+	if err := c.Approvals.Update(a); err != nil {
+		return nil, err
+	}
+	c.Events.Publish(e)
+	return &a, nil
+}
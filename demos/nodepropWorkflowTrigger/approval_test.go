@@ -0,0 +1,133 @@
+package flow_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+// newApprovalCorrelator holds dispatches to Cdaprod/site for approvers.
+func newApprovalCorrelator(t *testing.T, approvers ...string) (*flow.RunCorrelator, *nodeproptest.Server, *nodeproptest.Clock) {
+	t.Helper()
+	gh := nodeproptest.NewServer()
+	t.Cleanup(gh.Close)
+	gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+	c := newCorrelator(t, gh)
+	reg := flow.NewRepositoryRegistry()
+	reg.RegisterRepo("Cdaprod/site", nil, []string{"deploy.yml"})
+	if err := reg.SetApproval("Cdaprod/site", true, approvers); err != nil {
+		t.Fatal(err)
+	}
+	c.ApprovalPolicy = reg
+	c.Approvals = flow.NewFileApprovalStore(filepath.Join(t.TempDir(), "approvals.json"))
+	clock := nodeproptest.NewClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	c.Clock = clock
+	return c, gh, clock
+}
+
+// hold submits a dispatch requested by "bob" and returns its approval.
+func hold(t *testing.T, c *flow.RunCorrelator, key string) flow.Approval {
+	t.Helper()
+	_, err := c.Submit(context.Background(), flow.DispatchRequest{Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "main", RequestedBy: "bob", IdempotencyKey: key})
+	var held *flow.ApprovalRequiredError
+	if !errors.As(err, &held) {
+		t.Fatalf("Submit() error = %v, want an ApprovalRequiredError", err)
+	}
+	return held.Approval
+}
+
+func TestApprovalDecisions(t *testing.T) {
+	tests := []struct {
+		name      string
+		approvers []string
+		by        string
+		approve   bool
+		wantErr   error
+		want      flow.ApprovalState
+	}{
+		{name: "anyone approves", by: "carol", approve: true, want: flow.ApprovalApproved},
+		{name: "requester may not approve", by: "bob", approve: true, wantErr: flow.ErrNotApprover, want: flow.ApprovalPending},
+		{name: "requester may withdraw", by: "bob", want: flow.ApprovalRejected},
+		{name: "listed approver", approvers: []string{"alice"}, by: "alice", approve: true, want: flow.ApprovalApproved},
+		{name: "unlisted approver", approvers: []string{"alice"}, by: "carol", approve: true, wantErr: flow.ErrNotApprover, want: flow.ApprovalPending},
+		{name: "unlisted rejecter", approvers: []string{"alice"}, by: "bob", wantErr: flow.ErrNotApprover, want: flow.ApprovalPending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, gh, _ := newApprovalCorrelator(t, tt.approvers...)
+			a := hold(t, c, "")
+			if len(gh.Dispatches()) != 0 {
+				t.Fatal("a held dispatch was sent")
+			}
+			var err error
+			if tt.approve {
+				_, _, err = c.Approve(context.Background(), a.ID, tt.by, "ok")
+			} else {
+				_, err = c.Reject(context.Background(), a.ID, tt.by, "no")
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("decision error = %v, want %v", err, tt.wantErr)
+			}
+			got, _, _ := flow.FindApproval(c.Approvals, a.ID)
+			if got.State != tt.want {
+				t.Errorf("state = %s, want %s", got.State, tt.want)
+			}
+			if sent := len(gh.Dispatches()); (sent == 1) != (tt.want == flow.ApprovalApproved) {
+				t.Errorf("%d dispatches sent for a %s approval", sent, got.State)
+			}
+		})
+	}
+}
+
+func TestApprove(t *testing.T) {
+	c, gh, clock := newApprovalCorrelator(t)
+	ctx := context.Background()
+	a := hold(t, c, "delivery-1")
+	if again := hold(t, c, "delivery-1"); again.ID != a.ID {
+		t.Errorf("resubmitting held %s, want the pending %s", again.ID, a.ID)
+	}
+
+	clock.Advance(time.Hour)
+	got, rec, err := c.Approve(ctx, a.ID, "alice", "ship it")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.State != flow.ApprovalApproved || got.DispatchID != rec.ID || rec.Approval != a.ID || len(got.Decisions) != 1 || got.Decisions[0].Comment != "ship it" {
+		t.Errorf("Approve() = %+v, %+v", got, rec)
+	}
+	if ds := gh.Dispatches(); len(ds) != 1 {
+		t.Errorf("dispatches = %+v, want the approved one", ds)
+	}
+	if _, err := c.Reject(ctx, a.ID, "alice", ""); !errors.Is(err, flow.ErrApprovalDecided) {
+		t.Errorf("Reject() of an approved dispatch error = %v, want ErrApprovalDecided", err)
+	}
+	if _, _, err := c.Approve(ctx, "missing", "alice", ""); err == nil {
+		t.Error("Approve() of a missing approval succeeded")
+	}
+}
+
+func TestApprovalExpiry(t *testing.T) {
+	c, gh, clock := newApprovalCorrelator(t)
+	c.ApprovalTTL = time.Hour
+	a := hold(t, c, "")
+	if a.ExpiresAt != a.RequestedAt.Add(time.Hour) {
+		t.Errorf("ExpiresAt = %v, want an hour after %v", a.ExpiresAt, a.RequestedAt)
+	}
+	if a.CurrentState(clock.Now().Add(time.Hour)) != flow.ApprovalPending {
+		t.Error("approval expired at its ExpiresAt")
+	}
+
+	clock.Advance(time.Hour + time.Second)
+	if _, _, err := c.Approve(context.Background(), a.ID, "alice", ""); !errors.Is(err, flow.ErrApprovalDecided) {
+		t.Errorf("Approve() of an expired approval error = %v, want ErrApprovalDecided", err)
+	}
+	got, _, _ := flow.FindApproval(c.Approvals, a.ID)
+	if got.State != flow.ApprovalExpired || len(gh.Dispatches()) != 0 {
+		t.Errorf("state = %s with %d dispatches, want expired and none", got.State, len(gh.Dispatches()))
+	}
+}
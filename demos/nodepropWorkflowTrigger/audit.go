@@ -0,0 +1,180 @@
+package flow
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Audit results.
+const (
+	AuditDispatched = "dispatched"
+	AuditDuplicate  = "duplicate"
+	AuditHeld       = "held"
+	AuditFailed     = "failed"
+)
+
+// AuditEntry records one submitted dispatch for change-management audits.
+// Inputs are not stored, only a hash of them and the ref, and the token is
+// identified by its fingerprint.
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	// Actor is who requested the dispatch, e.g. key:ci or slack:U123.
+	Actor    string `json:"actor,omitempty"`
+	Repo     string `json:"repo"`
+	Workflow string `json:"workflow"`
+	Ref      string `json:"ref,omitempty"`
+	// ParamsHash is ParamsHash of the ref and inputs.
+	ParamsHash string `json:"params_hash"`
+	// Result is AuditDispatched, AuditDuplicate, AuditHeld, or AuditFailed.
+	Result           string `json:"result"`
+	Error            string `json:"error,omitempty"`
+	DispatchID       string `json:"dispatch_id,omitempty"`
+	Attempts         int    `json:"attempts,omitempty"`
+	TokenFingerprint string `json:"token_fingerprint,omitempty"`
+	IdempotencyKey   string `json:"idempotency_key,omitempty"`
+	Approval         string `json:"approval,omitempty"`
+	ReplayOf         string `json:"replay_of,omitempty"`
+	Schedule         string `json:"schedule,omitempty"`
+	CorrelationID    string `json:"correlation_id,omitempty"`
+}
+
+// AuditSink stores audit entries. Sinks only append; entries are never
+// changed or removed through them.
+type AuditSink interface {
+	Record(ctx context.Context, e AuditEntry) error
+}
+
+// AuditSinks records each entry in every sink.
+type AuditSinks []AuditSink
+
+// Record records e in every sink, returning the failures joined.
+func (s AuditSinks) Record(ctx context.Context, e AuditEntry) error {
+	var errs []error
+	for _, sink := range s {
+		if err := sink.Record(ctx, e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ParamsHash returns a digest identifying a dispatch's ref and inputs,
+// "sha256:" followed by hex. Equal parameters hash equally regardless of
+// input order.
+func ParamsHash(ref string, inputs map[string]string) string {
+	// The digest is of the JSON object {"ref": ref, "inputs": inputs}, with
+	// the keys of inputs in sorted order.
+	buf := getBuffer()
+	defer putBuffer(buf)
+	buf.WriteString(`{"ref":`)
+	writeJSONString(buf, ref)
+	buf.WriteString(`,"inputs":`)
+	writeInputs(buf, inputs)
+	buf.WriteByte('}')
+	sum := sha256.Sum256(buf.Bytes())
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// TokenFingerprint identifies a token without revealing it: the first 16
+// hex digits of its SHA-256. It is empty for an empty token.
+func TokenFingerprint(token string) string {
+	if token == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// audit records the outcome of a submission in c.Audit. A failure to
+// record is logged rather than returned, since the dispatch has happened.
+func (c *RunCorrelator) audit(ctx context.Context, req DispatchRequest, id string, attempts int, err error) {
+	if c.Audit == nil {
+		return
+	}
+	e := AuditEntry{
+		Time:           ClockOr(c.Clock).Now().UTC(),
+		Actor:          req.RequestedBy,
+		Repo:           req.Repo,
+		Workflow:       req.Workflow,
+		Ref:            req.Ref,
+		ParamsHash:     ParamsHash(req.Ref, req.Inputs),
+		Result:         AuditDispatched,
+		DispatchID:     id,
+		Attempts:       attempts,
+		IdempotencyKey: req.IdempotencyKey,
+		Approval:       req.Approval,
+		ReplayOf:       req.ReplayOf,
+		Schedule:       req.Schedule,
+		CorrelationID:  req.CorrelationID,
+	}
+	if e.Actor == "" {
+		e.Actor = c.Actor
+	}
+	if c.Client != nil {
+		e.TokenFingerprint = TokenFingerprint(c.Client.currentToken())
+	}
+	var approval *ApprovalRequiredError
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrAlreadyDispatched):
+		e.Result = AuditDuplicate
+	case errors.As(err, &approval):
+		e.Result, e.Approval = AuditHeld, approval.Approval.ID
+	default:
+		e.Result, e.Error = AuditFailed, err.Error()
+	}
+	if aerr := c.Audit.Record(context.WithoutCancel(ctx), e); aerr != nil {
+		LoggerOr(c.Logger).Error("failed to record audit entry", "correlation_id", req.CorrelationID, "repo", req.Repo, "workflow", req.Workflow, "dispatch_id", id, "error", aerr)
+	}
+}
+
+// FileAuditSink appends entries to a file as JSON lines. The file is opened
+// for appending only and synced after every entry.
+type FileAuditSink struct {
+	Path string
+	mu   sync.Mutex
+}
+
+// NewFileAuditSink creates a FileAuditSink writing to path.
+func NewFileAuditSink(path string) *FileAuditSink {
+	return &FileAuditSink{Path: path}
+}
+
+// DefaultAuditPath returns the per-user location of the audit log.
+func DefaultAuditPath() string {
+	return filepath.Join(filepath.Dir(DefaultHistoryPath()), "audit.jsonl")
+}
+
+// Record appends e to the file.
+func (s *FileAuditSink) Record(_ context.Context, e AuditEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to append to audit log %s: %w", s.Path, err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,205 @@
+package flow_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+// auditRecorder is an AuditSink keeping entries in memory.
+type auditRecorder struct {
+	mu      sync.Mutex
+	entries []flow.AuditEntry
+	err     error
+}
+
+func (r *auditRecorder) Record(_ context.Context, e flow.AuditEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, e)
+	return r.err
+}
+
+func TestParamsHash(t *testing.T) {
+	base := flow.ParamsHash("main", map[string]string{"a": "1", "b": "2"})
+	tests := []struct {
+		name   string
+		ref    string
+		inputs map[string]string
+		same   bool
+	}{
+		{name: "same", ref: "main", inputs: map[string]string{"b": "2", "a": "1"}, same: true},
+		{name: "other ref", ref: "dev", inputs: map[string]string{"a": "1", "b": "2"}},
+		{name: "other value", ref: "main", inputs: map[string]string{"a": "1", "b": "3"}},
+		{name: "fewer inputs", ref: "main", inputs: map[string]string{"a": "1"}},
+		{name: "value moved into the key", ref: "main", inputs: map[string]string{"a": "1", "b\":\"2": ""}},
+	}
+	if !strings.HasPrefix(base, "sha256:") || len(base) != len("sha256:")+64 {
+		t.Fatalf("ParamsHash() = %q", base)
+	}
+	for _, tt := range tests {
+		if got := flow.ParamsHash(tt.ref, tt.inputs); (got == base) != tt.same {
+			t.Errorf("%s: ParamsHash() = %s, equal to the base: %v", tt.name, got, got == base)
+		}
+	}
+}
+
+func TestTokenFingerprint(t *testing.T) {
+	if got := flow.TokenFingerprint(""); got != "" {
+		t.Errorf("TokenFingerprint(\"\") = %q", got)
+	}
+	fp := flow.TokenFingerprint("ghp_secret")
+	if !strings.HasPrefix(fp, "sha256:") || len(fp) != len("sha256:")+16 || strings.Contains(fp, "secret") {
+		t.Errorf("TokenFingerprint() = %q", fp)
+	}
+	if fp == flow.TokenFingerprint("ghp_secreu") || fp != flow.TokenFingerprint("ghp_secret") {
+		t.Error("TokenFingerprint() does not identify the token")
+	}
+}
+
+func TestSubmitAudit(t *testing.T) {
+	tests := []struct {
+		name       string
+		req        flow.DispatchRequest
+		fault      *nodeproptest.Fault
+		held       bool
+		repeat     bool
+		wantResult string
+	}{
+		{name: "dispatched", req: flow.DispatchRequest{RequestedBy: "key:ci"}, wantResult: flow.AuditDispatched},
+		{name: "actor defaults to the correlator's", wantResult: flow.AuditDispatched},
+		{name: "failed", fault: &nodeproptest.Fault{Status: 422}, wantResult: flow.AuditFailed},
+		{name: "duplicate", req: flow.DispatchRequest{IdempotencyKey: "delivery-1"}, repeat: true, wantResult: flow.AuditDuplicate},
+		{name: "held", req: flow.DispatchRequest{RequestedBy: "bob"}, held: true, wantResult: flow.AuditHeld},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c *flow.RunCorrelator
+			var gh *nodeproptest.Server
+			if tt.held {
+				c, gh, _ = newApprovalCorrelator(t)
+			} else {
+				gh = nodeproptest.NewServer()
+				defer gh.Close()
+				gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+				c = newCorrelator(t, gh)
+			}
+			if tt.fault != nil {
+				f := *tt.fault
+				f.Path = "/repos/*/*/actions/workflows/*/dispatches"
+				gh.Inject(f)
+			}
+			var sink auditRecorder
+			c.Audit = &sink
+			c.Actor = "local:alice"
+			req := tt.req
+			req.Repo, req.Workflow, req.Ref = "Cdaprod/site", "deploy.yml", "main"
+			req.Inputs = map[string]string{"note": "s3cret-value"}
+
+			rec, _ := c.Submit(context.Background(), req)
+			if tt.repeat {
+				c.Submit(context.Background(), req)
+			}
+			if len(sink.entries) == 0 {
+				t.Fatal("nothing audited")
+			}
+			e := sink.entries[len(sink.entries)-1]
+			if e.Result != tt.wantResult {
+				t.Errorf("Result = %q, want %q (error %q)", e.Result, tt.wantResult, e.Error)
+			}
+			wantActor := req.RequestedBy
+			if wantActor == "" {
+				wantActor = "local:alice"
+			}
+			if e.Actor != wantActor || e.Repo != req.Repo || e.Ref != "main" || e.ParamsHash != flow.ParamsHash("main", req.Inputs) || e.CorrelationID == "" {
+				t.Errorf("entry = %+v", e)
+			}
+			if e.TokenFingerprint != flow.TokenFingerprint(nodeproptest.DefaultToken) {
+				t.Errorf("TokenFingerprint = %q", e.TokenFingerprint)
+			}
+			if (e.Error != "") != (tt.wantResult == flow.AuditFailed) || (tt.held && e.Approval == "") {
+				t.Errorf("Error = %q, Approval = %q", e.Error, e.Approval)
+			}
+			if rec != nil && e.DispatchID != rec.ID {
+				t.Errorf("DispatchID = %q, want %s", e.DispatchID, rec.ID)
+			}
+			data, _ := json.Marshal(e)
+			if strings.Contains(string(data), "s3cret-value") {
+				t.Errorf("entry %s holds an input value", data)
+			}
+		})
+	}
+}
+
+func TestSubmitAuditFailureIsLogged(t *testing.T) {
+	gh := nodeproptest.NewServer()
+	defer gh.Close()
+	gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+	var logs logRecorder
+	c := newCorrelator(t, gh)
+	c.Logger = logs.logger()
+	c.Audit = &auditRecorder{err: errors.New("disk full")}
+	if _, err := c.Submit(context.Background(), flow.DispatchRequest{Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "main"}); err != nil {
+		t.Fatalf("Submit() error = %v, want the dispatch to stand", err)
+	}
+	got, _ := logs.records(t)
+	if len(got) != 2 || got[1] != "ERROR failed to record audit entry" {
+		t.Errorf("logged %q", got)
+	}
+}
+
+func TestAuditSinks(t *testing.T) {
+	ok, failing := &auditRecorder{}, &auditRecorder{err: errors.New("unavailable")}
+	err := flow.AuditSinks{failing, ok}.Record(context.Background(), flow.AuditEntry{Repo: "o/r"})
+	if err == nil || err.Error() != "unavailable" {
+		t.Errorf("Record() error = %v", err)
+	}
+	if len(ok.entries) != 1 {
+		t.Error("a failing sink kept the entry from the others")
+	}
+}
+
+func TestFileAuditSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "audit.jsonl")
+	s := flow.NewFileAuditSink(path)
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, id := range []string{"a", "b"} {
+		if err := s.Record(context.Background(), flow.AuditEntry{Time: at, Repo: "o/r", DispatchID: id, Result: flow.AuditDispatched}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A new sink on the same file appends.
+	if err := flow.NewFileAuditSink(path).Record(context.Background(), flow.AuditEntry{DispatchID: "c"}); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var ids []string
+	for sc := bufio.NewScanner(f); sc.Scan(); {
+		var e flow.AuditEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("line %q: %v", sc.Text(), err)
+		}
+		ids = append(ids, e.DispatchID)
+	}
+	if strings.Join(ids, ",") != "a,b,c" {
+		t.Errorf("audit log has %v, want a,b,c", ids)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("audit log mode = %v, %v; want 0600", info.Mode(), err)
+	}
+}
@@ -0,0 +1,155 @@
+package awssecrets
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// fakeAWS serves Secrets Manager's GetSecretValue and SSM's GetParameter
+// from values, keyed by secret or parameter name.
+type fakeAWS struct {
+	mu       sync.Mutex
+	values   map[string]string
+	calls    int
+	decrypts []bool
+}
+
+func (f *fakeAWS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	var in struct {
+		SecretId       string
+		Name           string
+		WithDecryption bool
+	}
+	json.NewDecoder(r.Body).Decode(&in)
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	name := in.SecretId + in.Name
+	v, ok := f.values[name]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"__type": "ResourceNotFoundException", "message": name + " not found"})
+		return
+	}
+	switch r.Header.Get("X-Amz-Target") {
+	case "secretsmanager.GetSecretValue":
+		json.NewEncoder(w).Encode(map[string]string{"Name": name, "SecretString": v})
+	case "AmazonSSM.GetParameter":
+		f.decrypts = append(f.decrypts, in.WithDecryption)
+		json.NewEncoder(w).Encode(map[string]interface{}{"Parameter": map[string]string{"Name": name, "Value": v}})
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func newFakeAWS(t *testing.T, values map[string]string) (*fakeAWS, *secretsmanager.Client, *ssm.Client) {
+	t.Helper()
+	f := &fakeAWS{values: values}
+	ts := httptest.NewServer(f)
+	t.Cleanup(ts.Close)
+	creds := credentials.NewStaticCredentialsProvider("AKIDEXAMPLE", "secret", "")
+	sm := secretsmanager.New(secretsmanager.Options{Region: "us-east-1", BaseEndpoint: aws.String(ts.URL), Credentials: creds})
+	p := ssm.New(ssm.Options{Region: "us-east-1", BaseEndpoint: aws.String(ts.URL), Credentials: creds})
+	return f, sm, p
+}
+
+func TestSecretsManager(t *testing.T) {
+	values := map[string]string{
+		"plain":    "ghp-plain",
+		"kv":       `{"token": "ghp-kv", "other": 1}`,
+		"not-json": "ghp-plain",
+		"empty":    "",
+	}
+	tests := []struct {
+		name    string
+		arg     string
+		want    string
+		wantErr string
+	}{
+		{name: "plain", arg: "plain", want: "ghp-plain"},
+		{name: "key", arg: "kv#token", want: "ghp-kv"},
+		{name: "missing key", arg: "kv#password", wantErr: `no key "password"`},
+		{name: "non-string key", arg: "kv#other", wantErr: `no key "other"`},
+		{name: "key of plain secret", arg: "not-json#token", wantErr: "not a JSON object"},
+		{name: "empty", arg: "empty", wantErr: "no string value"},
+		{name: "not found", arg: "missing", wantErr: "failed to read secret missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, sm, _ := newFakeAWS(t, values)
+			p, err := ParseSecretsManager(tt.arg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := p.(*SecretsManager)
+			s.Client = sm
+			for i := 0; i < 2; i++ {
+				got, err := s.Token(context.Background())
+				if tt.wantErr != "" {
+					if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+						t.Fatalf("Token() error = %v, want %q", err, tt.wantErr)
+					}
+					continue
+				}
+				if err != nil || got != tt.want {
+					t.Fatalf("Token() = %q, %v; want %q", got, err, tt.want)
+				}
+			}
+			// Values are cached; errors are not.
+			wantCalls := 1
+			if tt.wantErr != "" {
+				wantCalls = 2
+			}
+			if f.calls != wantCalls {
+				t.Errorf("%d calls, want %d", f.calls, wantCalls)
+			}
+		})
+	}
+	if _, err := ParseSecretsManager("#token"); err == nil {
+		t.Error("ParseSecretsManager() of an empty name succeeded")
+	}
+}
+
+func TestParameter(t *testing.T) {
+	tests := []struct {
+		name    string
+		param   string
+		want    string
+		wantErr string
+	}{
+		{name: "secure string", param: "/nodeprop/github-token", want: "ghp-param"},
+		{name: "empty", param: "/nodeprop/empty", wantErr: "is empty"},
+		{name: "not found", param: "/nodeprop/missing", wantErr: "failed to read parameter /nodeprop/missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, _, client := newFakeAWS(t, map[string]string{"/nodeprop/github-token": "ghp-param\n", "/nodeprop/empty": ""})
+			p, _ := ParseParameter(tt.param)
+			p.(*Parameter).Client = client
+			got, err := p.Token(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Token() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("Token() = %q, %v; want %q", got, err, tt.want)
+			}
+			if len(f.decrypts) != 1 || !f.decrypts[0] {
+				t.Errorf("WithDecryption = %v, want true", f.decrypts)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package flow
+
+import (
+	"context"
+)
+
+// BatchResult is the outcome of dispatching one batch target.
+type BatchResult struct {
+	Target BatchTarget
+	Record *DispatchRecord
+	Err    error
+}
+
+// DispatchBatch dispatches targets with at most concurrency requests in
+// flight. progress, if non-nil, is called once per finished target with the
+// number completed so far; calls are serialized. Results keep target order.
+func (c *RunCorrelator) DispatchBatch(ctx context.Context, targets []BatchTarget, concurrency int, progress func(done int, r BatchResult)) []BatchResult {
+	return ParallelSlice(ctx, Parallelism{Concurrency: concurrency}, targets, nil, func(ctx context.Context, t BatchTarget) BatchResult {
+		r := BatchResult{Target: t}
+		if err := ctx.Err(); err != nil {
+			r.Err = err
+		} else {
+			r.Record, r.Err = c.Dispatch(ctx, t.Repo, t.Workflow, t.Ref, t.Inputs)
+		}
+		return r
+	}, progress)
+}
@@ -0,0 +1,56 @@
+package flow_test
+
+import (
+	"context"
+	"testing"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+func TestDispatchBatch(t *testing.T) {
+	gh := nodeproptest.NewServer()
+	defer gh.Close()
+	gh.AddWorkflow("Cdaprod/api", "ci.yml")
+	gh.AddWorkflow("Cdaprod/web", "ci.yml")
+	c := newCorrelator(t, gh)
+
+	targets := []flow.BatchTarget{
+		{Repo: "Cdaprod/api", Workflow: "ci.yml", Ref: "main"},
+		{Repo: "Cdaprod/missing", Workflow: "ci.yml", Ref: "main"},
+		{Repo: "Cdaprod/web", Workflow: "ci.yml", Ref: "main", Inputs: map[string]string{"env": "staging"}},
+	}
+	var calls []int
+	results := c.DispatchBatch(context.Background(), targets, 2, func(done int, r flow.BatchResult) {
+		calls = append(calls, done)
+	})
+	if len(results) != len(targets) {
+		t.Fatalf("DispatchBatch() returned %d results, want %d", len(results), len(targets))
+	}
+	for i, r := range results {
+		if r.Target.Repo != targets[i].Repo {
+			t.Errorf("result %d is for %s, want target order", i, r.Target.Repo)
+		}
+		failed := r.Target.Repo == "Cdaprod/missing"
+		if (r.Err != nil) != failed {
+			t.Errorf("result %d (%s) error = %v", i, r.Target.Repo, r.Err)
+		}
+		if !failed && r.Record == nil {
+			t.Errorf("result %d (%s) has no record", i, r.Target.Repo)
+		}
+	}
+	if len(calls) != 3 || calls[2] != 3 {
+		t.Errorf("progress called with %v, want 1, 2, 3", calls)
+	}
+	if n := len(gh.Dispatches()); n != 2 {
+		t.Errorf("%d dispatches sent, want 2", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, r := range c.DispatchBatch(ctx, targets, 1, nil) {
+		if r.Err == nil {
+			t.Errorf("DispatchBatch() with a cancelled context dispatched %s", r.Target.Repo)
+		}
+	}
+}
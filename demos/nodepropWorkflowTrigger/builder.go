@@ -0,0 +1,221 @@
+package flow
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Builder assembles the registry entries, routing rules, and triggers of
+// an embedding service in one chain, instead of filling in RepoEntry,
+// RoutingRule, and TriggerManager registrations by hand:
+//
+//	setup, err := flow.New().
+//		Repo("Cdaprod/site").Tags("web").
+//		OnTag("v*").Trigger("deploy.yml").WithInput("version", "${payload.ref}").
+//		OnBranch("main").Trigger("preview.yml").WithRef("main").
+//		Repo("Cdaprod/api").
+//		OnRelease().Trigger("release.yml").
+//		Build()
+//
+// A repository's On calls choose the events that run the workflows named
+// by the Trigger calls after them; each Trigger registers the workflow
+// with the repository, adds it to the current rule's targets, and
+// registers a GitHubWorkflowDispatch for it. Mistakes are collected and
+// returned by Build, so the chain needs no error checks of its own.
+type Builder struct {
+	repos []*RepoBuilder
+	errs  []error
+}
+
+// New returns an empty Builder.
+func New() *Builder {
+	return &Builder{}
+}
+
+// Repo starts the configuration of repo, an owner/name repository.
+func (b *Builder) Repo(repo string) *RepoBuilder {
+	if strings.Count(repo, "/") != 1 {
+		b.errs = append(b.errs, fmt.Errorf("repo %q is not owner/name", repo))
+	}
+	r := &RepoBuilder{b: b, entry: RepoEntry{Name: repo}}
+	b.repos = append(b.repos, r)
+	return r
+}
+
+// Setup is what a Builder assembled.
+type Setup struct {
+	Registry *RepositoryRegistry
+	Rules    []RoutingRule
+	// Triggers has a workflow trigger registered for each workflow of each
+	// repository, under the workflow's file name.
+	Triggers *TriggerManager
+}
+
+// Router returns an EventRouter for the setup's rules and registry.
+func (s *Setup) Router() *EventRouter {
+	return &EventRouter{Rules: s.Rules, Registry: s.Registry}
+}
+
+// Build returns the setup the chain describes, its triggers configured by
+// opts, or every mistake made in the chain.
+func (b *Builder) Build(opts ...Option) (*Setup, error) {
+	s := &Setup{Registry: NewRepositoryRegistry(), Triggers: NewTriggerManager()}
+	errs := append([]error(nil), b.errs...)
+	for _, r := range b.repos {
+		e := r.entry
+		s.Registry.RegisterRepo(e.Name, e.Actions, e.Workflows)
+		if err := s.Registry.SetTags(e.Name, e.Tags); err != nil {
+			errs = append(errs, err)
+		}
+		if err := s.Registry.SetDependencies(e.Name, e.DependsOn); err != nil {
+			errs = append(errs, err)
+		}
+		for _, wf := range e.Workflows {
+			s.Triggers.RegisterWorkflow(wf, NewGitHubWorkflowDispatch(wf, opts...))
+		}
+		for _, rule := range r.rules {
+			if len(rule.Targets) == 0 {
+				errs = append(errs, fmt.Errorf("repo %s: rule %s triggers nothing", e.Name, rule.Name))
+				continue
+			}
+			s.Rules = append(s.Rules, *rule)
+		}
+	}
+	if err := ValidateRoutingRules(s.Rules); err != nil {
+		errs = append(errs, err)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// RepoBuilder configures one repository of a Builder.
+type RepoBuilder struct {
+	b     *Builder
+	entry RepoEntry
+	rules []*RoutingRule
+	// target is the target the last Trigger added, for WithInput and
+	// WithRef.
+	target *BatchTarget
+}
+
+// Repo ends this repository and starts the configuration of the next.
+func (r *RepoBuilder) Repo(repo string) *RepoBuilder {
+	return r.b.Repo(repo)
+}
+
+// Build is the Builder's Build.
+func (r *RepoBuilder) Build(opts ...Option) (*Setup, error) {
+	return r.b.Build(opts...)
+}
+
+// Tags sets the repository's registry tags, for selectors.
+func (r *RepoBuilder) Tags(tags ...string) *RepoBuilder {
+	r.entry.Tags = append(r.entry.Tags, tags...)
+	return r
+}
+
+// DependsOn records the repositories, as owner/name globs, that this one
+// depends on, for fan-out rules.
+func (r *RepoBuilder) DependsOn(repos ...string) *RepoBuilder {
+	r.entry.DependsOn = append(r.entry.DependsOn, repos...)
+	return r
+}
+
+// OnTag runs the workflows triggered next when a tag matching pattern, a
+// glob such as v*, is pushed to the repository.
+func (r *RepoBuilder) OnTag(pattern string) *RepoBuilder {
+	return r.on("tag "+pattern, RoutingRule{Events: []string{"push"}, Payload: map[string]string{"ref": "refs/tags/" + pattern}})
+}
+
+// OnBranch runs the workflows triggered next on pushes to a branch
+// matching pattern.
+func (r *RepoBuilder) OnBranch(pattern string) *RepoBuilder {
+	return r.on("branch "+pattern, RoutingRule{Events: []string{"push"}, Branch: pattern})
+}
+
+// OnRelease runs the workflows triggered next when a release of the
+// repository is published.
+func (r *RepoBuilder) OnRelease() *RepoBuilder {
+	return r.on("release", RoutingRule{Events: []string{"release"}, Actions: []string{"published"}})
+}
+
+// OnEvent runs the workflows triggered next on event, such as
+// workflow_run, with one of actions if any are given.
+func (r *RepoBuilder) OnEvent(event string, actions ...string) *RepoBuilder {
+	name := event
+	if len(actions) > 0 {
+		name += " " + strings.Join(actions, ",")
+	}
+	return r.on(name, RoutingRule{Events: []string{event}, Actions: actions})
+}
+
+// on starts a rule for events of the repository matching rule.
+func (r *RepoBuilder) on(what string, rule RoutingRule) *RepoBuilder {
+	rule.Name = r.entry.Name + ": " + what
+	rule.Repo = r.entry.Name
+	r.rules = append(r.rules, &rule)
+	r.target = nil
+	return r
+}
+
+// Trigger registers workflow, a workflow file, with the repository and, if
+// an On call came before, runs it in the repository on those events.
+func (r *RepoBuilder) Trigger(workflow string) *RepoBuilder {
+	if workflow == "" {
+		r.b.errs = append(r.b.errs, fmt.Errorf("repo %s: Trigger needs a workflow", r.entry.Name))
+		return r
+	}
+	if !contains(r.entry.Workflows, workflow) {
+		r.entry.Workflows = append(r.entry.Workflows, workflow)
+	}
+	r.target = nil
+	if len(r.rules) > 0 {
+		rule := r.rules[len(r.rules)-1]
+		rule.Targets = append(rule.Targets, BatchTarget{Repo: SourceRepo, Workflow: workflow})
+		r.target = &rule.Targets[len(rule.Targets)-1]
+	}
+	return r
+}
+
+// Action registers a repository_dispatch action with the repository.
+func (r *RepoBuilder) Action(name string) *RepoBuilder {
+	if !contains(r.entry.Actions, name) {
+		r.entry.Actions = append(r.entry.Actions, name)
+	}
+	return r
+}
+
+// WithInput passes key as an input of the last Trigger's dispatches. The
+// value may reference the event as a RoutingRule's targets do.
+func (r *RepoBuilder) WithInput(key, value string) *RepoBuilder {
+	t := r.lastTarget("WithInput")
+	if t == nil {
+		return r
+	}
+	if t.Inputs == nil {
+		t.Inputs = map[string]string{}
+	}
+	t.Inputs[key] = value
+	return r
+}
+
+// WithRef runs the last Trigger's workflow on ref instead of the default
+// branch.
+func (r *RepoBuilder) WithRef(ref string) *RepoBuilder {
+	if t := r.lastTarget("WithRef"); t != nil {
+		t.Ref = ref
+	}
+	return r
+}
+
+// lastTarget returns the target of the last Trigger, recording a mistake
+// for method if there is none.
+func (r *RepoBuilder) lastTarget(method string) *BatchTarget {
+	if r.target == nil {
+		r.b.errs = append(r.b.errs, fmt.Errorf("repo %s: %s must follow an On call and a Trigger", r.entry.Name, method))
+	}
+	return r.target
+}
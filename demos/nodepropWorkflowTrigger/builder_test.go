@@ -0,0 +1,159 @@
+package flow_test
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+func TestBuilder(t *testing.T) {
+	setup, err := flow.New().
+		Repo("Cdaprod/site").Tags("web").DependsOn("Cdaprod/lib").Action("notify").
+		OnTag("v*").Trigger("deploy.yml").WithInput("version", "${payload.ref}").
+		OnBranch("main").Trigger("preview.yml").WithRef("stable").Trigger("lint.yml").
+		Repo("Cdaprod/api").
+		Trigger("ci.yml").
+		OnRelease().Trigger("release.yml").
+		OnEvent("workflow_run", "completed").Trigger("deploy.yml").
+		Build(flow.WithRef("default"))
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	site, ok := setup.Registry.Get("Cdaprod/site")
+	if !ok || !slices.Equal(site.Workflows, []string{"deploy.yml", "preview.yml", "lint.yml"}) || !slices.Equal(site.Actions, []string{"notify"}) || !site.HasTag("web") || !site.DependsOnRepo("Cdaprod/lib") {
+		t.Errorf("Cdaprod/site = %+v", site)
+	}
+	api, _ := setup.Registry.Get("Cdaprod/api")
+	if !slices.Equal(api.Workflows, []string{"ci.yml", "release.yml", "deploy.yml"}) {
+		t.Errorf("Cdaprod/api workflows = %v", api.Workflows)
+	}
+	for _, wf := range []string{"deploy.yml", "preview.yml", "lint.yml", "ci.yml", "release.yml"} {
+		tr, ok := setup.Triggers.Workflow(wf)
+		if w, isDispatch := tr.(*flow.GitHubWorkflowDispatch); !ok || !isDispatch || w.WorkflowFile != wf || w.Ref != "default" {
+			t.Errorf("trigger %s = %+v, want a dispatch with the options", wf, tr)
+		}
+	}
+
+	tests := []struct {
+		name string
+		ev   flow.InboundEvent
+		want []string
+	}{
+		{
+			name: "tag",
+			ev:   flow.InboundEvent{Type: "push", Repo: "Cdaprod/site", Payload: map[string]interface{}{"ref": "refs/tags/v1.2.0"}},
+			want: []string{"Cdaprod/site deploy.yml@main map[version:refs/tags/v1.2.0]"},
+		},
+		{
+			name: "branch",
+			ev:   flow.InboundEvent{Type: "push", Repo: "Cdaprod/site", Branch: "main", Payload: map[string]interface{}{"ref": "refs/heads/main"}},
+			want: []string{"Cdaprod/site preview.yml@stable map[]", "Cdaprod/site lint.yml@main map[]"},
+		},
+		{
+			name: "other branch",
+			ev:   flow.InboundEvent{Type: "push", Repo: "Cdaprod/site", Branch: "dev", Payload: map[string]interface{}{"ref": "refs/heads/dev"}},
+		},
+		{
+			name: "release",
+			ev:   flow.InboundEvent{Type: "release", Action: "published", Repo: "Cdaprod/api"},
+			want: []string{"Cdaprod/api release.yml@main map[]"},
+		},
+		{
+			name: "release of another repository",
+			ev:   flow.InboundEvent{Type: "release", Action: "published", Repo: "Cdaprod/site"},
+		},
+		{
+			name: "draft release",
+			ev:   flow.InboundEvent{Type: "release", Action: "created", Repo: "Cdaprod/api"},
+		},
+		{
+			name: "event",
+			ev:   flow.InboundEvent{Type: "workflow_run", Action: "completed", Repo: "Cdaprod/api"},
+			want: []string{"Cdaprod/api deploy.yml@main map[]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routed, err := setup.Router().Route(tt.ev)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, d := range routed {
+				got = append(got, fmt.Sprintf("%s %s@%s %v", d.Repo, d.Workflow, d.Ref, d.Inputs))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("routed %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuilderErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func() (*flow.Setup, error)
+		want  []string
+	}{
+		{
+			name:  "not owner/name",
+			build: func() (*flow.Setup, error) { return flow.New().Repo("site").Trigger("ci.yml").Build() },
+			want:  []string{`repo "site" is not owner/name`},
+		},
+		{
+			name:  "empty workflow",
+			build: func() (*flow.Setup, error) { return flow.New().Repo("o/r").OnRelease().Trigger("").Build() },
+			want:  []string{"Trigger needs a workflow", "rule o/r: release triggers nothing"},
+		},
+		{
+			name: "input without a rule",
+			build: func() (*flow.Setup, error) {
+				return flow.New().Repo("o/r").Trigger("ci.yml").WithInput("k", "v").Build()
+			},
+			want: []string{"WithInput must follow an On call and a Trigger"},
+		},
+		{
+			name: "ref after an On call",
+			build: func() (*flow.Setup, error) {
+				return flow.New().Repo("o/r").OnBranch("main").WithRef("main").Trigger("ci.yml").Build()
+			},
+			want: []string{"WithRef must follow an On call and a Trigger"},
+		},
+		{
+			name:  "bad pattern",
+			build: func() (*flow.Setup, error) { return flow.New().Repo("o/r").OnBranch("[").Trigger("ci.yml").Build() },
+			want:  []string{`bad pattern "["`},
+		},
+		{
+			name: "unknown parameter",
+			build: func() (*flow.Setup, error) {
+				return flow.New().Repo("o/r").OnRelease().Trigger("ci.yml").WithInput("v", "${nope}").Build()
+			},
+			want: []string{"nope"},
+		},
+		{
+			name: "every mistake",
+			build: func() (*flow.Setup, error) {
+				return flow.New().Repo("a").Trigger("").Repo("b").OnRelease().Build()
+			},
+			want: []string{`repo "a"`, `repo "b"`, "Trigger needs a workflow", "triggers nothing"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := tt.build()
+			if err == nil {
+				t.Fatalf("Build() = %+v, want an error", s)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Build() error = %v, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package flow
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChaosConfig makes a share of GitHub requests fail, so retries, rate-limit
+// waits, and dead-lettering can be exercised under stress. Each rate is a
+// fraction from 0 to 1 of the requests matched by Paths and Methods.
+type ChaosConfig struct {
+	// ErrorRate is the share answered with a 502.
+	ErrorRate float64 `yaml:"error_rate,omitempty" json:"error_rate,omitempty"`
+	// NetworkErrorRate is the share that fail without a response, like a
+	// dropped connection.
+	NetworkErrorRate float64 `yaml:"network_error_rate,omitempty" json:"network_error_rate,omitempty"`
+	// RateLimitRate is the share answered with GitHub's 403 for an
+	// exhausted rate limit, resetting after RetryAfter.
+	RateLimitRate float64       `yaml:"rate_limit_rate,omitempty" json:"rate_limit_rate,omitempty"`
+	RetryAfter    time.Duration `yaml:"retry_after,omitempty" json:"retry_after,omitempty"`
+	// LatencyRate is the share delayed by Latency before being sent.
+	LatencyRate float64       `yaml:"latency_rate,omitempty" json:"latency_rate,omitempty"`
+	Latency     time.Duration `yaml:"latency,omitempty" json:"latency,omitempty"`
+	// Paths, if set, limits chaos to requests whose URL path matches one of
+	// these globs, e.g. /repos/Cdaprod/*/dispatches. A glob not starting
+	// with / matches the end of the path, so */dispatches matches every
+	// workflow dispatch.
+	Paths []string `yaml:"paths,omitempty" json:"paths,omitempty"`
+	// Methods, if set, limits chaos to these request methods.
+	Methods []string `yaml:"methods,omitempty" json:"methods,omitempty"`
+	// Seed, if not zero, makes the failures the same on every run.
+	Seed uint64 `yaml:"seed,omitempty" json:"seed,omitempty"`
+}
+
+// ErrChaos is the error of requests failed by NetworkErrorRate.
+var ErrChaos = errors.New("connection dropped by chaos injection")
+
+// ParseChaos parses a chaos spec of comma-separated key=value pairs named
+// like the ChaosConfig fields, e.g.
+// "error_rate=0.2,latency_rate=0.1,latency=3s,paths=*/dispatches". Several
+// paths or methods are separated by |.
+func ParseChaos(spec string) (ChaosConfig, error) {
+	var c ChaosConfig
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			return c, fmt.Errorf("chaos: expected key=value, got %q", pair)
+		}
+		var err error
+		switch k {
+		case "error_rate":
+			c.ErrorRate, err = strconv.ParseFloat(v, 64)
+		case "network_error_rate":
+			c.NetworkErrorRate, err = strconv.ParseFloat(v, 64)
+		case "rate_limit_rate":
+			c.RateLimitRate, err = strconv.ParseFloat(v, 64)
+		case "latency_rate":
+			c.LatencyRate, err = strconv.ParseFloat(v, 64)
+		case "retry_after":
+			c.RetryAfter, err = time.ParseDuration(v)
+		case "latency":
+			c.Latency, err = time.ParseDuration(v)
+		case "paths":
+			c.Paths = strings.Split(v, "|")
+		case "methods":
+			c.Methods = strings.Split(strings.ToUpper(v), "|")
+		case "seed":
+			c.Seed, err = strconv.ParseUint(v, 10, 64)
+		default:
+			return c, fmt.Errorf("chaos: unknown key %q", k)
+		}
+		if err != nil {
+			return c, fmt.Errorf("chaos: %s: %w", k, err)
+		}
+	}
+	return c, c.Validate()
+}
+
+// Validate checks that the rates are fractions and that, together, the
+// failures do not exceed every request.
+func (c ChaosConfig) Validate() error {
+	for _, r := range []float64{c.ErrorRate, c.NetworkErrorRate, c.RateLimitRate, c.LatencyRate} {
+		if r < 0 || r > 1 {
+			return fmt.Errorf("chaos: rate %v is not between 0 and 1", r)
+		}
+	}
+	if sum := c.ErrorRate + c.NetworkErrorRate + c.RateLimitRate; sum > 1 {
+		return fmt.Errorf("chaos: error, network error, and rate limit rates add up to %v, more than 1", sum)
+	}
+	if c.LatencyRate > 0 && c.Latency <= 0 {
+		return errors.New("chaos: latency_rate needs a latency")
+	}
+	for _, p := range c.Paths {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("chaos: path %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// Transport returns an http.RoundTripper that injects c's failures into
+// requests before sending the rest on with base; nil means
+// http.DefaultTransport.
+func (c ChaosConfig) Transport(base http.RoundTripper) *ChaosTransport {
+	seed := c.Seed
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	return &ChaosTransport{Config: c, Base: base, rng: rand.New(rand.NewPCG(seed, seed))}
+}
+
+// ChaosTransport injects the failures of a ChaosConfig. Create it with
+// ChaosConfig.Transport.
+type ChaosTransport struct {
+	Config ChaosConfig
+	Base   http.RoundTripper
+	// Clock, if set, replaces the system clock for injected latency and
+	// rate-limit resets.
+	Clock Clock
+	// Logger receives a debug record per injected failure; nil means
+	// slog.Default().
+	Logger Logger
+
+	mu     sync.Mutex
+	rng    *rand.Rand
+	counts map[string]int
+}
+
+// Chaos kinds, as counted by ChaosTransport.Counts.
+const (
+	ChaosError        = "error"
+	ChaosNetworkError = "network_error"
+	ChaosRateLimit    = "rate_limit"
+	ChaosLatency      = "latency"
+)
+
+// Counts returns how many requests got each kind of chaos so far.
+func (t *ChaosTransport) Counts() map[string]int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make(map[string]int, len(t.counts))
+	for k, n := range t.counts {
+		out[k] = n
+	}
+	return out
+}
+
+// RoundTrip fails, delays, or sends req.
+func (t *ChaosTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.matches(req) {
+		return t.base().RoundTrip(req)
+	}
+	delay, fail := t.roll()
+	clock := ClockOr(t.Clock)
+	if delay {
+		t.record(req, ChaosLatency)
+		select {
+		case <-clock.After(t.Config.Latency):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+	if fail == "" {
+		return t.base().RoundTrip(req)
+	}
+	t.record(req, fail)
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	if fail == ChaosNetworkError {
+		return nil, ErrChaos
+	}
+	resp := &http.Response{
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Request:    req,
+	}
+	body := `{"message": "Server Error (injected by nodeprop chaos)"}`
+	resp.StatusCode = http.StatusBadGateway
+	if fail == ChaosRateLimit {
+		retry := t.Config.RetryAfter
+		if retry <= 0 {
+			retry = time.Second
+		}
+		resp.StatusCode = http.StatusForbidden
+		resp.Header.Set("X-RateLimit-Limit", "5000")
+		resp.Header.Set("X-RateLimit-Remaining", "0")
+		// The reset is rounded up, as Retry-After is, so a client waiting
+		// for it does not retry early.
+		resp.Header.Set("X-RateLimit-Reset", strconv.FormatInt(clock.Now().Add(retry+time.Second-1).Unix(), 10))
+		resp.Header.Set("Retry-After", strconv.Itoa(int((retry+time.Second-1)/time.Second)))
+		body = `{"message": "API rate limit exceeded (injected by nodeprop chaos)"}`
+	}
+	resp.Status = fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	resp.Body = io.NopCloser(strings.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	return resp, nil
+}
+
+func (t *ChaosTransport) base() http.RoundTripper {
+	if t.Base == nil {
+		return http.DefaultTransport
+	}
+	return t.Base
+}
+
+// matches reports whether req is subject to chaos.
+func (t *ChaosTransport) matches(req *http.Request) bool {
+	if len(t.Config.Methods) > 0 && !slices.ContainsFunc(t.Config.Methods, func(m string) bool { return strings.EqualFold(m, req.Method) }) {
+		return false
+	}
+	if len(t.Config.Paths) == 0 {
+		return true
+	}
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	for _, p := range t.Config.Paths {
+		target := req.URL.Path
+		if !strings.HasPrefix(p, "/") {
+			n := strings.Count(p, "/") + 1
+			if n > len(segments) {
+				continue
+			}
+			target = strings.Join(segments[len(segments)-n:], "/")
+		}
+		if ok, _ := path.Match(p, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// roll decides whether a request is delayed and how it fails, if at all.
+func (t *ChaosTransport) roll() (delay bool, fail string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delay = t.rng.Float64() < t.Config.LatencyRate
+	r := t.rng.Float64()
+	switch {
+	case r < t.Config.ErrorRate:
+		fail = ChaosError
+	case r < t.Config.ErrorRate+t.Config.NetworkErrorRate:
+		fail = ChaosNetworkError
+	case r < t.Config.ErrorRate+t.Config.NetworkErrorRate+t.Config.RateLimitRate:
+		fail = ChaosRateLimit
+	}
+	return delay, fail
+}
+
+func (t *ChaosTransport) record(req *http.Request, kind string) {
+	t.mu.Lock()
+	if t.counts == nil {
+		t.counts = map[string]int{}
+	}
+	t.counts[kind]++
+	t.mu.Unlock()
+	LoggerOr(t.Logger).Debug("injected chaos", "kind", kind, "method", req.Method, "path", req.URL.Path)
+}
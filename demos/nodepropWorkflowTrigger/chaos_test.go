@@ -0,0 +1,176 @@
+package flow_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+func TestParseChaos(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    flow.ChaosConfig
+		wantErr string
+	}{
+		{spec: ""},
+		{spec: "error_rate=0.2, latency_rate=0.1,latency=3s,paths=*/dispatches", want: flow.ChaosConfig{ErrorRate: 0.2, LatencyRate: 0.1, Latency: 3 * time.Second, Paths: []string{"*/dispatches"}}},
+		{spec: "network_error_rate=0.1,rate_limit_rate=0.3,retry_after=1m,methods=post|get,seed=7", want: flow.ChaosConfig{NetworkErrorRate: 0.1, RateLimitRate: 0.3, RetryAfter: time.Minute, Methods: []string{"POST", "GET"}, Seed: 7}},
+		{spec: "paths=/repos/*/*/dispatches|*/cancel", want: flow.ChaosConfig{Paths: []string{"/repos/*/*/dispatches", "*/cancel"}}},
+		{spec: "error_rate", wantErr: "expected key=value"},
+		{spec: "chaos=1", wantErr: `unknown key "chaos"`},
+		{spec: "error_rate=lots", wantErr: "error_rate"},
+		{spec: "latency=soon", wantErr: "latency"},
+		{spec: "seed=-1", wantErr: "seed"},
+		{spec: "error_rate=1.5", wantErr: "not between 0 and 1"},
+		{spec: "latency_rate=-0.1", wantErr: "not between 0 and 1"},
+		{spec: "error_rate=0.6,rate_limit_rate=0.6", wantErr: "add up to"},
+		{spec: "latency_rate=0.5", wantErr: "needs a latency"},
+		{spec: "paths=[", wantErr: "path"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := flow.ParseChaos(tt.spec)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ParseChaos() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseChaos() = %+v, %v; want %+v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestChaosTransport(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     flow.ChaosConfig
+		method     string
+		path       string
+		wantStatus int
+		wantErr    error
+		wantCounts map[string]int
+	}{
+		{name: "no chaos", method: "POST", path: "/repos/o/r/dispatches", wantStatus: http.StatusNoContent, wantCounts: map[string]int{}},
+		{name: "error", config: flow.ChaosConfig{ErrorRate: 1}, method: "POST", path: "/repos/o/r/dispatches", wantStatus: http.StatusBadGateway, wantCounts: map[string]int{flow.ChaosError: 1}},
+		{name: "network error", config: flow.ChaosConfig{NetworkErrorRate: 1}, method: "POST", path: "/repos/o/r/dispatches", wantErr: flow.ErrChaos, wantCounts: map[string]int{flow.ChaosNetworkError: 1}},
+		{name: "rate limit", config: flow.ChaosConfig{RateLimitRate: 1, RetryAfter: 1500 * time.Millisecond}, method: "GET", path: "/rate_limit", wantStatus: http.StatusForbidden, wantCounts: map[string]int{flow.ChaosRateLimit: 1}},
+		{name: "latency", config: flow.ChaosConfig{LatencyRate: 1, Latency: time.Hour}, method: "GET", path: "/user", wantStatus: http.StatusNoContent, wantCounts: map[string]int{flow.ChaosLatency: 1}},
+		{name: "method matched", config: flow.ChaosConfig{ErrorRate: 1, Methods: []string{"post"}}, method: "POST", path: "/user", wantStatus: http.StatusBadGateway, wantCounts: map[string]int{flow.ChaosError: 1}},
+		{name: "method not matched", config: flow.ChaosConfig{ErrorRate: 1, Methods: []string{"POST"}}, method: "GET", path: "/user", wantStatus: http.StatusNoContent, wantCounts: map[string]int{}},
+		{name: "suffix glob", config: flow.ChaosConfig{ErrorRate: 1, Paths: []string{"*/dispatches"}}, method: "POST", path: "/repos/o/r/actions/workflows/d.yml/dispatches", wantStatus: http.StatusBadGateway, wantCounts: map[string]int{flow.ChaosError: 1}},
+		{name: "suffix glob not matched", config: flow.ChaosConfig{ErrorRate: 1, Paths: []string{"*/dispatches"}}, method: "GET", path: "/repos/o/r/actions/runs", wantStatus: http.StatusNoContent, wantCounts: map[string]int{}},
+		{name: "suffix glob longer than path", config: flow.ChaosConfig{ErrorRate: 1, Paths: []string{"a/b/c/d"}}, method: "GET", path: "/c/d", wantStatus: http.StatusNoContent, wantCounts: map[string]int{}},
+		{name: "absolute glob", config: flow.ChaosConfig{ErrorRate: 1, Paths: []string{"/repos/o/*/dispatches"}}, method: "POST", path: "/repos/o/r/dispatches", wantStatus: http.StatusBadGateway, wantCounts: map[string]int{flow.ChaosError: 1}},
+		{name: "absolute glob anchored", config: flow.ChaosConfig{ErrorRate: 1, Paths: []string{"/o/*/dispatches"}}, method: "POST", path: "/repos/o/r/dispatches", wantStatus: http.StatusNoContent, wantCounts: map[string]int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sent := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				sent++
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer srv.Close()
+			start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+			clock := nodeproptest.NewClock(start)
+			tr := tt.config.Transport(nil)
+			tr.Clock = clock
+			tr.Logger = discardLogger
+
+			req, _ := http.NewRequest(tt.method, srv.URL+tt.path, strings.NewReader("{}"))
+			type result struct {
+				resp *http.Response
+				err  error
+			}
+			done := make(chan result, 1)
+			go func() {
+				resp, err := tr.RoundTrip(req)
+				done <- result{resp, err}
+			}()
+			if tt.config.LatencyRate > 0 {
+				clock.BlockUntil(1)
+				clock.Advance(tt.config.Latency)
+			}
+			r := <-done
+			if !errors.Is(r.err, tt.wantErr) {
+				t.Fatalf("RoundTrip() error = %v, want %v", r.err, tt.wantErr)
+			}
+			if counts := tr.Counts(); !reflect.DeepEqual(counts, tt.wantCounts) {
+				t.Errorf("Counts() = %v, want %v", counts, tt.wantCounts)
+			}
+			if r.err != nil {
+				return
+			}
+			defer r.resp.Body.Close()
+			if r.resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", r.resp.StatusCode, tt.wantStatus)
+			}
+			if injected := r.resp.StatusCode != http.StatusNoContent; injected == (sent == 1) {
+				t.Errorf("%d requests reached the server, injected %v", sent, injected)
+			}
+			if r.resp.StatusCode == http.StatusForbidden {
+				h := r.resp.Header
+				if h.Get("X-RateLimit-Remaining") != "0" || h.Get("Retry-After") != "2" || h.Get("X-RateLimit-Reset") != "1709294402" {
+					t.Errorf("rate-limit headers = %v, want a reset 2s after the clock's time", h)
+				}
+				body, _ := io.ReadAll(r.resp.Body)
+				err := &flow.APIError{StatusCode: r.resp.StatusCode, Body: string(body)}
+				if flow.ErrorClass(err) != flow.ErrorRateLimited {
+					t.Errorf("ErrorClass() of the injected rate limit = %s", flow.ErrorClass(err))
+				}
+			}
+		})
+	}
+}
+
+func TestChaosSeed(t *testing.T) {
+	config := flow.ChaosConfig{ErrorRate: 0.3, NetworkErrorRate: 0.2, RateLimitRate: 0.1, Seed: 42}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }))
+	defer srv.Close()
+	// outcomes lists what each of 50 requests got.
+	outcomes := func(tr *flow.ChaosTransport) string {
+		var b strings.Builder
+		for range 50 {
+			req, _ := http.NewRequest("GET", srv.URL, nil)
+			resp, err := tr.RoundTrip(req)
+			if err != nil {
+				b.WriteString("x")
+				continue
+			}
+			resp.Body.Close()
+			b.WriteString(http.StatusText(resp.StatusCode)[:1])
+		}
+		return b.String()
+	}
+	first, second := outcomes(config.Transport(nil)), outcomes(config.Transport(nil))
+	if first != second {
+		t.Errorf("seeded transports failed differently:\n%s\n%s", first, second)
+	}
+	if !strings.ContainsAny(first, "Bx") || !strings.Contains(first, "N") {
+		t.Errorf("outcomes = %s, want both failures and successes", first)
+	}
+}
+
+func TestChaosLatencyCancelled(t *testing.T) {
+	tr := flow.ChaosConfig{LatencyRate: 1, Latency: time.Hour}.Transport(http.DefaultTransport)
+	tr.Clock = nodeproptest.NewClock(time.Now())
+	tr.Logger = discardLogger
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", "http://127.0.0.1:1/", nil)
+	if _, err := tr.RoundTrip(req); !errors.Is(err, context.Canceled) {
+		t.Errorf("RoundTrip() error = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,60 @@
+package flow
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ChatUsage describes the commands ParseChatCommand accepts.
+const ChatUsage = "trigger <owner/repo> <workflow> [ref] [key=value ...]"
+
+// ChatCommand is a command typed in a chat integration.
+type ChatCommand struct {
+	// Name is "trigger" or "help".
+	Name     string
+	Repo     string
+	Workflow string
+	// Ref is empty if the command did not name one.
+	Ref    string
+	Inputs map[string]string
+}
+
+// ParseChatCommand parses the text following a chat command prefix, e.g.
+// the text of "/nodeprop trigger Cdaprod/api deploy.yml main env=prod".
+// Empty text is a request for help.
+func ParseChatCommand(text string) (*ChatCommand, error) {
+	args := strings.Fields(text)
+	if len(args) == 0 || args[0] == "help" {
+		return &ChatCommand{Name: "help"}, nil
+	}
+	if args[0] != "trigger" {
+		return nil, fmt.Errorf("unknown command %q; usage: %s", args[0], ChatUsage)
+	}
+	args = args[1:]
+	if len(args) < 2 {
+		return nil, errors.New("usage: " + ChatUsage)
+	}
+	c := &ChatCommand{Name: "trigger", Repo: args[0], Workflow: args[1]}
+	if owner, name, ok := strings.Cut(c.Repo, "/"); !ok || owner == "" || name == "" {
+		return nil, fmt.Errorf("repository %q must be owner/repo", c.Repo)
+	}
+	for i, arg := range args[2:] {
+		k, v, ok := strings.Cut(arg, "=")
+		if !ok {
+			if i > 0 || c.Ref != "" {
+				return nil, fmt.Errorf("expected key=value, got %q", arg)
+			}
+			c.Ref = arg
+			continue
+		}
+		if k == "" {
+			return nil, fmt.Errorf("expected key=value, got %q", arg)
+		}
+		if c.Inputs == nil {
+			c.Inputs = map[string]string{}
+		}
+		c.Inputs[k] = v
+	}
+	return c, nil
+}
@@ -0,0 +1,46 @@
+package flow
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseChatCommand(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    *ChatCommand
+		wantErr string
+	}{
+		{text: "", want: &ChatCommand{Name: "help"}},
+		{text: "help", want: &ChatCommand{Name: "help"}},
+		{text: "trigger Cdaprod/api deploy.yml", want: &ChatCommand{Name: "trigger", Repo: "Cdaprod/api", Workflow: "deploy.yml"}},
+		{text: "trigger Cdaprod/api deploy.yml release", want: &ChatCommand{Name: "trigger", Repo: "Cdaprod/api", Workflow: "deploy.yml", Ref: "release"}},
+		{
+			text: "  trigger Cdaprod/api deploy.yml main env=prod note=a=b empty=",
+			want: &ChatCommand{Name: "trigger", Repo: "Cdaprod/api", Workflow: "deploy.yml", Ref: "main", Inputs: map[string]string{"env": "prod", "note": "a=b", "empty": ""}},
+		},
+		{text: "trigger Cdaprod/api deploy.yml env=prod", want: &ChatCommand{Name: "trigger", Repo: "Cdaprod/api", Workflow: "deploy.yml", Inputs: map[string]string{"env": "prod"}}},
+		{text: "deploy Cdaprod/api", wantErr: `unknown command "deploy"`},
+		{text: "trigger Cdaprod/api", wantErr: "usage: "},
+		{text: "trigger api deploy.yml", wantErr: "must be owner/repo"},
+		{text: "trigger /api deploy.yml", wantErr: "must be owner/repo"},
+		{text: "trigger Cdaprod/api deploy.yml env=prod main", wantErr: `expected key=value, got "main"`},
+		{text: "trigger Cdaprod/api deploy.yml main release", wantErr: `expected key=value, got "release"`},
+		{text: "trigger Cdaprod/api deploy.yml =prod", wantErr: "expected key=value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, err := ParseChatCommand(tt.text)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ParseChatCommand() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseChatCommand() = %+v, %v; want %+v", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,581 @@
+// Code generated by gen.go from server/openapi.yaml; DO NOT EDIT.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Approval is a dispatch held until an approver decides on it.
+type Approval struct {
+	Approvers []string `json:"approvers,omitempty"`
+	// The operation the held dispatch belongs to.
+	CorrelationID  string             `json:"correlation_id,omitempty"`
+	Decisions      []ApprovalDecision `json:"decisions,omitempty"`
+	DispatchID     string             `json:"dispatch_id,omitempty"`
+	Error          string             `json:"error,omitempty"`
+	ExpiresAt      time.Time          `json:"expires_at"`
+	ID             string             `json:"id"`
+	IdempotencyKey string             `json:"idempotency_key,omitempty"`
+	Inputs         map[string]string  `json:"inputs,omitempty"`
+	Ref            string             `json:"ref"`
+	Repo           string             `json:"repo"`
+	RequestedAt    time.Time          `json:"requested_at"`
+	RequestedBy    string             `json:"requested_by,omitempty"`
+	Schedule       string             `json:"schedule,omitempty"`
+	ScheduledFor   time.Time          `json:"scheduled_for,omitempty"`
+	State          ApprovalState      `json:"state"`
+	Workflow       string             `json:"workflow"`
+}
+
+// ApprovalDecision is one entry in an approval's audit trail.
+type ApprovalDecision struct {
+	Approved bool      `json:"approved"`
+	At       time.Time `json:"at"`
+	By       string    `json:"by"`
+	Comment  string    `json:"comment,omitempty"`
+}
+
+// ApprovalResponse is an approval after a decision, and its dispatch if it was approved.
+type ApprovalResponse struct {
+	Approval Approval        `json:"approval"`
+	Dispatch *DispatchRecord `json:"dispatch,omitempty"`
+}
+
+// ApprovalState is the state of an approval.
+type ApprovalState string
+
+const (
+	ApprovalStatePending  ApprovalState = "pending"
+	ApprovalStateApproved ApprovalState = "approved"
+	ApprovalStateRejected ApprovalState = "rejected"
+	ApprovalStateExpired  ApprovalState = "expired"
+)
+
+// BuildInfo is the version of the running binary.
+type BuildInfo struct {
+	BuildTime string `json:"build_time,omitempty"`
+	GoVersion string `json:"go_version"`
+	Modified  *bool  `json:"modified,omitempty"`
+	Revision  string `json:"revision,omitempty"`
+	Version   string `json:"version"`
+}
+
+// CheckResult is the result of one readiness check.
+type CheckResult struct {
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+	Status     string `json:"status"`
+}
+
+// DeadLetter is a dispatch that failed after retrying.
+type DeadLetter struct {
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+	// The ID of the rejected dispatch.
+	ID         string            `json:"id"`
+	Inputs     map[string]string `json:"inputs,omitempty"`
+	Ref        string            `json:"ref"`
+	ReplayedAs string            `json:"replayed_as,omitempty"`
+	ReplayedAt time.Time         `json:"replayed_at,omitempty"`
+	Replays    int               `json:"replays,omitempty"`
+	Repo       string            `json:"repo"`
+	Workflow   string            `json:"workflow"`
+}
+
+// DecisionRequest is the optional body of an approve or reject request.
+type DecisionRequest struct {
+	// The reason recorded in the audit trail.
+	Comment string `json:"comment,omitempty"`
+}
+
+// DispatchRecord is a dispatched workflow and the run it started.
+type DispatchRecord struct {
+	// The approval that allowed the dispatch.
+	Approval string `json:"approval,omitempty"`
+	// The run's conclusion, or dispatch_failed if the dispatch was rejected.
+	Conclusion string `json:"conclusion,omitempty"`
+	// The operation the dispatch belongs to.
+	CorrelationID  string            `json:"correlation_id,omitempty"`
+	DispatchedAt   time.Time         `json:"dispatched_at"`
+	Error          string            `json:"error,omitempty"`
+	ID             string            `json:"id"`
+	IdempotencyKey string            `json:"idempotency_key,omitempty"`
+	Inputs         map[string]string `json:"inputs,omitempty"`
+	Ref            string            `json:"ref"`
+	ReplayOf       string            `json:"replay_of,omitempty"`
+	Repo           string            `json:"repo"`
+	RunID          int64             `json:"run_id,omitempty"`
+	RunStartedAt   time.Time         `json:"run_started_at,omitempty"`
+	RunURL         string            `json:"run_url,omitempty"`
+	Schedule       string            `json:"schedule,omitempty"`
+	ScheduledFor   time.Time         `json:"scheduled_for,omitempty"`
+	// The run's status, e.g. queued, in_progress, or completed.
+	Status    string    `json:"status,omitempty"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+	Workflow  string    `json:"workflow"`
+}
+
+// Error is an error response.
+type Error struct {
+	Error string `json:"error"`
+}
+
+// Event is a dispatch lifecycle event.
+type Event struct {
+	Actor         string    `json:"actor,omitempty"`
+	ApprovalID    string    `json:"approval_id,omitempty"`
+	CorrelationID string    `json:"correlation_id,omitempty"`
+	DispatchID    string    `json:"dispatch_id,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	Repo          string    `json:"repo"`
+	RunID         int64     `json:"run_id,omitempty"`
+	RunURL        string    `json:"run_url,omitempty"`
+	Status        string    `json:"status,omitempty"`
+	Time          time.Time `json:"time"`
+	Type          string    `json:"type"`
+	Workflow      string    `json:"workflow,omitempty"`
+}
+
+// Health is the liveness status.
+type Health struct {
+	Status string `json:"status"`
+}
+
+// LatencyReport is dispatch latencies per workflow over a time window.
+type LatencyReport struct {
+	Since     time.Time         `json:"since"`
+	Until     time.Time         `json:"until"`
+	Workflows []WorkflowLatency `json:"workflows"`
+}
+
+// Percentiles is a summary of latencies.
+type Percentiles struct {
+	Count      int     `json:"count"`
+	P50Seconds float64 `json:"p50_seconds"`
+	P95Seconds float64 `json:"p95_seconds"`
+	P99Seconds float64 `json:"p99_seconds"`
+}
+
+// Readiness is the readiness status and the checks behind it.
+type Readiness struct {
+	Checks map[string]CheckResult `json:"checks"`
+	Status string                 `json:"status"`
+}
+
+// ReplayResponse is the dead letter and the dispatch replaying it.
+type ReplayResponse struct {
+	DeadLetter DeadLetter     `json:"dead_letter"`
+	Dispatch   DispatchRecord `json:"dispatch"`
+}
+
+// RepoEntry is a registered repository.
+type RepoEntry struct {
+	Actions          []string `json:"actions,omitempty"`
+	Approvers        []string `json:"approvers,omitempty"`
+	DependsOn        []string `json:"depends_on,omitempty"`
+	Name             string   `json:"name"`
+	RequiresApproval *bool    `json:"requires_approval,omitempty"`
+	Tags             []string `json:"tags,omitempty"`
+	Workflows        []string `json:"workflows,omitempty"`
+}
+
+// RepoRequest is a repository to register.
+type RepoRequest struct {
+	Actions   []string `json:"actions,omitempty"`
+	Approvers []string `json:"approvers,omitempty"`
+	DependsOn []string `json:"depends_on,omitempty"`
+	// The owner/repo to register.
+	Name             string   `json:"name"`
+	RequiresApproval *bool    `json:"requires_approval,omitempty"`
+	Tags             []string `json:"tags,omitempty"`
+	Workflows        []string `json:"workflows,omitempty"`
+}
+
+// RoleBinding is a role granted to API callers, in some or all repositories.
+type RoleBinding struct {
+	// Globs of owner/repo the role is limited to; empty means every repository and the server itself.
+	Repos []string `json:"repos,omitempty"`
+	Role  string   `json:"role"`
+	// Globs of caller identities, e.g. key:ci or jwt:*.
+	Subjects []string `json:"subjects"`
+	// In the server's own registry, globs of the tenants the binding extends to.
+	Tenants []string `json:"tenants,omitempty"`
+}
+
+// SLOResult is how a workflow's dispatches fared against one SLO.
+type SLOResult struct {
+	Compliance float64 `json:"compliance"`
+	// The dispatches whose outcome is known.
+	Eligible int    `json:"eligible"`
+	Met      int    `json:"met"`
+	Name     string `json:"name"`
+	// The fraction of dispatches that must meet the thresholds.
+	Objective float64 `json:"objective"`
+	// Whether compliance reaches the objective.
+	Ok bool `json:"ok"`
+	// The longest a run may take from start to finish; 0 is not checked.
+	RunDurationSeconds float64 `json:"run_duration_seconds"`
+	// The longest a run may take to start after dispatch; 0 is not checked.
+	StartLatencySeconds float64 `json:"start_latency_seconds"`
+}
+
+// TriggerRequest is a request to dispatch a workflow.
+type TriggerRequest struct {
+	// Makes a repeated request return the first dispatch.
+	IdempotencyKey string            `json:"idempotency_key,omitempty"`
+	Inputs         map[string]string `json:"inputs,omitempty"`
+	// Branch or tag to run on; main by default.
+	Ref string `json:"ref,omitempty"`
+	// The owner/repo to dispatch in.
+	Repo string `json:"repo"`
+	// The workflow file name, e.g. deploy.yml.
+	Workflow string `json:"workflow"`
+}
+
+// TriggerResult is a DispatchRecord, or the pending Approval holding the dispatch.
+type TriggerResult struct {
+	raw json.RawMessage
+}
+
+func (u TriggerResult) MarshalJSON() ([]byte, error) { return u.raw, nil }
+
+func (u *TriggerResult) UnmarshalJSON(data []byte) error {
+	u.raw = append(u.raw[:0], data...)
+	return nil
+}
+
+// AsDispatchRecord decodes the value as a DispatchRecord.
+func (u TriggerResult) AsDispatchRecord() (*DispatchRecord, error) {
+	var v DispatchRecord
+	if err := json.Unmarshal(u.raw, &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// AsApproval decodes the value as an Approval.
+func (u TriggerResult) AsApproval() (*Approval, error) {
+	var v Approval
+	if err := json.Unmarshal(u.raw, &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// WorkflowLatency is the latencies of one workflow's dispatches across repositories.
+type WorkflowLatency struct {
+	Dispatches   int         `json:"dispatches"`
+	RunDuration  Percentiles `json:"run_duration"`
+	Slos         []SLOResult `json:"slos,omitempty"`
+	StartLatency Percentiles `json:"start_latency"`
+	Workflow     string      `json:"workflow"`
+}
+
+// Healthz calls GET /healthz. Report that the process is serving.
+func (c *Client) Healthz(ctx context.Context) (*Health, error) {
+	var out Health
+	if _, err := c.do(ctx, "GET", "/healthz", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Readyz calls GET /readyz. Report whether the server can accept triggers.
+func (c *Client) Readyz(ctx context.Context) (*Readiness, error) {
+	var out Readiness
+	if _, err := c.do(ctx, "GET", "/readyz", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListApprovalsParams are the query parameters of ListApprovals.
+type ListApprovalsParams struct {
+	// Only approvals for this owner/repo.
+	Repo string
+	// Only approvals in this state.
+	State ApprovalState
+}
+
+// ListApprovals calls GET /v1/approvals. List dispatches held for approval, newest first.
+func (c *Client) ListApprovals(ctx context.Context, params *ListApprovalsParams) ([]Approval, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Repo != "" {
+			query.Set("repo", params.Repo)
+		}
+		if params.State != "" {
+			query.Set("state", string(params.State))
+		}
+	}
+	var out []Approval
+	if _, err := c.do(ctx, "GET", "/v1/approvals", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetApproval calls GET /v1/approvals/{id}. Get one approval with its audit trail.
+func (c *Client) GetApproval(ctx context.Context, id string) (*Approval, error) {
+	var out Approval
+	if _, err := c.do(ctx, "GET", "/v1/approvals/"+url.PathEscape(id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Approve calls POST /v1/approvals/{id}/approve. Approve a held dispatch and send it. Needs the admin scope.
+func (c *Client) Approve(ctx context.Context, id string, body *DecisionRequest) (*ApprovalResponse, error) {
+	var in interface{}
+	if body != nil {
+		in = body
+	}
+	var out ApprovalResponse
+	if _, err := c.do(ctx, "POST", "/v1/approvals/"+url.PathEscape(id)+"/approve", nil, in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Reject calls POST /v1/approvals/{id}/reject. Reject a held dispatch. Needs the admin scope.
+func (c *Client) Reject(ctx context.Context, id string, body *DecisionRequest) (*ApprovalResponse, error) {
+	var in interface{}
+	if body != nil {
+		in = body
+	}
+	var out ApprovalResponse
+	if _, err := c.do(ctx, "POST", "/v1/approvals/"+url.PathEscape(id)+"/reject", nil, in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListDeadLettersParams are the query parameters of ListDeadLetters.
+type ListDeadLettersParams struct {
+	// Only dead letters for this owner/repo.
+	Repo string
+	// Include dead letters that were replayed.
+	All bool
+}
+
+// ListDeadLetters calls GET /v1/deadletters. List dispatches that failed after retrying.
+func (c *Client) ListDeadLetters(ctx context.Context, params *ListDeadLettersParams) ([]DeadLetter, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Repo != "" {
+			query.Set("repo", params.Repo)
+		}
+		if params.All {
+			query.Set("all", "true")
+		}
+	}
+	var out []DeadLetter
+	if _, err := c.do(ctx, "GET", "/v1/deadletters", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetDeadLetter calls GET /v1/deadletters/{id}. Get one dead letter.
+func (c *Client) GetDeadLetter(ctx context.Context, id string) (*DeadLetter, error) {
+	var out DeadLetter
+	if _, err := c.do(ctx, "GET", "/v1/deadletters/"+url.PathEscape(id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteDeadLetter calls DELETE /v1/deadletters/{id}. Drop a dead letter. Needs the admin scope.
+func (c *Client) DeleteDeadLetter(ctx context.Context, id string) error {
+	_, err := c.do(ctx, "DELETE", "/v1/deadletters/"+url.PathEscape(id), nil, nil, nil)
+	return err
+}
+
+// ReplayDeadLetter calls POST /v1/deadletters/{id}/replay. Dispatch a dead letter again.
+func (c *Client) ReplayDeadLetter(ctx context.Context, id string) (*ReplayResponse, error) {
+	var out ReplayResponse
+	if _, err := c.do(ctx, "POST", "/v1/deadletters/"+url.PathEscape(id)+"/replay", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// StreamEventsParams are the query parameters of StreamEvents.
+type StreamEventsParams struct {
+	// Only events for this owner/repo.
+	Repo string
+	// Only events for this dispatch.
+	DispatchID string
+	// Comma-separated event types to send.
+	Types string
+}
+
+// StreamEvents calls GET /v1/events. Stream dispatch lifecycle events as server-sent events.
+// The caller must close the response body.
+func (c *Client) StreamEvents(ctx context.Context, params *StreamEventsParams) (*http.Response, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Repo != "" {
+			query.Set("repo", params.Repo)
+		}
+		if params.DispatchID != "" {
+			query.Set("dispatch_id", params.DispatchID)
+		}
+		if params.Types != "" {
+			query.Set("types", params.Types)
+		}
+	}
+	return c.stream(ctx, "GET", "/v1/events", query)
+}
+
+// ListRepos calls GET /v1/repos. List the registered repositories.
+func (c *Client) ListRepos(ctx context.Context) ([]RepoEntry, error) {
+	var out []RepoEntry
+	if _, err := c.do(ctx, "GET", "/v1/repos", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RegisterRepo calls POST /v1/repos. Register or replace a repository. Needs the admin scope.
+func (c *Client) RegisterRepo(ctx context.Context, body RepoRequest) (*RepoEntry, error) {
+	var out RepoEntry
+	if _, err := c.do(ctx, "POST", "/v1/repos", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListRoles calls GET /v1/roles. List the registry's role bindings. Needs the admin scope and role.
+func (c *Client) ListRoles(ctx context.Context) ([]RoleBinding, error) {
+	var out []RoleBinding
+	if _, err := c.do(ctx, "GET", "/v1/roles", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SetRoles calls PUT /v1/roles. Replace the registry's role bindings. Needs the admin scope and role, and refuses bindings that would take the caller's admin role away.
+func (c *Client) SetRoles(ctx context.Context, body []RoleBinding) ([]RoleBinding, error) {
+	var out []RoleBinding
+	if _, err := c.do(ctx, "PUT", "/v1/roles", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetSLOParams are the query parameters of GetSLO.
+type GetSLOParams struct {
+	// Only dispatches to this owner/repo.
+	Repo string
+	// Only this workflow file.
+	Workflow string
+	// Only dispatches made at or after this RFC 3339 time; default 24 hours before until.
+	Since string
+	// Only dispatches made before this RFC 3339 time; default now.
+	Until string
+}
+
+// GetSLO calls GET /v1/slo. Report dispatch latencies per workflow and their compliance with the server's SLOs.
+func (c *Client) GetSLO(ctx context.Context, params *GetSLOParams) (*LatencyReport, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Repo != "" {
+			query.Set("repo", params.Repo)
+		}
+		if params.Workflow != "" {
+			query.Set("workflow", params.Workflow)
+		}
+		if params.Since != "" {
+			query.Set("since", params.Since)
+		}
+		if params.Until != "" {
+			query.Set("until", params.Until)
+		}
+	}
+	var out LatencyReport
+	if _, err := c.do(ctx, "GET", "/v1/slo", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListTriggersParams are the query parameters of ListTriggers.
+type ListTriggersParams struct {
+	// Only dispatches to this owner/repo.
+	Repo string
+	// Only dispatches made at or after this RFC 3339 time.
+	Since string
+	// Only dispatches made before this RFC 3339 time.
+	Until string
+	// Only dispatches that are pending, completed, or failed, or whose run concluded with this conclusion.
+	Status string
+	// Only dispatches made under this correlation ID.
+	CorrelationID string
+	// At most this many dispatches.
+	Limit int
+}
+
+// ListTriggers calls GET /v1/triggers. List the dispatch history, newest first.
+func (c *Client) ListTriggers(ctx context.Context, params *ListTriggersParams) ([]DispatchRecord, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Repo != "" {
+			query.Set("repo", params.Repo)
+		}
+		if params.Since != "" {
+			query.Set("since", params.Since)
+		}
+		if params.Until != "" {
+			query.Set("until", params.Until)
+		}
+		if params.Status != "" {
+			query.Set("status", params.Status)
+		}
+		if params.CorrelationID != "" {
+			query.Set("correlation_id", params.CorrelationID)
+		}
+		if params.Limit != 0 {
+			query.Set("limit", strconv.Itoa(params.Limit))
+		}
+	}
+	var out []DispatchRecord
+	if _, err := c.do(ctx, "GET", "/v1/triggers", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CreateTrigger calls POST /v1/triggers. Dispatch a workflow, or hold it if its repository requires approval.
+func (c *Client) CreateTrigger(ctx context.Context, body TriggerRequest) (*TriggerResult, error) {
+	var out TriggerResult
+	if _, err := c.do(ctx, "POST", "/v1/triggers", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetTrigger calls GET /v1/triggers/{id}. Get one dispatch, refreshed from GitHub.
+func (c *Client) GetTrigger(ctx context.Context, id string) (*DispatchRecord, error) {
+	var out DispatchRecord
+	if _, err := c.do(ctx, "GET", "/v1/triggers/"+url.PathEscape(id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetVersion calls GET /version. Describe the running binary.
+func (c *Client) GetVersion(ctx context.Context) (*BuildInfo, error) {
+	var out BuildInfo
+	if _, err := c.do(ctx, "GET", "/version", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,181 @@
+// Package client is a Go client for the REST API of nodeprop serve. Its
+// types and methods are generated from server/openapi.yaml; run go generate
+// after changing the document.
+package client
+
+//go:generate go run gen.go ../server/openapi.yaml client.gen.go
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls a nodeprop server.
+type Client struct {
+	// BaseURL is the server's address, e.g. https://nodeprop.example.com.
+	BaseURL string
+	// HTTPClient sends the requests; http.DefaultClient if nil.
+	HTTPClient *http.Client
+	// APIKey, if set, is sent in the X-API-Key header.
+	APIKey string
+	// BearerToken, if set, is sent as a JWT in the Authorization header.
+	BearerToken string
+	// RequestEditor, if set, is called on every request before it is sent,
+	// e.g. to sign its body when the server requires signed API requests.
+	RequestEditor func(*http.Request) error
+}
+
+// New returns a Client for the server at baseURL.
+func New(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// APIError is a non-2xx response from the server.
+type APIError struct {
+	StatusCode int
+	// Message is the error the server reported, or the status text.
+	Message string
+	// Body is the raw response body.
+	Body []byte
+	// RetryAfter is how long the server asked the client to wait before
+	// retrying, e.g. when it is rate limited.
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("nodeprop: %d: %s", e.StatusCode, e.Message)
+}
+
+// Held reports whether the dispatch is awaiting approval, in which case the
+// result is an Approval rather than a DispatchRecord.
+func (u TriggerResult) Held() bool {
+	var probe struct {
+		State string `json:"state"`
+	}
+	return json.Unmarshal(u.raw, &probe) == nil && probe.State != ""
+}
+
+// ReadEvents decodes the server-sent events of a StreamEvents response,
+// calling fn for each until the stream ends or fn returns an error.
+func ReadEvents(r io.Reader, fn func(Event) error) error {
+	sc := bufio.NewScanner(r)
+	var data bytes.Buffer
+	for sc.Scan() {
+		line := sc.Text()
+		if d, ok := strings.CutPrefix(line, "data:"); ok {
+			data.WriteString(strings.TrimPrefix(d, " "))
+			continue
+		}
+		if line != "" || data.Len() == 0 {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(data.Bytes(), &e); err != nil {
+			return fmt.Errorf("decoding event: %w", err)
+		}
+		data.Reset()
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+type correlationKey struct{}
+
+// WithCorrelationID returns a copy of ctx whose requests carry id in the
+// X-Correlation-ID header, so the server records the dispatches they make
+// under it.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// do sends a request with an optional JSON body and decodes a JSON
+// response into out if it is non-nil.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out interface{}) (*http.Response, error) {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+	}
+	resp, err := c.send(ctx, method, path, query, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp, fmt.Errorf("decoding %s %s response: %w", method, path, err)
+		}
+	}
+	return resp, nil
+}
+
+// stream sends a request whose response the caller reads and closes.
+func (c *Client) stream(ctx context.Context, method, path string, query url.Values) (*http.Response, error) {
+	return c.send(ctx, method, path, query, nil)
+}
+
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body io.Reader) (*http.Response, error) {
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if id, _ := ctx.Value(correlationKey{}).(string); id != "" {
+		req.Header.Set("X-Correlation-ID", id)
+	}
+	if c.APIKey != "" {
+		req.Header.Set("X-API-Key", c.APIKey)
+	}
+	if c.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.BearerToken)
+	}
+	if c.RequestEditor != nil {
+		if err := c.RequestEditor(req); err != nil {
+			return nil, err
+		}
+	}
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		apiErr := &APIError{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode), Body: b}
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			apiErr.RetryAfter = time.Duration(secs) * time.Second
+		}
+		var msg struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(b, &msg) == nil && msg.Error != "" {
+			apiErr.Message = msg.Error
+		}
+		return nil, apiErr
+	}
+	return resp, nil
+}
@@ -0,0 +1,165 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/client"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/server"
+)
+
+// newServer runs nodeprop serve against a fake GitHub and returns a client
+// for it.
+func newServer(t *testing.T) (*client.Client, *nodeproptest.Server) {
+	t.Helper()
+	gh := nodeproptest.NewServer()
+	t.Cleanup(gh.Close)
+	gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+	c := flow.NewRunCorrelator(gh.Client(), flow.NewFileHistoryStore(filepath.Join(t.TempDir(), "history.json")))
+	s := server.New("127.0.0.1:0", c, nil)
+	s.Logger = log.New(io.Discard, "", 0)
+	srv := httptest.NewServer(s.Handler())
+	t.Cleanup(srv.Close)
+	return client.New(srv.URL + "/"), gh
+}
+
+func TestClient(t *testing.T) {
+	c, gh := newServer(t)
+	ctx := client.WithCorrelationID(context.Background(), "op-1")
+
+	res, err := c.CreateTrigger(ctx, client.TriggerRequest{Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "main", Inputs: map[string]string{"env": "prod"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Held() {
+		t.Error("Held() = true for a dispatch")
+	}
+	rec, err := res.AsDispatchRecord()
+	if err != nil || rec.ID == "" || rec.CorrelationID != "op-1" {
+		t.Fatalf("AsDispatchRecord() = %+v, %v; want a dispatch of op-1", rec, err)
+	}
+	if ds := gh.Dispatches(); len(ds) != 1 || ds[0].Inputs["env"] != "prod" {
+		t.Errorf("dispatches = %+v", ds)
+	}
+
+	got, err := c.GetTrigger(ctx, rec.ID)
+	if err != nil || got.ID != rec.ID {
+		t.Errorf("GetTrigger() = %+v, %v", got, err)
+	}
+	list, err := c.ListTriggers(ctx, &client.ListTriggersParams{Repo: "Cdaprod/site"})
+	if err != nil || len(list) != 1 {
+		t.Errorf("ListTriggers() = %+v, %v", list, err)
+	}
+	if h, err := c.Healthz(ctx); err != nil || h.Status != "ok" {
+		t.Errorf("Healthz() = %+v, %v", h, err)
+	}
+
+	_, err = c.GetTrigger(ctx, "missing")
+	var apiErr *client.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || !strings.Contains(apiErr.Message, "missing") {
+		t.Errorf("GetTrigger() of a missing dispatch error = %#v", err)
+	}
+}
+
+func TestClientRequests(t *testing.T) {
+	var got *http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Clone(context.Background())
+		w.Header().Set("Retry-After", "7")
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	c := client.New(srv.URL)
+	c.APIKey = "key-1"
+	c.BearerToken = "jwt-1"
+	c.RequestEditor = func(r *http.Request) error {
+		r.Header.Set("X-Signature", "signed")
+		return nil
+	}
+	_, err := c.Healthz(context.Background())
+	var apiErr *client.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 429 || apiErr.RetryAfter != 7*time.Second || apiErr.Message != "Too Many Requests" {
+		t.Errorf("error = %#v, want a 429 to retry after 7s", err)
+	}
+	for header, want := range map[string]string{"X-API-Key": "key-1", "Authorization": "Bearer jwt-1", "X-Signature": "signed"} {
+		if v := got.Header.Get(header); v != want {
+			t.Errorf("%s = %q, want %q", header, v, want)
+		}
+	}
+
+	c.RequestEditor = func(*http.Request) error { return errors.New("no signing key") }
+	if _, err := c.Healthz(context.Background()); err == nil || err.Error() != "no signing key" {
+		t.Errorf("error = %v, want the editor's", err)
+	}
+}
+
+func TestReadEvents(t *testing.T) {
+	tests := []struct {
+		name    string
+		stream  string
+		want    []string
+		wantErr bool
+	}{
+		{name: "events", stream: "data: {\"type\": \"queued\", \"repo\": \"o/a\"}\n\n: keepalive\n\ndata:{\"type\": \"dispatched\", \"repo\": \"o/b\"}\n\n", want: []string{"queued o/a", "dispatched o/b"}},
+		{name: "event field ignored", stream: "event: dispatch\ndata: {\"type\": \"failed\", \"repo\": \"o/a\"}\n\n", want: []string{"failed o/a"}},
+		{name: "unterminated", stream: "data: {\"type\": \"queued\", \"repo\": \"o/a\"}\n"},
+		{name: "invalid", stream: "data: {\n\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			err := client.ReadEvents(strings.NewReader(tt.stream), func(e client.Event) error {
+				got = append(got, string(e.Type)+" "+e.Repo)
+				return nil
+			})
+			if (err != nil) != tt.wantErr || strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("ReadEvents() = %v, %v; want %v", got, err, tt.want)
+			}
+		})
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err := client.ReadEvents(strings.NewReader("data: {}\n\ndata: {}\n\n"), func(client.Event) error { calls++; return stop })
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("ReadEvents() = %v after %d calls, want to stop after the first", err, calls)
+	}
+}
+
+// TestGenerated checks that client.gen.go is what go generate writes from
+// the current server/openapi.yaml.
+func TestGenerated(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs the generator")
+	}
+	out := filepath.Join(t.TempDir(), "client.gen.go")
+	cmd := exec.Command("go", "run", "gen.go", "../server/openapi.yaml", out)
+	if msg, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("gen.go: %v\n%s", err, msg)
+	}
+	want, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile("client.gen.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("client.gen.go is out of date; run go generate ./client")
+	}
+}
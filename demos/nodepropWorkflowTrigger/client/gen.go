@@ -0,0 +1,432 @@
+//go:build ignore
+
+// gen writes the client's types and methods from the server's OpenAPI
+// document. It understands the subset of OpenAPI 3 that document uses:
+// object, enum, and oneOf schemas; path and query parameters; JSON request
+// bodies; and JSON or streamed responses.
+//
+// Usage: go run gen.go <openapi.yaml> <output.go>
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type document struct {
+	Paths      map[string]map[string]*operation `yaml:"paths"`
+	Components struct {
+		Parameters map[string]*parameter `yaml:"parameters"`
+		Responses  map[string]*response  `yaml:"responses"`
+		Schemas    map[string]*schema    `yaml:"schemas"`
+	} `yaml:"components"`
+}
+
+type operation struct {
+	OperationID string               `yaml:"operationId"`
+	Summary     string               `yaml:"summary"`
+	Parameters  []*parameter         `yaml:"parameters"`
+	RequestBody *requestBody         `yaml:"requestBody"`
+	Responses   map[string]*response `yaml:"responses"`
+}
+
+type parameter struct {
+	Ref         string  `yaml:"$ref"`
+	Name        string  `yaml:"name"`
+	In          string  `yaml:"in"`
+	Required    bool    `yaml:"required"`
+	Description string  `yaml:"description"`
+	Schema      *schema `yaml:"schema"`
+}
+
+type requestBody struct {
+	Required bool                 `yaml:"required"`
+	Content  map[string]mediaType `yaml:"content"`
+}
+
+type response struct {
+	Ref     string               `yaml:"$ref"`
+	Content map[string]mediaType `yaml:"content"`
+}
+
+type mediaType struct {
+	Schema *schema `yaml:"schema"`
+}
+
+type schema struct {
+	Ref                  string             `yaml:"$ref"`
+	Type                 string             `yaml:"type"`
+	Format               string             `yaml:"format"`
+	Description          string             `yaml:"description"`
+	Enum                 []string           `yaml:"enum"`
+	Required             []string           `yaml:"required"`
+	Properties           map[string]*schema `yaml:"properties"`
+	Items                *schema            `yaml:"items"`
+	AdditionalProperties *schema            `yaml:"additionalProperties"`
+	OneOf                []*schema          `yaml:"oneOf"`
+}
+
+var methods = []string{"get", "post", "put", "patch", "delete"}
+
+func main() {
+	if len(os.Args) != 3 {
+		log.Fatal("usage: go run gen.go <openapi.yaml> <output.go>")
+	}
+	data, err := os.ReadFile(os.Args[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+	var doc document
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		log.Fatal(err)
+	}
+	g := &generator{doc: &doc}
+	g.schemas()
+	g.operations()
+	out, err := format.Source(g.source())
+	if err != nil {
+		log.Fatalf("%v\n%s", err, g.source())
+	}
+	if err := os.WriteFile(os.Args[2], out, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+type generator struct {
+	doc *document
+	buf bytes.Buffer
+}
+
+// source returns the generated file, importing the packages its
+// declarations use.
+func (g *generator) source() []byte {
+	var b bytes.Buffer
+	b.WriteString("// Code generated by gen.go from server/openapi.yaml; DO NOT EDIT.\n\npackage client\n\nimport (\n")
+	for _, pkg := range []string{"context", "encoding/json", "net/http", "net/url", "strconv", "time"} {
+		if bytes.Contains(g.buf.Bytes(), []byte(pkg[strings.LastIndex(pkg, "/")+1:]+".")) {
+			fmt.Fprintf(&b, "%q\n", pkg)
+		}
+	}
+	b.WriteString(")\n\n")
+	b.Write(g.buf.Bytes())
+	return b.Bytes()
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) schemas() {
+	for _, name := range sortedKeys(g.doc.Components.Schemas) {
+		s := g.doc.Components.Schemas[name]
+		switch {
+		case len(s.OneOf) > 0:
+			g.union(name, s)
+		case len(s.Enum) > 0:
+			g.comment(name, s.Description)
+			g.printf("type %s string\n\n", name)
+			g.printf("const (\n")
+			for _, v := range s.Enum {
+				g.printf("%s%s %s = %q\n", name, goName(v), name, v)
+			}
+			g.printf(")\n\n")
+		case s.Type == "object":
+			g.comment(name, s.Description)
+			g.printf("type %s struct {\n", name)
+			g.fields(s)
+			g.printf("}\n\n")
+		default:
+			log.Fatalf("schema %s: unsupported", name)
+		}
+	}
+}
+
+// comment writes a doc comment for a schema from its description, which
+// the document phrases as a noun phrase.
+func (g *generator) comment(name, desc string) {
+	if desc == "" {
+		log.Fatalf("schema %s has no description", name)
+	}
+	g.printf("// %s is %s\n", name, strings.ToLower(desc[:1])+desc[1:])
+}
+
+func (g *generator) fields(s *schema) {
+	required := map[string]bool{}
+	for _, r := range s.Required {
+		required[r] = true
+	}
+	for _, prop := range sortedKeys(s.Properties) {
+		p := s.Properties[prop]
+		if p.Description != "" {
+			g.printf("// %s\n", p.Description)
+		}
+		typ, tag := g.goType(p), prop
+		if !required[prop] {
+			tag += ",omitempty"
+			// Pointers let an optional false or a missing object be told
+			// apart from the zero value.
+			if p.Type == "boolean" || (p.Ref != "" && g.resolve(p).Type == "object") {
+				typ = "*" + typ
+			}
+		}
+		g.printf("%s %s `json:%q`\n", goName(prop), typ, tag)
+	}
+}
+
+func (g *generator) union(name string, s *schema) {
+	g.comment(name, s.Description)
+	g.printf("type %s struct {\nraw json.RawMessage\n}\n\n", name)
+	g.printf("func (u %s) MarshalJSON() ([]byte, error) { return u.raw, nil }\n\n", name)
+	g.printf("func (u *%s) UnmarshalJSON(data []byte) error {\nu.raw = append(u.raw[:0], data...)\nreturn nil\n}\n\n", name)
+	for _, v := range s.OneOf {
+		t := refName(v.Ref)
+		g.printf("// As%s decodes the value as %s.\n", t, article(t))
+		g.printf("func (u %s) As%s() (*%s, error) {\nvar v %s\nif err := json.Unmarshal(u.raw, &v); err != nil {\nreturn nil, err\n}\nreturn &v, nil\n}\n\n", name, t, t, t)
+	}
+}
+
+// resolve follows a schema reference.
+func (g *generator) resolve(s *schema) *schema {
+	if s.Ref == "" {
+		return s
+	}
+	r, ok := g.doc.Components.Schemas[refName(s.Ref)]
+	if !ok {
+		log.Fatalf("unknown schema %s", s.Ref)
+	}
+	return r
+}
+
+func (g *generator) goType(s *schema) string {
+	if s.Ref != "" {
+		g.resolve(s)
+		return refName(s.Ref)
+	}
+	switch s.Type {
+	case "string":
+		if s.Format == "date-time" {
+			return "time.Time"
+		}
+		return "string"
+	case "integer":
+		if s.Format == "int64" {
+			return "int64"
+		}
+		return "int"
+	case "number":
+		return "float64"
+	case "boolean":
+		return "bool"
+	case "array":
+		return "[]" + g.goType(s.Items)
+	case "object":
+		if s.AdditionalProperties != nil {
+			return "map[string]" + g.goType(s.AdditionalProperties)
+		}
+	}
+	log.Fatalf("unsupported schema type %q", s.Type)
+	return ""
+}
+
+func (g *generator) operations() {
+	for _, path := range sortedKeys(g.doc.Paths) {
+		for _, method := range methods {
+			if op := g.doc.Paths[path][method]; op != nil {
+				g.operation(strings.ToUpper(method), path, op)
+			}
+		}
+	}
+}
+
+func (g *generator) operation(method, path string, op *operation) {
+	name := op.OperationID
+	var pathParams, queryParams []*parameter
+	for _, p := range op.Parameters {
+		if p.Ref != "" {
+			p = g.doc.Components.Parameters[refName(p.Ref)]
+		}
+		switch p.In {
+		case "path":
+			pathParams = append(pathParams, p)
+		case "query":
+			queryParams = append(queryParams, p)
+		default:
+			log.Fatalf("%s: unsupported parameter location %q", name, p.In)
+		}
+	}
+
+	if len(queryParams) > 0 {
+		g.printf("// %sParams are the query parameters of %s.\n", name, name)
+		g.printf("type %sParams struct {\n", name)
+		for _, p := range queryParams {
+			if p.Description != "" {
+				g.printf("// %s\n", p.Description)
+			}
+			g.printf("%s %s\n", goName(p.Name), g.goType(p.Schema))
+		}
+		g.printf("}\n\n")
+	}
+
+	args := []string{"ctx context.Context"}
+	for _, p := range pathParams {
+		args = append(args, lowerName(p.Name)+" string")
+	}
+	body := "nil"
+	if op.RequestBody != nil {
+		s := op.RequestBody.Content["application/json"].Schema
+		if s == nil {
+			log.Fatalf("%s: request body is not JSON", name)
+		}
+		t := g.goType(s)
+		if !op.RequestBody.Required {
+			t = "*" + t
+		}
+		args = append(args, "body "+t)
+		body = "body"
+	}
+	if len(queryParams) > 0 {
+		args = append(args, "params *"+name+"Params")
+	}
+
+	result, stream := g.result(name, op)
+	g.printf("// %s calls %s %s. %s\n", name, method, path, op.Summary)
+	if stream {
+		g.printf("// The caller must close the response body.\n")
+	}
+	switch {
+	case stream:
+		g.printf("func (c *Client) %s(%s) (*http.Response, error) {\n", name, strings.Join(args, ", "))
+	case result == "":
+		g.printf("func (c *Client) %s(%s) error {\n", name, strings.Join(args, ", "))
+	default:
+		g.printf("func (c *Client) %s(%s) (%s, error) {\n", name, strings.Join(args, ", "), result)
+	}
+
+	pathExpr := fmt.Sprintf("%q", path)
+	for _, p := range pathParams {
+		pathExpr = strings.Replace(pathExpr, "{"+p.Name+"}", `" + url.PathEscape(`+lowerName(p.Name)+`) + "`, 1)
+	}
+	pathExpr = strings.TrimSuffix(strings.TrimPrefix(pathExpr, `"" + `), ` + ""`)
+	query := "nil"
+	if len(queryParams) > 0 {
+		query = "query"
+		g.printf("query := url.Values{}\n")
+		g.printf("if params != nil {\n")
+		for _, p := range queryParams {
+			field := "params." + goName(p.Name)
+			switch g.resolve(p.Schema).Type {
+			case "boolean":
+				g.printf("if %s {\nquery.Set(%q, \"true\")\n}\n", field, p.Name)
+			case "string":
+				value := field
+				if p.Schema.Ref != "" {
+					value = "string(" + field + ")"
+				}
+				g.printf("if %s != \"\" {\nquery.Set(%q, %s)\n}\n", field, p.Name, value)
+			case "integer":
+				g.printf("if %s != 0 {\nquery.Set(%q, strconv.Itoa(%s))\n}\n", field, p.Name, field)
+			default:
+				log.Fatalf("%s: unsupported query parameter %s", name, p.Name)
+			}
+		}
+		g.printf("}\n")
+	}
+	if body != "nil" && !op.RequestBody.Required {
+		// A nil optional body is sent as no body at all.
+		g.printf("var in interface{}\nif body != nil {\nin = body\n}\n")
+		body = "in"
+	}
+	switch {
+	case stream:
+		g.printf("return c.stream(ctx, %q, %s, %s)\n", method, pathExpr, query)
+	case result == "":
+		g.printf("_, err := c.do(ctx, %q, %s, %s, %s, nil)\nreturn err\n", method, pathExpr, query, body)
+	case strings.HasPrefix(result, "[]"):
+		g.printf("var out %s\nif _, err := c.do(ctx, %q, %s, %s, %s, &out); err != nil {\nreturn nil, err\n}\nreturn out, nil\n", result, method, pathExpr, query, body)
+	default:
+		t := strings.TrimPrefix(result, "*")
+		g.printf("var out %s\nif _, err := c.do(ctx, %q, %s, %s, %s, &out); err != nil {\nreturn nil, err\n}\nreturn &out, nil\n", t, method, pathExpr, query, body)
+	}
+	g.printf("}\n\n")
+}
+
+// result returns the Go type of op's successful responses, which must all
+// share one schema, and whether op streams its response instead.
+func (g *generator) result(name string, op *operation) (string, bool) {
+	var result string
+	for _, code := range sortedKeys(op.Responses) {
+		if !strings.HasPrefix(code, "2") {
+			continue
+		}
+		r := op.Responses[code]
+		if r.Ref != "" {
+			r = g.doc.Components.Responses[refName(r.Ref)]
+		}
+		if len(r.Content) == 0 {
+			continue
+		}
+		mt, ok := r.Content["application/json"]
+		if !ok {
+			return "", true
+		}
+		t := g.goType(mt.Schema)
+		if !strings.HasPrefix(t, "[]") {
+			t = "*" + t
+		}
+		if result != "" && result != t {
+			log.Fatalf("%s: responses have different schemas %s and %s", name, result, t)
+		}
+		result = t
+	}
+	return result, false
+}
+
+func article(noun string) string {
+	if strings.ContainsAny(noun[:1], "AEIOU") {
+		return "an " + noun
+	}
+	return "a " + noun
+}
+
+func refName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+// initialisms are written in upper case in Go names.
+var initialisms = map[string]bool{"id": true, "url": true, "ms": true, "api": true, "http": true}
+
+func goName(s string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == '_' || r == '-' }) {
+		if initialisms[part] {
+			b.WriteString(strings.ToUpper(part))
+			continue
+		}
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+func lowerName(s string) string {
+	n := goName(s)
+	if initialisms[strings.ToLower(n)] {
+		return strings.ToLower(n)
+	}
+	return strings.ToLower(n[:1]) + n[1:]
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
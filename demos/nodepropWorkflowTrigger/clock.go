@@ -0,0 +1,30 @@
+package flow
+
+import "time"
+
+// Clock tells the time and waits. The correlator's retry backoff and
+// approval expiry, the client's rate-limit waits, schedules, lock TTLs,
+// and alert windows all go through one, so tests can substitute a fake
+// clock, such as nodeproptest.Clock, and run them instantly.
+type Clock interface {
+	Now() time.Time
+	// After returns a channel that receives the time once d has passed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock is the real time, used wherever a Clock is nil.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// ClockOr returns c, or SystemClock if c is nil, for packages that take an
+// optional Clock as the library does.
+func ClockOr(c Clock) Clock {
+	if c == nil {
+		return SystemClock
+	}
+	return c
+}
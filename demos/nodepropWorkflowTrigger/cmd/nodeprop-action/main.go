@@ -0,0 +1,162 @@
+// Command nodeprop-action is the entrypoint of the NodeProp GitHub Action.
+// It reads the action's inputs from the INPUT_* variables the runner sets,
+// generates the repository's .nodeprop.yml with any spec file merged in,
+// stores a copy under its content hash, writes the config-hash and
+// config-path outputs, and optionally dispatches follow-up workflows.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := run(ctx); err != nil {
+		// An error annotation shows on the run's summary page.
+		fmt.Printf("::error::%s\n", strings.ReplaceAll(err.Error(), "\n", "%0A"))
+		os.Exit(1)
+	}
+}
+
+// input returns the named action input. The runner passes each as
+// INPUT_<NAME>, upper-cased with its hyphens kept.
+func input(name, def string) string {
+	if v := strings.TrimSpace(os.Getenv("INPUT_" + strings.ToUpper(name))); v != "" {
+		return v
+	}
+	return def
+}
+
+func run(ctx context.Context) error {
+	configFile := input("config-file", flow.DefaultConfigFile)
+	storagePath := input("storage-path", "configs")
+	specFile := input("spec-file", "")
+	manifest := input("dispatch", "")
+	repo := os.Getenv("GITHUB_REPOSITORY")
+	if repo == "" {
+		repo = "unknown/unknown"
+	}
+
+	g := &flow.NodeConfigGenerator{Repo: repo, SHA: os.Getenv("GITHUB_SHA"), Actor: os.Getenv("GITHUB_ACTOR")}
+	if g.Actor == "" {
+		g.Actor = "unknown"
+	}
+	var client *flow.GitHubClient
+	if token := input("github-token", os.Getenv("GITHUB_TOKEN")); token != "" {
+		flow.Secrets.Add(token)
+		client = flow.NewGitHubClient(token)
+		// GitHub Enterprise Server runners point at their own API.
+		if api := os.Getenv("GITHUB_API_URL"); api != "" {
+			client.BaseURL = api
+		}
+		g.Client = client
+	}
+
+	cfg, err := g.Generate(ctx)
+	if err != nil {
+		return err
+	}
+	if specFile != "" {
+		if _, err := os.Stat(specFile); err == nil {
+			spec, err := flow.LoadNodeConfig(specFile)
+			if err != nil {
+				return err
+			}
+			cfg = flow.MergeSpec(cfg, spec)
+		} else {
+			fmt.Printf("::warning::spec file %s not found; generating without it\n", specFile)
+		}
+	}
+	hash, err := flow.NodeConfigHash(cfg)
+	if err != nil {
+		return err
+	}
+	cfg["id"] = hash
+	data, err := flow.MarshalNodeConfig(cfg)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(configFile, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", configFile, err)
+	}
+	// .nodeprop-hash is what the action's outputs were read from before
+	// it was written in Go; workflows may still read it.
+	if err := os.WriteFile(".nodeprop-hash", []byte(hash), 0o644); err != nil {
+		return fmt.Errorf("failed to write .nodeprop-hash: %w", err)
+	}
+	if err := os.MkdirAll(storagePath, 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", storagePath, err)
+	}
+	if err := os.WriteFile(filepath.Join(storagePath, hash+".yml"), data, 0o644); err != nil {
+		return fmt.Errorf("failed to store config: %w", err)
+	}
+	fmt.Printf("Generated %s with hash %s\n", configFile, hash)
+
+	if err := setOutputs(map[string]string{"config-hash": hash, "config-path": configFile}); err != nil {
+		return err
+	}
+	if manifest == "" {
+		return nil
+	}
+	if client == nil {
+		return errors.New("dispatch needs github-token")
+	}
+	return dispatch(ctx, client, manifest, repo, hash, configFile)
+}
+
+// setOutputs appends outputs to the file GITHUB_OUTPUT names.
+func setOutputs(outputs map[string]string) error {
+	path := os.Getenv("GITHUB_OUTPUT")
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open GITHUB_OUTPUT: %w", err)
+	}
+	for k, v := range outputs {
+		fmt.Fprintf(f, "%s=%s\n", k, v)
+	}
+	return f.Close()
+}
+
+// dispatch runs the workflows of the batch manifest at path. Bare repo
+// names are taken to be in the owner of repo, and input values may use
+// ${config.hash} and ${config.path} to pass on what was generated.
+func dispatch(ctx context.Context, client *flow.GitHubClient, path, repo, hash, configFile string) error {
+	m, err := flow.LoadBatchManifest(path)
+	if err != nil {
+		return err
+	}
+	owner, _, _ := strings.Cut(repo, "/")
+	vars := strings.NewReplacer("${config.hash}", hash, "${config.path}", configFile)
+	var errs []error
+	for _, t := range m.Resolved() {
+		if t.Selector != "" {
+			errs = append(errs, fmt.Errorf("selector %s: the action has no registry to resolve selectors", t.Selector))
+			continue
+		}
+		if !strings.Contains(t.Repo, "/") {
+			t.Repo = owner + "/" + t.Repo
+		}
+		for k, v := range t.Inputs {
+			t.Inputs[k] = vars.Replace(v)
+		}
+		if err := client.DispatchWorkflow(ctx, t.Repo, t.Workflow, t.Ref, t.Inputs); err != nil {
+			errs = append(errs, fmt.Errorf("dispatch %s in %s: %w", t.Workflow, t.Repo, err))
+			continue
+		}
+		fmt.Printf("Dispatched %s in %s on %s\n", t.Workflow, t.Repo, t.Ref)
+	}
+	return errors.Join(errs...)
+}
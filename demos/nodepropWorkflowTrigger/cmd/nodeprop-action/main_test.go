@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+func TestRun(t *testing.T) {
+	const manifest = `targets:
+  - repo: api
+    workflow: deploy.yml
+    inputs: {config: "${config.hash}", path: "${config.path}"}
+`
+	tests := []struct {
+		name string
+		// inputs are the action's inputs, by name.
+		inputs map[string]string
+		token  bool
+		// files are written to the workspace first.
+		files        map[string]string
+		wantKeys     []string
+		wantDispatch bool
+		wantErr      string
+	}{
+		{name: "defaults", wantKeys: []string{"id", "name", "metadata"}},
+		{
+			name:     "spec merged",
+			inputs:   map[string]string{"spec-file": "spec.yml", "config-file": "node.yml", "storage-path": "store/configs"},
+			files:    map[string]string{"spec.yml": "deploy:\n  replicas: 3\n"},
+			wantKeys: []string{"id", "deploy"},
+		},
+		{name: "missing spec", inputs: map[string]string{"spec-file": "spec.yml"}, wantKeys: []string{"id"}},
+		{name: "broken spec", inputs: map[string]string{"spec-file": "spec.yml"}, files: map[string]string{"spec.yml": "deploy: ["}, wantErr: "spec.yml"},
+		{
+			name:         "dispatch",
+			inputs:       map[string]string{"dispatch": "follow-ups.yml"},
+			token:        true,
+			files:        map[string]string{"follow-ups.yml": manifest},
+			wantKeys:     []string{"id"},
+			wantDispatch: true,
+		},
+		{name: "dispatch without token", inputs: map[string]string{"dispatch": "follow-ups.yml"}, files: map[string]string{"follow-ups.yml": manifest}, wantErr: "dispatch needs github-token"},
+		{
+			name:    "dispatch to a selector",
+			inputs:  map[string]string{"dispatch": "follow-ups.yml"},
+			token:   true,
+			files:   map[string]string{"follow-ups.yml": "targets:\n  - selector: tag:web\n    workflow: deploy.yml\n"},
+			wantErr: "selector tag:web: the action has no registry to resolve selectors",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := nodeproptest.NewServer()
+			defer gh.Close()
+			gh.AddWorkflow("Cdaprod/site", "build.yml")
+			gh.AddWorkflow("Cdaprod/api", "deploy.yml")
+
+			dir := t.TempDir()
+			t.Chdir(dir)
+			for name, content := range tt.files {
+				if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, name := range []string{"config-file", "storage-path", "spec-file", "dispatch", "github-token"} {
+				t.Setenv("INPUT_"+strings.ToUpper(name), tt.inputs[name])
+			}
+			t.Setenv("GITHUB_TOKEN", "")
+			if tt.token {
+				t.Setenv("GITHUB_TOKEN", nodeproptest.DefaultToken)
+			}
+			t.Setenv("GITHUB_API_URL", gh.URL)
+			t.Setenv("GITHUB_REPOSITORY", "Cdaprod/site")
+			t.Setenv("GITHUB_SHA", "0123456789abcdef")
+			t.Setenv("GITHUB_ACTOR", "alice")
+			t.Setenv("GITHUB_OUTPUT", filepath.Join(dir, "outputs"))
+
+			err := run(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("run() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+
+			configFile := tt.inputs["config-file"]
+			if configFile == "" {
+				configFile = flow.DefaultConfigFile
+			}
+			cfg, err := flow.LoadNodeConfig(configFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, key := range tt.wantKeys {
+				if _, ok := cfg[key]; !ok {
+					t.Errorf("config has no %s: %v", key, cfg)
+				}
+			}
+			hash, _ := cfg["id"].(string)
+			if want, err := flow.NodeConfigHash(cfg); err != nil || hash != want {
+				t.Errorf("config id = %q, want its hash %s", hash, want)
+			}
+			if data, err := os.ReadFile(".nodeprop-hash"); err != nil || string(data) != hash {
+				t.Errorf(".nodeprop-hash = %q, %v; want %s", data, err, hash)
+			}
+			storage := tt.inputs["storage-path"]
+			if storage == "" {
+				storage = "configs"
+			}
+			stored, err := os.ReadFile(filepath.Join(storage, hash+".yml"))
+			written, _ := os.ReadFile(configFile)
+			if err != nil || string(stored) != string(written) {
+				t.Errorf("stored config = %q, %v; want a copy of %s", stored, err, configFile)
+			}
+			outputs, err := os.ReadFile("outputs")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range []string{"config-hash=" + hash + "\n", "config-path=" + configFile + "\n"} {
+				if !strings.Contains(string(outputs), want) {
+					t.Errorf("outputs = %q, want %q", outputs, want)
+				}
+			}
+
+			d := gh.Dispatches()
+			if !tt.wantDispatch {
+				if len(d) != 0 {
+					t.Errorf("dispatched %+v", d)
+				}
+				return
+			}
+			if len(d) != 1 || d[0].Repo != "Cdaprod/api" || d[0].Workflow != "deploy.yml" || d[0].Ref != "main" ||
+				d[0].Inputs["config"] != hash || d[0].Inputs["path"] != configFile {
+				t.Errorf("dispatches = %+v, want deploy.yml in Cdaprod/api with the config", d)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+// Command nodeprop-operator runs the NodePropRepo and NodePropFlow
+// controllers of package operator in a Kubernetes cluster. Install the
+// resource definitions first:
+//
+//	kubectl apply -f operator/crds.yaml
+//
+// It dispatches with the token in GITHUB_TOKEN and keeps the dispatch
+// history, which idempotency keys and schedules rely on, at -history; give
+// it a persistent volume so that a restarted operator neither repeats nor
+// misses dispatches.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/operator"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, "nodeprop-operator:", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	historyPath := flag.String("history", flow.DefaultHistoryPath(), "dispatch history file")
+	namespace := flag.String("namespace", "", "only watch resources in this namespace")
+	metricsAddr := flag.String("metrics-addr", ":8080", "address of the metrics endpoint; 0 disables it")
+	probeAddr := flag.String("health-addr", ":8081", "address of the health probes")
+	leaderElect := flag.Bool("leader-elect", false, "elect a leader so that replicas do not dispatch twice")
+	flag.Parse()
+
+	log.SetLogger(logr.FromSlogHandler(slog.Default().Handler()))
+	token := os.Getenv("GITHUB_TOKEN")
+	if token == "" {
+		return errors.New("GITHUB_TOKEN is not set")
+	}
+	flow.Secrets.Add(token)
+	client := flow.NewGitHubClient(token)
+	if api := os.Getenv("GITHUB_API_URL"); api != "" {
+		client.BaseURL = api
+	}
+
+	opts := ctrl.Options{
+		Scheme:                 runtime.NewScheme(),
+		Metrics:                metricsserver.Options{BindAddress: *metricsAddr},
+		HealthProbeBindAddress: *probeAddr,
+		LeaderElection:         *leaderElect,
+		LeaderElectionID:       "nodeprop-operator.nodeprop.cdaprod.dev",
+	}
+	if *namespace != "" {
+		opts.Cache.DefaultNamespaces = map[string]cache.Config{*namespace: {}}
+	}
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), opts)
+	if err != nil {
+		return err
+	}
+	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
+		return err
+	}
+	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
+		return err
+	}
+	op := operator.New(flow.NewRunCorrelator(client, flow.NewFileHistoryStore(*historyPath)))
+	if err := op.SetupWithManager(mgr); err != nil {
+		return err
+	}
+	return mgr.Start(ctrl.SetupSignalHandler())
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// errExcessPrivileges makes nodeprop access --check exit non-zero.
+var errExcessPrivileges = errors.New("the token has more or less access than the triggers need")
+
+func runAccess(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("access", flag.ContinueOnError)
+	registryPath := fs.String("registry", flow.DefaultRegistryPath(), "registry whose triggers the token is checked against")
+	check := fs.Bool("check", false, "exit non-zero if the token has excess or missing access")
+	format := outputFlag(fs)
+	profileName := profileFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+	p, err := loadProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	reg, err := flow.LoadRegistry(*registryPath)
+	if err != nil {
+		return err
+	}
+	c, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+	r, err := flow.AnalyzePrivileges(ctx, c, reg)
+	if err != nil {
+		return err
+	}
+	if err := render(os.Stdout, *format, r, func(w io.Writer) { printPrivileges(w, r) }); err != nil {
+		return err
+	}
+	if *check && !r.OK() {
+		return errExcessPrivileges
+	}
+	return nil
+}
+
+// printPrivileges writes r for a terminal.
+func printPrivileges(w io.Writer, r *flow.PrivilegeReport) {
+	who := r.Kind + " token"
+	if r.Login != "" {
+		who += " for " + r.Login
+	}
+	fmt.Fprintf(w, "%s, reaching %d repositories\n", who, r.Accessible)
+	perms := make([]string, 0, len(r.Required.Permissions))
+	for name, level := range r.Required.Permissions {
+		perms = append(perms, name+": "+level)
+	}
+	sort.Strings(perms)
+	fmt.Fprintf(w, "triggers need: %d repositories; scopes %s; permissions %s\n",
+		len(r.Required.Repos), strings.Join(r.Required.Scopes, ", "), strings.Join(perms, ", "))
+	if r.Scopes != nil {
+		fmt.Fprintf(w, "token scopes: %s\n", strings.Join(r.Scopes, ", "))
+	}
+	fmt.Fprintln(w)
+	for _, f := range r.Findings {
+		fmt.Fprintf(w, "- %s\n", f)
+	}
+	if n := len(r.ExcessRepos); n > 0 {
+		shown := r.ExcessRepos[:min(n, 10)]
+		fmt.Fprintf(w, "\nrepositories no trigger targets: %s", strings.Join(shown, ", "))
+		if n > len(shown) {
+			fmt.Fprintf(w, ", and %d more (see -o json)", n-len(shown))
+		}
+		fmt.Fprintln(w)
+	}
+}
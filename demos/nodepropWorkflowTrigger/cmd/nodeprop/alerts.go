@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/pagerduty"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/slack"
+)
+
+// alertsConfig is the --alerts file:
+//
+//	# alerts.yml
+//	interval: 1m
+//	rules:
+//	  - name: failing-dispatches
+//	    failure_rate: 0.25
+//	    window: 30m
+//	    min_dispatches: 4
+//	  - name: dead-letters
+//	    dead_letters: 10
+//	targets:
+//	  - type: slack
+//	    url: env:SLACK_ALERT_WEBHOOK_URL
+//	  - type: pagerduty
+//	    routing_key: env:PAGERDUTY_ROUTING_KEY
+//	    severity: critical
+//	  - type: webhook
+//	    url: file:/run/secrets/alert-webhook
+//
+// URLs and routing keys are token sources because they carry credentials.
+// A target's tls, if set, configures its connection; see notifyTarget.
+type alertsConfig struct {
+	Interval time.Duration    `yaml:"interval"`
+	Rules    []flow.AlertRule `yaml:"rules"`
+	Targets  []alertTarget    `yaml:"targets"`
+}
+
+type alertTarget struct {
+	Type       string `yaml:"type"`
+	URL        string `yaml:"url"`
+	RoutingKey string `yaml:"routing_key"`
+	Severity   string `yaml:"severity"`
+
+	TLS *flow.TLSConfig `yaml:"tls"`
+}
+
+// startAlerts loads the alert rules and targets in path and checks the
+// rules against c's history and dead letters until ctx is cancelled.
+func startAlerts(ctx context.Context, path string, c *flow.RunCorrelator) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var cfg alertsConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	if len(cfg.Rules) == 0 || len(cfg.Targets) == 0 {
+		return fmt.Errorf("%s: need at least one rule and one target", path)
+	}
+	seen := map[string]bool{}
+	for _, r := range cfg.Rules {
+		if err := r.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if seen[r.Name] {
+			return fmt.Errorf("%s: alert %s is defined twice", path, r.Name)
+		}
+		seen[r.Name] = true
+	}
+	alerters := make([]flow.Alerter, len(cfg.Targets))
+	for i, t := range cfg.Targets {
+		secret := t.URL
+		if t.Type == "pagerduty" {
+			secret = t.RoutingKey
+		}
+		tp, err := flow.ParseTokenSource(secret)
+		if err != nil {
+			return fmt.Errorf("%s: target %d: %w", path, i+1, err)
+		}
+		value, err := tp.Token(ctx)
+		if err != nil {
+			return fmt.Errorf("%s: target %d: %w", path, i+1, err)
+		}
+		hc, err := t.TLS.HTTPClient()
+		if err != nil {
+			return fmt.Errorf("%s: target %d: %w", path, i+1, err)
+		}
+		switch t.Type {
+		case "slack":
+			alerters[i] = &slack.AlertWebhook{URL: value, HTTPClient: hc}
+		case "pagerduty":
+			alerters[i] = &pagerduty.Events{RoutingKey: value, Severity: t.Severity, HTTPClient: hc}
+		case "webhook":
+			alerters[i] = &flow.WebhookAlerter{URL: value, HTTPClient: hc}
+		default:
+			return fmt.Errorf("%s: target %d: unknown type %q (want slack, pagerduty, or webhook)", path, i+1, t.Type)
+		}
+	}
+	m := flow.NewAlertMonitor(c, cfg.Rules, alerters...)
+	m.Interval = cfg.Interval
+	go m.Run(ctx)
+	log.Printf("checking %d alert rules from %s", len(cfg.Rules), path)
+	return nil
+}
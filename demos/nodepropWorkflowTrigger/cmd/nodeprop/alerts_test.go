@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+func TestStartAlerts(t *testing.T) {
+	t.Setenv("NODEPROP_TEST_ALERT_URL", "https://hooks.example.com/alert")
+	target := "targets:\n  - type: webhook\n    url: env:NODEPROP_TEST_ALERT_URL\n"
+	rule := "rules:\n  - name: dlq\n    dead_letters: 5\n"
+	tests := []struct {
+		name    string
+		file    string
+		wantErr string
+	}{
+		{name: "valid", file: "interval: 5m\n" + rule + target + "  - type: pagerduty\n    routing_key: env:NODEPROP_TEST_ALERT_URL\n    severity: critical\n  - type: slack\n    url: env:NODEPROP_TEST_ALERT_URL\n"},
+		{name: "no rules", file: target, wantErr: "need at least one rule and one target"},
+		{name: "no targets", file: rule, wantErr: "need at least one rule and one target"},
+		{name: "invalid rule", file: "rules:\n  - name: dlq\n" + target, wantErr: "alert dlq: set one of"},
+		{name: "duplicate rule", file: rule + "  - name: dlq\n    failure_rate: 0.5\n" + target, wantErr: "alert dlq is defined twice"},
+		{name: "unknown type", file: rule + "targets:\n  - type: irc\n    url: env:NODEPROP_TEST_ALERT_URL\n", wantErr: `target 1: unknown type "irc"`},
+		{name: "plain url", file: rule + "targets:\n  - type: webhook\n    url: https://hooks.example.com/alert\n", wantErr: "target 1: "},
+		{name: "unset url", file: rule + "targets:\n  - type: webhook\n    url: env:NODEPROP_TEST_UNSET\n", wantErr: "target 1: "},
+		{name: "invalid yaml", file: "rules: {", wantErr: "parse "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "alerts.yml")
+			os.WriteFile(path, []byte(tt.file), 0o600)
+			c := &flow.RunCorrelator{
+				History:     flow.NewFileHistoryStore(filepath.Join(dir, "history.json")),
+				DeadLetters: flow.NewFileDeadLetterStore(filepath.Join(dir, "deadletters.json")),
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			err := startAlerts(ctx, path, c)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("startAlerts() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("startAlerts() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// approvalView is the schema for one approval.
+type approvalView struct {
+	ID          string            `json:"id" yaml:"id"`
+	Repo        string            `json:"repo" yaml:"repo"`
+	Workflow    string            `json:"workflow" yaml:"workflow"`
+	Ref         string            `json:"ref" yaml:"ref"`
+	Inputs      map[string]string `json:"inputs,omitempty" yaml:"inputs,omitempty"`
+	State       string            `json:"state" yaml:"state"`
+	RequestedBy string            `json:"requested_by,omitempty" yaml:"requested_by,omitempty"`
+	RequestedAt time.Time         `json:"requested_at" yaml:"requested_at"`
+	ExpiresAt   time.Time         `json:"expires_at" yaml:"expires_at"`
+	Approvers   []string          `json:"approvers,omitempty" yaml:"approvers,omitempty"`
+	Decisions   []decisionView    `json:"decisions,omitempty" yaml:"decisions,omitempty"`
+	DispatchID  string            `json:"dispatch_id,omitempty" yaml:"dispatch_id,omitempty"`
+	Error       string            `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// decisionView is the schema for one entry in an approval's audit trail.
+type decisionView struct {
+	By       string    `json:"by" yaml:"by"`
+	Approved bool      `json:"approved" yaml:"approved"`
+	Comment  string    `json:"comment,omitempty" yaml:"comment,omitempty"`
+	At       time.Time `json:"at" yaml:"at"`
+}
+
+func newApprovalView(a flow.Approval, now time.Time) approvalView {
+	v := approvalView{
+		ID:          a.ID,
+		Repo:        a.Repo,
+		Workflow:    a.Workflow,
+		Ref:         a.Ref,
+		Inputs:      a.Inputs,
+		State:       string(a.CurrentState(now)),
+		RequestedBy: a.RequestedBy,
+		RequestedAt: a.RequestedAt,
+		ExpiresAt:   a.ExpiresAt,
+		Approvers:   a.Approvers,
+		DispatchID:  a.DispatchID,
+		Error:       a.Error,
+	}
+	for _, d := range a.Decisions {
+		v.Decisions = append(v.Decisions, decisionView{By: d.By, Approved: d.Approved, Comment: d.Comment, At: d.At})
+	}
+	return v
+}
+
+func runApprovals(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: nodeprop approvals <list|show|approve|reject|require> [flags]")
+	}
+	switch args[0] {
+	case "list":
+		return approvalsList(args[1:])
+	case "show":
+		return approvalsShow(args[1:])
+	case "approve":
+		return approvalsDecide(ctx, args[1:], true)
+	case "reject":
+		return approvalsDecide(ctx, args[1:], false)
+	case "require":
+		return approvalsRequire(args[1:])
+	default:
+		return fmt.Errorf("unknown approvals command %q", args[0])
+	}
+}
+
+func approvalsList(args []string) error {
+	fs := flag.NewFlagSet("approvals list", flag.ContinueOnError)
+	state := fs.String("state", string(flow.ApprovalPending), "only list approvals in this state (pending, approved, rejected, expired, or all)")
+	format := outputFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return errors.New("usage: nodeprop approvals list [--state STATE] [owner/repo]")
+	}
+	all, err := flow.NewFileApprovalStore(flow.DefaultApprovalPath()).List()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	views := []approvalView{}
+	for _, a := range all {
+		v := newApprovalView(a, now)
+		if (fs.NArg() == 0 || a.Repo == fs.Arg(0)) && (*state == "all" || v.State == *state) {
+			views = append(views, v)
+		}
+	}
+	return render(os.Stdout, *format, views, func(w io.Writer) {
+		if len(views) == 0 {
+			fmt.Fprintln(w, "no approvals")
+			return
+		}
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tREPO\tWORKFLOW\tREF\tSTATE\tREQUESTED BY\tREQUESTED")
+		for _, v := range views {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", v.ID, v.Repo, v.Workflow, v.Ref, v.State, v.RequestedBy, v.RequestedAt.Local().Format(time.DateTime))
+		}
+		tw.Flush()
+	})
+}
+
+func approvalsShow(args []string) error {
+	fs := flag.NewFlagSet("approvals show", flag.ContinueOnError)
+	format := outputFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: nodeprop approvals show <id>")
+	}
+	a, ok, err := flow.FindApproval(flow.NewFileApprovalStore(flow.DefaultApprovalPath()), fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("approval %s not found", fs.Arg(0))
+	}
+	v := newApprovalView(a, time.Now())
+	return render(os.Stdout, *format, v, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(tw, "ID\t%s\n", v.ID)
+		fmt.Fprintf(tw, "Dispatch\t%s in %s at %s\n", v.Workflow, v.Repo, v.Ref)
+		if len(v.Inputs) > 0 {
+			fmt.Fprintf(tw, "Inputs\t%s\n", inputFlags(v.Inputs))
+		}
+		fmt.Fprintf(tw, "State\t%s\n", v.State)
+		fmt.Fprintf(tw, "Requested\t%s by %s\n", v.RequestedAt.Local().Format(time.DateTime), orAnonymous(v.RequestedBy))
+		fmt.Fprintf(tw, "Expires\t%s\n", v.ExpiresAt.Local().Format(time.DateTime))
+		if len(v.Approvers) > 0 {
+			fmt.Fprintf(tw, "Approvers\t%s\n", strings.Join(v.Approvers, ", "))
+		}
+		for _, d := range v.Decisions {
+			verb := "rejected"
+			if d.Approved {
+				verb = "approved"
+			}
+			line := fmt.Sprintf("%s %s by %s", d.At.Local().Format(time.DateTime), verb, d.By)
+			if d.Comment != "" {
+				line += ": " + d.Comment
+			}
+			fmt.Fprintf(tw, "Decision\t%s\n", line)
+		}
+		if v.DispatchID != "" {
+			fmt.Fprintf(tw, "Dispatch ID\t%s\n", v.DispatchID)
+		}
+		if v.Error != "" {
+			fmt.Fprintf(tw, "Error\t%s\n", v.Error)
+		}
+		tw.Flush()
+	})
+}
+
+func approvalsDecide(ctx context.Context, args []string, approve bool) error {
+	verb := "reject"
+	if approve {
+		verb = "approve"
+	}
+	fs := flag.NewFlagSet("approvals "+verb, flag.ContinueOnError)
+	comment := fs.String("comment", "", "reason recorded in the audit trail")
+	profileName := profileFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: nodeprop approvals %s [--comment TEXT] <id>", verb)
+	}
+	p, err := loadProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	c, err := p.correlator(ctx)
+	if err != nil {
+		return err
+	}
+	id, by := fs.Arg(0), cliIdentity()
+	if !approve {
+		if _, err := c.Reject(ctx, id, by, *comment); err != nil {
+			return err
+		}
+		fmt.Printf("rejected %s\n", id)
+		return nil
+	}
+	a, rec, err := c.Approve(ctx, id, by, *comment)
+	if err != nil && !errors.Is(err, flow.ErrAlreadyDispatched) {
+		return err
+	}
+	fmt.Printf("approved %s: dispatched %s in %s (id %s)\n", a.ID, a.Workflow, a.Repo, rec.ID)
+	return nil
+}
+
+func approvalsRequire(args []string) error {
+	fs := flag.NewFlagSet("approvals require", flag.ContinueOnError)
+	var approvers stringList
+	fs.Var(&approvers, "approver", "identity allowed to approve, e.g. key:ops, jwt:alice, slack:U123, or cli:alice (repeatable; default anyone but the requester)")
+	off := fs.Bool("off", false, "stop requiring approval")
+	registryPath := fs.String("registry", flow.DefaultRegistryPath(), "registry file the repository is stored in")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || (*off && len(approvers) > 0) {
+		return errors.New("usage: nodeprop approvals require [--approver ID]... [--off] <owner/repo>")
+	}
+	reg, err := flow.LoadRegistry(*registryPath)
+	if err != nil {
+		return err
+	}
+	if err := reg.SetApproval(fs.Arg(0), !*off, approvers); err != nil {
+		return err
+	}
+	return reg.Save(*registryPath)
+}
+
+// cliIdentity names the local user in approval audit trails.
+func cliIdentity() string {
+	if u, err := user.Current(); err == nil {
+		return "cli:" + u.Username
+	}
+	return "cli:" + os.Getenv("USER")
+}
+
+func orAnonymous(s string) string {
+	if s == "" {
+		return "anonymous"
+	}
+	return s
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+func runAuth(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: nodeprop auth <login|logout|status|store> [flags]")
+	}
+	switch args[0] {
+	case "login":
+		return authLogin(ctx, args[1:])
+	case "logout":
+		return authLogout(args[1:])
+	case "status":
+		return authStatus(ctx, args[1:])
+	case "store":
+		return authStore(args[1:])
+	default:
+		return fmt.Errorf("unknown auth command %q", args[0])
+	}
+}
+
+func authLogin(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("auth login", flag.ContinueOnError)
+	clientID := fs.String("client-id", os.Getenv("NODEPROP_OAUTH_CLIENT_ID"), "OAuth app client ID (default $NODEPROP_OAUTH_CLIENT_ID, else profile oauth_client_id)")
+	scopes := fs.String("scopes", "repo,workflow", "comma-separated OAuth scopes to request")
+	profileName := profileFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	p, err := loadProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	store, err := defaultCredentialStore()
+	if err != nil {
+		return err
+	}
+	id := *clientID
+	if id == "" {
+		id = p.OAuthClientID
+	}
+	if id == "" {
+		return errors.New("an OAuth app client ID is required (--client-id or oauth_client_id in the profile)")
+	}
+
+	df := &flow.DeviceFlow{BaseURL: flow.WebBaseURL(p.APIBaseURL), ClientID: id, Scopes: strings.Split(*scopes, ",")}
+	code, err := df.Start(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "First copy your one-time code: %s\n", code.UserCode)
+	fmt.Fprintf(os.Stderr, "Then open %s in your browser to authorize nodeprop.\n", code.VerificationURI)
+	fmt.Fprintln(os.Stderr, "Waiting for authorization...")
+
+	token, err := df.Poll(ctx, code)
+	if err != nil {
+		return err
+	}
+	if err := store.Set(p.host(), token); err != nil {
+		return fmt.Errorf("failed to store token in %s: %w (set NODEPROP_CREDENTIAL_STORE=file where there is none)", store.Name(), err)
+	}
+	fmt.Printf("Logged in to %s; token stored in %s.\n", p.host(), store.Name())
+	return nil
+}
+
+func authLogout(args []string) error {
+	fs := flag.NewFlagSet("auth logout", flag.ContinueOnError)
+	profileName := profileFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	p, err := loadProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	store, err := defaultCredentialStore()
+	if err != nil {
+		return err
+	}
+	if err := store.Delete(p.host()); err != nil && !errors.Is(err, errNoCredential) {
+		return fmt.Errorf("failed to remove token from %s: %w", store.Name(), err)
+	}
+	fmt.Printf("Logged out of %s.\n", p.host())
+	return nil
+}
+
+// authStatusView is the schema for auth status.
+type authStatusView struct {
+	Host string `json:"host" yaml:"host"`
+	// Source is where the token is read from.
+	Source string `json:"source" yaml:"source"`
+	// StoredIn is the credential store holding a token for Host, if any.
+	StoredIn string `json:"stored_in,omitempty" yaml:"stored_in,omitempty"`
+}
+
+// authStatus reports where the profile's token comes from, without
+// printing it.
+func authStatus(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("auth status", flag.ContinueOnError)
+	format := outputFlag(fs)
+	profileName := profileFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+	p, err := loadProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	store, err := defaultCredentialStore()
+	if err != nil {
+		return err
+	}
+	source, err := p.tokenOrigin(ctx)
+	if err != nil {
+		return err
+	}
+	v := authStatusView{Host: p.host(), Source: source}
+	if _, err := store.Get(p.host()); err == nil {
+		v.StoredIn = store.Name()
+	}
+	return render(os.Stdout, *format, v, func(w io.Writer) {
+		fmt.Fprintf(w, "%s: token from %s\n", v.Host, v.Source)
+		if v.StoredIn != "" && v.StoredIn != v.Source {
+			fmt.Fprintf(w, "%s: token stored in %s\n", v.Host, v.StoredIn)
+		}
+	})
+}
+
+// authStore saves a secret read from stdin under an account in the
+// credential store, for use as a keychain: token source.
+func authStore(args []string) error {
+	if len(args) != 1 || strings.HasPrefix(args[0], "-") {
+		return errors.New("usage: nodeprop auth store ACCOUNT < secret")
+	}
+	account := args[0]
+	store, err := defaultCredentialStore()
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(io.LimitReader(os.Stdin, 1<<20))
+	if err != nil {
+		return err
+	}
+	secret := strings.TrimSpace(string(data))
+	if secret == "" {
+		return errors.New("no secret on stdin")
+	}
+	if err := store.Set(account, secret); err != nil {
+		return fmt.Errorf("failed to store %s in %s: %w", account, store.Name(), err)
+	}
+	fmt.Fprintf(os.Stderr, "Stored %s in %s.\n", account, store.Name())
+	return nil
+}
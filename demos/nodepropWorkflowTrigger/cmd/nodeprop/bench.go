@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"text/tabwriter"
+
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+func runBench(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	run := fs.String("run", "", "only run benchmarks whose name matches this regular expression")
+	baseline := fs.String("baseline", "", "fail if results regress from this file of nodeprop bench -o json")
+	thresholds := nodeproptest.DefaultThresholds
+	fs.Float64Var(&thresholds.Time, "max-time", thresholds.Time, "with --baseline, the fraction ns/op may grow; negative disables")
+	fs.Float64Var(&thresholds.Bytes, "max-bytes", thresholds.Bytes, "with --baseline, the fraction B/op may grow; negative disables")
+	fs.Float64Var(&thresholds.Allocs, "max-allocs", thresholds.Allocs, "with --baseline, the fraction allocs/op may grow; negative disables")
+	format := outputFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("usage: nodeprop bench [--run regexp] [--baseline FILE]")
+	}
+	match, err := regexp.Compile(*run)
+	if err != nil {
+		return fmt.Errorf("invalid --run: %w", err)
+	}
+	var base []nodeproptest.BenchResult
+	if *baseline != "" {
+		if base, err = nodeproptest.LoadBenchResults(*baseline); err != nil {
+			return err
+		}
+	}
+
+	var results []nodeproptest.BenchResult
+	for _, bm := range nodeproptest.Benchmarks {
+		if !match.MatchString(bm.Name) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		r, err := bm.Run()
+		if err != nil {
+			return err
+		}
+		results = append(results, r)
+	}
+	if len(results) == 0 {
+		return fmt.Errorf("no benchmark matches %q", *run)
+	}
+	err = render(os.Stdout, *format, results, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "BENCHMARK\tN\tNS/OP\tB/OP\tALLOCS/OP")
+		for _, r := range results {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\n", r.Name, r.N, r.NsPerOp, r.BytesPerOp, r.AllocsPerOp)
+		}
+		tw.Flush()
+	})
+	if err != nil || base == nil {
+		return err
+	}
+	regressions := nodeproptest.CompareBenchmarks(base, results, thresholds)
+	for _, r := range regressions {
+		fmt.Fprintln(os.Stderr, r)
+	}
+	if len(regressions) > 0 {
+		return fmt.Errorf("%d regressions from %s", len(regressions), *baseline)
+	}
+	return nil
+}
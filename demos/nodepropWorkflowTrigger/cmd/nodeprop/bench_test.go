@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunBenchArgs(t *testing.T) {
+	dir := t.TempDir()
+	corrupt := filepath.Join(dir, "corrupt.json")
+	if err := os.WriteFile(corrupt, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "invalid regexp", args: []string{"--run", "("}, wantErr: "invalid --run"},
+		{name: "no match", args: []string{"--run", "^Nothing$"}, wantErr: "no benchmark matches"},
+		{name: "extra argument", args: []string{"Submit"}, wantErr: "usage"},
+		{name: "unknown format", args: []string{"-o", "xml"}, wantErr: "xml"},
+		{name: "missing baseline", args: []string{"--baseline", filepath.Join(dir, "missing.json")}, wantErr: "missing.json"},
+		{name: "corrupt baseline", args: []string{"--baseline", corrupt}, wantErr: "corrupt.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := runBench(context.Background(), tt.args)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("runBench(%q) error = %v, want one containing %q", tt.args, err, tt.wantErr)
+			}
+		})
+	}
+}
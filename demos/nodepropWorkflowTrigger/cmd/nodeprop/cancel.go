@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// cancelView is the schema for one cancellation attempt.
+type cancelView struct {
+	DispatchID string `json:"dispatch_id" yaml:"dispatch_id"`
+	Repo       string `json:"repo" yaml:"repo"`
+	Workflow   string `json:"workflow" yaml:"workflow"`
+	RunID      int64  `json:"run_id,omitempty" yaml:"run_id,omitempty"`
+	Cancelled  bool   `json:"cancelled" yaml:"cancelled"`
+	Error      string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+func runCancel(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("cancel", flag.ContinueOnError)
+	allPending := fs.Bool("all-pending", false, "cancel every unfinished run started by nodeprop")
+	allRepos := fs.Bool("all-repos", false, "with --all-pending, cover every repository in the history")
+	since := fs.Duration("since", 24*time.Hour, "with --all-pending, only consider dispatches this recent")
+	format := outputFlag(fs)
+	profileName := profileFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+	wantArgs := 2
+	switch {
+	case *allPending && *allRepos:
+		wantArgs = 0
+	case *allPending:
+		wantArgs = 1
+	}
+	if fs.NArg() != wantArgs {
+		return errors.New("usage: nodeprop cancel <owner/repo> <runID|dispatchID> | --all-pending [--all-repos] [owner/repo]")
+	}
+
+	p, err := loadProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	c, err := p.correlator(ctx)
+	if err != nil {
+		return err
+	}
+	repo := ""
+	if fs.NArg() > 0 {
+		repo = p.repo(fs.Arg(0))
+	}
+
+	var targets []flow.DispatchRecord
+	if *allPending {
+		if targets, err = pendingRecords(ctx, c, repo, time.Now().Add(-*since)); err != nil {
+			return err
+		}
+	} else {
+		rec, err := ownedRecord(c, repo, fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		if rec, err = c.Resolve(ctx, rec); err != nil {
+			return err
+		}
+		targets = []flow.DispatchRecord{rec}
+	}
+
+	results := make([]cancelView, 0, len(targets))
+	failed := 0
+	for _, rec := range targets {
+		v := cancelView{DispatchID: rec.ID, Repo: rec.Repo, Workflow: rec.Workflow, RunID: rec.RunID}
+		if err := c.Cancel(ctx, rec); err != nil {
+			v.Error = err.Error()
+			failed++
+		} else {
+			v.Cancelled = true
+		}
+		results = append(results, v)
+	}
+
+	err = render(os.Stdout, *format, results, func(w io.Writer) {
+		if len(results) == 0 {
+			fmt.Fprintln(w, "no unfinished runs to cancel")
+			return
+		}
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tREPO\tWORKFLOW\tRUN\tRESULT")
+		for _, v := range results {
+			result := "cancel requested"
+			if !v.Cancelled {
+				result = "failed: " + v.Error
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\n", v.DispatchID, v.Repo, v.Workflow, v.RunID, result)
+		}
+		tw.Flush()
+	})
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d cancellations failed", failed, len(results))
+	}
+	return nil
+}
+
+// ownedRecord finds a dispatch made by nodeprop by dispatch ID or run ID.
+// Runs nodeprop did not start are refused.
+func ownedRecord(c *flow.RunCorrelator, repo, id string) (flow.DispatchRecord, error) {
+	recs, err := c.History.List(repo)
+	if err != nil {
+		return flow.DispatchRecord{}, err
+	}
+	runID, _ := strconv.ParseInt(id, 10, 64)
+	for _, rec := range recs {
+		if rec.ID == id || (runID != 0 && rec.RunID == runID) {
+			return rec, nil
+		}
+	}
+	return flow.DispatchRecord{}, fmt.Errorf("%s was not started by nodeprop in %s", id, repo)
+}
+
+// pendingRecords resolves unfinished dispatches since the cutoff.
+func pendingRecords(ctx context.Context, c *flow.RunCorrelator, repo string, cutoff time.Time) ([]flow.DispatchRecord, error) {
+	recs, err := c.History.List(repo)
+	if err != nil {
+		return nil, err
+	}
+	var out []flow.DispatchRecord
+	for _, rec := range recs {
+		if rec.Completed() || rec.DispatchedAt.Before(cutoff) {
+			continue
+		}
+		if rec, err = c.Resolve(ctx, rec); err != nil {
+			return nil, err
+		}
+		if !rec.Completed() {
+			out = append(out, rec)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/s3audit"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/sqlitestore"
+)
+
+// profile holds per-endpoint settings so users juggling GHES and github.com
+// don't repeat flags.
+type profile struct {
+	APIBaseURL    string `yaml:"api_base_url"`
+	Org           string `yaml:"org"`
+	TokenSource   string `yaml:"token_source"`
+	DefaultRef    string `yaml:"default_ref"`
+	OAuthClientID string `yaml:"oauth_client_id"`
+	// MaxAttempts overrides flow.DefaultRetryPolicy's attempts per dispatch.
+	MaxAttempts int `yaml:"max_attempts"`
+	// RetryBudgets overrides flow.DefaultRetryPolicy's budget of attempts
+	// per error class, e.g. {not_found: 3} while repositories are created.
+	RetryBudgets map[string]int `yaml:"retry_budgets"`
+	// Audit lists the sinks every dispatch is recorded in: file:PATH,
+	// sqlite:PATH, or s3://BUCKET/PREFIX.
+	Audit []string `yaml:"audit"`
+	// History is where dispatches are recorded: sqlite, the default, or
+	// file for the JSON history of earlier releases.
+	History string `yaml:"history"`
+	// CorrelationInput names a workflow input to send the correlation ID
+	// in, for workflows that declare one.
+	CorrelationInput string `yaml:"correlation_input"`
+	// SecretInputs names workflow inputs whose values are redacted from
+	// the history, output, and errors.
+	SecretInputs []string `yaml:"secret_inputs"`
+	// Redact lists token sources of other secrets to redact, such as a
+	// password passed in an input under several names.
+	Redact []string `yaml:"redact"`
+	// Policy is a policy file every dispatch must pass; see flow.Policy.
+	Policy string `yaml:"policy"`
+	// SLOs are the latency objectives nodeprop slo and serve check
+	// dispatches against.
+	SLOs []flow.SLO `yaml:"slos"`
+	// TLS, if set, configures connections to the API endpoint, e.g. a
+	// private CA or the client certificate of a GHES instance behind an
+	// mTLS gateway.
+	TLS *flow.TLSConfig `yaml:"tls"`
+	// HTTP, if set, tunes the pool of connections to the API endpoint;
+	// see flow.HTTPConfig.
+	HTTP *flow.HTTPConfig `yaml:"http"`
+	// Preflight checks that a dispatch's workflow exists and is active
+	// before sending it, caching what it reads; see flow.MetadataCache.
+	Preflight bool `yaml:"preflight"`
+}
+
+// cliConfig is the file at ~/.config/nodeprop/config.yml:
+//
+//	default_profile: github
+//	profiles:
+//	  github:
+//	    org: Cdaprod
+//	    token_source: env:GITHUB_TOKEN
+//	  ghes:
+//	    api_base_url: https://ghe.example.com/api/v3
+//	    token_source: command:gh auth token --hostname ghe.example.com
+//	    default_ref: develop
+type cliConfig struct {
+	DefaultProfile string             `yaml:"default_profile"`
+	Profiles       map[string]profile `yaml:"profiles"`
+}
+
+// configPath honors NODEPROP_CONFIG, then XDG_CONFIG_HOME, then ~/.config.
+func configPath() string {
+	if p := os.Getenv("NODEPROP_CONFIG"); p != "" {
+		return p
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "nodeprop", "config.yml")
+}
+
+func loadConfig(path string) (*cliConfig, error) {
+	cfg := &cliConfig{}
+	if path == "" {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// profileFlag registers --profile on fs.
+func profileFlag(fs *flag.FlagSet) *string {
+	return fs.String("profile", "", "named profile from "+configPath()+" (default $NODEPROP_PROFILE or default_profile)")
+}
+
+// loadProfile resolves the named profile. An empty name falls back to
+// NODEPROP_PROFILE, then default_profile; with neither, defaults apply.
+func loadProfile(name string) (profile, error) {
+	cfg, err := loadConfig(configPath())
+	if err != nil {
+		return profile{}, err
+	}
+	if name == "" {
+		name = os.Getenv("NODEPROP_PROFILE")
+	}
+	if name == "" {
+		name = cfg.DefaultProfile
+	}
+	if name == "" {
+		return profile{}, nil
+	}
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		return profile{}, fmt.Errorf("profile %q not found in %s", name, configPath())
+	}
+	return p, nil
+}
+
+// retryPolicy is flow.DefaultRetryPolicy with the profile's overrides.
+func (p profile) retryPolicy() (flow.RetryPolicy, error) {
+	rp := flow.DefaultRetryPolicy
+	if p.MaxAttempts > 0 {
+		rp.MaxAttempts = p.MaxAttempts
+	}
+	rp.Budgets = map[string]int{}
+	for class, n := range flow.DefaultRetryPolicy.Budgets {
+		rp.Budgets[class] = n
+	}
+	for class, n := range p.RetryBudgets {
+		if !slices.Contains(flow.ErrorClasses, class) {
+			return rp, fmt.Errorf("retry_budgets: unknown error class %q (want one of %s)", class, strings.Join(flow.ErrorClasses, ", "))
+		}
+		if n < 1 {
+			return rp, fmt.Errorf("retry_budgets: %s must be at least 1", class)
+		}
+		rp.Budgets[class] = n
+	}
+	return rp, nil
+}
+
+// slos returns the profile's SLOs after checking them.
+func (p profile) slos() ([]flow.SLO, error) {
+	seen := map[string]bool{}
+	for _, o := range p.SLOs {
+		if err := o.Validate(); err != nil {
+			return nil, err
+		}
+		if seen[o.Name] {
+			return nil, fmt.Errorf("SLO %s is defined twice", o.Name)
+		}
+		seen[o.Name] = true
+	}
+	return p.SLOs, nil
+}
+
+// ref returns the flag value, else the profile default, else main.
+func (p profile) ref(flagValue string) string {
+	switch {
+	case flagValue != "":
+		return flagValue
+	case p.DefaultRef != "":
+		return p.DefaultRef
+	default:
+		return "main"
+	}
+}
+
+// repo qualifies a bare repository name with the profile's org.
+func (p profile) repo(name string) string {
+	if p.Org != "" && !strings.Contains(name, "/") {
+		return p.Org + "/" + name
+	}
+	return name
+}
+
+// host is the GitHub host the profile points at, used to key stored tokens.
+func (p profile) host() string {
+	u, err := url.Parse(flow.WebBaseURL(p.APIBaseURL))
+	if err != nil || u.Host == "" {
+		return "github.com"
+	}
+	return u.Host
+}
+
+// token resolves the profile's token. Without an explicit token_source it
+// tries GITHUB_TOKEN/GH_TOKEN, then the token stored by nodeprop auth login.
+func (p profile) token(ctx context.Context) (string, error) {
+	if p.TokenSource != "" {
+		tp, err := flow.ParseTokenSource(p.TokenSource)
+		if err != nil {
+			return "", err
+		}
+		return tp.Token(ctx)
+	}
+	token, envErr := flow.DefaultTokenProvider.Token(ctx)
+	if envErr == nil {
+		return token, nil
+	}
+	if store, err := defaultCredentialStore(); err == nil {
+		if token, err := (storedToken{store: store, account: p.host()}).Token(ctx); err == nil {
+			return token, nil
+		}
+	}
+	return "", fmt.Errorf("%w; set a token_source or run nodeprop auth login", envErr)
+}
+
+// tokenOrigin describes where token finds the profile's token.
+func (p profile) tokenOrigin(ctx context.Context) (string, error) {
+	if p.TokenSource != "" {
+		return "token_source " + strings.SplitN(p.TokenSource, " ", 2)[0], nil
+	}
+	for _, name := range []string{"GITHUB_TOKEN", "GH_TOKEN"} {
+		if os.Getenv(name) != "" {
+			return name, nil
+		}
+	}
+	store, err := defaultCredentialStore()
+	if err != nil {
+		return "", err
+	}
+	if _, err := (storedToken{store: store, account: p.host()}).Token(ctx); err != nil {
+		return "", fmt.Errorf("no token: set GITHUB_TOKEN or a token_source: %w", err)
+	}
+	return store.Name(), nil
+}
+
+// client builds a GitHub client for the profile's endpoint and token.
+func (p profile) client(ctx context.Context) (*flow.GitHubClient, error) {
+	// Resolve the token per request, so that a rotated file, a leased
+	// Vault token, or a rotated AWS secret is picked up; commands would
+	// run too often.
+	var tp flow.TokenProvider
+	if p.TokenSource != "" && !strings.HasPrefix(p.TokenSource, "command:") {
+		var err error
+		if tp, err = flow.ParseTokenSource(p.TokenSource); err != nil {
+			return nil, err
+		}
+	}
+	var token string
+	var err error
+	if tp != nil {
+		token, err = tp.Token(ctx)
+	} else {
+		token, err = p.token(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := flow.NewGitHubClient(token)
+	c.TokenProvider = tp
+	if p.HTTP != nil {
+		c.HTTPClient, err = p.HTTP.Client(p.TLS)
+	} else {
+		c.HTTPClient, err = p.TLS.HTTPClient()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.APIBaseURL != "" {
+		c.BaseURL = p.APIBaseURL
+	}
+	c.DebugDump = debugDump
+	if chaos != nil {
+		c.HTTPClient = &http.Client{Transport: chaos.Transport(c.HTTPClient.Transport), Timeout: c.HTTPClient.Timeout}
+	}
+	return c, nil
+}
+
+// stateDir is the per-user directory of the history, dead letters, and
+// approvals.
+func stateDir() string {
+	return filepath.Dir(flow.DefaultHistoryPath())
+}
+
+// correlator builds a RunCorrelator backed by the user's history.
+func (p profile) correlator(ctx context.Context) (*flow.RunCorrelator, error) {
+	return p.correlatorIn(ctx, stateDir())
+}
+
+// historyIn opens the dispatch history in dir: history.db, or history.json
+// if the profile's history is file. Creating history.db imports the
+// records of an existing history.json.
+func (p profile) historyIn(dir string) (flow.HistoryStore, error) {
+	legacy := flow.NewFileHistoryStore(filepath.Join(dir, "history.json"))
+	switch p.History {
+	case "file":
+		return legacy, nil
+	case "", "sqlite":
+	default:
+		return nil, fmt.Errorf("unknown history %q (want sqlite or file)", p.History)
+	}
+	path := filepath.Join(dir, "history.db")
+	_, err := os.Stat(path)
+	fresh := errors.Is(err, os.ErrNotExist)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create history dir: %w", err)
+	}
+	store, err := sqlitestore.OpenHistoryStore(path)
+	if err != nil {
+		return nil, err
+	}
+	if fresh {
+		recs, err := legacy.List("")
+		if err == nil {
+			err = store.Import(recs)
+		}
+		if err != nil {
+			store.Close()
+			os.Remove(path)
+			return nil, fmt.Errorf("failed to import %s: %w", legacy.Path, err)
+		}
+	}
+	return store, nil
+}
+
+// correlatorIn builds a RunCorrelator keeping its history, dead letters,
+// and approvals in dir.
+func (p profile) correlatorIn(ctx context.Context, dir string) (*flow.RunCorrelator, error) {
+	c, err := p.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	history, err := p.historyIn(dir)
+	if err != nil {
+		return nil, err
+	}
+	rc := flow.NewRunCorrelator(c, history)
+	if rc.Retry, err = p.retryPolicy(); err != nil {
+		return nil, err
+	}
+	rc.DeadLetters = flow.NewFileDeadLetterStore(filepath.Join(dir, "deadletters.json"))
+	rc.Approvals = flow.NewFileApprovalStore(filepath.Join(dir, "approvals.json"))
+	rc.Actor = cliIdentity()
+	rc.CorrelationIDInput = p.CorrelationInput
+	rc.SecretInputs = p.SecretInputs
+	if p.Preflight {
+		rc.Metadata = flow.NewMetadataCache(c)
+	}
+	if p.Policy != "" {
+		if rc.Policy, err = flow.LoadPolicy(p.Policy); err != nil {
+			return nil, err
+		}
+	}
+	for _, src := range p.Redact {
+		tp, err := flow.ParseTokenSource(src)
+		if err != nil {
+			return nil, fmt.Errorf("redact: %w", err)
+		}
+		// Token sources add what they read to flow.Secrets.
+		if _, err := tp.Token(ctx); err != nil {
+			return nil, fmt.Errorf("redact %s: %w", src, err)
+		}
+	}
+	if len(p.Audit) > 0 {
+		var sinks flow.AuditSinks
+		for _, spec := range p.Audit {
+			sink, err := openAuditSink(ctx, spec)
+			if err != nil {
+				return nil, fmt.Errorf("audit %s: %w", spec, err)
+			}
+			sinks = append(sinks, sink)
+		}
+		rc.Audit = sinks
+	}
+	return rc, nil
+}
+
+// openAuditSink opens an audit sink given as file:PATH, sqlite:PATH, or
+// s3://BUCKET/PREFIX. A bare file: means flow.DefaultAuditPath().
+func openAuditSink(ctx context.Context, spec string) (flow.AuditSink, error) {
+	switch {
+	case strings.HasPrefix(spec, "file:"):
+		path := strings.TrimPrefix(spec, "file:")
+		if path == "" {
+			path = flow.DefaultAuditPath()
+		}
+		return flow.NewFileAuditSink(path), nil
+	case strings.HasPrefix(spec, "sqlite:"):
+		return sqlitestore.OpenAuditSink(strings.TrimPrefix(spec, "sqlite:"))
+	case strings.HasPrefix(spec, "s3://"):
+		return s3audit.Open(ctx, spec)
+	}
+	return nil, errors.New("want file:PATH, sqlite:PATH, or s3://BUCKET/PREFIX")
+}
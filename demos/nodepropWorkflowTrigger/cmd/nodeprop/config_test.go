@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/sqlitestore"
+)
+
+func TestOpenAuditSink(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		spec    string
+		want    string
+		wantErr bool
+	}{
+		{spec: "file:" + filepath.Join(dir, "audit.jsonl"), want: "*flow.FileAuditSink"},
+		{spec: "file:", want: "*flow.FileAuditSink"},
+		{spec: "sqlite:" + filepath.Join(dir, "audit.db"), want: "*sqlitestore.AuditSink"},
+		{spec: "sqlite:" + filepath.Join(dir, "missing", "audit.db"), wantErr: true},
+		{spec: "s3://", wantErr: true},
+		{spec: "audit.jsonl", wantErr: true},
+	}
+	for _, tt := range tests {
+		sink, err := openAuditSink(context.Background(), tt.spec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("openAuditSink(%q) succeeded", tt.spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("openAuditSink(%q) error = %v", tt.spec, err)
+			continue
+		}
+		switch s := sink.(type) {
+		case *flow.FileAuditSink:
+			if tt.want != "*flow.FileAuditSink" || (tt.spec == "file:" && s.Path != flow.DefaultAuditPath()) {
+				t.Errorf("openAuditSink(%q) = %+v", tt.spec, s)
+			}
+		case *sqlitestore.AuditSink:
+			if tt.want != "*sqlitestore.AuditSink" {
+				t.Errorf("openAuditSink(%q) = %T", tt.spec, s)
+			}
+		default:
+			t.Errorf("openAuditSink(%q) = %T, want %s", tt.spec, sink, tt.want)
+		}
+		if c, ok := sink.(io.Closer); ok {
+			c.Close()
+		}
+	}
+}
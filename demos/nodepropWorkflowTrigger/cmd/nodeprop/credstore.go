@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+	"gopkg.in/yaml.v3"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// keyringService is the OS keychain service under which credentials are
+// stored, keyed by account: the GitHub host for tokens from auth login.
+const keyringService = "nodeprop"
+
+// errNoCredential is returned by a credentialStore without the account.
+var errNoCredential = errors.New("not found")
+
+// credentialStore keeps secrets on a developer machine, so that tokens
+// need not sit in shell profiles.
+type credentialStore interface {
+	Name() string
+	Get(account string) (string, error)
+	Set(account, secret string) error
+	Delete(account string) error
+}
+
+// keychainStore is the OS keychain: the macOS Keychain, the Windows
+// Credential Manager, or the Secret Service (GNOME Keyring, KWallet) on
+// Linux and BSD.
+type keychainStore struct{}
+
+func (keychainStore) Name() string { return "the OS keychain" }
+
+func (keychainStore) Get(account string) (string, error) {
+	secret, err := keyring.Get(keyringService, account)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return "", errNoCredential
+	}
+	return secret, err
+}
+
+func (keychainStore) Set(account, secret string) error {
+	return keyring.Set(keyringService, account, secret)
+}
+
+func (keychainStore) Delete(account string) error {
+	err := keyring.Delete(keyringService, account)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return errNoCredential
+	}
+	return err
+}
+
+// fileStore keeps credentials in a file readable only by the user, for
+// machines without a keychain, such as headless Linux without D-Bus.
+type fileStore struct {
+	path string
+}
+
+// credentialsFile is fileStore's file:
+//
+//	credentials:
+//	  github.com: gho_...
+type credentialsFile struct {
+	Credentials map[string]string `yaml:"credentials"`
+}
+
+func (f fileStore) Name() string { return f.path }
+
+func (f fileStore) load() (credentialsFile, error) {
+	var cf credentialsFile
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cf, nil
+	}
+	if err != nil {
+		return cf, err
+	}
+	if err := yaml.Unmarshal(data, &cf); err != nil {
+		return cf, fmt.Errorf("failed to parse %s: %w", f.path, err)
+	}
+	return cf, nil
+}
+
+func (f fileStore) save(cf credentialsFile) error {
+	data, err := yaml.Marshal(cf)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), ".credentials-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
+
+func (f fileStore) Get(account string) (string, error) {
+	cf, err := f.load()
+	if err != nil {
+		return "", err
+	}
+	secret, ok := cf.Credentials[account]
+	if !ok {
+		return "", errNoCredential
+	}
+	return secret, nil
+}
+
+func (f fileStore) Set(account, secret string) error {
+	cf, err := f.load()
+	if err != nil {
+		return err
+	}
+	if cf.Credentials == nil {
+		cf.Credentials = map[string]string{}
+	}
+	cf.Credentials[account] = secret
+	return f.save(cf)
+}
+
+func (f fileStore) Delete(account string) error {
+	cf, err := f.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := cf.Credentials[account]; !ok {
+		return errNoCredential
+	}
+	delete(cf.Credentials, account)
+	return f.save(cf)
+}
+
+// defaultCredentialStore returns the store selected by NODEPROP_CREDENTIAL_STORE:
+// keychain, the default, or file. It is chosen per machine rather than per
+// profile, since it depends on whether the machine has a keychain.
+func defaultCredentialStore() (credentialStore, error) {
+	switch kind := os.Getenv("NODEPROP_CREDENTIAL_STORE"); kind {
+	case "", "keychain":
+		return keychainStore{}, nil
+	case "file":
+		return fileStore{path: filepath.Join(filepath.Dir(configPath()), "credentials.yml")}, nil
+	default:
+		return nil, fmt.Errorf("unknown NODEPROP_CREDENTIAL_STORE %q (want keychain or file)", kind)
+	}
+}
+
+// parseStoredToken builds a storedToken from a keychain:ACCOUNT source.
+func parseStoredToken(account string) (flow.TokenProvider, error) {
+	if account == "" {
+		return nil, errors.New("missing account")
+	}
+	store, err := defaultCredentialStore()
+	if err != nil {
+		return nil, err
+	}
+	return storedToken{store: store, account: account}, nil
+}
+
+// storedToken is a flow.TokenProvider for a credential in a store, such
+// as a token stored by auth login.
+type storedToken struct {
+	store   credentialStore
+	account string
+}
+
+func (s storedToken) Token(ctx context.Context) (string, error) {
+	token, err := s.store.Get(s.account)
+	if errors.Is(err, errNoCredential) {
+		return "", fmt.Errorf("no credential for %s in %s (run nodeprop auth login or auth store)", s.account, s.store.Name())
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s from %s: %w", s.account, s.store.Name(), err)
+	}
+	return strings.TrimSpace(token), nil
+}
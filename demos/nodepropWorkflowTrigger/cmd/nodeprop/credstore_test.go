@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+func TestCredentialStores(t *testing.T) {
+	keyring.MockInit()
+	tests := []struct {
+		name  string
+		store credentialStore
+	}{
+		{name: "keychain", store: keychainStore{}},
+		{name: "file", store: fileStore{path: filepath.Join(t.TempDir(), "nodeprop", "credentials.yml")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.store
+			if _, err := s.Get("github.com"); !errors.Is(err, errNoCredential) {
+				t.Fatalf("Get() of a missing account error = %v, want errNoCredential", err)
+			}
+			if err := s.Delete("github.com"); !errors.Is(err, errNoCredential) {
+				t.Errorf("Delete() of a missing account error = %v, want errNoCredential", err)
+			}
+			if err := s.Set("github.com", "gho_first"); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Set("ghe.example.com", "gho_ghe"); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Set("github.com", "gho_second"); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := s.Get("github.com"); err != nil || got != "gho_second" {
+				t.Errorf("Get() = %q, %v; want the replaced secret", got, err)
+			}
+			if err := s.Delete("github.com"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.Get("github.com"); !errors.Is(err, errNoCredential) {
+				t.Errorf("Get() after Delete() error = %v", err)
+			}
+			if got, err := s.Get("ghe.example.com"); err != nil || got != "gho_ghe" {
+				t.Errorf("Get() of the other account = %q, %v", got, err)
+			}
+			if f, ok := s.(fileStore); ok {
+				fi, err := os.Stat(f.path)
+				if err != nil || fi.Mode().Perm() != 0o600 {
+					t.Errorf("credentials file mode = %v, %v; want 0600", fi.Mode().Perm(), err)
+				}
+				di, err := os.Stat(filepath.Dir(f.path))
+				if err != nil || di.Mode().Perm() != 0o700 {
+					t.Errorf("credentials directory mode = %v, %v; want 0700", di.Mode().Perm(), err)
+				}
+			}
+		})
+	}
+}
+
+func TestFileStoreCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.yml")
+	if err := os.WriteFile(path, []byte("credentials: [\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s := fileStore{path: path}
+	if _, err := s.Get("github.com"); err == nil || !strings.Contains(err.Error(), "failed to parse") {
+		t.Errorf("Get() error = %v, want a parse error", err)
+	}
+	if err := s.Set("github.com", "gho_x"); err == nil {
+		t.Error("Set() overwrote a file it could not parse")
+	}
+}
+
+func TestDefaultCredentialStore(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("NODEPROP_CONFIG", filepath.Join(dir, "config.yml"))
+	tests := []struct {
+		env     string
+		want    string
+		wantErr bool
+	}{
+		{env: "", want: "the OS keychain"},
+		{env: "keychain", want: "the OS keychain"},
+		{env: "file", want: filepath.Join(dir, "credentials.yml")},
+		{env: "vault", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			t.Setenv("NODEPROP_CREDENTIAL_STORE", tt.env)
+			s, err := defaultCredentialStore()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("defaultCredentialStore() = %v, want an error", s.Name())
+				}
+				return
+			}
+			if err != nil || s.Name() != tt.want {
+				t.Errorf("defaultCredentialStore() = %v, %v; want %s", s, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestStoredToken(t *testing.T) {
+	t.Setenv("NODEPROP_CONFIG", filepath.Join(t.TempDir(), "config.yml"))
+	t.Setenv("NODEPROP_CREDENTIAL_STORE", "file")
+	store, err := defaultCredentialStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("github.com", "gho_stored\n"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		account string
+		want    string
+		wantErr string
+	}{
+		{account: "github.com", want: "gho_stored"},
+		{account: "ghe.example.com", wantErr: "no credential for ghe.example.com"},
+		{account: "", wantErr: "missing account"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.account, func(t *testing.T) {
+			p, err := parseStoredToken(tt.account)
+			var got string
+			if err == nil {
+				got, err = p.Token(context.Background())
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Token() = %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// diffView is the schema for diff.
+type diffView struct {
+	Spec    string              `json:"spec" yaml:"spec"`
+	Against string              `json:"against" yaml:"against"`
+	Changed bool                `json:"changed" yaml:"changed"`
+	Changes []flow.ConfigChange `json:"changes" yaml:"changes"`
+}
+
+func runDiff(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	specPath := fs.String("spec", "", "spec file to apply")
+	against := fs.String("against", flow.DefaultConfigFile, "generated config file to compare with")
+	remote := fs.String("against-remote", "", "compare with the generated config committed in owner/repo instead")
+	ref := fs.String("ref", "", "branch, tag, or SHA to read with --against-remote (default: the default branch)")
+	configFile := fs.String("config-file", flow.DefaultConfigFile, "path of the generated config in the remote repository")
+	exitCode := fs.Bool("exit-code", false, "exit with status 1 when there are changes")
+	format := outputFlag(fs)
+	profileName := profileFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+	if *specPath == "" || fs.NArg() != 0 {
+		return errors.New("usage: nodeprop diff --spec spec.yml [--against .nodeprop.yml | --against-remote owner/repo]")
+	}
+
+	spec, err := flow.LoadNodeConfig(*specPath)
+	if err != nil {
+		return err
+	}
+
+	var current map[string]interface{}
+	source := *against
+	if *remote != "" {
+		p, err := loadProfile(*profileName)
+		if err != nil {
+			return err
+		}
+		repo := p.repo(*remote)
+		c, err := p.client(ctx)
+		if err != nil {
+			return err
+		}
+		data, err := c.FileContents(ctx, repo, *configFile, *ref)
+		if err != nil {
+			return err
+		}
+		if current, err = flow.ParseNodeConfig(data); err != nil {
+			return fmt.Errorf("%s in %s: %w", *configFile, repo, err)
+		}
+		source = repo + ":" + *configFile
+	} else if current, err = flow.LoadNodeConfig(*against); err != nil {
+		return err
+	}
+
+	// The id is a hash of everything else and changes whenever anything does.
+	delete(current, "id")
+	delete(spec, "id")
+	changes := flow.DiffConfig(current, flow.MergeSpec(current, spec))
+
+	v := diffView{Spec: *specPath, Against: source, Changed: len(changes) > 0, Changes: changes}
+	if v.Changes == nil {
+		v.Changes = []flow.ConfigChange{}
+	}
+	err = render(os.Stdout, *format, v, func(w io.Writer) { printDiff(w, v) })
+	if err != nil {
+		return err
+	}
+	if *exitCode && v.Changed {
+		os.Exit(1)
+	}
+	return nil
+}
+
+func printDiff(w io.Writer, v diffView) {
+	if !v.Changed {
+		fmt.Fprintf(w, "%s already matches %s\n", v.Against, v.Spec)
+		return
+	}
+	fmt.Fprintf(w, "--- %s\n+++ %s applied\n", v.Against, v.Spec)
+	for _, c := range v.Changes {
+		switch c.Kind {
+		case flow.ChangeAdded:
+			fmt.Fprintf(w, "+ %s: %s\n", c.Path, flow.FormatConfigValue(c.New))
+		case flow.ChangeRemoved:
+			fmt.Fprintf(w, "- %s: %s\n", c.Path, flow.FormatConfigValue(c.Old))
+		default:
+			fmt.Fprintf(w, "~ %s: %s -> %s\n", c.Path, flow.FormatConfigValue(c.Old), flow.FormatConfigValue(c.New))
+		}
+	}
+	fmt.Fprintf(w, "\n%d change(s); the config id will be recomputed\n", len(v.Changes))
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// deadLetterView is the schema for one dead letter.
+type deadLetterView struct {
+	ID         string            `json:"id" yaml:"id"`
+	Repo       string            `json:"repo" yaml:"repo"`
+	Workflow   string            `json:"workflow" yaml:"workflow"`
+	Ref        string            `json:"ref" yaml:"ref"`
+	Inputs     map[string]string `json:"inputs,omitempty" yaml:"inputs,omitempty"`
+	Attempts   int               `json:"attempts" yaml:"attempts"`
+	Error      string            `json:"error" yaml:"error"`
+	FailedAt   time.Time         `json:"failed_at" yaml:"failed_at"`
+	Replays    int               `json:"replays,omitempty" yaml:"replays,omitempty"`
+	ReplayedAs string            `json:"replayed_as,omitempty" yaml:"replayed_as,omitempty"`
+}
+
+func newDeadLetterView(d flow.DeadLetter) deadLetterView {
+	return deadLetterView{
+		ID:         d.ID,
+		Repo:       d.Repo,
+		Workflow:   d.Workflow,
+		Ref:        d.Ref,
+		Inputs:     d.Inputs,
+		Attempts:   d.Attempts,
+		Error:      d.Error,
+		FailedAt:   d.FailedAt,
+		Replays:    d.Replays,
+		ReplayedAs: d.ReplayedAs,
+	}
+}
+
+func runDLQ(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: nodeprop dlq <list|replay|remove> [flags]")
+	}
+	switch args[0] {
+	case "list":
+		return deadLettersList(args[1:])
+	case "replay":
+		return deadLettersReplay(ctx, args[1:])
+	case "remove":
+		return deadLettersRemove(args[1:])
+	default:
+		return fmt.Errorf("unknown dlq command %q", args[0])
+	}
+}
+
+func deadLettersList(args []string) error {
+	fs := flag.NewFlagSet("dlq list", flag.ContinueOnError)
+	all := fs.Bool("all", false, "include dead letters that were replayed successfully")
+	format := outputFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return errors.New("usage: nodeprop dlq list [--all] [owner/repo]")
+	}
+	letters, err := flow.NewFileDeadLetterStore(flow.DefaultDeadLetterPath()).List()
+	if err != nil {
+		return err
+	}
+	views := []deadLetterView{}
+	for _, d := range letters {
+		if (fs.NArg() == 0 || d.Repo == fs.Arg(0)) && (*all || d.Pending()) {
+			views = append(views, newDeadLetterView(d))
+		}
+	}
+	return render(os.Stdout, *format, views, func(w io.Writer) {
+		if len(views) == 0 {
+			fmt.Fprintln(w, "no dead letters")
+			return
+		}
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tREPO\tWORKFLOW\tREF\tATTEMPTS\tFAILED\tERROR")
+		for _, v := range views {
+			msg := v.Error
+			if v.ReplayedAs != "" {
+				msg = "replayed as " + v.ReplayedAs
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", v.ID, v.Repo, v.Workflow, v.Ref, v.Attempts, v.FailedAt.Local().Format(time.DateTime), msg)
+		}
+		tw.Flush()
+	})
+}
+
+func deadLettersReplay(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("dlq replay", flag.ContinueOnError)
+	all := fs.Bool("all", false, "replay every pending dead letter")
+	format := outputFlag(fs)
+	profileName := profileFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+	if *all == (fs.NArg() > 0) {
+		return errors.New("usage: nodeprop dlq replay <id>... | --all")
+	}
+	p, err := loadProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	c, err := p.correlator(ctx)
+	if err != nil {
+		return err
+	}
+	ids := fs.Args()
+	if *all {
+		letters, err := c.DeadLetters.List()
+		if err != nil {
+			return err
+		}
+		for _, d := range letters {
+			if d.Pending() {
+				ids = append(ids, d.ID)
+			}
+		}
+	}
+
+	results := make([]replayView, 0, len(ids))
+	nfailed := 0
+	for _, id := range ids {
+		r := replayView{Original: id}
+		rec, err := c.ReplayDeadLetter(ctx, id)
+		switch {
+		case errors.Is(err, flow.ErrAlreadyDispatched):
+			r.Result, r.DispatchID = "skipped", rec.ID
+		case err != nil:
+			r.Result, r.Error = "failed", err.Error()
+			nfailed++
+		default:
+			r.Result, r.DispatchID = "dispatched", rec.ID
+		}
+		if rec != nil {
+			r.Repo, r.Workflow, r.Ref = rec.Repo, rec.Workflow, rec.Ref
+		}
+		results = append(results, r)
+	}
+	err = render(os.Stdout, *format, results, func(w io.Writer) {
+		if len(results) == 0 {
+			fmt.Fprintln(w, "no dead letters to replay")
+			return
+		}
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ORIGINAL\tRESULT\tNEW ID")
+		for _, r := range results {
+			result := r.Result
+			if r.Error != "" {
+				result += ": " + r.Error
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Original, result, r.DispatchID)
+		}
+		tw.Flush()
+	})
+	if err != nil {
+		return err
+	}
+	if nfailed > 0 {
+		return fmt.Errorf("%d of %d replays failed", nfailed, len(results))
+	}
+	return nil
+}
+
+func deadLettersRemove(args []string) error {
+	fs := flag.NewFlagSet("dlq remove", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("usage: nodeprop dlq remove <id>...")
+	}
+	store := flow.NewFileDeadLetterStore(flow.DefaultDeadLetterPath())
+	for _, id := range fs.Args() {
+		if err := store.Remove(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// Check outcomes reported by doctor.
+const (
+	checkOK   = "ok"
+	checkWarn = "warn"
+	checkFail = "fail"
+	checkSkip = "skip"
+)
+
+// checkResult is the schema for one doctor check.
+type checkResult struct {
+	Name    string `json:"name" yaml:"name"`
+	Status  string `json:"status" yaml:"status"`
+	Message string `json:"message" yaml:"message"`
+	Fix     string `json:"fix,omitempty" yaml:"fix,omitempty"`
+}
+
+// doctorView is the schema for doctor.
+type doctorView struct {
+	Healthy bool          `json:"healthy" yaml:"healthy"`
+	Checks  []checkResult `json:"checks" yaml:"checks"`
+}
+
+func runDoctor(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	registryPath := fs.String("registry", flow.DefaultRegistryPath(), "registry file to check")
+	var specs stringList
+	fs.Var(&specs, "spec", "manifest file to validate (repeatable)")
+	rateThreshold := fs.Float64("rate-threshold", 0.1, "warn when less than this fraction of the rate limit remains")
+	format := outputFlag(fs)
+	profileName := profileFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("usage: nodeprop doctor [flags]")
+	}
+
+	d := &doctor{}
+	d.run(ctx, *profileName, *registryPath, specs, *rateThreshold)
+
+	v := doctorView{Healthy: !d.failed(), Checks: d.results}
+	if err := render(os.Stdout, *format, v, func(w io.Writer) { printChecks(w, d.results) }); err != nil {
+		return err
+	}
+	if d.failed() {
+		return errors.New("one or more checks failed")
+	}
+	return nil
+}
+
+type doctor struct {
+	results []checkResult
+}
+
+func (d *doctor) add(name, status, message, fix string) {
+	d.results = append(d.results, checkResult{Name: name, Status: status, Message: message, Fix: fix})
+}
+
+func (d *doctor) failed() bool {
+	for _, r := range d.results {
+		if r.Status == checkFail {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *doctor) run(ctx context.Context, profileName, registryPath string, specs []string, rateThreshold float64) {
+	p, err := loadProfile(profileName)
+	if err != nil {
+		d.add("config", checkFail, err.Error(), "fix "+configPath()+" or pass an existing --profile")
+		return
+	}
+	d.add("config", checkOK, "using "+configPath(), "")
+
+	reg := d.checkRegistry(registryPath)
+	d.checkSpecs(specs, reg, p)
+
+	c, err := p.client(ctx)
+	if err != nil {
+		d.add("token", checkFail, err.Error(), "export GITHUB_TOKEN, set token_source in the profile, or run nodeprop auth login")
+		return
+	}
+	base := c.BaseURL
+	rtt, err := c.Ping(ctx)
+	if err != nil {
+		d.add("connectivity", checkFail, err.Error(), "check api_base_url ("+base+") and any proxy or firewall settings")
+		return
+	}
+	d.add("connectivity", checkOK, fmt.Sprintf("%s reachable in %s", base, rtt.Round(time.Millisecond)), "")
+
+	d.checkToken(ctx, c)
+	d.checkRateLimit(ctx, c, rateThreshold)
+	if reg != nil {
+		d.checkRegistryRemote(ctx, c, reg)
+	}
+}
+
+func (d *doctor) checkToken(ctx context.Context, c *flow.GitHubClient) {
+	info, err := c.TokenInfo(ctx)
+	if err != nil {
+		d.add("token", checkFail, err.Error(), "the token was rejected; create a new one or run nodeprop auth login")
+		return
+	}
+	d.add("token", checkOK, "authenticated as "+info.Login, "")
+
+	switch {
+	case info.Scopes == nil:
+		d.add("scopes", checkOK, "fine-grained or app token (GitHub does not report scopes)", "")
+	case info.HasScope("repo"):
+		d.add("scopes", checkOK, "scopes: "+strings.Join(info.Scopes, ", "), "")
+	case info.HasScope("public_repo"):
+		d.add("scopes", checkWarn, "public_repo only; private repositories cannot be dispatched", "grant the repo scope to reach private repositories")
+	default:
+		d.add("scopes", checkFail, "missing repo scope (have: "+strings.Join(info.Scopes, ", ")+")", "grant the repo scope, required to dispatch workflows")
+	}
+}
+
+func (d *doctor) checkRateLimit(ctx context.Context, c *flow.GitHubClient, threshold float64) {
+	rl, err := c.RateLimit(ctx)
+	if err != nil {
+		d.add("rate-limit", checkWarn, err.Error(), "")
+		return
+	}
+	msg := fmt.Sprintf("%d of %d requests remaining, resets at %s", rl.Remaining, rl.Limit, rl.Reset.Local().Format(time.TimeOnly))
+	switch {
+	case rl.Remaining == 0:
+		d.add("rate-limit", checkFail, msg, "wait for the reset or use a GitHub App installation token for a higher limit")
+	case rl.Limit > 0 && float64(rl.Remaining) < threshold*float64(rl.Limit):
+		d.add("rate-limit", checkWarn, msg, "large batches may be throttled; lower --concurrency or wait for the reset")
+	default:
+		d.add("rate-limit", checkOK, msg, "")
+	}
+}
+
+// checkRegistry validates the registry file locally and returns it if it loaded.
+func (d *doctor) checkRegistry(path string) *flow.RepositoryRegistry {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		d.add("registry", checkSkip, "no registry at "+path, "")
+		return nil
+	}
+	reg, err := flow.LoadRegistry(path)
+	if err != nil {
+		d.add("registry", checkFail, err.Error(), "fix the YAML in "+path)
+		return nil
+	}
+
+	problems := 0
+	for _, e := range reg.Repos() {
+		if owner, name, ok := strings.Cut(e.Name, "/"); !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+			d.add("registry", checkFail, fmt.Sprintf("%q is not owner/name", e.Name), "rename the entry in "+path)
+			problems++
+		}
+		if len(e.Workflows) == 0 && len(e.Actions) == 0 {
+			d.add("registry", checkWarn, e.Name+" has no workflows or actions", "add workflows to the entry or remove it")
+			problems++
+		}
+	}
+	if problems == 0 {
+		d.add("registry", checkOK, fmt.Sprintf("%d repositories in %s", len(reg.Repos()), path), "")
+	}
+	return reg
+}
+
+// checkRegistryRemote verifies registered workflows exist and are enabled,
+// listing the workflows of each repository once.
+func (d *doctor) checkRegistryRemote(ctx context.Context, c *flow.GitHubClient, reg *flow.RepositoryRegistry) {
+	meta := flow.NewMetadataCache(c)
+	problems := 0
+	for _, e := range reg.Repos() {
+		for _, name := range e.Workflows {
+			wf, err := meta.Workflow(ctx, e.Name, name)
+			switch {
+			case err != nil:
+				d.add("workflows", checkFail, fmt.Sprintf("%s %s: %v", e.Name, name, err), "check the workflow file exists on the default branch and the token can access "+e.Name)
+				problems++
+			case wf.State != "active":
+				d.add("workflows", checkWarn, fmt.Sprintf("%s %s is %s", e.Name, name, wf.State), "enable the workflow in the repository's Actions tab")
+				problems++
+			}
+		}
+	}
+	if problems == 0 {
+		d.add("workflows", checkOK, "all registered workflows exist and are active", "")
+	}
+}
+
+func (d *doctor) checkSpecs(specs []string, reg *flow.RepositoryRegistry, p profile) {
+	for _, path := range specs {
+		m, err := flow.LoadBatchManifest(path)
+		if err != nil {
+			d.add("spec", checkFail, err.Error(), "fix the manifest schema: targets need repo or selector, and a workflow")
+			continue
+		}
+		targets := m.Resolved()
+		for i := range targets {
+			if targets[i].Repo != "" {
+				targets[i].Repo = p.repo(targets[i].Repo)
+			}
+		}
+		plan, err := flow.BuildPlan(targets, reg)
+		if err != nil {
+			d.add("spec", checkFail, path+": "+err.Error(), "adjust the selectors or the registry so every target resolves")
+			continue
+		}
+		d.add("spec", checkOK, fmt.Sprintf("%s resolves to %d dispatches", path, len(plan.Dispatches)), "")
+	}
+}
+
+func printChecks(w io.Writer, results []checkResult) {
+	marks := map[string]string{checkOK: "[ok]  ", checkWarn: "[warn]", checkFail: "[FAIL]", checkSkip: "[skip]"}
+	for _, r := range results {
+		fmt.Fprintf(w, "%s %-12s %s\n", marks[r.Status], r.Name, r.Message)
+		if r.Fix != "" {
+			fmt.Fprintf(w, "       %-12s fix: %s\n", "", r.Fix)
+		}
+	}
+}
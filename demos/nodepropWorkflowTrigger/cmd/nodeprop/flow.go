@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+func runFlow(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: nodeprop flow <run|resume|graph|history> [flags]")
+	}
+	switch args[0] {
+	case "run":
+		return flowRun(ctx, args[1:])
+	case "resume":
+		return flowResume(ctx, args[1:])
+	case "graph":
+		return flowGraph(args[1:])
+	case "history":
+		return flowHistory(args[1:])
+	default:
+		return fmt.Errorf("unknown flow command %q", args[0])
+	}
+}
+
+func flowRun(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("flow run", flag.ContinueOnError)
+	poll := fs.Duration("poll", flow.DefaultStepPollInterval, "how often the run of a workflow step is checked")
+	registryPath := fs.String("registry", flow.DefaultRegistryPath(), "registry resolving the selectors of fan-out steps and the repo variables of when expressions")
+	event := fs.String("event", "", "webhook event (e.g. push) that when expressions see as started the flow")
+	action := fs.String("action", "", "action of --event")
+	repo := fs.String("repo", "", "repository that sent --event")
+	branch := fs.String("branch", "", "branch of --event")
+	payload := fs.String("payload", "", "JSON file with the payload of --event")
+	notifyPath := fs.String("notify", "", "YAML file of Discord and Teams webhooks told of steps whose on_failure asks to notify")
+	statePath := fs.String("state", flow.DefaultFlowStatePath(), "file the execution is saved to as it runs, for flow resume")
+	format := outputFlag(fs)
+	profileName := profileFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: nodeprop flow run [--poll 15s] [--registry registry.yml] [--event TYPE --repo owner/name ...] flow.yml")
+	}
+	ev := flow.InboundEvent{Type: *event, Action: *action, Repo: *repo, Branch: *branch, Payload: map[string]interface{}{}}
+	if *payload != "" {
+		data, err := os.ReadFile(*payload)
+		if err != nil {
+			return fmt.Errorf("failed to read payload: %w", err)
+		}
+		if err := json.Unmarshal(data, &ev.Payload); err != nil {
+			return fmt.Errorf("failed to parse payload %s: %w", *payload, err)
+		}
+	}
+	g, runner, err := loadFlow(ctx, fs.Arg(0), *registryPath, *notifyPath, *statePath, *profileName, *poll)
+	if err != nil {
+		return err
+	}
+	exec, err := g.RunEvent(ctx, ev, runner)
+	if exec == nil {
+		return err
+	}
+	// A flow that failed still shows how far each step got.
+	if rerr := render(os.Stdout, *format, exec, func(w io.Writer) { printExecution(w, exec) }); rerr != nil {
+		return rerr
+	}
+	if exec.FinishedAt.IsZero() {
+		fmt.Fprintf(os.Stderr, "execution %s was interrupted; continue it with nodeprop flow resume %s %s\n", exec.ID, fs.Arg(0), exec.ID)
+	}
+	return err
+}
+
+func flowResume(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("flow resume", flag.ContinueOnError)
+	poll := fs.Duration("poll", flow.DefaultStepPollInterval, "how often the run of a workflow step is checked")
+	registryPath := fs.String("registry", flow.DefaultRegistryPath(), "registry resolving the selectors of fan-out steps and the repo variables of when expressions")
+	notifyPath := fs.String("notify", "", "YAML file of Discord and Teams webhooks told of steps whose on_failure asks to notify")
+	statePath := fs.String("state", flow.DefaultFlowStatePath(), "file flow run saved the executions to")
+	format := outputFlag(fs)
+	profileName := profileFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		return errors.New("usage: nodeprop flow resume [--state flows.json] flow.yml [execution-id]")
+	}
+	g, runner, err := loadFlow(ctx, fs.Arg(0), *registryPath, *notifyPath, *statePath, *profileName, *poll)
+	if err != nil {
+		return err
+	}
+	// Without an ID every unfinished execution of the flow is resumed.
+	var execs []flow.FlowExecution
+	if id := fs.Arg(1); id != "" {
+		exec, err := g.Store.Get(id)
+		if err != nil {
+			return err
+		}
+		execs = append(execs, *exec)
+	} else if execs, err = flow.UnfinishedFlows(g.Store, g.Def.Name); err != nil {
+		return err
+	}
+	if len(execs) == 0 {
+		fmt.Fprintf(os.Stderr, "no unfinished executions of flow %s\n", g.Def.Name)
+		return nil
+	}
+	var errs []error
+	for i := range execs {
+		exec, err := g.Resume(ctx, &execs[i], runner)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("execution %s: %w", execs[i].ID, err))
+		}
+		if exec == nil {
+			continue
+		}
+		if rerr := render(os.Stdout, *format, exec, func(w io.Writer) { printExecution(w, exec) }); rerr != nil {
+			return rerr
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func flowGraph(args []string) error {
+	fs := flag.NewFlagSet("flow graph", flag.ContinueOnError)
+	format := fs.String("format", flow.GraphMermaid, "diagram format: mermaid or dot")
+	execID := fs.String("execution", "", "color the steps by their status in this execution")
+	statePath := fs.String("state", flow.DefaultFlowStatePath(), "file flow run saved the executions to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: nodeprop flow graph [--format mermaid|dot] [--execution ID] flow.yml")
+	}
+	def, err := flow.LoadFlowDefinition(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	g, err := flow.CompileFlow(def)
+	if err != nil {
+		return err
+	}
+	var exec *flow.FlowExecution
+	if *execID != "" {
+		if exec, err = flow.NewFileFlowStore(*statePath).Get(*execID); err != nil {
+			return err
+		}
+	}
+	out, err := g.ExportGraph(*format, exec)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(os.Stdout, out)
+	return err
+}
+
+func flowHistory(args []string) error {
+	fs := flag.NewFlagSet("flow history", flag.ContinueOnError)
+	version := fs.String("version", "", "only executions of this definition version or digest")
+	since := fs.Duration("since", 7*24*time.Hour, "only executions started this recently; 0 for all")
+	status := fs.String("status", "", "only executions that are unfinished, succeeded, or failed")
+	limit := fs.Int("n", 20, "number of executions to show; 0 for all")
+	statePath := fs.String("state", flow.DefaultFlowStatePath(), "file flow run saved the executions to")
+	format := outputFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return errors.New("usage: nodeprop flow history [--version V] [--status S] [--since 168h] [flow-name]")
+	}
+	q := flow.FlowQuery{Flow: fs.Arg(0), Version: *version, Status: *status, Limit: *limit}
+	if *since > 0 {
+		q.Since = time.Now().Add(-*since)
+	}
+	execs, err := flow.QueryFlows(flow.NewFileFlowStore(*statePath), q)
+	if err != nil {
+		return err
+	}
+	return render(os.Stdout, *format, execs, func(w io.Writer) {
+		if len(execs) == 0 {
+			fmt.Fprintln(w, "no flow executions recorded")
+			return
+		}
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tFLOW\tVERSION\tDIGEST\tSTATUS\tSTARTED\tDURATION")
+		for _, e := range execs {
+			version, duration := e.Version, "-"
+			if version == "" {
+				version = "-"
+			}
+			if !e.FinishedAt.IsZero() {
+				duration = e.FinishedAt.Sub(e.StartedAt).Round(time.Second).String()
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.ID, e.Flow, version, e.Digest, e.Status(), e.StartedAt.Local().Format(time.DateTime), duration)
+		}
+		tw.Flush()
+	})
+}
+
+// loadFlow compiles the flow at path with what running it needs.
+func loadFlow(ctx context.Context, path, registryPath, notifyPath, statePath, profileName string, poll time.Duration) (*flow.FlowGraph, *flow.FlowRunner, error) {
+	def, err := flow.LoadFlowDefinition(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	g, err := flow.CompileFlow(def)
+	if err != nil {
+		return nil, nil, err
+	}
+	if g.Registry, err = flow.LoadRegistry(registryPath); err != nil {
+		return nil, nil, err
+	}
+	if notifyPath != "" {
+		_, notifiers, err := loadNotifiers(ctx, notifyPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		g.Notifier = flow.Notifiers(notifiers)
+	}
+	g.Store = flow.NewFileFlowStore(statePath)
+	p, err := loadProfile(profileName)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := p.correlator(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return g, &flow.FlowRunner{Correlator: c, Registry: g.Registry, PollInterval: poll}, nil
+}
+
+func printExecution(w io.Writer, exec *flow.FlowExecution) {
+	fmt.Fprintf(w, "execution %s of flow %s", exec.ID, exec.Flow)
+	if exec.Version != "" {
+		fmt.Fprintf(w, " version %s", exec.Version)
+	}
+	fmt.Fprintf(w, " (digest %s)\n", exec.Digest)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STEP\tSTATUS\tATTEMPTS\tDURATION\tRUN\tERROR")
+	for _, s := range exec.Steps {
+		duration := "-"
+		if !s.StartedAt.IsZero() && !s.FinishedAt.IsZero() {
+			duration = s.FinishedAt.Sub(s.StartedAt).Round(time.Second).String()
+		}
+		run, msg := "-", s.Error
+		switch {
+		case len(s.Runs) == 1 && s.Runs[0].RunURL != "":
+			run = s.Runs[0].RunURL
+		case len(s.Runs) > 1:
+			succeeded := 0
+			for _, r := range s.Runs {
+				if r.Conclusion == "success" {
+					succeeded++
+				}
+			}
+			run = fmt.Sprintf("%d/%d succeeded", succeeded, len(s.Runs))
+		}
+		if msg == "" {
+			msg = "-"
+		}
+		status := s.Status
+		if s.Tolerated {
+			status += " (continued)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\n", s.Name, status, s.Attempts, duration, run, msg)
+	}
+	for _, set := range []struct {
+		role   string
+		states []flow.StepState
+	}{{"on_failure of", exec.Handlers}, {"compensating", exec.Compensations}} {
+		for _, h := range set.states {
+			msg := h.Error
+			if msg == "" {
+				msg = "-"
+			}
+			fmt.Fprintf(tw, "%s (%s %s)\t%s\t%d\t%s\t-\t%s\n", h.Name, set.role, h.For, h.Status, h.Attempts, h.FinishedAt.Sub(h.StartedAt).Round(time.Second), msg)
+		}
+	}
+	tw.Flush()
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+var flowNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// flowStubs holds the scaffolded step for each provider.
+var flowStubs = map[string]string{
+	flow.ProviderWorkflowDispatch: `  # Runs {{.Workflow}} through workflow_dispatch. The workflow must declare
+  # the nodeprop_id input and include it in its run-name.
+  - name: {{.Step}}
+    provider: workflow_dispatch
+    repo: {{.Repo}}
+    workflow: {{.Workflow}}
+    ref: {{.Ref}}
+    inputs:
+      flow: {{.Flow}}
+{{- if .Needs}}
+    needs: [{{.Needs}}]
+{{- end}}
+`,
+	flow.ProviderRepositoryDispatch: `  # Sends a repository_dispatch event; workflows in the repository listen
+  # for it with "on: repository_dispatch: types: [{{.Flow}}]".
+  - name: {{.Step}}
+    provider: repository_dispatch
+    repo: {{.Repo}}
+    event_type: {{.Flow}}
+    inputs:
+      flow: {{.Flow}}
+{{- if .Needs}}
+    needs: [{{.Needs}}]
+{{- end}}
+`,
+}
+
+type stubData struct {
+	Flow, Step, Repo, Workflow, Ref, Needs string
+}
+
+func runInit(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] != "flow" {
+		return errors.New("usage: nodeprop init flow [flags] <name>")
+	}
+	return runInitFlow(args[1:])
+}
+
+func runInitFlow(args []string) error {
+	fs := flag.NewFlagSet("init flow", flag.ContinueOnError)
+	var providers stringList
+	fs.Var(&providers, "provider", "step provider to scaffold: workflow_dispatch or repository_dispatch (repeatable)")
+	repo := fs.String("repo", "", "repository the steps target (default: OWNER/REPO placeholder)")
+	dir := fs.String("dir", "flows", "directory to write the flow definition to")
+	specPath := fs.String("spec", "spec.yml", "batch manifest to add matching targets to; empty to skip")
+	force := fs.Bool("force", false, "overwrite an existing flow definition")
+	profileName := profileFlag(fs)
+	// Accept the name before the flags too: nodeprop init flow NAME --provider ...
+	var name string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if name == "" && fs.NArg() == 1 {
+		name = fs.Arg(0)
+	} else if name == "" || fs.NArg() != 0 {
+		return errors.New("usage: nodeprop init flow [flags] <name>")
+	}
+	if !flowNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid flow name %q: use lowercase letters, digits, '-' and '_'", name)
+	}
+	if len(providers) == 0 {
+		providers = stringList{flow.ProviderWorkflowDispatch}
+	}
+
+	p, err := loadProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	target := "OWNER/REPO"
+	if *repo != "" {
+		target = p.repo(*repo)
+	}
+
+	def, steps, err := scaffoldFlow(name, target, p.ref(""), providers)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(*dir, name+".yml")
+	if _, err := os.Stat(path); err == nil && !*force {
+		return fmt.Errorf("%s already exists; use --force to overwrite", path)
+	}
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, def, 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("created %s\n", path)
+
+	if *specPath == "" {
+		return nil
+	}
+	var targets []flow.BatchTarget
+	for _, s := range steps {
+		if s.Provider == flow.ProviderWorkflowDispatch {
+			targets = append(targets, flow.BatchTarget{Repo: s.Repo, Workflow: s.Workflow, Inputs: s.Inputs})
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+	if err := appendSpecTargets(*specPath, targets); err != nil {
+		return err
+	}
+	fmt.Printf("added %d target(s) to %s\n", len(targets), *specPath)
+	return nil
+}
+
+// scaffoldFlow renders a flow definition with one chained step per provider
+// and returns it with the parsed steps.
+func scaffoldFlow(name, repo, ref string, providers []string) ([]byte, []flow.FlowStep, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Flow definition scaffolded by nodeprop init flow.\nname: %s\ndescription: TODO describe what the %s flow orchestrates\nsteps:\n", name, name)
+	prev := ""
+	for i, provider := range providers {
+		stub, ok := flowStubs[provider]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown provider %q (want %s or %s)", provider, flow.ProviderWorkflowDispatch, flow.ProviderRepositoryDispatch)
+		}
+		step := fmt.Sprintf("%s-%d", strings.ReplaceAll(provider, "_", "-"), i+1)
+		data := stubData{Flow: name, Step: step, Repo: repo, Workflow: name + ".yml", Ref: ref, Needs: prev}
+		if err := template.Must(template.New(provider).Parse(stub)).Execute(&buf, data); err != nil {
+			return nil, nil, err
+		}
+		prev = step
+	}
+
+	var def flow.FlowDefinition
+	if err := yaml.Unmarshal(buf.Bytes(), &def); err != nil {
+		return nil, nil, err
+	}
+	if err := def.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), def.Steps, nil
+}
+
+// appendSpecTargets adds targets to a batch manifest, creating it if needed
+// and keeping the existing content and comments.
+func appendSpecTargets(path string, targets []flow.BatchTarget) error {
+	var doc yaml.Node
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s is not a batch manifest", path)
+	}
+
+	var seq *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "targets" {
+			seq = root.Content[i+1]
+		}
+	}
+	if seq == nil {
+		seq = &yaml.Node{Kind: yaml.SequenceNode}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "targets"}, seq)
+	}
+	for _, t := range targets {
+		var n yaml.Node
+		if err := n.Encode(t); err != nil {
+			return err
+		}
+		seq.Content = append(seq.Content, &n)
+	}
+
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(path, out.Bytes(), 0o644)
+}
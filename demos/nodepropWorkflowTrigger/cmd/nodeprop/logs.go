@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+func runLogs(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("logs", flag.ContinueOnError)
+	follow := fs.Bool("follow", false, "keep streaming until the run completes")
+	fs.BoolVar(follow, "f", false, "shorthand for --follow")
+	id := fs.String("id", "", "dispatch ID to show (default: the latest dispatch to the repo)")
+	interval := fs.Duration("interval", 5*time.Second, "polling interval with --follow")
+	archive := fs.String("archive", "", "write the zip archive of the run's logs to this file instead of printing them")
+	profileName := profileFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: nodeprop logs [flags] <owner/repo>")
+	}
+	p, err := loadProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	repo := p.repo(fs.Arg(0))
+	c, err := p.correlator(ctx)
+	if err != nil {
+		return err
+	}
+
+	rec, err := latestRecord(c, repo, *id)
+	if err != nil {
+		return err
+	}
+
+	printed := make(map[int64]bool)
+	for {
+		if rec, err = c.Resolve(ctx, rec); err != nil {
+			return err
+		}
+		if rec.RunID != 0 && *archive != "" {
+			if rec.Completed() {
+				return downloadRunLogs(ctx, c.Client, repo, rec.RunID, *archive)
+			}
+			if !*follow {
+				return fmt.Errorf("run %d is %s; use --follow to wait for its logs", rec.RunID, rec.Status)
+			}
+		} else if rec.RunID != 0 {
+			jobs, err := c.Client.ListRunJobs(ctx, repo, rec.RunID)
+			if err != nil {
+				return err
+			}
+			pending := 0
+			for _, job := range jobs {
+				if printed[job.ID] {
+					continue
+				}
+				if job.Status != "completed" {
+					pending++
+					continue
+				}
+				if err := streamJobLog(ctx, c.Client, repo, job, os.Stdout); err != nil {
+					return err
+				}
+				printed[job.ID] = true
+			}
+			if rec.Completed() && pending == 0 {
+				fmt.Fprintf(os.Stderr, "run %d %s\n", rec.RunID, rec.Conclusion)
+				return nil
+			}
+			if !*follow {
+				fmt.Fprintf(os.Stderr, "%d job(s) still running; use --follow to wait for their logs\n", pending)
+				return nil
+			}
+		} else if !*follow {
+			return fmt.Errorf("no run found yet for dispatch %s; use --follow to wait for it", rec.ID)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(*interval):
+		}
+	}
+}
+
+// latestRecord returns the dispatch with the given ID, or the newest for repo.
+func latestRecord(c *flow.RunCorrelator, repo, id string) (flow.DispatchRecord, error) {
+	recs, err := c.Recent(repo, 0)
+	if err != nil {
+		return flow.DispatchRecord{}, err
+	}
+	for _, rec := range recs {
+		if id == "" || rec.ID == id {
+			return rec, nil
+		}
+	}
+	if id != "" {
+		return flow.DispatchRecord{}, fmt.Errorf("no dispatch %s recorded for %s", id, repo)
+	}
+	return flow.DispatchRecord{}, fmt.Errorf("no dispatches recorded for %s", repo)
+}
+
+// streamJobLog copies a completed job's log to w, prefixing each line with the job name.
+func streamJobLog(ctx context.Context, gh *flow.GitHubClient, repo string, job flow.WorkflowJob, w io.Writer) error {
+	logs, err := gh.JobLogs(ctx, repo, job.ID)
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+
+	fmt.Fprintf(w, "==> %s (%s)\n", job.Name, job.Conclusion)
+	// Lines are copied in pieces, so a long one, such as a minified bundle
+	// echoed by a build, is not held whole.
+	r := bufio.NewReaderSize(logs, 32*1024)
+	bw := bufio.NewWriter(w)
+	start := true
+	for {
+		line, err := r.ReadSlice('\n')
+		if len(line) > 0 {
+			if start {
+				fmt.Fprintf(bw, "[%s] ", job.Name)
+			}
+			bw.Write(line)
+			start = line[len(line)-1] == '\n'
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF {
+			if !start {
+				bw.WriteByte('\n')
+			}
+			return bw.Flush()
+		}
+		if err != nil {
+			bw.Flush()
+			return fmt.Errorf("failed to read logs for %s: %w", job.Name, err)
+		}
+	}
+}
+
+// downloadRunLogs writes the log archive of a completed run to path.
+func downloadRunLogs(ctx context.Context, gh *flow.GitHubClient, repo string, runID int64, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	n, err := gh.DownloadRunLogs(ctx, repo, runID, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "wrote %d bytes of logs of run %d to %s\n", n, runID, path)
+	return nil
+}
@@ -0,0 +1,234 @@
+// Command nodeprop dispatches GitHub workflows and tracks the runs they start.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/awssecrets"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/oidc"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/vault"
+)
+
+// version is set at build time with -ldflags "-X main.version=v1.2.3".
+var version string
+
+// command runs a subcommand with its remaining arguments.
+type command struct {
+	summary string
+	run     func(ctx context.Context, args []string) error
+}
+
+var commands = map[string]command{
+	"trigger":   {"dispatch a workflow and record it", runTrigger},
+	"status":    {"show the state of recently triggered runs", runStatus},
+	"watch":     {"follow recently triggered runs until they finish", runWatch},
+	"tui":       {"interactive dashboard of repositories and dispatches", runTUI},
+	"plan":      {"show the dispatches a spec or selector resolves to", runPlan},
+	"policy":    {"check a dispatch against the profile's policy without making it (policy check)", runPolicy},
+	"access":    {"compare the token's scopes and repositories with what the registry's triggers need", runAccess},
+	"apply":     {"execute a saved plan", runApply},
+	"approvals": {"list, approve, and reject dispatches held for approval (approvals list, show, approve, reject, require)", runApprovals},
+	"bench":     {"measure the time and allocations of the dispatch path", runBench},
+	"auth":      {"log in to GitHub with the device flow and manage stored credentials (login, logout, status, store)", runAuth},
+	"dlq":       {"list, replay, and remove dispatches that failed after retrying (dlq list, replay, remove)", runDLQ},
+	"doctor":    {"check token, rate limit, connectivity, registry, and specs", runDoctor},
+	"flow":      {"run a flow definition against GitHub, each step once those it needs succeed (flow run)", runFlow},
+	"init":      {"scaffold a flow definition and matching spec entries (init flow <name>)", runInit},
+	"logs":      {"stream job logs of the run started by the last dispatch", runLogs},
+	"cancel":    {"cancel runs started by nodeprop", runCancel},
+	"diff":      {"show what applying a spec would change in a generated config", runDiff},
+	"replay":    {"re-execute failed dispatches from the history (replay --failed)", runReplay},
+	"report":    {"summarise recent dispatches per repository", runReport},
+	"roles":     {"grant and revoke the API roles stored in a registry (roles list, grant, revoke)", runRoles},
+	"schedule":  {"manage and run cron schedules (schedule add, list, remove, run)", runSchedule},
+	"secrets":   {"set Actions secrets across registered repositories (secrets set)", runSecrets},
+	"serve":     {"run the dispatcher as an HTTP and webhook server", runServe},
+	"simulate":  {"play out a flow or event against simulated runs, without dispatching anything", runSimulate},
+	"slo":       {"report run latencies per workflow against the profile's SLOs", runSLO},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: nodeprop <command> [flags] [args]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].summary)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	name := os.Args[1]
+	cmd, ok := commands[name]
+	if !ok {
+		if name != "help" && name != "-h" && name != "--help" {
+			fmt.Fprintf(os.Stderr, "nodeprop: unknown command %q\n\n", name)
+		}
+		usage()
+		os.Exit(2)
+	}
+
+	if err := setupLogging(); err != nil {
+		fmt.Fprintf(os.Stderr, "nodeprop: %v\n", err)
+		os.Exit(2)
+	}
+	if err := setupDebugDump(); err != nil {
+		fmt.Fprintf(os.Stderr, "nodeprop: %v\n", err)
+		os.Exit(2)
+	}
+	if err := setupChaos(); err != nil {
+		fmt.Fprintf(os.Stderr, "nodeprop: %v\n", err)
+		os.Exit(2)
+	}
+	vault.Register()
+	awssecrets.Register()
+	oidc.Register()
+	flow.RegisterTokenSource("keychain", parseStoredToken)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	shutdownTracing, err := setupTracing(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "nodeprop: tracing: %v\n", err)
+		os.Exit(2)
+	}
+	// Ties the command's dispatches to the operation that ran it, e.g. a
+	// CI pipeline running several commands.
+	if id := os.Getenv("NODEPROP_CORRELATION_ID"); id != "" {
+		if !flow.ValidCorrelationID(id) {
+			fmt.Fprintf(os.Stderr, "nodeprop: NODEPROP_CORRELATION_ID %q is not a valid correlation ID\n", id)
+			os.Exit(2)
+		}
+		ctx = flow.WithCorrelationID(ctx, id)
+	}
+
+	err = cmd.run(ctx, os.Args[2:])
+	// Flush spans before exiting, even after an interrupt.
+	if terr := shutdownTracing(context.WithoutCancel(ctx)); terr != nil {
+		fmt.Fprintf(os.Stderr, "nodeprop: tracing: %v\n", terr)
+	}
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "nodeprop %s: %v\n", name, err)
+		os.Exit(1)
+	}
+}
+
+// setupLogging sends the library's log records to stderr at the level in
+// NODEPROP_LOG_LEVEL (debug, info, warn, or error; default warn), as text
+// or, with NODEPROP_LOG_FORMAT=json, as JSON.
+func setupLogging() error {
+	level := slog.LevelWarn
+	if v := os.Getenv("NODEPROP_LOG_LEVEL"); v != "" {
+		if err := level.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("NODEPROP_LOG_LEVEL: %w", err)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	switch format := os.Getenv("NODEPROP_LOG_FORMAT"); format {
+	case "", "text":
+		h = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("NODEPROP_LOG_FORMAT must be text or json, not %q", format)
+	}
+	slog.SetDefault(slog.New(h))
+	// SetDefault routes the log package through h at info level; keep the
+	// commands' own messages as they were.
+	log.SetOutput(os.Stderr)
+	log.SetFlags(log.LstdFlags)
+	return nil
+}
+
+// debugDump receives failed GitHub requests and responses; nil disables it.
+var debugDump io.Writer
+
+// setupDebugDump opens NODEPROP_DEBUG_DUMP for debugDump: - for stderr, or
+// a file that is appended to.
+func setupDebugDump() error {
+	switch path := os.Getenv("NODEPROP_DEBUG_DUMP"); path {
+	case "":
+	case "-":
+		debugDump = os.Stderr
+	default:
+		// Redaction is best effort; keep the file private all the same.
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return fmt.Errorf("NODEPROP_DEBUG_DUMP: %w", err)
+		}
+		debugDump = f
+	}
+	return nil
+}
+
+// chaos, if set, injects failures into every GitHub request.
+var chaos *flow.ChaosConfig
+
+// setupChaos parses NODEPROP_CHAOS into chaos, for resilience testing of
+// retries, rate-limit waits, and the dead-letter queue.
+func setupChaos() error {
+	spec := os.Getenv("NODEPROP_CHAOS")
+	if spec == "" {
+		return nil
+	}
+	c, err := flow.ParseChaos(spec)
+	if err != nil {
+		return fmt.Errorf("NODEPROP_CHAOS: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "nodeprop: NODEPROP_CHAOS is set; injecting failures into GitHub requests (%s)\n", spec)
+	chaos = &c
+	return nil
+}
+
+// inputFlags collects repeatable key=value flags.
+type inputFlags map[string]string
+
+func (f inputFlags) String() string {
+	pairs := make([]string, 0, len(f))
+	for k, v := range f {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (f inputFlags) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("expected key=value, got %q", s)
+	}
+	f[k] = v
+	return nil
+}
+
+// stringList collects repeatable string flags.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"os"
+	"testing"
+)
+
+func TestSetupLogging(t *testing.T) {
+	tests := []struct {
+		level, format string
+		want          slog.Level
+		wantErr       bool
+	}{
+		{want: slog.LevelWarn},
+		{level: "debug", format: "json", want: slog.LevelDebug},
+		{level: "INFO", format: "text", want: slog.LevelInfo},
+		{level: "error", want: slog.LevelError},
+		{level: "loud", wantErr: true},
+		{format: "xml", wantErr: true},
+	}
+	old := slog.Default()
+	defer func() {
+		slog.SetDefault(old)
+		log.SetOutput(os.Stderr)
+	}()
+	for _, tt := range tests {
+		t.Setenv("NODEPROP_LOG_LEVEL", tt.level)
+		t.Setenv("NODEPROP_LOG_FORMAT", tt.format)
+		slog.SetDefault(old)
+		err := setupLogging()
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("setupLogging() with level %q and format %q succeeded", tt.level, tt.format)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("setupLogging() error = %v", err)
+			continue
+		}
+		h := slog.Default().Handler()
+		if !h.Enabled(context.Background(), tt.want) || h.Enabled(context.Background(), tt.want-1) {
+			t.Errorf("level %q enables from the wrong level, want %v", tt.level, tt.want)
+		}
+		if _, json := h.(*slog.JSONHandler); json != (tt.format == "json") {
+			t.Errorf("format %q has handler %T", tt.format, h)
+		}
+	}
+}
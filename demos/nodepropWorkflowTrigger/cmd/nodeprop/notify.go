@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/discord"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/teams"
+)
+
+// notifyTarget is one entry of a --notify file:
+//
+//	# notify.yml
+//	- type: discord
+//	  url: env:DISCORD_WEBHOOK_URL
+//	  events: [failed, run_completed]
+//	- type: teams
+//	  url: file:/run/secrets/teams-webhook
+//
+// URLs are token sources because webhook URLs carry their own credentials.
+// TLS, if set, configures the connection, e.g. for a relay inside the
+// network that requires a client certificate.
+type notifyTarget struct {
+	Type   string           `yaml:"type"`
+	URL    string           `yaml:"url"`
+	Events []flow.EventType `yaml:"events"`
+	TLS    *flow.TLSConfig  `yaml:"tls"`
+}
+
+// startNotifiers loads the notification targets in path and forwards
+// events from bus to each of them until ctx is cancelled.
+func startNotifiers(ctx context.Context, path string, bus *flow.EventBus) error {
+	targets, notifiers, err := loadNotifiers(ctx, path)
+	if err != nil {
+		return err
+	}
+	for i, n := range notifiers {
+		go flow.ForwardEvents(ctx, bus, n, targets[i].Events, func(err error) {
+			log.Printf("%s: %v", targets[i].Type, err)
+		})
+	}
+	log.Printf("sending notifications to %d targets from %s", len(notifiers), path)
+	return nil
+}
+
+// loadNotifiers returns the notification targets in path and a notifier
+// for each.
+func loadNotifiers(ctx context.Context, path string) ([]notifyTarget, []flow.Notifier, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var targets []notifyTarget
+	if err := yaml.Unmarshal(data, &targets); err != nil {
+		return nil, nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	notifiers := make([]flow.Notifier, len(targets))
+	for i, t := range targets {
+		tp, err := flow.ParseTokenSource(t.URL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: notifier %d: %w", path, i+1, err)
+		}
+		url, err := tp.Token(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: notifier %d: %w", path, i+1, err)
+		}
+		hc, err := t.TLS.HTTPClient()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: notifier %d: %w", path, i+1, err)
+		}
+		switch t.Type {
+		case "discord":
+			notifiers[i] = &discord.Webhook{URL: url, HTTPClient: hc}
+		case "teams":
+			notifiers[i] = &teams.Webhook{URL: url, HTTPClient: hc}
+		default:
+			return nil, nil, fmt.Errorf("%s: notifier %d: unknown type %q (want discord or teams)", path, i+1, t.Type)
+		}
+	}
+	return targets, notifiers, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/discord"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/teams"
+)
+
+func TestLoadNotifiers(t *testing.T) {
+	t.Setenv("NODEPROP_TEST_DISCORD_URL", "https://discord.example.com/hook")
+	tests := []struct {
+		name    string
+		file    string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			file: "- type: discord\n  url: env:NODEPROP_TEST_DISCORD_URL\n  events: [failed]\n- type: teams\n  url: env:NODEPROP_TEST_DISCORD_URL\n",
+		},
+		{name: "unknown type", file: "- type: irc\n  url: env:NODEPROP_TEST_DISCORD_URL\n", wantErr: `notifier 1: unknown type "irc"`},
+		{name: "unset url", file: "- type: discord\n  url: env:NODEPROP_TEST_UNSET\n", wantErr: "notifier 1: "},
+		{name: "invalid yaml", file: "type: discord\n", wantErr: "parse "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "notify.yml")
+			if err := os.WriteFile(path, []byte(tt.file), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			targets, notifiers, err := loadNotifiers(context.Background(), path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("loadNotifiers() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(targets) != 2 || len(targets[0].Events) != 1 {
+				t.Errorf("targets = %+v", targets)
+			}
+			d, ok := notifiers[0].(*discord.Webhook)
+			if !ok || d.URL != "https://discord.example.com/hook" {
+				t.Errorf("notifiers[0] = %#v, want the Discord webhook from the environment", notifiers[0])
+			}
+			if _, ok := notifiers[1].(*teams.Webhook); !ok {
+				t.Errorf("notifiers[1] = %#v, want a Teams webhook", notifiers[1])
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// Results of an org-wide trigger for one repository.
+const (
+	orgDispatched = "dispatched"
+	orgSkipped    = "skipped"
+	orgFailed     = "failed"
+)
+
+// orgResultView is the schema for one repository of an org-wide trigger.
+type orgResultView struct {
+	Repo       string `json:"repo" yaml:"repo"`
+	Result     string `json:"result" yaml:"result"`
+	DispatchID string `json:"dispatch_id,omitempty" yaml:"dispatch_id,omitempty"`
+	Reason     string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// orgView is the schema for trigger --org.
+type orgView struct {
+	Org        string          `json:"org" yaml:"org"`
+	Workflow   string          `json:"workflow" yaml:"workflow"`
+	Total      int             `json:"total" yaml:"total"`
+	Dispatched int             `json:"dispatched" yaml:"dispatched"`
+	Skipped    int             `json:"skipped" yaml:"skipped"`
+	Failed     int             `json:"failed" yaml:"failed"`
+	Results    []orgResultView `json:"results" yaml:"results"`
+}
+
+type orgTrigger struct {
+	org, workflow, ref string
+	inputs             map[string]string
+	concurrency        int
+	rateFloor          int
+	includeArchived    bool
+}
+
+// triggerOrg dispatches workflow in every repository of an org that has it,
+// pacing requests against the rate limit.
+func triggerOrg(ctx context.Context, p profile, t orgTrigger, format string) error {
+	c, err := p.correlator(ctx)
+	if err != nil {
+		return err
+	}
+	c.Client.RateLimitFloor = t.rateFloor
+
+	repos, err := c.Client.ListOwnerRepos(ctx, t.org)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, r := range repos {
+		if (r.Archived || r.Disabled) && !t.includeArchived {
+			continue
+		}
+		names = append(names, r.FullName)
+	}
+
+	v := orgView{Org: t.org, Workflow: t.workflow, Total: len(names), Results: make([]orgResultView, len(names))}
+	bar := newProgressBar(os.Stderr, len(names))
+	dispatch := func(ctx context.Context, repo string) orgResultView { return dispatchOrgRepo(ctx, c, repo, t) }
+	done := 0
+	for res := range flow.Parallel(ctx, flow.Parallelism{Concurrency: t.concurrency}, names, nil, dispatch) {
+		r := res.Value
+		v.Results[res.Index] = r
+		switch r.Result {
+		case orgDispatched:
+			v.Dispatched++
+		case orgSkipped:
+			v.Skipped++
+		default:
+			v.Failed++
+		}
+		done++
+		status := fmt.Sprintf("%d dispatched, %d skipped, %d failed", v.Dispatched, v.Skipped, v.Failed)
+		if rl, ok := c.Client.LastRateLimit(); ok {
+			status += fmt.Sprintf(" | rate limit %d/%d", rl.Remaining, rl.Limit)
+		}
+		bar.update(done, status)
+	}
+	bar.finish()
+
+	err = render(os.Stdout, format, v, func(w io.Writer) { printOrgResults(w, v) })
+	if err != nil {
+		return err
+	}
+	if v.Failed > 0 {
+		return fmt.Errorf("%d of %d dispatches failed", v.Failed, v.Total)
+	}
+	return nil
+}
+
+// dispatchOrgRepo dispatches to repo if it has an active copy of the workflow.
+func dispatchOrgRepo(ctx context.Context, c *flow.RunCorrelator, repo string, t orgTrigger) orgResultView {
+	r := orgResultView{Repo: repo}
+	if err := ctx.Err(); err != nil {
+		r.Result, r.Reason = orgFailed, err.Error()
+		return r
+	}
+	lookup := c.Client.GetWorkflow
+	if c.Metadata != nil {
+		// Submit checks the workflow again; the cache answers both.
+		lookup = c.Metadata.Workflow
+	}
+	wf, err := lookup(ctx, repo, t.workflow)
+	switch {
+	case flow.IsNotFound(err):
+		r.Result, r.Reason = orgSkipped, "workflow not found"
+		return r
+	case err != nil:
+		r.Result, r.Reason = orgFailed, err.Error()
+		return r
+	case wf.State != "active":
+		r.Result, r.Reason = orgSkipped, "workflow "+wf.State
+		return r
+	}
+	rec, err := c.Dispatch(ctx, repo, t.workflow, t.ref, t.inputs)
+	if err != nil {
+		r.Result, r.Reason = orgFailed, err.Error()
+		return r
+	}
+	r.Result, r.DispatchID = orgDispatched, rec.ID
+	return r
+}
+
+func printOrgResults(w io.Writer, v orgView) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "REPO\tRESULT\tDETAIL")
+	for _, r := range v.Results {
+		detail := r.Reason
+		if r.Result == orgDispatched {
+			detail = "id " + r.DispatchID
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Repo, r.Result, detail)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\n%d repositories: %d dispatched, %d skipped, %d failed\n", v.Total, v.Dispatched, v.Skipped, v.Failed)
+}
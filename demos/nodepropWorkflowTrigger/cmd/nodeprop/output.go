@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// Output formats accepted by --output.
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatYAML  = "yaml"
+)
+
+// outputFlag registers --output (and its -o shorthand) on fs.
+func outputFlag(fs *flag.FlagSet) *string {
+	format := fs.String("output", formatTable, "output format: table, json, or yaml")
+	fs.StringVar(format, "o", formatTable, "shorthand for --output")
+	return format
+}
+
+// checkFormat rejects unknown output formats before any work is done.
+func checkFormat(format string) error {
+	switch format {
+	case formatTable, formatJSON, formatYAML:
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q (want table, json, or yaml)", format)
+}
+
+// render writes v as JSON or YAML, or calls table for the human-readable form.
+func render(w io.Writer, format string, v interface{}, table func(io.Writer)) error {
+	switch format {
+	case formatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case formatYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		return enc.Close()
+	default:
+		table(w)
+		return nil
+	}
+}
+
+// The view types below are the machine-readable schemas. Fields may be added
+// but existing names and meanings must not change.
+
+// dispatchView is the schema for a single dispatch and its run.
+type dispatchView struct {
+	ID           string            `json:"id" yaml:"id"`
+	Repo         string            `json:"repo" yaml:"repo"`
+	Workflow     string            `json:"workflow" yaml:"workflow"`
+	Ref          string            `json:"ref" yaml:"ref"`
+	Inputs       map[string]string `json:"inputs,omitempty" yaml:"inputs,omitempty"`
+	DispatchedAt time.Time         `json:"dispatched_at" yaml:"dispatched_at"`
+	Phase        string            `json:"phase" yaml:"phase"`
+	RunID        int64             `json:"run_id,omitempty" yaml:"run_id,omitempty"`
+	RunURL       string            `json:"run_url,omitempty" yaml:"run_url,omitempty"`
+	Status       string            `json:"status,omitempty" yaml:"status,omitempty"`
+	Conclusion   string            `json:"conclusion,omitempty" yaml:"conclusion,omitempty"`
+	Error        string            `json:"error,omitempty" yaml:"error,omitempty"`
+	ReplayOf     string            `json:"replay_of,omitempty" yaml:"replay_of,omitempty"`
+}
+
+func newDispatchView(rec flow.DispatchRecord) dispatchView {
+	return dispatchView{
+		ID:           rec.ID,
+		Repo:         rec.Repo,
+		Workflow:     rec.Workflow,
+		Ref:          rec.Ref,
+		Inputs:       rec.Inputs,
+		DispatchedAt: rec.DispatchedAt,
+		Phase:        dispatchPhase(rec),
+		RunID:        rec.RunID,
+		RunURL:       rec.RunURL,
+		Status:       rec.Status,
+		Conclusion:   rec.Conclusion,
+		Error:        rec.Error,
+		ReplayOf:     rec.ReplayOf,
+	}
+}
+
+func newDispatchViews(recs []flow.DispatchRecord) []dispatchView {
+	out := make([]dispatchView, len(recs))
+	for i, rec := range recs {
+		out[i] = newDispatchView(rec)
+	}
+	return out
+}
+
+// statusView is the schema for status and watch.
+type statusView struct {
+	Repo       string         `json:"repo" yaml:"repo"`
+	Dispatches []dispatchView `json:"dispatches" yaml:"dispatches"`
+}
+
+// batchResultView is the schema for one target of a batch trigger.
+type batchResultView struct {
+	Repo       string `json:"repo" yaml:"repo"`
+	Workflow   string `json:"workflow" yaml:"workflow"`
+	Ref        string `json:"ref" yaml:"ref"`
+	OK         bool   `json:"ok" yaml:"ok"`
+	DispatchID string `json:"dispatch_id,omitempty" yaml:"dispatch_id,omitempty"`
+	Error      string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// batchView is the schema for a batch trigger.
+type batchView struct {
+	Total   int               `json:"total" yaml:"total"`
+	Failed  int               `json:"failed" yaml:"failed"`
+	Results []batchResultView `json:"results" yaml:"results"`
+}
+
+func newBatchView(results []flow.BatchResult) batchView {
+	v := batchView{Total: len(results), Results: make([]batchResultView, len(results))}
+	for i, r := range results {
+		rv := batchResultView{Repo: r.Target.Repo, Workflow: r.Target.Workflow, Ref: r.Target.Ref, OK: r.Err == nil}
+		if r.Err != nil {
+			rv.Error = r.Err.Error()
+			v.Failed++
+		} else {
+			rv.DispatchID = r.Record.ID
+		}
+		v.Results[i] = rv
+	}
+	return v
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+func runPlan(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("plan", flag.ContinueOnError)
+	spec := fs.String("spec", "", "manifest of targets and selectors to resolve")
+	selector := fs.String("select", "", "registry selector to resolve instead of --spec (e.g. tag:infra)")
+	workflow := fs.String("workflow", "", "workflow for --select (default: each repository's registered workflows)")
+	ref := fs.String("ref", "", "ref for --select (default from profile, else main)")
+	inputs := inputFlags{}
+	fs.Var(inputs, "input", "workflow input for --select as key=value (repeatable)")
+	registryPath := fs.String("registry", flow.DefaultRegistryPath(), "registry file used to resolve selectors")
+	out := fs.String("out", "", "write the plan to this file for nodeprop apply")
+	format := outputFlag(fs)
+	profileName := profileFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 || (*spec == "") == (*selector == "") {
+		return errors.New("usage: nodeprop plan (--spec spec.yml | --select SELECTOR) [flags]")
+	}
+	p, err := loadProfile(*profileName)
+	if err != nil {
+		return err
+	}
+
+	m := &flow.BatchManifest{Targets: []flow.BatchTarget{{Selector: *selector, Workflow: *workflow, Ref: *ref, Inputs: inputs}}}
+	if *spec != "" {
+		if m, err = flow.LoadBatchManifest(*spec); err != nil {
+			return err
+		}
+	}
+	plan, err := resolvePlan(p, m, *registryPath)
+	if err != nil {
+		return err
+	}
+
+	if *out != "" {
+		if err := plan.Save(*out); err != nil {
+			return err
+		}
+	}
+	return render(os.Stdout, *format, plan, func(w io.Writer) {
+		printPlan(w, plan)
+		if *out != "" {
+			fmt.Fprintf(w, "\nSaved plan to %s. Run \"nodeprop apply --plan %s\" to execute it.\n", *out, *out)
+		}
+	})
+}
+
+func runApply(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("apply", flag.ContinueOnError)
+	planPath := fs.String("plan", "", "plan file written by nodeprop plan --out")
+	concurrency := fs.Int("concurrency", 4, "maximum dispatches in flight")
+	format := outputFlag(fs)
+	profileName := profileFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 || *planPath == "" {
+		return errors.New("usage: nodeprop apply --plan plan.json [flags]")
+	}
+	p, err := loadProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	plan, err := flow.LoadPlan(*planPath)
+	if err != nil {
+		return err
+	}
+	return dispatchPlan(ctx, p, plan, *concurrency, *format)
+}
+
+// resolvePlan applies profile defaults to m and expands it against the registry.
+func resolvePlan(p profile, m *flow.BatchManifest, registryPath string) (*flow.Plan, error) {
+	m.Defaults.Ref = p.ref(m.Defaults.Ref)
+	targets := m.Resolved()
+	for i := range targets {
+		if targets[i].Repo != "" {
+			targets[i].Repo = p.repo(targets[i].Repo)
+		}
+	}
+	reg, err := flow.LoadRegistry(registryPath)
+	if err != nil {
+		return nil, err
+	}
+	return flow.BuildPlan(targets, reg)
+}
+
+// dispatchPlan runs every dispatch in plan and fails if any failed.
+func dispatchPlan(ctx context.Context, p profile, plan *flow.Plan, concurrency int, format string) error {
+	c, err := p.correlator(ctx)
+	if err != nil {
+		return err
+	}
+
+	targets := plan.Targets()
+	failed := 0
+	results := c.DispatchBatch(ctx, targets, concurrency, func(done int, r flow.BatchResult) {
+		if r.Err != nil {
+			failed++
+		}
+		fmt.Fprintf(os.Stderr, "\r[%d/%d] %d ok, %d failed", done, len(targets), done-failed, failed)
+	})
+	fmt.Fprintln(os.Stderr)
+
+	err = render(os.Stdout, format, newBatchView(results), func(w io.Writer) {
+		for _, r := range results {
+			if r.Err != nil {
+				fmt.Fprintf(w, "FAIL  %s %s: %v\n", r.Target.Repo, r.Target.Workflow, r.Err)
+			} else {
+				fmt.Fprintf(w, "ok    %s %s (id %s)\n", r.Target.Repo, r.Target.Workflow, r.Record.ID)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d dispatches failed", failed, len(targets))
+	}
+	return nil
+}
+
+// printPlan writes a terraform-plan-style summary.
+func printPlan(w io.Writer, plan *flow.Plan) {
+	if len(plan.Dispatches) == 0 {
+		fmt.Fprintln(w, "No dispatches. Nothing to do.")
+		return
+	}
+	fmt.Fprintln(w, "NodeProp will perform the following dispatches:")
+	for _, d := range plan.Dispatches {
+		fmt.Fprintf(w, "\n  + %s\n", d.Repo)
+		fmt.Fprintf(w, "      workflow: %s\n", d.Workflow)
+		fmt.Fprintf(w, "      ref:      %s\n", d.Ref)
+		if d.Source != "" && d.Source != d.Repo {
+			fmt.Fprintf(w, "      source:   %s\n", d.Source)
+		}
+		if len(d.Inputs) > 0 {
+			keys := make([]string, 0, len(d.Inputs))
+			for k := range d.Inputs {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			fmt.Fprintln(w, "      inputs:")
+			for _, k := range keys {
+				fmt.Fprintf(w, "        %s = %q\n", k, d.Inputs[k])
+			}
+		}
+	}
+	fmt.Fprintf(w, "\nPlan: %d dispatches across %d repositories.\n", len(plan.Dispatches), plan.RepoCount())
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// policyCheckView is the schema for policy check.
+type policyCheckView struct {
+	Repo        string `json:"repo" yaml:"repo"`
+	Workflow    string `json:"workflow" yaml:"workflow"`
+	Ref         string `json:"ref" yaml:"ref"`
+	RequestedBy string `json:"requested_by" yaml:"requested_by"`
+	Allowed     bool   `json:"allowed" yaml:"allowed"`
+	// Rule is the deny rule that matched; empty if no allow rule did.
+	Rule   string `json:"rule,omitempty" yaml:"rule,omitempty"`
+	Reason string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+func runPolicy(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] != "check" {
+		return errors.New("usage: nodeprop policy check [flags] <owner/repo> <workflow>")
+	}
+	fs := flag.NewFlagSet("policy check", flag.ContinueOnError)
+	file := fs.String("policy", "", "policy file to check against (default the profile's policy)")
+	ref := fs.String("ref", "", "branch or tag (default from profile, else main)")
+	as := fs.String("as", cliIdentity(), "requester to check as, e.g. key:ci or slack:U123")
+	inputs := inputFlags{}
+	fs.Var(inputs, "input", "workflow input as key=value (repeatable)")
+	format := outputFlag(fs)
+	profileName := profileFlag(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errors.New("usage: nodeprop policy check [flags] <owner/repo> <workflow>")
+	}
+	p, err := loadProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	if *file == "" {
+		*file = p.Policy
+	}
+	if *file == "" {
+		return errors.New("no policy: set policy in the profile or pass --policy")
+	}
+	policy, err := flow.LoadPolicy(*file)
+	if err != nil {
+		return err
+	}
+	req := flow.DispatchRequest{Repo: p.repo(fs.Arg(0)), Workflow: fs.Arg(1), Ref: p.ref(*ref), Inputs: inputs, RequestedBy: *as}
+	v := policyCheckView{Repo: req.Repo, Workflow: req.Workflow, Ref: req.Ref, RequestedBy: req.RequestedBy, Allowed: true}
+	var denied *flow.PolicyError
+	err = policy.Check(ctx, req)
+	if errors.As(err, &denied) {
+		v.Allowed, v.Rule, v.Reason = false, denied.Rule, denied.Reason
+	} else if err != nil {
+		return err
+	}
+	err = render(os.Stdout, *format, v, func(w io.Writer) {
+		if v.Allowed {
+			fmt.Fprintf(w, "allowed: %s %s on %s as %s\n", v.Repo, v.Workflow, v.Ref, v.RequestedBy)
+			return
+		}
+		fmt.Fprintf(w, "denied: %s %s on %s as %s\n", v.Repo, v.Workflow, v.Ref, v.RequestedBy)
+		if v.Rule != "" {
+			fmt.Fprintf(w, "  rule:   %s\n", v.Rule)
+		}
+		fmt.Fprintf(w, "  reason: %s\n", v.Reason)
+	})
+	if err != nil {
+		return err
+	}
+	if !v.Allowed {
+		return flow.ErrPolicyDenied
+	}
+	return nil
+}
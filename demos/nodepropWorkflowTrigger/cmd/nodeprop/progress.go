@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// progressBar draws a single-line progress bar on a terminal. On anything
+// else it stays silent so redirected output is not cluttered.
+type progressBar struct {
+	out   *os.File
+	total int
+	tty   bool
+	width int
+}
+
+func newProgressBar(out *os.File, total int) *progressBar {
+	fi, err := out.Stat()
+	tty := err == nil && fi.Mode()&os.ModeCharDevice != 0
+	return &progressBar{out: out, total: total, tty: tty, width: 30}
+}
+
+// update redraws the bar with done items and a trailing status summary.
+func (b *progressBar) update(done int, status string) {
+	if !b.tty || b.total == 0 {
+		return
+	}
+	filled := b.width * done / b.total
+	bar := strings.Repeat("=", filled)
+	if filled < b.width {
+		bar += ">" + strings.Repeat(" ", b.width-filled-1)
+	}
+	fmt.Fprintf(b.out, "\r\033[K[%s] %d/%d %s", bar, done, b.total, status)
+}
+
+// finish ends the bar's line.
+func (b *progressBar) finish() {
+	if b.tty {
+		fmt.Fprintln(b.out)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// replayView is the schema for one replayed dispatch. Result is one of
+// "dispatched", "skipped" (already replayed), "failed", or "planned" with
+// --dry-run.
+type replayView struct {
+	Original   string `json:"original" yaml:"original"`
+	Repo       string `json:"repo" yaml:"repo"`
+	Workflow   string `json:"workflow" yaml:"workflow"`
+	Ref        string `json:"ref" yaml:"ref"`
+	Result     string `json:"result" yaml:"result"`
+	DispatchID string `json:"dispatch_id,omitempty" yaml:"dispatch_id,omitempty"`
+	Error      string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+func runReplay(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	failed := fs.Bool("failed", false, "replay dispatches that were rejected or whose runs failed")
+	since := fs.Duration("since", time.Hour, "only consider dispatches this recent")
+	concurrency := fs.Int("concurrency", 4, "maximum dispatches in flight")
+	dryRun := fs.Bool("dry-run", false, "list what would be replayed without dispatching")
+	format := outputFlag(fs)
+	profileName := profileFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+	if !*failed || fs.NArg() > 1 {
+		return errors.New("usage: nodeprop replay --failed [--since 1h] [owner/repo]")
+	}
+
+	p, err := loadProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	repo := ""
+	if fs.NArg() == 1 {
+		repo = p.repo(fs.Arg(0))
+	}
+	c, err := p.correlator(ctx)
+	if err != nil {
+		return err
+	}
+	recs, err := replayCandidates(ctx, c, repo, time.Now().Add(-*since))
+	if err != nil {
+		return err
+	}
+
+	results := make([]replayView, len(recs))
+	if *dryRun {
+		for i, rec := range recs {
+			results[i] = replayView{Original: rec.ID, Repo: rec.Repo, Workflow: rec.Workflow, Ref: rec.Ref, Result: "planned"}
+		}
+	} else {
+		replayAll(ctx, c, recs, *concurrency, results)
+	}
+
+	nfailed := 0
+	for _, r := range results {
+		if r.Result == "failed" {
+			nfailed++
+		}
+	}
+	err = render(os.Stdout, *format, results, func(w io.Writer) {
+		if len(results) == 0 {
+			fmt.Fprintln(w, "no failed dispatches to replay")
+			return
+		}
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ORIGINAL\tREPO\tWORKFLOW\tREF\tRESULT\tNEW ID")
+		for _, r := range results {
+			result := r.Result
+			if r.Error != "" {
+				result += ": " + r.Error
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Original, r.Repo, r.Workflow, r.Ref, result, r.DispatchID)
+		}
+		tw.Flush()
+	})
+	if err != nil {
+		return err
+	}
+	if nfailed > 0 {
+		return fmt.Errorf("%d of %d replays failed", nfailed, len(results))
+	}
+	return nil
+}
+
+// replayCandidates returns failed dispatches since cutoff that have not been
+// replayed yet, refreshing unfinished runs first. Only the latest failure in
+// a replay chain is returned, so each original is re-executed at most once
+// per attempt.
+func replayCandidates(ctx context.Context, c *flow.RunCorrelator, repo string, cutoff time.Time) ([]flow.DispatchRecord, error) {
+	recs, err := c.History.List(repo)
+	if err != nil {
+		return nil, err
+	}
+	replayed := make(map[string]bool)
+	for _, rec := range recs {
+		if rec.ReplayOf != "" {
+			replayed[rec.ReplayOf] = true
+		}
+	}
+	var out []flow.DispatchRecord
+	for _, rec := range recs {
+		if rec.DispatchedAt.Before(cutoff) || replayed[rec.ID] {
+			continue
+		}
+		if !rec.Completed() {
+			if rec, err = c.Resolve(ctx, rec); err != nil {
+				return nil, err
+			}
+		}
+		if rec.Failed() {
+			out = append(out, rec)
+		}
+	}
+	return out, nil
+}
+
+// replayAll re-dispatches recs with their original parameters. The
+// idempotency key ties each replay to its original, so running replay again
+// concurrently or after a crash does not dispatch twice.
+func replayAll(ctx context.Context, c *flow.RunCorrelator, recs []flow.DispatchRecord, concurrency int, results []replayView) {
+	reqs := make([]flow.DispatchRequest, len(recs))
+	for i, rec := range recs {
+		reqs[i] = flow.DispatchRequest{
+			Repo:           rec.Repo,
+			Workflow:       rec.Workflow,
+			Ref:            rec.Ref,
+			Inputs:         rec.Inputs,
+			IdempotencyKey: "replay:" + rec.ID,
+			ReplayOf:       rec.ID,
+		}
+	}
+	for res := range c.SubmitAll(ctx, flow.Parallelism{Concurrency: concurrency}, reqs) {
+		rec, got, err := recs[res.Index], res.Value.Record, res.Value.Err
+		r := replayView{Original: rec.ID, Repo: rec.Repo, Workflow: rec.Workflow, Ref: rec.Ref}
+		switch {
+		case errors.Is(err, flow.ErrAlreadyDispatched):
+			r.Result, r.DispatchID = "skipped", got.ID
+		case err != nil:
+			r.Result, r.Error = "failed", err.Error()
+		default:
+			r.Result, r.DispatchID = "dispatched", got.ID
+		}
+		results[res.Index] = r
+	}
+}
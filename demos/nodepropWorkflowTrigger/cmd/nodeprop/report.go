@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+const formatMarkdown = "markdown"
+
+func runReport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	since := fs.Duration("since", 24*time.Hour, "report on dispatches this recent")
+	until := fs.Duration("until", 0, "leave out dispatches more recent than this")
+	status := fs.String("status", "", "only dispatches that are pending, completed, or failed, or runs with this conclusion")
+	refresh := fs.Bool("refresh", false, "resolve unfinished runs against GitHub before reporting")
+	format := fs.String("output", formatMarkdown, "output format: markdown, json, or yaml")
+	fs.StringVar(format, "o", formatMarkdown, "shorthand for --output")
+	profileName := profileFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	switch *format {
+	case formatMarkdown, formatTable:
+		*format = formatMarkdown
+	case formatJSON, formatYAML:
+	default:
+		return fmt.Errorf("unknown output format %q (want markdown, json, or yaml)", *format)
+	}
+	if fs.NArg() > 1 {
+		return errors.New("usage: nodeprop report [flags] [owner/repo]")
+	}
+
+	p, err := loadProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	repo := ""
+	if fs.NArg() == 1 {
+		repo = p.repo(fs.Arg(0))
+	}
+
+	end := time.Now().Add(-*until)
+	q := flow.HistoryQuery{Repo: repo, Since: end.Add(-*since), Until: end, Status: *status}
+	recs, err := p.queryHistory(ctx, q, *refresh)
+	if err != nil {
+		return err
+	}
+
+	r := flow.BuildReport(recs, q.Since, q.Until)
+	if *format == formatMarkdown {
+		printReport(os.Stdout, r)
+		return nil
+	}
+	return render(os.Stdout, *format, r, nil)
+}
+
+// queryHistory returns the records matching q. With refresh, unfinished
+// runs are first resolved against GitHub.
+func (p profile) queryHistory(ctx context.Context, q flow.HistoryQuery, refresh bool) ([]flow.DispatchRecord, error) {
+	if !refresh {
+		history, err := p.historyIn(stateDir())
+		if err != nil {
+			return nil, err
+		}
+		return flow.QueryHistory(history, q)
+	}
+	c, err := p.correlator(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Unfinished runs may have concluded, so filter on status after
+	// resolving them.
+	pending := q
+	pending.Status = ""
+	recs, err := flow.QueryHistory(c.History, pending)
+	if err != nil {
+		return nil, err
+	}
+	for i := range recs {
+		if recs[i].Completed() {
+			continue
+		}
+		if recs[i], err = c.Resolve(ctx, recs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return flow.FilterHistory(recs, q), nil
+}
+
+// printReport writes r as a markdown table suitable for chat and issues.
+func printReport(w io.Writer, r *flow.HistoryReport) {
+	fmt.Fprintf(w, "### nodeprop dispatches, %s to %s\n\n", r.Since.Format("2006-01-02 15:04"), r.Until.Format("2006-01-02 15:04 MST"))
+	if len(r.Repos) == 0 {
+		fmt.Fprintln(w, "No dispatches in this window.")
+		return
+	}
+	fmt.Fprintln(w, "| Repository | Dispatches | Succeeded | Failed | Pending | Median duration |")
+	fmt.Fprintln(w, "|---|---:|---:|---:|---:|---:|")
+	for _, s := range r.Repos {
+		printReportRow(w, "`"+s.Repo+"`", s)
+	}
+	if len(r.Repos) > 1 {
+		printReportRow(w, "**Total**", r.Total)
+	}
+}
+
+func printReportRow(w io.Writer, name string, s flow.RepoReport) {
+	median := "-"
+	if s.MedianDuration > 0 {
+		median = s.MedianDuration.Round(time.Second).String()
+	}
+	fmt.Fprintf(w, "| %s | %d | %d | %d | %d | %s |\n", name, s.Dispatches, s.Succeeded, s.Failed, s.Pending, median)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+func runRoles(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: nodeprop roles <list|grant|revoke> [flags]")
+	}
+	switch args[0] {
+	case "list":
+		return rolesList(args[1:])
+	case "grant":
+		return rolesGrant(args[1:])
+	case "revoke":
+		return rolesRevoke(args[1:])
+	default:
+		return fmt.Errorf("unknown roles command %q", args[0])
+	}
+}
+
+func rolesList(args []string) error {
+	fs := flag.NewFlagSet("roles list", flag.ContinueOnError)
+	registryPath := fs.String("registry", flow.DefaultRegistryPath(), "registry file the roles are stored in")
+	format := outputFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+	reg, err := flow.LoadRegistry(*registryPath)
+	if err != nil {
+		return err
+	}
+	bindings := reg.RoleBindings()
+	if bindings == nil {
+		bindings = []flow.RoleBinding{}
+	}
+	return render(os.Stdout, *format, bindings, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ROLE\tSUBJECTS\tREPOS\tTENANTS")
+		for _, b := range bindings {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", b.Role, strings.Join(b.Subjects, ","), orAll(b.Repos), strings.Join(b.Tenants, ","))
+		}
+		tw.Flush()
+	})
+}
+
+// orAll joins patterns, or says "*" for a binding without any.
+func orAll(patterns []string) string {
+	if len(patterns) == 0 {
+		return "*"
+	}
+	return strings.Join(patterns, ",")
+}
+
+func rolesGrant(args []string) error {
+	fs := flag.NewFlagSet("roles grant", flag.ContinueOnError)
+	role := fs.String("role", "", "role to grant: viewer, triggerer, or admin")
+	var repos, tenants stringList
+	fs.Var(&repos, "repo", "repository glob the role is limited to, e.g. Cdaprod/* (repeatable; default every repository)")
+	fs.Var(&tenants, "tenant", "tenant glob the binding extends to, in the server's registry (repeatable)")
+	registryPath := fs.String("registry", flow.DefaultRegistryPath(), "registry file the roles are stored in")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 || *role == "" {
+		return errors.New("usage: nodeprop roles grant --role ROLE [--repo GLOB] [--tenant GLOB] <subject>...")
+	}
+	reg, err := flow.LoadRegistry(*registryPath)
+	if err != nil {
+		return err
+	}
+	for _, subject := range fs.Args() {
+		if err := reg.Grant(subject, flow.RoleBinding{Role: *role, Repos: repos, Tenants: tenants}); err != nil {
+			return err
+		}
+	}
+	if err := reg.Save(*registryPath); err != nil {
+		return err
+	}
+	fmt.Printf("granted %s in %s to %s\n", *role, orAll(repos), strings.Join(fs.Args(), ", "))
+	return nil
+}
+
+func rolesRevoke(args []string) error {
+	fs := flag.NewFlagSet("roles revoke", flag.ContinueOnError)
+	role := fs.String("role", "", "revoke only this role (default every role)")
+	registryPath := fs.String("registry", flow.DefaultRegistryPath(), "registry file the roles are stored in")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("usage: nodeprop roles revoke [--role ROLE] <subject>...")
+	}
+	reg, err := flow.LoadRegistry(*registryPath)
+	if err != nil {
+		return err
+	}
+	for _, subject := range fs.Args() {
+		if err := reg.Revoke(subject, *role); err != nil {
+			return err
+		}
+	}
+	return reg.Save(*registryPath)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// scheduleView is the schema for one schedule in `schedule list`.
+type scheduleView struct {
+	flow.ScheduleEntry `yaml:",inline"`
+	Next               time.Time `json:"next,omitempty" yaml:"next,omitempty"`
+}
+
+func runSchedule(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: nodeprop schedule <add|list|remove|run> [flags]")
+	}
+	switch args[0] {
+	case "add":
+		return scheduleAdd(args[1:])
+	case "list":
+		return scheduleList(args[1:])
+	case "remove":
+		return scheduleRemove(args[1:])
+	case "run":
+		return scheduleRun(ctx, args[1:])
+	default:
+		return fmt.Errorf("unknown schedule command %q", args[0])
+	}
+}
+
+func scheduleAdd(args []string) error {
+	fs := flag.NewFlagSet("schedule add", flag.ContinueOnError)
+	cron := fs.String("cron", "", `cron expression, e.g. "30 6 * * mon-fri" or @daily`)
+	tz := fs.String("timezone", "", "IANA time zone the expression is evaluated in (default UTC)")
+	ref := fs.String("ref", "", "branch or tag to run the workflow on (default main)")
+	inputs := inputFlags{}
+	fs.Var(inputs, "input", "workflow input as key=value (repeatable)")
+	catchUp := fs.Bool("catch-up", false, "fire once on start if a firing was missed while no scheduler ran")
+	registryPath := fs.String("registry", flow.DefaultRegistryPath(), "registry file the schedule is stored in")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 3 || *cron == "" {
+		return errors.New("usage: nodeprop schedule add --cron EXPR [flags] <name> <owner/repo> <workflow>")
+	}
+	reg, err := flow.LoadRegistry(*registryPath)
+	if err != nil {
+		return err
+	}
+	e := flow.ScheduleEntry{
+		Name:     fs.Arg(0),
+		Cron:     *cron,
+		Timezone: *tz,
+		Repo:     fs.Arg(1),
+		Workflow: fs.Arg(2),
+		Ref:      *ref,
+		Inputs:   inputs,
+		CatchUp:  *catchUp,
+	}
+	if len(e.Inputs) == 0 {
+		e.Inputs = nil
+	}
+	if err := reg.SetSchedule(e); err != nil {
+		return err
+	}
+	if err := reg.Save(*registryPath); err != nil {
+		return err
+	}
+	sched, _ := e.Parse()
+	fmt.Printf("scheduled %s: %s in %s, next at %s\n", e.Name, e.Workflow, e.Repo, sched.Next(time.Now()).Format(time.RFC3339))
+	return nil
+}
+
+func scheduleList(args []string) error {
+	fs := flag.NewFlagSet("schedule list", flag.ContinueOnError)
+	registryPath := fs.String("registry", flow.DefaultRegistryPath(), "registry file the schedules are stored in")
+	format := outputFlag(fs)
+	profileName := profileFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+	reg, err := flow.LoadRegistry(*registryPath)
+	if err != nil {
+		return err
+	}
+	p, err := loadProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	// Next firings depend only on the history, so no token is needed.
+	history, err := p.historyIn(stateDir())
+	if err != nil {
+		return err
+	}
+	s := flow.NewScheduler(reg, flow.NewRunCorrelator(nil, history))
+	now := time.Now()
+	views := []scheduleView{}
+	for _, e := range reg.Schedules() {
+		next, err := s.NextFiring(e, now)
+		if err != nil {
+			return err
+		}
+		views = append(views, scheduleView{ScheduleEntry: e, Next: next})
+	}
+	return render(os.Stdout, *format, views, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tCRON\tTIMEZONE\tREPO\tWORKFLOW\tNEXT")
+		for _, v := range views {
+			tz, next := v.Timezone, "never"
+			if tz == "" {
+				tz = "UTC"
+			}
+			if !v.Next.IsZero() {
+				next = v.Next.Format("2006-01-02 15:04 MST")
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", v.Name, v.Cron, tz, v.Repo, v.Workflow, next)
+		}
+		tw.Flush()
+	})
+}
+
+func scheduleRemove(args []string) error {
+	fs := flag.NewFlagSet("schedule remove", flag.ContinueOnError)
+	registryPath := fs.String("registry", flow.DefaultRegistryPath(), "registry file the schedule is stored in")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: nodeprop schedule remove <name>")
+	}
+	reg, err := flow.LoadRegistry(*registryPath)
+	if err != nil {
+		return err
+	}
+	if err := reg.RemoveSchedule(fs.Arg(0)); err != nil {
+		return err
+	}
+	return reg.Save(*registryPath)
+}
+
+func scheduleRun(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("schedule run", flag.ContinueOnError)
+	registryPath := fs.String("registry", flow.DefaultRegistryPath(), "registry file the schedules are stored in")
+	redisURL := redisFlag(fs)
+	profileName := profileFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	p, err := loadProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	c, err := p.correlator(ctx)
+	if err != nil {
+		return err
+	}
+	reg, err := flow.LoadRegistry(*registryPath)
+	if err != nil {
+		return err
+	}
+	c.ApprovalPolicy = reg
+	if *redisURL != "" {
+		locker, err := openLocker(ctx, *redisURL)
+		if err != nil {
+			return err
+		}
+		defer locker.Close()
+		c.Locker = locker
+	}
+	log.Printf("running schedules from %s", *registryPath)
+	runScheduler(ctx, c, *registryPath)
+	return nil
+}
+
+// schedulerLeaseTTL is how long a scheduler replica that died keeps the
+// scheduler lock before another replica takes over.
+const schedulerLeaseTTL = 30 * time.Second
+
+// runScheduler runs the schedules in registryPath until ctx is cancelled.
+// With a Locker on c, only the replica holding the scheduler lock fires
+// them.
+func runScheduler(ctx context.Context, c *flow.RunCorrelator, registryPath string) {
+	s := newScheduler(c, registryPath)
+	if c.Locker == nil {
+		s.Run(ctx)
+		return
+	}
+	flow.RunAsLeader(ctx, c.Locker, "scheduler", schedulerLeaseTTL, func(ctx context.Context) {
+		log.Printf("scheduler: elected leader")
+		s.Run(ctx)
+		log.Printf("scheduler: no longer leader")
+	}, s.OnError)
+}
+
+// newScheduler creates a Scheduler that reloads registryPath and logs its
+// firings.
+func newScheduler(c *flow.RunCorrelator, registryPath string) *flow.Scheduler {
+	s := flow.NewScheduler(nil, c)
+	s.RegistryPath = registryPath
+	s.OnError = func(err error) { log.Printf("scheduler: %v", err) }
+	s.OnFire = func(e flow.ScheduleEntry, rec *flow.DispatchRecord) {
+		log.Printf("schedule %s: dispatched %s in %s (id %s)", e.Name, rec.Workflow, rec.Repo, rec.ID)
+	}
+	return s
+}
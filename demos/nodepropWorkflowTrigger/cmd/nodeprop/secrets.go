@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// secretResultView is the schema for one secret written to one repository.
+// Secret values are never included.
+type secretResultView struct {
+	Repo   string `json:"repo" yaml:"repo"`
+	Secret string `json:"secret" yaml:"secret"`
+	OK     bool   `json:"ok" yaml:"ok"`
+	Error  string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+func runSecrets(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] != "set" {
+		return errors.New("usage: nodeprop secrets set --repos SELECTOR KEY=VALUE|KEY ...")
+	}
+	fs := flag.NewFlagSet("secrets set", flag.ContinueOnError)
+	selector := fs.String("repos", "", "registry selector of repositories to update (e.g. tag:infra)")
+	registryPath := fs.String("registry", flow.DefaultRegistryPath(), "registry file used to resolve --repos")
+	concurrency := fs.Int("concurrency", 4, "maximum repositories updated at once")
+	dryRun := fs.Bool("dry-run", false, "list the repositories and secrets without writing anything")
+	format := outputFlag(fs)
+	profileName := profileFlag(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+	if *selector == "" || fs.NArg() == 0 {
+		return errors.New("usage: nodeprop secrets set --repos SELECTOR KEY=VALUE|KEY ...")
+	}
+	secrets, err := parseSecretArgs(fs.Args(), os.Stdin)
+	if err != nil {
+		return err
+	}
+
+	reg, err := flow.LoadRegistry(*registryPath)
+	if err != nil {
+		return err
+	}
+	entries, err := reg.Select(*selector)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("selector %q matches no registered repositories", *selector)
+	}
+
+	var results []secretResultView
+	if *dryRun {
+		for _, e := range entries {
+			for _, s := range secrets {
+				results = append(results, secretResultView{Repo: e.Name, Secret: s.name})
+			}
+		}
+		return render(os.Stdout, *format, results, func(w io.Writer) {
+			fmt.Fprintf(w, "Would set %d secret(s) in %d repositories:\n", len(secrets), len(entries))
+			for _, e := range entries {
+				fmt.Fprintf(w, "  %s\n", e.Name)
+			}
+		})
+	}
+
+	p, err := loadProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	c, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+	results = setSecrets(ctx, c, entries, secrets, *concurrency)
+
+	failed := 0
+	for _, r := range results {
+		if !r.OK {
+			failed++
+		}
+	}
+	err = render(os.Stdout, *format, results, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "REPO\tSECRET\tRESULT")
+		for _, r := range results {
+			result := "set"
+			if !r.OK {
+				result = "failed: " + r.Error
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Repo, r.Secret, result)
+		}
+		tw.Flush()
+	})
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d secret writes failed", failed, len(results))
+	}
+	return nil
+}
+
+type secretArg struct {
+	name, value string
+}
+
+// parseSecretArgs parses KEY=VALUE arguments. A bare KEY takes its value from
+// stdin so it stays out of shell history; only one may be given.
+func parseSecretArgs(args []string, stdin io.Reader) ([]secretArg, error) {
+	var out []secretArg
+	fromStdin := false
+	for _, a := range args {
+		name, value, ok := strings.Cut(a, "=")
+		if !flow.ValidSecretName(name) {
+			return nil, fmt.Errorf("invalid secret name %q", name)
+		}
+		if !ok {
+			if fromStdin {
+				return nil, errors.New("only one secret can be read from stdin")
+			}
+			fromStdin = true
+			b, err := io.ReadAll(stdin)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s from stdin: %w", name, err)
+			}
+			value = strings.TrimRight(string(b), "\r\n")
+		}
+		out = append(out, secretArg{name: name, value: value})
+	}
+	return out, nil
+}
+
+// setSecrets writes every secret to every repository, at most concurrency
+// repositories at a time. Results are ordered by repository, then secret.
+func setSecrets(ctx context.Context, c *flow.GitHubClient, entries []flow.RepoEntry, secrets []secretArg, concurrency int) []secretResultView {
+	set := func(ctx context.Context, e flow.RepoEntry) []secretResultView {
+		out := make([]secretResultView, len(secrets))
+		for j, s := range secrets {
+			r := secretResultView{Repo: e.Name, Secret: s.name, OK: true}
+			if err := ctx.Err(); err != nil {
+				r.OK, r.Error = false, err.Error()
+			} else if err := c.SetRepoSecret(ctx, e.Name, s.name, s.value); err != nil {
+				r.OK, r.Error = false, err.Error()
+			}
+			out[j] = r
+		}
+		return out
+	}
+	results := make([]secretResultView, 0, len(entries)*len(secrets))
+	for _, rs := range flow.ParallelSlice(ctx, flow.Parallelism{Concurrency: concurrency}, entries, nil, set, nil) {
+		results = append(results, rs...)
+	}
+	return results
+}
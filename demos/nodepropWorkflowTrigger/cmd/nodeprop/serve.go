@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/discord"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/redislock"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/server"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/slack"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/teams"
+)
+
+func runServe(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", ":8080", "address to listen on")
+	httpTLS := listenerTLS(fs, "", "HTTP")
+	registryPath := fs.String("registry", flow.DefaultRegistryPath(), "registry file of repositories to serve")
+	routesPath := fs.String("routes", "", "YAML file of webhook routing rules")
+	tokenSource := fs.String("token-source", "", "token provider (env:VAR, file:PATH, or command:CMD); overrides the profile")
+	signaturesPath := fs.String("signatures", "", "YAML file of per-source webhook signature secrets")
+	webhookSecret := fs.String("webhook-secret", "", "token source for the GitHub webhook secret, e.g. env:GITHUB_WEBHOOK_SECRET")
+	allowUnsigned := fs.Bool("allow-unsigned", false, "accept webhooks from sources without a secret (development only)")
+	grpcAddr := fs.String("grpc-addr", "", "address to serve the gRPC TriggerService on (disabled if empty)")
+	grpcTLS := listenerTLS(fs, "grpc-", "gRPC")
+	authPath := fs.String("auth", "", "YAML file of API keys and JWT settings protecting the REST and gRPC APIs")
+	insecureNoAuth := fs.Bool("insecure-no-auth", false, "serve the REST API without --auth on a non-loopback --addr (only behind an authenticating proxy)")
+	rateLimitsPath := fs.String("rate-limits", "", "YAML file of per-client and per-tenant API rate limits")
+	tenantsPath := fs.String("tenants", "", "YAML file of tenants served with their own registries, tokens, rules, and quotas")
+	slackSecret := fs.String("slack-signing-secret", "", "token source for the Slack app signing secret; enables /slack/commands")
+	slackBotToken := fs.String("slack-bot-token", "", "token source for a Slack bot token used to post results to channels")
+	slackApprovals := fs.String("slack-approval-channel", "", "Slack channel ID to post dispatches awaiting approval to, with Approve and Reject buttons")
+	notifyPath := fs.String("notify", "", "YAML file of Discord and Teams webhooks to send dispatch results to")
+	alertsPath := fs.String("alerts", "", "YAML file of failure-rate and dead-letter thresholds and the Slack, PagerDuty, or webhook targets to alert")
+	discordKey := fs.String("discord-public-key", "", "hex public key of a Discord application; enables /discord/interactions")
+	teamsSecret := fs.String("teams-secret", "", "token source for a Teams outgoing webhook security token; enables /teams/messages")
+	metricsAddr := fs.String("metrics-addr", "", "address to serve Prometheus metrics on at /metrics (disabled if empty)")
+	metricsTLS := listenerTLS(fs, "metrics-", "metrics")
+	runSchedules := fs.Bool("scheduler", false, "fire the cron schedules stored in the registry")
+	queueSize := fs.Int("queue-size", flow.DefaultQueueCapacity, "events whose dispatches may wait to be sent")
+	queueWorkers := fs.Int("queue-workers", flow.DefaultQueueWorkers, "events whose dispatches are sent at once")
+	queueOverflow := fs.String("queue-overflow", string(flow.OverflowBlock), "what to do with an event when the queue is full: block, drop-oldest, or reject")
+	redisURL := redisFlag(fs)
+	profileName := profileFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("usage: nodeprop serve [flags]")
+	}
+	overflow, err := flow.ParseOverflowPolicy(*queueOverflow)
+	if err != nil {
+		return fmt.Errorf("--queue-overflow: %w", err)
+	}
+
+	p, err := loadProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	if *tokenSource != "" {
+		if _, err := flow.ParseTokenSource(*tokenSource); err != nil {
+			return err
+		}
+		p.TokenSource = *tokenSource
+	}
+	c, err := p.correlator(ctx)
+	if err != nil {
+		return err
+	}
+	reg, err := flow.LoadRegistry(*registryPath)
+	if err != nil {
+		return err
+	}
+	// Repositories registered through the API later share the policy.
+	c.ApprovalPolicy = reg
+	// The server's callers are named by their requests, not by its user.
+	c.Actor = ""
+
+	var locker *redislock.Locker
+	if *redisURL != "" {
+		if locker, err = openLocker(ctx, *redisURL); err != nil {
+			return err
+		}
+		defer locker.Close()
+		c.Locker = locker
+	}
+
+	s := server.New(*addr, c, reg)
+	s.Queue = flow.NewDispatchQueue(*queueSize, *queueWorkers, overflow)
+	// Serving waits for queued dispatches, so this only stops the workers.
+	defer s.Queue.Close(context.Background())
+	if s.TLS, err = serverTLS(httpTLS, ""); err != nil {
+		return err
+	}
+	if *metricsAddr != "" {
+		s.Metrics = server.NewMetrics()
+		if err := instrument(c, s.Metrics); err != nil {
+			return err
+		}
+		if s.Metrics.TLS, err = serverTLS(metricsTLS, "metrics-"); err != nil {
+			return err
+		}
+	}
+	s.RegistryPath = *registryPath
+	s.TokenProvider = tokenFunc(p.token)
+	s.Version = version
+	if s.SLOs, err = p.slos(); err != nil {
+		return err
+	}
+	if *routesPath != "" {
+		rules, err := flow.LoadRoutingRules(*routesPath)
+		if err != nil {
+			return err
+		}
+		s.Router = &flow.EventRouter{Rules: rules, Registry: reg}
+		log.Printf("loaded %d routing rules from %s", len(rules), *routesPath)
+	}
+	if *signaturesPath != "" {
+		if s.Signatures, err = server.LoadSignatureSources(ctx, *signaturesPath); err != nil {
+			return err
+		}
+	}
+	if *webhookSecret != "" {
+		src, err := server.NewSignatureSource(ctx, server.GitHubScheme, *webhookSecret)
+		if err != nil {
+			return fmt.Errorf("webhook secret: %w", err)
+		}
+		if s.Signatures == nil {
+			s.Signatures = map[string]*server.SignatureSource{}
+		}
+		s.Signatures[server.SourceGitHub] = src
+	}
+	s.AllowUnsigned = *allowUnsigned
+	if s.Signatures[server.SourceGitHub] == nil {
+		if !*allowUnsigned {
+			log.Printf("warning: no GitHub webhook secret configured; /webhook will reject every delivery")
+		} else {
+			log.Printf("warning: accepting unsigned webhooks")
+		}
+	}
+	if *authPath != "" {
+		if s.Auth, err = server.LoadAuthConfig(ctx, *authPath); err != nil {
+			return err
+		}
+	} else if !loopbackAddr(*addr) && !*insecureNoAuth {
+		return fmt.Errorf("--addr %s is not a loopback address, which requires --auth or --insecure-no-auth", *addr)
+	} else {
+		log.Printf("warning: no --auth configured; the REST API accepts unauthenticated requests")
+	}
+	if s.Auth == nil && len(reg.RoleBindings()) > 0 {
+		return fmt.Errorf("%s binds roles, which requires --auth", *registryPath)
+	}
+	if *rateLimitsPath != "" {
+		if s.RateLimiter, err = server.LoadRateLimits(*rateLimitsPath); err != nil {
+			return err
+		}
+	}
+	if *tenantsPath != "" {
+		if err := addTenants(ctx, p, s, locker, *tenantsPath, *runSchedules); err != nil {
+			return err
+		}
+	}
+	if *slackSecret != "" {
+		app, err := slackIntegration(ctx, c, reg, *slackSecret, *slackBotToken)
+		if err != nil {
+			return err
+		}
+		defer app.Close()
+		s.Handle("/slack/", app.Handler())
+		if *slackApprovals != "" {
+			if app.BotToken == "" {
+				return errors.New("--slack-approval-channel requires --slack-bot-token")
+			}
+			app.ApprovalChannel = *slackApprovals
+			go flow.ForwardEvents(ctx, c.Events, app, []flow.EventType{flow.EventApprovalRequested}, func(err error) {
+				log.Printf("slack: %v", err)
+			})
+		}
+	}
+	if *discordKey != "" {
+		key, err := discord.ParsePublicKey(*discordKey)
+		if err != nil {
+			return err
+		}
+		app := discord.NewInteractions(key, c, reg)
+		defer app.Close()
+		s.Handle("/discord/interactions", app)
+	}
+	if *teamsSecret != "" {
+		tp, err := flow.ParseTokenSource(*teamsSecret)
+		if err != nil {
+			return err
+		}
+		token, err := tp.Token(ctx)
+		if err != nil {
+			return fmt.Errorf("teams secret: %w", err)
+		}
+		hook, err := teams.NewOutgoingWebhook(token, c, reg)
+		if err != nil {
+			return err
+		}
+		s.Handle("/teams/messages", hook)
+	}
+	if *notifyPath != "" {
+		if err := startNotifiers(ctx, *notifyPath, c.Events); err != nil {
+			return err
+		}
+	}
+	if *alertsPath != "" {
+		if err := startAlerts(ctx, *alertsPath, c); err != nil {
+			return err
+		}
+	}
+	if *runSchedules {
+		go runScheduler(ctx, c, *registryPath)
+	}
+	if s.Metrics != nil {
+		go func() {
+			if err := s.Metrics.ListenAndServe(ctx, *metricsAddr); err != nil {
+				log.Printf("metrics: %v", err)
+			}
+		}()
+		log.Printf("metrics on %s/metrics", *metricsAddr)
+	}
+	log.Printf("nodeprop serving on %s (%d registered repositories)", *addr, len(reg.Repos()))
+	if *grpcAddr == "" {
+		return s.ListenAndServe(ctx)
+	}
+
+	if s.Auth == nil {
+		return errors.New("--grpc-addr requires --auth")
+	}
+	var opts []grpc.ServerOption
+	if cfg, err := serverTLS(grpcTLS, "grpc-"); err != nil {
+		return err
+	} else if cfg != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(cfg)))
+	} else {
+		log.Printf("warning: gRPC is served without TLS; bearer tokens are sent in plaintext")
+	}
+	ln, err := net.Listen("tcp", *grpcAddr)
+	if err != nil {
+		return err
+	}
+	log.Printf("gRPC TriggerService on %s", *grpcAddr)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	grpcErr := make(chan error, 1)
+	go func() {
+		// Stop the HTTP server too if gRPC fails.
+		defer cancel()
+		grpcErr <- s.ServeGRPC(ctx, s.NewGRPCServer(opts...), ln)
+	}()
+	err = s.ListenAndServe(ctx)
+	cancel()
+	if gerr := <-grpcErr; err == nil {
+		err = gerr
+	}
+	return err
+}
+
+// loopbackAddr reports whether addr listens only on a loopback interface.
+// An empty host listens on every interface.
+func loopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// listenerTLS registers the certificate flags of a listener, named with
+// prefix.
+func listenerTLS(fs *flag.FlagSet, prefix, listener string) *flow.TLSConfig {
+	t := &flow.TLSConfig{}
+	fs.StringVar(&t.Cert, prefix+"tls-cert", "", "TLS certificate file for the "+listener+" listener")
+	fs.StringVar(&t.Key, prefix+"tls-key", "", "TLS key file for the "+listener+" listener")
+	fs.StringVar(&t.CA, prefix+"tls-client-ca", "", "CA file of the client certificates the "+listener+" listener requires (mutual TLS)")
+	return t
+}
+
+// serverTLS returns the listener config of t, or nil if no flag was set.
+func serverTLS(t *flow.TLSConfig, prefix string) (*tls.Config, error) {
+	if t.IsZero() {
+		return nil, nil
+	}
+	cfg, err := t.ServerConfig()
+	if err != nil {
+		return nil, fmt.Errorf("--%stls-*: %w", prefix, err)
+	}
+	return cfg, nil
+}
+
+// instrument adds the library's dispatch metrics for c to m's registry.
+func instrument(c *flow.RunCorrelator, m *server.Metrics) error {
+	fm, err := flow.NewMetrics(m.Registry)
+	if err != nil {
+		return err
+	}
+	c.Metrics, c.Client.Metrics = fm, fm
+	return nil
+}
+
+// redisFlag registers --redis.
+func redisFlag(fs *flag.FlagSet) *string {
+	return fs.String("redis", "", "token source for a redis:// URL whose locks are shared by replicas, e.g. env:REDIS_URL")
+}
+
+// openLocker resolves a redis URL token source and connects to it.
+func openLocker(ctx context.Context, source string) (*redislock.Locker, error) {
+	tp, err := flow.ParseTokenSource(source)
+	if err != nil {
+		return nil, err
+	}
+	url, err := tp.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("redis URL: %w", err)
+	}
+	return redislock.Open(ctx, url)
+}
+
+// tokenFunc adapts a function to flow.TokenProvider.
+type tokenFunc func(ctx context.Context) (string, error)
+
+func (f tokenFunc) Token(ctx context.Context) (string, error) { return f(ctx) }
+
+// slackIntegration resolves the Slack secrets and creates the integration.
+func slackIntegration(ctx context.Context, c *flow.RunCorrelator, reg *flow.RepositoryRegistry, secretSource, botSource string) (*slack.Integration, error) {
+	tp, err := flow.ParseTokenSource(secretSource)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := tp.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("slack signing secret: %w", err)
+	}
+	app := slack.New([]byte(secret), c, reg)
+	if botSource != "" {
+		tp, err := flow.ParseTokenSource(botSource)
+		if err != nil {
+			return nil, err
+		}
+		if app.BotToken, err = tp.Token(ctx); err != nil {
+			return nil, fmt.Errorf("slack bot token: %w", err)
+		}
+	}
+	return app, nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+// outcomesFile is the --outcomes file of nodeprop simulate.
+type outcomesFile struct {
+	Default  nodeproptest.Outcome            `yaml:"default"`
+	Outcomes map[string]nodeproptest.Outcome `yaml:"outcomes"`
+}
+
+func runSimulate(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	flowPath := fs.String("flow", "", "flow definition to simulate")
+	routesPath := fs.String("routes", "", "routing rules applied to the event and to every run that completes")
+	event := fs.String("event", "", "simulate this webhook event (e.g. push) instead of --flow")
+	action := fs.String("action", "", "action of --event")
+	repo := fs.String("repo", "", "repository that sent --event")
+	branch := fs.String("branch", "main", "branch of --event")
+	payload := fs.String("payload", "", "JSON file with the payload of --event")
+	changed := fs.String("changed", "", "comma-separated files --event changed, for rules with paths")
+	outcomesPath := fs.String("outcomes", "", "YAML file of run outcomes: default, and outcomes by step, repo/workflow, or repo")
+	registryPath := fs.String("registry", flow.DefaultRegistryPath(), "registry used for selectors, fan-out, and approvals")
+	format := outputFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 || (*flowPath == "") == (*event == "") || (*event != "" && (*repo == "" || *routesPath == "")) {
+		return errors.New("usage: nodeprop simulate (--flow flow.yml | --event TYPE --repo owner/name --routes routes.yml) [flags]")
+	}
+
+	sim := &nodeproptest.Simulation{}
+	reg, err := flow.LoadRegistry(*registryPath)
+	if err != nil {
+		return err
+	}
+	sim.Registry = reg
+	if *routesPath != "" {
+		if sim.Rules, err = flow.LoadRoutingRules(*routesPath); err != nil {
+			return err
+		}
+	}
+	if *outcomesPath != "" {
+		data, err := os.ReadFile(*outcomesPath)
+		if err != nil {
+			return fmt.Errorf("failed to read outcomes: %w", err)
+		}
+		var f outcomesFile
+		if err := yaml.Unmarshal(data, &f); err != nil {
+			return fmt.Errorf("failed to parse outcomes %s: %w", *outcomesPath, err)
+		}
+		sim.Default, sim.Outcomes = f.Default, f.Outcomes
+	}
+
+	var report *nodeproptest.SimulationReport
+	if *flowPath != "" {
+		var def *flow.FlowDefinition
+		if def, err = flow.LoadFlowDefinition(*flowPath); err != nil {
+			return err
+		}
+		report, err = sim.RunFlow(ctx, def)
+	} else {
+		ev := flow.InboundEvent{Type: *event, Action: *action, Repo: *repo, Branch: *branch, Payload: map[string]interface{}{}}
+		if *payload != "" {
+			data, err := os.ReadFile(*payload)
+			if err != nil {
+				return fmt.Errorf("failed to read payload: %w", err)
+			}
+			if err := json.Unmarshal(data, &ev.Payload); err != nil {
+				return fmt.Errorf("failed to parse payload %s: %w", *payload, err)
+			}
+		}
+		if *changed != "" {
+			ev.ChangedFiles = strings.Split(*changed, ",")
+		}
+		report, err = sim.RunEvent(ctx, ev)
+	}
+	if report == nil {
+		return err
+	}
+	// A simulation that stopped early still shows what it did up to then.
+	if rerr := render(os.Stdout, *format, report, func(w io.Writer) { printSimulation(w, report) }); rerr != nil {
+		return rerr
+	}
+	if err != nil {
+		return fmt.Errorf("simulation stopped: %w", err)
+	}
+	if n := len(report.Unsuccessful()); n > 0 {
+		return fmt.Errorf("%d of %d simulated runs did not succeed", n, len(report.Runs))
+	}
+	return nil
+}
+
+// printSimulation writes a timeline of the simulated runs, with times as
+// offsets from the start of the simulation.
+func printSimulation(w io.Writer, report *nodeproptest.SimulationReport) {
+	if len(report.Runs) == 0 {
+		fmt.Fprintln(w, "Nothing was dispatched.")
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STEP/RULE\tREPO\tWORKFLOW\tSTART\tDURATION\tCONCLUSION\tCAUSE")
+	for _, r := range report.Runs {
+		target := r.Workflow
+		if r.EventType != "" {
+			target = "dispatch:" + r.EventType
+		}
+		start, took := "-", "-"
+		if !r.DispatchedAt.IsZero() {
+			start = "+" + r.DispatchedAt.Sub(report.Start).String()
+		}
+		if !r.CompletedAt.IsZero() {
+			took = r.CompletedAt.Sub(r.DispatchedAt).String()
+		}
+		conclusion := r.Conclusion
+		if r.Error != "" {
+			conclusion += ": " + r.Error
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", simulatedName(r), r.Repo, target, start, took, conclusion, r.Cause)
+	}
+	tw.Flush()
+	failed := report.Unsuccessful()
+	var names []string
+	for _, r := range failed {
+		names = append(names, simulatedName(r)+" "+r.Conclusion)
+	}
+	fmt.Fprintf(w, "\n%d runs in %s of simulated time", len(report.Runs), report.End.Sub(report.Start).Round(time.Second))
+	if len(failed) > 0 {
+		fmt.Fprintf(w, "; %d did not succeed (%s)", len(failed), strings.Join(names, ", "))
+	}
+	fmt.Fprintln(w, ".")
+}
+
+// simulatedName is the flow step or routing rule of r.
+func simulatedName(r nodeproptest.SimulatedRun) string {
+	if r.Step != "" {
+		return r.Step
+	}
+	return "rule " + r.Rule
+}
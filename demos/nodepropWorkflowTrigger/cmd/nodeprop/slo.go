@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// errSLOMissed makes nodeprop slo --check exit non-zero.
+var errSLOMissed = errors.New("an SLO was missed")
+
+func runSLO(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("slo", flag.ContinueOnError)
+	since := fs.Duration("since", 7*24*time.Hour, "report on dispatches this recent")
+	until := fs.Duration("until", 0, "leave out dispatches more recent than this")
+	workflow := fs.String("workflow", "", "only this workflow file")
+	refresh := fs.Bool("refresh", false, "resolve unfinished runs against GitHub before reporting")
+	check := fs.Bool("check", false, "exit non-zero if any SLO is missed")
+	format := fs.String("output", formatMarkdown, "output format: markdown, json, or yaml")
+	fs.StringVar(format, "o", formatMarkdown, "shorthand for --output")
+	profileName := profileFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	switch *format {
+	case formatMarkdown, formatTable:
+		*format = formatMarkdown
+	case formatJSON, formatYAML:
+	default:
+		return fmt.Errorf("unknown output format %q (want markdown, json, or yaml)", *format)
+	}
+	if fs.NArg() > 1 {
+		return errors.New("usage: nodeprop slo [flags] [owner/repo]")
+	}
+
+	p, err := loadProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	slos, err := p.slos()
+	if err != nil {
+		return err
+	}
+	repo := ""
+	if fs.NArg() == 1 {
+		repo = p.repo(fs.Arg(0))
+	}
+
+	end := time.Now().Add(-*until)
+	q := flow.HistoryQuery{Repo: repo, Since: end.Add(-*since), Until: end}
+	recs, err := p.queryHistory(ctx, q, *refresh)
+	if err != nil {
+		return err
+	}
+	if *workflow != "" {
+		var only []flow.DispatchRecord
+		for _, rec := range recs {
+			if rec.Workflow == *workflow {
+				only = append(only, rec)
+			}
+		}
+		recs = only
+	}
+
+	r := flow.BuildLatencyReport(recs, slos, q.Since, q.Until)
+	if *format == formatMarkdown {
+		printLatencyReport(os.Stdout, r)
+	} else if err := render(os.Stdout, *format, r, nil); err != nil {
+		return err
+	}
+	if *check && !r.OK() {
+		return errSLOMissed
+	}
+	return nil
+}
+
+// printLatencyReport writes r as markdown tables, latencies and then SLOs,
+// suitable for chat and issues.
+func printLatencyReport(w io.Writer, r *flow.LatencyReport) {
+	fmt.Fprintf(w, "### nodeprop latencies, %s to %s\n\n", r.Since.Format("2006-01-02 15:04"), r.Until.Format("2006-01-02 15:04 MST"))
+	if len(r.Workflows) == 0 {
+		fmt.Fprintln(w, "No dispatches in this window.")
+		return
+	}
+	fmt.Fprintln(w, "| Workflow | Dispatches | Start p50 | Start p95 | Run p50 | Run p95 |")
+	fmt.Fprintln(w, "|---|---:|---:|---:|---:|---:|")
+	var results bool
+	for _, wl := range r.Workflows {
+		fmt.Fprintf(w, "| `%s` | %d | %s | %s | %s | %s |\n", wl.Workflow, wl.Dispatches,
+			latency(wl.StartLatency, wl.StartLatency.P50), latency(wl.StartLatency, wl.StartLatency.P95),
+			latency(wl.RunDuration, wl.RunDuration.P50), latency(wl.RunDuration, wl.RunDuration.P95))
+		results = results || len(wl.SLOs) > 0
+	}
+	if !results {
+		return
+	}
+	fmt.Fprintln(w, "\n| SLO | Workflow | Objective | Compliance | Dispatches judged | Status |")
+	fmt.Fprintln(w, "|---|---|---:|---:|---:|---|")
+	for _, wl := range r.Workflows {
+		for _, s := range wl.SLOs {
+			status := "met"
+			if !s.OK {
+				status = "**missed**"
+			}
+			fmt.Fprintf(w, "| %s | `%s` | %.1f%% | %.1f%% | %d | %s |\n", s.Name, wl.Workflow, s.Objective*100, s.Compliance*100, s.Eligible, status)
+		}
+	}
+}
+
+// latency formats d, one of p's percentiles, or - if p is empty.
+func latency(p flow.Percentiles, d time.Duration) string {
+	if p.Count == 0 {
+		return "-"
+	}
+	return d.Round(time.Second).String()
+}
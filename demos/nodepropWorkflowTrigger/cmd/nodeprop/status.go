@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+func runStatus(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	limit := fs.Int("n", 10, "number of recent dispatches to show")
+	format := outputFlag(fs)
+	profileName := profileFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		return errors.New("usage: nodeprop status [flags] <owner/repo> [runID]")
+	}
+	p, err := loadProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	repo := p.repo(fs.Arg(0))
+
+	c, err := p.correlator(ctx)
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() == 2 {
+		rec, err := lookupRecord(ctx, c, repo, fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		return renderRecords(os.Stdout, *format, repo, []flow.DispatchRecord{rec})
+	}
+
+	recs, err := resolveRecent(ctx, c, repo, *limit)
+	if err != nil {
+		return err
+	}
+	return renderRecords(os.Stdout, *format, repo, recs)
+}
+
+func runWatch(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	limit := fs.Int("n", 10, "number of recent dispatches to follow")
+	interval := fs.Duration("interval", 5*time.Second, "polling interval")
+	timeout := fs.Duration("timeout", 30*time.Minute, "give up after this long")
+	format := outputFlag(fs)
+	profileName := profileFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: nodeprop watch [flags] <owner/repo>")
+	}
+	p, err := loadProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	repo := p.repo(fs.Arg(0))
+
+	c, err := p.correlator(ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+
+	for {
+		recs, err := resolveRecent(ctx, c, repo, *limit)
+		if err != nil {
+			return err
+		}
+		done := allCompleted(recs)
+
+		// Machine-readable output is written once, after every run finishes.
+		if *format != formatTable {
+			if done {
+				return renderRecords(os.Stdout, *format, repo, recs)
+			}
+		} else {
+			if len(recs) == 0 {
+				return renderRecords(os.Stdout, *format, repo, recs)
+			}
+			// Clear the screen and redraw in place.
+			fmt.Print("\033[H\033[2J")
+			fmt.Printf("Watching %s (every %s, Ctrl-C to stop)\n\n", repo, *interval)
+			printRecords(os.Stdout, recs)
+			if done {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(*interval):
+		}
+	}
+}
+
+// lookupRecord finds a dispatch by history ID or, for numeric IDs, by GitHub run ID.
+func lookupRecord(ctx context.Context, c *flow.RunCorrelator, repo, id string) (flow.DispatchRecord, error) {
+	recs, err := c.History.List(repo)
+	if err != nil {
+		return flow.DispatchRecord{}, err
+	}
+	runID, _ := strconv.ParseInt(id, 10, 64)
+	for _, rec := range recs {
+		if rec.ID == id || (runID != 0 && rec.RunID == runID) {
+			return c.Resolve(ctx, rec)
+		}
+	}
+	if runID == 0 {
+		return flow.DispatchRecord{}, fmt.Errorf("no dispatch %s recorded for %s", id, repo)
+	}
+
+	// Not one of ours; show the run directly.
+	run, err := c.Client.GetWorkflowRun(ctx, repo, runID)
+	if err != nil {
+		return flow.DispatchRecord{}, err
+	}
+	return flow.DispatchRecord{
+		Repo:         repo,
+		Workflow:     run.Name,
+		Ref:          run.HeadBranch,
+		DispatchedAt: run.CreatedAt,
+		RunID:        run.ID,
+		RunURL:       run.HTMLURL,
+		Status:       run.Status,
+		Conclusion:   run.Conclusion,
+		UpdatedAt:    run.UpdatedAt,
+	}, nil
+}
+
+// resolveRecent refreshes the newest dispatches for repo.
+func resolveRecent(ctx context.Context, c *flow.RunCorrelator, repo string, limit int) ([]flow.DispatchRecord, error) {
+	recs, err := c.Recent(repo, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range recs {
+		if recs[i], err = c.Resolve(ctx, recs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return recs, nil
+}
+
+func allCompleted(recs []flow.DispatchRecord) bool {
+	for _, rec := range recs {
+		if !rec.Completed() {
+			return false
+		}
+	}
+	return true
+}
+
+// dispatchPhase buckets a record into pending, active, or finished.
+func dispatchPhase(rec flow.DispatchRecord) string {
+	switch {
+	case rec.Completed():
+		return "finished"
+	case rec.Status == "in_progress":
+		return "active"
+	default:
+		return "pending"
+	}
+}
+
+// runState summarizes a record for display.
+func runState(rec flow.DispatchRecord) string {
+	switch {
+	case rec.RunID == 0:
+		return "waiting for run"
+	case rec.Completed():
+		return rec.Conclusion
+	default:
+		return rec.Status
+	}
+}
+
+// renderRecords writes recs for repo in the requested format.
+func renderRecords(w io.Writer, format, repo string, recs []flow.DispatchRecord) error {
+	v := statusView{Repo: repo, Dispatches: newDispatchViews(recs)}
+	return render(w, format, v, func(w io.Writer) {
+		if len(recs) == 0 {
+			fmt.Fprintf(w, "no dispatches recorded for %s\n", repo)
+			return
+		}
+		printRecords(w, recs)
+	})
+}
+
+func printRecords(w io.Writer, recs []flow.DispatchRecord) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tWORKFLOW\tREF\tDISPATCHED\tRUN\tSTATE\tURL")
+	for _, rec := range recs {
+		run := "-"
+		if rec.RunID != 0 {
+			run = strconv.FormatInt(rec.RunID, 10)
+		}
+		id := rec.ID
+		if id == "" {
+			id = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			id, rec.Workflow, rec.Ref, rec.DispatchedAt.Local().Format(time.DateTime), run, runState(rec), rec.RunURL)
+	}
+	tw.Flush()
+}
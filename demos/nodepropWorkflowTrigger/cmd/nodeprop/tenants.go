@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/redislock"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/server"
+)
+
+// tenantName is the form tenant names take, since they appear in paths.
+var tenantName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// tenantConfig is one tenant in the --tenants file.
+type tenantConfig struct {
+	Name        string `yaml:"name"`
+	TokenSource string `yaml:"token_source"`
+	Registry    string `yaml:"registry"`
+	Routes      string `yaml:"routes"`
+	Signatures  string `yaml:"signatures"`
+	// Policy, if set, is a policy file the tenant's dispatches must pass
+	// as well as the profile's.
+	Policy string `yaml:"policy"`
+	// StateDir holds the tenant's history, dead letters, and approvals;
+	// it defaults to tenants/<name> in the user cache directory.
+	StateDir  string        `yaml:"state_dir"`
+	RateLimit *server.Limit `yaml:"rate_limit"`
+}
+
+// loadTenants reads a tenants file.
+//
+//	tenants:
+//	  - name: payments
+//	    token_source: env:PAYMENTS_GITHUB_TOKEN
+//	    registry: /etc/nodeprop/payments/registry.yml
+//	    routes: /etc/nodeprop/payments/routes.yml
+//	    rate_limit: {rate: 120/m, quota: 2000/d}
+func loadTenants(path string) ([]tenantConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f struct {
+		Tenants []tenantConfig `yaml:"tenants"`
+	}
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse tenants %s: %w", path, err)
+	}
+	seen := map[string]bool{}
+	for i, t := range f.Tenants {
+		switch {
+		case !tenantName.MatchString(t.Name):
+			return nil, fmt.Errorf("%s: tenant %d: name %q must be lower-case letters, digits, and dashes", path, i, t.Name)
+		case seen[t.Name]:
+			return nil, fmt.Errorf("%s: tenant %s is listed twice", path, t.Name)
+		case t.Registry == "":
+			return nil, fmt.Errorf("%s: tenant %s has no registry", path, t.Name)
+		}
+		// Tenants never fall back to the server's own token.
+		if _, err := flow.ParseTokenSource(t.TokenSource); err != nil || t.TokenSource == "" {
+			return nil, fmt.Errorf("%s: tenant %s: token_source must be a token source", path, t.Name)
+		}
+		seen[t.Name] = true
+	}
+	if len(f.Tenants) == 0 {
+		return nil, fmt.Errorf("%s: no tenants", path)
+	}
+	return f.Tenants, nil
+}
+
+// addTenants adds the tenants of path to s. Tenants inherit p's API
+// endpoint and retry settings, and lock under their own prefix in locker.
+func addTenants(ctx context.Context, p profile, s *server.Server, locker *redislock.Locker, path string, schedule bool) error {
+	tenants, err := loadTenants(path)
+	if err != nil {
+		return err
+	}
+	for _, cfg := range tenants {
+		tp := p
+		tp.TokenSource = cfg.TokenSource
+		dir := cfg.StateDir
+		if dir == "" {
+			dir = filepath.Join(stateDir(), "tenants", cfg.Name)
+		}
+		c, err := tp.correlatorIn(ctx, dir)
+		if err != nil {
+			return fmt.Errorf("tenant %s: %w", cfg.Name, err)
+		}
+		reg, err := flow.LoadRegistry(cfg.Registry)
+		if err != nil {
+			return fmt.Errorf("tenant %s: %w", cfg.Name, err)
+		}
+		if s.Auth == nil && len(reg.RoleBindings()) > 0 {
+			return fmt.Errorf("tenant %s: %s binds roles, which requires --auth", cfg.Name, cfg.Registry)
+		}
+		c.ApprovalPolicy = reg
+		c.Actor = ""
+		if cfg.Policy != "" {
+			policy, err := flow.LoadPolicy(cfg.Policy)
+			if err != nil {
+				return fmt.Errorf("tenant %s: %w", cfg.Name, err)
+			}
+			if c.Policy != nil {
+				c.Policy = flow.DispatchPolicies{c.Policy, policy}
+			} else {
+				c.Policy = policy
+			}
+		}
+		if s.Metrics != nil {
+			if err := instrument(c, s.Metrics); err != nil {
+				return fmt.Errorf("tenant %s: %w", cfg.Name, err)
+			}
+		}
+		if locker != nil {
+			c.Locker = &redislock.Locker{Client: locker.Client, Prefix: locker.Prefix + "tenant:" + cfg.Name + ":"}
+		}
+
+		t := s.AddTenant(cfg.Name, c, reg)
+		t.RegistryPath = cfg.Registry
+		t.TokenProvider = tokenFunc(tp.token)
+		if cfg.Routes != "" {
+			rules, err := flow.LoadRoutingRules(cfg.Routes)
+			if err != nil {
+				return fmt.Errorf("tenant %s: %w", cfg.Name, err)
+			}
+			t.Router = &flow.EventRouter{Rules: rules, Registry: reg}
+		}
+		if cfg.Signatures != "" {
+			if t.Signatures, err = server.LoadSignatureSources(ctx, cfg.Signatures); err != nil {
+				return fmt.Errorf("tenant %s: %w", cfg.Name, err)
+			}
+		}
+		if cfg.RateLimit != nil {
+			if s.RateLimiter == nil {
+				s.RateLimiter = server.NewRateLimiter(server.RateLimits{})
+			}
+			if err := s.RateLimiter.SetTenantLimit(cfg.Name, *cfg.RateLimit); err != nil {
+				return fmt.Errorf("tenant %s: rate_limit: %w", cfg.Name, err)
+			}
+		}
+		if schedule {
+			go runScheduler(ctx, c, cfg.Registry)
+		}
+		log.Printf("tenant %s: %d registered repositories", cfg.Name, len(reg.Repos()))
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestSetupTracing(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		exported bool
+	}{
+		{name: "no endpoint"},
+		{name: "endpoint", endpoint: "http://127.0.0.1:4318", exported: true},
+	}
+	oldProvider, oldPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	defer func() {
+		otel.SetTracerProvider(oldProvider)
+		otel.SetTextMapPropagator(oldPropagator)
+	}()
+	// The cases without an exporter come first, as the global provider
+	// is only ever replaced.
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", tt.endpoint)
+			t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+			shutdown, err := setupTracing(context.Background())
+			if err != nil {
+				t.Fatalf("setupTracing() error = %v", err)
+			}
+			if fields := otel.GetTextMapPropagator().Fields(); !slices.Contains(fields, "traceparent") || !slices.Contains(fields, "baggage") {
+				t.Errorf("propagator fields = %v, want W3C trace context and baggage", fields)
+			}
+			if _, sdk := otel.GetTracerProvider().(*sdktrace.TracerProvider); sdk != tt.exported {
+				t.Errorf("tracer provider %T, exporting: %v", otel.GetTracerProvider(), tt.exported)
+			}
+			// Nothing was traced, so nothing is sent.
+			if err := shutdown(context.Background()); err != nil {
+				t.Errorf("shutdown error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+func runTrigger(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("trigger", flag.ContinueOnError)
+	ref := fs.String("ref", "", "branch or tag to run the workflow on (default from profile, else main)")
+	inputs := inputFlags{}
+	fs.Var(inputs, "input", "workflow input as key=value (repeatable)")
+	batch := fs.String("batch", "", "dispatch every target listed in this manifest file")
+	concurrency := fs.Int("concurrency", 4, "maximum dispatches in flight with --batch or --org")
+	registryPath := fs.String("registry", flow.DefaultRegistryPath(), "registry file used to resolve selectors with --batch")
+	key := fs.String("idempotency-key", "", "skip the dispatch if one with this key was already accepted")
+	org := fs.String("org", "", "dispatch --workflow in every repository of this organization or user")
+	workflow := fs.String("workflow", "", "workflow file to dispatch with --org")
+	rateFloor := fs.Int("rate-floor", 100, "with --org, pause for the rate-limit reset when this few requests remain")
+	includeArchived := fs.Bool("include-archived", false, "with --org, include archived and disabled repositories")
+	format := outputFlag(fs)
+	profileName := profileFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+	p, err := loadProfile(*profileName)
+	if err != nil {
+		return err
+	}
+
+	if *org != "" {
+		if fs.NArg() != 0 || *workflow == "" || *batch != "" {
+			return errors.New("usage: nodeprop trigger --org <org> --workflow <workflow> [flags]")
+		}
+		t := orgTrigger{
+			org:             *org,
+			workflow:        *workflow,
+			ref:             p.ref(*ref),
+			inputs:          inputs,
+			concurrency:     *concurrency,
+			rateFloor:       *rateFloor,
+			includeArchived: *includeArchived,
+		}
+		return triggerOrg(ctx, p, t, *format)
+	}
+	if *batch != "" {
+		if fs.NArg() != 0 {
+			return errors.New("usage: nodeprop trigger --batch <targets.yml>")
+		}
+		return triggerBatch(ctx, p, *batch, *registryPath, *concurrency, *format)
+	}
+	if fs.NArg() != 2 {
+		return errors.New("usage: nodeprop trigger [flags] <owner/repo> <workflow>")
+	}
+
+	c, err := p.correlator(ctx)
+	if err != nil {
+		return err
+	}
+	rec, err := c.Submit(ctx, flow.DispatchRequest{Repo: p.repo(fs.Arg(0)), Workflow: fs.Arg(1), Ref: p.ref(*ref), Inputs: inputs, IdempotencyKey: *key})
+	if errors.Is(err, flow.ErrAlreadyDispatched) {
+		fmt.Fprintf(os.Stderr, "idempotency key %q already used by dispatch %s; not dispatching again\n", *key, rec.ID)
+	} else if err != nil {
+		return err
+	}
+	return render(os.Stdout, *format, newDispatchView(*rec), func(w io.Writer) {
+		fmt.Fprintf(w, "dispatched %s on %s to %s (id %s)\n", rec.Workflow, rec.Ref, rec.Repo, rec.ID)
+	})
+}
+
+// triggerBatch resolves a manifest and dispatches it concurrently.
+func triggerBatch(ctx context.Context, p profile, path, registryPath string, concurrency int, format string) error {
+	m, err := flow.LoadBatchManifest(path)
+	if err != nil {
+		return err
+	}
+	plan, err := resolvePlan(p, m, registryPath)
+	if err != nil {
+		return err
+	}
+	return dispatchPlan(ctx, p, plan, concurrency, format)
+}
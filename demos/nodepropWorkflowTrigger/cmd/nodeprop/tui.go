@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+func runTUI(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("tui", flag.ContinueOnError)
+	registryPath := fs.String("registry", flow.DefaultRegistryPath(), "registry file listing repositories")
+	ref := fs.String("ref", "", "ref used when triggering from the dashboard (default from profile, else main)")
+	limit := fs.Int("n", 30, "number of recent dispatches to show")
+	profileName := profileFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("usage: nodeprop tui [flags]")
+	}
+
+	reg, err := flow.LoadRegistry(*registryPath)
+	if err != nil {
+		return err
+	}
+	p, err := loadProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	c, err := p.correlator(ctx)
+	if err != nil {
+		return err
+	}
+	c.Events = flow.NewEventBus()
+	events, unsubscribe := c.Events.Subscribe(64)
+	defer unsubscribe()
+
+	m := &tuiModel{ctx: ctx, c: c, events: events, ref: p.ref(*ref), limit: *limit}
+	for _, e := range reg.Repos() {
+		for _, wf := range e.Workflows {
+			m.targets = append(m.targets, tuiTarget{repo: e.Name, workflow: wf})
+		}
+	}
+
+	_, err = tea.NewProgram(m, tea.WithContext(ctx), tea.WithAltScreen()).Run()
+	if errors.Is(err, tea.ErrProgramKilled) && ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+const (
+	paneRepos = iota
+	paneDispatches
+)
+
+// tuiRefreshInterval is how often non-finished dispatches are re-resolved.
+const tuiRefreshInterval = 5 * time.Second
+
+type tuiTarget struct {
+	repo, workflow string
+}
+
+type (
+	eventMsg   flow.Event
+	recordsMsg []flow.DispatchRecord
+	tickMsg    struct{}
+	statusMsg  string
+)
+
+type tuiModel struct {
+	ctx    context.Context
+	c      *flow.RunCorrelator
+	events <-chan flow.Event
+	ref    string
+	limit  int
+
+	targets []tuiTarget
+	records []flow.DispatchRecord
+	pane    int
+	cursor  [2]int
+	status  string
+}
+
+func (m *tuiModel) Init() tea.Cmd {
+	return tea.Batch(m.waitEvent(), m.refresh(), tick())
+}
+
+func (m *tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "ctrl+c":
+			return m, tea.Quit
+		case "tab":
+			m.pane = (m.pane + 1) % 2
+		case "up", "k":
+			if m.cursor[m.pane] > 0 {
+				m.cursor[m.pane]--
+			}
+		case "down", "j":
+			if m.cursor[m.pane] < m.paneLen(m.pane)-1 {
+				m.cursor[m.pane]++
+			}
+		case "t":
+			if m.pane == paneRepos && len(m.targets) > 0 {
+				return m, m.trigger(m.targets[m.cursor[paneRepos]])
+			}
+		case "c":
+			if m.pane == paneDispatches && len(m.records) > 0 {
+				return m, m.cancel(m.records[m.cursor[paneDispatches]])
+			}
+		case "r":
+			return m, m.refresh()
+		}
+	case eventMsg:
+		m.status = formatEvent(flow.Event(msg))
+		return m, tea.Batch(m.waitEvent(), m.refresh())
+	case recordsMsg:
+		m.records = msg
+		if m.cursor[paneDispatches] >= len(m.records) {
+			m.cursor[paneDispatches] = max(len(m.records)-1, 0)
+		}
+	case statusMsg:
+		m.status = string(msg)
+	case tickMsg:
+		return m, tea.Batch(m.refresh(), tick())
+	}
+	return m, nil
+}
+
+func (m *tuiModel) View() string {
+	var b strings.Builder
+	b.WriteString("NodeProp dispatcher\n\n")
+
+	b.WriteString(paneTitle("Repositories", m.pane == paneRepos))
+	if len(m.targets) == 0 {
+		b.WriteString("  (no repositories registered)\n")
+	}
+	for i, t := range m.targets {
+		b.WriteString(cursorMark(m.pane == paneRepos && i == m.cursor[paneRepos]))
+		fmt.Fprintf(&b, "%-40s %s\n", t.repo, t.workflow)
+	}
+
+	b.WriteString("\n")
+	b.WriteString(paneTitle("Dispatches", m.pane == paneDispatches))
+	if len(m.records) == 0 {
+		b.WriteString("  (no dispatches recorded)\n")
+	}
+	for i, rec := range m.records {
+		b.WriteString(cursorMark(m.pane == paneDispatches && i == m.cursor[paneDispatches]))
+		fmt.Fprintf(&b, "%-9s %-30s %-24s %-16s %s\n",
+			dispatchPhase(rec), rec.Repo, rec.Workflow, runState(rec), rec.DispatchedAt.Local().Format(time.TimeOnly))
+	}
+
+	b.WriteString("\n" + m.status + "\n")
+	b.WriteString("tab switch pane · ↑/↓ move · t trigger · c cancel · r refresh · q quit\n")
+	return b.String()
+}
+
+func (m *tuiModel) paneLen(pane int) int {
+	if pane == paneRepos {
+		return len(m.targets)
+	}
+	return len(m.records)
+}
+
+// waitEvent delivers the next bus event to Update.
+func (m *tuiModel) waitEvent() tea.Cmd {
+	return func() tea.Msg {
+		e, ok := <-m.events
+		if !ok {
+			return nil
+		}
+		return eventMsg(e)
+	}
+}
+
+// refresh re-resolves recent dispatches in the background.
+func (m *tuiModel) refresh() tea.Cmd {
+	return func() tea.Msg {
+		recs, err := resolveRecent(m.ctx, m.c, "", m.limit)
+		if err != nil {
+			return statusMsg("refresh failed: " + err.Error())
+		}
+		return recordsMsg(recs)
+	}
+}
+
+func (m *tuiModel) trigger(t tuiTarget) tea.Cmd {
+	return func() tea.Msg {
+		if _, err := m.c.Dispatch(m.ctx, t.repo, t.workflow, m.ref, nil); err != nil {
+			return statusMsg(fmt.Sprintf("trigger %s %s failed: %v", t.repo, t.workflow, err))
+		}
+		return nil
+	}
+}
+
+func (m *tuiModel) cancel(rec flow.DispatchRecord) tea.Cmd {
+	return func() tea.Msg {
+		if err := m.c.Cancel(m.ctx, rec); err != nil {
+			return statusMsg(fmt.Sprintf("cancel %s failed: %v", rec.ID, err))
+		}
+		return nil
+	}
+}
+
+func tick() tea.Cmd {
+	return tea.Tick(tuiRefreshInterval, func(time.Time) tea.Msg { return tickMsg{} })
+}
+
+func formatEvent(e flow.Event) string {
+	s := fmt.Sprintf("%s %s: %s %s", e.Time.Local().Format(time.TimeOnly), e.Type, e.Repo, e.Workflow)
+	if e.Status != "" {
+		s += " (" + e.Status + ")"
+	}
+	if e.Error != "" {
+		s += ": " + e.Error
+	}
+	return s
+}
+
+func paneTitle(title string, active bool) string {
+	if active {
+		return "[" + title + "]\n"
+	}
+	return " " + title + "\n"
+}
+
+func cursorMark(selected bool) string {
+	if selected {
+		return "> "
+	}
+	return "  "
+}
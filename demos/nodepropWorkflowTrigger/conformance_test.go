@@ -0,0 +1,28 @@
+package flow_test
+
+import (
+	"testing"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/providertest"
+)
+
+func TestConformance(t *testing.T) {
+	tests := []struct {
+		name        string
+		newProvider providertest.NewProvider
+	}{
+		{name: "GitHubWorkflowDispatch", newProvider: func(t *testing.T, endpoint string) flow.Trigger {
+			return flow.NewGitHubWorkflowDispatch("conformance.yml", flow.WithBaseURL(endpoint), flow.WithRef("main"))
+		}},
+		{name: "GitHubRepoDispatch", newProvider: func(t *testing.T, endpoint string) flow.Trigger {
+			return flow.NewGitHubRepoDispatch("conformance", flow.WithBaseURL(endpoint))
+		}},
+		{name: "WebhookTrigger", newProvider: func(t *testing.T, endpoint string) flow.Trigger {
+			return flow.NewWebhookTrigger(endpoint)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) { providertest.Run(t, tt.newProvider) })
+	}
+}
@@ -0,0 +1,460 @@
+package flow
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CorrelationInput is the workflow input carrying the dispatch ID. The GitHub
+// dispatch API does not return the run it creates, so target workflows must
+// declare this input and include it in their run-name, e.g.
+//
+//	run-name: Deploy ${{ inputs.nodeprop_id }}
+const CorrelationInput = "nodeprop_id"
+
+// correlationSkew widens the run search window to tolerate clock drift.
+const correlationSkew = time.Minute
+
+// keyLockTTL bounds how long a crashed replica can hold an idempotency key.
+// It must outlast a dispatch with all its retries.
+const keyLockTTL = 2 * time.Minute
+
+// RunCorrelator dispatches workflows and matches them to the runs they spawn.
+type RunCorrelator struct {
+	Client  *GitHubClient
+	History HistoryStore
+	// Events, if set, receives lifecycle events for dispatches and runs.
+	Events *EventBus
+	// Retry is applied to dispatches that fail with transient errors.
+	Retry RetryPolicy
+	// DeadLetters, if set, keeps dispatches still rejected after retrying.
+	DeadLetters DeadLetterStore
+	// Locker, if set, serialises dispatches with the same idempotency key
+	// across replicas. The replicas must share History as well, so that
+	// each sees the others' dispatches.
+	Locker Locker
+	// Policy, if set, refuses dispatches before anything else is done with
+	// them. Requests without RequestedBy are checked as from Actor.
+	Policy DispatchPolicy
+	// Approvals, if set with ApprovalPolicy, holds the dispatches the
+	// policy requires approval for until Approve is called.
+	Approvals      ApprovalStore
+	ApprovalPolicy ApprovalPolicy
+	// ApprovalTTL overrides DefaultApprovalTTL.
+	ApprovalTTL time.Duration
+	// Logger receives dispatch outcomes and retries; nil means
+	// slog.Default().
+	Logger Logger
+	// Metrics, if set, counts attempts, retries, and failures.
+	Metrics *Metrics
+	// Audit, if set, receives an entry for every submitted dispatch,
+	// including those held, rejected, or repeated.
+	Audit AuditSink
+	// CorrelationIDInput, if set, names a workflow input the correlation
+	// ID is sent in as well. GitHub refuses inputs a workflow does not
+	// declare, so every dispatched workflow must declare it.
+	CorrelationIDInput string
+	// SecretInputs names inputs whose values are secrets. They are sent
+	// but recorded and returned as Redacted, and redacted wherever else
+	// they appear. Dead letters and held approvals keep them, to send again.
+	SecretInputs []string
+	// Actor is audited for requests without RequestedBy, e.g. the local
+	// user of a command.
+	Actor string
+	// TracerProvider provides the spans of submissions, their attempts,
+	// and run resolution; nil means the global provider.
+	TracerProvider trace.TracerProvider
+	// Clock, if set, replaces the system clock for retry delays, approval
+	// expiry, and the times recorded on dispatches, approvals, dead
+	// letters, and audit entries.
+	Clock Clock
+	// Metadata, if set, checks before a dispatch that its workflow exists
+	// and is active, and fills in the repository's default branch for
+	// requests without Ref.
+	Metadata *MetadataCache
+
+	keyMu      sync.Mutex
+	inflight   map[string]bool
+	approvalMu sync.Mutex
+}
+
+// NewRunCorrelator creates a RunCorrelator.
+func NewRunCorrelator(client *GitHubClient, history HistoryStore) *RunCorrelator {
+	return &RunCorrelator{Client: client, History: history}
+}
+
+// ErrAlreadyDispatched is returned by Submit when a dispatch with the same
+// idempotency key was already made. The existing record is returned with it.
+var ErrAlreadyDispatched = errors.New("already dispatched with this idempotency key")
+
+// DispatchRequest describes a dispatch for Submit.
+type DispatchRequest struct {
+	Repo     string
+	Workflow string
+	Ref      string
+	Inputs   map[string]string
+	// IdempotencyKey, if set, makes Submit a no-op when a dispatch with the
+	// same key was already accepted. Rejected dispatches do not count.
+	IdempotencyKey string
+	// ReplayOf is recorded to link a replay to the dispatch it re-executes.
+	ReplayOf string
+	// Schedule and ScheduledFor are recorded for dispatches made by a
+	// Scheduler: the schedule's name and the time the firing was due.
+	Schedule     string
+	ScheduledFor time.Time
+	// RequestedBy identifies who asked for the dispatch, e.g. key:ci or
+	// slack:U123. It is recorded on approvals.
+	RequestedBy string
+	// Approval is the approval that allowed the dispatch. It is set by
+	// Approve and exempts the request from the approval policy.
+	Approval string
+	// CorrelationID names the operation the dispatch belongs to. If empty,
+	// the context's correlation ID is used, or failing that a new one.
+	CorrelationID string
+}
+
+// Dispatch triggers workflowFile in repo with a fresh correlation ID and
+// records the dispatch in the history store.
+func (c *RunCorrelator) Dispatch(ctx context.Context, repo, workflowFile, ref string, inputs map[string]string) (*DispatchRecord, error) {
+	return c.Submit(ctx, DispatchRequest{Repo: repo, Workflow: workflowFile, Ref: ref, Inputs: inputs})
+}
+
+// Submit performs a dispatch described by req, retrying transient failures
+// as c.Retry allows. Rejected dispatches are recorded with
+// ConclusionDispatchFailed so they can be replayed, and added to
+// c.DeadLetters if set. A dispatch that needs approval is not sent; an
+// *ApprovalRequiredError carrying the pending approval is returned.
+func (c *RunCorrelator) Submit(ctx context.Context, req DispatchRequest) (*DispatchRecord, error) {
+	rec, _, err := c.submit(ctx, req, true)
+	return rec, err
+}
+
+// submit is Submit, optionally without dead-lettering a rejection. It also
+// returns the number of dispatch attempts made.
+func (c *RunCorrelator) submit(ctx context.Context, req DispatchRequest, deadLetter bool) (out *DispatchRecord, attempts int, err error) {
+	if ctx, err = correlate(ctx, &req); err != nil {
+		return nil, 0, err
+	}
+	if ctx, err = c.withSecretInputs(ctx, req); err != nil {
+		return nil, 0, err
+	}
+	if err = ValidateInputs(req.Inputs); err != nil {
+		return nil, 0, err
+	}
+	ctx, span := startSpan(ctx, c.TracerProvider, "nodeprop.submit", req)
+	var id string
+	defer func() {
+		if out != nil {
+			id = out.ID
+		}
+		err = redactError(ctx, err)
+		c.audit(ctx, req, id, attempts, err)
+		span.SetAttributes(attribute.String("nodeprop.dispatch_id", id), attribute.Int("nodeprop.attempts", attempts))
+		endSpan(span, err)
+	}()
+
+	if err = c.checkPolicy(ctx, req); err != nil {
+		return nil, 0, err
+	}
+	if req.IdempotencyKey != "" {
+		// Time spent waiting for another dispatch with the same key.
+		_, wait := startSpan(ctx, c.TracerProvider, "nodeprop.queue_wait", req)
+		if c.Locker != nil {
+			lock, err := c.Locker.Acquire(ctx, "idempotency:"+req.IdempotencyKey, keyLockTTL)
+			if errors.Is(err, ErrLockHeld) {
+				err = fmt.Errorf("dispatch with idempotency key %q is in progress", req.IdempotencyKey)
+			} else if err != nil {
+				err = fmt.Errorf("failed to lock idempotency key: %w", err)
+			}
+			if err != nil {
+				endSpan(wait, err)
+				return nil, 0, err
+			}
+			defer lock.Release(context.Background())
+		}
+		prev, err := c.reserveKey(req.Repo, req.IdempotencyKey)
+		endSpan(wait, err)
+		if prev != nil || err != nil {
+			return prev, 0, err
+		}
+		defer c.releaseKey(req.IdempotencyKey)
+	}
+	pctx, preflight := startSpan(ctx, c.TracerProvider, "nodeprop.preflight", req)
+	err = c.checkMetadata(pctx, &req)
+	if err == nil {
+		err = c.holdForApproval(req)
+	}
+	endSpan(preflight, err)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if id, err = newDispatchID(); err != nil {
+		return nil, 0, err
+	}
+	params := make(map[string]string, len(req.Inputs)+2)
+	for k, v := range req.Inputs {
+		params[k] = v
+	}
+	params[CorrelationInput] = id
+	if c.CorrelationIDInput != "" {
+		params[c.CorrelationIDInput] = req.CorrelationID
+	}
+
+	rec := DispatchRecord{
+		ID:             id,
+		Repo:           req.Repo,
+		Workflow:       req.Workflow,
+		Ref:            req.Ref,
+		Inputs:         c.RedactInputs(req.Inputs),
+		DispatchedAt:   ClockOr(c.Clock).Now().UTC(),
+		IdempotencyKey: req.IdempotencyKey,
+		ReplayOf:       req.ReplayOf,
+		Schedule:       req.Schedule,
+		ScheduledFor:   req.ScheduledFor,
+		Approval:       req.Approval,
+		CorrelationID:  req.CorrelationID,
+	}
+	c.Events.Publish(Event{Type: EventQueued, DispatchID: id, CorrelationID: req.CorrelationID, Repo: req.Repo, Workflow: req.Workflow})
+	attempts, err = c.dispatch(ctx, req, params)
+	if err != nil {
+		rec.Status, rec.Conclusion, rec.Error, rec.UpdatedAt = "completed", ConclusionDispatchFailed, err.Error(), ClockOr(c.Clock).Now().UTC()
+		c.Metrics.failed(err)
+		LoggerOr(c.Logger).Error("dispatch failed", "dispatch_id", id, "correlation_id", req.CorrelationID, "repo", req.Repo, "workflow", req.Workflow, "attempt", attempts, "status", statusOf(err), "class", ErrorClass(err), "error", err)
+		c.Events.Publish(Event{Type: EventFailed, DispatchID: id, CorrelationID: req.CorrelationID, Repo: req.Repo, Workflow: req.Workflow, Error: err.Error()})
+		if herr := c.History.Append(rec); herr != nil {
+			return nil, attempts, fmt.Errorf("%w (and failed to record it: %w)", err, herr)
+		}
+		if deadLetter && c.DeadLetters != nil {
+			d := DeadLetter{
+				ID:       id,
+				Repo:     req.Repo,
+				Workflow: req.Workflow,
+				Ref:      req.Ref,
+				Inputs:   req.Inputs,
+				Attempts: attempts,
+				Error:    err.Error(),
+				FailedAt: rec.UpdatedAt,
+			}
+			if derr := c.DeadLetters.Add(d); derr != nil {
+				return nil, attempts, fmt.Errorf("%w (and failed to dead-letter it: %w)", err, derr)
+			}
+		}
+		return nil, attempts, err
+	}
+	if err := c.History.Append(rec); err != nil {
+		return nil, attempts, fmt.Errorf("dispatched but failed to record %s: %w", id, err)
+	}
+	LoggerOr(c.Logger).Info("dispatched", "dispatch_id", id, "correlation_id", req.CorrelationID, "repo", req.Repo, "workflow", req.Workflow, "ref", req.Ref, "attempt", attempts)
+	c.Events.Publish(Event{Type: EventDispatched, DispatchID: id, CorrelationID: req.CorrelationID, Repo: req.Repo, Workflow: req.Workflow})
+	return &rec, attempts, nil
+}
+
+// checkPolicy applies c.Policy to req.
+func (c *RunCorrelator) checkPolicy(ctx context.Context, req DispatchRequest) error {
+	if c.Policy == nil {
+		return nil
+	}
+	if req.RequestedBy == "" {
+		req.RequestedBy = c.Actor
+	}
+	err := redactError(ctx, c.Policy.Check(ctx, req))
+	if err != nil {
+		LoggerOr(c.Logger).Warn("dispatch denied by policy", "correlation_id", req.CorrelationID, "repo", req.Repo, "workflow", req.Workflow, "ref", req.Ref, "requested_by", req.RequestedBy, "error", err)
+	}
+	return err
+}
+
+// dispatch sends the dispatch, retrying failures while their class has
+// budget left. It returns the number of attempts made and the last error.
+func (c *RunCorrelator) dispatch(ctx context.Context, req DispatchRequest, params map[string]string) (int, error) {
+	failures := map[string]int{}
+	for attempt := 1; ; attempt++ {
+		actx, span := startSpan(ctx, c.TracerProvider, "nodeprop.dispatch", req, attribute.Int("nodeprop.attempt", attempt))
+		start := time.Now()
+		err := dispatchError(ProviderGitHubWorkflow, req.Repo, req.Workflow, redactError(actx, c.Client.DispatchWorkflow(actx, req.Repo, req.Workflow, req.Ref, params)))
+		c.Metrics.attempt(time.Since(start), err)
+		endSpan(span, err)
+		if err == nil || attempt >= c.Retry.MaxAttempts {
+			return attempt, err
+		}
+		class := ErrorClass(err)
+		failures[class]++
+		if class == ErrorCancelled || failures[class] >= c.Retry.Budget(class) {
+			return attempt, err
+		}
+		delay := c.Retry.delay(attempt + 1)
+		c.Metrics.retry()
+		trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(
+			attribute.Int("nodeprop.attempt", attempt+1),
+			attribute.String("nodeprop.delay", delay.String()),
+		))
+		LoggerOr(c.Logger).Warn("retrying dispatch", "correlation_id", req.CorrelationID, "repo", req.Repo, "workflow", req.Workflow, "attempt", attempt, "status", statusOf(err), "class", class, "error", err, "delay", delay)
+		select {
+		case <-ctx.Done():
+			return attempt, err
+		case <-ClockOr(c.Clock).After(delay):
+		}
+	}
+}
+
+// statusOf returns the HTTP status of an API error, or 0.
+func statusOf(err error) int {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// reserveKey marks key as in flight. It returns the earlier record if the
+// key was already used by an accepted dispatch.
+func (c *RunCorrelator) reserveKey(repo, key string) (*DispatchRecord, error) {
+	c.keyMu.Lock()
+	defer c.keyMu.Unlock()
+	if c.inflight[key] {
+		return nil, fmt.Errorf("dispatch with idempotency key %q is in progress", key)
+	}
+	prev, err := c.History.List(repo)
+	if err != nil {
+		return nil, err
+	}
+	for i := range prev {
+		if prev[i].IdempotencyKey == key && prev[i].Conclusion != ConclusionDispatchFailed {
+			return &prev[i], ErrAlreadyDispatched
+		}
+	}
+	if c.inflight == nil {
+		c.inflight = make(map[string]bool)
+	}
+	c.inflight[key] = true
+	return nil, nil
+}
+
+func (c *RunCorrelator) releaseKey(key string) {
+	c.keyMu.Lock()
+	delete(c.inflight, key)
+	c.keyMu.Unlock()
+}
+
+// Resolve locates the run for rec if not yet known, refreshes its status, and
+// persists the result. It returns the updated record.
+func (c *RunCorrelator) Resolve(ctx context.Context, rec DispatchRecord) (DispatchRecord, error) {
+	if rec.Completed() {
+		return rec, nil
+	}
+	ctx, span := tracer(c.TracerProvider).Start(ctx, "nodeprop.resolve", trace.WithAttributes(
+		attribute.String("nodeprop.repo", rec.Repo),
+		attribute.String("nodeprop.workflow", rec.Workflow),
+		attribute.String("nodeprop.dispatch_id", rec.ID),
+	))
+	out, err := c.resolve(ctx, rec)
+	span.SetAttributes(attribute.Int64("nodeprop.run_id", out.RunID), attribute.String("nodeprop.status", out.Status))
+	endSpan(span, err)
+	return out, err
+}
+
+func (c *RunCorrelator) resolve(ctx context.Context, rec DispatchRecord) (DispatchRecord, error) {
+	var run *WorkflowRun
+	if rec.RunID == 0 {
+		runs, err := c.Client.ListWorkflowRuns(ctx, rec.Repo, rec.Workflow, rec.DispatchedAt.Add(-correlationSkew))
+		if err != nil {
+			return rec, err
+		}
+		for i := range runs {
+			if strings.Contains(runs[i].DisplayTitle, rec.ID) || strings.Contains(runs[i].Name, rec.ID) {
+				run = &runs[i]
+				break
+			}
+		}
+		if run == nil {
+			return rec, nil
+		}
+	} else {
+		var err error
+		if run, err = c.Client.GetWorkflowRun(ctx, rec.Repo, rec.RunID); err != nil {
+			return rec, err
+		}
+	}
+
+	started := rec.RunID == 0
+	changed := rec.RunID != run.ID || rec.Status != run.Status
+	rec.RunID = run.ID
+	rec.RunURL = run.HTMLURL
+	rec.RunStartedAt = run.RunStartedAt
+	if rec.RunStartedAt.IsZero() {
+		rec.RunStartedAt = run.CreatedAt
+	}
+	rec.Status = run.Status
+	rec.Conclusion = run.Conclusion
+	rec.UpdatedAt = run.UpdatedAt
+	if err := c.History.Update(rec); err != nil {
+		return rec, err
+	}
+	if changed {
+		e := Event{Type: EventRunUpdated, DispatchID: rec.ID, CorrelationID: rec.CorrelationID, Repo: rec.Repo, Workflow: rec.Workflow, RunID: rec.RunID, RunURL: rec.RunURL, Status: rec.Status}
+		switch {
+		case rec.Completed():
+			e.Type, e.Status = EventRunCompleted, rec.Conclusion
+		case started:
+			e.Type = EventRunStarted
+		}
+		c.Events.Publish(e)
+	}
+	return rec, nil
+}
+
+// Cancel requests cancellation of the run spawned by rec.
+func (c *RunCorrelator) Cancel(ctx context.Context, rec DispatchRecord) error {
+	if rec.RunID == 0 {
+		return fmt.Errorf("dispatch %s has no run yet", rec.ID)
+	}
+	if err := c.Client.CancelWorkflowRun(ctx, rec.Repo, rec.RunID); err != nil {
+		return err
+	}
+	c.Events.Publish(Event{Type: EventCancelled, DispatchID: rec.ID, CorrelationID: rec.CorrelationID, Repo: rec.Repo, Workflow: rec.Workflow, RunID: rec.RunID})
+	return nil
+}
+
+// Recent returns up to limit of the newest dispatch records for repo.
+func (c *RunCorrelator) Recent(repo string, limit int) ([]DispatchRecord, error) {
+	return QueryHistory(c.History, HistoryQuery{Repo: repo, Limit: limit})
+}
+
+// newDispatchID returns a random identifier for correlating a dispatch.
+func newDispatchID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate dispatch id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// checkMetadata checks req against c.Metadata, if set.
+func (c *RunCorrelator) checkMetadata(ctx context.Context, req *DispatchRequest) error {
+	if c.Metadata == nil {
+		return nil
+	}
+	wf, err := c.Metadata.Workflow(ctx, req.Repo, req.Workflow)
+	if err != nil {
+		return fmt.Errorf("failed to look up workflow %s of %s: %w", req.Workflow, req.Repo, err)
+	}
+	if wf.State != "active" {
+		return fmt.Errorf("workflow %s of %s is %s", req.Workflow, req.Repo, wf.State)
+	}
+	if req.Ref == "" {
+		if req.Ref, err = c.Metadata.DefaultBranch(ctx, req.Repo); err != nil {
+			return fmt.Errorf("failed to look up default branch of %s: %w", req.Repo, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package flow_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+func newCorrelator(t *testing.T, gh *nodeproptest.Server) *flow.RunCorrelator {
+	t.Helper()
+	c := flow.NewRunCorrelator(gh.Client(), flow.NewFileHistoryStore(filepath.Join(t.TempDir(), "history.json")))
+	c.Logger = discardLogger
+	return c
+}
+
+// discardLogger keeps expected failures out of test output.
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestSubmitAndResolve(t *testing.T) {
+	gh := nodeproptest.NewServer()
+	defer gh.Close()
+	gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+	gh.SetOutcome("Cdaprod/site", "deploy.yml", nodeproptest.Outcome{Duration: time.Hour})
+	c := newCorrelator(t, gh)
+	ctx := context.Background()
+
+	rec, err := c.Submit(ctx, flow.DispatchRequest{Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "main", Inputs: map[string]string{"env": "prod"}})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if rec.ID == "" || rec.CorrelationID == "" || rec.Completed() {
+		t.Errorf("Submit() = %+v, want a pending record with IDs", rec)
+	}
+	ds := gh.Dispatches()
+	if len(ds) != 1 || ds[0].Inputs[flow.CorrelationInput] != rec.ID || ds[0].Inputs["env"] != "prod" || ds[0].Ref != "main" {
+		t.Fatalf("dispatches = %+v, want one carrying the dispatch ID", ds)
+	}
+
+	got, err := c.Resolve(ctx, *rec)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if got.RunID != ds[0].RunID || got.RunURL == "" || got.Completed() {
+		t.Errorf("Resolve() = %+v, want run %d", got, ds[0].RunID)
+	}
+	if err := gh.Complete(got.RunID, "failure"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = c.Resolve(ctx, got); err != nil || !got.Completed() || !got.Failed() {
+		t.Errorf("Resolve() after completion = %+v, %v; want a failed run", got, err)
+	}
+	recent, err := c.Recent("Cdaprod/site", 10)
+	if err != nil || len(recent) != 1 || recent[0].Conclusion != "failure" {
+		t.Errorf("Recent() = %+v, %v; want the updated record", recent, err)
+	}
+}
+
+func TestSubmitErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		fault    *nodeproptest.Fault
+		retry    flow.RetryPolicy
+		class    string
+		attempts int
+	}{
+		{name: "not found", fault: &nodeproptest.Fault{Status: 404}, class: flow.ErrorNotFound, attempts: 1},
+		{name: "invalid", fault: &nodeproptest.Fault{Status: 422, Body: `{"message": "Unexpected inputs provided"}`}, class: flow.ErrorInvalid, attempts: 1},
+		{name: "server error retried", fault: &nodeproptest.Fault{Status: 502, Times: 2}, retry: flow.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}, attempts: 3},
+		{name: "server error out of budget", fault: &nodeproptest.Fault{Status: 502}, retry: flow.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}, class: flow.ErrorServer, attempts: 3},
+		{name: "invalid not retried", fault: &nodeproptest.Fault{Status: 422}, retry: flow.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}, class: flow.ErrorInvalid, attempts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := nodeproptest.NewServer()
+			defer gh.Close()
+			gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+			f := *tt.fault
+			f.Path = "/repos/*/*/actions/workflows/*/dispatches"
+			gh.Inject(f)
+			c := newCorrelator(t, gh)
+			c.Retry = tt.retry
+
+			_, err := c.Submit(context.Background(), flow.DispatchRequest{Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "main"})
+			if tt.class == "" {
+				if err != nil {
+					t.Fatalf("Submit() error = %v", err)
+				}
+			} else if got := flow.ErrorClass(err); got != tt.class {
+				t.Errorf("ErrorClass(%v) = %s, want %s", err, got, tt.class)
+			}
+			var sent int
+			for _, r := range gh.Requests() {
+				if r.Method == "POST" {
+					sent++
+				}
+			}
+			if sent != tt.attempts {
+				t.Errorf("sent %d dispatches, want %d", sent, tt.attempts)
+			}
+			if tt.class != "" {
+				recs, _ := c.History.List("Cdaprod/site")
+				if len(recs) != 1 || recs[0].Conclusion != flow.ConclusionDispatchFailed {
+					t.Errorf("history = %+v, want the rejection recorded", recs)
+				}
+			}
+		})
+	}
+}
+
+func TestSubmitIdempotencyKey(t *testing.T) {
+	gh := nodeproptest.NewServer()
+	defer gh.Close()
+	gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+	c := newCorrelator(t, gh)
+	req := flow.DispatchRequest{Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "main", IdempotencyKey: "delivery-1"}
+
+	first, err := c.Submit(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := c.Submit(context.Background(), req)
+	if !errors.Is(err, flow.ErrAlreadyDispatched) || again == nil || again.ID != first.ID {
+		t.Errorf("second Submit() = %+v, %v; want the first record and ErrAlreadyDispatched", again, err)
+	}
+	if n := len(gh.Dispatches()); n != 1 {
+		t.Errorf("%d dispatches sent, want 1", n)
+	}
+}
@@ -0,0 +1,69 @@
+package flow
+
+import "context"
+
+// CorrelationHeader is the HTTP header, and in lower case the gRPC
+// metadata key, that carries a correlation ID between systems.
+const CorrelationHeader = "X-Correlation-ID"
+
+// maxCorrelationID bounds the length of an accepted correlation ID.
+const maxCorrelationID = 128
+
+type correlationKey struct{}
+
+// WithCorrelationID returns a copy of ctx carrying the correlation ID id,
+// which names one logical operation, such as a rollout fanning out to many
+// repositories, across every dispatch it makes; each dispatch still has its
+// own dispatch ID. Dispatches submitted with the context are recorded,
+// logged, audited, and published under it.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// CorrelationID returns the correlation ID carried by ctx, or "".
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
+
+// NewCorrelationID returns a random correlation ID.
+func NewCorrelationID() (string, error) {
+	return newDispatchID()
+}
+
+// ValidCorrelationID reports whether id may be accepted from another
+// system: 1 to 128 letters, digits, and the characters . _ : / -, so that
+// it is safe to log and to pass on in headers and workflow inputs.
+func ValidCorrelationID(id string) bool {
+	if id == "" || len(id) > maxCorrelationID {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '.', r == '_', r == ':', r == '/', r == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// correlate fills in req's correlation ID from ctx, or with a new one, and
+// returns ctx carrying it.
+func correlate(ctx context.Context, req *DispatchRequest) (context.Context, error) {
+	if req.CorrelationID == "" {
+		req.CorrelationID = CorrelationID(ctx)
+	}
+	if req.CorrelationID == "" {
+		id, err := NewCorrelationID()
+		if err != nil {
+			return ctx, err
+		}
+		req.CorrelationID = id
+	}
+	if CorrelationID(ctx) == req.CorrelationID {
+		return ctx, nil
+	}
+	return WithCorrelationID(ctx, req.CorrelationID), nil
+}
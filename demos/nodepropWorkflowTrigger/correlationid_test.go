@@ -0,0 +1,104 @@
+package flow_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+func TestValidCorrelationID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{id: ""},
+		{id: "rollout-42", want: true},
+		{id: "ci:Cdaprod/site/run.7_a", want: true},
+		{id: strings.Repeat("a", 128), want: true},
+		{id: strings.Repeat("a", 129)},
+		{id: "with space"},
+		{id: "line\nbreak"},
+		{id: "quote\""},
+		{id: "héllo"},
+	}
+	for _, tt := range tests {
+		if got := flow.ValidCorrelationID(tt.id); got != tt.want {
+			t.Errorf("ValidCorrelationID(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestNewCorrelationID(t *testing.T) {
+	a, err := flow.NewCorrelationID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := flow.NewCorrelationID()
+	if !flow.ValidCorrelationID(a) || a == b {
+		t.Errorf("NewCorrelationID() = %q, %q; want distinct valid IDs", a, b)
+	}
+}
+
+func TestSubmitCorrelationID(t *testing.T) {
+	tests := []struct {
+		name   string
+		ctxID  string
+		reqID  string
+		input  string
+		wantID string
+	}{
+		{name: "generated"},
+		{name: "from context", ctxID: "rollout-1", wantID: "rollout-1"},
+		{name: "request wins", ctxID: "rollout-1", reqID: "req-2", wantID: "req-2"},
+		{name: "passed as input", ctxID: "rollout-1", input: "correlation_id", wantID: "rollout-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := nodeproptest.NewServer()
+			defer gh.Close()
+			gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+			c := newCorrelator(t, gh)
+			c.CorrelationIDInput = tt.input
+			c.Events = flow.NewEventBus()
+			events, cancel := c.Events.Subscribe(8)
+			defer cancel()
+
+			ctx := context.Background()
+			if tt.ctxID != "" {
+				ctx = flow.WithCorrelationID(ctx, tt.ctxID)
+			}
+			rec, err := c.Submit(ctx, flow.DispatchRequest{Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "main", CorrelationID: tt.reqID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantID != "" && rec.CorrelationID != tt.wantID {
+				t.Errorf("CorrelationID = %q, want %q", rec.CorrelationID, tt.wantID)
+			}
+			if !flow.ValidCorrelationID(rec.CorrelationID) || rec.CorrelationID == rec.ID {
+				t.Errorf("CorrelationID = %q, want a valid ID distinct from the dispatch ID %q", rec.CorrelationID, rec.ID)
+			}
+			ds := gh.Dispatches()
+			if len(ds) != 1 {
+				t.Fatalf("dispatches = %+v, want one", ds)
+			}
+			if got, ok := ds[0].Inputs[tt.input]; tt.input != "" && got != rec.CorrelationID || tt.input == "" && ok {
+				t.Errorf("inputs = %v, want the correlation ID only under %q", ds[0].Inputs, tt.input)
+			}
+			recs, err := flow.QueryHistory(c.History, flow.HistoryQuery{CorrelationID: rec.CorrelationID})
+			if err != nil || len(recs) != 1 || recs[0].ID != rec.ID {
+				t.Errorf("history for %q = %+v, %v", rec.CorrelationID, recs, err)
+			}
+			select {
+			case e := <-events:
+				if e.CorrelationID != rec.CorrelationID {
+					t.Errorf("event correlation ID = %q, want %q", e.CorrelationID, rec.CorrelationID)
+				}
+			default:
+				t.Error("no event published")
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package flow
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr, tz string
+		wantErr  string
+	}{
+		{expr: "*/15 9-17 * * mon-fri"},
+		{expr: "0 0 1,15 jan,JUL *"},
+		{expr: "@Daily"},
+		{expr: "CRON_TZ=Europe/Berlin 0 6 * * *"},
+		{expr: "0 6 * * 7", tz: "Asia/Tokyo"},
+		{expr: "0 6 * *", wantErr: "want 5 fields, got 4"},
+		{expr: "@fortnightly", wantErr: "want 5 fields"},
+		{expr: "60 * * * *", wantErr: `invalid minute "60" (want 0-59)`},
+		{expr: "0 24 * * *", wantErr: "invalid hour"},
+		{expr: "0 0 0 * *", wantErr: "invalid day of month"},
+		{expr: "0 0 * 13 *", wantErr: "invalid month"},
+		{expr: "0 0 * * 8", wantErr: "invalid day of week"},
+		{expr: "0 0 * * funday", wantErr: "invalid day of week"},
+		{expr: "*/0 * * * *", wantErr: `invalid step "0"`},
+		{expr: "5-1 * * * *", wantErr: `invalid range "5-1"`},
+		{expr: "0 0 * * *", tz: "Mars/Olympus", wantErr: `invalid time zone "Mars/Olympus"`},
+		{expr: "TZ=Nowhere 0 0 * * *", wantErr: "invalid time zone"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := ParseCron(tt.expr, tt.tz)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ParseCron() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseCron() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	ny := mustLoadLocation(t, "America/New_York")
+	santiago := mustLoadLocation(t, "America/Santiago")
+	utc := func(s string) time.Time {
+		at, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return at
+	}
+	tests := []struct {
+		name     string
+		expr, tz string
+		from     time.Time
+		want     []time.Time
+	}{
+		{
+			name: "every 15 minutes",
+			expr: "*/15 * * * *",
+			from: utc("2024-03-01T12:07:30Z"),
+			want: []time.Time{utc("2024-03-01T12:15:00Z"), utc("2024-03-01T12:30:00Z")},
+		},
+		{
+			name: "strictly after",
+			expr: "0 12 * * *",
+			from: utc("2024-03-01T12:00:00Z"),
+			want: []time.Time{utc("2024-03-02T12:00:00Z")},
+		},
+		{
+			name: "weekdays",
+			expr: "30 6 * * mon-fri",
+			from: utc("2024-03-01T07:00:00Z"), // a Friday
+			want: []time.Time{utc("2024-03-04T06:30:00Z"), utc("2024-03-05T06:30:00Z")},
+		},
+		{
+			name: "day of month or day of week",
+			expr: "0 0 13 * 5",
+			from: utc("2024-09-01T00:00:00Z"),
+			want: []time.Time{utc("2024-09-06T00:00:00Z"), utc("2024-09-13T00:00:00Z"), utc("2024-09-20T00:00:00Z")},
+		},
+		{
+			name: "sunday as 7",
+			expr: "0 0 * * 7",
+			from: utc("2024-03-01T00:00:00Z"),
+			want: []time.Time{utc("2024-03-03T00:00:00Z")},
+		},
+		{
+			name: "leap day",
+			expr: "0 0 29 2 *",
+			from: utc("2024-03-01T00:00:00Z"),
+			want: []time.Time{utc("2028-02-29T00:00:00Z")},
+		},
+		{
+			name: "never",
+			expr: "0 0 30 2 *",
+			from: utc("2024-01-01T00:00:00Z"),
+			want: []time.Time{{}},
+		},
+		{
+			name: "time zone",
+			expr: "0 6 * * *", tz: "Europe/Berlin",
+			from: utc("2024-07-01T00:00:00Z"),
+			want: []time.Time{utc("2024-07-01T04:00:00Z")},
+		},
+		{
+			name: "skipped when clocks go forward",
+			expr: "30 2 * * *", tz: "America/New_York",
+			from: time.Date(2024, 3, 10, 0, 0, 0, 0, ny),
+			want: []time.Time{time.Date(2024, 3, 11, 2, 30, 0, 0, ny), time.Date(2024, 3, 12, 2, 30, 0, 0, ny)},
+		},
+		{
+			name: "hourly when clocks go forward",
+			expr: "0 * * * *", tz: "America/New_York",
+			from: time.Date(2024, 3, 10, 0, 30, 0, 0, ny),
+			want: []time.Time{utc("2024-03-10T06:00:00Z"), utc("2024-03-10T07:00:00Z"), utc("2024-03-10T08:00:00Z")},
+		},
+		{
+			name: "fixed time once when clocks go back",
+			expr: "30 1 * * *", tz: "America/New_York",
+			from: time.Date(2024, 11, 3, 0, 0, 0, 0, ny),
+			want: []time.Time{utc("2024-11-03T05:30:00Z"), utc("2024-11-04T06:30:00Z")},
+		},
+		{
+			name: "hourly twice when clocks go back",
+			expr: "0 * * * *", tz: "America/New_York",
+			from: time.Date(2024, 11, 3, 0, 30, 0, 0, ny),
+			want: []time.Time{utc("2024-11-03T05:00:00Z"), utc("2024-11-03T06:00:00Z"), utc("2024-11-03T07:00:00Z")},
+		},
+		{
+			name: "midnight skipped when clocks go forward",
+			expr: "0 0 * * *", tz: "America/Santiago",
+			from: time.Date(2024, 9, 7, 12, 0, 0, 0, santiago),
+			want: []time.Time{time.Date(2024, 9, 9, 0, 0, 0, 0, santiago)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseCron(tt.expr, tt.tz)
+			if err != nil {
+				t.Fatal(err)
+			}
+			at := tt.from
+			for i, want := range tt.want {
+				at = s.Next(at)
+				if !at.Equal(want) {
+					t.Fatalf("firing %d = %v, want %v", i+1, at, want.In(s.Location()))
+				}
+			}
+		})
+	}
+}
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	return loc
+}
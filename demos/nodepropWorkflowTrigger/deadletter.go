@@ -0,0 +1,290 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RetryPolicy controls how often Submit retries a failed dispatch. Each
+// error class has a budget of attempts that may fail with it: by default
+// MaxAttempts for transient classes (a network failure, rate limiting, or a
+// 5xx) and 1, no retry, for the rest. The zero value makes one attempt.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	MaxAttempts int
+	// Backoff is the wait before the second attempt; it doubles after each
+	// further attempt, up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Budgets, if set, overrides the budget of the error classes it lists,
+	// keyed by ErrorClass. A budget above 1 retries even a permanent class,
+	// e.g. not_found for a repository that is still being created.
+	// Cancelled dispatches are never retried.
+	Budgets map[string]int
+	// Clock paces the waits between attempts; nil means SystemClock.
+	Clock Clock
+}
+
+// DefaultRetryPolicy makes up to five attempts over about half a minute for
+// network failures and rate limiting, and three for 5xx responses.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	Backoff:     2 * time.Second,
+	MaxBackoff:  30 * time.Second,
+	Budgets:     map[string]int{ErrorServer: 3},
+}
+
+// Budget returns the number of attempts that may fail with class.
+func (p RetryPolicy) Budget(class string) int {
+	if n, ok := p.Budgets[class]; ok {
+		return n
+	}
+	if Transient(class) {
+		return p.MaxAttempts
+	}
+	return 1
+}
+
+// delay returns the wait before the given attempt (2 or later).
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 2; i < attempt; i++ {
+		d *= 2
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+	return d
+}
+
+// run calls fn until it succeeds or p allows no more attempts, waiting
+// between attempts, and returns the last error.
+func (p RetryPolicy) run(ctx context.Context, log Logger, fn func() error) error {
+	failures := map[string]int{}
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.MaxAttempts {
+			return err
+		}
+		class := ErrorClass(err)
+		failures[class]++
+		if class == ErrorCancelled || failures[class] >= p.Budget(class) {
+			return err
+		}
+		delay := p.delay(attempt + 1)
+		LoggerOr(log).Warn("retrying delivery", "attempt", attempt, "status", statusOf(err), "class", class, "error", err, "delay", delay)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-ClockOr(p.Clock).After(delay):
+		}
+	}
+}
+
+// Retryable reports whether a dispatch error is transient and so worth
+// retrying.
+func Retryable(err error) bool {
+	return err != nil && Transient(ErrorClass(err))
+}
+
+// DeadLetter is a dispatch that was still rejected after every attempt its
+// retry policy allowed. It keeps the request so it can be replayed.
+type DeadLetter struct {
+	// ID is the ID of the rejected dispatch in the history.
+	ID       string            `json:"id"`
+	Repo     string            `json:"repo"`
+	Workflow string            `json:"workflow"`
+	Ref      string            `json:"ref"`
+	Inputs   map[string]string `json:"inputs,omitempty"`
+	Attempts int               `json:"attempts"`
+	Error    string            `json:"error"`
+	FailedAt time.Time         `json:"failed_at"`
+	// Replays counts replays that were rejected again; the latest error
+	// and time replace Error and FailedAt.
+	Replays int `json:"replays,omitempty"`
+	// ReplayedAs is the dispatch that finally succeeded, if any.
+	ReplayedAs string    `json:"replayed_as,omitempty"`
+	ReplayedAt time.Time `json:"replayed_at,omitempty"`
+}
+
+// Pending reports whether the dead letter has not been replayed successfully.
+func (d *DeadLetter) Pending() bool {
+	return d.ReplayedAs == ""
+}
+
+// DeadLetterStore persists dead letters.
+type DeadLetterStore interface {
+	Add(d DeadLetter) error
+	Update(d DeadLetter) error
+	Remove(id string) error
+	List() ([]DeadLetter, error)
+}
+
+// FindDeadLetter returns the dead letter with the given ID.
+func FindDeadLetter(s DeadLetterStore, id string) (DeadLetter, bool, error) {
+	all, err := s.List()
+	if err != nil {
+		return DeadLetter{}, false, err
+	}
+	for _, d := range all {
+		if d.ID == id {
+			return d, true, nil
+		}
+	}
+	return DeadLetter{}, false, nil
+}
+
+// FileDeadLetterStore keeps dead letters in a JSON file.
+type FileDeadLetterStore struct {
+	Path string
+	mu   sync.Mutex
+}
+
+// NewFileDeadLetterStore creates a FileDeadLetterStore backed by path.
+func NewFileDeadLetterStore(path string) *FileDeadLetterStore {
+	return &FileDeadLetterStore{Path: path}
+}
+
+// DefaultDeadLetterPath returns the per-user location of the dead-letter file.
+func DefaultDeadLetterPath() string {
+	return filepath.Join(filepath.Dir(DefaultHistoryPath()), "deadletters.json")
+}
+
+// Add stores a new dead letter.
+func (s *FileDeadLetterStore) Add(d DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all, err := s.load()
+	if err != nil {
+		return err
+	}
+	return s.save(append(all, d))
+}
+
+// Update replaces the dead letter with the same ID.
+func (s *FileDeadLetterStore) Update(d DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all, err := s.load()
+	if err != nil {
+		return err
+	}
+	for i := range all {
+		if all[i].ID == d.ID {
+			all[i] = d
+			return s.save(all)
+		}
+	}
+	return fmt.Errorf("dead letter %s not found", d.ID)
+}
+
+// Remove deletes the dead letter with the given ID.
+func (s *FileDeadLetterStore) Remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all, err := s.load()
+	if err != nil {
+		return err
+	}
+	for i := range all {
+		if all[i].ID == id {
+			return s.save(append(all[:i], all[i+1:]...))
+		}
+	}
+	return fmt.Errorf("dead letter %s not found", id)
+}
+
+// List returns every dead letter, newest first.
+func (s *FileDeadLetterStore) List() ([]DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].FailedAt.After(all[j].FailedAt) })
+	return all, nil
+}
+
+func (s *FileDeadLetterStore) load() ([]DeadLetter, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dead letters: %w", err)
+	}
+	var all []DeadLetter
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, fmt.Errorf("failed to parse dead letters %s: %w", s.Path, err)
+	}
+	return all, nil
+}
+
+func (s *FileDeadLetterStore) save(all []DeadLetter) error {
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead letters: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o755); err != nil {
+		return fmt.Errorf("failed to create dead-letter dir: %w", err)
+	}
+	tmp := s.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write dead letters: %w", err)
+	}
+	return os.Rename(tmp, s.Path)
+}
+
+// ReplayDeadLetter dispatches a dead letter again with its original
+// parameters. On success the dead letter is marked replayed; if the dispatch
+// is rejected again the dead letter records the new error rather than a
+// second one being added. Replaying an entry that was already replayed
+// returns its replay with ErrAlreadyDispatched.
+func (c *RunCorrelator) ReplayDeadLetter(ctx context.Context, id string) (*DispatchRecord, error) {
+	if c.DeadLetters == nil {
+		return nil, errors.New("no dead-letter store configured")
+	}
+	d, ok, err := FindDeadLetter(c.DeadLetters, id)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("dead letter %s not found", id)
+	}
+	// The key is the one `nodeprop replay` uses, so the two never both
+	// re-execute the same failure.
+	rec, attempts, err := c.submit(ctx, DispatchRequest{
+		Repo:           d.Repo,
+		Workflow:       d.Workflow,
+		Ref:            d.Ref,
+		Inputs:         d.Inputs,
+		IdempotencyKey: "replay:" + d.ID,
+		ReplayOf:       d.ID,
+	}, false)
+	if err != nil && !errors.Is(err, ErrAlreadyDispatched) {
+		if attempts > 0 {
+			d.Replays++
+			d.Attempts += attempts
+			d.Error, d.FailedAt = err.Error(), ClockOr(c.Clock).Now().UTC()
+			if uerr := c.DeadLetters.Update(d); uerr != nil {
+				return nil, fmt.Errorf("%w (and failed to update dead letter: %w)", err, uerr)
+			}
+		}
+		return nil, err
+	}
+	if d.Pending() {
+		d.ReplayedAs, d.ReplayedAt = rec.ID, ClockOr(c.Clock).Now().UTC()
+		if uerr := c.DeadLetters.Update(d); uerr != nil {
+			return rec, fmt.Errorf("replayed as %s but failed to update dead letter: %w", rec.ID, uerr)
+		}
+	}
+	return rec, err
+}
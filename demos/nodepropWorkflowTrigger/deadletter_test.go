@@ -0,0 +1,121 @@
+package flow_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+func TestRetryPolicyBudget(t *testing.T) {
+	tests := []struct {
+		class string
+		p     flow.RetryPolicy
+		want  int
+	}{
+		{class: flow.ErrorNetwork, p: flow.DefaultRetryPolicy, want: 5},
+		{class: flow.ErrorRateLimited, p: flow.DefaultRetryPolicy, want: 5},
+		{class: flow.ErrorServer, p: flow.DefaultRetryPolicy, want: 3},
+		{class: flow.ErrorNotFound, p: flow.DefaultRetryPolicy, want: 1},
+		{class: flow.ErrorInvalid, p: flow.DefaultRetryPolicy, want: 1},
+		{class: flow.ErrorNotFound, p: flow.RetryPolicy{MaxAttempts: 4, Budgets: map[string]int{flow.ErrorNotFound: 4}}, want: 4},
+		{class: flow.ErrorServer, p: flow.RetryPolicy{}, want: 0},
+	}
+	for _, tt := range tests {
+		if got := tt.p.Budget(tt.class); got != tt.want {
+			t.Errorf("Budget(%s) = %d, want %d", tt.class, got, tt.want)
+		}
+	}
+}
+
+func TestFileDeadLetterStore(t *testing.T) {
+	s := flow.NewFileDeadLetterStore(filepath.Join(t.TempDir(), "dl", "deadletters.json"))
+	if all, err := s.List(); err != nil || len(all) != 0 {
+		t.Fatalf("List() of a missing file = %v, %v", all, err)
+	}
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i, id := range []string{"a", "b", "c"} {
+		if err := s.Add(flow.DeadLetter{ID: id, Repo: "o/r", FailedAt: at.Add(time.Duration(i) * time.Minute)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Update(flow.DeadLetter{ID: "a", Repo: "o/r", FailedAt: at, ReplayedAs: "z"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Remove("b"); err != nil {
+		t.Fatal(err)
+	}
+	for _, err := range []error{s.Update(flow.DeadLetter{ID: "b"}), s.Remove("b")} {
+		if err == nil {
+			t.Error("changing a removed dead letter succeeded")
+		}
+	}
+	all, err := s.List()
+	if err != nil || len(all) != 2 || all[0].ID != "c" || all[1].ID != "a" || all[1].Pending() {
+		t.Errorf("List() = %+v, %v; want c then the replayed a", all, err)
+	}
+	if d, ok, err := flow.FindDeadLetter(s, "c"); !ok || err != nil || d.ID != "c" {
+		t.Errorf("FindDeadLetter(c) = %+v, %v, %v", d, ok, err)
+	}
+	if _, ok, err := flow.FindDeadLetter(s, "b"); ok || err != nil {
+		t.Errorf("FindDeadLetter(b) = %v, %v; want not found", ok, err)
+	}
+}
+
+func TestReplayDeadLetter(t *testing.T) {
+	gh := nodeproptest.NewServer()
+	defer gh.Close()
+	gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+	c := newCorrelator(t, gh)
+	ctx := context.Background()
+	if _, err := c.ReplayDeadLetter(ctx, "x"); err == nil {
+		t.Error("ReplayDeadLetter() without a store succeeded")
+	}
+	c.DeadLetters = flow.NewFileDeadLetterStore(filepath.Join(t.TempDir(), "deadletters.json"))
+	c.Retry = flow.RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond}
+
+	gh.Inject(nodeproptest.Fault{Method: "POST", Path: "/repos/*/*/actions/workflows/*/dispatches", Status: 502, Times: 2})
+	req := flow.DispatchRequest{Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "main", Inputs: map[string]string{"env": "prod"}}
+	if _, err := c.Submit(ctx, req); flow.ErrorClass(err) != flow.ErrorServer {
+		t.Fatalf("Submit() error = %v, want a server error", err)
+	}
+	all, _ := c.DeadLetters.List()
+	if len(all) != 1 || all[0].Attempts != 2 || all[0].Inputs["env"] != "prod" || !all[0].Pending() {
+		t.Fatalf("dead letters = %+v, want the rejected dispatch", all)
+	}
+	id := all[0].ID
+
+	if _, err := c.ReplayDeadLetter(ctx, "missing"); err == nil {
+		t.Error("ReplayDeadLetter() of a missing dead letter succeeded")
+	}
+
+	// Rejected again: the dead letter is updated, not duplicated.
+	gh.Inject(nodeproptest.Fault{Method: "POST", Path: "/repos/*/*/actions/workflows/*/dispatches", Status: 422, Times: 1})
+	if _, err := c.ReplayDeadLetter(ctx, id); flow.ErrorClass(err) != flow.ErrorInvalid {
+		t.Fatalf("ReplayDeadLetter() error = %v, want the rejection", err)
+	}
+	all, _ = c.DeadLetters.List()
+	if len(all) != 1 || all[0].Replays != 1 || all[0].Attempts != 3 || !all[0].Pending() {
+		t.Fatalf("dead letters after a rejected replay = %+v", all)
+	}
+
+	rec, err := c.ReplayDeadLetter(ctx, id)
+	if err != nil || rec.ReplayOf != id {
+		t.Fatalf("ReplayDeadLetter() = %+v, %v", rec, err)
+	}
+	d, _, _ := flow.FindDeadLetter(c.DeadLetters, id)
+	if d.Pending() || d.ReplayedAs != rec.ID {
+		t.Errorf("dead letter = %+v, want it replayed as %s", d, rec.ID)
+	}
+	again, err := c.ReplayDeadLetter(ctx, id)
+	if !errors.Is(err, flow.ErrAlreadyDispatched) || again == nil || again.ID != rec.ID {
+		t.Errorf("second ReplayDeadLetter() = %+v, %v; want the first replay", again, err)
+	}
+	if n := len(gh.Dispatches()); n != 1 {
+		t.Errorf("%d dispatches succeeded, want 1", n)
+	}
+}
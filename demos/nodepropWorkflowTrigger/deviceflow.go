@@ -0,0 +1,140 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DeviceCode is GitHub's response to a device authorization request.
+type DeviceCode struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+}
+
+// DeviceFlow implements the OAuth device authorization grant against GitHub.
+type DeviceFlow struct {
+	// BaseURL is the web (not API) root, e.g. https://github.com.
+	BaseURL    string
+	ClientID   string
+	Scopes     []string
+	HTTPClient *http.Client
+}
+
+// WebBaseURL derives the web root from a REST API base URL:
+// https://api.github.com becomes https://github.com and GHES
+// https://host/api/v3 becomes https://host.
+func WebBaseURL(apiBaseURL string) string {
+	if apiBaseURL == "" || strings.TrimSuffix(apiBaseURL, "/") == DefaultAPIBaseURL {
+		return "https://github.com"
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(apiBaseURL, "/"), "/api/v3")
+}
+
+// Start requests a device and user code. The user must enter UserCode at
+// VerificationURI before Poll succeeds.
+func (f *DeviceFlow) Start(ctx context.Context) (*DeviceCode, error) {
+	form := url.Values{"client_id": {f.ClientID}}
+	if len(f.Scopes) > 0 {
+		form.Set("scope", strings.Join(f.Scopes, " "))
+	}
+	var res struct {
+		DeviceCode
+		deviceError
+	}
+	if err := f.post(ctx, "/login/device/code", form, &res); err != nil {
+		return nil, err
+	}
+	if res.Error != "" {
+		return nil, fmt.Errorf("device authorization failed: %s", res.deviceError)
+	}
+	code := res.DeviceCode
+	if code.Interval <= 0 {
+		code.Interval = 5
+	}
+	return &code, nil
+}
+
+// Poll waits for the user to authorize code and returns the access token.
+func (f *DeviceFlow) Poll(ctx context.Context, code *DeviceCode) (string, error) {
+	interval := time.Duration(code.Interval) * time.Second
+	deadline := time.Now().Add(time.Duration(code.ExpiresIn) * time.Second)
+	form := url.Values{
+		"client_id":   {f.ClientID},
+		"device_code": {code.DeviceCode},
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(interval):
+		}
+		if code.ExpiresIn > 0 && time.Now().After(deadline) {
+			return "", fmt.Errorf("device code expired")
+		}
+
+		var res struct {
+			AccessToken string `json:"access_token"`
+			deviceError
+		}
+		if err := f.post(ctx, "/login/oauth/access_token", form, &res); err != nil {
+			return "", err
+		}
+		switch res.Error {
+		case "":
+			if res.AccessToken == "" {
+				return "", fmt.Errorf("no access token in response")
+			}
+			return res.AccessToken, nil
+		case "authorization_pending":
+		case "slow_down":
+			interval += 5 * time.Second
+		default:
+			return "", fmt.Errorf("device authorization failed: %s", res.deviceError)
+		}
+	}
+}
+
+// deviceError is the error shape returned by the OAuth endpoints.
+type deviceError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e deviceError) String() string {
+	if e.Description != "" {
+		return e.Error + ": " + e.Description
+	}
+	return e.Error
+}
+
+func (f *DeviceFlow) post(ctx context.Context, path string, form url.Values, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(f.BaseURL, "/")+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClientOr(f.HTTPClient).Do(req)
+	if err != nil {
+		return fmt.Errorf("POST %s failed: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("POST %s: unexpected status code: %d", path, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
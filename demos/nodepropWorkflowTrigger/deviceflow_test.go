@@ -0,0 +1,117 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebBaseURL(t *testing.T) {
+	tests := map[string]string{
+		"":                                "https://github.com",
+		"https://api.github.com":          "https://github.com",
+		"https://api.github.com/":         "https://github.com",
+		"https://ghe.example.com/api/v3":  "https://ghe.example.com",
+		"https://ghe.example.com/api/v3/": "https://ghe.example.com",
+	}
+	for in, want := range tests {
+		if got := WebBaseURL(in); got != want {
+			t.Errorf("WebBaseURL(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestDeviceFlow(t *testing.T) {
+	tests := []struct {
+		name string
+		// responses are the successive bodies of the token endpoint.
+		responses []string
+		want      string
+		wantErr   string
+	}{
+		{name: "authorized", responses: []string{`{"access_token": "gho_token"}`}, want: "gho_token"},
+		{name: "pending", responses: []string{`{"error": "authorization_pending"}`, `{"error": "authorization_pending"}`, `{"access_token": "gho_token"}`}, want: "gho_token"},
+		{name: "denied", responses: []string{`{"error": "access_denied", "error_description": "The user cancelled"}`}, wantErr: "access_denied: The user cancelled"},
+		{name: "no token", responses: []string{`{}`}, wantErr: "no access token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var polls int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := r.ParseForm(); err != nil || r.Form.Get("client_id") != "client" {
+					http.Error(w, "bad form", http.StatusBadRequest)
+					return
+				}
+				switch r.URL.Path {
+				case "/login/device/code":
+					if r.Form.Get("scope") != "repo workflow" {
+						http.Error(w, "bad scope", http.StatusBadRequest)
+						return
+					}
+					fmt.Fprint(w, `{"device_code": "dc", "user_code": "ABCD-1234", "verification_uri": "https://github.com/login/device", "expires_in": 900}`)
+				case "/login/oauth/access_token":
+					if r.Form.Get("device_code") != "dc" {
+						http.Error(w, "bad device code", http.StatusBadRequest)
+						return
+					}
+					fmt.Fprint(w, tt.responses[min(polls, len(tt.responses)-1)])
+					polls++
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer srv.Close()
+			f := &DeviceFlow{BaseURL: srv.URL + "/", ClientID: "client", Scopes: []string{"repo", "workflow"}}
+
+			code, err := f.Start(context.Background())
+			if err != nil {
+				t.Fatalf("Start() error = %v", err)
+			}
+			if code.UserCode != "ABCD-1234" || code.Interval != 5 {
+				t.Errorf("Start() = %+v, want the user code and the default interval", code)
+			}
+			// Poll without waiting between attempts.
+			code.Interval = 0
+			got, err := f.Poll(context.Background(), code)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Poll() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Poll() = %q, %v; want %q", got, err, tt.want)
+			}
+			if polls != len(tt.responses) {
+				t.Errorf("polled %d times, want %d", polls, len(tt.responses))
+			}
+		})
+	}
+}
+
+func TestDeviceFlowErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login/device/code" {
+			fmt.Fprint(w, `{"error": "unauthorized_client"}`)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	f := &DeviceFlow{BaseURL: srv.URL, ClientID: "client"}
+
+	if _, err := f.Start(context.Background()); err == nil || !strings.Contains(err.Error(), "unauthorized_client") {
+		t.Errorf("Start() error = %v, want the OAuth error", err)
+	}
+	if _, err := f.Poll(context.Background(), &DeviceCode{DeviceCode: "dc"}); err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("Poll() error = %v, want the status code", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := f.Poll(ctx, &DeviceCode{DeviceCode: "dc", Interval: 60}); err != context.Canceled {
+		t.Errorf("Poll() with a cancelled context error = %v", err)
+	}
+}
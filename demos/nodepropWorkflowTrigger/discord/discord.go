@@ -0,0 +1,289 @@
+// Package discord posts dispatch results to Discord and accepts trigger
+// commands from a Discord application command.
+package discord
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// DefaultAPIBaseURL is the Discord API endpoint used for follow-up messages.
+const DefaultAPIBaseURL = "https://discord.com/api/v10"
+
+// Embed colours by outcome.
+const (
+	colorSuccess = 0x2da44e
+	colorFailure = 0xcf222e
+	colorInfo    = 0x0969da
+)
+
+// maxBody caps the size of an interaction request.
+const maxBody = 1 << 20
+
+// Webhook posts events to a Discord channel webhook.
+type Webhook struct {
+	URL        string
+	HTTPClient *http.Client
+}
+
+// Notify posts e as an embed. Mentions in event text are never expanded.
+func (w *Webhook) Notify(ctx context.Context, e flow.Event) error {
+	color := colorInfo
+	switch {
+	case e.Type == flow.EventFailed || (e.Type == flow.EventRunCompleted && e.Status != "success"):
+		color = colorFailure
+	case e.Type == flow.EventRunCompleted:
+		color = colorSuccess
+	}
+	embed := map[string]interface{}{
+		"title":       flow.EventSummary(e),
+		"color":       color,
+		"timestamp":   e.Time.Format(time.RFC3339),
+		"description": fmt.Sprintf("%s · %s", e.Repo, e.Workflow),
+	}
+	if e.RunURL != "" {
+		embed["url"] = e.RunURL
+	}
+	msg := map[string]interface{}{
+		"embeds":           []interface{}{embed},
+		"allowed_mentions": map[string]interface{}{"parse": []string{}},
+	}
+	return post(ctx, w.HTTPClient, "POST", w.URL, msg)
+}
+
+// Interactions serves a Discord application's interactions endpoint. The
+// application command takes one string option holding the command text,
+// e.g. "/nodeprop command: trigger owner/repo deploy.yml main env=prod".
+type Interactions struct {
+	// PublicKey verifies that requests come from Discord.
+	PublicKey  ed25519.PublicKey
+	Correlator *flow.RunCorrelator
+	// Registry, if non-empty, is the allowlist of repositories that may be
+	// triggered.
+	Registry *flow.RepositoryRegistry
+	// APIBaseURL overrides DefaultAPIBaseURL.
+	APIBaseURL string
+	HTTPClient *http.Client
+	// Logger receives errors; nil means log.Default().
+	Logger *log.Logger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// ParsePublicKey decodes the hex public key shown in the Discord developer
+// portal.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	b, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(b) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid Discord public key")
+	}
+	return ed25519.PublicKey(b), nil
+}
+
+// NewInteractions creates an Interactions handler. Call Close to wait for
+// pending replies.
+func NewInteractions(publicKey ed25519.PublicKey, correlator *flow.RunCorrelator, registry *flow.RepositoryRegistry) *Interactions {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Interactions{PublicKey: publicKey, Correlator: correlator, Registry: registry, ctx: ctx, cancel: cancel}
+}
+
+// Close cancels pending replies and waits for them to finish.
+func (i *Interactions) Close() {
+	i.cancel()
+	i.wg.Wait()
+}
+
+// interaction is the subset of an interaction payload used here.
+type interaction struct {
+	Type          int    `json:"type"`
+	ApplicationID string `json:"application_id"`
+	Token         string `json:"token"`
+	Data          struct {
+		Options []struct {
+			Value interface{} `json:"value"`
+		} `json:"options"`
+	} `json:"data"`
+	Member *struct {
+		User discordUser `json:"user"`
+	} `json:"member"`
+	User *discordUser `json:"user"`
+}
+
+type discordUser struct {
+	ID string `json:"id"`
+}
+
+// Interaction and response types.
+const (
+	interactionPing               = 1
+	interactionApplicationCommand = 2
+	responsePong                  = 1
+	responseMessage               = 4
+	responseDeferredMessage       = 5
+)
+
+func (i *Interactions) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+	if err != nil {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	sig, err := hex.DecodeString(r.Header.Get("X-Signature-Ed25519"))
+	msg := append([]byte(r.Header.Get("X-Signature-Timestamp")), body...)
+	if err != nil || !ed25519.Verify(i.PublicKey, msg, sig) {
+		http.Error(w, "invalid request signature", http.StatusUnauthorized)
+		return
+	}
+
+	var in interaction
+	if err := json.Unmarshal(body, &in); err != nil {
+		http.Error(w, "invalid interaction", http.StatusBadRequest)
+		return
+	}
+	switch in.Type {
+	case interactionPing:
+		writeJSON(w, map[string]int{"type": responsePong})
+		return
+	case interactionApplicationCommand:
+	default:
+		http.Error(w, "unsupported interaction type", http.StatusBadRequest)
+		return
+	}
+
+	var text string
+	if len(in.Data.Options) > 0 {
+		text, _ = in.Data.Options[0].Value.(string)
+	}
+	cmd, err := flow.ParseChatCommand(text)
+	if err != nil {
+		writeMessage(w, err.Error())
+		return
+	}
+	if cmd.Name == "help" {
+		writeMessage(w, "Usage: "+flow.ChatUsage)
+		return
+	}
+	if i.Registry != nil && len(i.Registry.Repos()) > 0 {
+		if _, ok := i.Registry.Get(cmd.Repo); !ok {
+			writeMessage(w, fmt.Sprintf("Repository %s is not registered.", cmd.Repo))
+			return
+		}
+	}
+	if cmd.Ref == "" {
+		cmd.Ref = "main"
+	}
+
+	// Discord wants an answer within three seconds, so acknowledge now and
+	// edit the reply once the dispatch is done.
+	writeJSON(w, map[string]int{"type": responseDeferredMessage})
+	user := ""
+	if in.Member != nil {
+		user = in.Member.User.ID
+	} else if in.User != nil {
+		user = in.User.ID
+	}
+	i.wg.Add(1)
+	go func() {
+		defer i.wg.Done()
+		text := i.dispatch(i.ctx, *cmd, user)
+		base := i.APIBaseURL
+		if base == "" {
+			base = DefaultAPIBaseURL
+		}
+		url := fmt.Sprintf("%s/webhooks/%s/%s/messages/@original", strings.TrimRight(base, "/"), in.ApplicationID, in.Token)
+		if err := post(i.ctx, i.HTTPClient, "PATCH", url, message(text)); err != nil {
+			i.logf("discord: reply: %v", err)
+		}
+	}()
+}
+
+// dispatch performs cmd and describes the outcome.
+func (i *Interactions) dispatch(ctx context.Context, cmd flow.ChatCommand, user string) string {
+	req := flow.DispatchRequest{
+		Repo:     cmd.Repo,
+		Workflow: cmd.Workflow,
+		Ref:      cmd.Ref,
+		Inputs:   cmd.Inputs,
+	}
+	if user != "" {
+		req.RequestedBy = "discord:" + user
+	}
+	rec, err := i.Correlator.Submit(ctx, req)
+	var held *flow.ApprovalRequiredError
+	if errors.As(err, &held) {
+		return fmt.Sprintf("%s in %s needs approval %s; it will be dispatched once approved.", cmd.Workflow, cmd.Repo, held.Approval.ID)
+	}
+	if err != nil {
+		return fmt.Sprintf("Failed to trigger %s in %s: %v", cmd.Workflow, cmd.Repo, err)
+	}
+	by := ""
+	if user != "" {
+		by = fmt.Sprintf("<@%s> ", user)
+	}
+	return fmt.Sprintf("%striggered %s in %s at %s (dispatch %s).", by, cmd.Workflow, cmd.Repo, cmd.Ref, rec.ID)
+}
+
+// message is a message body that never pings anyone.
+func message(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"content":          text,
+		"allowed_mentions": map[string]interface{}{"parse": []string{}},
+	}
+}
+
+func writeMessage(w http.ResponseWriter, text string) {
+	writeJSON(w, map[string]interface{}{"type": responseMessage, "data": message(text)})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func post(ctx context.Context, hc *http.Client, method, url string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if hc == nil {
+		hc = flow.SharedHTTPClient()
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s webhook: unexpected status code: %d: %s", method, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func (i *Interactions) logf(format string, args ...interface{}) {
+	l := i.Logger
+	if l == nil {
+		l = log.Default()
+	}
+	l.Printf(format, args...)
+}
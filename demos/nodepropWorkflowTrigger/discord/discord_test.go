@@ -0,0 +1,178 @@
+package discord
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+func TestWebhookNotify(t *testing.T) {
+	tests := []struct {
+		name  string
+		e     flow.Event
+		color float64
+	}{
+		{name: "success", e: flow.Event{Type: flow.EventRunCompleted, Status: "success", RunURL: "https://github.com/o/r/actions/runs/1"}, color: colorSuccess},
+		{name: "failed run", e: flow.Event{Type: flow.EventRunCompleted, Status: "failure"}, color: colorFailure},
+		{name: "failed dispatch", e: flow.Event{Type: flow.EventFailed, Error: "<@everyone>"}, color: colorFailure},
+		{name: "approval", e: flow.Event{Type: flow.EventApprovalRequested}, color: colorInfo},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got struct {
+				Embeds []struct {
+					Title string  `json:"title"`
+					Color float64 `json:"color"`
+					URL   string  `json:"url"`
+				} `json:"embeds"`
+				AllowedMentions struct {
+					Parse []string `json:"parse"`
+				} `json:"allowed_mentions"`
+			}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewDecoder(r.Body).Decode(&got)
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer srv.Close()
+			tt.e.Repo, tt.e.Workflow = "o/r", "ci.yml"
+
+			w := &Webhook{URL: srv.URL}
+			if err := w.Notify(t.Context(), tt.e); err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Embeds) != 1 || got.Embeds[0].Color != tt.color || got.Embeds[0].Title != flow.EventSummary(tt.e) || got.Embeds[0].URL != tt.e.RunURL {
+				t.Errorf("embeds = %+v, want colour %#x", got.Embeds, int(tt.color))
+			}
+			if got.AllowedMentions.Parse == nil || len(got.AllowedMentions.Parse) != 0 {
+				t.Errorf("allowed_mentions = %+v, want mentions disabled", got.AllowedMentions)
+			}
+		})
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unknown webhook", http.StatusNotFound)
+	}))
+	defer srv.Close()
+	err := (&Webhook{URL: srv.URL}).Notify(t.Context(), flow.Event{Type: flow.EventFailed})
+	if err == nil || !strings.Contains(err.Error(), "404: unknown webhook") {
+		t.Errorf("Notify() error = %v, want the response", err)
+	}
+}
+
+func TestParsePublicKey(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(nil)
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{in: hex.EncodeToString(pub) + "\n", want: true},
+		{in: hex.EncodeToString(pub[:16])},
+		{in: "not hex"},
+	}
+	for _, tt := range tests {
+		if _, err := ParsePublicKey(tt.in); (err == nil) != tt.want {
+			t.Errorf("ParsePublicKey(%q) error = %v", tt.in, err)
+		}
+	}
+}
+
+// replies records the deferred replies edited through the Discord API.
+type replies struct {
+	paths chan string
+	texts chan string
+}
+
+func (r *replies) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var m struct {
+		Content string `json:"content"`
+	}
+	json.NewDecoder(req.Body).Decode(&m)
+	r.paths <- req.Method + " " + req.URL.Path
+	r.texts <- m.Content
+}
+
+func TestInteractions(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	gh := nodeproptest.NewServer()
+	defer gh.Close()
+	gh.AddWorkflow("Cdaprod/api", "deploy.yml")
+	c := flow.NewRunCorrelator(gh.Client(), flow.NewFileHistoryStore(filepath.Join(t.TempDir(), "history.json")))
+	reg := flow.NewRepositoryRegistry()
+	reg.RegisterRepo("Cdaprod/api", nil, []string{"deploy.yml"})
+	rs := &replies{paths: make(chan string, 1), texts: make(chan string, 1)}
+	api := httptest.NewServer(rs)
+	defer api.Close()
+
+	i := NewInteractions(pub, c, reg)
+	i.APIBaseURL = api.URL
+	i.Logger = log.New(io.Discard, "", 0)
+	defer i.Close()
+
+	send := func(body string, key ed25519.PrivateKey) *httptest.ResponseRecorder {
+		ts := "1700000000"
+		req := httptest.NewRequest("POST", "/discord", strings.NewReader(body))
+		req.Header.Set("X-Signature-Timestamp", ts)
+		req.Header.Set("X-Signature-Ed25519", hex.EncodeToString(ed25519.Sign(key, []byte(ts+body))))
+		w := httptest.NewRecorder()
+		i.ServeHTTP(w, req)
+		return w
+	}
+	command := func(text string) string {
+		return `{"type": 2, "application_id": "app", "token": "tok", "member": {"user": {"id": "42"}}, "data": {"options": [{"value": "` + text + `"}]}}`
+	}
+
+	_, other, _ := ed25519.GenerateKey(nil)
+	tests := []struct {
+		name   string
+		body   string
+		key    ed25519.PrivateKey
+		status int
+		want   string
+	}{
+		{name: "ping", body: `{"type": 1}`, key: priv, status: 200, want: `{"type":1}`},
+		{name: "wrong key", body: `{"type": 1}`, key: other, status: 401},
+		{name: "unsupported", body: `{"type": 3}`, key: priv, status: 400},
+		{name: "malformed", body: `{`, key: priv, status: 400},
+		{name: "help", body: command("help"), key: priv, status: 200, want: "Usage: "},
+		{name: "invalid", body: command("trigger api"), key: priv, status: 200, want: "usage:"},
+		{name: "not registered", body: command("trigger Cdaprod/web deploy.yml"), key: priv, status: 200, want: "Repository Cdaprod/web is not registered."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := send(tt.body, tt.key)
+			if w.Code != tt.status || !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("response = %d %s, want %d %q", w.Code, w.Body, tt.status, tt.want)
+			}
+		})
+	}
+
+	w := send(command("trigger Cdaprod/api deploy.yml env=prod"), priv)
+	if strings.TrimSpace(w.Body.String()) != `{"type":5}` {
+		t.Fatalf("response = %s, want a deferred message", w.Body)
+	}
+	select {
+	case path := <-rs.paths:
+		if path != "PATCH /webhooks/app/tok/messages/@original" {
+			t.Errorf("reply sent to %s", path)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reply")
+	}
+	if text := <-rs.texts; !strings.HasPrefix(text, "<@42> triggered deploy.yml in Cdaprod/api at main (dispatch ") {
+		t.Errorf("reply = %q", text)
+	}
+	if ds := gh.Dispatches(); len(ds) != 1 || ds[0].Inputs["env"] != "prod" {
+		t.Errorf("dispatches = %+v", ds)
+	}
+}
@@ -0,0 +1,84 @@
+package flow
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Providers of a DispatchError raised by the package's own triggers.
+// Errors of other triggers run by a TriggerManager name their Go type.
+const (
+	ProviderGitHubWorkflow     = "github_workflow"
+	ProviderGitHubRepoDispatch = "github_repository_dispatch"
+	ProviderWebhook            = "webhook"
+)
+
+// ErrNotRegistered is wrapped by the error of a TriggerManager asked to
+// run a trigger it does not have. ErrorClass classifies it as not_found.
+var ErrNotRegistered = errors.New("not registered")
+
+// DispatchError is a dispatch that failed, with the context programs need
+// to handle it without parsing the message: what was dispatched, by which
+// provider, and the response if there was one. Its message is that of
+// Err, which it wraps, so errors.Is, errors.As, and ErrorClass see through
+// it.
+type DispatchError struct {
+	// Provider is the kind of trigger, e.g. ProviderGitHubWorkflow.
+	Provider string
+	// Target is the repository or other target dispatched to.
+	Target string
+	// Trigger names what was dispatched: a workflow file, an event type, a
+	// webhook URL, or the name a trigger is registered under.
+	Trigger string
+	// StatusCode and Body are the response's, for failures with a response
+	// other than 2xx; Body is redacted. Message is GitHub's message in it.
+	StatusCode int
+	Body       string
+	Message    string
+	Err        error
+}
+
+func (e *DispatchError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DispatchError) Unwrap() error {
+	return e.Err
+}
+
+// Class returns the ErrorClass of the failure.
+func (e *DispatchError) Class() string {
+	return ErrorClass(e.Err)
+}
+
+// dispatchError returns err as a *DispatchError of provider dispatching
+// trigger to target, or nil if err is nil. An err that is already a
+// *DispatchError is returned as it is, so the innermost context is kept.
+func dispatchError(provider, target, trigger string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var de *DispatchError
+	if errors.As(err, &de) {
+		return err
+	}
+	de = &DispatchError{Provider: provider, Target: target, Trigger: trigger, Err: err}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		de.StatusCode, de.Body = apiErr.StatusCode, apiErr.Body
+		var body struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal([]byte(apiErr.Body), &body) == nil {
+			de.Message = body.Message
+		}
+	}
+	return de
+}
+
+// providerOf names the provider of a trigger that is not one of the
+// package's own.
+func providerOf(t Trigger) string {
+	return fmt.Sprintf("%T", t)
+}
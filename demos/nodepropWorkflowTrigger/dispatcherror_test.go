@@ -0,0 +1,147 @@
+package flow_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+func TestDispatchError(t *testing.T) {
+	gh := nodeproptest.NewServer()
+	defer gh.Close()
+	gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message": "hook is down"}`, http.StatusServiceUnavailable)
+	}))
+	defer hook.Close()
+
+	tests := []struct {
+		name         string
+		trigger      flow.Trigger
+		target       string
+		params       map[string]string
+		wantProvider string
+		wantTrigger  string
+		wantStatus   int
+		wantMessage  bool
+		wantClass    string
+	}{
+		{
+			name:         "unknown workflow",
+			trigger:      flow.NewGitHubWorkflowDispatch("missing.yml", flow.WithRef("main"), flow.WithBaseURL(gh.URL)),
+			target:       "Cdaprod/site",
+			wantProvider: flow.ProviderGitHubWorkflow,
+			wantTrigger:  "missing.yml",
+			wantStatus:   http.StatusNotFound,
+			wantMessage:  true,
+			wantClass:    flow.ErrorNotFound,
+		},
+		{
+			name:         "no ref",
+			trigger:      flow.NewGitHubWorkflowDispatch("deploy.yml", flow.WithBaseURL(gh.URL)),
+			target:       "Cdaprod/site",
+			wantProvider: flow.ProviderGitHubWorkflow,
+			wantTrigger:  "deploy.yml",
+			wantStatus:   http.StatusUnprocessableEntity,
+			wantMessage:  true,
+			wantClass:    flow.ErrorInvalid,
+		},
+		{
+			name:         "invalid input",
+			trigger:      flow.NewGitHubWorkflowDispatch("deploy.yml", flow.WithRef("main"), flow.WithBaseURL(gh.URL)),
+			target:       "Cdaprod/site",
+			params:       map[string]string{"-x": "1"},
+			wantProvider: flow.ProviderGitHubWorkflow,
+			wantTrigger:  "deploy.yml",
+			wantClass:    flow.ErrorInvalid,
+		},
+		{
+			name:         "unknown repository",
+			trigger:      flow.NewGitHubRepoDispatch("deploy", flow.WithBaseURL(gh.URL)),
+			target:       "Cdaprod/missing",
+			wantProvider: flow.ProviderGitHubRepoDispatch,
+			wantTrigger:  "deploy",
+			wantStatus:   http.StatusNotFound,
+			wantMessage:  true,
+			wantClass:    flow.ErrorNotFound,
+		},
+		{
+			name:         "webhook down",
+			trigger:      flow.NewWebhookTrigger(hook.URL),
+			target:       "Cdaprod/site",
+			wantProvider: flow.ProviderWebhook,
+			wantTrigger:  hook.URL,
+			wantStatus:   http.StatusServiceUnavailable,
+			wantMessage:  true,
+			wantClass:    flow.ErrorServer,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.trigger.Trigger(tt.target, tt.params, nodeproptest.DefaultToken)
+			var de *flow.DispatchError
+			if !errors.As(err, &de) {
+				t.Fatalf("Trigger() error = %v (%T), want a *flow.DispatchError", err, err)
+			}
+			if de.Provider != tt.wantProvider || de.Target != tt.target || de.Trigger != tt.wantTrigger || de.StatusCode != tt.wantStatus {
+				t.Errorf("DispatchError = %+v, want provider %s, target %s, trigger %s, status %d", de, tt.wantProvider, tt.target, tt.wantTrigger, tt.wantStatus)
+			}
+			if (de.Message != "") != tt.wantMessage || tt.wantStatus != 0 && de.Body == "" {
+				t.Errorf("DispatchError message %q and body %q", de.Message, de.Body)
+			}
+			if de.Class() != tt.wantClass || flow.ErrorClass(err) != tt.wantClass {
+				t.Errorf("Class() = %s, want %s", de.Class(), tt.wantClass)
+			}
+			if de.Error() != de.Err.Error() {
+				t.Errorf("Error() = %q, want that of the wrapped error", de.Error())
+			}
+			var apiErr *flow.APIError
+			if errors.As(err, &apiErr) != (tt.wantStatus != 0) {
+				t.Errorf("errors.As(*APIError) = %v with status %d", apiErr, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestTriggerManagerDispatchError(t *testing.T) {
+	errBoom := errors.New("boom")
+	tm := flow.NewTriggerManager()
+	tm.Logger = discardLogger
+	tm.RegisterWorkflow("custom", &nodeproptest.MockTrigger{Err: errBoom})
+	inner := &flow.DispatchError{Provider: "inner", Target: "Cdaprod/site", Trigger: "inner.yml", Err: errBoom}
+	tm.RegisterWorkflow("wrapped", &nodeproptest.MockTrigger{Err: fmt.Errorf("retrying: %w", inner)})
+
+	tests := []struct {
+		name         string
+		workflow     string
+		wantProvider string
+		wantTrigger  string
+		wantIs       error
+		wantClass    string
+	}{
+		{name: "not registered", workflow: "missing", wantTrigger: "missing", wantIs: flow.ErrNotRegistered, wantClass: flow.ErrorNotFound},
+		{name: "custom trigger", workflow: "custom", wantProvider: "*nodeproptest.MockTrigger", wantTrigger: "custom", wantIs: errBoom, wantClass: flow.ErrorNetwork},
+		{name: "innermost kept", workflow: "wrapped", wantProvider: "inner", wantTrigger: "inner.yml", wantIs: errBoom, wantClass: flow.ErrorNetwork},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tm.ExecuteWorkflowContext(context.Background(), tt.workflow, "Cdaprod/site", "token", nil)
+			var de *flow.DispatchError
+			if !errors.As(err, &de) || !errors.Is(err, tt.wantIs) {
+				t.Fatalf("ExecuteWorkflowContext() error = %v, want a *flow.DispatchError wrapping %v", err, tt.wantIs)
+			}
+			if de.Provider != tt.wantProvider || de.Trigger != tt.wantTrigger || de.Target != "Cdaprod/site" || de.Class() != tt.wantClass {
+				t.Errorf("DispatchError = %+v, class %s", de, de.Class())
+			}
+		})
+	}
+	if err := tm.ExecuteActionContext(context.Background(), "custom", "Cdaprod/site", "token", nil); !errors.Is(err, flow.ErrNotRegistered) {
+		t.Errorf("ExecuteActionContext() of a workflow's name error = %v, want %v", err, flow.ErrNotRegistered)
+	}
+}
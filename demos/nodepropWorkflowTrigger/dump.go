@@ -0,0 +1,75 @@
+package flow
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// maxDumpBody caps how much of a response body is read for a dump.
+const maxDumpBody = 64 << 10
+
+// redactedHeaders carry credentials and are dumped without their values.
+var redactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"X-Api-Key":           true,
+}
+
+// dump writes a failed request and its response, or the error that took
+// the place of a response, to c.DebugDump. Credential headers, Secrets,
+// which include c.Token, and the secret inputs of the dispatch ctx belongs
+// to are redacted.
+func (c *GitHubClient) dump(ctx context.Context, req *http.Request, body []byte, resp *http.Response, respBody []byte, failure error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "--- nodeprop: failed GitHub request at %s", time.Now().UTC().Format(time.RFC3339))
+	if id := CorrelationID(ctx); id != "" {
+		fmt.Fprintf(&b, " (correlation ID %s)", id)
+	}
+	fmt.Fprintf(&b, "\n%s %s HTTP/1.1\n", req.Method, req.URL)
+	writeHeaders(&b, req.Header)
+	if len(body) > 0 {
+		fmt.Fprintf(&b, "\n%s\n", body)
+	}
+	b.WriteString("\n")
+	if resp == nil {
+		fmt.Fprintf(&b, "error: %v\n", failure)
+	} else {
+		fmt.Fprintf(&b, "%s %s\n", resp.Proto, resp.Status)
+		writeHeaders(&b, resp.Header)
+		if len(respBody) > 0 {
+			fmt.Fprintf(&b, "\n%s\n", bytes.TrimSpace(respBody))
+		}
+	}
+	b.WriteString("\n")
+
+	text := redact(ctx, b.String())
+	c.dumpMu.Lock()
+	defer c.dumpMu.Unlock()
+	if _, err := io.WriteString(c.DebugDump, text); err != nil {
+		LoggerOr(c.Logger).Warn("failed to write debug dump", "error", err)
+	}
+}
+
+// writeHeaders writes h sorted by name, with credentials redacted.
+func writeHeaders(w io.Writer, h http.Header) {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, v := range h[name] {
+			if redactedHeaders[http.CanonicalHeaderKey(name)] {
+				v = Redacted
+			}
+			fmt.Fprintf(w, "%s: %s\n", name, v)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package flow
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestDebugDump(t *testing.T) {
+	const token = "dump-test-token-1234"
+	big := strings.Repeat("x", 4096)
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		down     bool
+		ctx      context.Context
+		want     []string
+		wantNone bool
+	}{
+		{name: "success not dumped", status: http.StatusOK, body: `{}`, wantNone: true},
+		{
+			name: "failed request", status: http.StatusUnprocessableEntity, body: `{"message": "bad input"}`,
+			want: []string{"--- nodeprop: failed GitHub request", "GET ", "HTTP/1.1 422", `{"message": "bad input"}`, "Authorization: " + Redacted, "Set-Cookie: " + Redacted, "X-Request-Id: r-1"},
+		},
+		{
+			name: "correlation id", status: http.StatusNotFound, ctx: WithCorrelationID(context.Background(), "rollout-7"),
+			want: []string{"(correlation ID rollout-7)"},
+		},
+		{name: "long body kept", status: http.StatusBadGateway, body: big, want: []string{big}},
+		{name: "transport error", down: true, want: []string{"error: "}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Set-Cookie", "session=abc")
+				w.Header().Set("X-Request-Id", "r-1")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+			if tt.down {
+				srv.Close()
+			}
+			c := NewGitHubClient(token)
+			c.BaseURL = srv.URL
+			var dump bytes.Buffer
+			c.DebugDump = &dump
+			ctx := tt.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+
+			err := c.do(ctx, "GET", "/repos/o/r", nil, nil)
+			if tt.wantNone {
+				if err != nil || dump.Len() != 0 {
+					t.Fatalf("do() = %v and dumped %q, want no dump", err, dump.String())
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("do() succeeded")
+			}
+			var apiErr *APIError
+			if errors.As(err, &apiErr) && len(apiErr.Body) > 1024 {
+				t.Errorf("APIError body is %d bytes, want at most 1024", len(apiErr.Body))
+			}
+			got := dump.String()
+			if strings.Contains(got, token) {
+				t.Errorf("dump holds the token:\n%s", got)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(got, w) {
+					t.Errorf("dump lacks %q:\n%s", w, got)
+				}
+			}
+		})
+	}
+}
+
+func TestDebugDumpWriteError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	c := NewGitHubClient("")
+	c.BaseURL = srv.URL
+	c.DebugDump = failingWriter{}
+	var logs bytes.Buffer
+	c.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+	var apiErr *APIError
+	if err := c.do(context.Background(), "GET", "/repos/o/r", nil, nil); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("do() error = %v, want the API error despite the failed dump", err)
+	}
+	if !strings.Contains(logs.String(), "failed to write debug dump") {
+		t.Errorf("logs = %q, want the dump failure", logs.String())
+	}
+}
@@ -0,0 +1,239 @@
+package flow
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// maxPooledBuffer bounds the buffers kept for reuse, so one large payload
+// does not pin its memory.
+const maxPooledBuffer = 64 << 10
+
+// bufferPool holds the buffers payloads are encoded in.
+var bufferPool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBuffer {
+		bufferPool.Put(buf)
+	}
+}
+
+// jsonWriter is a payload that encodes itself without reflection.
+type jsonWriter interface {
+	writeJSON(buf *bytes.Buffer)
+}
+
+// encodeJSON writes v to buf as json.Marshal would, without the newline
+// json.Encoder adds.
+func encodeJSON(buf *bytes.Buffer, v interface{}) error {
+	if w, ok := v.(jsonWriter); ok {
+		w.writeJSON(buf)
+		return nil
+	}
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		return err
+	}
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
+
+// dispatchPayload is the body of a workflow_dispatch.
+type dispatchPayload struct {
+	Ref    string
+	Inputs map[string]string
+}
+
+// writeJSON writes p as json.Marshal writes the equivalent map, keys in
+// order.
+func (p dispatchPayload) writeJSON(buf *bytes.Buffer) {
+	buf.WriteString(`{"inputs":`)
+	writeInputs(buf, p.Inputs)
+	buf.WriteString(`,"ref":`)
+	writeJSONString(buf, p.Ref)
+	buf.WriteByte('}')
+}
+
+// writeInputs writes inputs as json.Marshal would: null if nil, else an
+// object with sorted keys.
+func writeInputs(buf *bytes.Buffer, inputs map[string]string) {
+	if inputs == nil {
+		buf.WriteString("null")
+		return
+	}
+	// Dispatches rarely have more inputs than GitHub allows, so the keys
+	// usually fit on the stack.
+	var stack [MaxInputs]string
+	keys := stack[:0]
+	for k := range inputs {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	buf.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		writeJSONString(buf, k)
+		buf.WriteByte(':')
+		writeJSONString(buf, inputs[k])
+	}
+	buf.WriteByte('}')
+}
+
+const hexDigits = "0123456789abcdef"
+
+// writeJSONString writes s as a JSON string escaped as json.Marshal
+// escapes it, including <, >, and & for HTML and invalid UTF-8 as U+FFFD.
+func writeJSONString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+				continue
+			}
+			buf.WriteString(s[start:i])
+			switch c {
+			case '"', '\\':
+				buf.WriteByte('\\')
+				buf.WriteByte(c)
+			case '\b':
+				buf.WriteString(`\b`)
+			case '\f':
+				buf.WriteString(`\f`)
+			case '\n':
+				buf.WriteString(`\n`)
+			case '\r':
+				buf.WriteString(`\r`)
+			case '\t':
+				buf.WriteString(`\t`)
+			default:
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hexDigits[c>>4])
+				buf.WriteByte(hexDigits[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			buf.WriteString(s[start:i])
+			buf.WriteRune(utf8.RuneError)
+		case r == '\u2028' || r == '\u2029':
+			buf.WriteString(s[start:i])
+			buf.WriteString(`\u202`)
+			buf.WriteByte(hexDigits[r&0xf])
+		default:
+			i += size
+			continue
+		}
+		i += size
+		start = i
+	}
+	buf.WriteString(s[start:])
+	buf.WriteByte('"')
+}
+
+// jsonBody is a request payload encoded in a pooled buffer. A transport
+// may still be sending a body after Client.Do returns, so the buffer goes
+// back to the pool only once the sender has called release and the
+// transport has closed every body read from it.
+type jsonBody struct {
+	buf  *bytes.Buffer
+	refs atomic.Int32
+}
+
+// newJSONBody encodes v in a pooled buffer.
+func newJSONBody(v interface{}) (*jsonBody, error) {
+	buf := getBuffer()
+	if err := encodeJSON(buf, v); err != nil {
+		putBuffer(buf)
+		return nil, err
+	}
+	b := &jsonBody{buf: buf}
+	b.refs.Store(1)
+	return b, nil
+}
+
+// Bytes returns the payload. It is valid until release.
+func (b *jsonBody) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+// attach makes b the body of req, including for redirects and retries.
+func (b *jsonBody) attach(req *http.Request) {
+	req.Body = b.reader()
+	req.ContentLength = int64(b.buf.Len())
+	req.GetBody = func() (io.ReadCloser, error) { return b.reader(), nil }
+}
+
+// release drops the sender's reference.
+func (b *jsonBody) release() {
+	if b.refs.Add(-1) == 0 {
+		putBuffer(b.buf)
+	}
+}
+
+func (b *jsonBody) reader() io.ReadCloser {
+	b.refs.Add(1)
+	return &bodyReader{Reader: bytes.NewReader(b.buf.Bytes()), body: b}
+}
+
+// bodyReader reads a jsonBody and drops its reference when closed.
+type bodyReader struct {
+	*bytes.Reader
+	body *jsonBody
+	once sync.Once
+}
+
+func (r *bodyReader) Close() error {
+	r.once.Do(r.body.release)
+	return nil
+}
+
+// streamedJSON is a request payload encoded while it is sent rather than
+// up front, for payloads that may be large, such as a repository_dispatch
+// client_payload, so they are not held in memory whole. The request is
+// sent chunked and a debug dump omits its body.
+type streamedJSON struct {
+	v interface{}
+}
+
+// attach makes s the body of req, including for redirects and retries.
+func (s streamedJSON) attach(req *http.Request) {
+	req.Body = s.reader()
+	req.ContentLength = -1
+	req.GetBody = func() (io.ReadCloser, error) { return s.reader(), nil }
+}
+
+// reader encodes s on a goroutine as it is read. Closing the reader early
+// stops the encoding.
+func (s streamedJSON) reader() io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		w := bufio.NewWriterSize(pw, 32<<10)
+		err := json.NewEncoder(w).Encode(s.v)
+		if err == nil {
+			err = w.Flush()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
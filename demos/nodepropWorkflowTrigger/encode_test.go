@@ -0,0 +1,167 @@
+package flow
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestWriteJSONString(t *testing.T) {
+	tests := []string{
+		"",
+		"plain",
+		`say "hi" \ there`,
+		"tab\tnew\nline\rfeed\fback\b",
+		"nul\x00 bell\x07 esc\x1b del\x7f",
+		"<script>&amp;</script>",
+		"héllo ✓ 世界 🚀",
+		"bad \xff\xfe utf-8",
+		"truncated \xe2\x82",
+		"line\u2028para\u2029sep",
+	}
+	for _, s := range tests {
+		t.Run(fmt.Sprintf("%q", s), func(t *testing.T) {
+			want, _ := json.Marshal(s)
+			var buf bytes.Buffer
+			writeJSONString(&buf, s)
+			if buf.String() != string(want) {
+				t.Errorf("writeJSONString() = %s, want %s", buf.String(), want)
+			}
+		})
+	}
+}
+
+func TestDispatchPayloadJSON(t *testing.T) {
+	many := map[string]string{}
+	for i := range MaxInputs + 5 {
+		many[fmt.Sprintf("input_%02d", i)] = fmt.Sprint(i)
+	}
+	tests := []struct {
+		name   string
+		ref    string
+		inputs map[string]string
+	}{
+		{name: "nil inputs", ref: "main"},
+		{name: "empty inputs", ref: "main", inputs: map[string]string{}},
+		{name: "sorted", ref: "refs/tags/v1.0", inputs: map[string]string{"z": "1", "a": "2", "m": `"q"`}},
+		{name: "more than MaxInputs", ref: "main", inputs: many},
+		{name: "escaped", ref: "feature/<x>", inputs: map[string]string{"html": "<&>", "lines": "a\nb"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, _ := json.Marshal(map[string]interface{}{"ref": tt.ref, "inputs": tt.inputs})
+			var buf bytes.Buffer
+			if err := encodeJSON(&buf, dispatchPayload{Ref: tt.ref, Inputs: tt.inputs}); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != string(want) {
+				t.Errorf("encodeJSON() = %s, want %s", buf.String(), want)
+			}
+		})
+	}
+}
+
+func TestEncodeJSONFallback(t *testing.T) {
+	tests := []struct {
+		v       interface{}
+		wantErr bool
+	}{
+		{v: map[string]interface{}{"event_type": "release", "client_payload": map[string]int{"n": 1}}},
+		{v: []string{"<a>"}},
+		{v: nil},
+		{v: make(chan int), wantErr: true},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		err := encodeJSON(&buf, tt.v)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("encodeJSON(%T) succeeded", tt.v)
+			}
+			continue
+		}
+		want, _ := json.Marshal(tt.v)
+		if err != nil || buf.String() != string(want) {
+			t.Errorf("encodeJSON(%v) = %s, %v; want %s without a newline", tt.v, buf.String(), err, want)
+		}
+	}
+}
+
+func TestJSONBodyReferences(t *testing.T) {
+	b, err := newJSONBody(dispatchPayload{Ref: "main", Inputs: map[string]string{"env": "prod"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"inputs":{"env":"prod"},"ref":"main"}`
+	req, _ := http.NewRequest("POST", "http://example.com", nil)
+	b.attach(req)
+	if req.ContentLength != int64(len(want)) {
+		t.Errorf("ContentLength = %d, want %d", req.ContentLength, len(want))
+	}
+	// A retry reads the body again while the first read is still open.
+	again, _ := req.GetBody()
+	for _, r := range []io.ReadCloser{req.Body, again} {
+		if got, _ := io.ReadAll(r); string(got) != want {
+			t.Errorf("body = %s, want %s", got, want)
+		}
+	}
+	steps := []struct {
+		name     string
+		do       func()
+		wantRefs int32
+	}{
+		{name: "sender released", do: b.release, wantRefs: 2},
+		{name: "first body closed", do: func() { req.Body.Close() }, wantRefs: 1},
+		{name: "closed twice", do: func() { req.Body.Close() }, wantRefs: 1},
+		{name: "retry closed", do: func() { again.Close() }, wantRefs: 0},
+	}
+	for _, s := range steps {
+		s.do()
+		if got := b.refs.Load(); got != s.wantRefs {
+			t.Errorf("after %s, %d references, want %d", s.name, got, s.wantRefs)
+		}
+	}
+}
+
+func TestPutBufferDropsLarge(t *testing.T) {
+	large := bytes.NewBuffer(make([]byte, 0, maxPooledBuffer+1))
+	putBuffer(large)
+	for range 10 {
+		if buf := getBuffer(); buf == large {
+			t.Fatal("a buffer larger than maxPooledBuffer was pooled")
+		}
+	}
+	if buf := getBuffer(); buf.Len() != 0 {
+		t.Errorf("getBuffer() returned %d bytes, want a reset buffer", buf.Len())
+	}
+}
+
+func TestStreamedJSON(t *testing.T) {
+	payload := map[string]interface{}{"event_type": "release", "client_payload": map[string]string{"notes": strings.Repeat("x", 100<<10)}}
+	want, _ := json.Marshal(payload)
+	req, _ := http.NewRequest("POST", "http://example.com", nil)
+	streamedJSON{payload}.attach(req)
+	if req.ContentLength != -1 {
+		t.Errorf("ContentLength = %d, want chunked", req.ContentLength)
+	}
+	got, err := io.ReadAll(req.Body)
+	if err != nil || !bytes.Equal(bytes.TrimSuffix(got, []byte("\n")), want) {
+		t.Errorf("streamed body = %d bytes, %v; want %d", len(got), err, len(want))
+	}
+	// Closing early stops the encoder instead of leaving it blocked.
+	again, _ := req.GetBody()
+	io.ReadFull(again, make([]byte, 10))
+	if err := again.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+
+	bad, _ := http.NewRequest("POST", "http://example.com", nil)
+	streamedJSON{make(chan int)}.attach(bad)
+	if _, err := io.ReadAll(bad.Body); err == nil {
+		t.Error("reading an unencodable payload succeeded")
+	}
+}
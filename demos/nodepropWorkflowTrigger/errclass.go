@@ -0,0 +1,73 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Error classes returned by ErrorClass.
+const (
+	ErrorNetwork      = "network"
+	ErrorCancelled    = "cancelled"
+	ErrorRateLimited  = "rate_limited"
+	ErrorUnauthorized = "unauthorized"
+	ErrorNotFound     = "not_found"
+	ErrorInvalid      = "invalid"
+	ErrorClient       = "client"
+	ErrorServer       = "server"
+)
+
+// ErrorClasses lists every class ErrorClass returns.
+var ErrorClasses = []string{ErrorNetwork, ErrorCancelled, ErrorRateLimited, ErrorUnauthorized, ErrorNotFound, ErrorInvalid, ErrorClient, ErrorServer}
+
+// ErrorClass classifies a dispatch error for retries, metrics, and alerts:
+// network, cancelled, rate_limited, unauthorized, not_found (a 404 or an
+// unregistered trigger), invalid (a 422, e.g. an unknown input, or a
+// *ParamError), client (another 4xx), or server (a 5xx).
+func ErrorClass(err error) string {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return ErrorCancelled
+	}
+	var paramErr *ParamError
+	if errors.As(err, &paramErr) {
+		return ErrorInvalid
+	}
+	if errors.Is(err, ErrNotRegistered) {
+		return ErrorNotFound
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return ErrorNetwork
+	}
+	switch code := apiErr.StatusCode; {
+	case code == http.StatusTooManyRequests || code == http.StatusForbidden && isRateLimitBody(apiErr.Body):
+		return ErrorRateLimited
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return ErrorUnauthorized
+	case code == http.StatusNotFound:
+		return ErrorNotFound
+	case code == http.StatusUnprocessableEntity:
+		return ErrorInvalid
+	case code >= 500:
+		return ErrorServer
+	}
+	return ErrorClient
+}
+
+// Transient reports whether errors of class may succeed if retried as they
+// are: network failures, rate limiting, and 5xx responses.
+func Transient(class string) bool {
+	switch class {
+	case ErrorNetwork, ErrorRateLimited, ErrorServer:
+		return true
+	}
+	return false
+}
+
+// isRateLimitBody reports whether a 403 body is GitHub's rate-limit
+// message rather than a permission error.
+func isRateLimitBody(body string) bool {
+	return strings.Contains(strings.ToLower(body), "rate limit")
+}
@@ -0,0 +1,58 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "connection refused", err: errors.New("dial tcp: connection refused"), want: ErrorNetwork},
+		{name: "cancelled", err: fmt.Errorf("dispatch: %w", context.Canceled), want: ErrorCancelled},
+		{name: "deadline", err: context.DeadlineExceeded, want: ErrorCancelled},
+		{name: "param error", err: &ParamError{Key: "-x", Reason: "bad"}, want: ErrorInvalid},
+		{name: "not registered", err: fmt.Errorf("o/r: %w", ErrNotRegistered), want: ErrorNotFound},
+		{name: "429", err: &APIError{StatusCode: http.StatusTooManyRequests}, want: ErrorRateLimited},
+		{name: "403 rate limit", err: &APIError{StatusCode: http.StatusForbidden, Body: `{"message": "API Rate Limit exceeded"}`}, want: ErrorRateLimited},
+		{name: "403", err: &APIError{StatusCode: http.StatusForbidden, Body: `{"message": "Resource not accessible"}`}, want: ErrorUnauthorized},
+		{name: "401", err: &APIError{StatusCode: http.StatusUnauthorized}, want: ErrorUnauthorized},
+		{name: "404", err: &APIError{StatusCode: http.StatusNotFound}, want: ErrorNotFound},
+		{name: "422", err: &APIError{StatusCode: http.StatusUnprocessableEntity}, want: ErrorInvalid},
+		{name: "409", err: &APIError{StatusCode: http.StatusConflict}, want: ErrorClient},
+		{name: "502 wrapped", err: fmt.Errorf("dispatch: %w", &APIError{StatusCode: http.StatusBadGateway}), want: ErrorServer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ErrorClass(tt.err)
+			if got != tt.want {
+				t.Errorf("ErrorClass() = %s, want %s", got, tt.want)
+			}
+			found := false
+			for _, c := range ErrorClasses {
+				found = found || c == got
+			}
+			if !found {
+				t.Errorf("ErrorClasses lacks %s", got)
+			}
+		})
+	}
+}
+
+func TestTransient(t *testing.T) {
+	want := map[string]bool{ErrorNetwork: true, ErrorRateLimited: true, ErrorServer: true}
+	for _, class := range ErrorClasses {
+		if got := Transient(class); got != want[class] {
+			t.Errorf("Transient(%s) = %v, want %v", class, got, want[class])
+		}
+	}
+	if Transient("unknown") {
+		t.Error("Transient(unknown) = true")
+	}
+}
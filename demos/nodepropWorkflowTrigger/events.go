@@ -0,0 +1,103 @@
+package flow
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType identifies a stage in a dispatch's lifecycle.
+type EventType string
+
+const (
+	// EventQueued is published when a dispatch is about to be sent. It is
+	// followed by EventDispatched or EventFailed.
+	EventQueued       EventType = "queued"
+	EventDispatched   EventType = "dispatched"
+	EventFailed       EventType = "failed"
+	EventRunStarted   EventType = "run_started"
+	EventRunUpdated   EventType = "run_updated"
+	EventRunCompleted EventType = "run_completed"
+	EventCancelled    EventType = "cancelled"
+	// EventApprovalRequested is published when a dispatch is held for
+	// approval, and EventApproved or EventRejected when it is decided.
+	EventApprovalRequested EventType = "approval_requested"
+	EventApproved          EventType = "approved"
+	EventRejected          EventType = "rejected"
+	// EventFanOutCompleted is published when every dispatch of a fan-out
+	// rule has been submitted; Status counts the outcomes.
+	EventFanOutCompleted EventType = "fanout_completed"
+	// EventFlowStepFailed is sent for a flow step that failed for good and
+	// asks to notify; Actor is flow:NAME and Status names the step.
+	EventFlowStepFailed EventType = "flow_step_failed"
+)
+
+// Event is published on an EventBus as dispatches progress.
+type Event struct {
+	Type       EventType `json:"type"`
+	DispatchID string    `json:"dispatch_id,omitempty"`
+	Repo       string    `json:"repo"`
+	Workflow   string    `json:"workflow,omitempty"`
+	RunID      int64     `json:"run_id,omitempty"`
+	RunURL     string    `json:"run_url,omitempty"`
+	Status     string    `json:"status,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	ApprovalID string    `json:"approval_id,omitempty"`
+	// CorrelationID names the operation the dispatch or approval belongs
+	// to.
+	CorrelationID string `json:"correlation_id,omitempty"`
+	// Actor is who requested or decided an approval, or the rule that
+	// fanned out.
+	Actor string    `json:"actor,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+// EventBus fans events out to subscribers. Slow subscribers miss events
+// rather than block publishers.
+type EventBus struct {
+	mu   sync.RWMutex
+	subs map[chan Event]struct{}
+}
+
+// NewEventBus creates an EventBus with no subscribers.
+func NewEventBus() *EventBus {
+	return &EventBus{subs: make(map[chan Event]struct{})}
+}
+
+// Subscribe returns a channel receiving future events and a function that
+// unsubscribes and closes it.
+func (b *EventBus) Subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Publish delivers e to every subscriber with room in its buffer, with
+// Secrets redacted from its Error and Status. A nil bus discards events.
+func (b *EventBus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	e.Error, e.Status = Secrets.Redact(e.Error), Secrets.Redact(e.Status)
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package flow
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventBus(t *testing.T) {
+	b := NewEventBus()
+	first, unsubscribe := b.Subscribe(1)
+	second, unsubscribeSecond := b.Subscribe(1)
+	defer unsubscribeSecond()
+
+	Secrets.Add("event-bus-secret")
+	defer Secrets.Remove("event-bus-secret")
+	b.Publish(Event{Type: EventFailed, Repo: "o/r", Error: "bad token event-bus-secret"})
+	// Both buffers are full, so this is dropped rather than blocking.
+	b.Publish(Event{Type: EventDispatched, Repo: "o/r"})
+
+	for name, ch := range map[string]<-chan Event{"first": first, "second": second} {
+		select {
+		case e := <-ch:
+			if e.Type != EventFailed || e.Time.IsZero() || e.Error != "bad token "+Redacted {
+				t.Errorf("%s received %+v, want the failure, timestamped and redacted", name, e)
+			}
+		default:
+			t.Fatalf("%s received nothing", name)
+		}
+		select {
+		case e := <-ch:
+			t.Errorf("%s received %+v past its buffer", name, e)
+		default:
+		}
+	}
+
+	unsubscribe()
+	unsubscribe()
+	if _, ok := <-first; ok {
+		t.Error("unsubscribed channel is still open")
+	}
+	at := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	b.Publish(Event{Type: EventRunCompleted, Time: at})
+	if e := <-second; !e.Time.Equal(at) {
+		t.Errorf("Publish() replaced the event time %v with %v", at, e.Time)
+	}
+
+	var nilBus *EventBus
+	nilBus.Publish(Event{Type: EventQueued})
+}
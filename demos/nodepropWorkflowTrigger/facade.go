@@ -1,38 +1,50 @@
 package flow
 
-// FlowFacade defines the facade interface.
+import (
+	"context"
+	"fmt"
+)
+
+// FlowFacade defines the facade interface. Every method takes the caller's
+// context and passes it down to the triggers, so cancelling it or its
+// deadline stops the flows it started, and its trace spans the dispatches.
 type FlowFacade interface {
-	RegisterRepo(repo string, actions []string, workflows []string) error
-	TriggerRepoFlows(repo string, token string) error
-	TriggerCustomFlow(repo string, flowType string, name string, token string, params map[string]string) error
+	RegisterRepo(ctx context.Context, repo string, actions []string, workflows []string) error
+	TriggerRepoFlows(ctx context.Context, repo string, token string) error
+	TriggerCustomFlow(ctx context.Context, repo string, flowType string, name string, token string, params map[string]string) error
 }
 
 type flowFacadeImpl struct {
-	triggerManager *flow.TriggerManager
-	repoRegistry   *flow.RepositoryRegistry
+	triggerManager *TriggerManager
+	repoRegistry   *RepositoryRegistry
 }
 
-// NewFlowFacade creates a new FlowFacade.
-func NewFlowFacade(triggerManager *flow.TriggerManager, repoRegistry *flow.RepositoryRegistry) FlowFacade {
+// NewFlowFacade creates a new FlowFacade. It logs through the trigger
+// manager's Logger.
+func NewFlowFacade(triggerManager *TriggerManager, repoRegistry *RepositoryRegistry) FlowFacade {
 	return &flowFacadeImpl{triggerManager: triggerManager, repoRegistry: repoRegistry}
 }
 
-func (f *flowFacadeImpl) RegisterRepo(repo string, actions []string, workflows []string) error {
+func (f *flowFacadeImpl) RegisterRepo(ctx context.Context, repo string, actions []string, workflows []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	f.repoRegistry.RegisterRepo(repo, actions, workflows)
 	return nil
 }
 
-func (f *flowFacadeImpl) TriggerRepoFlows(repo string, token string) error {
-	return f.repoRegistry.TriggerForRepo(repo, f.triggerManager, token)
+func (f *flowFacadeImpl) TriggerRepoFlows(ctx context.Context, repo string, token string) error {
+	return f.repoRegistry.TriggerForRepoContext(ctx, repo, f.triggerManager, token)
 }
 
-func (f *flowFacadeImpl) TriggerCustomFlow(repo string, flowType string, name string, token string, params map[string]string) error {
+func (f *flowFacadeImpl) TriggerCustomFlow(ctx context.Context, repo string, flowType string, name string, token string, params map[string]string) error {
 	switch flowType {
 	case "action":
-		return f.triggerManager.ExecuteAction(name, repo, token, params)
+		return f.triggerManager.ExecuteActionContext(ctx, name, repo, token, params)
 	case "workflow":
-		return f.triggerManager.ExecuteWorkflow(name, repo, token, params)
+		return f.triggerManager.ExecuteWorkflowContext(ctx, name, repo, token, params)
 	default:
-		return fmt.Errorf("invalid flow type: %s", flowType)
+		LoggerOr(f.triggerManager.Logger).Warn("invalid flow type", "repo", repo, "flow_type", flowType, "name", name)
+		return &DispatchError{Target: repo, Trigger: name, Err: fmt.Errorf("invalid flow type: %s", flowType)}
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,102 @@
+package flow_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+func TestActorRunCustomFlow(t *testing.T) {
+	errBoom := errors.New("boom")
+	tests := []struct {
+		name     string
+		flowType string
+		flow     string
+		fail     error
+		wantErr  error
+		// called is the kind of trigger that should run, if any.
+		called string
+	}{
+		{name: "workflow", flowType: "workflow", flow: "deploy", called: "workflow"},
+		{name: "action", flowType: "action", flow: "notify", called: "action"},
+		{name: "unregistered workflow", flowType: "workflow", flow: "missing", wantErr: flow.ErrNotRegistered},
+		{name: "unregistered action", flowType: "action", flow: "deploy", wantErr: flow.ErrNotRegistered},
+		{name: "invalid flow type", flowType: "job", flow: "deploy"},
+		{name: "trigger fails", flowType: "workflow", flow: "deploy", fail: errBoom, wantErr: errBoom, called: "workflow"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workflow := &nodeproptest.MockTrigger{Err: tt.fail}
+			action := &nodeproptest.MockTrigger{Err: tt.fail}
+			tm := flow.NewTriggerManager()
+			tm.RegisterWorkflow("deploy", workflow)
+			tm.RegisterAction("notify", action)
+			actor := flow.NewActor(flow.NewFlowFacade(tm, flow.NewRepositoryRegistry()))
+
+			params := map[string]string{"env": "prod"}
+			err := actor.RunCustomFlow(context.Background(), "Cdaprod/site", tt.flowType, tt.flow, "token", params)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("RunCustomFlow() error = %v, want %v", err, tt.wantErr)
+				}
+			case tt.called == "":
+				if err == nil {
+					t.Errorf("RunCustomFlow() succeeded, want an error")
+				}
+			case err != nil:
+				t.Errorf("RunCustomFlow() error = %v", err)
+			}
+			var de *flow.DispatchError
+			if err != nil && !errors.As(err, &de) {
+				t.Errorf("RunCustomFlow() error %T is not a *flow.DispatchError", err)
+			}
+
+			for kind, mock := range map[string]*nodeproptest.MockTrigger{"workflow": workflow, "action": action} {
+				if tt.called == kind {
+					mock.AssertCalled(t, "Cdaprod/site", params)
+					mock.AssertToken(t, "token")
+				} else {
+					mock.AssertCallCount(t, 0)
+				}
+			}
+		})
+	}
+}
+
+func TestActorRunRepoFlows(t *testing.T) {
+	deploy := &nodeproptest.MockTrigger{}
+	notify := &nodeproptest.MockTrigger{}
+	tm := flow.NewTriggerManager()
+	tm.RegisterWorkflow("deploy", deploy)
+	tm.RegisterAction("notify", notify)
+	actor := flow.NewActor(flow.NewFlowFacade(tm, flow.NewRepositoryRegistry()))
+	ctx := context.Background()
+
+	if err := actor.RunRepoFlows(ctx, "Cdaprod/site", "token"); err == nil {
+		t.Fatal("RunRepoFlows() of an unregistered repository succeeded")
+	}
+	if err := actor.RegisterRepo(ctx, "Cdaprod/site", []string{"notify"}, []string{"deploy", "missing"}); err != nil {
+		t.Fatal(err)
+	}
+	err := actor.RunRepoFlows(ctx, "Cdaprod/site", "token")
+	if !errors.Is(err, flow.ErrNotRegistered) {
+		t.Errorf("RunRepoFlows() error = %v, want the unregistered workflow", err)
+	}
+	deploy.AssertCalled(t, "Cdaprod/site", nil)
+	notify.AssertCalled(t, "Cdaprod/site", nil)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	deploy.Reset()
+	if err := actor.RunRepoFlows(cancelled, "Cdaprod/site", "token"); !errors.Is(err, context.Canceled) {
+		t.Errorf("RunRepoFlows() with a cancelled context error = %v", err)
+	}
+	deploy.AssertCallCount(t, 0)
+	if err := actor.RegisterRepo(cancelled, "Cdaprod/other", nil, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("RegisterRepo() with a cancelled context error = %v", err)
+	}
+}
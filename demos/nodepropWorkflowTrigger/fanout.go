@@ -0,0 +1,157 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultFanOutConcurrency bounds a fan-out that does not set Concurrency.
+const DefaultFanOutConcurrency = 4
+
+// FanOut is a RoutingRule action that dispatches to every registered
+// repository depending on the event's repository. Workflow, Ref, and Inputs
+// may use the same parameters as targets; without a Workflow each
+// dependent's registered workflows are dispatched.
+//
+//	# routes.yml
+//	- name: bump-dependents
+//	  events: [release]
+//	  actions: [published]
+//	  repo: Cdaprod/lib-*
+//	  fan_out:
+//	    workflow: update-dependency.yml
+//	    inputs:
+//	      library: ${event.repo}
+//	      version: ${payload.release.tag_name}
+//	    concurrency: 8
+type FanOut struct {
+	Workflow string            `yaml:"workflow,omitempty" json:"workflow,omitempty"`
+	Ref      string            `yaml:"ref,omitempty" json:"ref,omitempty"`
+	Inputs   map[string]string `yaml:"inputs,omitempty" json:"inputs,omitempty"`
+	// Concurrency bounds how many dispatches are in flight at once; it
+	// defaults to DefaultFanOutConcurrency.
+	Concurrency int `yaml:"concurrency,omitempty" json:"concurrency,omitempty"`
+}
+
+// FanOutResult aggregates the dispatches of one fan-out. Results keep
+// request order.
+type FanOutResult struct {
+	Rule    string
+	Source  string
+	Results []SubmitResult
+}
+
+// SubmitResult is the outcome of one submitted dispatch.
+type SubmitResult struct {
+	Request DispatchRequest
+	Record  *DispatchRecord
+	Err     error
+}
+
+// Counts returns how many dispatches were sent (or had been already), how
+// many are held for approval, and how many failed.
+func (r FanOutResult) Counts() (dispatched, held, failed int) {
+	for _, res := range r.Results {
+		var approval *ApprovalRequiredError
+		switch {
+		case res.Err == nil || errors.Is(res.Err, ErrAlreadyDispatched):
+			dispatched++
+		case errors.As(res.Err, &approval):
+			held++
+		default:
+			failed++
+		}
+	}
+	return dispatched, held, failed
+}
+
+// Summary describes the counts, e.g. "5 dispatched, 1 held, 2 failed".
+func (r FanOutResult) Summary() string {
+	dispatched, held, failed := r.Counts()
+	return fmt.Sprintf("%d dispatched, %d held, %d failed", dispatched, held, failed)
+}
+
+// Err joins the failures, or returns nil if there were none.
+func (r FanOutResult) Err() error {
+	var msgs []string
+	for _, res := range r.Results {
+		var approval *ApprovalRequiredError
+		if res.Err != nil && !errors.Is(res.Err, ErrAlreadyDispatched) && !errors.As(res.Err, &approval) {
+			msgs = append(msgs, fmt.Sprintf("%s %s: %v", res.Request.Repo, res.Request.Workflow, res.Err))
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(msgs, "; "))
+}
+
+// SubmitAll submits reqs on a pool of p.Concurrency workers and streams
+// each result as it finishes. Requests not started before ctx is done
+// fail with ctx.Err(). With c.Metadata set, the repositories of requests
+// without a ref are read first in batches.
+func (c *RunCorrelator) SubmitAll(ctx context.Context, p Parallelism, reqs []DispatchRequest) <-chan Completed[SubmitResult] {
+	if c.Metadata != nil {
+		var repos []string
+		for _, req := range reqs {
+			if req.Ref == "" {
+				repos = append(repos, req.Repo)
+			}
+		}
+		// Each submission looks its repository up again if this fails.
+		if err := c.Metadata.Prefetch(ctx, repos); err != nil {
+			LoggerOr(c.Logger).Warn("failed to prefetch repositories", "repos", len(repos), "error", err)
+		}
+	}
+	return Parallel(ctx, p, reqs, nil, func(ctx context.Context, req DispatchRequest) SubmitResult {
+		res := SubmitResult{Request: req}
+		if err := ctx.Err(); err != nil {
+			res.Err = err
+		} else {
+			res.Record, res.Err = c.Submit(ctx, req)
+		}
+		return res
+	})
+}
+
+// FanOut submits reqs with at most concurrency in flight, then publishes
+// EventFanOutCompleted with the aggregate result.
+func (c *RunCorrelator) FanOut(ctx context.Context, rule, source string, reqs []DispatchRequest, concurrency int) FanOutResult {
+	if concurrency < 1 {
+		concurrency = DefaultFanOutConcurrency
+	}
+	ctx, span := tracer(c.TracerProvider).Start(ctx, "nodeprop.fanout", trace.WithAttributes(
+		attribute.String("nodeprop.rule", rule),
+		attribute.String("nodeprop.source", source),
+		attribute.Int("nodeprop.dispatches", len(reqs)),
+	))
+	defer span.End()
+	// The fan-out is one operation, so its dispatches share a correlation
+	// ID unless the caller chose one for each.
+	if CorrelationID(ctx) == "" {
+		if id, err := NewCorrelationID(); err == nil {
+			ctx = WithCorrelationID(ctx, id)
+		}
+	}
+	span.SetAttributes(attribute.String("nodeprop.correlation_id", CorrelationID(ctx)))
+	result := FanOutResult{Rule: rule, Source: source, Results: make([]SubmitResult, len(reqs))}
+	for r := range c.SubmitAll(ctx, Parallelism{Concurrency: concurrency}, reqs) {
+		result.Results[r.Index] = r.Value
+	}
+
+	e := Event{Type: EventFanOutCompleted, CorrelationID: CorrelationID(ctx), Repo: source, Status: result.Summary(), Actor: "rule:" + rule, Time: time.Now().UTC()}
+	span.SetAttributes(attribute.String("nodeprop.summary", e.Status))
+	if err := result.Err(); err != nil {
+		e.Error = err.Error()
+		span.SetStatus(codes.Error, e.Error)
+	}
+	c.Events.Publish(e)
+	return result
+}
@@ -0,0 +1,181 @@
+package flow_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+func TestRouteFanOut(t *testing.T) {
+	release := flow.InboundEvent{
+		Type: "release", Repo: "Cdaprod/lib",
+		Payload: map[string]interface{}{"release": map[string]interface{}{"tag_name": "v2.0.0"}},
+	}
+	tests := []struct {
+		name    string
+		fanOut  flow.FanOut
+		deps    map[string][]string
+		want    []flow.RoutedDispatch
+		wantErr string
+	}{
+		{
+			name:   "workflow",
+			fanOut: flow.FanOut{Workflow: "bump.yml", Inputs: map[string]string{"version": "${payload.release.tag_name}"}, Concurrency: 8},
+			deps:   map[string][]string{"Cdaprod/api": {"ci.yml"}, "Cdaprod/web": nil},
+			want: []flow.RoutedDispatch{
+				{Rule: "bump", FanOut: 8, PlannedDispatch: flow.PlannedDispatch{Repo: "Cdaprod/api", Workflow: "bump.yml", Ref: "main", Inputs: map[string]string{"version": "v2.0.0"}, Source: "dependents:Cdaprod/lib"}},
+				{Rule: "bump", FanOut: 8, PlannedDispatch: flow.PlannedDispatch{Repo: "Cdaprod/web", Workflow: "bump.yml", Ref: "main", Inputs: map[string]string{"version": "v2.0.0"}, Source: "dependents:Cdaprod/lib"}},
+			},
+		},
+		{
+			name:   "registered workflows",
+			fanOut: flow.FanOut{Ref: "dev"},
+			deps:   map[string][]string{"Cdaprod/api": {"ci.yml", "e2e.yml"}},
+			want: []flow.RoutedDispatch{
+				{Rule: "bump", FanOut: flow.DefaultFanOutConcurrency, PlannedDispatch: flow.PlannedDispatch{Repo: "Cdaprod/api", Workflow: "ci.yml", Ref: "dev", Source: "dependents:Cdaprod/lib"}},
+				{Rule: "bump", FanOut: flow.DefaultFanOutConcurrency, PlannedDispatch: flow.PlannedDispatch{Repo: "Cdaprod/api", Workflow: "e2e.yml", Ref: "dev", Source: "dependents:Cdaprod/lib"}},
+			},
+		},
+		{name: "no dependents", fanOut: flow.FanOut{Workflow: "bump.yml"}},
+		{name: "no workflows", deps: map[string][]string{"Cdaprod/api": nil}, wantErr: "Cdaprod/api has no registered workflows"},
+		{name: "missing parameter", fanOut: flow.FanOut{Workflow: "${payload.nope}"}, deps: map[string][]string{"Cdaprod/api": nil}, wantErr: "is not set"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := flow.NewRepositoryRegistry()
+			reg.SetRepo(flow.RepoEntry{Name: "Cdaprod/lib", Workflows: []string{"release.yml"}})
+			for repo, workflows := range tt.deps {
+				reg.SetRepo(flow.RepoEntry{Name: repo, Workflows: workflows, DependsOn: []string{"Cdaprod/lib"}})
+			}
+			fanOut := tt.fanOut
+			router := &flow.EventRouter{Registry: reg, Rules: []flow.RoutingRule{{Name: "bump", Events: []string{"release"}, FanOut: &fanOut}}}
+
+			got, err := router.Route(release)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Route() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Route() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Route() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFanOutResult(t *testing.T) {
+	held := &flow.ApprovalRequiredError{Approval: flow.Approval{ID: "a-1", Repo: "o/c", Workflow: "ci.yml"}}
+	tests := []struct {
+		name    string
+		errs    []error
+		summary string
+		wantErr string
+	}{
+		{name: "empty", summary: "0 dispatched, 0 held, 0 failed"},
+		{name: "dispatched", errs: []error{nil, flow.ErrAlreadyDispatched}, summary: "2 dispatched, 0 held, 0 failed"},
+		{name: "held", errs: []error{nil, held}, summary: "1 dispatched, 1 held, 0 failed"},
+		{
+			name:    "failed",
+			errs:    []error{errors.New("boom"), held, context.Canceled},
+			summary: "0 dispatched, 1 held, 2 failed",
+			wantErr: "o/r0 ci.yml: boom; o/r2 ci.yml: context canceled",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r flow.FanOutResult
+			for i, err := range tt.errs {
+				r.Results = append(r.Results, flow.SubmitResult{Request: flow.DispatchRequest{Repo: "o/r" + string(rune('0'+i)), Workflow: "ci.yml"}, Err: err})
+			}
+			if got := r.Summary(); got != tt.summary {
+				t.Errorf("Summary() = %q, want %q", got, tt.summary)
+			}
+			err := r.Err()
+			if (err == nil) != (tt.wantErr == "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("Err() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCorrelatorFanOut(t *testing.T) {
+	gh := nodeproptest.NewServer()
+	defer gh.Close()
+	for _, repo := range []string{"Cdaprod/api", "Cdaprod/web", "Cdaprod/docs"} {
+		gh.AddWorkflow(repo, "bump.yml")
+	}
+	c := newCorrelator(t, gh)
+	c.Events = flow.NewEventBus()
+	events, unsubscribe := c.Events.Subscribe(16)
+	defer unsubscribe()
+
+	var reqs []flow.DispatchRequest
+	for _, repo := range []string{"Cdaprod/api", "Cdaprod/web", "Cdaprod/missing", "Cdaprod/docs"} {
+		reqs = append(reqs, flow.DispatchRequest{Repo: repo, Workflow: "bump.yml", Ref: "main"})
+	}
+	res := c.FanOut(context.Background(), "bump", "Cdaprod/lib", reqs, 2)
+
+	for i, r := range res.Results {
+		if r.Request.Repo != reqs[i].Repo {
+			t.Errorf("result %d is for %s, want request order", i, r.Request.Repo)
+		}
+	}
+	if got := res.Summary(); got != "3 dispatched, 0 held, 1 failed" {
+		t.Errorf("Summary() = %q", got)
+	}
+	ids := map[string]bool{}
+	for _, r := range res.Results {
+		if r.Record != nil {
+			ids[r.Record.CorrelationID] = true
+		}
+	}
+	if len(ids) != 1 {
+		t.Errorf("dispatches have correlation IDs %v, want one shared", ids)
+	}
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e := <-events:
+			if e.Type != flow.EventFanOutCompleted {
+				continue
+			}
+			if e.Actor != "rule:bump" || e.Repo != "Cdaprod/lib" || e.Status != res.Summary() || !strings.Contains(e.Error, "Cdaprod/missing") || !ids[e.CorrelationID] {
+				t.Errorf("fan-out event = %+v", e)
+			}
+			return
+		case <-timeout:
+			t.Fatal("no fan-out event published")
+		}
+	}
+}
+
+func TestSubmitAllCancelled(t *testing.T) {
+	gh := nodeproptest.NewServer()
+	defer gh.Close()
+	gh.AddWorkflow("Cdaprod/api", "bump.yml")
+	c := newCorrelator(t, gh)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var errs []error
+	for r := range c.SubmitAll(ctx, flow.Parallelism{Concurrency: 1}, []flow.DispatchRequest{{Repo: "Cdaprod/api", Workflow: "bump.yml", Ref: "main"}}) {
+		errs = append(errs, r.Value.Err)
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], context.Canceled) {
+		t.Errorf("SubmitAll() errors = %v, want context.Canceled", errs)
+	}
+	if n := len(gh.Dispatches()); n != 0 {
+		t.Errorf("%d dispatches sent after cancellation", n)
+	}
+}
@@ -1,145 +1,157 @@
 package flow
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"net/http"
 	"sync"
+	"sync/atomic"
 )
 
-// WorkflowTrigger defines the interface for triggering workflows.
-type WorkflowTrigger interface {
-	Trigger(target string, params map[string]string, authToken string) error
+// TriggerManager handles actions and workflows. Lookups read an immutable
+// snapshot of the registrations without locking, so executions fanned out
+// over many goroutines do not contend with each other or wait behind
+// registrations; a registration copies the snapshot and swaps it in. The
+// zero value is ready to use.
+type TriggerManager struct {
+	// Logger receives executions and their failures; nil means
+	// slog.Default(). The facade logs through it too.
+	Logger Logger
+	// mu serializes registrations.
+	mu       sync.Mutex
+	triggers atomic.Pointer[triggerSet]
 }
 
-// TriggerManager handles actions and workflows.
-type TriggerManager struct {
-	Actions   map[string]ActionTrigger
-	Workflows map[string]WorkflowTrigger
-	mu        sync.Mutex
+// triggerSet is a snapshot of a TriggerManager's registrations. It is never
+// modified once published.
+type triggerSet struct {
+	actions   map[string]Trigger
+	workflows map[string]Trigger
 }
 
 var instance *TriggerManager
 var once sync.Once
 
 // GetTriggerManager returns a singleton instance of TriggerManager.
+// Programs that keep triggers apart, e.g. per organization, create
+// managers with NewTriggerManager or a ShardedTriggerManager instead.
 func GetTriggerManager() *TriggerManager {
 	once.Do(func() {
-		instance = &TriggerManager{
-			Actions:   make(map[string]ActionTrigger),
-			Workflows: make(map[string]WorkflowTrigger),
-		}
+		instance = NewTriggerManager()
 	})
 	return instance
 }
 
-// RegisterAction registers a new action trigger.
-func (tm *TriggerManager) RegisterAction(name string, trigger ActionTrigger) {
-	tm.mu.Lock()
-	defer tm.mu.Unlock()
-	tm.Actions[name] = trigger
+// NewTriggerManager creates a TriggerManager with no triggers.
+func NewTriggerManager() *TriggerManager {
+	return &TriggerManager{}
 }
 
-// RegisterWorkflow registers a new workflow trigger.
-func (tm *TriggerManager) RegisterWorkflow(name string, trigger WorkflowTrigger) {
-	tm.mu.Lock()
-	defer tm.mu.Unlock()
-	tm.Workflows[name] = trigger
+// RegisterAction registers a new action trigger, such as a
+// GitHubRepoDispatch.
+func (tm *TriggerManager) RegisterAction(name string, trigger Trigger) {
+	tm.update(func(s *triggerSet) { s.actions[name] = trigger })
 }
 
-// ExecuteAction executes a registered action.
-func (tm *TriggerManager) ExecuteAction(name, target, token string, params map[string]string) error {
-	tm.mu.Lock()
-	trigger, exists := tm.Actions[name]
-	tm.mu.Unlock()
-
-	if !exists {
-		return fmt.Errorf("action %s not registered", name)
-	}
-	return trigger.Trigger(target, params, token)
+// RegisterWorkflow registers a new workflow trigger, such as a
+// GitHubWorkflowDispatch.
+func (tm *TriggerManager) RegisterWorkflow(name string, trigger Trigger) {
+	tm.update(func(s *triggerSet) { s.workflows[name] = trigger })
 }
 
-// ExecuteWorkflow executes a registered workflow.
-func (tm *TriggerManager) ExecuteWorkflow(name, target, token string, params map[string]string) error {
-	tm.mu.Lock()
-	trigger, exists := tm.Workflows[name]
-	tm.mu.Unlock()
+// Action returns the action trigger registered as name.
+func (tm *TriggerManager) Action(name string) (Trigger, bool) {
+	t, ok := tm.snapshot().actions[name]
+	return t, ok
+}
 
-	if !exists {
-		return fmt.Errorf("workflow %s not registered", name)
-	}
-	return trigger.Trigger(target, params, token)
+// Workflow returns the workflow trigger registered as name.
+func (tm *TriggerManager) Workflow(name string) (Trigger, bool) {
+	t, ok := tm.snapshot().workflows[name]
+	return t, ok
 }
 
-// ActionTrigger represents a trigger for GitHub Actions.
-type ActionTrigger struct {
-	ActionName string
-	Ref        string
+// snapshot returns the current registrations, which may be empty.
+func (tm *TriggerManager) snapshot() *triggerSet {
+	if s := tm.triggers.Load(); s != nil {
+		return s
+	}
+	return &triggerSet{}
 }
 
-func (a *ActionTrigger) Trigger(target string, params map[string]string, authToken string) error {
-	url := fmt.Sprintf("https://api.github.com/repos/%s/dispatches", a.ActionName)
-	payload := map[string]interface{}{
-		"ref":    a.Ref,
-		"inputs": params,
+// update publishes a copy of the registrations changed by fn.
+func (tm *TriggerManager) update(fn func(*triggerSet)) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	old := tm.snapshot()
+	next := &triggerSet{
+		actions:   make(map[string]Trigger, len(old.actions)+1),
+		workflows: make(map[string]Trigger, len(old.workflows)+1),
 	}
-	body, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("failed to marshal payload: %v", err)
+	for k, v := range old.actions {
+		next.actions[k] = v
 	}
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
+	for k, v := range old.workflows {
+		next.workflows[k] = v
 	}
-	req.Header.Set("Authorization", "Bearer "+authToken)
-	req.Header.Set("Content-Type", "application/json")
+	fn(next)
+	tm.triggers.Store(next)
+}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to trigger action: %v", err)
-	}
-	defer resp.Body.Close()
+// ExecuteAction executes a registered action.
+func (tm *TriggerManager) ExecuteAction(name, target, token string, params map[string]string) error {
+	return tm.ExecuteActionContext(context.Background(), name, target, token, params)
+}
+
+// ExecuteActionContext executes a registered action, passing ctx to it if
+// it is a ContextTrigger. Failures are a *DispatchError.
+func (tm *TriggerManager) ExecuteActionContext(ctx context.Context, name, target, token string, params map[string]string) error {
+	trigger, exists := tm.Action(name)
 
-	if resp.StatusCode != 204 {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	log := LoggerOr(tm.Logger)
+	if !exists {
+		log.Warn("action not registered", "action", name, "repo", target)
+		return &DispatchError{Target: target, Trigger: name, Err: fmt.Errorf("action %s %w", name, ErrNotRegistered)}
+	}
+	log.Debug("executing action", "action", name, "repo", target)
+	if err := runTrigger(ctx, trigger, target, params, token); err != nil {
+		log.Error("action failed", "action", name, "repo", target, "error", err)
+		return dispatchError(providerOf(trigger), target, name, err)
 	}
 	return nil
 }
 
-// WorkflowTrigger represents a trigger for GitHub reusable workflows.
-type WorkflowTrigger struct {
-	WorkflowFile string
-	Ref          string
+// ExecuteWorkflow executes a registered workflow.
+func (tm *TriggerManager) ExecuteWorkflow(name, target, token string, params map[string]string) error {
+	return tm.ExecuteWorkflowContext(context.Background(), name, target, token, params)
 }
 
-func (w *WorkflowTrigger) Trigger(target string, params map[string]string, authToken string) error {
-	url := fmt.Sprintf("https://api.github.com/repos/%s/actions/workflows/%s/dispatches", target, w.WorkflowFile)
-	payload := map[string]interface{}{
-		"ref":    w.Ref,
-		"inputs": params,
-	}
-	body, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("failed to marshal payload: %v", err)
-	}
+// ExecuteWorkflowContext executes a registered workflow, passing ctx to it
+// if it is a ContextTrigger. Failures are a *DispatchError.
+func (tm *TriggerManager) ExecuteWorkflowContext(ctx context.Context, name, target, token string, params map[string]string) error {
+	trigger, exists := tm.Workflow(name)
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
+	log := LoggerOr(tm.Logger)
+	if !exists {
+		log.Warn("workflow not registered", "workflow", name, "repo", target)
+		return &DispatchError{Target: target, Trigger: name, Err: fmt.Errorf("workflow %s %w", name, ErrNotRegistered)}
 	}
-	req.Header.Set("Authorization", "Bearer "+authToken)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to trigger workflow: %v", err)
+	log.Debug("executing workflow", "workflow", name, "repo", target)
+	if err := runTrigger(ctx, trigger, target, params, token); err != nil {
+		log.Error("workflow failed", "workflow", name, "repo", target, "error", err)
+		return dispatchError(providerOf(trigger), target, name, err)
 	}
-	defer resp.Body.Close()
+	return nil
+}
 
-	if resp.StatusCode != 204 {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+// runTrigger runs t with ctx if it is a ContextTrigger. Other triggers
+// cannot be cancelled once started, so they are not started if ctx is
+// already done.
+func runTrigger(ctx context.Context, t Trigger, target string, params map[string]string, token string) error {
+	if ct, ok := t.(ContextTrigger); ok {
+		return ct.TriggerContext(ctx, target, params, token)
 	}
-	return nil
-}
\ No newline at end of file
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return t.Trigger(target, params, token)
+}
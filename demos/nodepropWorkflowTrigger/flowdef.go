@@ -0,0 +1,291 @@
+package flow
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"gopkg.in/yaml.v3"
+)
+
+// Providers a flow step can use, besides the kinds NewProvider builds.
+const (
+	// ProviderWorkflowDispatch runs a workflow file through workflow_dispatch.
+	ProviderWorkflowDispatch = "workflow_dispatch"
+	// ProviderRepositoryDispatch sends a repository_dispatch event.
+	ProviderRepositoryDispatch = "repository_dispatch"
+)
+
+// FlowDefinition is a named orchestration of dispatches kept as config.
+type FlowDefinition struct {
+	Name string `yaml:"name" json:"name"`
+	// Version labels the definition, e.g. 2024-06-01 or 3; executions
+	// record it, with the Digest, to tell which definition they ran.
+	Version     string     `yaml:"version,omitempty" json:"version,omitempty"`
+	Description string     `yaml:"description,omitempty" json:"description,omitempty"`
+	Steps       []FlowStep `yaml:"steps" json:"steps"`
+	// Handlers are steps that run only when a step's OnFailure or
+	// Compensate names them.
+	Handlers []FlowStep `yaml:"handlers,omitempty" json:"handlers,omitempty"`
+	// Timeout, if set, bounds the whole flow from its start. Once it has
+	// passed, steps not yet started are skipped and running steps stop
+	// following their runs and fail. With CancelRuns those runs are also
+	// cancelled on GitHub; otherwise they are left to finish.
+	Timeout    time.Duration `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	CancelRuns bool          `yaml:"cancel_runs,omitempty" json:"cancel_runs,omitempty"`
+}
+
+// FlowStep is one dispatch in a flow. Needs lists steps that must finish
+// first.
+//
+// A workflow_dispatch step runs Workflow on Ref with Inputs and succeeds if
+// the run does; a repository_dispatch step sends EventType with Inputs as
+// its client_payload. Any other Provider is a kind NewProvider builds from
+// Settings, such as webhook or a plugin's, and is triggered on Repo with
+// Inputs as its params. A workflow_dispatch step with FanOut runs on the
+// repositories it selects instead of Repo.
+type FlowStep struct {
+	Name      string            `yaml:"name" json:"name"`
+	Provider  string            `yaml:"provider" json:"provider"`
+	Repo      string            `yaml:"repo" json:"repo"`
+	Workflow  string            `yaml:"workflow,omitempty" json:"workflow,omitempty"`
+	EventType string            `yaml:"event_type,omitempty" json:"event_type,omitempty"`
+	Ref       string            `yaml:"ref,omitempty" json:"ref,omitempty"`
+	Inputs    map[string]string `yaml:"inputs,omitempty" json:"inputs,omitempty"`
+	Settings  map[string]string `yaml:"settings,omitempty" json:"settings,omitempty"`
+	Needs     []string          `yaml:"needs,omitempty" json:"needs,omitempty"`
+	// Retry, if set, runs the step again when it fails.
+	Retry  *StepRetry  `yaml:"retry,omitempty" json:"retry,omitempty"`
+	FanOut *StepFanOut `yaml:"fan_out,omitempty" json:"fan_out,omitempty"`
+	// When is a CEL expression deciding, once the steps the step needs are
+	// done, whether it runs, e.g. event.branch == "main" &&
+	// "prod" in repo.tags. See ConditionEnv for its variables.
+	When string `yaml:"when,omitempty" json:"when,omitempty"`
+	// ContinueOnError lets steps that need the step run, and the flow
+	// succeed, even if it fails.
+	ContinueOnError bool         `yaml:"continue_on_error,omitempty" json:"continue_on_error,omitempty"`
+	OnFailure       *StepFailure `yaml:"on_failure,omitempty" json:"on_failure,omitempty"`
+	// Compensate names the handler that undoes the step, e.g. one
+	// dispatching a revert-deploy workflow. A flow with such a step is a
+	// saga: once any step fails, the steps that had succeeded are
+	// compensated in the reverse of the order they finished in.
+	Compensate string `yaml:"compensate,omitempty" json:"compensate,omitempty"`
+	// Outputs, if set, collects the outputs of the step's run for later
+	// steps.
+	Outputs *StepOutputs `yaml:"outputs,omitempty" json:"outputs,omitempty"`
+}
+
+// StepFailure is what happens when a step has failed for good, after its
+// retries: Notify sends an EventFlowStepFailed to the graph's Notifier, and
+// Run names handlers of the flow to run in order, e.g. to page someone or
+// to dispatch a cleanup workflow.
+type StepFailure struct {
+	Notify bool     `yaml:"notify,omitempty" json:"notify,omitempty"`
+	Run    []string `yaml:"run,omitempty" json:"run,omitempty"`
+}
+
+// StepRetry runs a failed step again, dispatch and run alike, up to
+// MaxAttempts times in all. The wait before the second attempt is Backoff,
+// doubling after each further attempt up to MaxBackoff.
+type StepRetry struct {
+	MaxAttempts int           `yaml:"max_attempts" json:"max_attempts"`
+	Backoff     time.Duration `yaml:"backoff,omitempty" json:"backoff,omitempty"`
+	MaxBackoff  time.Duration `yaml:"max_backoff,omitempty" json:"max_backoff,omitempty"`
+}
+
+// attempts returns the attempts r allows a step, 1 if r is nil.
+func (r *StepRetry) attempts() int {
+	if r == nil || r.MaxAttempts < 1 {
+		return 1
+	}
+	return r.MaxAttempts
+}
+
+// delay returns the wait before the given attempt (2 or later).
+func (r *StepRetry) delay(attempt int) time.Duration {
+	return RetryPolicy{Backoff: r.Backoff, MaxBackoff: r.MaxBackoff}.delay(attempt)
+}
+
+// Digest identifies the content of the definition: two definitions have
+// the same digest only if they are the same, however their files are laid
+// out. Unlike Version it changes with every edit, including one whose
+// author forgot to bump Version.
+func (f *FlowDefinition) Digest() string {
+	// The JSON encoding sorts map keys, so it is the same for equal
+	// definitions.
+	data, _ := json.Marshal(f)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:6])
+}
+
+// LoadFlowDefinition reads and validates a flow definition file.
+func LoadFlowDefinition(path string) (*FlowDefinition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f FlowDefinition
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse flow %s: %w", path, err)
+	}
+	if err := f.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &f, nil
+}
+
+// Validate checks step names, providers, and dependencies, which must not
+// form a cycle, compiles When expressions, and checks that failure
+// handlers exist.
+func (f *FlowDefinition) Validate() error {
+	if f.Name == "" {
+		return fmt.Errorf("flow has no name")
+	}
+	if len(f.Steps) == 0 {
+		return fmt.Errorf("flow %s has no steps", f.Name)
+	}
+	if f.Timeout < 0 {
+		return fmt.Errorf("flow %s: timeout must not be negative", f.Name)
+	}
+	if f.CancelRuns && f.Timeout == 0 {
+		return fmt.Errorf("flow %s: cancel_runs needs a timeout", f.Name)
+	}
+	env, err := flowEnv()
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool, len(f.Steps))
+	handlers := make(map[string]bool, len(f.Handlers))
+	for i, s := range f.Steps {
+		if s.Name == "" {
+			return fmt.Errorf("step %d: name is required", i)
+		}
+		if seen[s.Name] {
+			return fmt.Errorf("step %s: duplicate name", s.Name)
+		}
+		seen[s.Name] = true
+		if err := s.validate(env); err != nil {
+			return fmt.Errorf("step %s: %w", s.Name, err)
+		}
+	}
+	for i, h := range f.Handlers {
+		if h.Name == "" {
+			return fmt.Errorf("handler %d: name is required", i)
+		}
+		if seen[h.Name] || handlers[h.Name] {
+			return fmt.Errorf("handler %s: duplicate name", h.Name)
+		}
+		handlers[h.Name] = true
+		if len(h.Needs) > 0 || h.When != "" || h.OnFailure != nil || h.Compensate != "" {
+			return fmt.Errorf("handler %s: needs, when, on_failure, and compensate are for steps", h.Name)
+		}
+		if err := h.validate(env); err != nil {
+			return fmt.Errorf("handler %s: %w", h.Name, err)
+		}
+	}
+	for _, s := range f.Steps {
+		for _, dep := range s.Needs {
+			if !seen[dep] {
+				return fmt.Errorf("step %s needs unknown step %s", s.Name, dep)
+			}
+		}
+		if s.OnFailure != nil {
+			for _, h := range s.OnFailure.Run {
+				if !handlers[h] {
+					return fmt.Errorf("step %s: on_failure runs unknown handler %s", s.Name, h)
+				}
+			}
+		}
+		if s.Compensate != "" && !handlers[s.Compensate] {
+			return fmt.Errorf("step %s: compensate names unknown handler %s", s.Name, s.Compensate)
+		}
+	}
+	if _, err := f.order(); err != nil {
+		return err
+	}
+	return f.checkOutputs()
+}
+
+// validate checks what s dispatches, how, and when.
+func (s *FlowStep) validate(env *cel.Env) error {
+	switch {
+	case s.FanOut != nil:
+		if s.Repo != "" {
+			return fmt.Errorf("repo and fan_out are exclusive")
+		}
+		if s.Provider != ProviderWorkflowDispatch {
+			return fmt.Errorf("fan_out needs provider %s", ProviderWorkflowDispatch)
+		}
+		if err := s.FanOut.validate(); err != nil {
+			return err
+		}
+	case s.Repo == "":
+		return fmt.Errorf("repo is required")
+	}
+	switch s.Provider {
+	case ProviderWorkflowDispatch:
+		if s.Workflow == "" {
+			return fmt.Errorf("workflow is required for %s", s.Provider)
+		}
+	case ProviderRepositoryDispatch:
+		if s.EventType == "" {
+			return fmt.Errorf("event_type is required for %s", s.Provider)
+		}
+	default:
+		if !slices.Contains(Providers(), s.Provider) {
+			return fmt.Errorf("unknown provider %q", s.Provider)
+		}
+	}
+	if s.Outputs != nil && (s.Provider != ProviderWorkflowDispatch || s.FanOut != nil) {
+		return fmt.Errorf("outputs need provider %s and one repo", ProviderWorkflowDispatch)
+	}
+	if s.Retry != nil && s.Retry.MaxAttempts < 1 {
+		return fmt.Errorf("retry max_attempts must be at least 1")
+	}
+	if s.When != "" {
+		if _, err := compileWhen(env, s.When); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// order returns the step names so that every step comes after those it
+// needs, keeping the definition's order otherwise, or the error of a
+// cycle.
+func (f *FlowDefinition) order() ([]string, error) {
+	done := make(map[string]bool, len(f.Steps))
+	order := make([]string, 0, len(f.Steps))
+	for len(order) < len(f.Steps) {
+		progressed := false
+		for _, s := range f.Steps {
+			if done[s.Name] {
+				continue
+			}
+			ready := true
+			for _, dep := range s.Needs {
+				ready = ready && done[dep]
+			}
+			if ready {
+				done[s.Name] = true
+				order = append(order, s.Name)
+				progressed = true
+			}
+		}
+		if !progressed {
+			var stuck []string
+			for _, s := range f.Steps {
+				if !done[s.Name] {
+					stuck = append(stuck, s.Name)
+				}
+			}
+			return nil, fmt.Errorf("flow %s: steps %v need each other in a cycle", f.Name, stuck)
+		}
+	}
+	return order, nil
+}
@@ -0,0 +1,166 @@
+package flow
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFlowDefinitionValidate(t *testing.T) {
+	build := FlowStep{Name: "build", Provider: ProviderWorkflowDispatch, Repo: "o/api", Workflow: "build.yml"}
+	deploy := FlowStep{Name: "deploy", Provider: ProviderWorkflowDispatch, Repo: "o/api", Workflow: "deploy.yml", Needs: []string{"build"}}
+	step := func(edit func(s *FlowStep)) FlowStep {
+		s := build
+		edit(&s)
+		return s
+	}
+	fanOut := func(f *StepFanOut) FlowStep {
+		return step(func(s *FlowStep) { s.Repo, s.FanOut = "", f })
+	}
+	handler := func(name string, edits ...func(s *FlowStep)) FlowStep {
+		h := FlowStep{Name: name, Provider: ProviderRepositoryDispatch, Repo: "o/ops", EventType: "page"}
+		for _, edit := range edits {
+			edit(&h)
+		}
+		return h
+	}
+	onFailure := func(handlers ...string) FlowStep {
+		return step(func(s *FlowStep) { s.OnFailure = &StepFailure{Notify: true, Run: handlers} })
+	}
+	tests := []struct {
+		name    string
+		f       FlowDefinition
+		wantErr string
+	}{
+		{name: "valid", f: FlowDefinition{Name: "release", Steps: []FlowStep{build, deploy}}},
+		{name: "repository dispatch", f: FlowDefinition{Name: "f", Steps: []FlowStep{{Name: "ping", Provider: ProviderRepositoryDispatch, Repo: "o/r", EventType: "ping"}}}},
+		{name: "webhook", f: FlowDefinition{Name: "f", Steps: []FlowStep{{Name: "hook", Provider: "webhook", Repo: "o/r"}}}},
+		{name: "no name", f: FlowDefinition{Steps: []FlowStep{build}}, wantErr: "flow has no name"},
+		{name: "no steps", f: FlowDefinition{Name: "f"}, wantErr: "has no steps"},
+		{name: "negative timeout", f: FlowDefinition{Name: "f", Steps: []FlowStep{build}, Timeout: -time.Second}, wantErr: "timeout must not be negative"},
+		{name: "cancel runs without timeout", f: FlowDefinition{Name: "f", Steps: []FlowStep{build}, CancelRuns: true}, wantErr: "cancel_runs needs a timeout"},
+		{name: "unnamed step", f: FlowDefinition{Name: "f", Steps: []FlowStep{step(func(s *FlowStep) { s.Name = "" })}}, wantErr: "name is required"},
+		{name: "duplicate step", f: FlowDefinition{Name: "f", Steps: []FlowStep{build, build}}, wantErr: "duplicate name"},
+		{name: "no repo", f: FlowDefinition{Name: "f", Steps: []FlowStep{step(func(s *FlowStep) { s.Repo = "" })}}, wantErr: "repo is required"},
+		{name: "no workflow", f: FlowDefinition{Name: "f", Steps: []FlowStep{step(func(s *FlowStep) { s.Workflow = "" })}}, wantErr: "workflow is required"},
+		{name: "no event type", f: FlowDefinition{Name: "f", Steps: []FlowStep{step(func(s *FlowStep) { s.Provider = ProviderRepositoryDispatch })}}, wantErr: "event_type is required"},
+		{name: "unknown provider", f: FlowDefinition{Name: "f", Steps: []FlowStep{step(func(s *FlowStep) { s.Provider = "jenkins" })}}, wantErr: `unknown provider "jenkins"`},
+		{name: "zero retries", f: FlowDefinition{Name: "f", Steps: []FlowStep{step(func(s *FlowStep) { s.Retry = &StepRetry{} })}}, wantErr: "max_attempts must be at least 1"},
+		{name: "unknown need", f: FlowDefinition{Name: "f", Steps: []FlowStep{deploy}}, wantErr: "needs unknown step build"},
+		{
+			name: "cycle",
+			f: FlowDefinition{Name: "f", Steps: []FlowStep{
+				step(func(s *FlowStep) { s.Needs = []string{"deploy"} }),
+				deploy,
+			}},
+			wantErr: "need each other in a cycle",
+		},
+		{name: "self cycle", f: FlowDefinition{Name: "f", Steps: []FlowStep{step(func(s *FlowStep) { s.Needs = []string{"build"} })}}, wantErr: "cycle"},
+		{name: "fan out", f: FlowDefinition{Name: "f", Steps: []FlowStep{fanOut(&StepFanOut{Selector: "tag:web", Wait: FanInQuorum, Quorum: 2})}}},
+		{name: "fan out with repo", f: FlowDefinition{Name: "f", Steps: []FlowStep{step(func(s *FlowStep) { s.FanOut = &StepFanOut{Selector: "*"} })}}, wantErr: "repo and fan_out are exclusive"},
+		{name: "fan out of repository dispatch", f: FlowDefinition{Name: "f", Steps: []FlowStep{{Name: "ping", Provider: ProviderRepositoryDispatch, EventType: "ping", FanOut: &StepFanOut{Selector: "*"}}}}, wantErr: "fan_out needs provider workflow_dispatch"},
+		{name: "fan out without selector", f: FlowDefinition{Name: "f", Steps: []FlowStep{fanOut(&StepFanOut{})}}, wantErr: "fan_out selector is required"},
+		{name: "quorum without wait", f: FlowDefinition{Name: "f", Steps: []FlowStep{fanOut(&StepFanOut{Selector: "*", Quorum: 2})}}, wantErr: "fan_out quorum needs wait: quorum"},
+		{name: "zero quorum", f: FlowDefinition{Name: "f", Steps: []FlowStep{fanOut(&StepFanOut{Selector: "*", Wait: FanInQuorum})}}, wantErr: "quorum must be at least 1"},
+		{name: "unknown wait", f: FlowDefinition{Name: "f", Steps: []FlowStep{fanOut(&StepFanOut{Selector: "*", Wait: "most"})}}, wantErr: `unknown fan_out wait "most"`},
+		{name: "negative concurrency", f: FlowDefinition{Name: "f", Steps: []FlowStep{fanOut(&StepFanOut{Selector: "*", Concurrency: -1})}}, wantErr: "concurrency must not be negative"},
+		{name: "failure handler", f: FlowDefinition{Name: "f", Steps: []FlowStep{onFailure("page")}, Handlers: []FlowStep{handler("page")}}},
+		{name: "unknown failure handler", f: FlowDefinition{Name: "f", Steps: []FlowStep{onFailure("page")}}, wantErr: "on_failure runs unknown handler page"},
+		{name: "step is not a handler", f: FlowDefinition{Name: "f", Steps: []FlowStep{build, step(func(s *FlowStep) { s.Name, s.OnFailure = "deploy", &StepFailure{Run: []string{"build"}} })}}, wantErr: "on_failure runs unknown handler build"},
+		{name: "unnamed handler", f: FlowDefinition{Name: "f", Steps: []FlowStep{build}, Handlers: []FlowStep{handler("")}}, wantErr: "handler 0: name is required"},
+		{name: "handler named as step", f: FlowDefinition{Name: "f", Steps: []FlowStep{build}, Handlers: []FlowStep{handler("build")}}, wantErr: "handler build: duplicate name"},
+		{name: "duplicate handler", f: FlowDefinition{Name: "f", Steps: []FlowStep{build}, Handlers: []FlowStep{handler("page"), handler("page")}}, wantErr: "handler page: duplicate name"},
+		{name: "handler with needs", f: FlowDefinition{Name: "f", Steps: []FlowStep{build}, Handlers: []FlowStep{handler("page", func(h *FlowStep) { h.Needs = []string{"build"} })}}, wantErr: "are for steps"},
+		{name: "handler with when", f: FlowDefinition{Name: "f", Steps: []FlowStep{build}, Handlers: []FlowStep{handler("page", func(h *FlowStep) { h.When = "true" })}}, wantErr: "are for steps"},
+		{name: "compensate", f: FlowDefinition{Name: "f", Steps: []FlowStep{step(func(s *FlowStep) { s.Compensate = "revert" })}, Handlers: []FlowStep{handler("revert")}}},
+		{name: "unknown compensation", f: FlowDefinition{Name: "f", Steps: []FlowStep{step(func(s *FlowStep) { s.Compensate = "revert" })}}, wantErr: "compensate names unknown handler revert"},
+		{name: "handler with compensate", f: FlowDefinition{Name: "f", Steps: []FlowStep{build}, Handlers: []FlowStep{handler("page", func(h *FlowStep) { h.Compensate = "page" })}}, wantErr: "are for steps"},
+		{name: "invalid handler", f: FlowDefinition{Name: "f", Steps: []FlowStep{build}, Handlers: []FlowStep{handler("page", func(h *FlowStep) { h.EventType = "" })}}, wantErr: "handler page: event_type is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.f.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFlowDefinitionOrder(t *testing.T) {
+	f := FlowDefinition{Name: "f", Steps: []FlowStep{
+		{Name: "deploy", Needs: []string{"build", "test"}},
+		{Name: "build"},
+		{Name: "notify", Needs: []string{"deploy"}},
+		{Name: "test", Needs: []string{"build"}},
+		{Name: "lint"},
+	}}
+	got, err := f.order()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"build", "test", "lint", "deploy", "notify"}; !slices.Equal(got, want) {
+		t.Errorf("order() = %v, want %v", got, want)
+	}
+}
+
+func TestLoadFlowDefinition(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "release.yml")
+	def := `name: release
+version: "3"
+steps:
+  - name: build
+    provider: workflow_dispatch
+    repo: o/api
+    workflow: build.yml
+    inputs: {env: prod, region: us}
+  - name: deploy
+    provider: workflow_dispatch
+    repo: o/api
+    workflow: deploy.yml
+    needs: [build]
+`
+	if err := os.WriteFile(path, []byte(def), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := LoadFlowDefinition(path)
+	if err != nil {
+		t.Fatalf("LoadFlowDefinition() error = %v", err)
+	}
+	if f.Version != "3" || len(f.Steps) != 2 || f.Steps[1].Needs[0] != "build" {
+		t.Errorf("LoadFlowDefinition() = %+v", f)
+	}
+
+	// The same definition laid out differently has the same digest.
+	relaid := strings.Replace(def, "inputs: {env: prod, region: us}", "inputs:\n      region: us\n      env: prod", 1)
+	if err := os.WriteFile(path, []byte(relaid), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	g, err := LoadFlowDefinition(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Digest() != g.Digest() {
+		t.Errorf("Digest() differs for the same definition: %s, %s", f.Digest(), g.Digest())
+	}
+	g.Steps[0].Inputs["env"] = "staging"
+	if f.Digest() == g.Digest() {
+		t.Error("Digest() is unchanged after an edit")
+	}
+
+	if err := os.WriteFile(path, []byte("name: broken\nsteps: []\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFlowDefinition(path); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("LoadFlowDefinition() of an invalid flow error = %v, want it to name the file", err)
+	}
+}
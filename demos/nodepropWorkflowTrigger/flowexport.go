@@ -0,0 +1,184 @@
+package flow
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Formats of ExportGraph.
+const (
+	// GraphDOT is Graphviz's DOT language.
+	GraphDOT = "dot"
+	// GraphMermaid is a Mermaid flowchart, which GitHub renders in
+	// Markdown, such as a job summary, inside a ```mermaid block.
+	GraphMermaid = "mermaid"
+)
+
+// statusColors are the fill colors of step statuses in exported graphs.
+var statusColors = map[string]string{
+	StepPending:   "#eaeef2",
+	StepRunning:   "#54aeff",
+	StepSucceeded: "#4ac26b",
+	StepFailed:    "#ff8182",
+	StepSkipped:   "#d0d7de",
+	StepOmitted:   "#d0d7de",
+	"tolerated":   "#d4a72c",
+}
+
+// graphNode is a step or handler of an exported graph.
+type graphNode struct {
+	id, label, status string
+	handler           bool
+}
+
+// graphEdge is a need, drawn solid, or an on_failure or compensate link to
+// a handler, drawn dashed with its label.
+type graphEdge struct {
+	from, to, label string
+}
+
+// ExportGraph renders the flow as a diagram in format, GraphDOT or
+// GraphMermaid: a node per step, showing what it dispatches, an arrow from
+// each step to the steps that need it, and dashed arrows to the handlers of
+// its on_failure and compensate. If exec, an execution of the flow, is not
+// nil, each step also shows and is colored by its status there, and each
+// handler by how it last ran, if it did.
+func (g *FlowGraph) ExportGraph(format string, exec *FlowExecution) (string, error) {
+	if exec != nil && exec.Flow != g.Def.Name {
+		return "", fmt.Errorf("execution %s is of flow %s, not %s", exec.ID, exec.Flow, g.Def.Name)
+	}
+	nodes, edges := g.graphParts(exec)
+	switch format {
+	case GraphDOT:
+		return exportDOT(g.Def.Name, nodes, edges), nil
+	case GraphMermaid:
+		return exportMermaid(nodes, edges), nil
+	}
+	return "", fmt.Errorf("unknown graph format %q (want %s or %s)", format, GraphDOT, GraphMermaid)
+}
+
+// graphParts returns the nodes and edges of the flow, in definition order.
+func (g *FlowGraph) graphParts(exec *FlowExecution) ([]graphNode, []graphEdge) {
+	ids := map[string]string{}
+	var nodes []graphNode
+	add := func(s FlowStep, handler bool) {
+		n := graphNode{id: fmt.Sprintf("n%d", len(nodes)), label: s.Name + "\n" + stepTarget(s), handler: handler}
+		ids[s.Name] = n.id
+		var st *StepState
+		switch {
+		case exec == nil:
+		case handler:
+			// A handler shows how it last ran, if it did.
+			ran := append(append([]StepState(nil), exec.Handlers...), exec.Compensations...)
+			for i := range ran {
+				if ran[i].Name == s.Name && (st == nil || !ran[i].StartedAt.Before(st.StartedAt)) {
+					st = &ran[i]
+				}
+			}
+		default:
+			st = exec.Step(s.Name)
+		}
+		if st != nil {
+			n.status = st.Status
+			if st.Tolerated {
+				n.status = "tolerated"
+			}
+			n.label += "\n" + n.status
+		}
+		nodes = append(nodes, n)
+	}
+	for _, s := range g.Def.Steps {
+		add(s, false)
+	}
+	for _, h := range g.Def.Handlers {
+		add(h, true)
+	}
+	var edges []graphEdge
+	for _, s := range g.Def.Steps {
+		for _, dep := range s.Needs {
+			edges = append(edges, graphEdge{from: ids[dep], to: ids[s.Name]})
+		}
+		if s.OnFailure != nil {
+			for _, h := range s.OnFailure.Run {
+				edges = append(edges, graphEdge{from: ids[s.Name], to: ids[h], label: "on_failure"})
+			}
+		}
+		if s.Compensate != "" {
+			edges = append(edges, graphEdge{from: ids[s.Name], to: ids[s.Compensate], label: "compensate"})
+		}
+	}
+	return nodes, edges
+}
+
+// stepTarget describes what s dispatches, e.g. Cdaprod/app build.yml.
+func stepTarget(s FlowStep) string {
+	repo := s.Repo
+	if s.FanOut != nil {
+		repo = s.FanOut.Selector
+	}
+	switch s.Provider {
+	case ProviderWorkflowDispatch:
+		return repo + " " + s.Workflow
+	case ProviderRepositoryDispatch:
+		return repo + " " + s.EventType
+	}
+	return s.Provider + " " + repo
+}
+
+func exportDOT(name string, nodes []graphNode, edges []graphEdge) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", strconv.Quote(name))
+	b.WriteString("  rankdir=LR;\n  node [shape=box, style=\"rounded,filled\", fillcolor=\"#ffffff\"];\n")
+	for _, n := range nodes {
+		attrs := "label=" + strconv.Quote(n.label)
+		if c := statusColors[n.status]; c != "" {
+			attrs += ", fillcolor=" + strconv.Quote(c)
+		}
+		if n.handler {
+			attrs += ", style=\"rounded,filled,dashed\""
+		}
+		fmt.Fprintf(&b, "  %s [%s];\n", n.id, attrs)
+	}
+	for _, e := range edges {
+		if e.label == "" {
+			fmt.Fprintf(&b, "  %s -> %s;\n", e.from, e.to)
+		} else {
+			fmt.Fprintf(&b, "  %s -> %s [style=dashed, label=%s];\n", e.from, e.to, strconv.Quote(e.label))
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func exportMermaid(nodes []graphNode, edges []graphEdge) string {
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	for _, n := range nodes {
+		label := strings.ReplaceAll(strings.ReplaceAll(n.label, `"`, "#quot;"), "\n", "<br/>")
+		if n.handler {
+			fmt.Fprintf(&b, "  %s([\"%s\"])\n", n.id, label)
+		} else {
+			fmt.Fprintf(&b, "  %s[\"%s\"]\n", n.id, label)
+		}
+	}
+	for _, e := range edges {
+		if e.label == "" {
+			fmt.Fprintf(&b, "  %s --> %s\n", e.from, e.to)
+		} else {
+			fmt.Fprintf(&b, "  %s -.->|%s| %s\n", e.from, e.label, e.to)
+		}
+	}
+	for _, status := range []string{StepPending, StepRunning, StepSucceeded, StepFailed, StepSkipped, StepOmitted, "tolerated"} {
+		var ids []string
+		for _, n := range nodes {
+			if n.status == status {
+				ids = append(ids, n.id)
+			}
+		}
+		if len(ids) > 0 {
+			fmt.Fprintf(&b, "  classDef %s fill:%s\n  class %s %s\n", status, statusColors[status], strings.Join(ids, ","), status)
+		}
+	}
+	return b.String()
+}
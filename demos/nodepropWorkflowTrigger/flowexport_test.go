@@ -0,0 +1,92 @@
+package flow_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+// exportFlow compiles a flow with a step of each kind and both kinds of
+// handler.
+func exportFlow(t *testing.T) *flow.FlowGraph {
+	t.Helper()
+	build := workflowStep("build")
+	build.Compensate = "unbuild"
+	deploy := workflowStep("deploy", "build")
+	deploy.OnFailure = &flow.StepFailure{Run: []string{"page"}}
+	rebuild := flow.FlowStep{Name: "rebuild", Provider: flow.ProviderWorkflowDispatch, Workflow: "build.yml", Needs: []string{"build"}, FanOut: &flow.StepFanOut{Selector: "tag:web"}, ContinueOnError: true}
+	hook := flow.FlowStep{Name: `say "done"`, Provider: "webhook", Repo: "Cdaprod/ops", Needs: []string{"deploy", "rebuild"}}
+	g, err := flow.CompileFlow(&flow.FlowDefinition{
+		Name:     "release",
+		Steps:    []flow.FlowStep{build, deploy, rebuild, hook},
+		Handlers: []flow.FlowStep{handlerStep("page"), handlerStep("unbuild")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestExportGraph(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	// deploy failed and was handled by page, which failed before it
+	// succeeded; build was compensated.
+	exec := &flow.FlowExecution{
+		ID:   "11111111-1111-4111-8111-111111111111",
+		Flow: "release",
+		Steps: []flow.StepState{
+			{Name: "build", Status: flow.StepSucceeded},
+			{Name: "deploy", Status: flow.StepFailed},
+			{Name: "rebuild", Status: flow.StepFailed, Tolerated: true},
+			{Name: `say "done"`, Status: flow.StepSkipped},
+		},
+		Handlers: []flow.StepState{
+			{Name: "page", For: "deploy", Status: flow.StepSucceeded, StartedAt: start.Add(time.Minute)},
+			{Name: "page", For: "deploy", Status: flow.StepFailed, StartedAt: start},
+		},
+		Compensations: []flow.StepState{{Name: "unbuild", For: "build", Status: flow.StepSucceeded, StartedAt: start.Add(2 * time.Minute)}},
+	}
+	tests := []struct {
+		name   string
+		format string
+		exec   *flow.FlowExecution
+		golden string
+	}{
+		{name: "dot", format: flow.GraphDOT, golden: "testdata/release.golden.dot"},
+		{name: "mermaid", format: flow.GraphMermaid, golden: "testdata/release.golden.mmd"},
+		{name: "dot execution", format: flow.GraphDOT, exec: exec, golden: "testdata/release-execution.golden.dot"},
+		{name: "mermaid execution", format: flow.GraphMermaid, exec: exec, golden: "testdata/release-execution.golden.mmd"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := exportFlow(t).ExportGraph(tt.format, tt.exec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			nodeproptest.Golden(t, tt.golden, []byte(got))
+		})
+	}
+}
+
+func TestExportGraphErrors(t *testing.T) {
+	g := exportFlow(t)
+	tests := []struct {
+		name    string
+		format  string
+		exec    *flow.FlowExecution
+		wantErr string
+	}{
+		{name: "unknown format", format: "svg", wantErr: `unknown graph format "svg" (want dot or mermaid)`},
+		{name: "another flow", format: flow.GraphDOT, exec: &flow.FlowExecution{ID: "e-1", Flow: "nightly"}, wantErr: "execution e-1 is of flow nightly, not release"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := g.ExportGraph(tt.format, tt.exec); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ExportGraph() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// onFailure handles the failure of step with cause as its OnFailure says,
+// and returns the states of the handlers it ran. Handlers run one after
+// another, each with its own retries; one failing does not stop the next.
+// Their StepKeys start with key.
+func (g *FlowGraph) onFailure(ctx context.Context, runner StepRunner, clock Clock, key string, step FlowStep, cause error) ([]StepState, error) {
+	f := step.OnFailure
+	if f == nil {
+		return nil, nil
+	}
+	var errs []error
+	if f.Notify && g.Notifier != nil {
+		e := Event{
+			Type:     EventFlowStepFailed,
+			Repo:     step.Repo,
+			Workflow: step.Workflow,
+			Status:   "step " + step.Name,
+			Error:    cause.Error(),
+			Actor:    "flow:" + g.Def.Name,
+			Time:     clock.Now(),
+		}
+		// The notification matters most when the flow was cancelled.
+		nctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), notifyTimeout)
+		if err := g.Notifier.Notify(nctx, e); err != nil {
+			errs = append(errs, fmt.Errorf("notify: %w", err))
+		}
+		cancel()
+	}
+	var states []StepState
+	for _, name := range f.Run {
+		st, err := g.runHandler(ctx, runner, clock, key+"/on_failure/"+name, name, step.Name)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		states = append(states, st)
+	}
+	return states, errors.Join(errs...)
+}
+
+// Saga reports whether the flow is a saga: one with a step that has a
+// Compensate handler.
+func (g *FlowGraph) Saga() bool {
+	for _, s := range g.Def.Steps {
+		if s.Compensate != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// compensate runs the Compensate handlers of the succeeded steps in the
+// reverse of the order they succeeded in, so that what was done last is
+// undone first, and adds their states to exec. A compensation that fails
+// does not stop the others; one that already succeeded, before exec was
+// resumed, is not run again.
+func (g *FlowGraph) compensate(ctx context.Context, runner StepRunner, clock Clock, exec *FlowExecution, succeeded []string) error {
+	done := map[string]bool{}
+	for _, c := range exec.Compensations {
+		if c.Status == StepSucceeded {
+			done[c.For] = true
+		}
+	}
+	var errs []error
+	for i := len(succeeded) - 1; i >= 0; i-- {
+		step := g.steps[succeeded[i]]
+		if step.Compensate == "" || done[step.Name] {
+			continue
+		}
+		st, err := g.runHandler(ctx, runner, clock, exec.ID+"/"+step.Name+"/compensate", step.Compensate, step.Name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("compensating step %s: %w", step.Name, err))
+		}
+		exec.Compensations = append(exec.Compensations, st)
+		g.save(exec)
+	}
+	return errors.Join(errs...)
+}
+
+// runHandler runs the named handler, with its retries, for step.
+func (g *FlowGraph) runHandler(ctx context.Context, runner StepRunner, clock Clock, key, name, step string) (StepState, error) {
+	st := StepState{Name: name, For: step, StartedAt: clock.Now()}
+	runs, attempts, err := g.runStep(ctx, runner, clock, key, g.handlers[name])
+	st.Attempts, st.Runs, st.FinishedAt = attempts, runs, clock.Now()
+	if err != nil {
+		st.Status, st.Error = StepFailed, err.Error()
+		return st, fmt.Errorf("handler %s: %w", name, err)
+	}
+	st.Status = StepSucceeded
+	return st, nil
+}
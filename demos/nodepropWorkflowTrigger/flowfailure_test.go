@@ -0,0 +1,279 @@
+package flow_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// recordNotifier records the events it is sent and fails with Err.
+type recordNotifier struct {
+	Err    error
+	mu     sync.Mutex
+	events []flow.Event
+}
+
+func (n *recordNotifier) Notify(ctx context.Context, e flow.Event) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.events = append(n.events, e)
+	return n.Err
+}
+
+// handlerStep returns a failure handler dispatching to Cdaprod/ops.
+func handlerStep(name string) flow.FlowStep {
+	return flow.FlowStep{Name: name, Provider: flow.ProviderRepositoryDispatch, Repo: "Cdaprod/ops", EventType: name}
+}
+
+func TestFlowGraphOnFailure(t *testing.T) {
+	type handler struct {
+		name, status string
+	}
+	tests := []struct {
+		name            string
+		continueOnError bool
+		onFailure       *flow.StepFailure
+		fail            []string
+		notifyErr       error
+		wantStatus      string
+		wantTolerated   bool
+		wantHandlers    []handler
+		wantRan         []string
+		wantNotified    bool
+		wantErr         []string
+	}{
+		{
+			name:       "no handling",
+			fail:       []string{"deploy"},
+			wantStatus: flow.StepFailed,
+			wantRan:    []string{"deploy"},
+			wantErr:    []string{"step deploy: deploy failed"},
+		},
+		{
+			name:            "continue on error",
+			continueOnError: true,
+			fail:            []string{"deploy"},
+			wantStatus:      flow.StepFailed,
+			wantTolerated:   true,
+			wantRan:         []string{"deploy", "release"},
+		},
+		{
+			name:         "handlers in order",
+			onFailure:    &flow.StepFailure{Run: []string{"rollback", "page"}},
+			fail:         []string{"deploy", "rollback"},
+			wantStatus:   flow.StepFailed,
+			wantHandlers: []handler{{"rollback", flow.StepFailed}, {"page", flow.StepSucceeded}},
+			wantRan:      []string{"deploy", "rollback", "page"},
+			wantErr:      []string{"step deploy: deploy failed", "step deploy: handler rollback: rollback failed"},
+		},
+		{
+			name:         "notify",
+			onFailure:    &flow.StepFailure{Notify: true},
+			fail:         []string{"deploy"},
+			wantStatus:   flow.StepFailed,
+			wantRan:      []string{"deploy"},
+			wantNotified: true,
+			wantErr:      []string{"step deploy: deploy failed"},
+		},
+		{
+			name:         "notify fails",
+			onFailure:    &flow.StepFailure{Notify: true, Run: []string{"page"}},
+			fail:         []string{"deploy"},
+			notifyErr:    errors.New("webhook down"),
+			wantStatus:   flow.StepFailed,
+			wantHandlers: []handler{{"page", flow.StepSucceeded}},
+			wantRan:      []string{"deploy", "page"},
+			wantNotified: true,
+			wantErr:      []string{"step deploy: notify: webhook down"},
+		},
+		{
+			name:            "tolerated failure handled",
+			continueOnError: true,
+			onFailure:       &flow.StepFailure{Notify: true, Run: []string{"page"}},
+			fail:            []string{"deploy"},
+			wantStatus:      flow.StepFailed,
+			wantTolerated:   true,
+			wantHandlers:    []handler{{"page", flow.StepSucceeded}},
+			wantRan:         []string{"deploy", "page", "release"},
+			wantNotified:    true,
+		},
+		{
+			name:       "success not handled",
+			onFailure:  &flow.StepFailure{Notify: true, Run: []string{"rollback", "page"}},
+			wantStatus: flow.StepSucceeded,
+			wantRan:    []string{"deploy", "release"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deploy := workflowStep("deploy")
+			deploy.ContinueOnError, deploy.OnFailure = tt.continueOnError, tt.onFailure
+			def := &flow.FlowDefinition{
+				Name:     "release",
+				Steps:    []flow.FlowStep{deploy, workflowStep("release", "deploy")},
+				Handlers: []flow.FlowStep{handlerStep("rollback"), handlerStep("page")},
+			}
+			g, err := flow.CompileFlow(def)
+			if err != nil {
+				t.Fatal(err)
+			}
+			n := &recordNotifier{Err: tt.notifyErr}
+			g.Notifier = n
+			runner, ran := failSteps(tt.fail...)
+			exec, err := g.Run(context.Background(), runner)
+			for _, want := range tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), want) {
+					t.Errorf("Run() error = %v, want %q", err, want)
+				}
+			}
+			if len(tt.wantErr) == 0 && err != nil {
+				t.Errorf("Run() error = %v", err)
+			}
+			if st := exec.Step("deploy"); st.Status != tt.wantStatus || st.Tolerated != tt.wantTolerated {
+				t.Errorf("deploy = %+v, want %s, tolerated %v", st, tt.wantStatus, tt.wantTolerated)
+			}
+			if got := ran(); !slices.Equal(got, tt.wantRan) {
+				t.Errorf("ran %v, want %v", got, tt.wantRan)
+			}
+			if len(exec.Handlers) != len(tt.wantHandlers) {
+				t.Fatalf("handlers = %+v, want %v", exec.Handlers, tt.wantHandlers)
+			}
+			for i, h := range exec.Handlers {
+				if h.Name != tt.wantHandlers[i].name || h.Status != tt.wantHandlers[i].status || h.For != "deploy" || h.Attempts != 1 {
+					t.Errorf("handler %d = %+v, want %v for deploy", i, h, tt.wantHandlers[i])
+				}
+			}
+			if !tt.wantNotified {
+				if len(n.events) != 0 {
+					t.Errorf("notified %+v", n.events)
+				}
+				return
+			}
+			if len(n.events) != 1 {
+				t.Fatalf("notified %+v, want one event", n.events)
+			}
+			e := n.events[0]
+			if e.Type != flow.EventFlowStepFailed || e.Repo != "Cdaprod/site" || e.Workflow != "deploy.yml" || e.Status != "step deploy" || e.Actor != "flow:release" || e.Error != "deploy failed" || e.Time.IsZero() {
+				t.Errorf("event = %+v", e)
+			}
+		})
+	}
+}
+
+func TestFailureHandlerRetry(t *testing.T) {
+	deploy := workflowStep("deploy")
+	deploy.OnFailure = &flow.StepFailure{Run: []string{"rollback"}}
+	rollback := handlerStep("rollback")
+	rollback.Retry = &flow.StepRetry{MaxAttempts: 2}
+	g, err := flow.CompileFlow(&flow.FlowDefinition{Name: "release", Steps: []flow.FlowStep{deploy}, Handlers: []flow.FlowStep{rollback}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	runner := stepFunc(func(ctx context.Context, step flow.FlowStep) ([]flow.StepRun, error) {
+		keys = append(keys, flow.StepKey(ctx))
+		if step.Name == "deploy" || len(keys) == 2 {
+			return nil, errors.New(step.Name + " failed")
+		}
+		return nil, nil
+	})
+	exec, err := g.Run(context.Background(), runner)
+	if err == nil || strings.Contains(err.Error(), "handler rollback") {
+		t.Errorf("Run() error = %v, want only the step's failure", err)
+	}
+	if len(exec.Handlers) != 1 || exec.Handlers[0].Status != flow.StepSucceeded || exec.Handlers[0].Attempts != 2 {
+		t.Errorf("handlers = %+v, want rollback succeeding on its second attempt", exec.Handlers)
+	}
+	want := []string{exec.ID + "/deploy/1", exec.ID + "/deploy/on_failure/rollback/1", exec.ID + "/deploy/on_failure/rollback/2"}
+	if !slices.Equal(keys, want) {
+		t.Errorf("step keys = %v, want %v", keys, want)
+	}
+}
+
+func TestFlowGraphSaga(t *testing.T) {
+	tests := []struct {
+		name string
+		fail []string
+		// wantCompensations are the handlers run, in order, with their
+		// status.
+		wantCompensations []string
+		wantSkipped       []string
+		wantErr           []string
+	}{
+		{name: "succeeds"},
+		{
+			name:              "compensates in reverse",
+			fail:              []string{"deploy"},
+			wantCompensations: []string{"unmigrate for migrate succeeded", "unbuild for build succeeded"},
+			wantSkipped:       []string{"announce"},
+			wantErr:           []string{"step deploy: deploy failed"},
+		},
+		{
+			name:              "failed compensation",
+			fail:              []string{"deploy", "unmigrate"},
+			wantCompensations: []string{"unmigrate for migrate failed", "unbuild for build succeeded"},
+			wantSkipped:       []string{"announce"},
+			wantErr:           []string{"step deploy: deploy failed", "compensating step migrate: handler unmigrate: unmigrate failed"},
+		},
+		{
+			name:        "first step fails",
+			fail:        []string{"build"},
+			wantSkipped: []string{"migrate", "deploy", "announce"},
+			wantErr:     []string{"step build: build failed"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			build := workflowStep("build")
+			build.Compensate = "unbuild"
+			migrate := workflowStep("migrate", "build")
+			migrate.Compensate = "unmigrate"
+			// deploy has nothing to undo.
+			deploy := workflowStep("deploy", "migrate")
+			def := &flow.FlowDefinition{
+				Name:     "release",
+				Steps:    []flow.FlowStep{build, migrate, deploy, workflowStep("announce", "deploy")},
+				Handlers: []flow.FlowStep{handlerStep("unbuild"), handlerStep("unmigrate")},
+			}
+			g, err := flow.CompileFlow(def)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !g.Saga() {
+				t.Error("Saga() = false for a flow with compensations")
+			}
+			runner, _ := failSteps(tt.fail...)
+			exec, err := g.Run(context.Background(), runner)
+			for _, want := range tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), want) {
+					t.Errorf("Run() error = %v, want %q", err, want)
+				}
+			}
+			if len(tt.wantErr) == 0 && err != nil {
+				t.Errorf("Run() error = %v", err)
+			}
+			var got []string
+			for _, c := range exec.Compensations {
+				got = append(got, c.Name+" for "+c.For+" "+c.Status)
+			}
+			if !slices.Equal(got, tt.wantCompensations) {
+				t.Errorf("compensations = %v, want %v", got, tt.wantCompensations)
+			}
+			for _, name := range tt.wantSkipped {
+				if st := exec.Step(name); st.Status != flow.StepSkipped {
+					t.Errorf("step %s = %+v, want skipped", name, st)
+				}
+			}
+		})
+	}
+
+	g := compileFlow(t, workflowStep("build"))
+	if g.Saga() {
+		t.Error("Saga() = true for a flow without compensations")
+	}
+}
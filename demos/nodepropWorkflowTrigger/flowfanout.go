@@ -0,0 +1,157 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Fan-in modes of a StepFanOut.
+const (
+	// FanInAll waits for every run to succeed.
+	FanInAll = "all"
+	// FanInAny waits for one run to succeed.
+	FanInAny = "any"
+	// FanInQuorum waits for Quorum runs to succeed.
+	FanInQuorum = "quorum"
+)
+
+// StepFanOut dispatches a workflow_dispatch step to every registered
+// repository matching Selector instead of to one Repo, then fans in: the
+// step succeeds once enough of the runs have, as Wait says, and fails as
+// soon as too many have failed for that to happen.
+//
+//	steps:
+//	  - name: rebuild-consumers
+//	    provider: workflow_dispatch
+//	    workflow: rebuild.yml
+//	    fan_out:
+//	      selector: dependents:Cdaprod/lib-core
+//	      wait: quorum
+//	      quorum: 3
+//	  - name: integration
+//	    provider: workflow_dispatch
+//	    repo: Cdaprod/integration
+//	    workflow: suite.yml
+//	    needs: [rebuild-consumers]
+type StepFanOut struct {
+	// Selector chooses the repositories, as RepositoryRegistry.Select
+	// reads it.
+	Selector string `yaml:"selector" json:"selector"`
+	// Wait is FanInAll, the default, FanInAny, or FanInQuorum.
+	Wait   string `yaml:"wait,omitempty" json:"wait,omitempty"`
+	Quorum int    `yaml:"quorum,omitempty" json:"quorum,omitempty"`
+	// Concurrency bounds how many dispatches are in flight at once; it
+	// defaults to DefaultFanOutConcurrency.
+	Concurrency int `yaml:"concurrency,omitempty" json:"concurrency,omitempty"`
+}
+
+// validate checks the fan-in mode.
+func (f *StepFanOut) validate() error {
+	if f.Selector == "" {
+		return fmt.Errorf("fan_out selector is required")
+	}
+	switch f.Wait {
+	case "", FanInAll, FanInAny:
+		if f.Quorum != 0 {
+			return fmt.Errorf("fan_out quorum needs wait: %s", FanInQuorum)
+		}
+	case FanInQuorum:
+		if f.Quorum < 1 {
+			return fmt.Errorf("fan_out quorum must be at least 1")
+		}
+	default:
+		return fmt.Errorf("unknown fan_out wait %q (want %s, %s, or %s)", f.Wait, FanInAll, FanInAny, FanInQuorum)
+	}
+	if f.Concurrency < 0 {
+		return fmt.Errorf("fan_out concurrency must not be negative")
+	}
+	return nil
+}
+
+// Needed returns how many of n runs must succeed for the step to succeed.
+func (f *StepFanOut) Needed(n int) int {
+	switch f.Wait {
+	case FanInAny:
+		return 1
+	case FanInQuorum:
+		return f.Quorum
+	}
+	return n
+}
+
+// awaited is a fan-out run that concluded, or could not be followed.
+type awaited struct {
+	i   int
+	rec *DispatchRecord
+	err error
+}
+
+// fanOut dispatches step to the repositories its selector matches and
+// waits until enough runs have succeeded, or too many failed. Runs still
+// going when it returns are left to finish on their own.
+func (r *FlowRunner) fanOut(ctx context.Context, step FlowStep) ([]StepRun, error) {
+	if r.Registry == nil {
+		return nil, errors.New("fan_out needs a registry")
+	}
+	entries, err := r.Registry.Select(step.FanOut.Selector)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("selector %q matches no repositories", step.FanOut.Selector)
+	}
+	reqs := make([]DispatchRequest, len(entries))
+	for i, e := range entries {
+		reqs[i] = DispatchRequest{Repo: e.Name, Workflow: step.Workflow, Ref: step.Ref, Inputs: step.Inputs}
+		if key := StepKey(ctx); key != "" {
+			reqs[i].IdempotencyKey = key + "/" + e.Name
+		}
+	}
+	need := step.FanOut.Needed(len(reqs))
+	if need > len(reqs) {
+		return nil, fmt.Errorf("quorum of %d but selector %q matches %d repositories", need, step.FanOut.Selector, len(reqs))
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	res := r.Correlator.FanOut(ctx, "flow step "+step.Name, "", reqs, step.FanOut.Concurrency)
+	recs := make([]DispatchRecord, len(reqs))
+	// Buffered so the followers left running on return do not block.
+	done := make(chan awaited, len(reqs))
+	var errs []error
+	pending, succeeded, failed := 0, 0, 0
+	for i, sr := range res.Results {
+		recs[i] = DispatchRecord{Repo: sr.Request.Repo, Workflow: sr.Request.Workflow, Ref: sr.Request.Ref}
+		if sr.Record != nil {
+			recs[i] = *sr.Record
+		}
+		if sr.Err != nil && !(errors.Is(sr.Err, ErrAlreadyDispatched) && sr.Record != nil) {
+			failed++
+			errs = append(errs, fmt.Errorf("%s: %w", sr.Request.Repo, sr.Err))
+			continue
+		}
+		pending++
+		go func(i int, rec DispatchRecord) {
+			next, err := r.await(ctx, rec)
+			done <- awaited{i: i, rec: next, err: err}
+		}(i, recs[i])
+	}
+	for pending > 0 && succeeded < need && len(reqs)-failed >= need {
+		a := <-done
+		pending--
+		if a.rec != nil {
+			recs[a.i] = *a.rec
+		}
+		if a.err != nil {
+			failed++
+			errs = append(errs, fmt.Errorf("%s: %w", recs[a.i].Repo, a.err))
+		} else {
+			succeeded++
+		}
+	}
+	if succeeded >= need {
+		return newStepRuns(recs), nil
+	}
+	return newStepRuns(recs), fmt.Errorf("%d of %d runs succeeded, %d needed: %w", succeeded, len(reqs), need, errors.Join(errs...))
+}
@@ -0,0 +1,140 @@
+package flow_test
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+func TestStepFanOutNeeded(t *testing.T) {
+	tests := []struct {
+		f    flow.StepFanOut
+		want int
+	}{
+		{f: flow.StepFanOut{}, want: 5},
+		{f: flow.StepFanOut{Wait: flow.FanInAll}, want: 5},
+		{f: flow.StepFanOut{Wait: flow.FanInAny}, want: 1},
+		{f: flow.StepFanOut{Wait: flow.FanInQuorum, Quorum: 3}, want: 3},
+	}
+	for _, tt := range tests {
+		if got := tt.f.Needed(5); got != tt.want {
+			t.Errorf("%+v Needed(5) = %d, want %d", tt.f, got, tt.want)
+		}
+	}
+}
+
+func TestFanOutStep(t *testing.T) {
+	// Runs that never conclude during the test.
+	slow := nodeproptest.Outcome{Duration: time.Hour}
+	failure := nodeproptest.Outcome{Conclusion: "failure"}
+	tests := []struct {
+		name     string
+		fanOut   flow.StepFanOut
+		outcomes map[string]nodeproptest.Outcome
+		// missing repositories have no rebuild.yml, so their dispatch
+		// fails.
+		missing    []string
+		noRegistry bool
+		wantErr    string
+		wantRuns   int
+	}{
+		{name: "all", fanOut: flow.StepFanOut{Selector: "tag:web"}, wantRuns: 3},
+		{
+			name:     "all fails at the first failure",
+			fanOut:   flow.StepFanOut{Selector: "tag:web"},
+			outcomes: map[string]nodeproptest.Outcome{"Cdaprod/a": failure, "Cdaprod/b": slow, "Cdaprod/c": slow},
+			wantErr:  "0 of 3 runs succeeded, 3 needed",
+			wantRuns: 3,
+		},
+		{
+			name:     "any returns at the first success",
+			fanOut:   flow.StepFanOut{Selector: "tag:web", Wait: flow.FanInAny},
+			outcomes: map[string]nodeproptest.Outcome{"Cdaprod/a": failure, "Cdaprod/b": slow, "Cdaprod/c": {}},
+			wantRuns: 3,
+		},
+		{
+			name:     "quorum",
+			fanOut:   flow.StepFanOut{Selector: "tag:web", Wait: flow.FanInQuorum, Quorum: 2},
+			outcomes: map[string]nodeproptest.Outcome{"Cdaprod/a": failure},
+			wantRuns: 3,
+		},
+		{
+			name:     "quorum out of reach",
+			fanOut:   flow.StepFanOut{Selector: "tag:web", Wait: flow.FanInQuorum, Quorum: 2},
+			outcomes: map[string]nodeproptest.Outcome{"Cdaprod/a": failure, "Cdaprod/b": failure, "Cdaprod/c": slow},
+			wantErr:  "0 of 3 runs succeeded, 2 needed",
+			wantRuns: 3,
+		},
+		{name: "quorum above matches", fanOut: flow.StepFanOut{Selector: "tag:web", Wait: flow.FanInQuorum, Quorum: 4}, wantErr: "quorum of 4 but selector \"tag:web\" matches 3 repositories"},
+		{name: "failed dispatch", fanOut: flow.StepFanOut{Selector: "tag:web", Wait: flow.FanInQuorum, Quorum: 3}, missing: []string{"Cdaprod/c"}, wantErr: "Cdaprod/c: ", wantRuns: 3},
+		{name: "failed dispatch tolerated", fanOut: flow.StepFanOut{Selector: "tag:web", Wait: flow.FanInAny}, missing: []string{"Cdaprod/c"}, wantRuns: 3},
+		{name: "selector", fanOut: flow.StepFanOut{Selector: "Cdaprod/a,tag:web"}, wantRuns: 1},
+		{name: "no matches", fanOut: flow.StepFanOut{Selector: "tag:cli"}, wantErr: `selector "tag:cli" matches no repositories`},
+		{name: "no registry", fanOut: flow.StepFanOut{Selector: "tag:web"}, noRegistry: true, wantErr: "fan_out needs a registry"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := nodeproptest.NewServer()
+			defer gh.Close()
+			reg := flow.NewRepositoryRegistry()
+			for _, repo := range []string{"Cdaprod/a", "Cdaprod/b", "Cdaprod/c"} {
+				reg.SetRepo(flow.RepoEntry{Name: repo, Tags: []string{"web"}})
+				if !slices.Contains(tt.missing, repo) {
+					gh.AddWorkflow(repo, "rebuild.yml")
+				}
+				gh.SetOutcome(repo, "rebuild.yml", tt.outcomes[repo])
+			}
+			r := &flow.FlowRunner{Correlator: newCorrelator(t, gh), Registry: reg, PollInterval: time.Millisecond}
+			if tt.noRegistry {
+				r.Registry = nil
+			}
+			f := tt.fanOut
+			step := flow.FlowStep{Name: "rebuild", Provider: flow.ProviderWorkflowDispatch, Workflow: "rebuild.yml", Ref: "main", FanOut: &f}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			runs, err := r.RunStep(ctx, step)
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("RunStep() error = %v, want %q", err, tt.wantErr)
+			}
+			if len(runs) != tt.wantRuns {
+				t.Fatalf("runs = %+v, want %d", runs, tt.wantRuns)
+			}
+			for _, run := range runs {
+				if run.Repo == "" || slices.Contains(tt.missing, run.Repo) != (run.Dispatch == "") {
+					t.Errorf("run = %+v", run)
+				}
+			}
+		})
+	}
+}
+
+func TestFanOutStepKeys(t *testing.T) {
+	gh := nodeproptest.NewServer()
+	defer gh.Close()
+	reg := flow.NewRepositoryRegistry()
+	for _, repo := range []string{"Cdaprod/a", "Cdaprod/b"} {
+		reg.SetRepo(flow.RepoEntry{Name: repo, Tags: []string{"web"}})
+		gh.AddWorkflow(repo, "rebuild.yml")
+	}
+	c := newCorrelator(t, gh)
+	g := compileFlow(t, flow.FlowStep{Name: "rebuild", Provider: flow.ProviderWorkflowDispatch, Workflow: "rebuild.yml", Ref: "main", FanOut: &flow.StepFanOut{Selector: "tag:web"}})
+	exec, err := g.Run(context.Background(), &flow.FlowRunner{Correlator: c, Registry: reg, PollInterval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs := exec.Step("rebuild").Runs
+	if len(runs) != 2 {
+		t.Fatalf("runs = %+v, want one per repository", runs)
+	}
+	for _, run := range runs {
+		recs, err := c.History.List(run.Repo)
+		if want := exec.ID + "/rebuild/1/" + run.Repo; err != nil || len(recs) != 1 || recs[0].IdempotencyKey != want {
+			t.Errorf("history of %s = %+v, want a dispatch with idempotency key %q", run.Repo, recs, want)
+		}
+	}
+}
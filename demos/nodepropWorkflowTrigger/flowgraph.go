@@ -0,0 +1,585 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/cel-go/cel"
+)
+
+// DefaultStepPollInterval is how often a FlowRunner checks on the run of a
+// workflow_dispatch step.
+const DefaultStepPollInterval = 15 * time.Second
+
+// Statuses of a StepState.
+const (
+	StepPending   = "pending"
+	StepRunning   = "running"
+	StepSucceeded = "succeeded"
+	StepFailed    = "failed"
+	// StepSkipped is a step that never ran because a step it needs did not
+	// succeed.
+	StepSkipped = "skipped"
+	// StepOmitted is a step that never ran because its When expression was
+	// false. Steps that need it run as if it had succeeded.
+	StepOmitted = "omitted"
+)
+
+// StepRunner runs one flow step to completion: for a workflow, until its
+// run concludes. An error means the step failed. The runs are the
+// dispatches the step made, one per repository of a fan-out, with the
+// outputs of the run if the step has Outputs.
+type StepRunner interface {
+	RunStep(ctx context.Context, step FlowStep) ([]StepRun, error)
+}
+
+// FlowGraph is a validated FlowDefinition ready to run. Create it with
+// CompileFlow.
+type FlowGraph struct {
+	Def *FlowDefinition
+	// Clock times the steps and their retries; nil means SystemClock.
+	Clock Clock
+	// Registry provides the repo and registry variables of When
+	// expressions.
+	Registry *RepositoryRegistry
+	// Notifier receives the EventFlowStepFailed of steps whose OnFailure
+	// asks to notify.
+	Notifier Notifier
+	// Store, if set, keeps each execution as it progresses, so that Resume
+	// can continue it after a crash or restart.
+	Store    FlowStore
+	Logger   Logger
+	order    []string
+	steps    map[string]FlowStep
+	handlers map[string]FlowStep
+	when     map[string]cel.Program
+}
+
+// CompileFlow validates def and returns its graph.
+func CompileFlow(def *FlowDefinition) (*FlowGraph, error) {
+	if err := def.Validate(); err != nil {
+		return nil, err
+	}
+	order, err := def.order()
+	if err != nil {
+		return nil, err
+	}
+	env, err := flowEnv()
+	if err != nil {
+		return nil, err
+	}
+	g := &FlowGraph{Def: def, order: order, steps: make(map[string]FlowStep, len(def.Steps)), handlers: map[string]FlowStep{}, when: map[string]cel.Program{}}
+	for _, h := range def.Handlers {
+		g.handlers[h.Name] = h
+	}
+	for _, s := range def.Steps {
+		g.steps[s.Name] = s
+		if s.When != "" {
+			if g.when[s.Name], err = compileWhen(env, s.When); err != nil {
+				return nil, fmt.Errorf("step %s: %w", s.Name, err)
+			}
+		}
+	}
+	return g, nil
+}
+
+// Order returns the step names so that each comes after those it needs.
+func (g *FlowGraph) Order() []string {
+	return append([]string(nil), g.order...)
+}
+
+// StepState is the progress of one step of a FlowExecution.
+type StepState struct {
+	Name     string `json:"name" yaml:"name"`
+	Status   string `json:"status" yaml:"status"`
+	Attempts int    `json:"attempts,omitempty" yaml:"attempts,omitempty"`
+	// Runs are the dispatches of the step's last attempt.
+	Runs  []StepRun `json:"runs,omitempty" yaml:"runs,omitempty"`
+	Error string    `json:"error,omitempty" yaml:"error,omitempty"`
+	// Tolerated is set on a failed step with ContinueOnError.
+	Tolerated bool `json:"tolerated,omitempty" yaml:"tolerated,omitempty"`
+	// Outputs are the outputs of the step's run, if it has Outputs and
+	// succeeded.
+	Outputs map[string]string `json:"outputs,omitempty" yaml:"outputs,omitempty"`
+	// For is, on a failure handler, the step whose failure it handled.
+	For        string    `json:"for,omitempty" yaml:"for,omitempty"`
+	StartedAt  time.Time `json:"started_at,omitempty" yaml:"started_at,omitempty"`
+	FinishedAt time.Time `json:"finished_at,omitempty" yaml:"finished_at,omitempty"`
+}
+
+// StepRun is one dispatch of a step and the run it started.
+type StepRun struct {
+	Repo       string `json:"repo" yaml:"repo"`
+	Dispatch   string `json:"dispatch,omitempty" yaml:"dispatch,omitempty"`
+	RunID      int64  `json:"run_id,omitempty" yaml:"run_id,omitempty"`
+	RunURL     string `json:"run_url,omitempty" yaml:"run_url,omitempty"`
+	Conclusion string `json:"conclusion,omitempty" yaml:"conclusion,omitempty"`
+	// Outputs are what the run uploaded as the step's outputs artifact.
+	Outputs map[string]string `json:"outputs,omitempty" yaml:"outputs,omitempty"`
+}
+
+func newStepRuns(recs []DispatchRecord) []StepRun {
+	var runs []StepRun
+	for _, rec := range recs {
+		runs = append(runs, StepRun{Repo: rec.Repo, Dispatch: rec.ID, RunID: rec.RunID, RunURL: rec.RunURL, Conclusion: rec.Conclusion})
+	}
+	return runs
+}
+
+// Done reports whether the step will not change any more.
+func (s *StepState) Done() bool {
+	return s.Status != StepPending && s.Status != StepRunning
+}
+
+// satisfied reports whether steps that need s may run.
+func (s *StepState) satisfied() bool {
+	return s.Status == StepSucceeded || s.Status == StepOmitted || s.Tolerated
+}
+
+// FlowExecution is one run of a flow. Steps follow the definition's order.
+// FinishedAt stays zero until the execution has nothing left to do, so an
+// execution saved without it can be resumed.
+type FlowExecution struct {
+	// ID is also the correlation ID of the execution's dispatches.
+	ID   string `json:"id" yaml:"id"`
+	Flow string `json:"flow" yaml:"flow"`
+	// Version and Digest are those of the definition the execution ran.
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+	Digest  string `json:"digest,omitempty" yaml:"digest,omitempty"`
+	// Event is the event that started the flow, for When expressions.
+	Event InboundEvent `json:"event" yaml:"event"`
+	Steps []StepState  `json:"steps" yaml:"steps"`
+	// Handlers are the failure handlers that ran, in the order they did.
+	Handlers []StepState `json:"handlers,omitempty" yaml:"handlers,omitempty"`
+	// Compensations are the Compensate handlers a failed saga ran, in the
+	// order it did.
+	Compensations []StepState `json:"compensations,omitempty" yaml:"compensations,omitempty"`
+	StartedAt     time.Time   `json:"started_at" yaml:"started_at"`
+	FinishedAt    time.Time   `json:"finished_at,omitempty" yaml:"finished_at,omitempty"`
+}
+
+// Step returns the state of the named step, or nil.
+func (e *FlowExecution) Step(name string) *StepState {
+	for i := range e.Steps {
+		if e.Steps[i].Name == name {
+			return &e.Steps[i]
+		}
+	}
+	return nil
+}
+
+// finished returns the steps that are done, in the order they finished.
+func (e *FlowExecution) finished() []StepState {
+	var out []StepState
+	for _, s := range e.Steps {
+		if s.Done() {
+			out = append(out, s)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].FinishedAt.Before(out[j].FinishedAt) })
+	return out
+}
+
+// Status returns FlowUnfinished until the execution finishes, then
+// FlowSucceeded or FlowFailed.
+func (e *FlowExecution) Status() string {
+	switch {
+	case e.FinishedAt.IsZero():
+		return FlowUnfinished
+	case e.Succeeded():
+		return FlowSucceeded
+	}
+	return FlowFailed
+}
+
+// Succeeded reports whether every step succeeded, was omitted, or failed
+// with its failure tolerated.
+func (e *FlowExecution) Succeeded() bool {
+	for _, s := range e.Steps {
+		if !s.satisfied() {
+			return false
+		}
+	}
+	return true
+}
+
+// stepDone is the outcome of one attempt loop of a step, and of its
+// failure handlers.
+type stepDone struct {
+	name       string
+	runs       []StepRun
+	attempts   int
+	err        error
+	handlers   []StepState
+	handlerErr error
+}
+
+// Run runs the flow's steps with runner, each as soon as the steps it
+// needs have succeeded and its When expression holds, and skips those with
+// a need that failed. Steps that do not depend on each other run at once.
+// A failed step is retried as its Retry says. In a saga, a step failing
+// stops any more from starting and, once those running are done,
+// compensates the steps that succeeded. Run returns when every step is
+// done or ctx is, with the failures joined into the error.
+func (g *FlowGraph) Run(ctx context.Context, runner StepRunner) (*FlowExecution, error) {
+	return g.RunEvent(ctx, InboundEvent{}, runner)
+}
+
+// RunEvent is Run for a flow started by ev, which When expressions see as
+// event.
+func (g *FlowGraph) RunEvent(ctx context.Context, ev InboundEvent, runner StepRunner) (*FlowExecution, error) {
+	id, err := NewCorrelationID()
+	if err != nil {
+		return nil, err
+	}
+	exec := &FlowExecution{ID: id, Flow: g.Def.Name, Version: g.Def.Version, Digest: g.Def.Digest(), Event: ev, StartedAt: ClockOr(g.Clock).Now()}
+	for _, s := range g.Def.Steps {
+		exec.Steps = append(exec.Steps, StepState{Name: s.Name, Status: StepPending})
+	}
+	return g.run(ctx, exec, runner)
+}
+
+// Resume continues exec, an unfinished execution of the flow loaded from
+// a FlowStore after the process running it stopped. Steps that are done
+// stay done, and steps that were running run again: a workflow dispatch
+// they had made is found by its idempotency key and followed instead of
+// being made twice. The definition must be the one exec started with, so
+// that an execution never mixes two versions of a flow.
+func (g *FlowGraph) Resume(ctx context.Context, exec *FlowExecution, runner StepRunner) (*FlowExecution, error) {
+	if exec.Flow != g.Def.Name {
+		return nil, fmt.Errorf("execution %s is of flow %s, not %s", exec.ID, exec.Flow, g.Def.Name)
+	}
+	if !exec.FinishedAt.IsZero() {
+		return nil, fmt.Errorf("execution %s already finished", exec.ID)
+	}
+	if digest := g.Def.Digest(); exec.Digest != "" && exec.Digest != digest {
+		return nil, fmt.Errorf("execution %s started with another definition of flow %s (digest %s, now %s)", exec.ID, exec.Flow, exec.Digest, digest)
+	}
+	for _, name := range g.order {
+		if exec.Step(name) == nil {
+			return nil, fmt.Errorf("execution %s has no step %s; was the flow changed?", exec.ID, name)
+		}
+	}
+	for i := range exec.Steps {
+		if st := &exec.Steps[i]; st.Status == StepRunning {
+			st.Status = StepPending
+		}
+	}
+	return g.run(ctx, exec, runner)
+}
+
+// run runs the pending steps of exec, saving it to g.Store as it changes.
+func (g *FlowGraph) run(ctx context.Context, exec *FlowExecution, runner StepRunner) (*FlowExecution, error) {
+	clock := ClockOr(g.Clock)
+	if ValidCorrelationID(exec.ID) {
+		ctx = WithCorrelationID(ctx, exec.ID)
+	}
+	// Steps run under the flow's deadline; failure handlers and
+	// compensations, which clean up after them, under base.
+	base := ctx
+	if g.Def.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(base, exec.StartedAt.Add(g.Def.Timeout).Sub(clock.Now()))
+		defer cancel()
+	}
+	done := make(chan stepDone)
+	running := 0
+	var errs []error
+	// succeeded lists the steps that succeeded, in order, for compensation;
+	// aborted stops a saga from starting steps after one failed.
+	var succeeded []string
+	aborted := false
+	for _, st := range exec.finished() {
+		switch {
+		case st.Status == StepSucceeded:
+			succeeded = append(succeeded, st.Name)
+		case st.Status == StepFailed && !st.Tolerated:
+			errs = append(errs, fmt.Errorf("step %s: %s", st.Name, st.Error))
+			aborted = g.Saga()
+		}
+	}
+	for {
+		for _, name := range g.order {
+			st := exec.Step(name)
+			if st.Status != StepPending {
+				continue
+			}
+			switch g.readiness(exec, name) {
+			case StepSkipped:
+				st.Status, st.FinishedAt = StepSkipped, clock.Now()
+			case StepRunning:
+				if ctx.Err() != nil || aborted {
+					continue
+				}
+				ok, err := g.When(name, ConditionEnv{Event: exec.Event, Steps: exec.Steps, Registry: g.Registry})
+				step := g.steps[name]
+				if err == nil && ok {
+					step, err = expandOutputs(step, exec)
+				}
+				if err != nil {
+					st.Status, st.Error, st.FinishedAt = StepFailed, err.Error(), clock.Now()
+					errs = append(errs, fmt.Errorf("step %s: %w", name, err))
+					aborted = g.Saga()
+					continue
+				}
+				if !ok {
+					st.Status, st.FinishedAt = StepOmitted, clock.Now()
+					continue
+				}
+				st.Status, st.StartedAt = StepRunning, clock.Now()
+				running++
+				go func(step FlowStep) {
+					d := stepDone{name: step.Name}
+					d.runs, d.attempts, d.err = g.runStep(ctx, runner, clock, exec.ID+"/"+step.Name, step)
+					if d.err != nil && base.Err() == nil {
+						d.handlers, d.handlerErr = g.onFailure(base, runner, clock, exec.ID+"/"+step.Name, step, d.err)
+					}
+					done <- d
+				}(step)
+			}
+		}
+		g.save(exec)
+		if running == 0 {
+			break
+		}
+		d := <-done
+		running--
+		st := exec.Step(d.name)
+		if base.Err() != nil && ErrorClass(d.err) == ErrorCancelled {
+			// Interrupted rather than failed: the step stays running for
+			// Resume to run again.
+			st.Runs = d.runs
+			continue
+		}
+		st.Attempts, st.FinishedAt, st.Runs = d.attempts, clock.Now(), d.runs
+		if d.err == nil && len(d.runs) == 1 {
+			st.Outputs = d.runs[0].Outputs
+		}
+		exec.Handlers = append(exec.Handlers, d.handlers...)
+		if d.err != nil && g.Def.CancelRuns && timedOut(base, ctx) {
+			if err := cancelRuns(base, runner, g.steps[d.name], d.runs); err != nil {
+				errs = append(errs, fmt.Errorf("step %s: %w", d.name, err))
+			}
+		}
+		if d.handlerErr != nil {
+			errs = append(errs, fmt.Errorf("step %s: %w", d.name, d.handlerErr))
+		}
+		switch {
+		case d.err == nil:
+			st.Status = StepSucceeded
+			succeeded = append(succeeded, d.name)
+		case g.steps[d.name].ContinueOnError:
+			st.Status, st.Error, st.Tolerated = StepFailed, d.err.Error(), true
+		default:
+			st.Status, st.Error = StepFailed, d.err.Error()
+			errs = append(errs, fmt.Errorf("step %s: %w", d.name, d.err))
+			aborted = g.Saga()
+		}
+	}
+	if timedOut(base, ctx) {
+		for i := range exec.Steps {
+			if st := &exec.Steps[i]; st.Status == StepPending {
+				st.Status, st.Error, st.FinishedAt = StepSkipped, "the flow timed out", clock.Now()
+			}
+		}
+		errs = append(errs, fmt.Errorf("flow %s timed out after %s", g.Def.Name, g.Def.Timeout))
+	}
+	if aborted {
+		for i := range exec.Steps {
+			if st := &exec.Steps[i]; st.Status == StepPending {
+				st.Status, st.Error, st.FinishedAt = StepSkipped, "the flow failed", clock.Now()
+			}
+		}
+		if err := g.compensate(base, runner, clock, exec, succeeded); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := base.Err(); err != nil {
+		// The execution is left unfinished, to be resumed.
+		return exec, errors.Join(append(errs, err)...)
+	}
+	exec.FinishedAt = clock.Now()
+	g.save(exec)
+	return exec, errors.Join(errs...)
+}
+
+// RunCanceler is a StepRunner that can cancel the runs of a step, which a
+// flow with CancelRuns asks of it for the steps its timeout stopped.
+type RunCanceler interface {
+	CancelRuns(ctx context.Context, step FlowStep, runs []StepRun) error
+}
+
+// cancelRuns cancels the runs of step that have not concluded.
+func cancelRuns(ctx context.Context, runner StepRunner, step FlowStep, runs []StepRun) error {
+	var open []StepRun
+	for _, r := range runs {
+		if r.Conclusion == "" && r.Dispatch != "" {
+			open = append(open, r)
+		}
+	}
+	if len(open) == 0 {
+		return nil
+	}
+	rc, ok := runner.(RunCanceler)
+	if !ok {
+		return fmt.Errorf("%d runs left running: the step runner cannot cancel them", len(open))
+	}
+	return rc.CancelRuns(ctx, step, open)
+}
+
+// timedOut reports whether ctx, derived from base, ran out of the flow's
+// time while base did not.
+func timedOut(base, ctx context.Context) bool {
+	return base.Err() == nil && errors.Is(ctx.Err(), context.DeadlineExceeded)
+}
+
+// save writes exec to g.Store, if set. A failure is logged rather than
+// stopping the flow, which loses no more than the ability to resume.
+func (g *FlowGraph) save(exec *FlowExecution) {
+	if g.Store == nil {
+		return
+	}
+	if err := g.Store.Save(exec); err != nil {
+		LoggerOr(g.Logger).Warn("failed to save flow execution", "flow", exec.Flow, "execution", exec.ID, "error", err)
+	}
+}
+
+// readiness returns StepRunning if the step can start, StepSkipped if a
+// step it needs did not succeed, or StepPending.
+func (g *FlowGraph) readiness(exec *FlowExecution, name string) string {
+	for _, need := range g.steps[name].Needs {
+		st := exec.Step(need)
+		switch {
+		case st.satisfied():
+		case st.Done():
+			return StepSkipped
+		default:
+			return StepPending
+		}
+	}
+	return StepRunning
+}
+
+// stepKey is the context key of the idempotency key of a step attempt.
+type stepKey struct{}
+
+// StepKey returns the idempotency key of the step attempt ctx was passed to
+// RunStep for: the same on every run of the attempt, including one resumed
+// after a crash, and different for every other attempt, step, and
+// execution. A StepRunner passes it on so that resuming an execution does
+// not dispatch an attempt twice.
+func StepKey(ctx context.Context) string {
+	key, _ := ctx.Value(stepKey{}).(string)
+	return key
+}
+
+// runStep runs step until it succeeds or its retries are used up. Each
+// attempt's StepKey is key and the attempt number.
+func (g *FlowGraph) runStep(ctx context.Context, runner StepRunner, clock Clock, key string, step FlowStep) ([]StepRun, int, error) {
+	for attempt := 1; ; attempt++ {
+		runs, err := runner.RunStep(context.WithValue(ctx, stepKey{}, fmt.Sprintf("%s/%d", key, attempt)), step)
+		if err == nil || attempt >= step.Retry.attempts() || ErrorClass(err) == ErrorCancelled {
+			return runs, attempt, err
+		}
+		select {
+		case <-ctx.Done():
+			return runs, attempt, err
+		case <-clock.After(step.Retry.delay(attempt + 1)):
+		}
+	}
+}
+
+// FlowRunner runs flow steps against GitHub: workflow_dispatch steps are
+// submitted through Correlator, with the StepKey as idempotency key, and
+// followed until their run concludes, which must be a success;
+// repository_dispatch steps are sent with its client; other providers are
+// built with NewProvider and triggered with the client's token. Only
+// workflow dispatches are safe from being repeated when an execution is
+// resumed.
+type FlowRunner struct {
+	Correlator *RunCorrelator
+	// Registry resolves the selectors of fan-out steps.
+	Registry *RepositoryRegistry
+	// PollInterval is how often a run is checked; 0 means
+	// DefaultStepPollInterval.
+	PollInterval time.Duration
+	// Options configure the triggers of other providers.
+	Options []Option
+}
+
+// RunStep runs step.
+func (r *FlowRunner) RunStep(ctx context.Context, step FlowStep) ([]StepRun, error) {
+	c := r.Correlator
+	switch {
+	case step.FanOut != nil:
+		return r.fanOut(ctx, step)
+	case step.Provider == ProviderWorkflowDispatch:
+		rec, err := c.Submit(ctx, DispatchRequest{Repo: step.Repo, Workflow: step.Workflow, Ref: step.Ref, Inputs: step.Inputs, IdempotencyKey: StepKey(ctx)})
+		if err != nil && !(errors.Is(err, ErrAlreadyDispatched) && rec != nil) {
+			return nil, err
+		}
+		rec, err = r.await(ctx, *rec)
+		runs := newStepRuns([]DispatchRecord{*rec})
+		if err == nil && step.Outputs != nil {
+			if runs[0].Outputs, err = c.Client.RunOutputs(ctx, rec.Repo, rec.RunID, step.Outputs.artifact()); err != nil {
+				err = fmt.Errorf("outputs: %w", err)
+			}
+		}
+		return runs, err
+	case step.Provider == ProviderRepositoryDispatch:
+		return nil, c.Client.RepositoryDispatch(ctx, step.Repo, step.EventType, step.Inputs)
+	}
+	t, err := NewProvider(step.Provider, step.Settings, r.Options...)
+	if err != nil {
+		return nil, err
+	}
+	token, err := c.Client.token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return nil, runTrigger(ctx, t, step.Repo, step.Inputs, token)
+}
+
+// CancelRuns cancels the runs of step. A run that GitHub has not matched to
+// its dispatch yet cannot be cancelled, and is reported.
+func (r *FlowRunner) CancelRuns(ctx context.Context, step FlowStep, runs []StepRun) error {
+	var errs []error
+	for _, run := range runs {
+		rec := DispatchRecord{ID: run.Dispatch, CorrelationID: CorrelationID(ctx), Repo: run.Repo, Workflow: step.Workflow, RunID: run.RunID}
+		if err := r.Correlator.Cancel(ctx, rec); err != nil {
+			errs = append(errs, fmt.Errorf("cancel run in %s: %w", run.Repo, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// await resolves rec until its run completes.
+func (r *FlowRunner) await(ctx context.Context, rec DispatchRecord) (*DispatchRecord, error) {
+	interval := r.PollInterval
+	if interval <= 0 {
+		interval = DefaultStepPollInterval
+	}
+	clock := ClockOr(r.Correlator.Clock)
+	for {
+		next, err := r.Correlator.Resolve(ctx, rec)
+		if err == nil {
+			rec = next
+		} else if ErrorClass(err) == ErrorCancelled {
+			return &rec, err
+		}
+		if rec.Completed() {
+			if rec.Conclusion != "success" {
+				return &rec, fmt.Errorf("run of %s in %s concluded %s", rec.Workflow, rec.Repo, rec.Conclusion)
+			}
+			return &rec, nil
+		}
+		select {
+		case <-ctx.Done():
+			return &rec, ctx.Err()
+		case <-clock.After(interval):
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package flow_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+// stepFunc is a StepRunner that calls itself.
+type stepFunc func(ctx context.Context, step flow.FlowStep) ([]flow.StepRun, error)
+
+func (f stepFunc) RunStep(ctx context.Context, step flow.FlowStep) ([]flow.StepRun, error) {
+	return f(ctx, step)
+}
+
+// failSteps returns a StepRunner failing the named steps and recording the
+// steps it ran.
+func failSteps(fail ...string) (flow.StepRunner, func() []string) {
+	var mu sync.Mutex
+	var ran []string
+	runner := stepFunc(func(ctx context.Context, step flow.FlowStep) ([]flow.StepRun, error) {
+		mu.Lock()
+		ran = append(ran, step.Name)
+		mu.Unlock()
+		if slices.Contains(fail, step.Name) {
+			return nil, fmt.Errorf("%s failed", step.Name)
+		}
+		return []flow.StepRun{{Repo: step.Repo, Conclusion: "success"}}, nil
+	})
+	return runner, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), ran...)
+	}
+}
+
+// workflowStep returns a workflow_dispatch step of Cdaprod/site needing
+// needs.
+func workflowStep(name string, needs ...string) flow.FlowStep {
+	return flow.FlowStep{Name: name, Provider: flow.ProviderWorkflowDispatch, Repo: "Cdaprod/site", Workflow: name + ".yml", Ref: "main", Needs: needs}
+}
+
+func compileFlow(t *testing.T, steps ...flow.FlowStep) *flow.FlowGraph {
+	t.Helper()
+	g, err := flow.CompileFlow(&flow.FlowDefinition{Name: "release", Steps: steps})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestFlowGraphOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []flow.FlowStep
+		want  []string
+	}{
+		{name: "definition order", steps: []flow.FlowStep{workflowStep("a"), workflowStep("b")}, want: []string{"a", "b"}},
+		{name: "needs first", steps: []flow.FlowStep{workflowStep("deploy", "build"), workflowStep("build")}, want: []string{"build", "deploy"}},
+		{
+			name:  "diamond",
+			steps: []flow.FlowStep{workflowStep("release", "test", "lint"), workflowStep("test", "build"), workflowStep("lint", "build"), workflowStep("build")},
+			want:  []string{"build", "test", "lint", "release"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compileFlow(t, tt.steps...).Order(); !slices.Equal(got, tt.want) {
+				t.Errorf("Order() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := flow.CompileFlow(&flow.FlowDefinition{Name: "f", Steps: []flow.FlowStep{workflowStep("a", "b"), workflowStep("b", "a")}}); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("CompileFlow() of a cycle error = %v", err)
+	}
+}
+
+func TestFlowGraphRun(t *testing.T) {
+	diamond := []flow.FlowStep{workflowStep("build"), workflowStep("test", "build"), workflowStep("lint", "build"), workflowStep("release", "test", "lint")}
+	tests := []struct {
+		name  string
+		steps []flow.FlowStep
+		fail  []string
+		want  map[string]string
+		// wantRan are the steps that must run, in order where one needs
+		// another.
+		wantRan []string
+		wantErr string
+	}{
+		{
+			name:    "all succeed",
+			steps:   diamond,
+			want:    map[string]string{"build": flow.StepSucceeded, "test": flow.StepSucceeded, "lint": flow.StepSucceeded, "release": flow.StepSucceeded},
+			wantRan: []string{"build", "test", "lint", "release"},
+		},
+		{
+			name:    "failed need skips",
+			steps:   diamond,
+			fail:    []string{"test"},
+			want:    map[string]string{"build": flow.StepSucceeded, "test": flow.StepFailed, "lint": flow.StepSucceeded, "release": flow.StepSkipped},
+			wantRan: []string{"build", "test", "lint"},
+			wantErr: "step test: test failed",
+		},
+		{
+			name:    "skips transitively",
+			steps:   diamond,
+			fail:    []string{"build"},
+			want:    map[string]string{"build": flow.StepFailed, "test": flow.StepSkipped, "lint": flow.StepSkipped, "release": flow.StepSkipped},
+			wantRan: []string{"build"},
+			wantErr: "step build: build failed",
+		},
+		{
+			name:    "independent steps run",
+			steps:   []flow.FlowStep{workflowStep("a"), workflowStep("b")},
+			fail:    []string{"a", "b"},
+			want:    map[string]string{"a": flow.StepFailed, "b": flow.StepFailed},
+			wantRan: []string{"a", "b"},
+			wantErr: "step b: b failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := compileFlow(t, tt.steps...)
+			runner, ran := failSteps(tt.fail...)
+			exec, err := g.Run(context.Background(), runner)
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Run() error = %v, want %q", err, tt.wantErr)
+			}
+			for name, want := range tt.want {
+				if st := exec.Step(name); st.Status != want || st.FinishedAt.IsZero() {
+					t.Errorf("step %s = %+v, want %s", name, st, want)
+				}
+			}
+			got := ran()
+			if len(got) != len(tt.wantRan) {
+				t.Fatalf("ran %v, want %v", got, tt.wantRan)
+			}
+			for _, s := range tt.steps {
+				for _, need := range s.Needs {
+					if i, j := slices.Index(got, need), slices.Index(got, s.Name); j >= 0 && i > j {
+						t.Errorf("ran %v: %s before %s, which it needs", got, s.Name, need)
+					}
+				}
+			}
+			if exec.FinishedAt.IsZero() || exec.Succeeded() != (tt.wantErr == "") || exec.Flow != "release" || !flow.ValidCorrelationID(exec.ID) {
+				t.Errorf("execution = %+v", exec)
+			}
+		})
+	}
+}
+
+func TestFlowGraphRunsStepsAtOnce(t *testing.T) {
+	g := compileFlow(t, workflowStep("a"), workflowStep("b"), workflowStep("c", "a", "b"))
+	var both sync.WaitGroup
+	both.Add(2)
+	runner := stepFunc(func(ctx context.Context, step flow.FlowStep) ([]flow.StepRun, error) {
+		if step.Name == "c" {
+			return nil, nil
+		}
+		// Neither a nor b finishes until the other has started.
+		both.Done()
+		both.Wait()
+		return nil, nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	exec, err := g.Run(ctx, runner)
+	if err != nil || !exec.Succeeded() {
+		t.Errorf("Run() = %+v, %v", exec, err)
+	}
+}
+
+func TestFlowGraphRetry(t *testing.T) {
+	retry := &flow.StepRetry{MaxAttempts: 4, Backoff: time.Second, MaxBackoff: 3 * time.Second}
+	cancelled := context.Canceled
+	failed := errors.New("run concluded failure")
+	tests := []struct {
+		name  string
+		retry *flow.StepRetry
+		// errs are the results of the attempts, the last repeating.
+		errs         []error
+		wantAttempts int
+		wantBackoffs []time.Duration
+		wantStatus   string
+	}{
+		{name: "no retry", errs: []error{failed}, wantAttempts: 1, wantStatus: flow.StepFailed},
+		{name: "succeeds", retry: retry, errs: []error{failed, failed, nil}, wantAttempts: 3, wantBackoffs: []time.Duration{time.Second, 2 * time.Second}, wantStatus: flow.StepSucceeded},
+		{name: "attempts used up", retry: retry, errs: []error{failed}, wantAttempts: 4, wantBackoffs: []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}, wantStatus: flow.StepFailed},
+		{name: "cancelled not retried", retry: retry, errs: []error{cancelled}, wantAttempts: 1, wantStatus: flow.StepFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step := workflowStep("deploy")
+			step.Retry = tt.retry
+			g := compileFlow(t, step)
+			clock := nodeproptest.NewClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+			g.Clock = clock
+			var keys []string
+			runner := stepFunc(func(ctx context.Context, step flow.FlowStep) ([]flow.StepRun, error) {
+				keys = append(keys, flow.StepKey(ctx))
+				return nil, tt.errs[min(len(keys), len(tt.errs))-1]
+			})
+			type result struct {
+				exec *flow.FlowExecution
+				err  error
+			}
+			done := make(chan result, 1)
+			go func() {
+				exec, err := g.Run(context.Background(), runner)
+				done <- result{exec, err}
+			}()
+			for i, want := range tt.wantBackoffs {
+				clock.BlockUntil(1)
+				if d := clock.AdvanceToNext(); d != want {
+					t.Errorf("backoff %d = %v, want %v", i+1, d, want)
+				}
+			}
+			r := <-done
+			st := r.exec.Step("deploy")
+			if st.Status != tt.wantStatus || st.Attempts != tt.wantAttempts {
+				t.Errorf("step = %+v, want %s after %d attempts", st, tt.wantStatus, tt.wantAttempts)
+			}
+			if (r.err == nil) != (tt.wantStatus == flow.StepSucceeded) {
+				t.Errorf("Run() error = %v", r.err)
+			}
+			if len(keys) != tt.wantAttempts {
+				t.Fatalf("%d attempts run, want %d", len(keys), tt.wantAttempts)
+			}
+			for i, key := range keys {
+				if want := fmt.Sprintf("%s/deploy/%d", r.exec.ID, i+1); key != want {
+					t.Errorf("attempt %d StepKey = %q, want %q", i+1, key, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFlowRunner(t *testing.T) {
+	tests := []struct {
+		name       string
+		step       flow.FlowStep
+		conclusion string
+		wantErr    string
+		wantRuns   int
+	}{
+		{name: "workflow", step: workflowStep("deploy"), wantRuns: 1},
+		{name: "workflow failed", step: workflowStep("deploy"), conclusion: "failure", wantErr: "run of deploy.yml in Cdaprod/site concluded failure", wantRuns: 1},
+		{name: "unknown workflow", step: workflowStep("missing"), wantErr: "404"},
+		{name: "repository dispatch", step: flow.FlowStep{Name: "ping", Provider: flow.ProviderRepositoryDispatch, Repo: "Cdaprod/site", EventType: "ping"}},
+		{name: "unknown provider", step: flow.FlowStep{Name: "build", Provider: "jenkins", Repo: "Cdaprod/site"}, wantErr: "jenkins"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := nodeproptest.NewServer()
+			defer gh.Close()
+			gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+			gh.SetOutcome("Cdaprod/site", "deploy.yml", nodeproptest.Outcome{Conclusion: tt.conclusion})
+			r := &flow.FlowRunner{Correlator: newCorrelator(t, gh), PollInterval: time.Millisecond}
+			runs, err := r.RunStep(context.Background(), tt.step)
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("RunStep() error = %v, want %q", err, tt.wantErr)
+			}
+			if len(runs) != tt.wantRuns {
+				t.Fatalf("runs = %+v, want %d", runs, tt.wantRuns)
+			}
+			if tt.wantRuns == 1 && (runs[0].RunID == 0 || runs[0].Repo != "Cdaprod/site" || runs[0].Dispatch == "") {
+				t.Errorf("run = %+v, want the dispatch and its run", runs[0])
+			}
+			if tt.wantErr == "" && len(gh.Dispatches()) != 1 {
+				t.Errorf("dispatches = %+v, want 1", gh.Dispatches())
+			}
+		})
+	}
+}
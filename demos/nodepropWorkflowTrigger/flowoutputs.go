@@ -0,0 +1,286 @@
+package flow
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// DefaultOutputsArtifact is the artifact a step's outputs are read from
+// unless its StepOutputs names another.
+const DefaultOutputsArtifact = "nodeprop-outputs"
+
+// MaxOutputsArtifactSize bounds the outputs artifact RunOutputs downloads.
+const MaxOutputsArtifactSize = 10 << 20
+
+// StepOutputs makes a workflow_dispatch step collect the outputs of its run
+// once it succeeds, for later steps to pass on as
+// ${steps.<step>.outputs.<name>} in their ref and inputs. The run provides
+// them by uploading an artifact of JSON objects or of files written as
+// $GITHUB_OUTPUT is:
+//
+//	steps:
+//	  - run: |
+//	      echo "digest=$DIGEST" >> outputs.txt
+//	      echo "version=$VERSION" >> outputs.txt
+//	  - uses: actions/upload-artifact@v4
+//	    with:
+//	      name: nodeprop-outputs
+//	      path: outputs.txt
+type StepOutputs struct {
+	// Artifact is the name of the artifact, DefaultOutputsArtifact if
+	// empty.
+	Artifact string `yaml:"artifact,omitempty" json:"artifact,omitempty"`
+}
+
+func (o *StepOutputs) artifact() string {
+	if o.Artifact == "" {
+		return DefaultOutputsArtifact
+	}
+	return o.Artifact
+}
+
+// outputPattern matches a ${steps.<step>.outputs.<name>} reference.
+var outputPattern = regexp.MustCompile(`^\$\{\s*steps\.([A-Za-z0-9_-]+)\.outputs\.([A-Za-z0-9_-]+)\s*\}$`)
+
+// outputRefs returns the step and output name of each
+// ${steps.<step>.outputs.<name>} in s, or the error of a ${steps.*}
+// reference of another form. Other references are left alone.
+func outputRefs(s string) ([][2]string, error) {
+	var refs [][2]string
+	for _, ref := range paramPattern.FindAllString(s, -1) {
+		m := outputPattern.FindStringSubmatch(ref)
+		switch {
+		case m != nil:
+			refs = append(refs, [2]string{m[1], m[2]})
+		case strings.HasPrefix(strings.TrimSpace(ref[2:]), "steps."):
+			return nil, fmt.Errorf("%s is not of the form ${steps.<step>.outputs.<name>}", ref)
+		}
+	}
+	return refs, nil
+}
+
+// templated returns the fields of s that may use step outputs.
+func (s *FlowStep) templated() []string {
+	out := []string{s.Ref}
+	for _, v := range s.Inputs {
+		out = append(out, v)
+	}
+	return out
+}
+
+// checkOutputs checks that every output reference of a step names a step
+// it needs, directly or not, that collects outputs, so the output is there
+// by the time it runs. Handlers run out of that order and may not use
+// outputs.
+func (f *FlowDefinition) checkOutputs() error {
+	steps := make(map[string]FlowStep, len(f.Steps))
+	for _, s := range f.Steps {
+		steps[s.Name] = s
+	}
+	for _, s := range f.Steps {
+		var before map[string]bool
+		for _, v := range s.templated() {
+			refs, err := outputRefs(v)
+			if err != nil {
+				return fmt.Errorf("step %s: %w", s.Name, err)
+			}
+			for _, ref := range refs {
+				if before == nil {
+					before = f.upstream(s.Name)
+				}
+				switch dep, ok := steps[ref[0]]; {
+				case !ok:
+					return fmt.Errorf("step %s uses outputs of unknown step %s", s.Name, ref[0])
+				case !before[ref[0]]:
+					return fmt.Errorf("step %s uses outputs of %s, which it does not need", s.Name, ref[0])
+				case dep.Outputs == nil:
+					return fmt.Errorf("step %s uses outputs of %s, which has no outputs", s.Name, ref[0])
+				}
+			}
+		}
+	}
+	for _, h := range f.Handlers {
+		for _, v := range h.templated() {
+			refs, err := outputRefs(v)
+			if err != nil {
+				return fmt.Errorf("handler %s: %w", h.Name, err)
+			}
+			if len(refs) > 0 {
+				return fmt.Errorf("handler %s: outputs are for steps", h.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// upstream returns the steps the named step needs, directly or not.
+func (f *FlowDefinition) upstream(name string) map[string]bool {
+	needs := make(map[string][]string, len(f.Steps))
+	for _, s := range f.Steps {
+		needs[s.Name] = s.Needs
+	}
+	seen := map[string]bool{}
+	var visit func(string)
+	visit = func(n string) {
+		for _, dep := range needs[n] {
+			if !seen[dep] {
+				seen[dep] = true
+				visit(dep)
+			}
+		}
+	}
+	visit(name)
+	return seen
+}
+
+// expandOutputs returns step with the output references in its ref and
+// inputs replaced by the outputs of exec's steps. An output its step did
+// not produce, or a step that was omitted, is an error, so a dispatch is
+// never sent with an input silently left empty.
+func expandOutputs(step FlowStep, exec *FlowExecution) (FlowStep, error) {
+	var err error
+	expand := func(s string) string {
+		return paramPattern.ReplaceAllStringFunc(s, func(ref string) string {
+			m := outputPattern.FindStringSubmatch(ref)
+			if m == nil {
+				return ref
+			}
+			if st := exec.Step(m[1]); st != nil {
+				if v, ok := st.Outputs[m[2]]; ok {
+					return v
+				}
+			}
+			if err == nil {
+				err = fmt.Errorf("%s is not set: step %s produced no output %s", ref, m[1], m[2])
+			}
+			return ""
+		})
+	}
+	step.Ref = expand(step.Ref)
+	if step.Inputs != nil {
+		inputs := make(map[string]string, len(step.Inputs))
+		for k, v := range step.Inputs {
+			inputs[k] = expand(v)
+		}
+		step.Inputs = inputs
+	}
+	return step, err
+}
+
+// RunOutputs reads the outputs a run uploaded as the named artifact: the
+// keys of its JSON files, whose values are kept as strings if they are
+// strings and as JSON otherwise, and the name=value and heredoc lines of
+// its other files, as $GITHUB_OUTPUT has them. Files are read in the
+// archive's order, so a later one wins.
+func (c *GitHubClient) RunOutputs(ctx context.Context, repo string, runID int64, artifact string) (map[string]string, error) {
+	all, err := c.ListRunArtifacts(ctx, repo, runID)
+	if err != nil {
+		return nil, err
+	}
+	var found *Artifact
+	for i := range all {
+		if all[i].Name == artifact && !all[i].Expired {
+			found = &all[i]
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("run %d of %s uploaded no artifact %s", runID, repo, artifact)
+	}
+	if found.SizeInBytes > MaxOutputsArtifactSize {
+		return nil, fmt.Errorf("artifact %s is %d bytes, more than %d", artifact, found.SizeInBytes, MaxOutputsArtifactSize)
+	}
+	var buf bytes.Buffer
+	if _, err := c.DownloadArtifact(ctx, repo, found.ID, &buf); err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open artifact %s: %w", artifact, err)
+	}
+	outputs := map[string]string{}
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s of artifact %s: %w", f.Name, artifact, err)
+		}
+		data, err := io.ReadAll(io.LimitReader(rc, MaxOutputsArtifactSize))
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s of artifact %s: %w", f.Name, artifact, err)
+		}
+		if path.Ext(f.Name) == ".json" {
+			err = parseJSONOutputs(data, outputs)
+		} else {
+			err = parseOutputs(data, outputs)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s of artifact %s: %w", f.Name, artifact, err)
+		}
+	}
+	return outputs, nil
+}
+
+// parseJSONOutputs adds the keys of the JSON object in data to outputs.
+func parseJSONOutputs(data []byte, outputs map[string]string) error {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("not a JSON object: %w", err)
+	}
+	for k, raw := range m {
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			outputs[k] = s
+		} else {
+			outputs[k] = string(raw)
+		}
+	}
+	return nil
+}
+
+// parseOutputs adds the outputs of data, in the format of $GITHUB_OUTPUT,
+// to outputs: name=value lines, and name<<DELIMITER lines followed by the
+// value's lines and the delimiter.
+func parseOutputs(data []byte, outputs map[string]string) error {
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, MaxOutputsArtifactSize)
+	for sc.Scan() {
+		line := strings.TrimSuffix(sc.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if k, delim, ok := strings.Cut(line, "<<"); ok && !strings.Contains(k, "=") {
+			var value []string
+			closed := false
+			for sc.Scan() {
+				l := strings.TrimSuffix(sc.Text(), "\r")
+				if l == delim {
+					closed = true
+					break
+				}
+				value = append(value, l)
+			}
+			if !closed {
+				return fmt.Errorf("output %s: delimiter %s never closes", k, delim)
+			}
+			outputs[k] = strings.Join(value, "\n")
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok || k == "" {
+			return fmt.Errorf("line %q is not name=value", line)
+		}
+		outputs[k] = v
+	}
+	return sc.Err()
+}
@@ -0,0 +1,256 @@
+package flow
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseOutputs(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    map[string]string
+		wantErr string
+	}{
+		{name: "lines", data: "digest=sha256:abc\nversion=1.2.0\n", want: map[string]string{"digest": "sha256:abc", "version": "1.2.0"}},
+		{name: "value with equals", data: "query=a=b\n", want: map[string]string{"query": "a=b"}},
+		{name: "empty value", data: "tag=\n", want: map[string]string{"tag": ""}},
+		{name: "crlf and blank lines", data: "a=1\r\n\r\n  \nb=2\r\n", want: map[string]string{"a": "1", "b": "2"}},
+		{name: "heredoc", data: "notes<<EOF\nline one\nline two\nEOF\nversion=2\n", want: map[string]string{"notes": "line one\nline two", "version": "2"}},
+		{name: "later wins", data: "a=1\na=2\n", want: map[string]string{"a": "2"}},
+		{name: "unclosed heredoc", data: "notes<<EOF\nline one\n", wantErr: "delimiter EOF never closes"},
+		{name: "not name=value", data: "just text\n", wantErr: `line "just text" is not name=value`},
+		{name: "no name", data: "=value\n", wantErr: "is not name=value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string]string{}
+			err := parseOutputs([]byte(tt.data), got)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("parseOutputs() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || !maps.Equal(got, tt.want) {
+				t.Errorf("parseOutputs() = %v, %v; want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseJSONOutputs(t *testing.T) {
+	got := map[string]string{}
+	if err := parseJSONOutputs([]byte(`{"version": "1.2.0", "count": 3, "ok": true, "images": ["a", "b"], "none": null}`), got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"version": "1.2.0", "count": "3", "ok": "true", "images": `["a", "b"]`, "none": ""}
+	if !maps.Equal(got, want) {
+		t.Errorf("parseJSONOutputs() = %v, want %v", got, want)
+	}
+	if err := parseJSONOutputs([]byte(`["a"]`), got); err == nil || !strings.Contains(err.Error(), "not a JSON object") {
+		t.Errorf("parseJSONOutputs() of an array error = %v", err)
+	}
+}
+
+// zipFiles returns a zip archive of files, in order; a name ending in /
+// is a directory.
+func zipFiles(t *testing.T, files ...[2]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.Create(f[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(f[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRunOutputs(t *testing.T) {
+	outputs := zipFiles(t,
+		[2]string{"out/", ""},
+		[2]string{"out/build.json", `{"version": "1.2.0", "digest": "sha256:old"}`},
+		[2]string{"out/outputs.txt", "digest=sha256:new\n"},
+	)
+	tests := []struct {
+		name      string
+		artifacts []Artifact
+		archive   []byte
+		want      map[string]string
+		wantErr   string
+	}{
+		{
+			name:      "outputs",
+			artifacts: []Artifact{{ID: 1, Name: "logs"}, {ID: 2, Name: DefaultOutputsArtifact}},
+			archive:   outputs,
+			want:      map[string]string{"version": "1.2.0", "digest": "sha256:new"},
+		},
+		{name: "no artifact", artifacts: []Artifact{{ID: 1, Name: "logs"}}, wantErr: "run 7 of Cdaprod/site uploaded no artifact nodeprop-outputs"},
+		{name: "expired", artifacts: []Artifact{{ID: 2, Name: DefaultOutputsArtifact, Expired: true}}, wantErr: "uploaded no artifact"},
+		{name: "too large", artifacts: []Artifact{{ID: 2, Name: DefaultOutputsArtifact, SizeInBytes: MaxOutputsArtifactSize + 1}}, wantErr: "more than"},
+		{name: "not a zip", artifacts: []Artifact{{ID: 2, Name: DefaultOutputsArtifact}}, archive: []byte("nope"), wantErr: "failed to open artifact nodeprop-outputs"},
+		{
+			name:      "bad file",
+			artifacts: []Artifact{{ID: 2, Name: DefaultOutputsArtifact}},
+			archive:   zipFiles(t, [2]string{"outputs.json", "[]"}),
+			wantErr:   "outputs.json of artifact nodeprop-outputs: not a JSON object",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/repos/Cdaprod/site/actions/runs/7/artifacts":
+					json.NewEncoder(w).Encode(map[string][]Artifact{"artifacts": tt.artifacts})
+				case "/repos/Cdaprod/site/actions/artifacts/2/zip":
+					w.Write(tt.archive)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer srv.Close()
+			c := NewGitHubClient("token")
+			c.BaseURL = srv.URL
+			got, err := c.RunOutputs(context.Background(), "Cdaprod/site", 7, DefaultOutputsArtifact)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("RunOutputs() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || !maps.Equal(got, tt.want) {
+				t.Errorf("RunOutputs() = %v, %v; want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckOutputs(t *testing.T) {
+	build := FlowStep{Name: "build", Provider: ProviderWorkflowDispatch, Repo: "o/api", Workflow: "build.yml", Outputs: &StepOutputs{}}
+	test := FlowStep{Name: "test", Provider: ProviderWorkflowDispatch, Repo: "o/api", Workflow: "test.yml", Needs: []string{"build"}}
+	deploy := func(needs []string, inputs map[string]string) FlowStep {
+		return FlowStep{Name: "deploy", Provider: ProviderWorkflowDispatch, Repo: "o/api", Workflow: "deploy.yml", Needs: needs, Inputs: inputs}
+	}
+	refOutput := deploy(nil, nil)
+	refOutput.Ref = "${steps.build.outputs.tag}"
+	tests := []struct {
+		name    string
+		f       FlowDefinition
+		wantErr string
+	}{
+		{name: "needed directly", f: FlowDefinition{Name: "f", Steps: []FlowStep{build, deploy([]string{"build"}, map[string]string{"image": "${steps.build.outputs.digest}"})}}},
+		{name: "needed through another", f: FlowDefinition{Name: "f", Steps: []FlowStep{build, test, deploy([]string{"test"}, map[string]string{"image": "app@${ steps.build.outputs.digest }"})}}},
+		{name: "other references", f: FlowDefinition{Name: "f", Steps: []FlowStep{deploy(nil, map[string]string{"sha": "${event.sha}"})}}},
+		{name: "in the ref", f: FlowDefinition{Name: "f", Steps: []FlowStep{build, refOutput}}, wantErr: "step deploy uses outputs of build, which it does not need"},
+		{name: "unknown step", f: FlowDefinition{Name: "f", Steps: []FlowStep{deploy(nil, map[string]string{"v": "${steps.lint.outputs.v}"})}}, wantErr: "uses outputs of unknown step lint"},
+		{name: "not needed", f: FlowDefinition{Name: "f", Steps: []FlowStep{build, deploy(nil, map[string]string{"v": "${steps.build.outputs.v}"})}}, wantErr: "which it does not need"},
+		{name: "no outputs", f: FlowDefinition{Name: "f", Steps: []FlowStep{build, test, deploy([]string{"test"}, map[string]string{"v": "${steps.test.outputs.v}"})}}, wantErr: "uses outputs of test, which has no outputs"},
+		{name: "malformed", f: FlowDefinition{Name: "f", Steps: []FlowStep{build, deploy([]string{"build"}, map[string]string{"v": "${steps.build.digest}"})}}, wantErr: "${steps.build.digest} is not of the form ${steps.<step>.outputs.<name>}"},
+		{
+			name:    "handler",
+			f:       FlowDefinition{Name: "f", Steps: []FlowStep{build}, Handlers: []FlowStep{{Name: "page", Provider: ProviderRepositoryDispatch, Repo: "o/ops", EventType: "page", Inputs: map[string]string{"v": "${steps.build.outputs.v}"}}}},
+			wantErr: "handler page: outputs are for steps",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.f.Validate()
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExpandOutputs(t *testing.T) {
+	exec := &FlowExecution{Steps: []StepState{
+		{Name: "build", Status: StepSucceeded, Outputs: map[string]string{"digest": "sha256:abc", "tag": "v1.2.0"}},
+		{Name: "scan", Status: StepOmitted},
+	}}
+	tests := []struct {
+		name       string
+		step       FlowStep
+		wantRef    string
+		wantInputs map[string]string
+		wantErr    string
+	}{
+		{
+			name:       "expanded",
+			step:       FlowStep{Ref: "${steps.build.outputs.tag}", Inputs: map[string]string{"image": "app@${steps.build.outputs.digest}", "sha": "${event.sha}"}},
+			wantRef:    "v1.2.0",
+			wantInputs: map[string]string{"image": "app@sha256:abc", "sha": "${event.sha}"},
+		},
+		{name: "no inputs", step: FlowStep{Ref: "main"}, wantRef: "main"},
+		{name: "missing output", step: FlowStep{Inputs: map[string]string{"v": "${steps.build.outputs.version}"}}, wantErr: "${steps.build.outputs.version} is not set: step build produced no output version"},
+		{name: "omitted step", step: FlowStep{Inputs: map[string]string{"report": "${steps.scan.outputs.report}"}}, wantErr: "step scan produced no output report"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := maps.Clone(tt.step.Inputs)
+			got, err := expandOutputs(tt.step, exec)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expandOutputs() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got.Ref != tt.wantRef || !maps.Equal(got.Inputs, tt.wantInputs) {
+				t.Errorf("expandOutputs() = %q %v, %v; want %q %v", got.Ref, got.Inputs, err, tt.wantRef, tt.wantInputs)
+			}
+			if !maps.Equal(tt.step.Inputs, original) {
+				t.Errorf("expandOutputs() changed the step's inputs to %v", tt.step.Inputs)
+			}
+		})
+	}
+}
+
+func TestFlowGraphPassesOutputs(t *testing.T) {
+	def := &FlowDefinition{Name: "release", Steps: []FlowStep{
+		{Name: "build", Provider: ProviderWorkflowDispatch, Repo: "o/api", Workflow: "build.yml", Outputs: &StepOutputs{}},
+		{Name: "deploy", Provider: ProviderWorkflowDispatch, Repo: "o/api", Workflow: "deploy.yml", Ref: "${steps.build.outputs.tag}", Needs: []string{"build"}, Inputs: map[string]string{"image": "app@${steps.build.outputs.digest}"}},
+	}}
+	g, err := CompileFlow(def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var deployed FlowStep
+	runner := stepRunnerFunc(func(ctx context.Context, step FlowStep) ([]StepRun, error) {
+		if step.Name == "build" {
+			return []StepRun{{Repo: step.Repo, Outputs: map[string]string{"digest": "sha256:abc", "tag": "v1.2.0"}}}, nil
+		}
+		deployed = step
+		return nil, nil
+	})
+	exec, err := g.Run(context.Background(), runner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deployed.Ref != "v1.2.0" || deployed.Inputs["image"] != "app@sha256:abc" {
+		t.Errorf("deploy ran with ref %q and inputs %v", deployed.Ref, deployed.Inputs)
+	}
+	if got := exec.Step("build").Outputs; got["tag"] != "v1.2.0" {
+		t.Errorf("build outputs = %v", got)
+	}
+}
+
+// stepRunnerFunc is a StepRunner that calls itself.
+type stepRunnerFunc func(ctx context.Context, step FlowStep) ([]StepRun, error)
+
+func (f stepRunnerFunc) RunStep(ctx context.Context, step FlowStep) ([]StepRun, error) {
+	return f(ctx, step)
+}
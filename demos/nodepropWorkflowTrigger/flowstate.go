@@ -0,0 +1,184 @@
+package flow
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FlowStore persists flow executions so that one interrupted by a crash or
+// restart can be resumed with FlowGraph.Resume.
+type FlowStore interface {
+	// Save adds exec, or replaces the execution with its ID.
+	Save(exec *FlowExecution) error
+	Get(id string) (*FlowExecution, error)
+	List() ([]FlowExecution, error)
+}
+
+// UnfinishedFlows returns the executions in s of the named flow that have not
+// finished, oldest first, as they should be resumed.
+func UnfinishedFlows(s FlowStore, flow string) ([]FlowExecution, error) {
+	all, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	var out []FlowExecution
+	for _, e := range all {
+		if e.Flow == flow && e.FinishedAt.IsZero() {
+			out = append(out, e)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].StartedAt.Before(out[j].StartedAt) })
+	return out, nil
+}
+
+// Statuses of a FlowExecution.
+const (
+	FlowUnfinished = "unfinished"
+	FlowSucceeded  = "succeeded"
+	FlowFailed     = "failed"
+)
+
+// FlowQuery selects executions from a FlowStore. Empty fields match any
+// execution.
+type FlowQuery struct {
+	Flow string
+	// Version matches the definition's Version or its Digest.
+	Version string
+	// Since and Until bound StartedAt; Since is inclusive and Until
+	// exclusive.
+	Since time.Time
+	Until time.Time
+	// Status is FlowUnfinished, FlowSucceeded, or FlowFailed.
+	Status string
+	// Limit caps the number of executions returned; 0 means no limit.
+	Limit int
+}
+
+// Matches reports whether e satisfies every field of q but Limit.
+func (q FlowQuery) Matches(e FlowExecution) bool {
+	switch {
+	case q.Flow != "" && e.Flow != q.Flow,
+		q.Version != "" && e.Version != q.Version && e.Digest != q.Version,
+		q.Status != "" && e.Status() != q.Status,
+		!q.Since.IsZero() && e.StartedAt.Before(q.Since),
+		!q.Until.IsZero() && !e.StartedAt.Before(q.Until):
+		return false
+	}
+	return true
+}
+
+// QueryFlows returns the executions in s that match q, newest first.
+func QueryFlows(s FlowStore, q FlowQuery) ([]FlowExecution, error) {
+	all, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].StartedAt.After(all[j].StartedAt) })
+	var out []FlowExecution
+	for _, e := range all {
+		if q.Limit > 0 && len(out) == q.Limit {
+			break
+		}
+		if q.Matches(e) {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+// FileFlowStore keeps flow executions in a JSON file.
+type FileFlowStore struct {
+	Path string
+	mu   sync.Mutex
+}
+
+// NewFileFlowStore creates a FileFlowStore backed by path.
+func NewFileFlowStore(path string) *FileFlowStore {
+	return &FileFlowStore{Path: path}
+}
+
+// DefaultFlowStatePath returns the per-user location of the flow state file.
+func DefaultFlowStatePath() string {
+	return filepath.Join(filepath.Dir(DefaultHistoryPath()), "flows.json")
+}
+
+// Save adds exec, or replaces the execution with its ID.
+func (s *FileFlowStore) Save(exec *FlowExecution) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all, err := s.load()
+	if err != nil {
+		return err
+	}
+	for i := range all {
+		if all[i].ID == exec.ID {
+			all[i] = *exec
+			return s.save(all)
+		}
+	}
+	return s.save(append(all, *exec))
+}
+
+// Get returns the execution with the given ID.
+func (s *FileFlowStore) Get(id string) (*FlowExecution, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	for i := range all {
+		if all[i].ID == id {
+			return &all[i], nil
+		}
+	}
+	return nil, fmt.Errorf("flow execution %s not found", id)
+}
+
+// List returns every execution, newest first.
+func (s *FileFlowStore) List() ([]FlowExecution, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].StartedAt.After(all[j].StartedAt) })
+	return all, nil
+}
+
+func (s *FileFlowStore) load() ([]FlowExecution, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read flow state: %w", err)
+	}
+	var all []FlowExecution
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, fmt.Errorf("failed to parse flow state %s: %w", s.Path, err)
+	}
+	return all, nil
+}
+
+func (s *FileFlowStore) save(all []FlowExecution) error {
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal flow state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o755); err != nil {
+		return fmt.Errorf("failed to create flow state dir: %w", err)
+	}
+	tmp := s.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write flow state: %w", err)
+	}
+	return os.Rename(tmp, s.Path)
+}
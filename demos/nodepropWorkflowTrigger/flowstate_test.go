@@ -0,0 +1,281 @@
+package flow_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+func TestFileFlowStore(t *testing.T) {
+	s := flow.NewFileFlowStore(filepath.Join(t.TempDir(), "state", "flows.json"))
+	if all, err := s.List(); err != nil || len(all) != 0 {
+		t.Fatalf("List() of a missing file = %v, %v", all, err)
+	}
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	execs := []*flow.FlowExecution{
+		{ID: "a", Flow: "release", StartedAt: start},
+		{ID: "b", Flow: "release", StartedAt: start.Add(time.Hour), FinishedAt: start.Add(2 * time.Hour)},
+		{ID: "c", Flow: "nightly", StartedAt: start.Add(2 * time.Hour)},
+		{ID: "d", Flow: "release", StartedAt: start.Add(-time.Hour)},
+	}
+	for _, e := range execs {
+		if err := s.Save(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Saving again replaces the execution.
+	execs[0].Steps = []flow.StepState{{Name: "build", Status: flow.StepSucceeded}}
+	if err := s.Save(execs[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Get("a")
+	if err != nil || len(got.Steps) != 1 || got.Steps[0].Status != flow.StepSucceeded {
+		t.Errorf("Get() = %+v, %v; want the saved steps", got, err)
+	}
+	if _, err := s.Get("missing"); err == nil || !strings.Contains(err.Error(), "flow execution missing not found") {
+		t.Errorf("Get() of an unknown execution error = %v", err)
+	}
+	all, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, e := range all {
+		ids = append(ids, e.ID)
+	}
+	if want := []string{"c", "b", "a", "d"}; !slices.Equal(ids, want) {
+		t.Errorf("List() = %v, want newest first %v", ids, want)
+	}
+
+	unfinished, err := flow.UnfinishedFlows(s, "release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids = nil
+	for _, e := range unfinished {
+		ids = append(ids, e.ID)
+	}
+	if want := []string{"d", "a"}; !slices.Equal(ids, want) {
+		t.Errorf("UnfinishedFlows() = %v, want oldest first %v", ids, want)
+	}
+
+	if err := os.WriteFile(s.Path, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.List(); err == nil || !strings.Contains(err.Error(), "failed to parse flow state") {
+		t.Errorf("List() of a corrupt file error = %v", err)
+	}
+}
+
+func TestQueryFlows(t *testing.T) {
+	s := flow.NewFileFlowStore(filepath.Join(t.TempDir(), "flows.json"))
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	failed := []flow.StepState{{Name: "build", Status: flow.StepFailed, Error: "build failed"}}
+	for _, e := range []*flow.FlowExecution{
+		{ID: "a", Flow: "release", Version: "2", Digest: "aaaaaaaaaaaa", StartedAt: start, FinishedAt: start.Add(time.Minute)},
+		{ID: "b", Flow: "release", Version: "2", Digest: "aaaaaaaaaaaa", StartedAt: start.Add(time.Hour), FinishedAt: start.Add(time.Hour), Steps: failed},
+		{ID: "c", Flow: "release", Version: "3", Digest: "bbbbbbbbbbbb", StartedAt: start.Add(2 * time.Hour)},
+		{ID: "d", Flow: "nightly", StartedAt: start.Add(3 * time.Hour), FinishedAt: start.Add(3 * time.Hour)},
+	} {
+		if err := s.Save(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A flow run records the version and digest of its definition.
+	g := compileFlow(t, workflowStep("build"))
+	g.Def.Version = "4"
+	g.Clock = nodeproptest.NewClock(start.Add(4 * time.Hour))
+	g.Store = s
+	runner, _ := failSteps()
+	exec, err := g.Run(context.Background(), runner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exec.Version != "4" || exec.Digest != g.Def.Digest() {
+		t.Errorf("execution version %q, digest %q; want 4, %s", exec.Version, exec.Digest, g.Def.Digest())
+	}
+
+	tests := []struct {
+		name string
+		q    flow.FlowQuery
+		want []string
+	}{
+		{name: "all", want: []string{exec.ID, "d", "c", "b", "a"}},
+		{name: "flow", q: flow.FlowQuery{Flow: "release"}, want: []string{exec.ID, "c", "b", "a"}},
+		{name: "version", q: flow.FlowQuery{Version: "2"}, want: []string{"b", "a"}},
+		{name: "digest", q: flow.FlowQuery{Version: "bbbbbbbbbbbb"}, want: []string{"c"}},
+		{name: "run digest", q: flow.FlowQuery{Version: g.Def.Digest()}, want: []string{exec.ID}},
+		{name: "unfinished", q: flow.FlowQuery{Status: flow.FlowUnfinished}, want: []string{"c"}},
+		{name: "succeeded", q: flow.FlowQuery{Flow: "release", Status: flow.FlowSucceeded}, want: []string{exec.ID, "a"}},
+		{name: "failed", q: flow.FlowQuery{Status: flow.FlowFailed}, want: []string{"b"}},
+		{name: "since is inclusive", q: flow.FlowQuery{Since: start.Add(time.Hour)}, want: []string{exec.ID, "d", "c", "b"}},
+		{name: "until is exclusive", q: flow.FlowQuery{Until: start.Add(time.Hour)}, want: []string{"a"}},
+		{name: "limit", q: flow.FlowQuery{Flow: "release", Limit: 2}, want: []string{exec.ID, "c"}},
+		{name: "limit counts matches", q: flow.FlowQuery{Version: "2", Limit: 1}, want: []string{"b"}},
+		{name: "no match", q: flow.FlowQuery{Flow: "hotfix"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := flow.QueryFlows(s, tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, e := range got {
+				ids = append(ids, e.ID)
+			}
+			if !slices.Equal(ids, tt.want) {
+				t.Errorf("QueryFlows(%+v) = %v, want %v", tt.q, ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlowGraphResume(t *testing.T) {
+	steps := []flow.FlowStep{workflowStep("build"), workflowStep("test", "build"), workflowStep("deploy", "test")}
+	digest := compileFlow(t, steps...).Def.Digest()
+	tests := []struct {
+		name string
+		// exec edits the unfinished execution to resume.
+		exec    func(e *flow.FlowExecution)
+		fail    []string
+		wantRan []string
+		wantErr string
+	}{
+		{
+			name: "running steps run again",
+			exec: func(e *flow.FlowExecution) {
+				e.Step("build").Status = flow.StepSucceeded
+				e.Step("test").Status = flow.StepRunning
+			},
+			wantRan: []string{"test", "deploy"},
+		},
+		{
+			name: "failed steps stay failed",
+			exec: func(e *flow.FlowExecution) {
+				e.Step("build").Status = flow.StepSucceeded
+				st := e.Step("test")
+				st.Status, st.Error, st.FinishedAt = flow.StepFailed, "tests failed", e.StartedAt
+			},
+			wantErr: "step test: tests failed",
+		},
+		{
+			name: "same definition",
+			exec: func(e *flow.FlowExecution) {
+				e.Digest = digest
+				e.Step("build").Status = flow.StepRunning
+			},
+			wantRan: []string{"build", "test", "deploy"},
+		},
+		{
+			name:    "changed definition",
+			exec:    func(e *flow.FlowExecution) { e.Digest = "000000000000" },
+			wantErr: "started with another definition of flow release (digest 000000000000, now " + digest + ")",
+		},
+		{name: "another flow", exec: func(e *flow.FlowExecution) { e.Flow = "nightly" }, wantErr: "is of flow nightly, not release"},
+		{name: "finished", exec: func(e *flow.FlowExecution) { e.FinishedAt = e.StartedAt }, wantErr: "already finished"},
+		{name: "missing step", exec: func(e *flow.FlowExecution) { e.Steps = e.Steps[:2] }, wantErr: "has no step deploy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := compileFlow(t, steps...)
+			g.Store = flow.NewFileFlowStore(filepath.Join(t.TempDir(), "flows.json"))
+			exec := &flow.FlowExecution{ID: "11111111-1111-4111-8111-111111111111", Flow: "release", StartedAt: time.Now()}
+			for _, s := range steps {
+				exec.Steps = append(exec.Steps, flow.StepState{Name: s.Name, Status: flow.StepPending})
+			}
+			tt.exec(exec)
+			runner, ran := failSteps(tt.fail...)
+			got, err := g.Resume(context.Background(), exec, runner)
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Resume() error = %v, want %q", err, tt.wantErr)
+			}
+			if r := ran(); !slices.Equal(r, tt.wantRan) {
+				t.Errorf("ran %v, want %v", r, tt.wantRan)
+			}
+			if got == nil {
+				return
+			}
+			saved, err := g.Store.Get(exec.ID)
+			if err != nil || saved.FinishedAt.IsZero() || saved.Succeeded() != (tt.wantErr == "") {
+				t.Errorf("saved execution = %+v, %v; want it finished", saved, err)
+			}
+		})
+	}
+}
+
+// TestFlowGraphInterrupted stops a flow while a workflow step waits for its
+// run, and resumes it: the step runs again, following the run it had
+// dispatched instead of dispatching it twice.
+func TestFlowGraphInterrupted(t *testing.T) {
+	gh := nodeproptest.NewServer()
+	defer gh.Close()
+	gh.AddWorkflow("Cdaprod/site", "build.yml", "deploy.yml")
+	clock := nodeproptest.NewClock(time.Now())
+	gh.Clock = clock
+	gh.SetOutcome("Cdaprod/site", "build.yml", nodeproptest.Outcome{Duration: time.Hour})
+	c := newCorrelator(t, gh)
+	c.Clock = clock
+	runner := &flow.FlowRunner{Correlator: c, PollInterval: time.Minute}
+
+	g := compileFlow(t, workflowStep("build"), workflowStep("deploy", "build"))
+	g.Clock = clock
+	g.Store = flow.NewFileFlowStore(filepath.Join(t.TempDir(), "flows.json"))
+	ctx, cancel := context.WithCancel(context.Background())
+	type result struct {
+		exec *flow.FlowExecution
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		exec, err := g.Run(ctx, runner)
+		done <- result{exec, err}
+	}()
+	// The step polls the run once it is dispatched.
+	clock.BlockUntil(1)
+	cancel()
+	r := <-done
+	if !errors.Is(r.err, context.Canceled) || !r.exec.FinishedAt.IsZero() {
+		t.Fatalf("interrupted Run() = %+v, %v; want it unfinished", r.exec, r.err)
+	}
+	saved, err := g.Store.Get(r.exec.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := saved.Step("build"); st.Status != flow.StepRunning {
+		t.Errorf("saved build = %+v, want it running", st)
+	}
+	if st := saved.Step("deploy"); st.Status != flow.StepPending {
+		t.Errorf("saved deploy = %+v, want it pending", st)
+	}
+	if len(saved.Handlers) != 0 {
+		t.Errorf("handlers = %+v, want none for an interrupted step", saved.Handlers)
+	}
+
+	clock.Advance(time.Hour)
+	exec, err := g.Resume(context.Background(), saved, runner)
+	if err != nil || !exec.Succeeded() || exec.FinishedAt.IsZero() {
+		t.Fatalf("Resume() = %+v, %v", exec, err)
+	}
+	var builds int
+	for _, d := range gh.Dispatches() {
+		if d.Workflow == "build.yml" {
+			builds++
+		}
+	}
+	if builds != 1 {
+		t.Errorf("build dispatched %d times, want once", builds)
+	}
+	if st := exec.Step("build"); len(st.Runs) != 1 || st.Runs[0].Conclusion != "success" {
+		t.Errorf("build = %+v, want the first run followed to its end", st)
+	}
+}
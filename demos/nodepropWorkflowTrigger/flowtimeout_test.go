@@ -0,0 +1,165 @@
+package flow_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+// cancelRunner is a StepRunner that records the runs it is asked to cancel
+// and fails to cancel them with Err.
+type cancelRunner struct {
+	flow.StepRunner
+	Err       error
+	cancelled []flow.StepRun
+}
+
+func (r *cancelRunner) CancelRuns(ctx context.Context, step flow.FlowStep, runs []flow.StepRun) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	r.cancelled = append(r.cancelled, runs...)
+	return r.Err
+}
+
+func TestFlowGraphTimeout(t *testing.T) {
+	// deploy has dispatched to two repositories, one of which has
+	// concluded, when the flow times out. Its failure is tolerated, so that
+	// announce is left pending by the timeout rather than skipped for it.
+	hang := stepFunc(func(ctx context.Context, step flow.FlowStep) ([]flow.StepRun, error) {
+		if step.Name != "deploy" {
+			return nil, nil
+		}
+		<-ctx.Done()
+		return []flow.StepRun{
+			{Repo: "Cdaprod/lib", Dispatch: "d-1", RunID: 1, Conclusion: "success"},
+			{Repo: "Cdaprod/site", Dispatch: "d-2", RunID: 2},
+		}, ctx.Err()
+	})
+	tests := []struct {
+		name          string
+		cancelRuns    bool
+		runner        flow.StepRunner
+		wantCancelled []string
+		wantErr       []string
+	}{
+		{
+			name:    "runs left to finish",
+			runner:  &cancelRunner{StepRunner: hang},
+			wantErr: []string{"flow release timed out after 100ms"},
+		},
+		{
+			name:          "runs cancelled",
+			cancelRuns:    true,
+			runner:        &cancelRunner{StepRunner: hang},
+			wantCancelled: []string{"d-2"},
+			wantErr:       []string{"flow release timed out after 100ms"},
+		},
+		{
+			name:          "cancel fails",
+			cancelRuns:    true,
+			runner:        &cancelRunner{StepRunner: hang, Err: errors.New("forbidden")},
+			wantCancelled: []string{"d-2"},
+			wantErr:       []string{"step deploy: forbidden", "timed out"},
+		},
+		{
+			name:       "runner cannot cancel",
+			cancelRuns: true,
+			runner:     hang,
+			wantErr:    []string{"step deploy: 1 runs left running: the step runner cannot cancel them"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deploy := workflowStep("deploy", "build")
+			deploy.ContinueOnError, deploy.OnFailure = true, &flow.StepFailure{Run: []string{"rollback"}}
+			g, err := flow.CompileFlow(&flow.FlowDefinition{
+				Name:       "release",
+				Steps:      []flow.FlowStep{workflowStep("build"), deploy, workflowStep("announce", "deploy")},
+				Handlers:   []flow.FlowStep{handlerStep("rollback")},
+				Timeout:    100 * time.Millisecond,
+				CancelRuns: tt.cancelRuns,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			exec, err := g.Run(context.Background(), tt.runner)
+			for _, want := range tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), want) {
+					t.Errorf("Run() error = %v, want %q", err, want)
+				}
+			}
+			if exec.FinishedAt.IsZero() {
+				t.Error("a timed out execution is unfinished")
+			}
+			if st := exec.Step("deploy"); st.Status != flow.StepFailed || len(st.Runs) != 2 {
+				t.Errorf("deploy = %+v, want it failed with its runs", st)
+			}
+			if st := exec.Step("announce"); st.Status != flow.StepSkipped || st.Error != "the flow timed out" {
+				t.Errorf("announce = %+v, want it skipped for the timeout", st)
+			}
+			// Failure handlers run past the flow's deadline.
+			if len(exec.Handlers) != 1 || exec.Handlers[0].Status != flow.StepSucceeded {
+				t.Errorf("handlers = %+v, want rollback to succeed", exec.Handlers)
+			}
+			var cancelled []string
+			if r, ok := tt.runner.(*cancelRunner); ok {
+				for _, run := range r.cancelled {
+					cancelled = append(cancelled, run.Dispatch)
+				}
+			}
+			if !slices.Equal(cancelled, tt.wantCancelled) {
+				t.Errorf("cancelled %v, want %v", cancelled, tt.wantCancelled)
+			}
+		})
+	}
+
+	g, err := flow.CompileFlow(&flow.FlowDefinition{Name: "release", Steps: []flow.FlowStep{workflowStep("build")}, Timeout: time.Minute, CancelRuns: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner, _ := failSteps()
+	if exec, err := g.Run(context.Background(), runner); err != nil || !exec.Succeeded() {
+		t.Errorf("Run() within the timeout = %+v, %v", exec, err)
+	}
+}
+
+// TestFlowRunnerCancelRuns times a flow out while its step follows a run,
+// which is cancelled on GitHub.
+func TestFlowRunnerCancelRuns(t *testing.T) {
+	gh := nodeproptest.NewServer()
+	defer gh.Close()
+	gh.AddWorkflow("Cdaprod/site", "build.yml")
+	clock := nodeproptest.NewClock(time.Now())
+	gh.Clock = clock
+	gh.SetOutcome("Cdaprod/site", "build.yml", nodeproptest.Outcome{Duration: time.Hour})
+	c := newCorrelator(t, gh)
+	c.Clock = clock
+	runner := &flow.FlowRunner{Correlator: c, PollInterval: time.Minute}
+
+	g, err := flow.CompileFlow(&flow.FlowDefinition{Name: "release", Steps: []flow.FlowStep{workflowStep("build")}, Timeout: 200 * time.Millisecond, CancelRuns: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Clock = clock
+	g.Store = flow.NewFileFlowStore(filepath.Join(t.TempDir(), "flows.json"))
+	exec, err := g.Run(context.Background(), runner)
+	if err == nil || !strings.Contains(err.Error(), "timed out") || strings.Contains(err.Error(), "cancel run") {
+		t.Fatalf("Run() error = %v, want only the timeout", err)
+	}
+	st := exec.Step("build")
+	if st.Status != flow.StepFailed || len(st.Runs) != 1 || st.Runs[0].RunID == 0 {
+		t.Fatalf("build = %+v, want it failed with its run", st)
+	}
+	runs := gh.Runs("Cdaprod/site")
+	if len(runs) != 1 || runs[0].ID != st.Runs[0].RunID || runs[0].Conclusion != "cancelled" {
+		t.Errorf("runs = %+v, want the step's run cancelled", runs)
+	}
+}
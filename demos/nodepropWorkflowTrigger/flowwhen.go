@@ -0,0 +1,116 @@
+package flow
+
+import (
+	"fmt"
+
+	"github.com/google/cel-go/cel"
+)
+
+// flowEnv declares the variables step When expressions may use.
+func flowEnv() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("event", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("steps", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("repo", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("registry", cel.MapType(cel.StringType, cel.DynType)),
+	)
+}
+
+// compileWhen compiles a When expression, which must be boolean.
+func compileWhen(env *cel.Env, expr string) (cel.Program, error) {
+	ast, iss := env.Compile(expr)
+	if iss.Err() != nil {
+		return nil, fmt.Errorf("when: %w", iss.Err())
+	}
+	if !ast.OutputType().IsExactType(cel.BoolType) {
+		return nil, fmt.Errorf("when must be a boolean expression, not %v", ast.OutputType())
+	}
+	return env.Program(ast)
+}
+
+// ConditionEnv is what the When expressions of a flow's steps see:
+//
+//	event     type, action, repo, branch, delivery, and payload of Event
+//	steps     each step of Steps by name: status, attempts, error,
+//	          outputs, and runs, a list of repo, dispatch, run_url, and
+//	          conclusion
+//	repo      the Registry entry of the step's repo: name, tags,
+//	          workflows, actions, and depends_on
+//	registry  every Registry entry by name, as repo
+type ConditionEnv struct {
+	Event    InboundEvent
+	Steps    []StepState
+	Registry *RepositoryRegistry
+}
+
+// When reports whether the named step should run in env: true if it has
+// no When expression, or if the expression holds. An expression that fails
+// to evaluate, e.g. on a payload field the event lacks, is an error.
+func (g *FlowGraph) When(step string, env ConditionEnv) (bool, error) {
+	prg := g.when[step]
+	if prg == nil {
+		return true, nil
+	}
+	payload := env.Event.Payload
+	if payload == nil {
+		payload = map[string]interface{}{}
+	}
+	steps := make(map[string]interface{}, len(env.Steps))
+	for _, s := range env.Steps {
+		runs := make([]interface{}, len(s.Runs))
+		for i, r := range s.Runs {
+			runs[i] = map[string]interface{}{"repo": r.Repo, "dispatch": r.Dispatch, "run_url": r.RunURL, "conclusion": r.Conclusion}
+		}
+		outputs := s.Outputs
+		if outputs == nil {
+			outputs = map[string]string{}
+		}
+		steps[s.Name] = map[string]interface{}{"status": s.Status, "attempts": s.Attempts, "error": s.Error, "runs": runs, "outputs": outputs}
+	}
+	registry := map[string]interface{}{}
+	repo := repoVars(RepoEntry{Name: g.steps[step].Repo})
+	if env.Registry != nil {
+		for _, e := range env.Registry.Repos() {
+			registry[e.Name] = repoVars(e)
+		}
+		if e, ok := env.Registry.Get(g.steps[step].Repo); ok {
+			repo = repoVars(e)
+		}
+	}
+	out, _, err := prg.Eval(map[string]interface{}{
+		"event": map[string]interface{}{
+			"type":     env.Event.Type,
+			"action":   env.Event.Action,
+			"repo":     env.Event.Repo,
+			"branch":   env.Event.Branch,
+			"delivery": env.Event.Delivery,
+			"payload":  payload,
+		},
+		"steps":    steps,
+		"repo":     repo,
+		"registry": registry,
+	})
+	if err != nil {
+		return false, fmt.Errorf("when: %w", err)
+	}
+	ok, _ := out.Value().(bool)
+	return ok, nil
+}
+
+// repoVars is e as When expressions see it.
+func repoVars(e RepoEntry) map[string]interface{} {
+	return map[string]interface{}{
+		"name":       e.Name,
+		"tags":       stringsOrEmpty(e.Tags),
+		"workflows":  stringsOrEmpty(e.Workflows),
+		"actions":    stringsOrEmpty(e.Actions),
+		"depends_on": stringsOrEmpty(e.DependsOn),
+	}
+}
+
+func stringsOrEmpty(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -0,0 +1,132 @@
+package flow_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+func TestCompileWhen(t *testing.T) {
+	tests := []struct {
+		when    string
+		wantErr string
+	}{
+		{when: `event.branch == "main"`},
+		{when: `"web" in repo.tags && steps.build.status == "succeeded"`},
+		{when: `event.branch`, wantErr: "when must be a boolean expression"},
+		{when: `event.branch ==`, wantErr: "step deploy: when:"},
+		{when: `unknown == 1`, wantErr: "undeclared reference"},
+	}
+	for _, tt := range tests {
+		step := workflowStep("deploy")
+		step.When = tt.when
+		_, err := flow.CompileFlow(&flow.FlowDefinition{Name: "release", Steps: []flow.FlowStep{step}})
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("CompileFlow() with when %q error = %v, want %q", tt.when, err, tt.wantErr)
+		}
+	}
+}
+
+func TestFlowGraphWhen(t *testing.T) {
+	reg := flow.NewRepositoryRegistry()
+	reg.SetRepo(flow.RepoEntry{Name: "Cdaprod/site", Tags: []string{"web"}, DependsOn: []string{"Cdaprod/lib"}})
+	reg.SetRepo(flow.RepoEntry{Name: "Cdaprod/lib", Tags: []string{"go"}})
+	push := flow.InboundEvent{Type: "push", Repo: "Cdaprod/lib", Branch: "main", Delivery: "d-1", Payload: map[string]interface{}{"forced": true, "pusher": map[string]interface{}{"name": "alice"}}}
+	built := []flow.StepState{{Name: "build", Status: flow.StepSucceeded, Attempts: 2, Outputs: map[string]string{"version": "1.2.0"}, Runs: []flow.StepRun{{Repo: "Cdaprod/site", Conclusion: "success"}}}}
+	tests := []struct {
+		name    string
+		when    string
+		env     flow.ConditionEnv
+		want    bool
+		wantErr bool
+	}{
+		{name: "no expression", want: true},
+		{name: "event", when: `event.type == "push" && event.branch == "main" && event.delivery == "d-1"`, env: flow.ConditionEnv{Event: push}, want: true},
+		{name: "payload", when: `event.payload.forced && event.payload.pusher.name == "alice"`, env: flow.ConditionEnv{Event: push}, want: true},
+		{name: "missing payload field", when: `event.payload.ref == "main"`, env: flow.ConditionEnv{Event: push}, wantErr: true},
+		{name: "no payload", when: `!("ref" in event.payload)`, want: true},
+		{name: "false", when: `event.branch == "dev"`, env: flow.ConditionEnv{Event: push}},
+		{name: "step status", when: `steps.build.status == "succeeded" && steps.build.attempts == 2`, env: flow.ConditionEnv{Steps: built}, want: true},
+		{name: "step outputs", when: `steps.build.outputs.version.startsWith("1.")`, env: flow.ConditionEnv{Steps: built}, want: true},
+		{name: "step runs", when: `steps.build.runs.all(r, r.conclusion == "success")`, env: flow.ConditionEnv{Steps: built}, want: true},
+		{name: "repo", when: `"web" in repo.tags && "Cdaprod/lib" in repo.depends_on`, env: flow.ConditionEnv{Registry: reg}, want: true},
+		{name: "unregistered repo", when: `repo.name == "Cdaprod/site" && size(repo.tags) == 0`, want: true},
+		{name: "registry", when: `registry["Cdaprod/lib"].tags.exists(t, t == "go")`, env: flow.ConditionEnv{Registry: reg}, want: true},
+		{name: "event repo in registry", when: `event.repo in registry && event.repo in repo.depends_on`, env: flow.ConditionEnv{Event: push, Registry: reg}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step := workflowStep("deploy")
+			step.When = tt.when
+			g := compileFlow(t, step)
+			got, err := g.When("deploy", tt.env)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("When() = %v, %v; want %v, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFlowGraphRunWhen(t *testing.T) {
+	build := workflowStep("build")
+	notify := workflowStep("notify", "build")
+	notify.When = `steps.build.status == "failed"`
+	deploy := workflowStep("deploy", "notify")
+	deploy.When = `event.branch == "main"`
+	release := workflowStep("release", "deploy")
+	broken := workflowStep("broken")
+	broken.When = `event.payload.missing == true`
+	tests := []struct {
+		name    string
+		branch  string
+		steps   []flow.FlowStep
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name:   "omitted steps satisfy needs",
+			branch: "main",
+			steps:  []flow.FlowStep{build, notify, deploy, release},
+			want:   map[string]string{"build": flow.StepSucceeded, "notify": flow.StepOmitted, "deploy": flow.StepSucceeded, "release": flow.StepSucceeded},
+		},
+		{
+			name:   "omitted on another branch",
+			branch: "dev",
+			steps:  []flow.FlowStep{build, notify, deploy, release},
+			want:   map[string]string{"build": flow.StepSucceeded, "notify": flow.StepOmitted, "deploy": flow.StepOmitted, "release": flow.StepSucceeded},
+		},
+		{
+			name:    "failed expression fails the step",
+			steps:   []flow.FlowStep{broken},
+			want:    map[string]string{"broken": flow.StepFailed},
+			wantErr: "step broken: when:",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := compileFlow(t, tt.steps...)
+			runner, ran := failSteps()
+			exec, err := g.RunEvent(context.Background(), flow.InboundEvent{Type: "push", Branch: tt.branch}, runner)
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("RunEvent() error = %v, want %q", err, tt.wantErr)
+			}
+			var wantRan int
+			for name, want := range tt.want {
+				if st := exec.Step(name); st.Status != want {
+					t.Errorf("step %s = %s, want %s", name, st.Status, want)
+				}
+				if want == flow.StepSucceeded {
+					wantRan++
+				}
+			}
+			if got := ran(); len(got) != wantRan {
+				t.Errorf("ran %v, want only the succeeded steps", got)
+			}
+			if exec.Succeeded() != (tt.wantErr == "") || exec.Event.Branch != tt.branch {
+				t.Errorf("execution = %+v", exec)
+			}
+		})
+	}
+}
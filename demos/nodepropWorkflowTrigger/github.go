@@ -0,0 +1,371 @@
+package flow
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultAPIBaseURL is the REST endpoint for github.com.
+const DefaultAPIBaseURL = "https://api.github.com"
+
+// GitHubClient is a minimal GitHub REST client used for run lookups.
+type GitHubClient struct {
+	BaseURL string
+	Token   string
+	// TokenProvider, if set, is asked for the token before every request
+	// instead of using Token, so that a short-lived token, such as one
+	// leased from a secret manager, is replaced before it expires. The
+	// provider should cache it.
+	TokenProvider TokenProvider
+	HTTPClient    *http.Client
+	// RateLimitFloor, if positive, makes requests wait for the rate-limit
+	// window to reset once the remaining quota drops to this many requests.
+	RateLimitFloor int
+	// Clock, if set, replaces the system clock for rate-limit waits.
+	Clock Clock
+	// Logger receives a debug record per request; nil means slog.Default().
+	Logger Logger
+	// Metrics, if set, reports requests waiting for the rate limit.
+	Metrics *Metrics
+	// TracerProvider provides a client span per request; nil means the
+	// global provider. The span's context is sent in the request headers
+	// with the global propagator.
+	TracerProvider trace.TracerProvider
+	// DebugDump, if set, receives the full request and response of every
+	// request that fails, such as a dispatch GitHub answers with 422. The
+	// token, credential headers, and Secrets are redacted.
+	DebugDump io.Writer
+
+	tokenMu   sync.Mutex
+	lastToken string
+
+	dumpMu   sync.Mutex
+	rateMu   sync.Mutex
+	rate     RateLimit
+	rateSeen bool
+}
+
+// APIError is returned for responses with a non-2xx status.
+type APIError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s %s: unexpected status code: %d: %s", e.Method, e.Path, e.StatusCode, e.Body)
+}
+
+// IsNotFound reports whether err is an API 404.
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// NewGitHubClient creates a client for github.com using the given token.
+func NewGitHubClient(token string) *GitHubClient {
+	return &GitHubClient{BaseURL: DefaultAPIBaseURL, Token: token, HTTPClient: SharedHTTPClient()}
+}
+
+// do sends a request to path (relative to BaseURL) and decodes the JSON
+// response into out when out is non-nil.
+func (c *GitHubClient) do(ctx context.Context, method, path string, in, out interface{}) error {
+	resp, err := c.send(ctx, method, path, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// send issues a request and returns the response if its status is 2xx. The
+// caller must close the body.
+func (c *GitHubClient) send(ctx context.Context, method, path string, in interface{}) (*http.Response, error) {
+	var body *jsonBody
+	var payload []byte
+	stream, streamed := in.(streamedJSON)
+	if in != nil && !streamed {
+		var err error
+		if body, err = newJSONBody(in); err != nil {
+			return nil, fmt.Errorf("failed to marshal payload: %w", err)
+		}
+		defer body.release()
+		payload = body.Bytes()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.endpoint(path), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		body.attach(req)
+	} else if streamed {
+		stream.attach(req)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	token, err := c.token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		Secrets.seen(token)
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	ctx, span := tracer(c.TracerProvider).Start(ctx, "github "+method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("http.request.method", method),
+		attribute.String("url.full", req.URL.String()),
+	))
+	defer span.End()
+	req = req.WithContext(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	if err := c.pace(ctx); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	start := time.Now()
+	resp, err := httpClientOr(c.HTTPClient).Do(req)
+	if err != nil {
+		LoggerOr(c.Logger).Debug("github request failed", "method", method, "path", path, "error", err)
+		if c.DebugDump != nil {
+			c.dump(ctx, req, payload, nil, nil, err)
+		}
+		err = RedactError(err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("%s %s failed: %w", method, path, err)
+	}
+	c.observe(resp.Header)
+	LoggerOr(c.Logger).Debug("github request", "method", method, "path", path, "status", resp.StatusCode, "duration", time.Since(start))
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		span.SetStatus(codes.Error, resp.Status)
+		defer resp.Body.Close()
+		limit := int64(1024)
+		if c.DebugDump != nil {
+			limit = maxDumpBody
+		}
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, limit))
+		if c.DebugDump != nil {
+			c.dump(ctx, req, payload, resp, msg, nil)
+			msg = msg[:min(len(msg), 1024)]
+		}
+		return nil, &APIError{Method: method, Path: path, StatusCode: resp.StatusCode, Body: Secrets.Redact(strings.TrimSpace(string(msg)))}
+	}
+	return resp, nil
+}
+
+// endpoint returns the URL of path. graphQLPath is GitHub's GraphQL
+// endpoint, which on GHES is /api/graphql, beside the REST API's /api/v3
+// rather than under it.
+func (c *GitHubClient) endpoint(path string) string {
+	base := strings.TrimSuffix(c.BaseURL, "/")
+	if path == graphQLPath {
+		if api, ok := strings.CutSuffix(base, "/api/v3"); ok {
+			return api + "/api/graphql"
+		}
+	}
+	return base + path
+}
+
+// token returns the token for the next request.
+func (c *GitHubClient) token(ctx context.Context) (string, error) {
+	if c.TokenProvider == nil {
+		return c.Token, nil
+	}
+	token, err := c.TokenProvider.Token(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get GitHub token: %w", err)
+	}
+	c.tokenMu.Lock()
+	c.lastToken = token
+	c.tokenMu.Unlock()
+	return token, nil
+}
+
+// currentToken is the token last used, or Token before the first request.
+func (c *GitHubClient) currentToken() string {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	if c.lastToken != "" {
+		return c.lastToken
+	}
+	return c.Token
+}
+
+// observe records the rate-limit headers of a response. Those of other
+// limits than the core REST one, such as GraphQL's, are ignored.
+func (c *GitHubClient) observe(h http.Header) {
+	if r := h.Get("X-RateLimit-Resource"); r != "" && r != "core" {
+		return
+	}
+	remaining, err1 := strconv.Atoi(h.Get("X-RateLimit-Remaining"))
+	reset, err2 := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64)
+	if err1 != nil || err2 != nil {
+		return
+	}
+	limit, _ := strconv.Atoi(h.Get("X-RateLimit-Limit"))
+	c.rateMu.Lock()
+	c.rate = RateLimit{Limit: limit, Remaining: remaining, Reset: time.Unix(reset, 0)}
+	c.rateSeen = true
+	c.rateMu.Unlock()
+}
+
+// pace blocks until the rate-limit window resets if the last response left
+// no more than RateLimitFloor requests.
+func (c *GitHubClient) pace(ctx context.Context) error {
+	if c.RateLimitFloor <= 0 {
+		return nil
+	}
+	rl, ok := c.LastRateLimit()
+	if !ok || rl.Remaining > c.RateLimitFloor {
+		return nil
+	}
+	clock := ClockOr(c.Clock)
+	wait := rl.Reset.Sub(clock.Now()) + time.Second
+	if wait <= 0 {
+		return nil
+	}
+	LoggerOr(c.Logger).Warn("waiting for github rate limit reset", "remaining", rl.Remaining, "wait", wait)
+	trace.SpanFromContext(ctx).AddEvent("rate_limit_wait", trace.WithAttributes(attribute.String("nodeprop.wait", wait.String())))
+	defer c.Metrics.pause()()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-clock.After(wait):
+		return nil
+	}
+}
+
+// LastRateLimit returns the rate limit reported by the most recent response.
+func (c *GitHubClient) LastRateLimit() (RateLimit, bool) {
+	c.rateMu.Lock()
+	defer c.rateMu.Unlock()
+	return c.rate, c.rateSeen
+}
+
+// Ping checks that the API base URL is reachable and returns the round-trip time.
+func (c *GitHubClient) Ping(ctx context.Context) (time.Duration, error) {
+	start := time.Now()
+	if err := c.do(ctx, "GET", "/meta", nil, nil); err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
+
+// TokenInfo describes the authenticated token.
+type TokenInfo struct {
+	Login string
+	// Scopes lists classic OAuth/PAT scopes. It is nil for fine-grained
+	// and GitHub App tokens, which GitHub does not report scopes for.
+	Scopes []string
+}
+
+// HasScope reports whether the token carries scope.
+func (t *TokenInfo) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenInfo returns the login and scopes of the client's token.
+func (c *GitHubClient) TokenInfo(ctx context.Context) (*TokenInfo, error) {
+	resp, err := c.send(ctx, "GET", "/user", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var user struct {
+		Login string `json:"login"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	info := &TokenInfo{Login: user.Login}
+	if h := resp.Header.Get("X-OAuth-Scopes"); h != "" {
+		for _, s := range strings.Split(h, ",") {
+			info.Scopes = append(info.Scopes, strings.TrimSpace(s))
+		}
+	}
+	return info, nil
+}
+
+// RateLimit is the core REST rate-limit window.
+type RateLimit struct {
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+}
+
+// RateLimit returns the core rate limit for the client's token.
+func (c *GitHubClient) RateLimit(ctx context.Context) (*RateLimit, error) {
+	var out struct {
+		Resources struct {
+			Core struct {
+				Limit     int   `json:"limit"`
+				Remaining int   `json:"remaining"`
+				Reset     int64 `json:"reset"`
+			} `json:"core"`
+		} `json:"resources"`
+	}
+	if err := c.do(ctx, "GET", "/rate_limit", nil, &out); err != nil {
+		return nil, err
+	}
+	core := out.Resources.Core
+	return &RateLimit{Limit: core.Limit, Remaining: core.Remaining, Reset: time.Unix(core.Reset, 0)}, nil
+}
+
+// FileContents fetches a file from repo at ref; an empty ref means the
+// default branch.
+func (c *GitHubClient) FileContents(ctx context.Context, repo, path, ref string) ([]byte, error) {
+	p := fmt.Sprintf("/repos/%s/contents/%s", repo, strings.TrimPrefix(path, "/"))
+	if ref != "" {
+		p += "?ref=" + url.QueryEscape(ref)
+	}
+	var out struct {
+		Content  string `json:"content"`
+		Encoding string `json:"encoding"`
+	}
+	if err := c.do(ctx, "GET", p, nil, &out); err != nil {
+		return nil, err
+	}
+	if out.Encoding != "base64" {
+		return nil, fmt.Errorf("%s in %s: unsupported encoding %q", path, repo, out.Encoding)
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(out.Content, "\n", ""))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,158 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// graphQLPath is the path of GitHub's GraphQL endpoint; see endpoint.
+const graphQLPath = "/graphql"
+
+// graphQLBatch is the number of repositories read per GraphQL query, well
+// within GitHub's limits on the nodes and cost of one query.
+const graphQLBatch = 50
+
+// repositoryFields selects the fields of Repository in a GraphQL query.
+const repositoryFields = "fragment repo on Repository { nameWithOwner isArchived isDisabled isPrivate defaultBranchRef { name } }"
+
+// GetRepositories reads repos, as owner/name, with one GraphQL query per
+// 50 of them instead of a request each, keyed as given. Repositories that
+// do not exist or the token cannot see are missing from the result. If the
+// endpoint has no GraphQL API, or a query cannot answer for a repository,
+// it is read with GetRepository instead.
+func (c *GitHubClient) GetRepositories(ctx context.Context, repos []string) (map[string]*Repository, error) {
+	out := make(map[string]*Repository, len(repos))
+	var rest []string
+	for start := 0; start < len(repos); start += graphQLBatch {
+		batch := repos[start:min(start+graphQLBatch, len(repos))]
+		unanswered, err := c.queryRepositories(ctx, batch, out)
+		if noGraphQL(err) {
+			rest = append(rest, repos[start:]...)
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		rest = append(rest, unanswered...)
+	}
+	for _, repo := range rest {
+		r, err := c.GetRepository(ctx, repo)
+		if IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		out[repo] = r
+	}
+	return out, nil
+}
+
+// graphQLRepository is a repository as repositoryFields reads it.
+type graphQLRepository struct {
+	NameWithOwner    string `json:"nameWithOwner"`
+	IsArchived       bool   `json:"isArchived"`
+	IsDisabled       bool   `json:"isDisabled"`
+	IsPrivate        bool   `json:"isPrivate"`
+	DefaultBranchRef *struct {
+		Name string `json:"name"`
+	} `json:"defaultBranchRef"`
+}
+
+// graphQLError is an entry of a GraphQL response's errors.
+type graphQLError struct {
+	Type    string        `json:"type"`
+	Path    []interface{} `json:"path"`
+	Message string        `json:"message"`
+}
+
+// queryRepositories reads batch in one query, adding what it finds to out,
+// and returns the repositories it could not answer for.
+func (c *GitHubClient) queryRepositories(ctx context.Context, batch []string, out map[string]*Repository) ([]string, error) {
+	var q strings.Builder
+	var fields strings.Builder
+	vars := map[string]string{}
+	var unanswered []string
+	alias := map[string]string{}
+	q.WriteString("query(")
+	for i, repo := range batch {
+		owner, name, ok := strings.Cut(repo, "/")
+		if !ok || owner == "" || name == "" {
+			unanswered = append(unanswered, repo)
+			continue
+		}
+		n := strconv.Itoa(i)
+		if len(vars) > 0 {
+			q.WriteString(", ")
+		}
+		fmt.Fprintf(&q, "$o%s: String!, $n%s: String!", n, n)
+		fmt.Fprintf(&fields, " r%s: repository(owner: $o%s, name: $n%s) { ...repo }", n, n, n)
+		vars["o"+n], vars["n"+n] = owner, name
+		alias["r"+n] = repo
+	}
+	if len(alias) == 0 {
+		return unanswered, nil
+	}
+	q.WriteString(") {")
+	q.WriteString(fields.String())
+	q.WriteString(" } ")
+	q.WriteString(repositoryFields)
+
+	var resp struct {
+		Data   map[string]*graphQLRepository `json:"data"`
+		Errors []graphQLError                `json:"errors"`
+	}
+	in := map[string]interface{}{"query": q.String(), "variables": vars}
+	if err := c.do(ctx, "POST", graphQLPath, in, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Data == nil && len(resp.Errors) > 0 {
+		return nil, fmt.Errorf("graphql: %s", resp.Errors[0].Message)
+	}
+	notFound := map[string]bool{}
+	for _, e := range resp.Errors {
+		if len(e.Path) > 0 && e.Type == "NOT_FOUND" {
+			if a, ok := e.Path[0].(string); ok {
+				notFound[a] = true
+			}
+		}
+	}
+	for a, repo := range alias {
+		r := resp.Data[a]
+		switch {
+		case r != nil:
+			out[repo] = r.repository()
+		case !notFound[a]:
+			// Some other error, such as a SAML enforcement, that the REST
+			// API reports properly.
+			unanswered = append(unanswered, repo)
+		}
+	}
+	return unanswered, nil
+}
+
+func (r *graphQLRepository) repository() *Repository {
+	repo := &Repository{FullName: r.NameWithOwner, Archived: r.IsArchived, Disabled: r.IsDisabled, Private: r.IsPrivate}
+	if r.DefaultBranchRef != nil {
+		repo.DefaultBranch = r.DefaultBranchRef.Name
+	}
+	return repo
+}
+
+// noGraphQL reports whether err means the endpoint has no GraphQL API, as
+// on some proxies and fakes.
+func noGraphQL(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.StatusCode {
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return true
+	}
+	return false
+}
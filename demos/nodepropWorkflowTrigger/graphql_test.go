@@ -0,0 +1,257 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// graphQLServer serves repositories over GraphQL, unless noGraphQL is
+// set, and REST. Those listed in missing do not exist and those in saml
+// are refused by GraphQL but readable over REST.
+type graphQLServer struct {
+	noGraphQL bool
+	failQuery bool
+	missing   map[string]bool
+	saml      map[string]bool
+
+	queries, rest atomic.Int32
+}
+
+func (s *graphQLServer) start(t *testing.T) *GitHubClient {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/graphql" {
+			s.queries.Add(1)
+			if s.noGraphQL {
+				http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+				return
+			}
+			s.graphQL(t, w, r)
+			return
+		}
+		s.rest.Add(1)
+		repo, _ := strings.CutPrefix(r.URL.Path, "/repos/")
+		if owner, name, ok := strings.Cut(repo, "/"); !ok || owner == "" || name == "" || s.missing[repo] {
+			http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(Repository{FullName: repo, DefaultBranch: "main", Stars: 1})
+	}))
+	t.Cleanup(srv.Close)
+	c := NewGitHubClient("token")
+	c.BaseURL = srv.URL
+	return c
+}
+
+func (s *graphQLServer) graphQL(t *testing.T, w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		Query     string            `json:"query"`
+		Variables map[string]string `json:"variables"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		t.Errorf("GraphQL request: %v", err)
+	}
+	// GraphQL has its own rate limit, which is not the core one.
+	w.Header().Set("X-RateLimit-Resource", "graphql")
+	w.Header().Set("X-RateLimit-Remaining", "1")
+	w.Header().Set("X-RateLimit-Reset", "1700000000")
+	if s.failQuery {
+		fmt.Fprint(w, `{"errors": [{"message": "Something went wrong"}]}`)
+		return
+	}
+	data := map[string]interface{}{}
+	var errs []graphQLError
+	for k, owner := range in.Variables {
+		n, ok := strings.CutPrefix(k, "o")
+		if !ok {
+			continue
+		}
+		alias, repo := "r"+n, owner+"/"+in.Variables["n"+n]
+		if !strings.Contains(in.Query, alias+": repository(owner: $o"+n+", name: $n"+n+")") {
+			t.Errorf("query %q does not read %s as %s", in.Query, repo, alias)
+		}
+		switch {
+		case s.missing[repo]:
+			data[alias] = nil
+			errs = append(errs, graphQLError{Type: "NOT_FOUND", Path: []interface{}{alias}, Message: "Could not resolve to a Repository"})
+		case s.saml[repo]:
+			data[alias] = nil
+			errs = append(errs, graphQLError{Type: "FORBIDDEN", Path: []interface{}{alias}, Message: "SAML enforcement"})
+		default:
+			data[alias] = map[string]interface{}{"nameWithOwner": repo, "isPrivate": true, "defaultBranchRef": map[string]string{"name": "main"}}
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data, "errors": errs})
+}
+
+func repoNames(n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("o/repo-%d", i)
+	}
+	return names
+}
+
+func TestGetRepositories(t *testing.T) {
+	tests := []struct {
+		name        string
+		server      *graphQLServer
+		repos       []string
+		wantFound   int
+		wantQueries int32
+		wantREST    int32
+	}{
+		{name: "one batch", repos: repoNames(3), wantFound: 3, wantQueries: 1},
+		{name: "several batches", repos: repoNames(120), wantFound: 120, wantQueries: 3},
+		{name: "none", wantQueries: 0},
+		{
+			name:        "not found",
+			server:      &graphQLServer{missing: map[string]bool{"o/repo-1": true}},
+			repos:       repoNames(3),
+			wantFound:   2,
+			wantQueries: 1,
+		},
+		{
+			name:        "refused by GraphQL",
+			server:      &graphQLServer{saml: map[string]bool{"o/repo-1": true}},
+			repos:       repoNames(3),
+			wantFound:   3,
+			wantQueries: 1,
+			wantREST:    1,
+		},
+		{
+			name:        "not owner/name",
+			repos:       append(repoNames(1), "site", "/site"),
+			wantFound:   1,
+			wantQueries: 1,
+			wantREST:    2,
+		},
+		{
+			name:        "no GraphQL",
+			server:      &graphQLServer{noGraphQL: true, missing: map[string]bool{"o/repo-2": true}},
+			repos:       repoNames(60),
+			wantFound:   59,
+			wantQueries: 1,
+			wantREST:    60,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.server
+			if s == nil {
+				s = &graphQLServer{}
+			}
+			c := s.start(t)
+			got, err := c.GetRepositories(context.Background(), tt.repos)
+			if err != nil {
+				t.Fatalf("GetRepositories() error = %v", err)
+			}
+			if len(got) != tt.wantFound {
+				t.Errorf("GetRepositories() found %d repositories, want %d", len(got), tt.wantFound)
+			}
+			for name, r := range got {
+				if r.FullName != name || r.DefaultBranch != "main" {
+					t.Errorf("GetRepositories()[%s] = %+v", name, r)
+				}
+			}
+			if q, n := s.queries.Load(), s.rest.Load(); q != tt.wantQueries || n != tt.wantREST {
+				t.Errorf("sent %d queries and %d REST requests, want %d and %d", q, n, tt.wantQueries, tt.wantREST)
+			}
+			if rl, ok := c.LastRateLimit(); ok {
+				t.Errorf("LastRateLimit() = %+v, want the GraphQL limit ignored", rl)
+			}
+		})
+	}
+}
+
+func TestGetRepositoriesFields(t *testing.T) {
+	s := &graphQLServer{}
+	c := s.start(t)
+	got, err := c.GetRepositories(context.Background(), []string{"o/site"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Repository{FullName: "o/site", DefaultBranch: "main", Private: true}
+	if r := got["o/site"]; r == nil || r.FullName != want.FullName || r.DefaultBranch != want.DefaultBranch || !r.Private || r.Archived || r.Stars != 0 {
+		t.Errorf("GetRepositories() = %+v, want %+v", r, want)
+	}
+}
+
+func TestGetRepositoriesQueryError(t *testing.T) {
+	s := &graphQLServer{failQuery: true}
+	c := s.start(t)
+	if _, err := c.GetRepositories(context.Background(), repoNames(2)); err == nil || !strings.Contains(err.Error(), "Something went wrong") {
+		t.Errorf("GetRepositories() error = %v, want the query's error", err)
+	}
+	if n := s.rest.Load(); n != 0 {
+		t.Errorf("sent %d REST requests after the query failed", n)
+	}
+}
+
+func TestGitHubClientEndpoint(t *testing.T) {
+	tests := []struct {
+		base string
+		path string
+		want string
+	}{
+		{base: "https://api.github.com", path: "/repos/o/r", want: "https://api.github.com/repos/o/r"},
+		{base: "https://api.github.com/", path: graphQLPath, want: "https://api.github.com/graphql"},
+		{base: "https://ghe.example.com/api/v3", path: "/repos/o/r", want: "https://ghe.example.com/api/v3/repos/o/r"},
+		{base: "https://ghe.example.com/api/v3/", path: graphQLPath, want: "https://ghe.example.com/api/graphql"},
+	}
+	for _, tt := range tests {
+		c := &GitHubClient{BaseURL: tt.base}
+		if got := c.endpoint(tt.path); got != tt.want {
+			t.Errorf("endpoint(%q) with base %s = %q, want %q", tt.path, tt.base, got, tt.want)
+		}
+	}
+}
+
+func TestObserveIgnoresOtherLimits(t *testing.T) {
+	tests := []struct {
+		resource string
+		want     bool
+	}{
+		{resource: "", want: true},
+		{resource: "core", want: true},
+		{resource: "graphql"},
+		{resource: "search"},
+	}
+	for _, tt := range tests {
+		c := &GitHubClient{}
+		h := http.Header{}
+		h.Set("X-RateLimit-Resource", tt.resource)
+		h.Set("X-RateLimit-Remaining", "10")
+		h.Set("X-RateLimit-Reset", "1700000000")
+		c.observe(h)
+		if _, ok := c.LastRateLimit(); ok != tt.want {
+			t.Errorf("observed the %q limit = %v, want %v", tt.resource, ok, tt.want)
+		}
+	}
+}
+
+// The query names variables and aliases by position in the batch.
+func TestQueryRepositoriesAliases(t *testing.T) {
+	s := &graphQLServer{}
+	c := s.start(t)
+	out := map[string]*Repository{}
+	unanswered, err := c.queryRepositories(context.Background(), []string{"bare", "o/a", "o/b"}, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, 0, len(out))
+	for name := range out {
+		got = append(got, name)
+	}
+	sort.Strings(got)
+	if strings.Join(got, ",") != "o/a,o/b" || strings.Join(unanswered, ",") != "bare" {
+		t.Errorf("queryRepositories() answered %v, left %v", got, unanswered)
+	}
+}
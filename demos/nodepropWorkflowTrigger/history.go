@@ -0,0 +1,285 @@
+package flow
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ConclusionDispatchFailed is recorded for dispatches the API rejected. Such
+// records are completed, have no run, and carry the error in Error.
+const ConclusionDispatchFailed = "dispatch_failed"
+
+// DispatchRecord describes a single dispatch and, once resolved, the run it
+// spawned. A non-empty IdempotencyKey prevents a second dispatch with the same
+// key; ReplayOf names the failed dispatch this one re-executes. Schedule
+// names the schedule that fired it, at the time given by ScheduledFor.
+type DispatchRecord struct {
+	ID             string            `json:"id"`
+	Repo           string            `json:"repo"`
+	Workflow       string            `json:"workflow"`
+	Ref            string            `json:"ref"`
+	Inputs         map[string]string `json:"inputs,omitempty"`
+	DispatchedAt   time.Time         `json:"dispatched_at"`
+	RunID          int64             `json:"run_id,omitempty"`
+	RunURL         string            `json:"run_url,omitempty"`
+	RunStartedAt   time.Time         `json:"run_started_at,omitempty"`
+	Status         string            `json:"status,omitempty"`
+	Conclusion     string            `json:"conclusion,omitempty"`
+	UpdatedAt      time.Time         `json:"updated_at,omitempty"`
+	Error          string            `json:"error,omitempty"`
+	IdempotencyKey string            `json:"idempotency_key,omitempty"`
+	ReplayOf       string            `json:"replay_of,omitempty"`
+	Schedule       string            `json:"schedule,omitempty"`
+	ScheduledFor   time.Time         `json:"scheduled_for,omitempty"`
+	Approval       string            `json:"approval,omitempty"`
+	CorrelationID  string            `json:"correlation_id,omitempty"`
+}
+
+// Completed reports whether the spawned run has finished.
+func (r *DispatchRecord) Completed() bool {
+	return r.Status == "completed"
+}
+
+// Failed reports whether the dispatch was rejected or its run failed. Runs
+// that were cancelled are not failures.
+func (r *DispatchRecord) Failed() bool {
+	if !r.Completed() {
+		return false
+	}
+	switch r.Conclusion {
+	case "failure", "timed_out", "startup_failure", ConclusionDispatchFailed:
+		return true
+	}
+	return false
+}
+
+// Duration is the time from dispatch until the run finished, including any
+// time spent queued. It is zero until the run has completed and for
+// dispatches that never started a run.
+func (r *DispatchRecord) Duration() time.Duration {
+	if !r.Completed() || r.RunID == 0 || r.UpdatedAt.Before(r.DispatchedAt) {
+		return 0
+	}
+	return r.UpdatedAt.Sub(r.DispatchedAt)
+}
+
+// StartLatency is the time from dispatch until the run started. It is zero
+// until the run has started.
+func (r *DispatchRecord) StartLatency() time.Duration {
+	if r.RunStartedAt.Before(r.DispatchedAt) {
+		return 0
+	}
+	return r.RunStartedAt.Sub(r.DispatchedAt)
+}
+
+// RunDuration is the time from the run starting until it finished. It is
+// zero until the run has completed.
+func (r *DispatchRecord) RunDuration() time.Duration {
+	if !r.Completed() || r.RunStartedAt.IsZero() || r.UpdatedAt.Before(r.RunStartedAt) {
+		return 0
+	}
+	return r.UpdatedAt.Sub(r.RunStartedAt)
+}
+
+// HistoryStore persists dispatch records.
+type HistoryStore interface {
+	Append(rec DispatchRecord) error
+	Update(rec DispatchRecord) error
+	List(repo string) ([]DispatchRecord, error)
+}
+
+// History statuses matched by HistoryQuery.Status besides run conclusions.
+const (
+	HistoryPending   = "pending"
+	HistoryCompleted = "completed"
+	HistoryFailed    = "failed"
+)
+
+// HistoryQuery selects dispatch records. Zero fields match every record.
+type HistoryQuery struct {
+	Repo string
+	// Since and Until bound DispatchedAt; Since is inclusive and Until
+	// exclusive.
+	Since time.Time
+	Until time.Time
+	// Status is HistoryPending, HistoryCompleted, HistoryFailed, or a run
+	// conclusion such as success or dispatch_failed.
+	Status string
+	// ID is a dispatch ID, as carried to the run in CorrelationInput.
+	ID string
+	// CorrelationID selects the dispatches of one operation.
+	CorrelationID string
+	// Limit caps the number of records returned; 0 means no limit.
+	Limit int
+}
+
+// Matches reports whether rec satisfies every field of q but Limit.
+func (q HistoryQuery) Matches(rec DispatchRecord) bool {
+	switch {
+	case q.Repo != "" && rec.Repo != q.Repo,
+		q.ID != "" && rec.ID != q.ID,
+		q.CorrelationID != "" && rec.CorrelationID != q.CorrelationID,
+		!q.Since.IsZero() && rec.DispatchedAt.Before(q.Since),
+		!q.Until.IsZero() && !rec.DispatchedAt.Before(q.Until):
+		return false
+	}
+	switch q.Status {
+	case "":
+		return true
+	case HistoryPending:
+		return !rec.Completed()
+	case HistoryCompleted:
+		return rec.Completed()
+	case HistoryFailed:
+		return rec.Failed()
+	}
+	return rec.Completed() && rec.Conclusion == q.Status
+}
+
+// HistoryQuerier is implemented by history stores that filter records
+// themselves rather than listing them all.
+type HistoryQuerier interface {
+	Query(q HistoryQuery) ([]DispatchRecord, error)
+}
+
+// QueryHistory returns the records in store matching q, newest first. It
+// uses the store's Query method if it has one.
+func QueryHistory(store HistoryStore, q HistoryQuery) ([]DispatchRecord, error) {
+	if qs, ok := store.(HistoryQuerier); ok {
+		return qs.Query(q)
+	}
+	recs, err := store.List(q.Repo)
+	if err != nil {
+		return nil, err
+	}
+	return FilterHistory(recs, q), nil
+}
+
+// FilterHistory returns the records in recs that match q, up to q.Limit,
+// keeping their order.
+func FilterHistory(recs []DispatchRecord, q HistoryQuery) []DispatchRecord {
+	var out []DispatchRecord
+	for _, rec := range recs {
+		if q.Limit > 0 && len(out) == q.Limit {
+			break
+		}
+		if q.Matches(rec) {
+			out = append(out, rec)
+		}
+	}
+	return out
+}
+
+// FileHistoryStore keeps dispatch records in a JSON file.
+type FileHistoryStore struct {
+	Path string
+	mu   sync.Mutex
+}
+
+// NewFileHistoryStore creates a FileHistoryStore backed by path.
+func NewFileHistoryStore(path string) *FileHistoryStore {
+	return &FileHistoryStore{Path: path}
+}
+
+// DefaultHistoryPath returns the per-user location of the dispatch history file.
+func DefaultHistoryPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "nodeprop", "history.json")
+}
+
+// Append adds a record to the store.
+func (s *FileHistoryStore) Append(rec DispatchRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recs, err := s.load()
+	if err != nil {
+		return err
+	}
+	return s.save(append(recs, rec))
+}
+
+// Update replaces the record with the same ID.
+func (s *FileHistoryStore) Update(rec DispatchRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recs, err := s.load()
+	if err != nil {
+		return err
+	}
+	for i := range recs {
+		if recs[i].ID == rec.ID {
+			recs[i] = rec
+			return s.save(recs)
+		}
+	}
+	return fmt.Errorf("dispatch %s not found", rec.ID)
+}
+
+// List returns the records for repo, newest first. An empty repo lists all records.
+func (s *FileHistoryStore) List(repo string) ([]DispatchRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recs, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	var out []DispatchRecord
+	for _, r := range recs {
+		if repo == "" || r.Repo == repo {
+			out = append(out, r)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].DispatchedAt.After(out[j].DispatchedAt) })
+	return out, nil
+}
+
+// Query returns the records matching q, newest first.
+func (s *FileHistoryStore) Query(q HistoryQuery) ([]DispatchRecord, error) {
+	recs, err := s.List(q.Repo)
+	if err != nil {
+		return nil, err
+	}
+	return FilterHistory(recs, q), nil
+}
+
+func (s *FileHistoryStore) load() ([]DispatchRecord, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	var recs []DispatchRecord
+	if err := json.Unmarshal(data, &recs); err != nil {
+		return nil, fmt.Errorf("failed to parse history %s: %w", s.Path, err)
+	}
+	return recs, nil
+}
+
+func (s *FileHistoryStore) save(recs []DispatchRecord) error {
+	data, err := json.MarshalIndent(recs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal history: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o755); err != nil {
+		return fmt.Errorf("failed to create history dir: %w", err)
+	}
+	tmp := s.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return os.Rename(tmp, s.Path)
+}
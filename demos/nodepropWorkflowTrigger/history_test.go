@@ -0,0 +1,80 @@
+package flow
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistoryQueryMatches(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	pending := DispatchRecord{ID: "a", Repo: "o/r", CorrelationID: "op", DispatchedAt: at}
+	succeeded := DispatchRecord{ID: "b", Repo: "o/r", DispatchedAt: at, Status: "completed", Conclusion: "success"}
+	failed := DispatchRecord{ID: "c", Repo: "o/r", DispatchedAt: at, Status: "completed", Conclusion: ConclusionDispatchFailed}
+	cancelled := DispatchRecord{ID: "d", Repo: "o/r", DispatchedAt: at, Status: "completed", Conclusion: "cancelled"}
+	tests := []struct {
+		name string
+		q    HistoryQuery
+		rec  DispatchRecord
+		want bool
+	}{
+		{name: "zero query", rec: pending, want: true},
+		{name: "repo", q: HistoryQuery{Repo: "o/other"}, rec: pending},
+		{name: "id", q: HistoryQuery{ID: "a"}, rec: pending, want: true},
+		{name: "other id", q: HistoryQuery{ID: "b"}, rec: pending},
+		{name: "correlation id", q: HistoryQuery{CorrelationID: "op"}, rec: pending, want: true},
+		{name: "since inclusive", q: HistoryQuery{Since: at}, rec: pending, want: true},
+		{name: "since after", q: HistoryQuery{Since: at.Add(time.Second)}, rec: pending},
+		{name: "until exclusive", q: HistoryQuery{Until: at}, rec: pending},
+		{name: "until after", q: HistoryQuery{Until: at.Add(time.Second)}, rec: pending, want: true},
+		{name: "pending", q: HistoryQuery{Status: HistoryPending}, rec: pending, want: true},
+		{name: "pending completed", q: HistoryQuery{Status: HistoryPending}, rec: succeeded},
+		{name: "completed", q: HistoryQuery{Status: HistoryCompleted}, rec: cancelled, want: true},
+		{name: "failed dispatch", q: HistoryQuery{Status: HistoryFailed}, rec: failed, want: true},
+		{name: "cancelled is not failed", q: HistoryQuery{Status: HistoryFailed}, rec: cancelled},
+		{name: "conclusion", q: HistoryQuery{Status: "success"}, rec: succeeded, want: true},
+		{name: "other conclusion", q: HistoryQuery{Status: "success"}, rec: cancelled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.q.Matches(tt.rec); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileHistoryStore(t *testing.T) {
+	s := NewFileHistoryStore(filepath.Join(t.TempDir(), "history", "history.json"))
+	if recs, err := s.List(""); err != nil || len(recs) != 0 {
+		t.Fatalf("List() of a missing file = %v, %v", recs, err)
+	}
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i, id := range []string{"a", "b", "c"} {
+		repo := "o/r"
+		if id == "b" {
+			repo = "o/other"
+		}
+		if err := s.Append(DispatchRecord{ID: id, Repo: repo, DispatchedAt: at.Add(time.Duration(i) * time.Minute)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Update(DispatchRecord{ID: "a", Repo: "o/r", DispatchedAt: at, Status: "completed", Conclusion: "success"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Update(DispatchRecord{ID: "missing"}); err == nil {
+		t.Error("Update() of a missing record succeeded")
+	}
+
+	recs, err := s.List("o/r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2 || recs[0].ID != "c" || recs[1].ID != "a" || !recs[1].Completed() {
+		t.Errorf("List() = %+v, want c then the updated a", recs)
+	}
+	recs, err = QueryHistory(s, HistoryQuery{Status: HistoryPending, Limit: 1})
+	if err != nil || len(recs) != 1 || recs[0].ID != "c" {
+		t.Errorf("QueryHistory() = %+v, %v; want the newest pending record", recs, err)
+	}
+}
@@ -0,0 +1,143 @@
+package flow
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HTTPConfig tunes the connections of an HTTP client. Dispatching to
+// hundreds of repositories reuses a few pooled connections to the API,
+// multiplexed over HTTP/2, instead of dialing and handshaking for each
+// request. Zero fields take the defaults of DefaultHTTPConfig.
+//
+//	http:
+//	  max_conns_per_host: 32
+//	  response_header_timeout: 20s
+type HTTPConfig struct {
+	// Timeout bounds a whole request, including reading the body. The
+	// default is none, as job logs are streamed; the other timeouts
+	// bound each phase.
+	Timeout time.Duration `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	// DialTimeout and KeepAlive apply to the TCP connections.
+	DialTimeout time.Duration `yaml:"dial_timeout,omitempty" json:"dial_timeout,omitempty"`
+	KeepAlive   time.Duration `yaml:"keep_alive,omitempty" json:"keep_alive,omitempty"`
+	// TLSHandshakeTimeout bounds the TLS handshake of a new connection.
+	TLSHandshakeTimeout time.Duration `yaml:"tls_handshake_timeout,omitempty" json:"tls_handshake_timeout,omitempty"`
+	// ResponseHeaderTimeout bounds the wait for a response once the
+	// request is sent.
+	ResponseHeaderTimeout time.Duration `yaml:"response_header_timeout,omitempty" json:"response_header_timeout,omitempty"`
+	// IdleConnTimeout is how long an idle connection stays in the pool.
+	IdleConnTimeout time.Duration `yaml:"idle_conn_timeout,omitempty" json:"idle_conn_timeout,omitempty"`
+	// MaxIdleConns and MaxIdleConnsPerHost bound the pool of idle
+	// connections; MaxConnsPerHost, if set, bounds all connections to a
+	// host, idle or not.
+	MaxIdleConns        int `yaml:"max_idle_conns,omitempty" json:"max_idle_conns,omitempty"`
+	MaxIdleConnsPerHost int `yaml:"max_idle_conns_per_host,omitempty" json:"max_idle_conns_per_host,omitempty"`
+	MaxConnsPerHost     int `yaml:"max_conns_per_host,omitempty" json:"max_conns_per_host,omitempty"`
+	// DisableHTTP2 keeps connections on HTTP/1.1, e.g. behind a proxy
+	// that mishandles HTTP/2.
+	DisableHTTP2 bool `yaml:"disable_http2,omitempty" json:"disable_http2,omitempty"`
+}
+
+// DefaultHTTPConfig returns the settings of SharedHTTPClient. Unlike
+// http.DefaultTransport, it keeps enough idle connections per host for a
+// fan-out to reuse them rather than closing all but two.
+func DefaultHTTPConfig() HTTPConfig {
+	return HTTPConfig{
+		DialTimeout:           10 * time.Second,
+		KeepAlive:             30 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   32,
+	}
+}
+
+// withDefaults returns c with its zero fields set from DefaultHTTPConfig.
+func (c HTTPConfig) withDefaults() HTTPConfig {
+	d := DefaultHTTPConfig()
+	for _, f := range []struct{ v, def *time.Duration }{
+		{&c.DialTimeout, &d.DialTimeout},
+		{&c.KeepAlive, &d.KeepAlive},
+		{&c.TLSHandshakeTimeout, &d.TLSHandshakeTimeout},
+		{&c.ResponseHeaderTimeout, &d.ResponseHeaderTimeout},
+		{&c.IdleConnTimeout, &d.IdleConnTimeout},
+	} {
+		if *f.v == 0 {
+			*f.v = *f.def
+		}
+	}
+	if c.MaxIdleConns == 0 {
+		c.MaxIdleConns = d.MaxIdleConns
+	}
+	if c.MaxIdleConnsPerHost == 0 {
+		c.MaxIdleConnsPerHost = d.MaxIdleConnsPerHost
+	}
+	return c
+}
+
+// Transport returns a pooled transport with c's settings, using the
+// proxy from the environment and, if tlsConfig is not nil, its TLS
+// settings.
+func (c HTTPConfig) Transport(tlsConfig *tls.Config) *http.Transport {
+	c = c.withDefaults()
+	dialer := &net.Dialer{Timeout: c.DialTimeout, KeepAlive: c.KeepAlive}
+	tr := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig.Clone(),
+		TLSHandshakeTimeout:   c.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: c.ResponseHeaderTimeout,
+		ExpectContinueTimeout: time.Second,
+		IdleConnTimeout:       c.IdleConnTimeout,
+		MaxIdleConns:          c.MaxIdleConns,
+		MaxIdleConnsPerHost:   c.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       c.MaxConnsPerHost,
+		// A transport with its own TLS or dial settings only negotiates
+		// HTTP/2 when asked to.
+		ForceAttemptHTTP2: !c.DisableHTTP2,
+	}
+	if c.DisableHTTP2 {
+		tr.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return tr
+}
+
+// Client returns an HTTP client with c's settings whose connections use
+// t's ClientConfig, if t configures anything. Clients share nothing, so
+// build one per configuration and keep it: SharedHTTPClient is the one
+// for the defaults.
+func (c HTTPConfig) Client(t *TLSConfig) (*http.Client, error) {
+	var tlsConfig *tls.Config
+	if !t.IsZero() {
+		var err error
+		if tlsConfig, err = t.ClientConfig(); err != nil {
+			return nil, err
+		}
+	}
+	return &http.Client{Transport: c.Transport(tlsConfig), Timeout: c.Timeout}, nil
+}
+
+var sharedHTTPClient = sync.OnceValue(func() *http.Client {
+	c, _ := DefaultHTTPConfig().Client(nil)
+	return c
+})
+
+// SharedHTTPClient returns the client of DefaultHTTPConfig that clients
+// without an HTTPClient of their own use, so that they all draw on one
+// pool of connections.
+func SharedHTTPClient() *http.Client {
+	return sharedHTTPClient()
+}
+
+// httpClientOr returns hc, or SharedHTTPClient if hc is nil.
+func httpClientOr(hc *http.Client) *http.Client {
+	if hc == nil {
+		return SharedHTTPClient()
+	}
+	return hc
+}
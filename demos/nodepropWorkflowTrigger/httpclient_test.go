@@ -0,0 +1,151 @@
+package flow
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTPConfigTransport(t *testing.T) {
+	tests := []struct {
+		name   string
+		config HTTPConfig
+		check  func(*http.Transport) bool
+	}{
+		{name: "defaults", check: func(tr *http.Transport) bool {
+			return tr.TLSHandshakeTimeout == 10*time.Second && tr.ResponseHeaderTimeout == 30*time.Second && tr.IdleConnTimeout == 90*time.Second &&
+				tr.MaxIdleConns == 100 && tr.MaxIdleConnsPerHost == 32 && tr.MaxConnsPerHost == 0 && tr.ForceAttemptHTTP2 && tr.TLSNextProto == nil && tr.Proxy != nil
+		}},
+		{name: "overrides", config: HTTPConfig{ResponseHeaderTimeout: time.Second, MaxIdleConnsPerHost: 4, MaxConnsPerHost: 8}, check: func(tr *http.Transport) bool {
+			return tr.ResponseHeaderTimeout == time.Second && tr.MaxIdleConnsPerHost == 4 && tr.MaxConnsPerHost == 8 && tr.IdleConnTimeout == 90*time.Second
+		}},
+		{name: "http/1.1 only", config: HTTPConfig{DisableHTTP2: true}, check: func(tr *http.Transport) bool {
+			return !tr.ForceAttemptHTTP2 && tr.TLSNextProto != nil && len(tr.TLSNextProto) == 0
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tr := tt.config.Transport(nil); !tt.check(tr) {
+				t.Errorf("Transport() = %+v", tr)
+			}
+		})
+	}
+}
+
+func TestHTTPConfigTransportClonesTLS(t *testing.T) {
+	cfg := &tls.Config{ServerName: "api.github.com"}
+	tr := HTTPConfig{}.Transport(cfg)
+	if tr.TLSClientConfig == cfg || tr.TLSClientConfig.ServerName != "api.github.com" {
+		t.Errorf("TLSClientConfig = %p, want a copy of %p", tr.TLSClientConfig, cfg)
+	}
+}
+
+func TestHTTPConfigProtocols(t *testing.T) {
+	var conns atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Proto)
+	}))
+	srv.EnableHTTP2 = true
+	srv.Config.ConnState = func(_ net.Conn, s http.ConnState) {
+		if s == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.StartTLS()
+	defer srv.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	tests := []struct {
+		name      string
+		config    HTTPConfig
+		wantProto string
+		wantConns int32
+	}{
+		{name: "http/2", wantProto: "HTTP/2.0", wantConns: 1},
+		{name: "http/1.1", config: HTTPConfig{DisableHTTP2: true, MaxIdleConnsPerHost: 10}, wantProto: "HTTP/1.1", wantConns: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conns.Store(0)
+			hc := &http.Client{Transport: tt.config.Transport(&tls.Config{RootCAs: roots})}
+			defer hc.CloseIdleConnections()
+			// After one request has opened a connection, two rounds of
+			// concurrent ones: HTTP/2 multiplexes them all over it, and the
+			// second round of HTTP/1.1 reuses the first's pooled
+			// connections.
+			if resp, err := hc.Get(srv.URL); err == nil {
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+			for range 2 {
+				var wg sync.WaitGroup
+				for range 10 {
+					wg.Go(func() {
+						resp, err := hc.Get(srv.URL)
+						if err != nil {
+							t.Error(err)
+							return
+						}
+						defer resp.Body.Close()
+						if body, _ := io.ReadAll(resp.Body); string(body) != tt.wantProto {
+							t.Errorf("protocol = %s, want %s", body, tt.wantProto)
+						}
+					})
+				}
+				wg.Wait()
+			}
+			if n := conns.Load(); n > tt.wantConns {
+				t.Errorf("%d connections for 21 requests, want at most %d", n, tt.wantConns)
+			}
+		})
+	}
+}
+
+func TestHTTPConfigClient(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		tls     *TLSConfig
+		wantTLS bool
+		wantErr bool
+	}{
+		{name: "no tls"},
+		{name: "zero tls", tls: &TLSConfig{}},
+		{name: "tls", tls: &TLSConfig{ServerName: "ghe.example.com"}, wantTLS: true},
+		{name: "bad tls", tls: &TLSConfig{CA: filepath.Join(dir, "missing.pem")}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hc, err := HTTPConfig{Timeout: time.Minute}.Client(tt.tls)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Client() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			tr := hc.Transport.(*http.Transport)
+			if hc.Timeout != time.Minute || (tr.TLSClientConfig != nil) != tt.wantTLS {
+				t.Errorf("Client() = timeout %v, TLS %+v", hc.Timeout, tr.TLSClientConfig)
+			}
+		})
+	}
+}
+
+func TestSharedHTTPClient(t *testing.T) {
+	if SharedHTTPClient() != SharedHTTPClient() {
+		t.Error("SharedHTTPClient() returned different clients")
+	}
+	own := &http.Client{}
+	if httpClientOr(own) != own || httpClientOr(nil) != SharedHTTPClient() {
+		t.Error("httpClientOr() did not prefer the client given")
+	}
+}
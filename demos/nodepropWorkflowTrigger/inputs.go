@@ -0,0 +1,226 @@
+package flow
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Dispatch runs trigger on target with inputs, a struct, as its params,
+// encoded by EncodeInputs, so a workflow's inputs are declared once as Go
+// fields instead of assembled as strings by every caller:
+//
+//	type Deploy struct {
+//		Environment string `input:"environment,required"`
+//		Version     string `input:"version,required"`
+//		DryRun      bool   `input:"dry_run"`
+//		Replicas    int    `input:"replicas,omitempty"`
+//	}
+//
+//	err := flow.Dispatch(ctx, flow.NewGitHubWorkflowDispatch("deploy.yml", flow.WithRef("main")),
+//		"Cdaprod/site", Deploy{Environment: "prod", Version: "v1.4.2"}, token)
+//
+// Inputs that cannot be encoded, or that GitHub would refuse, are a
+// *ParamError, and nothing is sent.
+func Dispatch[T any](ctx context.Context, trigger Trigger, target string, inputs T, token string) error {
+	params, err := EncodeInputs(inputs)
+	if err != nil {
+		return err
+	}
+	return runTrigger(ctx, trigger, target, params, token)
+}
+
+// EncodeInputs returns the workflow inputs of v, a struct or a pointer to
+// one. Each exported field is an input named by its input tag, or by the
+// field name in snake_case, e.g. DryRun as dry_run; the tag's options are
+// omitempty, which leaves out a zero value, and required, which refuses
+// one. A tag of "-" skips the field, and the fields of an embedded struct
+// without a tag are inputs of v.
+//
+// Strings are sent as they are; bools and numbers as strconv formats them;
+// an encoding.TextMarshaler, such as a time.Time, as its text; and other
+// values, such as slices and maps, as JSON, for the workflow to read with
+// fromJSON. A nil pointer is a zero value. The inputs are checked with
+// ValidateInputs.
+func EncodeInputs(v interface{}) (map[string]string, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, &ParamError{Reason: "inputs are a nil pointer"}
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, &ParamError{Reason: fmt.Sprintf("inputs are a %s, not a struct", rv.Type())}
+	}
+	out := map[string]string{}
+	for _, f := range inputFieldsOf(rv.Type()) {
+		fv, ok := fieldByIndex(rv, f.index)
+		if !ok || fv.IsZero() {
+			if f.required {
+				return nil, &ParamError{Key: f.name, Reason: "required input is empty"}
+			}
+			if f.omitEmpty {
+				continue
+			}
+		}
+		s, err := encodeInput(fv, ok)
+		if err != nil {
+			return nil, &ParamError{Key: f.name, Reason: err.Error()}
+		}
+		out[f.name] = s
+	}
+	if err := ValidateInputs(out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// inputField is a struct field EncodeInputs encodes.
+type inputField struct {
+	name      string
+	index     []int
+	required  bool
+	omitEmpty bool
+}
+
+// inputFields caches the fields of each struct type EncodeInputs has seen.
+var inputFields sync.Map // reflect.Type -> []inputField
+
+func inputFieldsOf(t reflect.Type) []inputField {
+	if fields, ok := inputFields.Load(t); ok {
+		return fields.([]inputField)
+	}
+	fields := collectInputFields(t, nil)
+	inputFields.Store(t, fields)
+	return fields
+}
+
+func collectInputFields(t reflect.Type, index []int) []inputField {
+	var fields []inputField
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		tag, tagged := sf.Tag.Lookup("input")
+		if tag == "-" {
+			continue
+		}
+		idx := append(append([]int(nil), index...), i)
+		ft := sf.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if sf.Anonymous && !tagged && ft.Kind() == reflect.Struct && !isTextMarshaler(ft) {
+			fields = append(fields, collectInputFields(ft, idx)...)
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = snakeCase(sf.Name)
+		}
+		f := inputField{name: name, index: idx}
+		for _, opt := range strings.Split(opts, ",") {
+			switch opt {
+			case "required":
+				f.required = true
+			case "omitempty":
+				f.omitEmpty = true
+			}
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// fieldByIndex is reflect.Value.FieldByIndex, reporting false instead of
+// panicking at a nil embedded pointer.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+var textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+
+func isTextMarshaler(t reflect.Type) bool {
+	return t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType)
+}
+
+// encodeInput returns v as an input value. A field that is not there
+// because of a nil embedded pointer is empty.
+func encodeInput(v reflect.Value, ok bool) (string, error) {
+	if !ok {
+		return "", nil
+	}
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+	if m, ok := asTextMarshaler(v); ok {
+		b, err := m.MarshalText()
+		return string(b), err
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), nil
+	case reflect.Func, reflect.Chan, reflect.Complex64, reflect.Complex128, reflect.UnsafePointer:
+		return "", fmt.Errorf("cannot encode a %s", v.Type())
+	}
+	b, err := json.Marshal(v.Interface())
+	return string(b), err
+}
+
+func asTextMarshaler(v reflect.Value) (encoding.TextMarshaler, bool) {
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		return m, true
+	}
+	if v.CanAddr() {
+		m, ok := v.Addr().Interface().(encoding.TextMarshaler)
+		return m, ok
+	}
+	return nil, false
+}
+
+// snakeCase converts a Go field name to an input name: DryRun is dry_run
+// and HTTPPort is http_port.
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			boundary := i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))
+			if boundary {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
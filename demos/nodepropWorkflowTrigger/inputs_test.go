@@ -0,0 +1,134 @@
+package flow_test
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+type deployInputs struct {
+	Environment string `input:"environment,required"`
+	Version     string `input:"version,required"`
+	DryRun      bool
+	Replicas    int `input:"replicas,omitempty"`
+}
+
+type Common struct {
+	Actor string
+}
+
+type inputKinds struct {
+	*Common
+	HTTPPort  uint16
+	Ratio     float64
+	Deadline  time.Time
+	Regions   []string `input:",omitempty"`
+	Labels    map[string]string
+	Note      *string
+	Secret    string `input:"-"`
+	unexposed string
+}
+
+func TestEncodeInputs(t *testing.T) {
+	note := "hi"
+	deadline := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		in      interface{}
+		want    map[string]string
+		wantKey string
+		wantErr bool
+	}{
+		{
+			name: "tags and defaults",
+			in:   deployInputs{Environment: "prod", Version: "v1.4.2"},
+			want: map[string]string{"environment": "prod", "version": "v1.4.2", "dry_run": "false"},
+		},
+		{
+			name: "pointer",
+			in:   &deployInputs{Environment: "prod", Version: "v1", DryRun: true, Replicas: 3},
+			want: map[string]string{"environment": "prod", "version": "v1", "dry_run": "true", "replicas": "3"},
+		},
+		{name: "required input empty", in: deployInputs{Environment: "prod"}, wantKey: "version", wantErr: true},
+		{
+			name: "kinds",
+			in:   inputKinds{Common: &Common{Actor: "alice"}, HTTPPort: 8080, Ratio: 0.5, Deadline: deadline, Regions: []string{"eu", "us"}, Labels: map[string]string{"a": "b"}, Note: &note, Secret: "s", unexposed: "u"},
+			want: map[string]string{"actor": "alice", "http_port": "8080", "ratio": "0.5", "deadline": "2024-03-01T12:00:00Z", "regions": `["eu","us"]`, "labels": `{"a":"b"}`, "note": "hi"},
+		},
+		{
+			name: "zero values",
+			in:   inputKinds{},
+			want: map[string]string{"actor": "", "http_port": "0", "ratio": "0", "deadline": "0001-01-01T00:00:00Z", "labels": "null", "note": ""},
+		},
+		{name: "not a struct", in: map[string]string{"env": "prod"}, wantErr: true},
+		{name: "nil pointer", in: (*deployInputs)(nil), wantErr: true},
+		{name: "cannot encode", in: struct{ Done chan bool }{Done: make(chan bool)}, wantKey: "done", wantErr: true},
+		{name: "invalid name", in: struct {
+			X string `input:"-x"`
+		}{X: "1"}, wantKey: "-x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := flow.EncodeInputs(tt.in)
+			if tt.wantErr {
+				var pe *flow.ParamError
+				if !errors.As(err, &pe) || pe.Key != tt.wantKey {
+					t.Errorf("EncodeInputs() error = %v, want a *ParamError for %q", err, tt.wantKey)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("EncodeInputs() error = %v", err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("EncodeInputs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeInputsNames(t *testing.T) {
+	in := struct {
+		DryRun      bool
+		HTTPPort    int
+		ID          int
+		UserID      int
+		Region2Zone int
+		V2API       int
+	}{}
+	got, err := flow.EncodeInputs(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"dry_run", "http_port", "id", "user_id", "region2_zone", "v2_api"} {
+		if _, ok := got[name]; !ok {
+			t.Errorf("EncodeInputs() = %v, want an input named %s", got, name)
+		}
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	m := &nodeproptest.MockTrigger{}
+	ctx := context.Background()
+	if err := flow.Dispatch(ctx, m, "Cdaprod/site", deployInputs{Environment: "prod", Version: "v1"}, "token"); err != nil {
+		t.Fatal(err)
+	}
+	m.AssertCalled(t, "Cdaprod/site", map[string]string{"environment": "prod", "version": "v1", "dry_run": "false"})
+	m.AssertToken(t, "token")
+
+	m.Reset()
+	if err := flow.Dispatch(ctx, m, "Cdaprod/site", deployInputs{}, "token"); err == nil {
+		t.Error("Dispatch() with a required input empty succeeded")
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := flow.Dispatch(cancelled, m, "Cdaprod/site", deployInputs{Environment: "prod", Version: "v1"}, "token"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Dispatch() with a cancelled context error = %v", err)
+	}
+	m.AssertCallCount(t, 0)
+}
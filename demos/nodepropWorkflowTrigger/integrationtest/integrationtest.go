@@ -0,0 +1,131 @@
+// Package integrationtest starts the persistence backends of the
+// dispatcher for end-to-end tests: Redis in a container through
+// testcontainers, and SQLite databases in the test's temporary directory.
+// Each helper cleans up after the test, and tests that need Docker skip
+// when it is not available:
+//
+//	func TestDispatchEndToEnd(t *testing.T) {
+//		gh := nodeproptest.NewServer()
+//		defer gh.Close()
+//		gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+//		c := integrationtest.Correlator(t, gh.Client())
+//		...
+//	}
+//
+// Set NODEPROP_TEST_REDIS_URL to use a Redis server already running, such
+// as a CI service container, instead of starting one.
+package integrationtest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/redislock"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/sqlitestore"
+)
+
+// RedisImage is the image Redis starts.
+var RedisImage = "redis:7-alpine"
+
+// startTimeout bounds starting a container, including pulling its image.
+const startTimeout = 2 * time.Minute
+
+// Redis returns the URL of a Redis server for t: NODEPROP_TEST_REDIS_URL
+// if set, or a new container stopped when t ends. Without Docker, t is
+// skipped.
+func Redis(t *testing.T) string {
+	t.Helper()
+	if url := os.Getenv("NODEPROP_TEST_REDIS_URL"); url != "" {
+		return url
+	}
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+	ctx, cancel := context.WithTimeout(context.Background(), startTimeout)
+	defer cancel()
+	c, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        RedisImage,
+			ExposedPorts: []string{"6379/tcp"},
+			WaitingFor:   wait.ForLog("Ready to accept connections"),
+		},
+		Started: true,
+	})
+	testcontainers.CleanupContainer(t, c)
+	if err != nil {
+		t.Fatalf("failed to start redis: %v", err)
+	}
+	host, err := c.Host(ctx)
+	if err != nil {
+		t.Fatalf("failed to find redis: %v", err)
+	}
+	port, err := c.MappedPort(ctx, "6379/tcp")
+	if err != nil {
+		t.Fatalf("failed to find redis: %v", err)
+	}
+	return fmt.Sprintf("redis://%s:%s/0", host, port.Port())
+}
+
+// RedisLocker returns a redislock.Locker on Redis(t), with its keys under
+// a prefix of their own so tests sharing a server do not collide.
+func RedisLocker(t *testing.T) *redislock.Locker {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	l, err := redislock.Open(ctx, Redis(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	token, err := flow.LockToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Prefix = redislock.DefaultPrefix + "test-" + token + ":"
+	return l
+}
+
+// SQLiteHistory returns a sqlitestore.HistoryStore in a new database,
+// closed when t ends.
+func SQLiteHistory(t testing.TB) *sqlitestore.HistoryStore {
+	t.Helper()
+	s, err := sqlitestore.OpenHistoryStore(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// SQLiteAudit returns a sqlitestore.AuditSink in a new database, closed
+// when t ends.
+func SQLiteAudit(t testing.TB) *sqlitestore.AuditSink {
+	t.Helper()
+	s, err := sqlitestore.OpenAuditSink(filepath.Join(t.TempDir(), "audit.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// Correlator returns a RunCorrelator for client backed as the dispatcher
+// is in production: history and audit in SQLite, idempotency locks in
+// Redis, and dead letters and approvals in files, all of them the test's
+// own. Without Docker, t is skipped.
+func Correlator(t *testing.T, client *flow.GitHubClient) *flow.RunCorrelator {
+	t.Helper()
+	dir := t.TempDir()
+	c := flow.NewRunCorrelator(client, SQLiteHistory(t))
+	c.Audit = SQLiteAudit(t)
+	c.Locker = RedisLocker(t)
+	c.DeadLetters = flow.NewFileDeadLetterStore(filepath.Join(dir, "dead-letters.json"))
+	c.Approvals = flow.NewFileApprovalStore(filepath.Join(dir, "approvals.json"))
+	return c
+}
@@ -0,0 +1,74 @@
+package integrationtest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/integrationtest"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+func TestRedisFromEnv(t *testing.T) {
+	t.Setenv("NODEPROP_TEST_REDIS_URL", "redis://ci-redis:6379/3")
+	if got := integrationtest.Redis(t); got != "redis://ci-redis:6379/3" {
+		t.Errorf("Redis() = %q, want the URL from the environment", got)
+	}
+}
+
+func TestSQLiteBackends(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	// Each call gets a database of its own.
+	first, second := integrationtest.SQLiteHistory(t), integrationtest.SQLiteHistory(t)
+	if err := first.Append(flow.DispatchRecord{ID: "a", Repo: "Cdaprod/site", DispatchedAt: at}); err != nil {
+		t.Fatal(err)
+	}
+	if recs, err := first.List("Cdaprod/site"); err != nil || len(recs) != 1 {
+		t.Errorf("List() = %+v, %v; want the appended record", recs, err)
+	}
+	if recs, err := second.List("Cdaprod/site"); err != nil || len(recs) != 0 {
+		t.Errorf("List() of another database = %+v, %v; want none", recs, err)
+	}
+
+	audit := integrationtest.SQLiteAudit(t)
+	e := flow.AuditEntry{Time: at, Actor: "key:ci", Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "main", Result: flow.AuditDispatched, DispatchID: "a"}
+	if err := audit.Record(context.Background(), e); err != nil {
+		t.Errorf("Record() error = %v", err)
+	}
+}
+
+// TestCorrelatorEndToEnd dispatches through the production backends. It
+// needs Docker, or NODEPROP_TEST_REDIS_URL.
+func TestCorrelatorEndToEnd(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts a Redis container")
+	}
+	gh := nodeproptest.NewServer()
+	defer gh.Close()
+	gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+	c := integrationtest.Correlator(t, gh.Client())
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		req     flow.DispatchRequest
+		wantErr error
+	}{
+		{name: "dispatched", req: flow.DispatchRequest{Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "main", IdempotencyKey: "release-1"}},
+		{name: "same key", req: flow.DispatchRequest{Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "main", IdempotencyKey: "release-1"}, wantErr: flow.ErrAlreadyDispatched},
+		{name: "other key", req: flow.DispatchRequest{Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "main", IdempotencyKey: "release-2"}},
+	}
+	for _, tt := range tests {
+		if _, err := c.Submit(ctx, tt.req); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: Submit() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+	if n := len(gh.Dispatches()); n != 2 {
+		t.Errorf("%d dispatches, want 2", n)
+	}
+	if recs, err := c.History.List("Cdaprod/site"); err != nil || len(recs) != 2 {
+		t.Errorf("history = %+v, %v; want 2 records", recs, err)
+	}
+}
@@ -0,0 +1,173 @@
+package flow
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrLockHeld is returned by Locker.Acquire when another holder has the lock.
+var ErrLockHeld = errors.New("lock is held by another holder")
+
+// ErrLockLost is returned by Lock.Refresh when the lock expired and may now
+// belong to someone else.
+var ErrLockLost = errors.New("lock was lost")
+
+// Locker hands out named, expiring locks. Replicas of the dispatcher share
+// one so that only one of them dispatches a given trigger.
+type Locker interface {
+	// Acquire takes name for ttl without waiting, or returns ErrLockHeld.
+	Acquire(ctx context.Context, name string, ttl time.Duration) (Lock, error)
+}
+
+// Lock is a held lock. It expires unless refreshed.
+type Lock interface {
+	// Refresh extends the lock by the ttl it was acquired with.
+	Refresh(ctx context.Context) error
+	Release(ctx context.Context) error
+}
+
+// LocalLocker is a Locker for a single process.
+type LocalLocker struct {
+	// Clock, if set, replaces the system clock for lock expiry.
+	Clock Clock
+
+	mu    sync.Mutex
+	locks map[string]localLock
+}
+
+type localLock struct {
+	token   string
+	expires time.Time
+}
+
+// NewLocalLocker creates a LocalLocker.
+func NewLocalLocker() *LocalLocker {
+	return &LocalLocker{locks: make(map[string]localLock)}
+}
+
+// Acquire takes name for ttl.
+func (l *LocalLocker) Acquire(ctx context.Context, name string, ttl time.Duration) (Lock, error) {
+	token, err := LockToken()
+	if err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := ClockOr(l.Clock).Now()
+	if cur, ok := l.locks[name]; ok && now.Before(cur.expires) {
+		return nil, ErrLockHeld
+	}
+	l.locks[name] = localLock{token: token, expires: now.Add(ttl)}
+	return &localHeld{l: l, name: name, token: token, ttl: ttl}, nil
+}
+
+type localHeld struct {
+	l     *LocalLocker
+	name  string
+	token string
+	ttl   time.Duration
+}
+
+func (h *localHeld) Refresh(ctx context.Context) error {
+	h.l.mu.Lock()
+	defer h.l.mu.Unlock()
+	now := ClockOr(h.l.Clock).Now()
+	cur, ok := h.l.locks[h.name]
+	if !ok || cur.token != h.token || now.After(cur.expires) {
+		return ErrLockLost
+	}
+	h.l.locks[h.name] = localLock{token: h.token, expires: now.Add(h.ttl)}
+	return nil
+}
+
+func (h *localHeld) Release(ctx context.Context) error {
+	h.l.mu.Lock()
+	defer h.l.mu.Unlock()
+	if cur, ok := h.l.locks[h.name]; ok && cur.token == h.token {
+		delete(h.l.locks, h.name)
+	}
+	return nil
+}
+
+// LockToken returns a random token identifying one holder of a lock.
+func LockToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// RunAsLeader runs fn while this process holds the lock name, so that only
+// one replica sharing locker runs it at a time. Other replicas keep trying
+// to take over every ttl/3. The lock is refreshed at the same interval;
+// if a refresh fails, fn's context is cancelled and leadership is contested
+// again. Both intervals are measured on the Clock of a LocalLocker, so a
+// fake one paces them too. RunAsLeader returns when ctx is cancelled.
+func RunAsLeader(ctx context.Context, locker Locker, name string, ttl time.Duration, fn func(ctx context.Context), onError func(error)) {
+	report := func(err error) {
+		if onError != nil {
+			onError(err)
+		}
+	}
+	clock, interval := lockerClock(locker), ttl/3
+	for {
+		lock, err := locker.Acquire(ctx, name, ttl)
+		if err == nil {
+			lead(ctx, clock, lock, interval, fn, report)
+		} else if !errors.Is(err, ErrLockHeld) {
+			report(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-clock.After(interval):
+		}
+	}
+}
+
+// lockerClock returns the Clock locker expires locks by: a LocalLocker's,
+// or SystemClock for lockers whose locks expire elsewhere.
+func lockerClock(locker Locker) Clock {
+	if l, ok := locker.(*LocalLocker); ok {
+		return ClockOr(l.Clock)
+	}
+	return SystemClock
+}
+
+// lead runs fn until ctx is done or the lock is lost, then releases it.
+func lead(ctx context.Context, clock Clock, lock Lock, interval time.Duration, fn func(ctx context.Context), report func(error)) {
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(runCtx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+		// Release with a fresh context: ctx may already be cancelled.
+		rctx, rcancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer rcancel()
+		if err := lock.Release(rctx); err != nil {
+			report(err)
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-done:
+			return
+		case <-clock.After(interval):
+			if err := lock.Refresh(ctx); err != nil {
+				report(err)
+				return
+			}
+		}
+	}
+}
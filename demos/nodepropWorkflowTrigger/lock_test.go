@@ -0,0 +1,178 @@
+package flow_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+func TestLocalLocker(t *testing.T) {
+	clock := nodeproptest.NewClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	l := flow.NewLocalLocker()
+	l.Clock = clock
+	ctx := context.Background()
+
+	a, err := l.Acquire(ctx, "deploy", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Acquire(ctx, "deploy", time.Minute); !errors.Is(err, flow.ErrLockHeld) {
+		t.Errorf("second Acquire() error = %v, want ErrLockHeld", err)
+	}
+	other, err := l.Acquire(ctx, "release", time.Minute)
+	if err != nil {
+		t.Errorf("Acquire() of another name error = %v", err)
+	}
+	other.Release(ctx)
+
+	clock.Advance(50 * time.Second)
+	if err := a.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	clock.Advance(50 * time.Second)
+	if _, err := l.Acquire(ctx, "deploy", time.Minute); !errors.Is(err, flow.ErrLockHeld) {
+		t.Errorf("Acquire() of a refreshed lock error = %v, want ErrLockHeld", err)
+	}
+
+	clock.Advance(time.Minute)
+	b, err := l.Acquire(ctx, "deploy", time.Minute)
+	if err != nil {
+		t.Fatalf("Acquire() of an expired lock error = %v", err)
+	}
+	if err := a.Refresh(ctx); !errors.Is(err, flow.ErrLockLost) {
+		t.Errorf("Refresh() of a lost lock error = %v, want ErrLockLost", err)
+	}
+	// Releasing a lost lock leaves the new holder's alone.
+	a.Release(ctx)
+	if _, err := l.Acquire(ctx, "deploy", time.Minute); !errors.Is(err, flow.ErrLockHeld) {
+		t.Errorf("Acquire() after a stale Release() error = %v, want ErrLockHeld", err)
+	}
+	b.Release(ctx)
+	if _, err := l.Acquire(ctx, "deploy", time.Minute); err != nil {
+		t.Errorf("Acquire() after Release() error = %v", err)
+	}
+}
+
+func TestRunAsLeader(t *testing.T) {
+	l := flow.NewLocalLocker()
+	var (
+		mu      sync.Mutex
+		leading int
+		most    int
+		leaders = map[string]bool{}
+	)
+	started := make(chan string, 8)
+	replica := func(ctx context.Context, name string) {
+		flow.RunAsLeader(ctx, l, "scheduler", 30*time.Millisecond, func(ctx context.Context) {
+			mu.Lock()
+			leading++
+			if leading > most {
+				most = leading
+			}
+			leaders[name] = true
+			mu.Unlock()
+			started <- name
+			<-ctx.Done()
+			mu.Lock()
+			leading--
+			mu.Unlock()
+		}, func(err error) { t.Errorf("%s: %v", name, err) })
+	}
+
+	ctxA, stopA := context.WithCancel(context.Background())
+	ctxB, stopB := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for name, ctx := range map[string]context.Context{"a": ctxA, "b": ctxB} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			replica(ctx, name)
+		}()
+	}
+	first := waitLeader(t, started)
+	time.Sleep(100 * time.Millisecond)
+	if first == "a" {
+		stopA()
+	} else {
+		stopB()
+	}
+	if second := waitLeader(t, started); second == first {
+		t.Errorf("%s led again after stopping", first)
+	}
+	stopA()
+	stopB()
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if most != 1 || len(leaders) != 2 {
+		t.Errorf("%d replicas led at once and %d led in all, want 1 and 2", most, len(leaders))
+	}
+}
+
+func TestRunAsLeaderClock(t *testing.T) {
+	clock := nodeproptest.NewClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	l := flow.NewLocalLocker()
+	l.Clock = clock
+	const ttl = 30 * time.Second
+	started := make(chan string, 2)
+	replica := func(ctx context.Context, name string) {
+		flow.RunAsLeader(ctx, l, "scheduler", ttl, func(ctx context.Context) {
+			started <- name
+			<-ctx.Done()
+		}, func(err error) { t.Errorf("%s: %v", name, err) })
+	}
+
+	ctxA, stopA := context.WithCancel(context.Background())
+	ctxB, stopB := context.WithCancel(context.Background())
+	defer stopB()
+	doneA, doneB := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(doneA)
+		replica(ctxA, "a")
+	}()
+	if name := waitLeader(t, started); name != "a" {
+		t.Fatalf("%s led first, want a", name)
+	}
+	go func() {
+		defer close(doneB)
+		replica(ctxB, "b")
+	}()
+	// Two TTLs pass on the fake clock: a keeps the lock by refreshing it,
+	// and b keeps trying to take over.
+	for range 6 {
+		clock.BlockUntil(2)
+		clock.Advance(ttl / 3)
+	}
+	clock.BlockUntil(2)
+	select {
+	case name := <-started:
+		t.Fatalf("%s led while a held the lock", name)
+	default:
+	}
+
+	stopA()
+	<-doneA
+	clock.Advance(ttl / 3)
+	if name := waitLeader(t, started); name != "b" {
+		t.Errorf("%s led after a stopped, want b", name)
+	}
+	stopB()
+	<-doneB
+}
+
+func waitLeader(t *testing.T, started <-chan string) string {
+	t.Helper()
+	select {
+	case name := <-started:
+		return name
+	case <-time.After(5 * time.Second):
+		t.Fatal("no replica became leader")
+		return ""
+	}
+}
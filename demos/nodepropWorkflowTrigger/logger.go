@@ -0,0 +1,23 @@
+package flow
+
+import "log/slog"
+
+// Logger receives the library's log records: a message and alternating
+// key-value fields such as repo, workflow, attempt, and status.
+// *slog.Logger satisfies it.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// LoggerOr returns l, or slog.Default() if l is nil. The default is looked
+// up on every call so slog.SetDefault takes effect everywhere. Packages
+// that take an optional Logger as the library does use it too.
+func LoggerOr(l Logger) Logger {
+	if l == nil {
+		return slog.Default()
+	}
+	return l
+}
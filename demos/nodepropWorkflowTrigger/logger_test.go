@@ -0,0 +1,151 @@
+package flow_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+// logRecorder captures log records as decoded JSON.
+type logRecorder struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (r *logRecorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.buf.Write(p)
+}
+
+// logger returns a logger recording every level into r.
+func (r *logRecorder) logger() *slog.Logger {
+	return slog.New(slog.NewJSONHandler(r, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+// records returns "LEVEL msg" for each record, and the records.
+func (r *logRecorder) records(t *testing.T) ([]string, []map[string]interface{}) {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var lines []string
+	var recs []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(r.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var rec map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("log record %q: %v", line, err)
+		}
+		lines = append(lines, rec["level"].(string)+" "+rec["msg"].(string))
+		recs = append(recs, rec)
+	}
+	return lines, recs
+}
+
+func TestTriggerManagerLogs(t *testing.T) {
+	tests := []struct {
+		name    string
+		action  bool
+		trigger string
+		err     error
+		want    []string
+	}{
+		{name: "workflow", trigger: "deploy", want: []string{"DEBUG executing workflow"}},
+		{name: "workflow fails", trigger: "deploy", err: errors.New("boom"), want: []string{"DEBUG executing workflow", "ERROR workflow failed"}},
+		{name: "unregistered workflow", trigger: "missing", want: []string{"WARN workflow not registered"}},
+		{name: "action", action: true, trigger: "deploy", want: []string{"DEBUG executing action"}},
+		{name: "action fails", action: true, trigger: "deploy", err: errors.New("boom"), want: []string{"DEBUG executing action", "ERROR action failed"}},
+		{name: "unregistered action", action: true, trigger: "missing", want: []string{"WARN action not registered"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs logRecorder
+			tm := flow.NewTriggerManager()
+			tm.Logger = logs.logger()
+			tm.RegisterWorkflow("deploy", &nodeproptest.MockTrigger{Err: tt.err})
+			tm.RegisterAction("deploy", &nodeproptest.MockTrigger{Err: tt.err})
+
+			if tt.action {
+				tm.ExecuteAction(tt.trigger, "Cdaprod/site", "token", nil)
+			} else {
+				tm.ExecuteWorkflow(tt.trigger, "Cdaprod/site", "token", nil)
+			}
+			got, recs := logs.records(t)
+			if strings.Join(got, "; ") != strings.Join(tt.want, "; ") {
+				t.Fatalf("logged %q, want %q", got, tt.want)
+			}
+			for _, rec := range recs {
+				if rec["repo"] != "Cdaprod/site" {
+					t.Errorf("record %v, want the repo", rec)
+				}
+			}
+		})
+	}
+}
+
+func TestLoggerDefaultsToSlog(t *testing.T) {
+	var logs logRecorder
+	old := slog.Default()
+	slog.SetDefault(logs.logger())
+	defer slog.SetDefault(old)
+
+	flow.NewTriggerManager().ExecuteWorkflow("missing", "Cdaprod/site", "token", nil)
+	if got, _ := logs.records(t); len(got) != 1 || got[0] != "WARN workflow not registered" {
+		t.Errorf("slog.Default() got %q", got)
+	}
+}
+
+func TestCorrelatorLogs(t *testing.T) {
+	tests := []struct {
+		name  string
+		fault *nodeproptest.Fault
+		want  []string
+		// attempt and status are those of the last record.
+		attempt float64
+		status  float64
+	}{
+		{name: "dispatched", want: []string{"INFO dispatched"}, attempt: 1},
+		{name: "retried", fault: &nodeproptest.Fault{Status: 502, Times: 1}, want: []string{"WARN retrying dispatch", "INFO dispatched"}, attempt: 2},
+		{name: "failed", fault: &nodeproptest.Fault{Status: 404}, want: []string{"ERROR dispatch failed"}, attempt: 1, status: 404},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := nodeproptest.NewServer()
+			defer gh.Close()
+			gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+			if tt.fault != nil {
+				f := *tt.fault
+				f.Path = "/repos/*/*/actions/workflows/*/dispatches"
+				gh.Inject(f)
+			}
+			var logs logRecorder
+			c := newCorrelator(t, gh)
+			c.Logger = logs.logger()
+			c.Retry = flow.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+
+			c.Submit(context.Background(), flow.DispatchRequest{Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "main"})
+			got, recs := logs.records(t)
+			if strings.Join(got, "; ") != strings.Join(tt.want, "; ") {
+				t.Fatalf("logged %q, want %q", got, tt.want)
+			}
+			last := recs[len(recs)-1]
+			if last["repo"] != "Cdaprod/site" || last["workflow"] != "deploy.yml" || last["attempt"] != tt.attempt {
+				t.Errorf("last record = %v, want attempt %v", last, tt.attempt)
+			}
+			if status, _ := last["status"].(float64); status != tt.status {
+				t.Errorf("last record status = %v, want %v", last["status"], tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package flow
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BatchTarget is a single dispatch listed in a batch manifest. Instead of a
+// repo, a target may name a registry Selector; it then expands to every
+// matching repository, using their registered workflows unless Workflow is set.
+type BatchTarget struct {
+	Repo     string            `yaml:"repo,omitempty" json:"repo,omitempty"`
+	Selector string            `yaml:"selector,omitempty" json:"selector,omitempty"`
+	Workflow string            `yaml:"workflow,omitempty" json:"workflow,omitempty"`
+	Ref      string            `yaml:"ref,omitempty" json:"ref,omitempty"`
+	Inputs   map[string]string `yaml:"inputs,omitempty" json:"inputs,omitempty"`
+}
+
+// BatchManifest lists dispatches to run together. Defaults fill in any
+// workflow, ref, or inputs a target leaves unset.
+//
+//	defaults:
+//	  workflow: nodeprop-action.yml
+//	  ref: main
+//	targets:
+//	  - repo: Cdaprod/api
+//	  - repo: Cdaprod/web
+//	    inputs:
+//	      env: staging
+//	  - selector: tag:infra
+type BatchManifest struct {
+	Defaults BatchTarget   `yaml:"defaults,omitempty"`
+	Targets  []BatchTarget `yaml:"targets"`
+}
+
+// LoadBatchManifest reads and validates a manifest file.
+func LoadBatchManifest(path string) (*BatchManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var m BatchManifest
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", path, err)
+	}
+	if err := m.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", path, err)
+	}
+	return &m, nil
+}
+
+// Validate checks that every resolved target names a repo and workflow. Repos
+// may be bare names for callers that qualify them with a default org.
+func (m *BatchManifest) Validate() error {
+	if len(m.Targets) == 0 {
+		return fmt.Errorf("no targets")
+	}
+	for i, t := range m.Resolved() {
+		if (t.Repo == "") == (t.Selector == "") {
+			return fmt.Errorf("target %d: exactly one of repo or selector is required", i)
+		}
+		if t.Selector != "" {
+			continue
+		}
+		if owner, name, ok := strings.Cut(t.Repo, "/"); ok && (owner == "" || name == "") {
+			return fmt.Errorf("target %d: repo %q must be owner/name", i, t.Repo)
+		}
+		if t.Workflow == "" {
+			return fmt.Errorf("target %d (%s): workflow is required", i, t.Repo)
+		}
+	}
+	return nil
+}
+
+// Resolved returns the targets with defaults applied.
+func (m *BatchManifest) Resolved() []BatchTarget {
+	out := make([]BatchTarget, len(m.Targets))
+	for i, t := range m.Targets {
+		if t.Workflow == "" {
+			t.Workflow = m.Defaults.Workflow
+		}
+		if t.Ref == "" {
+			t.Ref = m.Defaults.Ref
+		}
+		if t.Ref == "" {
+			t.Ref = "main"
+		}
+		inputs := make(map[string]string, len(m.Defaults.Inputs)+len(t.Inputs))
+		for k, v := range m.Defaults.Inputs {
+			inputs[k] = v
+		}
+		for k, v := range t.Inputs {
+			inputs[k] = v
+		}
+		t.Inputs = inputs
+		out[i] = t
+	}
+	return out
+}
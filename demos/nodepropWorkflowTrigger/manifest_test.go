@@ -0,0 +1,83 @@
+package flow
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBatchManifestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		m       BatchManifest
+		wantErr string
+	}{
+		{name: "defaults fill workflow", m: BatchManifest{Defaults: BatchTarget{Workflow: "ci.yml"}, Targets: []BatchTarget{{Repo: "o/r"}}}},
+		{name: "bare repo", m: BatchManifest{Targets: []BatchTarget{{Repo: "api", Workflow: "ci.yml"}}}},
+		{name: "selector needs no workflow", m: BatchManifest{Targets: []BatchTarget{{Selector: "tag:infra"}}}},
+		{name: "no targets", wantErr: "no targets"},
+		{name: "neither repo nor selector", m: BatchManifest{Targets: []BatchTarget{{Workflow: "ci.yml"}}}, wantErr: "exactly one of repo or selector"},
+		{name: "both repo and selector", m: BatchManifest{Targets: []BatchTarget{{Repo: "o/r", Selector: "tag:x", Workflow: "ci.yml"}}}, wantErr: "exactly one of repo or selector"},
+		{name: "missing owner", m: BatchManifest{Targets: []BatchTarget{{Repo: "/r", Workflow: "ci.yml"}}}, wantErr: "must be owner/name"},
+		{name: "missing name", m: BatchManifest{Targets: []BatchTarget{{Repo: "o/", Workflow: "ci.yml"}}}, wantErr: "must be owner/name"},
+		{name: "missing workflow", m: BatchManifest{Targets: []BatchTarget{{Repo: "o/r"}}}, wantErr: "workflow is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.m.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadBatchManifest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "batch.yml")
+	manifest := `defaults:
+  workflow: nodeprop-action.yml
+  inputs:
+    env: prod
+    debug: "false"
+targets:
+  - repo: Cdaprod/api
+  - repo: Cdaprod/web
+    ref: release
+    inputs:
+      env: staging
+`
+	if err := os.WriteFile(path, []byte(manifest), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := LoadBatchManifest(path)
+	if err != nil {
+		t.Fatalf("LoadBatchManifest() error = %v", err)
+	}
+	got := m.Resolved()
+	if len(got) != 2 {
+		t.Fatalf("Resolved() = %+v, want 2 targets", got)
+	}
+	if api := got[0]; api.Workflow != "nodeprop-action.yml" || api.Ref != "main" || api.Inputs["env"] != "prod" {
+		t.Errorf("Resolved()[0] = %+v, want the defaults", api)
+	}
+	if web := got[1]; web.Ref != "release" || web.Inputs["env"] != "staging" || web.Inputs["debug"] != "false" {
+		t.Errorf("Resolved()[1] = %+v, want its own ref and inputs over the defaults", web)
+	}
+	if m.Targets[1].Inputs["debug"] != "" {
+		t.Errorf("Resolved() modified the manifest's targets")
+	}
+
+	if err := os.WriteFile(path, []byte("targets: []\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadBatchManifest(path); err == nil || !strings.Contains(err.Error(), "no targets") {
+		t.Errorf("LoadBatchManifest() of an empty manifest error = %v", err)
+	}
+}
@@ -0,0 +1,248 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metadata cache lifetimes, unless a MetadataCache sets its own.
+const (
+	DefaultMetadataTTL = 5 * time.Minute
+	// DefaultNotFoundTTL is shorter, so a repository or workflow being
+	// created is seen soon.
+	DefaultNotFoundTTL = time.Minute
+)
+
+// MetadataCache caches the repository metadata pre-flight checks read:
+// whether a repository exists, its default branch, and its workflows.
+// Validating a batch of dispatches to a few repositories then costs a
+// request or two per repository and TTL, not several per dispatch.
+// Concurrent lookups of the same repository share one request. Not-found
+// answers are cached for NotFoundTTL; other errors are not cached.
+type MetadataCache struct {
+	Client *GitHubClient
+	// TTL overrides DefaultMetadataTTL and NotFoundTTL overrides
+	// DefaultNotFoundTTL.
+	TTL         time.Duration
+	NotFoundTTL time.Duration
+	// Clock, if set, replaces the system clock for expiry.
+	Clock Clock
+
+	mu      sync.Mutex
+	entries map[metadataKey]*metadataEntry
+}
+
+// NewMetadataCache creates a MetadataCache reading through client.
+func NewMetadataCache(client *GitHubClient) *MetadataCache {
+	return &MetadataCache{Client: client}
+}
+
+type metadataKey struct {
+	kind string
+	repo string
+}
+
+// metadataEntry is a cached lookup, or one in flight until ready is
+// closed.
+type metadataEntry struct {
+	ready   chan struct{}
+	value   interface{}
+	err     error
+	expires time.Time
+}
+
+// Repository returns repo as GetRepository does.
+func (m *MetadataCache) Repository(ctx context.Context, repo string) (*Repository, error) {
+	v, err := m.lookup(ctx, metadataKey{"repo", repo}, func(ctx context.Context) (interface{}, error) {
+		return m.Client.GetRepository(ctx, repo)
+	})
+	if err != nil {
+		return nil, err
+	}
+	r := *v.(*Repository)
+	return &r, nil
+}
+
+// Prefetch reads the repositories of repos that are not cached in batched
+// queries, as GetRepositories does, so that looking each up afterwards
+// costs no request. Repositories it finds missing are cached as not
+// found.
+func (m *MetadataCache) Prefetch(ctx context.Context, repos []string) error {
+	clock := ClockOr(m.Clock)
+	m.mu.Lock()
+	var missing []string
+	seen := map[string]bool{}
+	for _, repo := range repos {
+		e := m.entries[metadataKey{"repo", repo}]
+		if seen[repo] || e != nil && (!isReady(e) || clock.Now().Before(e.expires)) {
+			continue
+		}
+		seen[repo] = true
+		missing = append(missing, repo)
+	}
+	m.mu.Unlock()
+	if len(missing) == 0 {
+		return nil
+	}
+
+	found, err := m.Client.GetRepositories(ctx, missing)
+	if err != nil {
+		return err
+	}
+	now := clock.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.entries == nil {
+		m.entries = map[metadataKey]*metadataEntry{}
+	}
+	for _, repo := range missing {
+		key := metadataKey{"repo", repo}
+		if e := m.entries[key]; e != nil && !isReady(e) {
+			// A lookup started meanwhile; let it finish.
+			continue
+		}
+		e := &metadataEntry{ready: make(chan struct{})}
+		if r, ok := found[repo]; ok {
+			e.value, e.expires = r, now.Add(durationOr(m.TTL, DefaultMetadataTTL))
+		} else {
+			e.err = &APIError{Method: "GET", Path: "/repos/" + repo, StatusCode: 404, Body: "repository not found"}
+			e.expires = now.Add(durationOr(m.NotFoundTTL, DefaultNotFoundTTL))
+		}
+		close(e.ready)
+		m.entries[key] = e
+	}
+	return nil
+}
+
+// RepoExists reports whether repo exists and the token can see it.
+func (m *MetadataCache) RepoExists(ctx context.Context, repo string) (bool, error) {
+	_, err := m.Repository(ctx, repo)
+	if IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// DefaultBranch returns the default branch of repo.
+func (m *MetadataCache) DefaultBranch(ctx context.Context, repo string) (string, error) {
+	r, err := m.Repository(ctx, repo)
+	if err != nil {
+		return "", err
+	}
+	return r.DefaultBranch, nil
+}
+
+// Workflows returns the workflows of repo as ListWorkflows does.
+func (m *MetadataCache) Workflows(ctx context.Context, repo string) ([]Workflow, error) {
+	v, err := m.lookup(ctx, metadataKey{"workflows", repo}, func(ctx context.Context) (interface{}, error) {
+		return m.Client.ListWorkflows(ctx, repo)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append([]Workflow(nil), v.([]Workflow)...), nil
+}
+
+// Workflow returns the workflow of repo a dispatch names, by file name,
+// path, or ID, as GetWorkflow does: a workflow that is not there is an
+// *APIError for which IsNotFound is true.
+func (m *MetadataCache) Workflow(ctx context.Context, repo, workflowFile string) (*Workflow, error) {
+	wfs, err := m.Workflows(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	for _, wf := range wfs {
+		if wf.Path == workflowFile || path.Base(wf.Path) == workflowFile || strconv.FormatInt(wf.ID, 10) == workflowFile {
+			return &wf, nil
+		}
+	}
+	return nil, &APIError{Method: "GET", Path: fmt.Sprintf("/repos/%s/actions/workflows/%s", repo, workflowFile), StatusCode: 404, Body: "workflow not found"}
+}
+
+// Invalidate drops what is cached about repo, e.g. after a push that
+// changed its workflows.
+func (m *MetadataCache) Invalidate(repo string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k := range m.entries {
+		if strings.EqualFold(k.repo, repo) {
+			delete(m.entries, k)
+		}
+	}
+}
+
+// Purge drops everything cached.
+func (m *MetadataCache) Purge() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = nil
+}
+
+// lookup returns the cached value of key, calling fetch if there is none
+// or it expired. Callers asking while fetch runs wait for its result.
+func (m *MetadataCache) lookup(ctx context.Context, key metadataKey, fetch func(context.Context) (interface{}, error)) (interface{}, error) {
+	clock := ClockOr(m.Clock)
+	m.mu.Lock()
+	if e := m.entries[key]; e != nil {
+		select {
+		case <-e.ready:
+			if clock.Now().Before(e.expires) {
+				m.mu.Unlock()
+				return e.value, e.err
+			}
+		default:
+			m.mu.Unlock()
+			select {
+			case <-e.ready:
+				return e.value, e.err
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+	e := &metadataEntry{ready: make(chan struct{})}
+	if m.entries == nil {
+		m.entries = map[metadataKey]*metadataEntry{}
+	}
+	m.entries[key] = e
+	m.mu.Unlock()
+
+	e.value, e.err = fetch(ctx)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case e.err == nil:
+		e.expires = clock.Now().Add(durationOr(m.TTL, DefaultMetadataTTL))
+	case IsNotFound(e.err):
+		e.expires = clock.Now().Add(durationOr(m.NotFoundTTL, DefaultNotFoundTTL))
+	default:
+		if m.entries[key] == e {
+			delete(m.entries, key)
+		}
+	}
+	close(e.ready)
+	return e.value, e.err
+}
+
+// isReady reports whether e's lookup finished.
+func isReady(e *metadataEntry) bool {
+	select {
+	case <-e.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// durationOr returns d, or def if d is not positive.
+func durationOr(d, def time.Duration) time.Duration {
+	if d <= 0 {
+		return def
+	}
+	return d
+}
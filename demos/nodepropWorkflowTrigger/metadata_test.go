@@ -0,0 +1,237 @@
+package flow_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+// countRequests returns how many requests gh received for path.
+func countRequests(gh *nodeproptest.Server, path string) int {
+	n := 0
+	for _, r := range gh.Requests() {
+		if r.Path == path {
+			n++
+		}
+	}
+	return n
+}
+
+func TestMetadataCache(t *testing.T) {
+	const repoPath = "/repos/Cdaprod/site"
+	tests := []struct {
+		name  string
+		steps func(t *testing.T, m *flow.MetadataCache, gh *nodeproptest.Server, clock *nodeproptest.Clock)
+		path  string
+		want  int
+	}{
+		{name: "cached", path: repoPath, want: 1, steps: func(t *testing.T, m *flow.MetadataCache, gh *nodeproptest.Server, clock *nodeproptest.Clock) {
+			for range 3 {
+				if branch, err := m.DefaultBranch(context.Background(), "Cdaprod/site"); err != nil || branch != "main" {
+					t.Errorf("DefaultBranch() = %q, %v", branch, err)
+				}
+			}
+			clock.Advance(4 * time.Minute)
+			m.RepoExists(context.Background(), "Cdaprod/site")
+		}},
+		{name: "expired", path: repoPath, want: 2, steps: func(t *testing.T, m *flow.MetadataCache, gh *nodeproptest.Server, clock *nodeproptest.Clock) {
+			m.Repository(context.Background(), "Cdaprod/site")
+			clock.Advance(flow.DefaultMetadataTTL)
+			m.Repository(context.Background(), "Cdaprod/site")
+		}},
+		{name: "own ttl", path: repoPath, want: 2, steps: func(t *testing.T, m *flow.MetadataCache, gh *nodeproptest.Server, clock *nodeproptest.Clock) {
+			m.TTL = time.Second
+			m.Repository(context.Background(), "Cdaprod/site")
+			clock.Advance(time.Second)
+			m.Repository(context.Background(), "Cdaprod/site")
+		}},
+		{name: "not found cached briefly", path: "/repos/Cdaprod/new", want: 2, steps: func(t *testing.T, m *flow.MetadataCache, gh *nodeproptest.Server, clock *nodeproptest.Clock) {
+			for range 2 {
+				if ok, err := m.RepoExists(context.Background(), "Cdaprod/new"); ok || err != nil {
+					t.Errorf("RepoExists() = %v, %v; want false", ok, err)
+				}
+			}
+			gh.AddWorkflow("Cdaprod/new", "ci.yml")
+			clock.Advance(flow.DefaultNotFoundTTL)
+			if ok, err := m.RepoExists(context.Background(), "Cdaprod/new"); !ok || err != nil {
+				t.Errorf("RepoExists() once created = %v, %v; want true", ok, err)
+			}
+		}},
+		{name: "errors not cached", path: repoPath, want: 2, steps: func(t *testing.T, m *flow.MetadataCache, gh *nodeproptest.Server, clock *nodeproptest.Clock) {
+			gh.Inject(nodeproptest.Fault{Status: http.StatusBadGateway, Times: 1})
+			if _, err := m.Repository(context.Background(), "Cdaprod/site"); err == nil {
+				t.Error("Repository() hid the 502")
+			}
+			if _, err := m.Repository(context.Background(), "Cdaprod/site"); err != nil {
+				t.Errorf("Repository() after the 502 error = %v", err)
+			}
+		}},
+		{name: "invalidated", path: "/repos/Cdaprod/site/actions/workflows", want: 2, steps: func(t *testing.T, m *flow.MetadataCache, gh *nodeproptest.Server, clock *nodeproptest.Clock) {
+			m.Workflows(context.Background(), "Cdaprod/site")
+			m.Invalidate("cdaprod/SITE")
+			m.Workflows(context.Background(), "Cdaprod/site")
+			m.Invalidate("Cdaprod/other")
+			m.Workflows(context.Background(), "Cdaprod/site")
+		}},
+		{name: "purged", path: repoPath, want: 2, steps: func(t *testing.T, m *flow.MetadataCache, gh *nodeproptest.Server, clock *nodeproptest.Clock) {
+			m.Repository(context.Background(), "Cdaprod/site")
+			m.Purge()
+			m.Repository(context.Background(), "Cdaprod/site")
+		}},
+		{name: "prefetched", path: repoPath, want: 1, steps: func(t *testing.T, m *flow.MetadataCache, gh *nodeproptest.Server, clock *nodeproptest.Clock) {
+			if err := m.Prefetch(context.Background(), []string{"Cdaprod/site", "Cdaprod/site", "Cdaprod/gone"}); err != nil {
+				t.Fatal(err)
+			}
+			m.Prefetch(context.Background(), []string{"Cdaprod/site"})
+			if ok, err := m.RepoExists(context.Background(), "Cdaprod/gone"); ok || err != nil {
+				t.Errorf("RepoExists() of a prefetched missing repository = %v, %v", ok, err)
+			}
+			if n := countRequests(gh, "/repos/Cdaprod/gone"); n != 1 {
+				t.Errorf("%d requests for the missing repository, want 1", n)
+			}
+			m.Repository(context.Background(), "Cdaprod/site")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := nodeproptest.NewServer()
+			defer gh.Close()
+			gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+			clock := nodeproptest.NewClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+			m := flow.NewMetadataCache(gh.Client())
+			m.Clock = clock
+			tt.steps(t, m, gh, clock)
+			if n := countRequests(gh, tt.path); n != tt.want {
+				t.Errorf("%d requests for %s, want %d", n, tt.path, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetadataCacheWorkflow(t *testing.T) {
+	gh := nodeproptest.NewServer()
+	defer gh.Close()
+	gh.AddWorkflow("Cdaprod/site", "deploy.yml", "ci.yml")
+	m := flow.NewMetadataCache(gh.Client())
+	ctx := context.Background()
+	deploy, err := m.Workflow(ctx, "Cdaprod/site", "deploy.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		workflow string
+		wantID   int64
+	}{
+		{name: "file", workflow: "deploy.yml", wantID: deploy.ID},
+		{name: "path", workflow: ".github/workflows/deploy.yml", wantID: deploy.ID},
+		{name: "id", workflow: fmt.Sprint(deploy.ID), wantID: deploy.ID},
+		{name: "missing", workflow: "release.yml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wf, err := m.Workflow(ctx, "Cdaprod/site", tt.workflow)
+			if tt.wantID == 0 {
+				if !flow.IsNotFound(err) {
+					t.Errorf("Workflow() error = %v, want not found", err)
+				}
+				return
+			}
+			if err != nil || wf.ID != tt.wantID {
+				t.Errorf("Workflow() = %+v, %v; want ID %d", wf, err, tt.wantID)
+			}
+		})
+	}
+	if n := countRequests(gh, "/repos/Cdaprod/site/actions/workflows"); n != 1 {
+		t.Errorf("%d workflow list requests, want 1", n)
+	}
+}
+
+func TestMetadataCacheSharesLookups(t *testing.T) {
+	gh := nodeproptest.NewServer()
+	defer gh.Close()
+	gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+	gh.Inject(nodeproptest.Fault{Latency: 50 * time.Millisecond, Times: 1})
+	m := flow.NewMetadataCache(gh.Client())
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			if _, err := m.Repository(context.Background(), "Cdaprod/site"); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	wg.Wait()
+	if n := countRequests(gh, "/repos/Cdaprod/site"); n != 1 {
+		t.Errorf("%d requests for 10 concurrent lookups, want 1", n)
+	}
+
+	// A waiter gives up with its context; the lookup goes on for others.
+	gh.Inject(nodeproptest.Fault{Latency: time.Second, Times: 1})
+	m.Purge()
+	go m.Repository(context.Background(), "Cdaprod/site")
+	time.Sleep(10 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := m.Repository(ctx, "Cdaprod/site"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Repository() with an expired context error = %v", err)
+	}
+}
+
+func TestCorrelatorMetadataPreflight(t *testing.T) {
+	// The workflows of a repository: deploy.yml is active, and
+	// old.yml disabled.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/Cdaprod/site":
+			fmt.Fprint(w, `{"full_name": "Cdaprod/site", "default_branch": "trunk"}`)
+		case "/repos/Cdaprod/site/actions/workflows":
+			fmt.Fprint(w, `{"workflows": [{"id": 1, "path": ".github/workflows/deploy.yml", "state": "active"}, {"id": 2, "path": ".github/workflows/old.yml", "state": "disabled_manually"}]}`)
+		case "/repos/Cdaprod/site/actions/workflows/deploy.yml/dispatches":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	tests := []struct {
+		name    string
+		req     flow.DispatchRequest
+		wantRef string
+		wantErr string
+	}{
+		{name: "default branch", req: flow.DispatchRequest{Repo: "Cdaprod/site", Workflow: "deploy.yml"}, wantRef: "trunk"},
+		{name: "ref kept", req: flow.DispatchRequest{Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "release"}, wantRef: "release"},
+		{name: "disabled", req: flow.DispatchRequest{Repo: "Cdaprod/site", Workflow: "old.yml"}, wantErr: "workflow old.yml of Cdaprod/site is disabled_manually"},
+		{name: "missing", req: flow.DispatchRequest{Repo: "Cdaprod/site", Workflow: "new.yml"}, wantErr: "failed to look up workflow new.yml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := flow.NewGitHubClient("token")
+			client.BaseURL = srv.URL
+			c := flow.NewRunCorrelator(client, flow.NewFileHistoryStore(filepath.Join(t.TempDir(), "history.json")))
+			c.Logger = discardLogger
+			c.Metadata = flow.NewMetadataCache(client)
+			rec, err := c.Submit(context.Background(), tt.req)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Submit() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || rec.Ref != tt.wantRef {
+				t.Errorf("Submit() = %+v, %v; want ref %s", rec, err, tt.wantRef)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package flow
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics are the library's Prometheus collectors. Set the same Metrics on
+// a RunCorrelator and its GitHubClient.
+type Metrics struct {
+	attempts *prometheus.CounterVec
+	failures *prometheus.CounterVec
+	duration prometheus.Histogram
+	retries  prometheus.Counter
+	paused   prometheus.Gauge
+}
+
+// NewMetrics creates the dispatch metrics and registers them with reg.
+// Metrics created again with the same reg share the registered collectors,
+// so several correlators may report to one registry.
+func NewMetrics(reg prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		attempts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nodeprop_dispatch_attempts_total",
+			Help: "Dispatch requests sent to GitHub, by outcome: ok or the error class.",
+		}, []string{"outcome"}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nodeprop_dispatch_failures_total",
+			Help: "Dispatches that failed after every attempt, by the class of the last error.",
+		}, []string{"class"}),
+		duration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "nodeprop_dispatch_attempt_duration_seconds",
+			Help:    "Time taken by each dispatch request to GitHub.",
+			Buckets: prometheus.DefBuckets,
+		}),
+		retries: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "nodeprop_dispatch_retries_total",
+			Help: "Dispatch attempts made after a transient failure.",
+		}),
+		paused: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "nodeprop_github_rate_limit_paused",
+			Help: "Requests waiting for the GitHub rate limit to reset because the remaining quota reached the floor.",
+		}),
+	}
+	var err error
+	register := func(c prometheus.Collector) prometheus.Collector {
+		if err != nil {
+			return c
+		}
+		var are prometheus.AlreadyRegisteredError
+		rerr := reg.Register(c)
+		switch {
+		case rerr == nil:
+			return c
+		case errors.As(rerr, &are):
+			return are.ExistingCollector
+		}
+		err = rerr
+		return c
+	}
+	m.attempts = register(m.attempts).(*prometheus.CounterVec)
+	m.failures = register(m.failures).(*prometheus.CounterVec)
+	m.duration = register(m.duration).(prometheus.Histogram)
+	m.retries = register(m.retries).(prometheus.Counter)
+	m.paused = register(m.paused).(prometheus.Gauge)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// attempt records one dispatch request to GitHub. A nil Metrics records
+// nothing.
+func (m *Metrics) attempt(d time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.duration.Observe(d.Seconds())
+	outcome := "ok"
+	if err != nil {
+		outcome = ErrorClass(err)
+	}
+	m.attempts.WithLabelValues(outcome).Inc()
+}
+
+func (m *Metrics) retry() {
+	if m != nil {
+		m.retries.Inc()
+	}
+}
+
+func (m *Metrics) failed(err error) {
+	if m != nil {
+		m.failures.WithLabelValues(ErrorClass(err)).Inc()
+	}
+}
+
+// pause counts a request waiting on the rate limit until the returned
+// function is called.
+func (m *Metrics) pause() func() {
+	if m == nil {
+		return func() {}
+	}
+	m.paused.Inc()
+	return m.paused.Dec
+}
@@ -0,0 +1,179 @@
+package flow_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+// metricValue returns the value of the series of name with the given label
+// name and value pairs, or -1 if there is none. Histograms report their
+// sample count.
+func metricValue(t *testing.T, reg *prometheus.Registry, name string, labels ...string) float64 {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range families {
+		if mf.GetName() != name {
+			continue
+		}
+	series:
+		for _, m := range mf.GetMetric() {
+			for i := 0; i < len(labels); i += 2 {
+				var found bool
+				for _, lp := range m.GetLabel() {
+					found = found || (lp.GetName() == labels[i] && lp.GetValue() == labels[i+1])
+				}
+				if !found {
+					continue series
+				}
+			}
+			switch {
+			case m.GetHistogram() != nil:
+				return float64(m.GetHistogram().GetSampleCount())
+			case m.GetGauge() != nil:
+				return m.GetGauge().GetValue()
+			}
+			return m.GetCounter().GetValue()
+		}
+	}
+	return -1
+}
+
+func TestDispatchMetrics(t *testing.T) {
+	tests := []struct {
+		name  string
+		fault *nodeproptest.Fault
+		// attempts counts attempts by outcome; failures the failed
+		// dispatches by class.
+		attempts map[string]float64
+		retries  float64
+		failures map[string]float64
+	}{
+		{name: "dispatched", attempts: map[string]float64{"ok": 1}},
+		{name: "retried", fault: &nodeproptest.Fault{Status: 502, Times: 2}, attempts: map[string]float64{"ok": 1, flow.ErrorServer: 2}, retries: 2},
+		{name: "out of attempts", fault: &nodeproptest.Fault{Status: 502}, attempts: map[string]float64{flow.ErrorServer: 3}, retries: 2, failures: map[string]float64{flow.ErrorServer: 1}},
+		{name: "not found", fault: &nodeproptest.Fault{Status: 404}, attempts: map[string]float64{flow.ErrorNotFound: 1}, failures: map[string]float64{flow.ErrorNotFound: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := nodeproptest.NewServer()
+			defer gh.Close()
+			gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+			if tt.fault != nil {
+				f := *tt.fault
+				f.Path = "/repos/*/*/actions/workflows/*/dispatches"
+				gh.Inject(f)
+			}
+			reg := prometheus.NewRegistry()
+			m, err := flow.NewMetrics(reg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := newCorrelator(t, gh)
+			c.Metrics, c.Client.Metrics = m, m
+			c.Retry = flow.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+
+			c.Submit(context.Background(), flow.DispatchRequest{Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "main"})
+			var total float64
+			for outcome, want := range tt.attempts {
+				total += want
+				if got := metricValue(t, reg, "nodeprop_dispatch_attempts_total", "outcome", outcome); got != want {
+					t.Errorf("attempts{outcome=%q} = %v, want %v", outcome, got, want)
+				}
+			}
+			if got := metricValue(t, reg, "nodeprop_dispatch_attempt_duration_seconds"); got != total {
+				t.Errorf("attempt durations observed = %v, want %v", got, total)
+			}
+			if got := metricValue(t, reg, "nodeprop_dispatch_retries_total"); got != tt.retries {
+				t.Errorf("retries = %v, want %v", got, tt.retries)
+			}
+			for class, want := range tt.failures {
+				if got := metricValue(t, reg, "nodeprop_dispatch_failures_total", "class", class); got != want {
+					t.Errorf("failures{class=%q} = %v, want %v", class, got, want)
+				}
+			}
+			if tt.failures == nil && metricValue(t, reg, "nodeprop_dispatch_failures_total") != -1 {
+				t.Error("a failure was counted")
+			}
+		})
+	}
+}
+
+func TestNewMetricsSharesRegistry(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	first, err := flow.NewMetrics(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := flow.NewMetrics(reg)
+	if err != nil {
+		t.Fatalf("NewMetrics() again on the same registry error = %v", err)
+	}
+	if first == second {
+		t.Fatal("NewMetrics() returned the same Metrics")
+	}
+
+	gh := nodeproptest.NewServer()
+	defer gh.Close()
+	gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+	for _, m := range []*flow.Metrics{first, second} {
+		c := newCorrelator(t, gh)
+		c.Metrics = m
+		c.Submit(context.Background(), flow.DispatchRequest{Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "main"})
+	}
+	if got := metricValue(t, reg, "nodeprop_dispatch_attempts_total", "outcome", "ok"); got != 2 {
+		t.Errorf("attempts{outcome=ok} = %v, want both correlators' dispatches", got)
+	}
+
+	clash := prometheus.NewRegistry()
+	clash.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "nodeprop_dispatch_retries_total", Help: "not a counter"}))
+	if _, err := flow.NewMetrics(clash); err == nil {
+		t.Error("NewMetrics() over a clashing collector succeeded")
+	}
+}
+
+func TestRateLimitPauseMetric(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	clock := nodeproptest.NewClock(start)
+	gh := nodeproptest.NewServer()
+	defer gh.Close()
+	gh.Clock = clock
+	gh.RateLimit = 2
+	reg := prometheus.NewRegistry()
+	m, err := flow.NewMetrics(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := gh.Client()
+	client.Clock, client.Metrics, client.RateLimitFloor = clock, m, 1
+
+	ctx := context.Background()
+	// The first response leaves one request, which is the floor.
+	if _, err := client.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.Ping(ctx)
+		done <- err
+	}()
+	clock.BlockUntil(1)
+	if got := metricValue(t, reg, "nodeprop_github_rate_limit_paused"); got != 1 {
+		t.Errorf("paused = %v while waiting, want 1", got)
+	}
+	clock.Advance(time.Hour + time.Second)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if got := metricValue(t, reg, "nodeprop_github_rate_limit_paused"); got != 0 {
+		t.Errorf("paused = %v after the reset, want 0", got)
+	}
+}
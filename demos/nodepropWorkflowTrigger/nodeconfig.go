@@ -0,0 +1,135 @@
+package flow
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultConfigFile is the file the NodeProp action generates in a repository.
+const DefaultConfigFile = ".nodeprop.yml"
+
+// ParseNodeConfig decodes a generated .nodeprop.yml or a spec file.
+func ParseNodeConfig(data []byte) (map[string]interface{}, error) {
+	cfg := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	return cfg, nil
+}
+
+// LoadNodeConfig reads a generated .nodeprop.yml or a spec file.
+func LoadNodeConfig(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := ParseNodeConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// MergeSpec returns base with spec merged in the way the action applies a
+// spec file: nested maps merge recursively, any other value replaces the
+// base value. Neither argument is modified.
+func MergeSpec(base, spec map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(base))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range spec {
+		bm, ok1 := out[k].(map[string]interface{})
+		sm, ok2 := v.(map[string]interface{})
+		if ok1 && ok2 {
+			out[k] = MergeSpec(bm, sm)
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// Kinds of ConfigChange.
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// ConfigChange is one difference between two configs. Path joins nested keys
+// with dots; lists are compared as a whole.
+type ConfigChange struct {
+	Path string      `json:"path" yaml:"path"`
+	Kind string      `json:"kind" yaml:"kind"`
+	Old  interface{} `json:"old,omitempty" yaml:"old,omitempty"`
+	New  interface{} `json:"new,omitempty" yaml:"new,omitempty"`
+}
+
+// DiffConfig lists the changes that turn old into new, sorted by path.
+func DiffConfig(old, new map[string]interface{}) []ConfigChange {
+	var changes []ConfigChange
+	diffConfig("", old, new, &changes)
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+func diffConfig(prefix string, old, new map[string]interface{}, changes *[]ConfigChange) {
+	keys := make(map[string]bool, len(old)+len(new))
+	for k := range old {
+		keys[k] = true
+	}
+	for k := range new {
+		keys[k] = true
+	}
+	for k := range keys {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		ov, inOld := old[k]
+		nv, inNew := new[k]
+		switch {
+		case !inOld:
+			*changes = append(*changes, ConfigChange{Path: path, Kind: ChangeAdded, New: nv})
+		case !inNew:
+			*changes = append(*changes, ConfigChange{Path: path, Kind: ChangeRemoved, Old: ov})
+		default:
+			om, ok1 := ov.(map[string]interface{})
+			nm, ok2 := nv.(map[string]interface{})
+			if ok1 && ok2 {
+				diffConfig(path, om, nm, changes)
+			} else if !reflect.DeepEqual(ov, nv) {
+				*changes = append(*changes, ConfigChange{Path: path, Kind: ChangeChanged, Old: ov, New: nv})
+			}
+		}
+	}
+}
+
+// FormatConfigValue renders a config value on one line for display.
+func FormatConfigValue(v interface{}) string {
+	var n yaml.Node
+	if err := n.Encode(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	setFlowStyle(&n)
+	b, err := yaml.Marshal(&n)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func setFlowStyle(n *yaml.Node) {
+	if n.Kind == yaml.MappingNode || n.Kind == yaml.SequenceNode {
+		n.Style = yaml.FlowStyle
+	}
+	for _, c := range n.Content {
+		setFlowStyle(c)
+	}
+}
@@ -0,0 +1,105 @@
+package flow
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeSpec(t *testing.T) {
+	base, err := ParseNodeConfig([]byte(`
+name: api
+deploy:
+  env: staging
+  replicas: 2
+tags: [a, b]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec, err := ParseNodeConfig([]byte(`
+deploy:
+  env: prod
+  region: us-east-1
+tags: [c]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := MergeSpec(base, spec)
+	want := map[string]interface{}{
+		"name":   "api",
+		"deploy": map[string]interface{}{"env": "prod", "replicas": 2, "region": "us-east-1"},
+		"tags":   []interface{}{"c"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MergeSpec() = %v, want %v", got, want)
+	}
+	if base["deploy"].(map[string]interface{})["env"] != "staging" {
+		t.Error("MergeSpec() modified base")
+	}
+	if _, err := ParseNodeConfig([]byte("deploy: [")); err == nil {
+		t.Error("ParseNodeConfig() of invalid YAML succeeded")
+	}
+}
+
+func TestDiffConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new map[string]interface{}
+		want     []ConfigChange
+	}{
+		{name: "equal", old: map[string]interface{}{"a": 1}, new: map[string]interface{}{"a": 1}},
+		{
+			name: "added removed changed",
+			old:  map[string]interface{}{"a": 1, "b": "x"},
+			new:  map[string]interface{}{"b": "y", "c": true},
+			want: []ConfigChange{
+				{Path: "a", Kind: ChangeRemoved, Old: 1},
+				{Path: "b", Kind: ChangeChanged, Old: "x", New: "y"},
+				{Path: "c", Kind: ChangeAdded, New: true},
+			},
+		},
+		{
+			name: "nested",
+			old:  map[string]interface{}{"deploy": map[string]interface{}{"env": "staging", "replicas": 2}},
+			new:  map[string]interface{}{"deploy": map[string]interface{}{"env": "prod", "replicas": 2}},
+			want: []ConfigChange{{Path: "deploy.env", Kind: ChangeChanged, Old: "staging", New: "prod"}},
+		},
+		{
+			name: "lists compared whole",
+			old:  map[string]interface{}{"tags": []interface{}{"a", "b"}},
+			new:  map[string]interface{}{"tags": []interface{}{"b", "a"}},
+			want: []ConfigChange{{Path: "tags", Kind: ChangeChanged, Old: []interface{}{"a", "b"}, New: []interface{}{"b", "a"}}},
+		},
+		{
+			name: "map replaced by a scalar",
+			old:  map[string]interface{}{"deploy": map[string]interface{}{"env": "prod"}},
+			new:  map[string]interface{}{"deploy": "off"},
+			want: []ConfigChange{{Path: "deploy", Kind: ChangeChanged, Old: map[string]interface{}{"env": "prod"}, New: "off"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DiffConfig(tt.old, tt.new); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffConfig() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatConfigValue(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		want string
+	}{
+		{v: "prod", want: "prod"},
+		{v: 3, want: "3"},
+		{v: []interface{}{"a", "b"}, want: "[a, b]"},
+		{v: map[string]interface{}{"env": "prod", "tags": []interface{}{"x"}}, want: "{env: prod, tags: [x]}"},
+	}
+	for _, tt := range tests {
+		if got := FormatConfigValue(tt.v); got != tt.want {
+			t.Errorf("FormatConfigValue(%v) = %q, want %q", tt.v, got, tt.want)
+		}
+	}
+}
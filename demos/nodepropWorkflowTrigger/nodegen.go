@@ -0,0 +1,223 @@
+package flow
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultDomainBase is the domain the networking identifiers of a generated
+// config are under.
+const DefaultDomainBase = "cdaprod.dev"
+
+// capabilityFiles maps files and directories of a checkout to the
+// capability their presence gives a repository.
+var capabilityFiles = map[string]string{
+	"Dockerfile":          "containerized",
+	"docker-compose.yml":  "docker-compose",
+	"docker-compose.yaml": "docker-compose",
+	".github/workflows":   "pipeline",
+	"deploy.yaml":         "deployable",
+	"deploy.yml":          "deployable",
+}
+
+// configKeyOrder is the order of the top-level keys of a written config;
+// keys a spec adds follow, sorted.
+var configKeyOrder = []string{"id", "name", "address", "capabilities", "status", "metadata"}
+
+// NodeConfigGenerator generates the .nodeprop.yml of a repository as the
+// NodeProp action does: its GitHub metadata, the capabilities its checkout
+// shows, and its networking identifiers, with an optional spec file merged
+// in by MergeSpec.
+type NodeConfigGenerator struct {
+	// Client fetches the repository's metadata. If nil, the metadata is
+	// left at its defaults, as it is without a token.
+	Client *GitHubClient
+	// Repo is the repository as owner/name, SHA the commit the image is
+	// tagged with, and Actor the config's owner.
+	Repo  string
+	SHA   string
+	Actor string
+	// Dir is the checkout capabilities are detected in; "" means the
+	// working directory.
+	Dir string
+	// DomainBase defaults to DefaultDomainBase.
+	DomainBase string
+	Clock      Clock
+	Logger     Logger
+}
+
+// Generate returns the config of the repository, without its id.
+func (g *NodeConfigGenerator) Generate(ctx context.Context) (map[string]interface{}, error) {
+	owner, name, ok := strings.Cut(g.Repo, "/")
+	if !ok {
+		owner, name = "unknown", "unknown"
+	}
+	now := ClockOr(g.Clock).Now().UTC().Format(time.RFC3339)
+	github := map[string]interface{}{
+		"stars":          0,
+		"forks":          0,
+		"issues":         0,
+		"latest_commit":  now,
+		"license":        "No License",
+		"topics":         []string{},
+		"default_branch": "main",
+	}
+	if g.Client == nil {
+		LoggerOr(g.Logger).Warn("no GitHub token; repository metadata left at defaults", "repo", g.Repo)
+	} else {
+		r, err := g.Client.GetRepository(ctx, g.Repo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch metadata of %s: %w", g.Repo, err)
+		}
+		github["stars"], github["forks"], github["issues"] = r.Stars, r.Forks, r.OpenIssues
+		if !r.PushedAt.IsZero() {
+			github["latest_commit"] = r.PushedAt.UTC().Format(time.RFC3339)
+		}
+		if r.License != nil && r.License.SPDXID != "" {
+			github["license"] = r.License.SPDXID
+		}
+		if r.Topics != nil {
+			github["topics"] = r.Topics
+		}
+		if r.DefaultBranch != "" {
+			github["default_branch"] = r.DefaultBranch
+		}
+	}
+
+	domainBase := g.DomainBase
+	if domainBase == "" {
+		domainBase = DefaultDomainBase
+	}
+	namespace := owner + "-network"
+	domain := name + "." + domainBase
+	sha := g.SHA
+	if len(sha) > 7 {
+		sha = sha[:7]
+	}
+	return map[string]interface{}{
+		"name":         g.Repo,
+		"address":      "https://github.com/" + g.Repo,
+		"capabilities": g.capabilities(),
+		"status":       "active",
+		"metadata": map[string]interface{}{
+			"description":  fmt.Sprintf("Auto-generated configuration for '%s' in %s domain.", g.Repo, owner),
+			"owner":        g.Actor,
+			"last_updated": now,
+			"github":       github,
+			"custom_properties": map[string]interface{}{
+				"deploy_environment": nil,
+				"monitoring_enabled": nil,
+				"auto_scale":         nil,
+				"service":            nil,
+				"app":                name,
+				"image":              g.Repo + ":" + sha,
+				"domain":             domain,
+				"network":            namespace,
+				"networking": map[string]interface{}{
+					"namespace":    namespace,
+					"domain":       domain,
+					"service_dns":  name + "." + namespace + ".svc",
+					"cluster_dns":  name + "." + namespace + ".svc.cluster.local",
+					"service_name": name,
+				},
+			},
+		},
+	}, nil
+}
+
+// capabilities returns the capabilities the checkout shows, sorted.
+func (g *NodeConfigGenerator) capabilities() []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for file, c := range capabilityFiles {
+		if _, err := os.Stat(filepath.Join(g.Dir, file)); err == nil && !seen[c] {
+			seen[c] = true
+			out = append(out, c)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// NodeConfigHash returns the content address of cfg, less any id and
+// metadata.last_updated, so that generating an unchanged config again keeps
+// its id: the SHA-256 of a "config <size>\0" header and cfg as YAML with
+// sorted keys, as git hashes a blob.
+func NodeConfigHash(cfg map[string]interface{}) (string, error) {
+	body := make(map[string]interface{}, len(cfg))
+	for k, v := range cfg {
+		if k != "id" {
+			body[k] = v
+		}
+	}
+	if meta, ok := body["metadata"].(map[string]interface{}); ok {
+		if _, ok := meta["last_updated"]; ok {
+			m := make(map[string]interface{}, len(meta))
+			for k, v := range meta {
+				if k != "last_updated" {
+					m[k] = v
+				}
+			}
+			body["metadata"] = m
+		}
+	}
+	data, err := encodeNodeConfig(body)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "config %d\x00", len(data))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// MarshalNodeConfig returns cfg as the YAML of a .nodeprop.yml: id first,
+// then the generated keys, then any others a spec added.
+func MarshalNodeConfig(cfg map[string]interface{}) ([]byte, error) {
+	var n yaml.Node
+	if err := n.Encode(cfg); err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	rank := func(key string) int {
+		for i, k := range configKeyOrder {
+			if k == key {
+				return i
+			}
+		}
+		return len(configKeyOrder)
+	}
+	pairs := make([][2]*yaml.Node, 0, len(n.Content)/2)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		pairs = append(pairs, [2]*yaml.Node{n.Content[i], n.Content[i+1]})
+	}
+	// The encoder sorted the keys, so a stable sort keeps the rest sorted.
+	sort.SliceStable(pairs, func(i, j int) bool { return rank(pairs[i][0].Value) < rank(pairs[j][0].Value) })
+	n.Content = n.Content[:0]
+	for _, p := range pairs {
+		n.Content = append(n.Content, p[0], p[1])
+	}
+	return encodeNodeConfig(&n)
+}
+
+func encodeNodeConfig(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	return buf.Bytes(), nil
+}
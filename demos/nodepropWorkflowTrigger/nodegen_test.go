@@ -0,0 +1,207 @@
+package flow_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+func TestNodeConfigGenerator(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/Cdaprod/site" {
+			http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(flow.Repository{
+			FullName: "Cdaprod/site", DefaultBranch: "trunk", Stars: 12, Forks: 3, OpenIssues: 4,
+			License: &flow.RepositoryLicense{SPDXID: "MIT"}, Topics: []string{"web"},
+			PushedAt: time.Date(2024, 2, 29, 8, 0, 0, 0, time.FixedZone("CET", 3600)),
+		})
+	}))
+	defer srv.Close()
+	client := flow.NewGitHubClient("token")
+	client.BaseURL = srv.URL
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		g    flow.NodeConfigGenerator
+		// files are created in the checkout.
+		files   []string
+		want    map[string]interface{}
+		wantErr string
+	}{
+		{
+			name: "no client",
+			g:    flow.NodeConfigGenerator{Repo: "Cdaprod/site", SHA: "0123456789abcdef", Actor: "alice"},
+			want: map[string]interface{}{
+				"stars": 0, "forks": 0, "issues": 0, "latest_commit": "2024-03-01T12:00:00Z",
+				"license": "No License", "topics": []string{}, "default_branch": "main",
+			},
+		},
+		{
+			name:  "metadata",
+			g:     flow.NodeConfigGenerator{Client: client, Repo: "Cdaprod/site", SHA: "0123456789abcdef", Actor: "alice"},
+			files: []string{"Dockerfile", "deploy.yml", "docker-compose.yaml", ".github/workflows/ci.yml"},
+			want: map[string]interface{}{
+				"stars": 12, "forks": 3, "issues": 4, "latest_commit": "2024-02-29T07:00:00Z",
+				"license": "MIT", "topics": []string{"web"}, "default_branch": "trunk",
+			},
+		},
+		{
+			name:    "metadata fails",
+			g:       flow.NodeConfigGenerator{Client: client, Repo: "Cdaprod/missing"},
+			wantErr: "failed to fetch metadata of Cdaprod/missing",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, f := range tt.files {
+				path := filepath.Join(dir, f)
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, nil, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			g := tt.g
+			g.Dir, g.Clock, g.Logger = dir, nodeproptest.NewClock(now), discardLogger
+			cfg, err := g.Generate(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Generate() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			meta := cfg["metadata"].(map[string]interface{})
+			if got := meta["github"]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("github metadata = %v, want %v", got, tt.want)
+			}
+			wantCaps := []string{}
+			if len(tt.files) > 0 {
+				wantCaps = []string{"containerized", "deployable", "docker-compose", "pipeline"}
+			}
+			if got := cfg["capabilities"]; !reflect.DeepEqual(got, wantCaps) {
+				t.Errorf("capabilities = %v, want %v", got, wantCaps)
+			}
+			custom := meta["custom_properties"].(map[string]interface{})
+			networking := custom["networking"].(map[string]interface{})
+			if custom["image"] != "Cdaprod/site:0123456" || custom["domain"] != "site.cdaprod.dev" || networking["cluster_dns"] != "site.Cdaprod-network.svc.cluster.local" {
+				t.Errorf("custom properties = %v", custom)
+			}
+			if meta["owner"] != "alice" || meta["last_updated"] != "2024-03-01T12:00:00Z" {
+				t.Errorf("metadata = %v", meta)
+			}
+		})
+	}
+
+	// Generated again a day later, an unchanged config keeps its id.
+	var hashes []string
+	for _, at := range []time.Time{now, now.Add(24 * time.Hour)} {
+		g := flow.NodeConfigGenerator{Client: client, Repo: "Cdaprod/site", SHA: "0123456789abcdef", Dir: t.TempDir(), Clock: nodeproptest.NewClock(at), Logger: discardLogger}
+		cfg, err := g.Generate(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		hash, err := flow.NodeConfigHash(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, hash)
+	}
+	if hashes[0] != hashes[1] {
+		t.Errorf("hash of a config generated again = %s, first %s", hashes[1], hashes[0])
+	}
+
+	g := flow.NodeConfigGenerator{Repo: "bare", DomainBase: "example.com", Clock: nodeproptest.NewClock(now), Logger: discardLogger}
+	cfg, err := g.Generate(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	custom := cfg["metadata"].(map[string]interface{})["custom_properties"].(map[string]interface{})
+	if custom["domain"] != "unknown.example.com" || custom["network"] != "unknown-network" {
+		t.Errorf("custom properties of a repo without an owner = %v", custom)
+	}
+}
+
+func TestNodeConfigHash(t *testing.T) {
+	cfg := map[string]interface{}{"name": "Cdaprod/site", "status": "active", "metadata": map[string]interface{}{"owner": "alice", "app": "site"}}
+	hash, err := flow.NodeConfigHash(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hash) != 64 {
+		t.Errorf("NodeConfigHash() = %q, want a SHA-256", hash)
+	}
+	tests := []struct {
+		name string
+		cfg  map[string]interface{}
+		same bool
+	}{
+		{name: "id is left out", cfg: map[string]interface{}{"id": hash, "name": "Cdaprod/site", "status": "active", "metadata": map[string]interface{}{"app": "site", "owner": "alice"}}, same: true},
+		{name: "last_updated is left out", cfg: map[string]interface{}{"name": "Cdaprod/site", "status": "active", "metadata": map[string]interface{}{"owner": "alice", "app": "site", "last_updated": "2024-03-01T12:00:00Z"}}, same: true},
+		{name: "value changed", cfg: map[string]interface{}{"name": "Cdaprod/site", "status": "retired", "metadata": map[string]interface{}{"owner": "alice", "app": "site"}}},
+		{name: "nested value changed", cfg: map[string]interface{}{"name": "Cdaprod/site", "status": "active", "metadata": map[string]interface{}{"owner": "bob", "app": "site"}}},
+	}
+	for _, tt := range tests {
+		got, err := flow.NodeConfigHash(tt.cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (got == hash) != tt.same {
+			t.Errorf("%s: NodeConfigHash() = %s, first %s", tt.name, got, hash)
+		}
+	}
+	if _, ok := cfg["id"]; ok {
+		t.Error("NodeConfigHash() modified cfg")
+	}
+}
+
+func TestMarshalNodeConfig(t *testing.T) {
+	cfg := map[string]interface{}{
+		"zone":         "us",
+		"status":       "active",
+		"metadata":     map[string]interface{}{"owner": "alice"},
+		"deploy":       map[string]interface{}{"replicas": 2},
+		"name":         "Cdaprod/site",
+		"capabilities": []string{"pipeline"},
+		"address":      "https://github.com/Cdaprod/site",
+		"id":           "abc",
+	}
+	data, err := flow.MarshalNodeConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if key, _, ok := strings.Cut(line, ":"); ok && !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "-") {
+			keys = append(keys, key)
+		}
+	}
+	want := []string{"id", "name", "address", "capabilities", "status", "metadata", "deploy", "zone"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("MarshalNodeConfig() keys = %v, want %v:\n%s", keys, want, data)
+	}
+	back, err := flow.ParseNodeConfig(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back["zone"] != "us" || back["metadata"].(map[string]interface{})["owner"] != "alice" {
+		t.Errorf("MarshalNodeConfig() does not parse back: %v", back)
+	}
+}
@@ -0,0 +1,241 @@
+package nodeproptest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// Benchmark is one benchmark of the dispatch path. It runs in a test
+// binary with b.Run, or in any program with testing.Benchmark, as nodeprop
+// bench does.
+type Benchmark struct {
+	Name string
+	F    func(b *testing.B)
+}
+
+// Benchmarks cover the hot dispatch path: validating and hashing inputs,
+// dispatching through a GitHubClient, and submitting through a
+// RunCorrelator, alone and in a fan-out of FanOutSize, which also reports
+// dispatches per second. They also cover looking up registered triggers
+// and repositories of a RegistrySize registry, and merging and diffing the
+// generated config. Requests go to an in-memory transport that answers
+// 204, so they measure nodeprop's own work and allocations rather than the
+// network's. In a test file:
+//
+//	func BenchmarkNodeprop(b *testing.B) { nodeproptest.RunBenchmarks(b) }
+var Benchmarks = []Benchmark{
+	{"ValidateInputs", benchValidateInputs},
+	{"ParamsHash", benchParamsHash},
+	{"DispatchWorkflow", benchDispatchWorkflow},
+	{"Submit", benchSubmit},
+	{"FanOut", benchFanOut},
+	{"TriggerLookup", benchTriggerLookup},
+	{"RegistryGet", benchRegistryGet},
+	{"RegistrySelect", benchRegistrySelect},
+	{"MergeSpec", benchMergeSpec},
+	{"DiffConfig", benchDiffConfig},
+}
+
+// Sizes of the FanOut and registry benchmarks.
+const (
+	FanOutSize   = 100
+	RegistrySize = 1000
+)
+
+// RunBenchmarks runs every benchmark of Benchmarks as a sub-benchmark of b.
+func RunBenchmarks(b *testing.B) {
+	for _, bm := range Benchmarks {
+		b.Run(bm.Name, bm.F)
+	}
+}
+
+// benchInputs are the inputs of every benchmark dispatch, about the size
+// of a typical deploy.
+var benchInputs = map[string]string{
+	"environment": "production",
+	"version":     "v1.42.0",
+	"commit":      "9f2c1e7d5b3a48e6c0d1f2a3b4c5d6e7f8091a2b",
+	"service":     "nodeprop-api",
+	"region":      "us-east-1",
+	"dry_run":     "false",
+	"reason":      "Scheduled release of the weekly train, approved in #deploys",
+	"config":      `{"replicas": 3, "canary": true, "timeout": "10m"}`,
+}
+
+func benchValidateInputs(b *testing.B) {
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := flow.ValidateInputs(benchInputs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchParamsHash(b *testing.B) {
+	b.ReportAllocs()
+	for b.Loop() {
+		flow.ParamsHash("main", benchInputs)
+	}
+}
+
+func benchDispatchWorkflow(b *testing.B) {
+	c := benchClient()
+	ctx := context.Background()
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := c.DispatchWorkflow(ctx, "Cdaprod/site", "deploy.yml", "main", benchInputs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchSubmit(b *testing.B) {
+	c := benchCorrelator()
+	ctx := context.Background()
+	req := flow.DispatchRequest{Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "main", Inputs: benchInputs}
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := c.Submit(ctx, req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchFanOut(b *testing.B) {
+	c := benchCorrelator()
+	ctx := context.Background()
+	reqs := make([]flow.DispatchRequest, FanOutSize)
+	for i := range reqs {
+		reqs[i] = flow.DispatchRequest{Repo: fmt.Sprintf("Cdaprod/service-%03d", i), Workflow: "deploy.yml", Ref: "main", Inputs: benchInputs}
+	}
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := c.FanOut(ctx, "bench", "Cdaprod/lib", reqs, 16).Err(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(b.N*FanOutSize)/b.Elapsed().Seconds(), "dispatches/s")
+}
+
+func benchTriggerLookup(b *testing.B) {
+	tm := flow.NewTriggerManager()
+	for i := range RegistrySize {
+		tm.RegisterWorkflow(fmt.Sprintf("deploy-%04d", i), &MockTrigger{})
+	}
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, ok := tm.Workflow("deploy-0500"); !ok {
+			b.Fatal("workflow not registered")
+		}
+	}
+}
+
+func benchRegistryGet(b *testing.B) {
+	reg := benchRegistry()
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, ok := reg.Get("Cdaprod/service-0500"); !ok {
+			b.Fatal("repository not registered")
+		}
+	}
+}
+
+func benchRegistrySelect(b *testing.B) {
+	reg := benchRegistry()
+	b.ReportAllocs()
+	for b.Loop() {
+		repos, err := reg.Select("tag:web,Cdaprod/service-0*")
+		if err != nil || len(repos) == 0 {
+			b.Fatal(len(repos), err)
+		}
+	}
+}
+
+func benchMergeSpec(b *testing.B) {
+	base, spec := benchConfig(0), benchConfig(1)
+	b.ReportAllocs()
+	for b.Loop() {
+		flow.MergeSpec(base, spec)
+	}
+}
+
+func benchDiffConfig(b *testing.B) {
+	base := benchConfig(0)
+	merged := flow.MergeSpec(base, benchConfig(1))
+	b.ReportAllocs()
+	for b.Loop() {
+		if len(flow.DiffConfig(base, merged)) == 0 {
+			b.Fatal("no changes")
+		}
+	}
+}
+
+// benchRegistry returns a registry of RegistrySize repositories, every
+// third tagged web.
+func benchRegistry() *flow.RepositoryRegistry {
+	reg := flow.NewRepositoryRegistry()
+	for i := range RegistrySize {
+		name := fmt.Sprintf("Cdaprod/service-%04d", i)
+		reg.RegisterRepo(name, nil, []string{"deploy.yml", "test.yml"})
+		if i%3 == 0 {
+			reg.SetTags(name, []string{"web"})
+		}
+	}
+	return reg
+}
+
+// benchConfig returns a generated config of a few dozen services; version
+// changes the values a spec would.
+func benchConfig(version int) map[string]interface{} {
+	services := map[string]interface{}{}
+	for i := range 40 {
+		services[fmt.Sprintf("service-%02d", i)] = map[string]interface{}{
+			"image":    fmt.Sprintf("ghcr.io/cdaprod/service-%02d:v1.%d", i, version),
+			"replicas": 2 + version,
+			"env":      map[string]interface{}{"LOG_LEVEL": "info", "REGION": "us-east-1"},
+			"ports":    []interface{}{8080, 9090},
+		}
+	}
+	return map[string]interface{}{"version": version, "services": services, "workflows": []interface{}{"deploy.yml", "test.yml"}}
+}
+
+// benchClient returns a client whose requests all succeed in memory.
+func benchClient() *flow.GitHubClient {
+	c := flow.NewGitHubClient("ghp_benchmark")
+	c.BaseURL = "https://api.github.invalid"
+	c.HTTPClient = &http.Client{Transport: acceptTransport{}}
+	c.Logger = slog.New(slog.DiscardHandler)
+	return c
+}
+
+// benchCorrelator returns a RunCorrelator on benchClient that records
+// nothing.
+func benchCorrelator() *flow.RunCorrelator {
+	c := flow.NewRunCorrelator(benchClient(), discardHistory{})
+	c.Logger = slog.New(slog.DiscardHandler)
+	return c
+}
+
+// acceptTransport reads every request and answers 204.
+type acceptTransport struct{}
+
+func (acceptTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		io.Copy(io.Discard, req.Body)
+		req.Body.Close()
+	}
+	return &http.Response{StatusCode: http.StatusNoContent, Status: "204 No Content", Header: http.Header{}, Body: http.NoBody, Request: req}, nil
+}
+
+// discardHistory is a HistoryStore that keeps nothing.
+type discardHistory struct{}
+
+func (discardHistory) Append(flow.DispatchRecord) error           { return nil }
+func (discardHistory) Update(flow.DispatchRecord) error           { return nil }
+func (discardHistory) List(string) ([]flow.DispatchRecord, error) { return nil, nil }
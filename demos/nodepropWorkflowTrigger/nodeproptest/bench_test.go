@@ -0,0 +1,137 @@
+package nodeproptest_test
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+var baseline = flag.String("baseline", "", "fail TestBenchmarkRegressions for results regressed from this file of nodeprop bench -o json")
+
+func BenchmarkNodeprop(b *testing.B) { nodeproptest.RunBenchmarks(b) }
+
+// TestBenchmarkRegressions runs the benchmarks against a saved baseline:
+//
+//	nodeprop bench -o json > bench.json
+//	go test ./nodeproptest -run BenchmarkRegressions -baseline bench.json
+func TestBenchmarkRegressions(t *testing.T) {
+	if *baseline == "" {
+		t.Skip("no -baseline")
+	}
+	nodeproptest.CheckBenchmarks(t, *baseline, nodeproptest.DefaultThresholds)
+}
+
+func TestBenchmarksRun(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs every benchmark")
+	}
+	for _, bm := range nodeproptest.Benchmarks {
+		r, err := bm.Run()
+		if err != nil {
+			t.Errorf("%s: %v", bm.Name, err)
+			continue
+		}
+		if r.Name != bm.Name || r.N == 0 {
+			t.Errorf("%s: result %+v", bm.Name, r)
+		}
+	}
+}
+
+func TestCompareBenchmarks(t *testing.T) {
+	base := nodeproptest.BenchResult{Name: "Submit", NsPerOp: 1000, BytesPerOp: 2000, AllocsPerOp: 20}
+	tests := []struct {
+		name    string
+		current nodeproptest.BenchResult
+		t       nodeproptest.Thresholds
+		want    []string
+	}{
+		{name: "unchanged", current: base, t: nodeproptest.DefaultThresholds},
+		{name: "faster", current: nodeproptest.BenchResult{Name: "Submit", NsPerOp: 500, BytesPerOp: 1000, AllocsPerOp: 10}, t: nodeproptest.DefaultThresholds},
+		{name: "within thresholds", current: nodeproptest.BenchResult{Name: "Submit", NsPerOp: 1250, BytesPerOp: 2200, AllocsPerOp: 22}, t: nodeproptest.DefaultThresholds},
+		{name: "slower", current: nodeproptest.BenchResult{Name: "Submit", NsPerOp: 1251, BytesPerOp: 2000, AllocsPerOp: 20}, t: nodeproptest.DefaultThresholds, want: []string{"ns/op"}},
+		{name: "more memory", current: nodeproptest.BenchResult{Name: "Submit", NsPerOp: 1000, BytesPerOp: 2201, AllocsPerOp: 23}, t: nodeproptest.DefaultThresholds, want: []string{"B/op", "allocs/op"}},
+		{name: "time check disabled", current: nodeproptest.BenchResult{Name: "Submit", NsPerOp: 5000, BytesPerOp: 2000, AllocsPerOp: 20}, t: nodeproptest.Thresholds{Time: -1, Bytes: 0.1, Allocs: 0.1}},
+		{name: "zero tolerance", current: nodeproptest.BenchResult{Name: "Submit", NsPerOp: 1001, BytesPerOp: 2000, AllocsPerOp: 20}, t: nodeproptest.Thresholds{}, want: []string{"ns/op"}},
+		{name: "not in baseline", current: nodeproptest.BenchResult{Name: "FanOut", NsPerOp: 1e9}, t: nodeproptest.DefaultThresholds},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, r := range nodeproptest.CompareBenchmarks([]nodeproptest.BenchResult{base}, []nodeproptest.BenchResult{tt.current}, tt.t) {
+				got = append(got, r.Metric)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("CompareBenchmarks() regressed %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	zero := nodeproptest.BenchResult{Name: "RegistryGet", NsPerOp: 10}
+	regs := nodeproptest.CompareBenchmarks([]nodeproptest.BenchResult{zero}, []nodeproptest.BenchResult{{Name: "RegistryGet", NsPerOp: 10, AllocsPerOp: 1}}, nodeproptest.DefaultThresholds)
+	if len(regs) != 1 || regs[0].Metric != "allocs/op" {
+		t.Errorf("an allocation where the baseline had none: %v", regs)
+	}
+}
+
+func TestLoadBenchResults(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		data    string
+		want    []nodeproptest.BenchResult
+		wantErr bool
+	}{
+		{
+			name: "saved run",
+			data: `[{"name": "Submit", "n": 100, "ns_per_op": 1000, "bytes_per_op": 2000, "allocs_per_op": 20}, {"name": "FanOut", "n": 1, "ns_per_op": 5, "dispatches_per_second": 1.5}]`,
+			want: []nodeproptest.BenchResult{{Name: "Submit", N: 100, NsPerOp: 1000, BytesPerOp: 2000, AllocsPerOp: 20}, {Name: "FanOut", N: 1, NsPerOp: 5, PerSecond: 1.5}},
+		},
+		{name: "empty", data: `[]`, want: []nodeproptest.BenchResult{}},
+		{name: "not json", data: "BenchmarkSubmit 100 1000 ns/op", wantErr: true},
+		{name: "missing", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".json")
+			if tt.data != "" {
+				if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := nodeproptest.LoadBenchResults(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadBenchResults() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("LoadBenchResults() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegressionString(t *testing.T) {
+	tests := []struct {
+		r    nodeproptest.Regression
+		want string
+	}{
+		{r: nodeproptest.Regression{Name: "Submit", Metric: "ns/op", Baseline: 1000, Current: 1500}, want: "Submit: ns/op went from 1000 to 1500 (+50%)"},
+		{r: nodeproptest.Regression{Name: "RegistryGet", Metric: "allocs/op", Current: 2}, want: "RegistryGet: allocs/op went from 0 to 2"},
+	}
+	for _, tt := range tests {
+		if got := tt.r.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestBenchmarkRunFailure(t *testing.T) {
+	bm := nodeproptest.Benchmark{Name: "Broken", F: func(b *testing.B) { b.Fatal("no server") }}
+	if _, err := bm.Run(); err == nil || !strings.Contains(err.Error(), "Broken") {
+		t.Errorf("Run() of a failing benchmark error = %v, want one naming it", err)
+	}
+}
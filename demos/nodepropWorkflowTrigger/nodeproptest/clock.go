@@ -0,0 +1,127 @@
+package nodeproptest
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is a flow.Clock whose time moves only when a test moves it, so
+// retries, schedules, and expiries happen as soon as the test says:
+//
+//	clock := nodeproptest.NewClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+//	c.Clock = clock
+//	go c.Submit(ctx, req)   // fails once, then waits out its backoff
+//	clock.BlockUntil(1)     // until the retry is waiting
+//	clock.AdvanceToNext()   // and it is sent at once
+//
+// Create it with NewClock.
+type Clock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []waiter
+}
+
+type waiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// NewClock returns a clock stopped at now.
+func NewClock(now time.Time) *Clock {
+	c := &Clock{now: now}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now returns the clock's time.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After returns a channel that receives the time once the clock has been
+// advanced by d. A d of zero or less fires at once.
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, waiter{at: c.now.Add(d), ch: ch})
+	c.cond.Broadcast()
+	return ch
+}
+
+// Advance moves the clock forward by d, firing the waits that fall due in
+// the order they do.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(c.now.Add(d))
+}
+
+// Set moves the clock to t, firing the waits due by then. The clock never
+// goes back.
+func (c *Clock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t.After(c.now) {
+		c.set(t)
+	}
+}
+
+// AdvanceToNext moves the clock to the earliest pending wait, firing it,
+// and returns how far it moved; 0 if nothing is waiting.
+func (c *Clock) AdvanceToNext() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.waiters) == 0 {
+		return 0
+	}
+	next := c.waiters[0].at
+	for _, w := range c.waiters[1:] {
+		if w.at.Before(next) {
+			next = w.at
+		}
+	}
+	d := next.Sub(c.now)
+	c.set(next)
+	return d
+}
+
+// Waiters returns the number of waits pending.
+func (c *Clock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// BlockUntil waits until at least n waits are pending, so a test advances
+// the clock only once the code under test is waiting on it.
+func (c *Clock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
+
+// set moves the clock to t and fires the waits due; c.mu must be held.
+func (c *Clock) set(t time.Time) {
+	c.now = t
+	sort.SliceStable(c.waiters, func(i, j int) bool { return c.waiters[i].at.Before(c.waiters[j].at) })
+	kept := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(t) {
+			kept = append(kept, w)
+			continue
+		}
+		w.ch <- w.at
+	}
+	c.waiters = kept
+}
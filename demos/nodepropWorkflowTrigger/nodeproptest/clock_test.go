@@ -0,0 +1,125 @@
+package nodeproptest_test
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+var _ flow.Clock = (*nodeproptest.Clock)(nil)
+
+func TestClock(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		move      func(*nodeproptest.Clock)
+		wantNow   time.Time
+		wantFired []time.Duration
+		wantLeft  int
+	}{
+		{name: "still", wantNow: start, wantLeft: 3},
+		{name: "advance past one", move: func(c *nodeproptest.Clock) { c.Advance(90 * time.Second) }, wantNow: start.Add(90 * time.Second), wantFired: []time.Duration{time.Minute}, wantLeft: 2},
+		{name: "advance to a deadline", move: func(c *nodeproptest.Clock) { c.Advance(2 * time.Minute) }, wantNow: start.Add(2 * time.Minute), wantFired: []time.Duration{time.Minute, 2 * time.Minute}, wantLeft: 1},
+		{name: "advance past all", move: func(c *nodeproptest.Clock) { c.Advance(time.Hour) }, wantNow: start.Add(time.Hour), wantFired: []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute}},
+		{name: "set", move: func(c *nodeproptest.Clock) { c.Set(start.Add(2 * time.Minute)) }, wantNow: start.Add(2 * time.Minute), wantFired: []time.Duration{time.Minute, 2 * time.Minute}, wantLeft: 1},
+		{name: "set backwards", move: func(c *nodeproptest.Clock) { c.Set(start.Add(-time.Hour)) }, wantNow: start, wantLeft: 3},
+		{name: "advance to next", move: func(c *nodeproptest.Clock) { c.AdvanceToNext() }, wantNow: start.Add(time.Minute), wantFired: []time.Duration{time.Minute}, wantLeft: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := nodeproptest.NewClock(start)
+			// Registered out of order, so firing must sort them.
+			waits := map[time.Duration]<-chan time.Time{}
+			for _, d := range []time.Duration{3 * time.Minute, time.Minute, 2 * time.Minute} {
+				waits[d] = c.After(d)
+			}
+			if tt.move != nil {
+				tt.move(c)
+			}
+			if got := c.Now(); !got.Equal(tt.wantNow) {
+				t.Errorf("Now() = %v, want %v", got, tt.wantNow)
+			}
+			fired := map[time.Duration]bool{}
+			for _, d := range tt.wantFired {
+				fired[d] = true
+				select {
+				case at := <-waits[d]:
+					if !at.Equal(start.Add(d)) {
+						t.Errorf("After(%v) fired with %v, want its deadline", d, at)
+					}
+				default:
+					t.Errorf("After(%v) has not fired", d)
+				}
+			}
+			for d, ch := range waits {
+				if !fired[d] && len(ch) > 0 {
+					t.Errorf("After(%v) fired early", d)
+				}
+			}
+			if n := c.Waiters(); n != tt.wantLeft {
+				t.Errorf("Waiters() = %d, want %d", n, tt.wantLeft)
+			}
+		})
+	}
+}
+
+func TestClockImmediate(t *testing.T) {
+	c := nodeproptest.NewClock(time.Unix(0, 0))
+	for _, d := range []time.Duration{0, -time.Second} {
+		select {
+		case <-c.After(d):
+		default:
+			t.Errorf("After(%v) did not fire at once", d)
+		}
+	}
+	if d := c.AdvanceToNext(); d != 0 || c.Waiters() != 0 {
+		t.Errorf("AdvanceToNext() with nothing waiting = %v", d)
+	}
+}
+
+// TestClockRetries drives the correlator's retry backoff from the clock: a
+// dispatch that fails waits for the clock, not for real time.
+func TestClockRetries(t *testing.T) {
+	gh := nodeproptest.NewServer()
+	defer gh.Close()
+	gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+	gh.Inject(nodeproptest.Fault{Method: "POST", Status: http.StatusBadGateway, Times: 2})
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	clock := nodeproptest.NewClock(start)
+	c := flow.NewRunCorrelator(gh.Client(), flow.NewFileHistoryStore(filepath.Join(t.TempDir(), "history.json")))
+	c.Clock = clock
+	c.Retry = flow.RetryPolicy{MaxAttempts: 5, Backoff: time.Hour, MaxBackoff: 4 * time.Hour}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Submit(context.Background(), flow.DispatchRequest{Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "main"})
+		done <- err
+	}()
+	var waited []time.Duration
+	for range 2 {
+		clock.BlockUntil(1)
+		waited = append(waited, clock.AdvanceToNext())
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Submit() did not return after the clock advanced")
+	}
+	if len(waited) != 2 || waited[0] != time.Hour || waited[1] != 2*time.Hour {
+		t.Errorf("backoffs = %v, want 1h then 2h", waited)
+	}
+	if n := len(gh.Dispatches()); n != 1 {
+		t.Errorf("%d dispatches, want 1", n)
+	}
+	if recs, err := c.History.List("Cdaprod/site"); err != nil || len(recs) != 1 || !recs[0].DispatchedAt.Equal(start) {
+		t.Errorf("history = %+v, %v; want a record at the clock's time", recs, err)
+	}
+}
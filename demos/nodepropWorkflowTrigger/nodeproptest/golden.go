@@ -0,0 +1,302 @@
+package nodeproptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// update is the -update flag of test binaries importing the package.
+var update = flag.Bool("update", false, "rewrite golden files with what the tests generate")
+
+// Ignored replaces the values of ignored paths in normalized documents.
+const Ignored = "<ignored>"
+
+// Golden fails t unless got matches the golden file at path, showing the
+// lines that differ. With go test -update, it writes got to path instead,
+// so a change to what is generated shows up as a reviewable diff of the
+// golden file:
+//
+//	out, err := generate(spec)
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	nodeproptest.GoldenYAML(t, "testdata/nodeprop.golden.yml", out, "id", "metadata.latest_commit")
+//
+// Golden compares bytes; GoldenYAML and GoldenJSON normalize both sides
+// first. Tests importing the package must not define an -update flag of
+// their own.
+func Golden(t testing.TB, path string, got []byte) {
+	t.Helper()
+	golden(t, path, got, nil)
+}
+
+// GoldenYAML is Golden for YAML: got and the golden file are compared as
+// normalized by NormalizeYAML, so key order, indentation, and quoting do
+// not matter, and the values at the ignore paths, such as ids and
+// timestamps, are not compared. The golden file is written normalized.
+func GoldenYAML(t testing.TB, path string, got []byte, ignore ...string) {
+	t.Helper()
+	norm, err := NormalizeYAML(got, ignore...)
+	if err != nil {
+		t.Fatalf("generated YAML: %v", err)
+	}
+	golden(t, path, norm, func(want []byte) ([]byte, error) { return NormalizeYAML(want, ignore...) })
+}
+
+// GoldenJSON is GoldenYAML for JSON, normalized by NormalizeJSON.
+func GoldenJSON(t testing.TB, path string, got []byte, ignore ...string) {
+	t.Helper()
+	norm, err := NormalizeJSON(got, ignore...)
+	if err != nil {
+		t.Fatalf("generated JSON: %v", err)
+	}
+	golden(t, path, norm, func(want []byte) ([]byte, error) { return NormalizeJSON(want, ignore...) })
+}
+
+// golden compares got with the file at path, after normalizing the file's
+// content if normalize is set, or writes got to it with -update.
+func golden(t testing.TB, path string, got []byte, normalize func([]byte) ([]byte, error)) {
+	t.Helper()
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to write golden file: %v", err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("failed to write golden file: %v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file (create it with go test -update): %v", err)
+	}
+	if normalize != nil {
+		if want, err = normalize(want); err != nil {
+			t.Fatalf("golden file %s: %v", path, err)
+		}
+	}
+	if !bytes.Equal(want, got) {
+		t.Errorf("output differs from %s (- golden, + got; rerun with -update to accept):\n%s", path, DiffLines(string(want), string(got)))
+	}
+}
+
+// NormalizeYAML re-encodes every document in data with mapping keys sorted,
+// in block style with two-space indentation and only the quotes needed,
+// and without comments, and replaces the values at the dotted ignore paths
+// (e.g. metadata.latest_commit) with Ignored; * in a path matches any key
+// or item. Sequences keep their order, which is meaningful in workflows
+// and flows. Use Golden where comments matter.
+func NormalizeYAML(data []byte, ignore ...string) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		normalizeNode(&doc)
+		for _, p := range ignore {
+			ignoreNode(&doc, strings.Split(p, "."))
+		}
+		if err := enc.Encode(&doc); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// normalizeNode sorts the keys of every mapping in n and clears the styles
+// and comments the encoder would otherwise keep.
+func normalizeNode(n *yaml.Node) {
+	n.Style &^= yaml.FlowStyle | yaml.DoubleQuotedStyle | yaml.SingleQuotedStyle
+	n.HeadComment, n.LineComment, n.FootComment = "", "", ""
+	if n.Kind == yaml.MappingNode {
+		pairs := make([][2]*yaml.Node, 0, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			pairs = append(pairs, [2]*yaml.Node{n.Content[i], n.Content[i+1]})
+		}
+		sort.SliceStable(pairs, func(i, j int) bool { return pairs[i][0].Value < pairs[j][0].Value })
+		n.Content = n.Content[:0]
+		for _, p := range pairs {
+			n.Content = append(n.Content, p[0], p[1])
+		}
+	}
+	for _, c := range n.Content {
+		normalizeNode(c)
+	}
+}
+
+// ignoreNode replaces the values at path in n with Ignored.
+func ignoreNode(n *yaml.Node, path []string) {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		for _, c := range n.Content {
+			ignoreNode(c, path)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if path[0] != "*" && n.Content[i].Value != path[0] {
+				continue
+			}
+			if len(path) == 1 {
+				*n.Content[i+1] = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: Ignored}
+			} else {
+				ignoreNode(n.Content[i+1], path[1:])
+			}
+		}
+	case yaml.SequenceNode:
+		if path[0] != "*" {
+			return
+		}
+		for i, c := range n.Content {
+			if len(path) == 1 {
+				*n.Content[i] = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: Ignored}
+			} else {
+				ignoreNode(c, path[1:])
+			}
+		}
+	}
+}
+
+// NormalizeJSON re-encodes data with object keys sorted and two-space
+// indentation, and replaces the values at the dotted ignore paths with
+// Ignored, as NormalizeYAML does.
+func NormalizeJSON(data []byte, ignore ...string) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	for _, p := range ignore {
+		v = ignoreValue(v, strings.Split(p, "."))
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ignoreValue returns v with the values at path replaced with Ignored.
+func ignoreValue(v interface{}, path []string) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			if path[0] != "*" && k != path[0] {
+				continue
+			}
+			if len(path) == 1 {
+				v[k] = Ignored
+			} else {
+				v[k] = ignoreValue(e, path[1:])
+			}
+		}
+	case []interface{}:
+		if path[0] != "*" {
+			break
+		}
+		for i, e := range v {
+			if len(path) == 1 {
+				v[i] = Ignored
+			} else {
+				v[i] = ignoreValue(e, path[1:])
+			}
+		}
+	}
+	return v
+}
+
+// DiffLines returns a line diff of want and got: removed lines are
+// prefixed with "- ", added ones with "+ ", and unchanged ones with two
+// spaces, with long unchanged stretches elided.
+func DiffLines(want, got string) string {
+	a := strings.Split(strings.TrimSuffix(want, "\n"), "\n")
+	b := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	type line struct {
+		op   byte
+		text string
+	}
+	var lines []line
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, line{' ', a[i]})
+			i, j = i+1, j+1
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, line{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, line{'+', b[j]})
+			j++
+		}
+	}
+
+	// Unchanged lines more than context lines from a change are elided,
+	// so equal texts have no diff.
+	const context = 3
+	keep := make([]bool, len(lines))
+	changed := false
+	for k, l := range lines {
+		if l.op == ' ' {
+			continue
+		}
+		changed = true
+		for d := max(0, k-context); d <= min(len(lines)-1, k+context); d++ {
+			keep[d] = true
+		}
+	}
+	if !changed {
+		return ""
+	}
+	var out strings.Builder
+	for k, l := range lines {
+		switch {
+		case keep[k]:
+			fmt.Fprintf(&out, "%c %s\n", l.op, l.text)
+		case k == 0 || keep[k-1]:
+			out.WriteString("  ...\n")
+		}
+	}
+	return out.String()
+}
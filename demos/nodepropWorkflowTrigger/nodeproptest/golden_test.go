@@ -0,0 +1,143 @@
+package nodeproptest_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+func TestNormalizeYAML(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		ignore  []string
+		want    string
+		wantErr bool
+	}{
+		{name: "sorted keys", in: "b: 1\na: 2\n", want: "a: 2\nb: 1\n"},
+		{name: "nested", in: "z:\n    y: 1\n    x: 2\n", want: "z:\n  x: 2\n  y: 1\n"},
+		{name: "flow style and quotes", in: `{name: "site", tags: ['web', api]}`, want: "name: site\ntags:\n  - web\n  - api\n"},
+		{name: "comments", in: "# head\na: 1 # line\n", want: "a: 1\n"},
+		{name: "sequences keep order", in: "steps: [b, a]\n", want: "steps:\n  - b\n  - a\n"},
+		{name: "needed quotes kept", in: "version: '1.0'\nenabled: 'true'\n", want: "enabled: \"true\"\nversion: \"1.0\"\n"},
+		{name: "ignored", in: "id: abc\nmetadata: {latest_commit: 123, name: x}\n", ignore: []string{"id", "metadata.latest_commit"}, want: "id: <ignored>\nmetadata:\n  latest_commit: <ignored>\n  name: x\n"},
+		{name: "ignored wildcard", in: "runs: [{id: 1, ok: true}, {id: 2, ok: false}]\n", ignore: []string{"runs.*.id"}, want: "runs:\n  - id: <ignored>\n    ok: true\n  - id: <ignored>\n    ok: false\n"},
+		{name: "ignored missing", in: "a: 1\n", ignore: []string{"b.c"}, want: "a: 1\n"},
+		{name: "documents", in: "b: 1\na: 2\n---\nd: 1\nc: 2\n", want: "a: 2\nb: 1\n---\nc: 2\nd: 1\n"},
+		{name: "invalid", in: "a: [\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := nodeproptest.NormalizeYAML([]byte(tt.in), tt.ignore...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NormalizeYAML() error = %v, want error %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("NormalizeYAML() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		ignore  []string
+		want    string
+		wantErr bool
+	}{
+		{name: "sorted keys", in: `{"b":1,"a":2}`, want: "{\n  \"a\": 2,\n  \"b\": 1\n}\n"},
+		{name: "numbers kept", in: `{"id": 12345678901234567890, "f": 1.50}`, want: "{\n  \"f\": 1.50,\n  \"id\": 12345678901234567890\n}\n"},
+		{name: "html not escaped", in: `{"a": "<b>&"}`, want: "{\n  \"a\": \"<b>&\"\n}\n"},
+		{name: "ignored", in: `{"id": "x", "at": {"t": 1}}`, ignore: []string{"id", "at.t"}, want: "{\n  \"at\": {\n    \"t\": \"<ignored>\"\n  },\n  \"id\": \"<ignored>\"\n}\n"},
+		{name: "ignored wildcard", in: `[{"id": 1}, {"id": 2}]`, ignore: []string{"*.id"}, want: "[\n  {\n    \"id\": \"<ignored>\"\n  },\n  {\n    \"id\": \"<ignored>\"\n  }\n]\n"},
+		{name: "invalid", in: `{`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := nodeproptest.NormalizeJSON([]byte(tt.in), tt.ignore...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NormalizeJSON() error = %v, want error %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("NormalizeJSON() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name      string
+		want, got string
+		diff      string
+	}{
+		{name: "equal", want: "a\nb\n", got: "a\nb\n", diff: ""},
+		{name: "changed", want: "a\nb\nc\n", got: "a\nx\nc\n", diff: "  a\n- b\n+ x\n  c\n"},
+		{name: "added", want: "a\n", got: "a\nb\n", diff: "  a\n+ b\n"},
+		{name: "removed", want: "a\nb\n", got: "b\n", diff: "- a\n  b\n"},
+		{
+			name: "elided",
+			want: "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			got:  "1\n2\n3\n4\n5\n6\n7\n8\nnine\n",
+			diff: "  ...\n  6\n  7\n  8\n- 9\n+ nine\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nodeproptest.DiffLines(tt.want, tt.got); got != tt.diff {
+				t.Errorf("DiffLines() =\n%s\nwant\n%s", got, tt.diff)
+			}
+		})
+	}
+}
+
+func TestGolden(t *testing.T) {
+	dir := t.TempDir()
+	yamlFile := filepath.Join(dir, "flow.golden.yml")
+	os.WriteFile(yamlFile, []byte("name: release # the flow\nid: 1\nsteps: [build, deploy]\n"), 0o644)
+	jsonFile := filepath.Join(dir, "report.golden.json")
+	os.WriteFile(jsonFile, []byte(`{"runs": [{"id": 1, "conclusion": "success"}]}`), 0o644)
+	rawFile := filepath.Join(dir, "raw.golden")
+	os.WriteFile(rawFile, []byte("a: 1\n"), 0o644)
+
+	tests := []struct {
+		name     string
+		check    func(testing.TB)
+		wantDiff string
+	}{
+		{name: "yaml", check: func(tb testing.TB) {
+			nodeproptest.GoldenYAML(tb, yamlFile, []byte("id: 2\nname: release\nsteps:\n- build\n- deploy\n"), "id")
+		}},
+		{name: "yaml differs", check: func(tb testing.TB) {
+			nodeproptest.GoldenYAML(tb, yamlFile, []byte("id: 1\nname: release\nsteps: [deploy]\n"), "id")
+		}, wantDiff: "-   - build"},
+		{name: "yaml id compared", check: func(tb testing.TB) {
+			nodeproptest.GoldenYAML(tb, yamlFile, []byte("id: 2\nname: release\nsteps: [build, deploy]\n"))
+		}, wantDiff: "+ id: 2"},
+		{name: "json", check: func(tb testing.TB) {
+			nodeproptest.GoldenJSON(tb, jsonFile, []byte(`{"runs":[{"conclusion":"success","id":7}]}`), "runs.*.id")
+		}},
+		{name: "json differs", check: func(tb testing.TB) {
+			nodeproptest.GoldenJSON(tb, jsonFile, []byte(`{"runs":[{"conclusion":"failure","id":1}]}`))
+		}, wantDiff: `+       "conclusion": "failure"`},
+		{name: "bytes", check: func(tb testing.TB) { nodeproptest.Golden(tb, rawFile, []byte("a: 1\n")) }},
+		{name: "bytes not normalized", check: func(tb testing.TB) { nodeproptest.Golden(tb, rawFile, []byte("a:  1\n")) }, wantDiff: "+ a:  1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := &recordingTB{TB: t}
+			tt.check(tb)
+			switch {
+			case tt.wantDiff == "" && len(tb.errors) > 0:
+				t.Errorf("golden check failed: %s", tb.errors)
+			case tt.wantDiff != "" && (len(tb.errors) != 1 || !strings.Contains(tb.errors[0], tt.wantDiff)):
+				t.Errorf("golden check errors = %q, want a diff with %q", tb.errors, tt.wantDiff)
+			}
+		})
+	}
+}
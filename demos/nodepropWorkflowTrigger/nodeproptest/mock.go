@@ -0,0 +1,176 @@
+package nodeproptest
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sync"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// Call is an invocation of a MockTrigger. The token is kept only as its
+// fingerprint, so failing assertions do not print it.
+type Call struct {
+	Target           string
+	Params           map[string]string
+	TokenFingerprint string
+	At               time.Time
+}
+
+// MockTrigger is a workflow trigger that records its invocations instead
+// of sending them, for testing code above the triggers, such as a
+// TriggerManager, FlowFacade, or actor, without HTTP:
+//
+//	mock := &nodeproptest.MockTrigger{}
+//	tm.RegisterWorkflow("deploy", mock)
+//	actor.RunCustomFlow(ctx, "Cdaprod/site", "workflow", "deploy", token, map[string]string{"env": "prod"})
+//	mock.AssertCalled(t, "Cdaprod/site", map[string]string{"env": "prod"})
+//
+// It is a flow.ContextTrigger, and also has the TriggerWorkflow method of the
+// deprecated flow.GitHubWorkflowTrigger. Its zero value succeeds every
+// time.
+type MockTrigger struct {
+	// Err, if set, is returned by every invocation.
+	Err error
+	// Fail, if set, decides the error of each invocation instead of Err.
+	Fail func(Call) error
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+// Trigger records the invocation.
+func (m *MockTrigger) Trigger(target string, params map[string]string, authToken string) error {
+	c := Call{Target: target, Params: maps.Clone(params), TokenFingerprint: flow.TokenFingerprint(authToken), At: time.Now()}
+	if c.Params == nil {
+		c.Params = map[string]string{}
+	}
+	m.mu.Lock()
+	m.calls = append(m.calls, c)
+	err, fail := m.Err, m.Fail
+	m.mu.Unlock()
+	if fail != nil {
+		return fail(c)
+	}
+	return err
+}
+
+// TriggerContext records the invocation, as Trigger does, unless ctx is
+// already done, when it returns ctx's error instead, so tests can check
+// that a cancelled caller starts nothing.
+func (m *MockTrigger) TriggerContext(ctx context.Context, target string, params map[string]string, authToken string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.Trigger(target, params, authToken)
+}
+
+// TriggerWorkflow records the invocation, as Trigger does.
+func (m *MockTrigger) TriggerWorkflow(target string, params map[string]string, authToken string) error {
+	return m.Trigger(target, params, authToken)
+}
+
+// Calls returns the invocations, oldest first.
+func (m *MockTrigger) Calls() []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Call(nil), m.calls...)
+}
+
+// CallsTo returns the invocations for target, oldest first.
+func (m *MockTrigger) CallsTo(target string) []Call {
+	var out []Call
+	for _, c := range m.Calls() {
+		if c.Target == target {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Reset forgets the invocations.
+func (m *MockTrigger) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = nil
+}
+
+// AssertCalled fails t unless target was triggered with params, or with
+// at least those params if others were passed too, and returns the first
+// matching call.
+func (m *MockTrigger) AssertCalled(t testing.TB, target string, params map[string]string) Call {
+	t.Helper()
+	calls := m.CallsTo(target)
+	for _, c := range calls {
+		if hasParams(c.Params, params) {
+			return c
+		}
+	}
+	if len(calls) == 0 {
+		t.Errorf("%s was not triggered; calls: %s", target, describe(m.Calls()))
+	} else {
+		t.Errorf("%s was not triggered with %v; calls: %s", target, params, describe(calls))
+	}
+	return Call{}
+}
+
+// AssertNotCalled fails t if target was triggered.
+func (m *MockTrigger) AssertNotCalled(t testing.TB, target string) {
+	t.Helper()
+	if calls := m.CallsTo(target); len(calls) > 0 {
+		t.Errorf("%s was triggered %d times: %s", target, len(calls), describe(calls))
+	}
+}
+
+// AssertCallCount fails t unless the mock was invoked n times.
+func (m *MockTrigger) AssertCallCount(t testing.TB, n int) {
+	t.Helper()
+	if calls := m.Calls(); len(calls) != n {
+		t.Errorf("triggered %d times, want %d: %s", len(calls), n, describe(calls))
+	}
+}
+
+// AssertToken fails t unless every invocation carried token.
+func (m *MockTrigger) AssertToken(t testing.TB, token string) {
+	t.Helper()
+	want := flow.TokenFingerprint(token)
+	for _, c := range m.Calls() {
+		if c.TokenFingerprint != want {
+			t.Errorf("%s was triggered with token %s, want %s", c.Target, orNone(c.TokenFingerprint), orNone(want))
+		}
+	}
+}
+
+// hasParams reports whether got has every param in want.
+func hasParams(got, want map[string]string) bool {
+	for k, v := range want {
+		if g, ok := got[k]; !ok || g != v {
+			return false
+		}
+	}
+	return true
+}
+
+func describe(calls []Call) string {
+	if len(calls) == 0 {
+		return "none"
+	}
+	s := ""
+	for i, c := range calls {
+		if i > 0 {
+			s += ", "
+		}
+		s += fmt.Sprintf("%s %v", c.Target, c.Params)
+	}
+	return s
+}
+
+func orNone(fingerprint string) string {
+	if fingerprint == "" {
+		return "(none)"
+	}
+	return fingerprint
+}
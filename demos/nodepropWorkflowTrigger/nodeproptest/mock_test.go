@@ -0,0 +1,154 @@
+package nodeproptest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+// recordingTB collects the failures an assertion reports instead of
+// failing the test.
+type recordingTB struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recordingTB) Helper() {}
+
+func (r *recordingTB) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+var (
+	_ flow.ContextTrigger  = (*nodeproptest.MockTrigger)(nil)
+	_ flow.WorkflowTrigger = (*nodeproptest.MockTrigger)(nil)
+)
+
+func TestMockTriggerAssertions(t *testing.T) {
+	tests := []struct {
+		name    string
+		assert  func(testing.TB, *nodeproptest.MockTrigger)
+		wantErr string
+	}{
+		{name: "called", assert: func(tb testing.TB, m *nodeproptest.MockTrigger) {
+			m.AssertCalled(tb, "Cdaprod/site", map[string]string{"env": "prod"})
+		}},
+		{name: "called with a subset", assert: func(tb testing.TB, m *nodeproptest.MockTrigger) {
+			m.AssertCalled(tb, "Cdaprod/site", nil)
+		}},
+		{name: "other params", assert: func(tb testing.TB, m *nodeproptest.MockTrigger) {
+			m.AssertCalled(tb, "Cdaprod/site", map[string]string{"env": "dev"})
+		}, wantErr: "Cdaprod/site was not triggered with map[env:dev]"},
+		{name: "not called", assert: func(tb testing.TB, m *nodeproptest.MockTrigger) {
+			m.AssertCalled(tb, "Cdaprod/other", nil)
+		}, wantErr: "Cdaprod/other was not triggered; calls: Cdaprod/site map[env:prod sha:abc], Cdaprod/lib map[]"},
+		{name: "not called as expected", assert: func(tb testing.TB, m *nodeproptest.MockTrigger) {
+			m.AssertNotCalled(tb, "Cdaprod/other")
+		}},
+		{name: "called unexpectedly", assert: func(tb testing.TB, m *nodeproptest.MockTrigger) {
+			m.AssertNotCalled(tb, "Cdaprod/lib")
+		}, wantErr: "Cdaprod/lib was triggered 1 times"},
+		{name: "call count", assert: func(tb testing.TB, m *nodeproptest.MockTrigger) {
+			m.AssertCallCount(tb, 2)
+		}},
+		{name: "wrong call count", assert: func(tb testing.TB, m *nodeproptest.MockTrigger) {
+			m.AssertCallCount(tb, 3)
+		}, wantErr: "triggered 2 times, want 3"},
+		{name: "token", assert: func(tb testing.TB, m *nodeproptest.MockTrigger) {
+			m.AssertToken(tb, "ghp_secret")
+		}},
+		{name: "other token", assert: func(tb testing.TB, m *nodeproptest.MockTrigger) {
+			m.AssertToken(tb, "ghp_other")
+		}, wantErr: "want " + flow.TokenFingerprint("ghp_other")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &nodeproptest.MockTrigger{}
+			m.Trigger("Cdaprod/site", map[string]string{"env": "prod", "sha": "abc"}, "ghp_secret")
+			m.TriggerWorkflow("Cdaprod/lib", nil, "ghp_secret")
+			tb := &recordingTB{TB: t}
+			tt.assert(tb, m)
+			if tt.wantErr == "" && len(tb.errors) > 0 {
+				t.Errorf("assertion failed: %v", tb.errors)
+			}
+			if tt.wantErr != "" && len(tb.errors) == 0 {
+				t.Errorf("assertion passed, want an error containing %q", tt.wantErr)
+			}
+			for _, e := range tb.errors {
+				if !strings.Contains(e, tt.wantErr) {
+					t.Errorf("assertion error %q, want one containing %q", e, tt.wantErr)
+				}
+				if strings.Contains(e, "ghp_") {
+					t.Errorf("assertion error %q prints the token", e)
+				}
+			}
+		})
+	}
+}
+
+func TestMockTriggerErrors(t *testing.T) {
+	errBoom := errors.New("boom")
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name      string
+		mock      *nodeproptest.MockTrigger
+		ctx       context.Context
+		wantErr   error
+		wantCalls int
+	}{
+		{name: "zero value", mock: &nodeproptest.MockTrigger{}, ctx: context.Background(), wantCalls: 1},
+		{name: "err", mock: &nodeproptest.MockTrigger{Err: errBoom}, ctx: context.Background(), wantErr: errBoom, wantCalls: 1},
+		{
+			name: "fail overrides err",
+			mock: &nodeproptest.MockTrigger{Err: errBoom, Fail: func(c nodeproptest.Call) error {
+				if c.Params["env"] == "prod" {
+					return flow.ErrPolicyDenied
+				}
+				return nil
+			}},
+			ctx: context.Background(), wantErr: flow.ErrPolicyDenied, wantCalls: 1,
+		},
+		{name: "cancelled context", mock: &nodeproptest.MockTrigger{}, ctx: cancelled, wantErr: context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := map[string]string{"env": "prod"}
+			err := tt.mock.TriggerContext(tt.ctx, "Cdaprod/site", params, "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("TriggerContext() error = %v, want %v", err, tt.wantErr)
+			}
+			calls := tt.mock.Calls()
+			if len(calls) != tt.wantCalls {
+				t.Fatalf("Calls() = %+v, want %d", calls, tt.wantCalls)
+			}
+			if tt.wantCalls == 0 {
+				return
+			}
+			// The recorded params are a copy.
+			params["env"] = "dev"
+			if c := calls[0]; c.Params["env"] != "prod" || c.TokenFingerprint != "" || c.At.IsZero() {
+				t.Errorf("call = %+v", c)
+			}
+		})
+	}
+}
+
+func TestMockTriggerCallsTo(t *testing.T) {
+	m := &nodeproptest.MockTrigger{}
+	m.Trigger("a", nil, "")
+	m.Trigger("b", nil, "")
+	m.Trigger("a", map[string]string{"n": "2"}, "")
+	if calls := m.CallsTo("a"); len(calls) != 2 || calls[1].Params["n"] != "2" || calls[0].Params == nil {
+		t.Errorf("CallsTo(a) = %+v", calls)
+	}
+	m.Reset()
+	if calls := m.Calls(); len(calls) != 0 {
+		t.Errorf("Calls() after Reset() = %+v", calls)
+	}
+}
@@ -0,0 +1,573 @@
+// Package nodeproptest is a fake of the GitHub Actions API for testing code
+// that triggers workflows, without reaching GitHub. It serves the dispatch,
+// workflow, and run endpoints the flow package uses from an httptest
+// server, runs dispatched workflows to a programmed outcome, and fails or
+// delays requests on demand:
+//
+//	gh := nodeproptest.NewServer()
+//	defer gh.Close()
+//	gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+//	gh.Inject(nodeproptest.Fault{Path: "/repos/*/*/actions/workflows/*/dispatches", Status: 502, Times: 1})
+//	c := flow.NewRunCorrelator(gh.Client(), flow.NewFileHistoryStore(filepath.Join(t.TempDir(), "history.jsonl")))
+package nodeproptest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// DefaultToken is the token Client authenticates with and the server
+// accepts unless Token is changed.
+const DefaultToken = "ghp_nodeproptest"
+
+// Outcome is how the fake runs a workflow: queued for Queued, then in
+// progress for Duration, then completed with Conclusion.
+type Outcome struct {
+	// Conclusion defaults to success.
+	Conclusion string        `yaml:"conclusion,omitempty" json:"conclusion,omitempty"`
+	Queued     time.Duration `yaml:"queued,omitempty" json:"queued,omitempty"`
+	Duration   time.Duration `yaml:"duration,omitempty" json:"duration,omitempty"`
+}
+
+// Fault makes matching requests fail or wait. A fault with a Status
+// answers it instead of the fake; one with only Latency delays the
+// request and lets it through.
+type Fault struct {
+	// Method matches the request method; empty matches any.
+	Method string
+	// Path is a path.Match glob of the request path, such as
+	// /repos/*/*/actions/workflows/*/dispatches; empty matches any.
+	Path    string
+	Status  int
+	Body    string
+	Latency time.Duration
+	// RetryAfter, if set, is sent in a Retry-After header.
+	RetryAfter time.Duration
+	// Times is how many requests the fault applies to; 0 means all.
+	Times int
+}
+
+// Dispatch is a workflow_dispatch or repository_dispatch event received.
+type Dispatch struct {
+	Repo string
+	// Workflow is empty for a repository_dispatch, whose event type is in
+	// EventType and client payload, formatted as strings, in Inputs.
+	Workflow  string
+	EventType string
+	Ref       string
+	Inputs    map[string]string
+	// RunID is the run the dispatch started, if any.
+	RunID int64
+	// Token is the credential the request carried.
+	Token string
+	At    time.Time
+}
+
+// Request is a request the server received, faults included.
+type Request struct {
+	Method string
+	Path   string
+	At     time.Time
+}
+
+// Server is a fake GitHub API. Its zero value is not usable; create it
+// with NewServer.
+type Server struct {
+	*httptest.Server
+	// Token is the credential requests must carry, as a bearer token;
+	// empty accepts any.
+	Token string
+	// Login and Scopes are reported by GET /user.
+	Login  string
+	Scopes []string
+	// RunName, if set, gives the display title of the run a dispatch
+	// starts. The default is the workflow name followed by the
+	// nodeprop_id input, as with run-name: Deploy ${{ inputs.nodeprop_id }}.
+	RunName func(Dispatch) string
+	// RateLimit is the number of requests reported as remaining, counting
+	// down with each request; 0 means 5000.
+	RateLimit int
+	// Clock, if set, replaces the system clock for the times of runs and
+	// their progress, so a fake clock moves them along. Fault latencies
+	// are always real.
+	Clock flow.Clock
+
+	mu         sync.Mutex
+	workflows  map[string]map[string]*flow.Workflow
+	outcomes   map[string]Outcome
+	runs       []*run
+	dispatches []Dispatch
+	requests   []Request
+	faults     []*Fault
+	nextID     int64
+	used       int
+}
+
+// run is a run and when it was created.
+type run struct {
+	repo     string
+	workflow string
+	run      flow.WorkflowRun
+	outcome  Outcome
+	// cancelled is when the run was cancelled, if it was.
+	cancelled time.Time
+}
+
+// NewServer starts a fake; Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		Token:     DefaultToken,
+		Login:     "nodeproptest",
+		Scopes:    []string{"repo"},
+		workflows: map[string]map[string]*flow.Workflow{},
+		outcomes:  map[string]Outcome{},
+		nextID:    1000,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Client returns a GitHub client for the fake.
+func (s *Server) Client() *flow.GitHubClient {
+	c := flow.NewGitHubClient(s.Token)
+	if s.Token == "" {
+		c.Token = DefaultToken
+	}
+	c.BaseURL = s.URL
+	c.HTTPClient = s.Server.Client()
+	return c
+}
+
+// AddWorkflow adds workflow files to repo. Dispatching a workflow that was
+// not added is a 404, as on GitHub.
+func (s *Server) AddWorkflow(repo string, files ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.workflows[repo] == nil {
+		s.workflows[repo] = map[string]*flow.Workflow{}
+	}
+	for _, f := range files {
+		if s.workflows[repo][f] != nil {
+			continue
+		}
+		s.nextID++
+		name := strings.TrimSuffix(strings.TrimSuffix(f, ".yml"), ".yaml")
+		s.workflows[repo][f] = &flow.Workflow{ID: s.nextID, Name: name, Path: ".github/workflows/" + f, State: "active"}
+	}
+}
+
+// SetOutcome sets how runs of the workflow started from now on end. An
+// empty workflow sets the outcome of every workflow in repo without its
+// own.
+func (s *Server) SetOutcome(repo, workflow string, o Outcome) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.outcomes[repo+"\x00"+workflow] = o
+}
+
+// Complete ends a run now with conclusion.
+func (s *Server) Complete(runID int64, conclusion string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.findRun(runID)
+	if r == nil {
+		return fmt.Errorf("run %d not found", runID)
+	}
+	elapsed := s.now().Sub(r.run.CreatedAt)
+	queued := min(r.outcome.Queued, elapsed)
+	r.outcome = Outcome{Conclusion: conclusion, Queued: queued, Duration: elapsed - queued}
+	return nil
+}
+
+// Inject adds a fault; the first matching fault with requests left applies.
+func (s *Server) Inject(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// ClearFaults removes every fault.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// Dispatches returns the dispatches received, oldest first.
+func (s *Server) Dispatches() []Dispatch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Dispatch(nil), s.dispatches...)
+}
+
+// Requests returns the requests received, oldest first.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Runs returns the runs of repo, newest first, as they are now.
+func (s *Server) Runs(repo string) []flow.WorkflowRun {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.listRuns(repo, "", time.Time{})
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path, At: s.now()})
+	s.used++
+	remaining := s.RateLimit
+	if remaining == 0 {
+		remaining = 5000
+	}
+	remaining = max(remaining-s.used, 0)
+	f := s.fault(r)
+	var fault Fault
+	if f != nil {
+		fault = *f
+	}
+	s.mu.Unlock()
+
+	h := w.Header()
+	h.Set("X-RateLimit-Limit", "5000")
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	h.Set("X-RateLimit-Reset", strconv.FormatInt(s.now().Add(time.Hour).Unix(), 10))
+	if fault.Latency > 0 {
+		select {
+		case <-time.After(fault.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if fault.Status != 0 {
+		if fault.RetryAfter > 0 {
+			h.Set("Retry-After", strconv.Itoa(int((fault.RetryAfter+time.Second-1)/time.Second)))
+		}
+		if fault.Body == "" {
+			writeJSON(w, fault.Status, message(http.StatusText(fault.Status)))
+			return
+		}
+		h.Set("Content-Type", "application/json")
+		w.WriteHeader(fault.Status)
+		fmt.Fprint(w, fault.Body)
+		return
+	}
+	token := bearer(r)
+	if s.Token != "" && token != s.Token {
+		writeJSON(w, http.StatusUnauthorized, message("Bad credentials"))
+		return
+	}
+	s.route(w, r, token)
+}
+
+// fault returns the fault applying to r and uses up one of its requests.
+func (s *Server) fault(r *http.Request) *Fault {
+	for _, f := range s.faults {
+		if f.Method != "" && !strings.EqualFold(f.Method, r.Method) {
+			continue
+		}
+		if f.Path != "" {
+			if ok, _ := path.Match(f.Path, r.URL.Path); !ok {
+				continue
+			}
+		}
+		if f.Times < 0 {
+			continue
+		}
+		if f.Times > 0 {
+			if f.Times--; f.Times == 0 {
+				f.Times = -1
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+// route serves the endpoints of the fake.
+func (s *Server) route(w http.ResponseWriter, r *http.Request, token string) {
+	switch {
+	case r.URL.Path == "/user" && r.Method == "GET":
+		w.Header().Set("X-OAuth-Scopes", strings.Join(s.Scopes, ", "))
+		writeJSON(w, http.StatusOK, map[string]string{"login": s.Login})
+		return
+	case r.URL.Path == "/meta" && r.Method == "GET":
+		writeJSON(w, http.StatusOK, map[string]interface{}{"verifiable_password_authentication": false})
+		return
+	case r.URL.Path == "/rate_limit" && r.Method == "GET":
+		remaining, _ := strconv.Atoi(w.Header().Get("X-RateLimit-Remaining"))
+		reset, _ := strconv.ParseInt(w.Header().Get("X-RateLimit-Reset"), 10, 64)
+		core := map[string]interface{}{"limit": 5000, "remaining": remaining, "reset": reset}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"resources": map[string]interface{}{"core": core}})
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/repos/"), "/")
+	if !strings.HasPrefix(r.URL.Path, "/repos/") || len(parts) < 2 {
+		writeJSON(w, http.StatusNotFound, message("Not Found"))
+		return
+	}
+	repo, rest := parts[0]+"/"+parts[1], parts[2:]
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.workflows[repo] == nil {
+		writeJSON(w, http.StatusNotFound, message("Not Found"))
+		return
+	}
+	switch {
+	case len(rest) == 0 && r.Method == "GET":
+		writeJSON(w, http.StatusOK, flow.Repository{FullName: repo, DefaultBranch: "main", Private: true})
+	case len(rest) == 1 && rest[0] == "dispatches" && r.Method == "POST":
+		s.repositoryDispatch(w, r, repo, token)
+	case len(rest) < 2 || rest[0] != "actions":
+		writeJSON(w, http.StatusNotFound, message("Not Found"))
+	case len(rest) == 2 && rest[1] == "workflows" && r.Method == "GET":
+		s.listWorkflows(w, repo)
+	case len(rest) == 3 && rest[1] == "workflows" && r.Method == "GET":
+		wf := s.workflow(repo, rest[2])
+		if wf == nil {
+			writeJSON(w, http.StatusNotFound, message("Not Found"))
+			return
+		}
+		writeJSON(w, http.StatusOK, wf)
+	case len(rest) == 4 && rest[1] == "workflows" && rest[3] == "dispatches" && r.Method == "POST":
+		s.workflowDispatch(w, r, repo, rest[2], token)
+	case len(rest) == 4 && rest[1] == "workflows" && rest[3] == "runs" && r.Method == "GET":
+		s.workflowRuns(w, r, repo, rest[2])
+	case len(rest) == 2 && rest[1] == "runs" && r.Method == "GET":
+		s.workflowRuns(w, r, repo, "")
+	case len(rest) >= 3 && rest[1] == "runs":
+		s.runEndpoint(w, r, repo, rest[2], rest[3:])
+	default:
+		writeJSON(w, http.StatusNotFound, message("Not Found"))
+	}
+}
+
+// workflow finds a workflow of repo by file name or ID.
+func (s *Server) workflow(repo, ref string) *flow.Workflow {
+	if wf := s.workflows[repo][ref]; wf != nil {
+		return wf
+	}
+	for _, wf := range s.workflows[repo] {
+		if strconv.FormatInt(wf.ID, 10) == ref {
+			return wf
+		}
+	}
+	return nil
+}
+
+func (s *Server) listWorkflows(w http.ResponseWriter, repo string) {
+	wfs := []*flow.Workflow{}
+	for _, wf := range s.workflows[repo] {
+		wfs = append(wfs, wf)
+	}
+	sort.Slice(wfs, func(i, j int) bool { return wfs[i].ID < wfs[j].ID })
+	writeJSON(w, http.StatusOK, map[string]interface{}{"total_count": len(wfs), "workflows": wfs})
+}
+
+func (s *Server) workflowDispatch(w http.ResponseWriter, r *http.Request, repo, file, token string) {
+	wf := s.workflow(repo, file)
+	if wf == nil {
+		writeJSON(w, http.StatusNotFound, message("Not Found"))
+		return
+	}
+	var body struct {
+		Ref    string            `json:"ref"`
+		Inputs map[string]string `json:"inputs"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, message("Problems parsing JSON"))
+		return
+	}
+	if body.Ref == "" {
+		writeJSON(w, http.StatusUnprocessableEntity, message("Invalid request.\n\n\"ref\" wasn't supplied."))
+		return
+	}
+	d := Dispatch{Repo: repo, Workflow: file, Ref: body.Ref, Inputs: body.Inputs, Token: token, At: s.now()}
+	title := wf.Name
+	if id := body.Inputs[flow.CorrelationInput]; id != "" {
+		title += " " + id
+	}
+	if s.RunName != nil {
+		title = s.RunName(d)
+	}
+	s.nextID++
+	ref := strings.TrimPrefix(strings.TrimPrefix(body.Ref, "refs/heads/"), "refs/tags/")
+	nr := &run{repo: repo, workflow: file, outcome: s.outcome(repo, file), run: flow.WorkflowRun{
+		ID:           s.nextID,
+		Name:         wf.Name,
+		DisplayTitle: title,
+		Event:        "workflow_dispatch",
+		HeadBranch:   ref,
+		HTMLURL:      fmt.Sprintf("%s/%s/actions/runs/%d", s.URL, repo, s.nextID),
+		CreatedAt:    d.At.UTC(),
+	}}
+	s.runs = append(s.runs, nr)
+	d.RunID = nr.run.ID
+	s.dispatches = append(s.dispatches, d)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) repositoryDispatch(w http.ResponseWriter, r *http.Request, repo, token string) {
+	var body struct {
+		EventType     string                 `json:"event_type"`
+		ClientPayload map[string]interface{} `json:"client_payload"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.EventType == "" {
+		writeJSON(w, http.StatusUnprocessableEntity, message("Invalid request.\n\n\"event_type\" wasn't supplied."))
+		return
+	}
+	payload := map[string]string{}
+	for k, v := range body.ClientPayload {
+		payload[k] = fmt.Sprint(v)
+	}
+	s.dispatches = append(s.dispatches, Dispatch{Repo: repo, EventType: body.EventType, Inputs: payload, Token: token, At: s.now()})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// outcome is the outcome runs of the workflow started now will have.
+func (s *Server) outcome(repo, file string) Outcome {
+	o, ok := s.outcomes[repo+"\x00"+file]
+	if !ok {
+		o = s.outcomes[repo+"\x00"]
+	}
+	if o.Conclusion == "" {
+		o.Conclusion = "success"
+	}
+	return o
+}
+
+func (s *Server) workflowRuns(w http.ResponseWriter, r *http.Request, repo, file string) {
+	if file != "" && s.workflow(repo, file) == nil {
+		writeJSON(w, http.StatusNotFound, message("Not Found"))
+		return
+	}
+	var since time.Time
+	if c, ok := strings.CutPrefix(r.URL.Query().Get("created"), ">="); ok {
+		since, _ = time.Parse(time.RFC3339, c)
+	}
+	runs := s.listRuns(repo, file, since)
+	if event := r.URL.Query().Get("event"); event != "" {
+		kept := runs[:0]
+		for _, run := range runs {
+			if run.Event == event {
+				kept = append(kept, run)
+			}
+		}
+		runs = kept
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"total_count": len(runs), "workflow_runs": runs})
+}
+
+// listRuns returns the runs of repo, of one workflow file if it is set,
+// created at or after since, newest first.
+func (s *Server) listRuns(repo, file string, since time.Time) []flow.WorkflowRun {
+	now := s.now()
+	out := []flow.WorkflowRun{}
+	for i := len(s.runs) - 1; i >= 0; i-- {
+		r := s.runs[i]
+		if r.repo != repo || (file != "" && r.workflow != file) || r.run.CreatedAt.Before(since.Truncate(time.Second)) {
+			continue
+		}
+		out = append(out, r.at(now))
+	}
+	return out
+}
+
+func (s *Server) runEndpoint(w http.ResponseWriter, r *http.Request, repo, id string, rest []string) {
+	runID, _ := strconv.ParseInt(id, 10, 64)
+	run := s.findRun(runID)
+	if run == nil || run.repo != repo {
+		writeJSON(w, http.StatusNotFound, message("Not Found"))
+		return
+	}
+	now := s.now()
+	cur := run.at(now)
+	switch {
+	case len(rest) == 0 && r.Method == "GET":
+		writeJSON(w, http.StatusOK, cur)
+	case len(rest) == 1 && rest[0] == "cancel" && r.Method == "POST":
+		if cur.Completed() {
+			writeJSON(w, http.StatusConflict, message("Cannot cancel a workflow run that is completed."))
+			return
+		}
+		run.cancelled = now
+		writeJSON(w, http.StatusAccepted, struct{}{})
+	case len(rest) == 1 && rest[0] == "jobs" && r.Method == "GET":
+		job := flow.WorkflowJob{ID: run.run.ID*10 + 1, Name: "build", Status: cur.Status, Conclusion: cur.Conclusion, StartedAt: cur.RunStartedAt}
+		if cur.Completed() {
+			job.CompletedAt = cur.UpdatedAt
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"total_count": 1, "jobs": []flow.WorkflowJob{job}})
+	default:
+		writeJSON(w, http.StatusNotFound, message("Not Found"))
+	}
+}
+
+func (s *Server) now() time.Time {
+	if s.Clock != nil {
+		return s.Clock.Now()
+	}
+	return time.Now()
+}
+
+func (s *Server) findRun(id int64) *run {
+	for _, r := range s.runs {
+		if r.run.ID == id {
+			return r
+		}
+	}
+	return nil
+}
+
+// at returns the run as it is at now.
+func (r *run) at(now time.Time) flow.WorkflowRun {
+	out := r.run
+	started := out.CreatedAt.Add(r.outcome.Queued)
+	done := started.Add(r.outcome.Duration)
+	switch {
+	case !r.cancelled.IsZero() && (r.cancelled.Before(done) || r.cancelled.Equal(done)):
+		out.Status, out.Conclusion, out.UpdatedAt = "completed", "cancelled", r.cancelled.UTC()
+		if r.cancelled.After(started) {
+			out.RunStartedAt = started
+		}
+	case now.Before(started):
+		out.Status, out.UpdatedAt = "queued", out.CreatedAt
+	case now.Before(done):
+		out.Status, out.RunStartedAt, out.UpdatedAt = "in_progress", started, started
+	default:
+		out.Status, out.Conclusion, out.RunStartedAt, out.UpdatedAt = "completed", r.outcome.Conclusion, started, done
+	}
+	return out
+}
+
+func bearer(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if t, ok := strings.CutPrefix(h, "Bearer "); ok {
+		return t
+	}
+	t, _ := strings.CutPrefix(h, "token ")
+	return t
+}
+
+func message(msg string) map[string]string {
+	return map[string]string{"message": msg}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
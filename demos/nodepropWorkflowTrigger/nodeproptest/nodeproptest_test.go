@@ -0,0 +1,336 @@
+package nodeproptest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+func TestRunLifecycle(t *testing.T) {
+	outcome := nodeproptest.Outcome{Conclusion: "failure", Queued: time.Minute, Duration: 5 * time.Minute}
+	tests := []struct {
+		name           string
+		elapsed        time.Duration
+		cancelAt       time.Duration
+		complete       string
+		wantStatus     string
+		wantConclusion string
+		wantStarted    bool
+	}{
+		{name: "queued", elapsed: 30 * time.Second, wantStatus: "queued"},
+		{name: "in progress", elapsed: 2 * time.Minute, wantStatus: "in_progress", wantStarted: true},
+		{name: "completed", elapsed: 10 * time.Minute, wantStatus: "completed", wantConclusion: "failure", wantStarted: true},
+		{name: "cancelled while queued", cancelAt: 30 * time.Second, elapsed: 10 * time.Minute, wantStatus: "completed", wantConclusion: "cancelled"},
+		{name: "cancelled while running", cancelAt: 2 * time.Minute, elapsed: 10 * time.Minute, wantStatus: "completed", wantConclusion: "cancelled", wantStarted: true},
+		{name: "completed early", complete: "success", elapsed: 30 * time.Second, wantStatus: "completed", wantConclusion: "success", wantStarted: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := nodeproptest.NewServer()
+			defer gh.Close()
+			start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+			clock := nodeproptest.NewClock(start)
+			gh.Clock = clock
+			gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+			gh.SetOutcome("Cdaprod/site", "", outcome)
+			c := gh.Client()
+			ctx := context.Background()
+			if err := c.DispatchWorkflow(ctx, "Cdaprod/site", "deploy.yml", "refs/heads/main", map[string]string{flow.CorrelationInput: "d-1"}); err != nil {
+				t.Fatal(err)
+			}
+			id := gh.Dispatches()[0].RunID
+			if tt.cancelAt > 0 {
+				clock.Advance(tt.cancelAt)
+				if err := c.CancelWorkflowRun(ctx, "Cdaprod/site", id); err != nil {
+					t.Fatal(err)
+				}
+				clock.Set(start)
+			}
+			if tt.complete != "" {
+				clock.Advance(tt.elapsed)
+				if err := gh.Complete(id, tt.complete); err != nil {
+					t.Fatal(err)
+				}
+				clock.Set(start)
+			}
+			clock.Advance(tt.elapsed)
+
+			run, err := c.GetWorkflowRun(ctx, "Cdaprod/site", id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if run.Status != tt.wantStatus || run.Conclusion != tt.wantConclusion || run.RunStartedAt.IsZero() == tt.wantStarted {
+				t.Errorf("run = %s/%s started %v, want %s/%s started %v", run.Status, run.Conclusion, run.RunStartedAt, tt.wantStatus, tt.wantConclusion, tt.wantStarted)
+			}
+			if run.DisplayTitle != "deploy d-1" || run.HeadBranch != "main" || run.Event != "workflow_dispatch" || !run.CreatedAt.Equal(start) {
+				t.Errorf("run = %+v, want the dispatch's title, branch, and time", run)
+			}
+			if runs := gh.Runs("Cdaprod/site"); len(runs) != 1 || runs[0].Status != tt.wantStatus {
+				t.Errorf("Runs() = %+v", runs)
+			}
+		})
+	}
+}
+
+func TestCancelCompletedRun(t *testing.T) {
+	gh := nodeproptest.NewServer()
+	defer gh.Close()
+	gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+	c := gh.Client()
+	ctx := context.Background()
+	if err := c.DispatchWorkflow(ctx, "Cdaprod/site", "deploy.yml", "main", nil); err != nil {
+		t.Fatal(err)
+	}
+	id := gh.Dispatches()[0].RunID
+	var apiErr *flow.APIError
+	if err := c.CancelWorkflowRun(ctx, "Cdaprod/site", id); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		t.Errorf("CancelWorkflowRun() of a completed run error = %v, want 409", err)
+	}
+	if err := gh.Complete(id+100, "success"); err == nil {
+		t.Error("Complete() of an unknown run succeeded")
+	}
+	if jobs, err := c.ListRunJobs(ctx, "Cdaprod/site", id); err != nil || len(jobs) != 1 || jobs[0].Conclusion != "success" || jobs[0].CompletedAt.IsZero() {
+		t.Errorf("ListRunJobs() = %+v, %v", jobs, err)
+	}
+	if _, err := c.GetWorkflowRun(ctx, "Cdaprod/other", id); !flow.IsNotFound(err) {
+		t.Errorf("GetWorkflowRun() in another repository error = %v, want not found", err)
+	}
+}
+
+func TestDispatchEndpoints(t *testing.T) {
+	tests := []struct {
+		name       string
+		dispatch   func(*flow.GitHubClient) error
+		runName    func(nodeproptest.Dispatch) string
+		wantStatus int
+		want       nodeproptest.Dispatch
+		wantTitle  string
+	}{
+		{
+			name: "workflow dispatch",
+			dispatch: func(c *flow.GitHubClient) error {
+				return c.DispatchWorkflow(context.Background(), "Cdaprod/site", "deploy.yml", "main", map[string]string{"env": "prod"})
+			},
+			want:      nodeproptest.Dispatch{Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "main", Inputs: map[string]string{"env": "prod"}},
+			wantTitle: "deploy",
+		},
+		{
+			name: "dispatch by workflow ID",
+			dispatch: func(c *flow.GitHubClient) error {
+				return c.DispatchWorkflow(context.Background(), "Cdaprod/site", "1001", "main", nil)
+			},
+			want:      nodeproptest.Dispatch{Repo: "Cdaprod/site", Workflow: "1001", Ref: "main"},
+			wantTitle: "deploy",
+		},
+		{
+			name: "run name",
+			dispatch: func(c *flow.GitHubClient) error {
+				return c.DispatchWorkflow(context.Background(), "Cdaprod/site", "deploy.yml", "main", map[string]string{"env": "prod"})
+			},
+			runName:   func(d nodeproptest.Dispatch) string { return "Deploy to " + d.Inputs["env"] },
+			want:      nodeproptest.Dispatch{Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "main", Inputs: map[string]string{"env": "prod"}},
+			wantTitle: "Deploy to prod",
+		},
+		{
+			name: "repository dispatch",
+			dispatch: func(c *flow.GitHubClient) error {
+				return c.RepositoryDispatch(context.Background(), "Cdaprod/site", "release", map[string]interface{}{"version": 2, "name": "x"})
+			},
+			want: nodeproptest.Dispatch{Repo: "Cdaprod/site", EventType: "release", Inputs: map[string]string{"version": "2", "name": "x"}},
+		},
+		{
+			name: "unknown workflow",
+			dispatch: func(c *flow.GitHubClient) error {
+				return c.DispatchWorkflow(context.Background(), "Cdaprod/site", "missing.yml", "main", nil)
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "unknown repository",
+			dispatch: func(c *flow.GitHubClient) error {
+				return c.DispatchWorkflow(context.Background(), "Cdaprod/other", "deploy.yml", "main", nil)
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "no ref",
+			dispatch: func(c *flow.GitHubClient) error {
+				return c.DispatchWorkflow(context.Background(), "Cdaprod/site", "deploy.yml", "", nil)
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := nodeproptest.NewServer()
+			defer gh.Close()
+			gh.RunName = tt.runName
+			gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+			err := tt.dispatch(gh.Client())
+			if tt.wantStatus != 0 {
+				var apiErr *flow.APIError
+				if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.wantStatus {
+					t.Errorf("error = %v, want %d", err, tt.wantStatus)
+				}
+				if n := len(gh.Dispatches()); n != 0 {
+					t.Errorf("%d dispatches recorded, want none", n)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			ds := gh.Dispatches()
+			if len(ds) != 1 {
+				t.Fatalf("dispatches = %+v", ds)
+			}
+			d := ds[0]
+			if d.Repo != tt.want.Repo || d.Workflow != tt.want.Workflow || d.EventType != tt.want.EventType || d.Ref != tt.want.Ref || d.Token != nodeproptest.DefaultToken || d.At.IsZero() {
+				t.Errorf("dispatch = %+v, want %+v", d, tt.want)
+			}
+			for k, v := range tt.want.Inputs {
+				if d.Inputs[k] != v {
+					t.Errorf("inputs = %v, want %v", d.Inputs, tt.want.Inputs)
+				}
+			}
+			if tt.wantTitle == "" {
+				if d.RunID != 0 || len(gh.Runs("Cdaprod/site")) != 0 {
+					t.Errorf("repository_dispatch started run %d", d.RunID)
+				}
+				return
+			}
+			if runs := gh.Runs("Cdaprod/site"); len(runs) != 1 || runs[0].ID != d.RunID || runs[0].DisplayTitle != tt.wantTitle {
+				t.Errorf("runs = %+v, want run %d titled %q", runs, d.RunID, tt.wantTitle)
+			}
+		})
+	}
+}
+
+func TestFaults(t *testing.T) {
+	tests := []struct {
+		name        string
+		fault       nodeproptest.Fault
+		wantErrs    int
+		wantStatus  int
+		wantBody    string
+		wantRetry   string
+		wantLatency time.Duration
+	}{
+		{name: "once", fault: nodeproptest.Fault{Path: "/repos/*/*/actions/workflows/*/dispatches", Status: http.StatusBadGateway, Times: 1}, wantErrs: 1, wantStatus: http.StatusBadGateway},
+		{name: "always", fault: nodeproptest.Fault{Method: "post", Status: http.StatusInternalServerError}, wantErrs: 3, wantStatus: http.StatusInternalServerError},
+		{name: "other method", fault: nodeproptest.Fault{Method: "GET", Status: http.StatusInternalServerError}},
+		{name: "other path", fault: nodeproptest.Fault{Path: "/repos/*/*/dispatches", Status: http.StatusInternalServerError}},
+		{
+			name: "rate limited", fault: nodeproptest.Fault{Status: http.StatusForbidden, Body: `{"message": "API rate limit exceeded"}`, RetryAfter: 1500 * time.Millisecond, Times: 2},
+			wantErrs: 2, wantStatus: http.StatusForbidden, wantBody: "API rate limit exceeded", wantRetry: "2",
+		},
+		{name: "latency", fault: nodeproptest.Fault{Latency: 20 * time.Millisecond, Times: 1}, wantLatency: 20 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := nodeproptest.NewServer()
+			defer gh.Close()
+			gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+			gh.Inject(tt.fault)
+			c := gh.Client()
+			c.RateLimitFloor = -1
+			errs := 0
+			start := time.Now()
+			for i := 0; i < 3; i++ {
+				err := c.DispatchWorkflow(context.Background(), "Cdaprod/site", "deploy.yml", "main", nil)
+				if err == nil {
+					continue
+				}
+				errs++
+				var apiErr *flow.APIError
+				if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.wantStatus || !strings.Contains(apiErr.Body, tt.wantBody) {
+					t.Errorf("error = %v, want %d with %q", err, tt.wantStatus, tt.wantBody)
+				}
+			}
+			if errs != tt.wantErrs {
+				t.Errorf("%d of 3 requests failed, want %d", errs, tt.wantErrs)
+			}
+			if elapsed := time.Since(start); elapsed < tt.wantLatency {
+				t.Errorf("requests took %v, want at least %v", elapsed, tt.wantLatency)
+			}
+			if n := len(gh.Requests()); n != 3 {
+				t.Errorf("%d requests recorded, want 3 with faults included", n)
+			}
+			if n := len(gh.Dispatches()); n != 3-tt.wantErrs {
+				t.Errorf("%d dispatches, want %d", n, 3-tt.wantErrs)
+			}
+		})
+	}
+}
+
+func TestFaultRetryAfter(t *testing.T) {
+	gh := nodeproptest.NewServer()
+	defer gh.Close()
+	gh.Inject(nodeproptest.Fault{Status: http.StatusTooManyRequests, RetryAfter: 1500 * time.Millisecond})
+	resp, err := http.Get(gh.URL + "/rate_limit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "2" {
+		t.Errorf("response = %d with Retry-After %q, want 429 after 2 seconds", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	gh.ClearFaults()
+	if resp, err := http.Get(gh.URL + "/rate_limit"); err != nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("GET without a token after ClearFaults() = %v, %v; want 401", resp, err)
+	}
+}
+
+func TestServerAuth(t *testing.T) {
+	tests := []struct {
+		name        string
+		serverToken string
+		clientToken string
+		wantErr     bool
+	}{
+		{name: "default token", serverToken: nodeproptest.DefaultToken, clientToken: nodeproptest.DefaultToken},
+		{name: "bad credentials", serverToken: nodeproptest.DefaultToken, clientToken: "ghp_other", wantErr: true},
+		{name: "any token", clientToken: "ghp_other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := nodeproptest.NewServer()
+			defer gh.Close()
+			gh.Token = tt.serverToken
+			gh.Scopes = []string{"repo", "workflow"}
+			c := gh.Client()
+			c.Token = tt.clientToken
+			info, err := c.TokenInfo(context.Background())
+			if tt.wantErr {
+				var apiErr *flow.APIError
+				if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+					t.Errorf("TokenInfo() error = %v, want 401", err)
+				}
+				return
+			}
+			if err != nil || info.Login != "nodeproptest" || strings.Join(info.Scopes, ",") != "repo,workflow" {
+				t.Errorf("TokenInfo() = %+v, %v", info, err)
+			}
+		})
+	}
+}
+
+func TestRateLimitCountsDown(t *testing.T) {
+	gh := nodeproptest.NewServer()
+	defer gh.Close()
+	gh.RateLimit = 3
+	c := gh.Client()
+	c.RateLimitFloor = -1
+	for _, want := range []int{2, 1, 0, 0} {
+		rl, err := c.RateLimit(context.Background())
+		if err != nil || rl.Remaining != want || rl.Limit != 5000 {
+			t.Errorf("RateLimit() = %+v, %v; want %d remaining", rl, err, want)
+		}
+	}
+}
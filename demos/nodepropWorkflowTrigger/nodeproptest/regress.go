@@ -0,0 +1,131 @@
+package nodeproptest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// BenchResult is the outcome of one benchmark. Its JSON is the output of
+// nodeprop bench -o json, so a saved run serves as a baseline.
+type BenchResult struct {
+	Name        string  `json:"name" yaml:"name"`
+	N           int     `json:"n" yaml:"n"`
+	NsPerOp     int64   `json:"ns_per_op" yaml:"ns_per_op"`
+	BytesPerOp  int64   `json:"bytes_per_op" yaml:"bytes_per_op"`
+	AllocsPerOp int64   `json:"allocs_per_op" yaml:"allocs_per_op"`
+	PerSecond   float64 `json:"dispatches_per_second,omitempty" yaml:"dispatches_per_second,omitempty"`
+}
+
+// Run runs bm with testing.Benchmark. It returns an error if bm failed.
+func (bm Benchmark) Run() (BenchResult, error) {
+	r := testing.Benchmark(bm.F)
+	if r.N == 0 {
+		return BenchResult{}, fmt.Errorf("benchmark %s failed", bm.Name)
+	}
+	return BenchResult{
+		Name:        bm.Name,
+		N:           r.N,
+		NsPerOp:     r.NsPerOp(),
+		BytesPerOp:  r.AllocedBytesPerOp(),
+		AllocsPerOp: r.AllocsPerOp(),
+		PerSecond:   r.Extra["dispatches/s"],
+	}, nil
+}
+
+// LoadBenchResults reads a baseline saved with nodeprop bench -o json.
+func LoadBenchResults(path string) ([]BenchResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var results []BenchResult
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return results, nil
+}
+
+// Thresholds bound how far benchmark results may regress from a baseline,
+// as fractions: 0.2 allows 20% more. A negative threshold disables the
+// check.
+type Thresholds struct {
+	Time   float64 `json:"time" yaml:"time"`
+	Bytes  float64 `json:"bytes" yaml:"bytes"`
+	Allocs float64 `json:"allocs" yaml:"allocs"`
+}
+
+// DefaultThresholds tolerate the noise of timing on a shared machine, and
+// little change in allocations, which are steady between runs.
+var DefaultThresholds = Thresholds{Time: 0.25, Bytes: 0.10, Allocs: 0.10}
+
+// Regression is a benchmark result beyond its threshold.
+type Regression struct {
+	Name     string  `json:"name" yaml:"name"`
+	Metric   string  `json:"metric" yaml:"metric"`
+	Baseline float64 `json:"baseline" yaml:"baseline"`
+	Current  float64 `json:"current" yaml:"current"`
+}
+
+func (r Regression) String() string {
+	if r.Baseline == 0 {
+		return fmt.Sprintf("%s: %s went from 0 to %g", r.Name, r.Metric, r.Current)
+	}
+	return fmt.Sprintf("%s: %s went from %g to %g (%+.0f%%)", r.Name, r.Metric, r.Baseline, r.Current, (r.Current/r.Baseline-1)*100)
+}
+
+// CompareBenchmarks returns the results of current that regressed from
+// baseline beyond t. Benchmarks missing from either are not compared.
+// Any allocation where the baseline had none is a regression.
+func CompareBenchmarks(baseline, current []BenchResult, t Thresholds) []Regression {
+	base := make(map[string]BenchResult, len(baseline))
+	for _, r := range baseline {
+		base[r.Name] = r
+	}
+	var out []Regression
+	for _, cur := range current {
+		old, ok := base[cur.Name]
+		if !ok {
+			continue
+		}
+		check := func(metric string, was, now int64, limit float64) {
+			if limit >= 0 && now > was && float64(now) > float64(was)*(1+limit) {
+				out = append(out, Regression{Name: cur.Name, Metric: metric, Baseline: float64(was), Current: float64(now)})
+			}
+		}
+		check("ns/op", old.NsPerOp, cur.NsPerOp, t.Time)
+		check("B/op", old.BytesPerOp, cur.BytesPerOp, t.Bytes)
+		check("allocs/op", old.AllocsPerOp, cur.AllocsPerOp, t.Allocs)
+	}
+	return out
+}
+
+// CheckBenchmarks runs Benchmarks and fails tb for each result that
+// regressed from the baseline at path beyond t, for a test that keeps
+// performance from slipping:
+//
+//	func TestPerformance(t *testing.T) {
+//		if testing.Short() {
+//			t.Skip("runs the benchmarks")
+//		}
+//		nodeproptest.CheckBenchmarks(t, "testdata/bench.json", nodeproptest.DefaultThresholds)
+//	}
+func CheckBenchmarks(tb testing.TB, path string, t Thresholds) {
+	tb.Helper()
+	baseline, err := LoadBenchResults(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	var current []BenchResult
+	for _, bm := range Benchmarks {
+		r, err := bm.Run()
+		if err != nil {
+			tb.Fatal(err)
+		}
+		current = append(current, r)
+	}
+	for _, r := range CompareBenchmarks(baseline, current, t) {
+		tb.Error(r)
+	}
+}
@@ -0,0 +1,676 @@
+package nodeproptest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// DefaultMaxDispatches bounds a simulation whose rules keep triggering
+// each other.
+const DefaultMaxDispatches = 100
+
+// DefaultRunDuration is how long a simulated run takes if its Outcome has
+// no Duration.
+const DefaultRunDuration = time.Minute
+
+// Conclusions of simulated steps that did not produce a run.
+const (
+	// ConclusionSkipped is a flow step whose needs did not all succeed.
+	ConclusionSkipped = "skipped"
+	// ConclusionHeld is a dispatch held for approval by the registry.
+	ConclusionHeld = "held"
+	// ConclusionSent is a repository_dispatch step, or one of another
+	// provider such as webhook, which starts no run of its own.
+	ConclusionSent = "sent"
+	// ConclusionOmitted is a flow step whose when expression was false.
+	ConclusionOmitted = "omitted"
+)
+
+// Simulation plays out a flow or an event the way the dispatcher would,
+// entirely in-process: routing rules and the registry decide what to
+// dispatch, a real RunCorrelator dispatches it to a fake GitHub (Server),
+// and runs complete on a fake clock with the configured outcomes. Each
+// completed run is routed through the rules again as a workflow_run event,
+// as GitHub would deliver it, so chains of workflows happen in order.
+// Nothing reaches GitHub and no real time passes, which makes it a way to
+// check an orchestration before touching real repositories.
+type Simulation struct {
+	// Registry, if set, resolves selectors and fan-out dependents, and
+	// holds dispatches to repositories that require approval.
+	Registry *flow.RepositoryRegistry
+	Rules    []flow.RoutingRule
+	// Outcomes decides how runs end, keyed by flow step name, by
+	// repository and workflow file (Cdaprod/site/deploy.yml), or by
+	// repository, in that order. Runs without one get Default.
+	Outcomes map[string]Outcome
+	Default  Outcome
+	// MaxDispatches stops a simulation after this many dispatches; 0
+	// means DefaultMaxDispatches.
+	MaxDispatches int
+	// Start is the simulated time the simulation begins; zero means now.
+	Start time.Time
+	// FlowEvent is the event the when expressions of a flow's steps see.
+	FlowEvent flow.InboundEvent
+}
+
+// SimulatedRun is one dispatch of a simulation, or a flow step skipped.
+type SimulatedRun struct {
+	// Step is the flow step, or empty for a dispatch made by a rule.
+	Step string `json:"step,omitempty" yaml:"step,omitempty"`
+	// Rule is the routing rule that made the dispatch, if any.
+	Rule      string            `json:"rule,omitempty" yaml:"rule,omitempty"`
+	Repo      string            `json:"repo" yaml:"repo"`
+	Workflow  string            `json:"workflow,omitempty" yaml:"workflow,omitempty"`
+	EventType string            `json:"event_type,omitempty" yaml:"event_type,omitempty"`
+	Ref       string            `json:"ref,omitempty" yaml:"ref,omitempty"`
+	Inputs    map[string]string `json:"inputs,omitempty" yaml:"inputs,omitempty"`
+	// Cause is what led to the dispatch: the event, the run whose
+	// completion a rule matched, or the steps a flow step needed.
+	Cause        string    `json:"cause,omitempty" yaml:"cause,omitempty"`
+	DispatchedAt time.Time `json:"dispatched_at,omitempty" yaml:"dispatched_at,omitempty"`
+	StartedAt    time.Time `json:"started_at,omitempty" yaml:"started_at,omitempty"`
+	CompletedAt  time.Time `json:"completed_at,omitempty" yaml:"completed_at,omitempty"`
+	// Conclusion is the run's, dispatch_failed, or one of
+	// ConclusionSkipped, ConclusionHeld, ConclusionSent, and
+	// ConclusionOmitted.
+	Conclusion string `json:"conclusion" yaml:"conclusion"`
+	Error      string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// Succeeded reports whether the run, or a repository_dispatch step, went
+// as it should. An omitted step did too.
+func (r SimulatedRun) Succeeded() bool {
+	return r.Conclusion == "success" || r.Conclusion == ConclusionSent || r.Conclusion == ConclusionOmitted
+}
+
+// SimulationReport is what a simulation did, in the order it happened.
+type SimulationReport struct {
+	Start time.Time      `json:"start" yaml:"start"`
+	End   time.Time      `json:"end" yaml:"end"`
+	Runs  []SimulatedRun `json:"runs" yaml:"runs"`
+}
+
+// Unsuccessful returns the runs and steps that did not succeed.
+func (r *SimulationReport) Unsuccessful() []SimulatedRun {
+	var out []SimulatedRun
+	for _, run := range r.Runs {
+		if !run.Succeeded() {
+			out = append(out, run)
+		}
+	}
+	return out
+}
+
+// RunFlow simulates def: its steps are dispatched once the steps they need
+// have succeeded, and skipped if any did not. A fan-out step is dispatched
+// to each repository its selector matches in Registry and concludes as its
+// fan-in says. Failure handlers and the compensations of a failed saga are
+// dispatched together rather than one after another.
+func (s *Simulation) RunFlow(ctx context.Context, def *flow.FlowDefinition) (*SimulationReport, error) {
+	g, err := flow.CompileFlow(def)
+	if err != nil {
+		return nil, err
+	}
+	g.Registry = s.Registry
+	sim, err := s.start()
+	if err != nil {
+		return nil, err
+	}
+	defer sim.close()
+	sim.def, sim.graph, sim.steps, sim.fanIns = def, g, map[string]string{}, map[string]*fanIn{}
+	if err := sim.startSteps(ctx); err != nil {
+		return sim.report, err
+	}
+	return sim.run(ctx)
+}
+
+// RunEvent simulates ev arriving at the webhook: the dispatches the rules
+// route it to, and those the completions of their runs lead to.
+func (s *Simulation) RunEvent(ctx context.Context, ev flow.InboundEvent) (*SimulationReport, error) {
+	sim, err := s.start()
+	if err != nil {
+		return nil, err
+	}
+	defer sim.close()
+	cause := ev.Type
+	if ev.Action != "" {
+		cause += "." + ev.Action
+	}
+	cause += " from " + ev.Repo
+	if ev.Branch != "" {
+		cause += " (" + ev.Branch + ")"
+	}
+	if err := sim.route(ctx, ev, cause); err != nil {
+		return sim.report, err
+	}
+	return sim.run(ctx)
+}
+
+// simulation is the state of one run of a Simulation.
+type simulation struct {
+	*Simulation
+	dir        string
+	gh         *Server
+	clock      *Clock
+	c          *flow.RunCorrelator
+	router     *flow.EventRouter
+	report     *SimulationReport
+	inflight   []inflight
+	dispatched int
+
+	def   *flow.FlowDefinition
+	graph *flow.FlowGraph
+	// steps maps each flow step started to its conclusion, or to "" while
+	// it runs.
+	steps map[string]string
+	// fanIns counts the runs of the fan-out steps.
+	fanIns map[string]*fanIn
+	// succeeded lists the steps that succeeded, in order, for a saga to
+	// compensate once aborted.
+	succeeded   []string
+	aborted     bool
+	compensated bool
+}
+
+// fanIn is the progress of a fan-out step's runs.
+type fanIn struct {
+	need, total       int
+	succeeded, failed int
+	decided           bool
+}
+
+// inflight is a dispatch whose run has not completed.
+type inflight struct {
+	run int
+	rec flow.DispatchRecord
+}
+
+func (s *Simulation) start() (*simulation, error) {
+	dir, err := os.MkdirTemp("", "nodeprop-simulation")
+	if err != nil {
+		return nil, err
+	}
+	start := s.Start
+	if start.IsZero() {
+		start = time.Now().UTC().Truncate(time.Second)
+	}
+	clock := NewClock(start)
+	gh := NewServer()
+	gh.Clock = clock
+	c := flow.NewRunCorrelator(gh.Client(), flow.NewFileHistoryStore(filepath.Join(dir, "history.jsonl")))
+	c.Clock, c.Client.Clock = clock, clock
+	c.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	c.Actor = "simulation"
+	if s.Registry != nil {
+		for _, e := range s.Registry.Repos() {
+			gh.AddWorkflow(e.Name, e.Workflows...)
+		}
+		c.Approvals = flow.NewFileApprovalStore(filepath.Join(dir, "approvals.json"))
+		c.ApprovalPolicy = s.Registry
+	}
+	return &simulation{
+		Simulation: s,
+		dir:        dir,
+		gh:         gh,
+		clock:      clock,
+		c:          c,
+		router:     &flow.EventRouter{Rules: s.Rules, Registry: s.Registry},
+		report:     &SimulationReport{Start: start},
+	}, nil
+}
+
+func (sim *simulation) close() {
+	sim.report.End = sim.clock.Now()
+	sim.gh.Close()
+	os.RemoveAll(sim.dir)
+}
+
+// run resolves the dispatches in flight, moving the clock to the next
+// change of a run whenever none has completed, until every run has.
+func (sim *simulation) run(ctx context.Context) (*SimulationReport, error) {
+	for len(sim.inflight) > 0 {
+		progressed := false
+		for i := 0; i < len(sim.inflight); {
+			f := sim.inflight[i]
+			rec, err := sim.c.Resolve(ctx, f.rec)
+			if err != nil {
+				return sim.report, err
+			}
+			if !rec.Completed() {
+				sim.inflight[i].rec = rec
+				i++
+				continue
+			}
+			sim.inflight = append(sim.inflight[:i], sim.inflight[i+1:]...)
+			r := &sim.report.Runs[f.run]
+			r.StartedAt, r.CompletedAt, r.Conclusion = rec.RunStartedAt, rec.UpdatedAt, rec.Conclusion
+			progressed = true
+			if err := sim.completed(ctx, f.run); err != nil {
+				return sim.report, err
+			}
+		}
+		if progressed {
+			continue
+		}
+		next, ok := sim.gh.nextChange()
+		if !ok {
+			return sim.report, fmt.Errorf("simulation stalled with %d runs that never complete", len(sim.inflight))
+		}
+		sim.clock.Set(next)
+	}
+	return sim.report, nil
+}
+
+// completed follows up the run at index i: the flow steps waiting on it
+// and the rules matching its workflow_run event.
+func (sim *simulation) completed(ctx context.Context, i int) error {
+	run := sim.report.Runs[i]
+	if conclusion, ok := sim.conclude(run); ok {
+		sim.steps[run.Step] = conclusion
+		// Handlers neither count for compensation nor abort a saga.
+		if step, ok := sim.flowStep(run.Step); ok {
+			switch {
+			case conclusion == "success" || conclusion == ConclusionSent:
+				sim.succeeded = append(sim.succeeded, run.Step)
+			case !step.ContinueOnError && sim.graph.Saga():
+				sim.aborted = true
+			}
+		}
+		if err := sim.handle(ctx, run.Step, conclusion); err != nil {
+			return err
+		}
+		if err := sim.startSteps(ctx); err != nil {
+			return err
+		}
+	}
+	if run.Workflow == "" || run.Conclusion == ConclusionHeld || run.Conclusion == flow.ConclusionDispatchFailed {
+		return nil
+	}
+	name := strings.TrimSuffix(strings.TrimSuffix(run.Workflow, ".yml"), ".yaml")
+	ev := flow.InboundEvent{
+		Type:   "workflow_run",
+		Action: "completed",
+		Repo:   run.Repo,
+		Branch: run.Ref,
+		Payload: map[string]interface{}{
+			"action": "completed",
+			"workflow_run": map[string]interface{}{
+				"name":        name,
+				"path":        ".github/workflows/" + run.Workflow,
+				"event":       "workflow_dispatch",
+				"status":      "completed",
+				"conclusion":  run.Conclusion,
+				"head_branch": run.Ref,
+			},
+			"repository": map[string]interface{}{"full_name": run.Repo},
+		},
+	}
+	return sim.route(ctx, ev, fmt.Sprintf("%s %s completed (%s)", run.Repo, run.Workflow, run.Conclusion))
+}
+
+// route dispatches what the rules route ev to.
+func (sim *simulation) route(ctx context.Context, ev flow.InboundEvent, cause string) error {
+	routed, err := sim.router.Route(ev)
+	if err != nil {
+		return err
+	}
+	for _, d := range routed {
+		run := SimulatedRun{Rule: d.Rule, Repo: d.Repo, Workflow: d.Workflow, Ref: d.Ref, Inputs: d.Inputs, Cause: cause}
+		if err := sim.dispatch(ctx, run); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startSteps dispatches the flow steps whose needs have all succeeded and
+// skips those with a need that did not.
+func (sim *simulation) startSteps(ctx context.Context) error {
+	if sim.def == nil {
+		return nil
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, step := range sim.def.Steps {
+			if _, started := sim.steps[step.Name]; started {
+				continue
+			}
+			if sim.aborted {
+				run := newStepRun(step)
+				run.Conclusion, run.Cause = ConclusionSkipped, "the flow failed"
+				sim.steps[step.Name] = ConclusionSkipped
+				sim.report.Runs = append(sim.report.Runs, run)
+				continue
+			}
+			ready, failed := true, ""
+			for _, need := range step.Needs {
+				conclusion, started := sim.steps[need]
+				switch {
+				case !started || conclusion == "":
+					ready = false
+				case conclusion != "success" && conclusion != ConclusionSent && conclusion != ConclusionOmitted && !sim.defStep(need).ContinueOnError:
+					failed = need + " " + conclusion
+				}
+			}
+			run := newStepRun(step)
+			run.Cause = "flow " + sim.def.Name
+			if len(step.Needs) > 0 {
+				run.Cause = "needs " + strings.Join(step.Needs, ", ")
+			}
+			switch {
+			case failed != "":
+				run.Conclusion, run.Cause = ConclusionSkipped, "needs "+failed
+				sim.steps[step.Name] = ConclusionSkipped
+				sim.report.Runs = append(sim.report.Runs, run)
+			case ready && !sim.when(step, &run):
+				sim.steps[step.Name] = run.Conclusion
+				sim.report.Runs = append(sim.report.Runs, run)
+				sim.aborted = sim.aborted || (run.Conclusion != ConclusionOmitted && sim.graph.Saga())
+			case ready:
+				if err := sim.send(ctx, step, run); err != nil {
+					return err
+				}
+			default:
+				continue
+			}
+			changed = true
+		}
+	}
+	return sim.compensate(ctx)
+}
+
+// compensate dispatches the compensations of an aborted saga once no step
+// runs any more, for the steps that succeeded in reverse order.
+func (sim *simulation) compensate(ctx context.Context) error {
+	if !sim.aborted || sim.compensated {
+		return nil
+	}
+	for _, step := range sim.def.Steps {
+		if sim.steps[step.Name] == "" {
+			return nil
+		}
+	}
+	sim.compensated = true
+	for i := len(sim.succeeded) - 1; i >= 0; i-- {
+		step := sim.defStep(sim.succeeded[i])
+		if step.Compensate == "" {
+			continue
+		}
+		handler := sim.defStep(step.Compensate)
+		run := newStepRun(handler)
+		run.Cause = "compensating " + step.Name
+		if err := sim.send(ctx, handler, run); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newStepRun returns the run of step, not yet sent.
+func newStepRun(step flow.FlowStep) SimulatedRun {
+	run := SimulatedRun{Step: step.Name, Repo: step.Repo, Ref: step.Ref, Inputs: step.Inputs}
+	if step.Provider == flow.ProviderRepositoryDispatch {
+		run.EventType = step.EventType
+	} else {
+		run.Workflow = step.Workflow
+	}
+	if run.Ref == "" {
+		run.Ref = "main"
+	}
+	if step.FanOut != nil {
+		run.Repo = step.FanOut.Selector
+	}
+	return run
+}
+
+// send dispatches run, the run of step or of a failure handler, as its
+// provider would.
+func (sim *simulation) send(ctx context.Context, step flow.FlowStep, run SimulatedRun) error {
+	switch {
+	case step.FanOut != nil:
+		return sim.fanOut(ctx, step, run)
+	case step.Provider != flow.ProviderWorkflowDispatch && step.Provider != flow.ProviderRepositoryDispatch:
+		run.DispatchedAt = sim.clock.Now()
+		run.Conclusion, run.CompletedAt = ConclusionSent, run.DispatchedAt
+		sim.report.Runs = append(sim.report.Runs, run)
+		return sim.completed(ctx, len(sim.report.Runs)-1)
+	}
+	sim.steps[step.Name] = ""
+	return sim.dispatch(ctx, run)
+}
+
+// defStep returns the flow step or handler called name.
+func (sim *simulation) defStep(name string) flow.FlowStep {
+	if s, ok := sim.flowStep(name); ok {
+		return s
+	}
+	for _, h := range sim.def.Handlers {
+		if h.Name == name {
+			return h
+		}
+	}
+	return flow.FlowStep{}
+}
+
+// flowStep returns the flow step called name, if it is not a handler.
+func (sim *simulation) flowStep(name string) (flow.FlowStep, bool) {
+	for _, s := range sim.def.Steps {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return flow.FlowStep{}, false
+}
+
+// handle runs the failure handlers of the step called name, which
+// concluded with conclusion, if it failed.
+func (sim *simulation) handle(ctx context.Context, name, conclusion string) error {
+	step := sim.defStep(name)
+	if step.OnFailure == nil || conclusion == "success" || conclusion == ConclusionSent {
+		return nil
+	}
+	for _, h := range step.OnFailure.Run {
+		handler := sim.defStep(h)
+		run := newStepRun(handler)
+		run.Cause = "on_failure of " + name
+		if err := sim.send(ctx, handler, run); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// when evaluates the when expression of step, and if it does not hold
+// concludes run as omitted, or failed if it could not be evaluated.
+func (sim *simulation) when(step flow.FlowStep, run *SimulatedRun) bool {
+	ok, err := sim.graph.When(step.Name, flow.ConditionEnv{Event: sim.FlowEvent, Steps: sim.stepStates(), Registry: sim.Registry})
+	switch {
+	case err != nil:
+		run.Conclusion, run.Error = "failure", err.Error()
+	case !ok:
+		run.Conclusion, run.Cause = ConclusionOmitted, "when is false"
+	default:
+		return true
+	}
+	run.DispatchedAt, run.CompletedAt = sim.clock.Now(), sim.clock.Now()
+	return false
+}
+
+// stepStates returns the flow steps as a FlowGraph would see them.
+func (sim *simulation) stepStates() []flow.StepState {
+	var states []flow.StepState
+	for _, step := range sim.def.Steps {
+		st := flow.StepState{Name: step.Name, Status: flow.StepPending}
+		conclusion, started := sim.steps[step.Name]
+		switch {
+		case !started:
+		case conclusion == "":
+			st.Status = flow.StepRunning
+		case conclusion == "success" || conclusion == ConclusionSent:
+			st.Status = flow.StepSucceeded
+		case conclusion == ConclusionSkipped:
+			st.Status = flow.StepSkipped
+		case conclusion == ConclusionOmitted:
+			st.Status = flow.StepOmitted
+		default:
+			st.Status = flow.StepFailed
+		}
+		for _, r := range sim.report.Runs {
+			if r.Step == step.Name {
+				st.Runs = append(st.Runs, flow.StepRun{Repo: r.Repo, Conclusion: r.Conclusion})
+			}
+		}
+		states = append(states, st)
+	}
+	return states
+}
+
+// fanOut dispatches run to every repository the selector of step matches.
+func (sim *simulation) fanOut(ctx context.Context, step flow.FlowStep, run SimulatedRun) error {
+	if sim.Registry == nil {
+		return fmt.Errorf("step %s: fan_out needs a registry", step.Name)
+	}
+	entries, err := sim.Registry.Select(step.FanOut.Selector)
+	if err != nil {
+		return fmt.Errorf("step %s: %w", step.Name, err)
+	}
+	fi := &fanIn{need: step.FanOut.Needed(len(entries)), total: len(entries)}
+	sim.fanIns[step.Name] = fi
+	if len(entries) == 0 || fi.need > fi.total {
+		fi.decided = true
+		run.Conclusion = flow.ConclusionDispatchFailed
+		run.Error = fmt.Sprintf("selector matches %d repositories, %d needed", len(entries), fi.need)
+		sim.steps[step.Name] = run.Conclusion
+		sim.report.Runs = append(sim.report.Runs, run)
+		return nil
+	}
+	sim.steps[step.Name] = ""
+	for _, e := range entries {
+		r := run
+		r.Repo = e.Name
+		if err := sim.dispatch(ctx, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// conclude returns the conclusion of the flow step of run once it has
+// one: the run's own, or for a fan-out step, success once enough of its
+// runs have succeeded and failure once too many have not.
+func (sim *simulation) conclude(run SimulatedRun) (string, bool) {
+	if run.Step == "" {
+		return "", false
+	}
+	fi := sim.fanIns[run.Step]
+	if fi == nil {
+		return run.Conclusion, true
+	}
+	if fi.decided {
+		return "", false
+	}
+	if run.Succeeded() {
+		fi.succeeded++
+	} else {
+		fi.failed++
+	}
+	switch {
+	case fi.succeeded >= fi.need:
+		fi.decided = true
+		return "success", true
+	case fi.total-fi.failed < fi.need:
+		fi.decided = true
+		return "failure", true
+	}
+	return "", false
+}
+
+// dispatch submits run, or sends it as a repository_dispatch event.
+func (sim *simulation) dispatch(ctx context.Context, run SimulatedRun) error {
+	limit := sim.MaxDispatches
+	if limit <= 0 {
+		limit = DefaultMaxDispatches
+	}
+	if sim.dispatched >= limit {
+		return fmt.Errorf("stopped after %d dispatches; do rules trigger each other in a loop?", limit)
+	}
+	sim.dispatched++
+	run.DispatchedAt = sim.clock.Now()
+
+	if run.EventType != "" {
+		run.Conclusion, run.CompletedAt = ConclusionSent, run.DispatchedAt
+		sim.report.Runs = append(sim.report.Runs, run)
+		ev := flow.InboundEvent{
+			Type:    "repository_dispatch",
+			Action:  run.EventType,
+			Repo:    run.Repo,
+			Branch:  run.Ref,
+			Payload: map[string]interface{}{"action": run.EventType, "branch": run.Ref, "repository": map[string]interface{}{"full_name": run.Repo}},
+		}
+		if err := sim.completed(ctx, len(sim.report.Runs)-1); err != nil {
+			return err
+		}
+		return sim.route(ctx, ev, "repository_dispatch."+run.EventType+" to "+run.Repo)
+	}
+
+	sim.gh.AddWorkflow(run.Repo, run.Workflow)
+	sim.gh.SetOutcome(run.Repo, run.Workflow, sim.outcome(run))
+	rec, err := sim.c.Submit(ctx, flow.DispatchRequest{Repo: run.Repo, Workflow: run.Workflow, Ref: run.Ref, Inputs: run.Inputs})
+	var held *flow.ApprovalRequiredError
+	switch {
+	case errors.As(err, &held):
+		run.Conclusion = ConclusionHeld
+	case err != nil:
+		run.Conclusion, run.Error = flow.ConclusionDispatchFailed, err.Error()
+	default:
+		sim.report.Runs = append(sim.report.Runs, run)
+		sim.inflight = append(sim.inflight, inflight{run: len(sim.report.Runs) - 1, rec: *rec})
+		return nil
+	}
+	sim.report.Runs = append(sim.report.Runs, run)
+	return sim.completed(ctx, len(sim.report.Runs)-1)
+}
+
+// outcome looks up how run ends.
+func (sim *simulation) outcome(run SimulatedRun) Outcome {
+	o := sim.Default
+	for _, key := range []string{run.Step, run.Repo + "/" + run.Workflow, run.Repo} {
+		if e, ok := sim.Outcomes[key]; ok && key != "" {
+			o = e
+			break
+		}
+	}
+	if o.Duration <= 0 {
+		o.Duration = DefaultRunDuration
+	}
+	return o
+}
+
+// nextChange returns the next time a run changes state.
+func (s *Server) nextChange() (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	var next time.Time
+	for _, r := range s.runs {
+		if !r.cancelled.IsZero() {
+			continue
+		}
+		started := r.run.CreatedAt.Add(r.outcome.Queued)
+		for _, t := range []time.Time{started, started.Add(r.outcome.Duration)} {
+			if t.After(now) && (next.IsZero() || t.Before(next)) {
+				next = t
+			}
+		}
+	}
+	return next, !next.IsZero()
+}
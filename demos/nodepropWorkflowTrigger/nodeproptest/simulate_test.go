@@ -0,0 +1,255 @@
+package nodeproptest_test
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+// summarize lists a report's runs as "step repo conclusion", or "rule
+// repo conclusion" for dispatches made by rules.
+func summarize(r *nodeproptest.SimulationReport) []string {
+	var out []string
+	for _, run := range r.Runs {
+		name := run.Step
+		if name == "" {
+			name = run.Rule
+		}
+		out = append(out, name+" "+run.Repo+" "+run.Conclusion)
+	}
+	return out
+}
+
+func step(name, repo string, needs ...string) flow.FlowStep {
+	return flow.FlowStep{Name: name, Provider: flow.ProviderWorkflowDispatch, Repo: repo, Workflow: name + ".yml", Needs: needs}
+}
+
+func TestSimulationRunFlow(t *testing.T) {
+	failed := nodeproptest.Outcome{Conclusion: "failure"}
+	tests := []struct {
+		name     string
+		def      func() *flow.FlowDefinition
+		outcomes map[string]nodeproptest.Outcome
+		approval bool
+		want     []string
+		wantTime time.Duration
+	}{
+		{
+			name: "in order",
+			def: func() *flow.FlowDefinition {
+				return &flow.FlowDefinition{Name: "release", Steps: []flow.FlowStep{step("build", "Cdaprod/lib"), step("deploy", "Cdaprod/site", "build")}}
+			},
+			want:     []string{"build Cdaprod/lib success", "deploy Cdaprod/site success"},
+			wantTime: 2 * time.Minute,
+		},
+		{
+			name: "in parallel",
+			def: func() *flow.FlowDefinition {
+				return &flow.FlowDefinition{Name: "release", Steps: []flow.FlowStep{step("lib", "Cdaprod/lib"), step("api", "Cdaprod/api"), step("site", "Cdaprod/site", "lib", "api")}}
+			},
+			outcomes: map[string]nodeproptest.Outcome{"api": {Queued: time.Minute, Duration: 2 * time.Minute}},
+			want:     []string{"lib Cdaprod/lib success", "api Cdaprod/api success", "site Cdaprod/site success"},
+			wantTime: 4 * time.Minute,
+		},
+		{
+			name: "failed need",
+			def: func() *flow.FlowDefinition {
+				return &flow.FlowDefinition{Name: "release", Steps: []flow.FlowStep{step("build", "Cdaprod/lib"), step("deploy", "Cdaprod/site", "build")}}
+			},
+			outcomes: map[string]nodeproptest.Outcome{"build": failed},
+			want:     []string{"build Cdaprod/lib failure", "deploy Cdaprod/site skipped"},
+			wantTime: time.Minute,
+		},
+		{
+			name: "continue on error",
+			def: func() *flow.FlowDefinition {
+				build := step("build", "Cdaprod/lib")
+				build.ContinueOnError = true
+				return &flow.FlowDefinition{Name: "release", Steps: []flow.FlowStep{build, step("deploy", "Cdaprod/site", "build")}}
+			},
+			outcomes: map[string]nodeproptest.Outcome{"build": failed},
+			want:     []string{"build Cdaprod/lib failure", "deploy Cdaprod/site success"},
+			wantTime: 2 * time.Minute,
+		},
+		{
+			name: "failure handler",
+			def: func() *flow.FlowDefinition {
+				build := step("build", "Cdaprod/lib")
+				build.OnFailure = &flow.StepFailure{Run: []string{"rollback"}}
+				return &flow.FlowDefinition{Name: "release", Steps: []flow.FlowStep{build}, Handlers: []flow.FlowStep{step("rollback", "Cdaprod/lib")}}
+			},
+			outcomes: map[string]nodeproptest.Outcome{"build": failed},
+			want:     []string{"build Cdaprod/lib failure", "rollback Cdaprod/lib success"},
+			wantTime: 2 * time.Minute,
+		},
+		{
+			name: "saga compensation",
+			def: func() *flow.FlowDefinition {
+				migrate := step("migrate", "Cdaprod/db")
+				migrate.Compensate = "unmigrate"
+				return &flow.FlowDefinition{Name: "release", Steps: []flow.FlowStep{migrate, step("deploy", "Cdaprod/site", "migrate"), step("notify", "Cdaprod/bot", "deploy")}, Handlers: []flow.FlowStep{step("unmigrate", "Cdaprod/db")}}
+			},
+			outcomes: map[string]nodeproptest.Outcome{"deploy": failed},
+			want:     []string{"migrate Cdaprod/db success", "deploy Cdaprod/site failure", "notify Cdaprod/bot skipped", "unmigrate Cdaprod/db success"},
+			wantTime: 3 * time.Minute,
+		},
+		{
+			name: "when false",
+			def: func() *flow.FlowDefinition {
+				docs := step("docs", "Cdaprod/docs")
+				docs.When = `event.branch == "release"`
+				return &flow.FlowDefinition{Name: "release", Steps: []flow.FlowStep{docs, step("deploy", "Cdaprod/site", "docs")}}
+			},
+			want:     []string{"docs Cdaprod/docs omitted", "deploy Cdaprod/site success"},
+			wantTime: time.Minute,
+		},
+		{
+			name: "repository dispatch",
+			def: func() *flow.FlowDefinition {
+				return &flow.FlowDefinition{Name: "release", Steps: []flow.FlowStep{{Name: "announce", Provider: flow.ProviderRepositoryDispatch, Repo: "Cdaprod/bot", EventType: "release"}, step("deploy", "Cdaprod/site", "announce")}}
+			},
+			want:     []string{"announce Cdaprod/bot sent", "deploy Cdaprod/site success"},
+			wantTime: time.Minute,
+		},
+		{
+			name: "fan out",
+			def: func() *flow.FlowDefinition {
+				deploy := step("deploy", "")
+				deploy.FanOut = &flow.StepFanOut{Selector: "tag:web"}
+				return &flow.FlowDefinition{Name: "release", Steps: []flow.FlowStep{deploy, step("notify", "Cdaprod/bot", "deploy")}}
+			},
+			outcomes: map[string]nodeproptest.Outcome{"Cdaprod/docs": failed},
+			want:     []string{"deploy Cdaprod/docs failure", "deploy Cdaprod/site success", "notify Cdaprod/bot skipped"},
+			wantTime: time.Minute,
+		},
+		{
+			name: "fan out to nothing",
+			def: func() *flow.FlowDefinition {
+				deploy := step("deploy", "")
+				deploy.FanOut = &flow.StepFanOut{Selector: "tag:missing"}
+				return &flow.FlowDefinition{Name: "release", Steps: []flow.FlowStep{deploy}}
+			},
+			want: []string{"deploy tag:missing " + flow.ConclusionDispatchFailed},
+		},
+		{
+			name: "held for approval",
+			def: func() *flow.FlowDefinition {
+				return &flow.FlowDefinition{Name: "release", Steps: []flow.FlowStep{step("deploy", "Cdaprod/site"), step("notify", "Cdaprod/bot", "deploy")}}
+			},
+			approval: true,
+			want:     []string{"deploy Cdaprod/site held", "notify Cdaprod/bot skipped"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := flow.NewRepositoryRegistry()
+			for _, repo := range []string{"Cdaprod/site", "Cdaprod/docs"} {
+				reg.RegisterRepo(repo, nil, []string{"deploy.yml"})
+				reg.SetTags(repo, []string{"web"})
+			}
+			if tt.approval {
+				reg.SetApproval("Cdaprod/site", true, []string{"alice"})
+			}
+			start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+			sim := &nodeproptest.Simulation{Registry: reg, Outcomes: tt.outcomes, Start: start, FlowEvent: flow.InboundEvent{Type: "push", Branch: "main"}}
+			report, err := sim.RunFlow(context.Background(), tt.def())
+			if err != nil {
+				t.Fatalf("RunFlow() error = %v", err)
+			}
+			got := summarize(report)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("runs = %q, want %q", got, tt.want)
+			}
+			if d := report.End.Sub(report.Start); !report.Start.Equal(start) || d != tt.wantTime {
+				t.Errorf("simulated %v from %v, want %v", d, report.Start, tt.wantTime)
+			}
+		})
+	}
+}
+
+func TestSimulationRunFlowErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		def     *flow.FlowDefinition
+		wantErr string
+	}{
+		{name: "cycle", def: &flow.FlowDefinition{Name: "loop", Steps: []flow.FlowStep{step("a", "Cdaprod/a", "b"), step("b", "Cdaprod/b", "a")}}, wantErr: "cycle"},
+		{name: "fan out without a registry", def: &flow.FlowDefinition{Name: "f", Steps: []flow.FlowStep{{Name: "d", Provider: flow.ProviderWorkflowDispatch, Workflow: "d.yml", FanOut: &flow.StepFanOut{Selector: "tag:web"}}}}, wantErr: "needs a registry"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := (&nodeproptest.Simulation{}).RunFlow(context.Background(), tt.def)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("RunFlow() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSimulationRunEvent(t *testing.T) {
+	build := flow.RoutingRule{
+		Name:    "build",
+		Events:  []string{"push"},
+		Targets: []flow.BatchTarget{{Repo: flow.SourceRepo, Workflow: "build.yml", Ref: "${event.branch}"}},
+	}
+	deploy := flow.RoutingRule{
+		Name:    "deploy",
+		Events:  []string{"workflow_run"},
+		Payload: map[string]string{"workflow_run.name": "build", "workflow_run.conclusion": "success"},
+		Targets: []flow.BatchTarget{{Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "${event.branch}"}},
+	}
+	loop := flow.RoutingRule{
+		Name:    "loop",
+		Events:  []string{"workflow_run"},
+		Targets: []flow.BatchTarget{{Repo: flow.SourceRepo, Workflow: "again.yml", Ref: "main"}},
+	}
+	tests := []struct {
+		name     string
+		rules    []flow.RoutingRule
+		outcomes map[string]nodeproptest.Outcome
+		want     []string
+		wantErr  string
+	}{
+		{name: "chained", rules: []flow.RoutingRule{build, deploy}, want: []string{"build Cdaprod/lib success", "deploy Cdaprod/site success"}},
+		{name: "chain broken", rules: []flow.RoutingRule{build, deploy}, outcomes: map[string]nodeproptest.Outcome{"Cdaprod/lib": {Conclusion: "failure"}}, want: []string{"build Cdaprod/lib failure"}},
+		{name: "unrouted", rules: []flow.RoutingRule{deploy}},
+		{name: "loop", rules: []flow.RoutingRule{build, loop}, wantErr: "stopped after 5 dispatches"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sim := &nodeproptest.Simulation{Rules: tt.rules, Outcomes: tt.outcomes, MaxDispatches: 5}
+			report, err := sim.RunEvent(context.Background(), flow.InboundEvent{Type: "push", Repo: "Cdaprod/lib", Branch: "main"})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("RunEvent() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := summarize(report); !slices.Equal(got, tt.want) {
+				t.Errorf("runs = %q, want %q", got, tt.want)
+			}
+			for _, run := range report.Runs {
+				if run.Ref != "main" || run.Cause == "" {
+					t.Errorf("run = %+v, want it on main with a cause", run)
+				}
+			}
+			wantUnsuccessful := 0
+			for _, w := range tt.want {
+				if !strings.HasSuffix(w, " success") {
+					wantUnsuccessful++
+				}
+			}
+			if n := len(report.Unsuccessful()); n != wantUnsuccessful {
+				t.Errorf("Unsuccessful() has %d runs, want %d", n, wantUnsuccessful)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package nodeproptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// Mode is whether a Recorder records or replays.
+type Mode int
+
+const (
+	// ModeReplay answers requests from the fixture and never reaches the
+	// network.
+	ModeReplay Mode = iota
+	// ModeRecord sends requests on and writes each exchange to the
+	// fixture, replacing what it held.
+	ModeRecord
+)
+
+// ModeFromEnv returns ModeRecord if NODEPROP_VCR is "record", so fixtures
+// are refreshed with NODEPROP_VCR=record go test ./..., and ModeReplay
+// otherwise.
+func ModeFromEnv() Mode {
+	if os.Getenv("NODEPROP_VCR") == "record" {
+		return ModeRecord
+	}
+	return ModeReplay
+}
+
+// Interaction is a request and its response, as stored in a fixture.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is the request of an Interaction.
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// RecordedResponse is the response of an Interaction.
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// credentialHeaders are dropped from fixtures.
+var credentialHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+// Recorder is an http.RoundTripper that records real GitHub exchanges to a
+// fixture file and replays them, so tests of retries, pagination, and
+// rate-limit handling run offline against what GitHub actually sent:
+//
+//	rec, err := nodeproptest.NewRecorder("testdata/dispatch-retry.json", nodeproptest.ModeFromEnv())
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	client := flow.NewGitHubClient(os.Getenv("GITHUB_TOKEN"))
+//	client.HTTPClient = rec.Client()
+//
+// Fixtures are sanitized as they are written: credential headers are
+// dropped, and Secrets, which include the client's token, and anything
+// shaped like a GitHub token are redacted from URLs, headers, and bodies.
+//
+// A replayed request is answered by the first recorded interaction not
+// used yet with the same method, path, and query, ignoring the query
+// parameters in IgnoreQuery. Bodies are not compared, since dispatches
+// carry a new nodeprop_id each time; interactions are used in order, so a
+// request answered with a 502 and then a 204 when recorded is too when
+// replayed.
+type Recorder struct {
+	Path string
+	Mode Mode
+	// Transport sends requests when recording; nil means
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+	// IgnoreQuery names query parameters that differ between runs. It
+	// defaults to created, the time window of run lookups.
+	IgnoreQuery []string
+	// Sanitize, if set, further scrubs each interaction before it is
+	// written, e.g. to replace private repository names.
+	Sanitize func(*Interaction)
+
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+// NewRecorder returns a recorder for the fixture at path, reading it when
+// replaying.
+func NewRecorder(path string, mode Mode) (*Recorder, error) {
+	r := &Recorder{Path: path, Mode: mode, IgnoreQuery: []string{"created"}}
+	if mode == ModeRecord {
+		return r, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture (record it with NODEPROP_VCR=record): %w", err)
+	}
+	if err := json.Unmarshal(data, &r.interactions); err != nil {
+		return nil, fmt.Errorf("failed to parse fixture %s: %w", path, err)
+	}
+	r.used = make([]bool, len(r.interactions))
+	return r, nil
+}
+
+// Client returns an HTTP client using the recorder.
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Unused returns the recorded interactions no request has been answered
+// by, for tests that expect every one to be replayed.
+func (r *Recorder) Unused() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []Interaction
+	for i, used := range r.used {
+		if !used {
+			out = append(out, r.interactions[i])
+		}
+	}
+	return out
+}
+
+// RoundTrip records or replays req.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if r.Mode == ModeRecord {
+		return r.record(req, body)
+	}
+	return r.replay(req)
+}
+
+func (r *Recorder) replay(req *http.Request) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	want := r.key(req.Method, req.URL)
+	for i, in := range r.interactions {
+		if r.used[i] {
+			continue
+		}
+		u, err := url.Parse(in.Request.URL)
+		if err != nil || r.key(in.Request.Method, u) != want {
+			continue
+		}
+		r.used[i] = true
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", in.Response.StatusCode, http.StatusText(in.Response.StatusCode)),
+			StatusCode:    in.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        in.Response.Header.Clone(),
+			Body:          io.NopCloser(bytes.NewReader([]byte(in.Response.Body))),
+			ContentLength: int64(len(in.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("nodeproptest: no recorded interaction left for %s in %s", want, r.Path)
+}
+
+// key identifies a request for replay by method, path, and query.
+func (r *Recorder) key(method string, u *url.URL) string {
+	q := u.Query()
+	for _, name := range r.IgnoreQuery {
+		q.Del(name)
+	}
+	k := method + " " + u.EscapedPath()
+	if len(q) > 0 {
+		k += "?" + q.Encode()
+	}
+	return k
+}
+
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	if body != nil {
+		out.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	in := Interaction{
+		Request:  RecordedRequest{Method: req.Method, URL: req.URL.String(), Header: req.Header.Clone(), Body: string(body)},
+		Response: RecordedResponse{StatusCode: resp.StatusCode, Header: resp.Header.Clone(), Body: string(respBody)},
+	}
+	sanitize(&in)
+	if r.Sanitize != nil {
+		r.Sanitize(&in)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.interactions = append(r.interactions, in)
+	r.used = append(r.used, true)
+	if err := r.save(); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// save writes every interaction recorded so far, so a test that stops
+// early still leaves a usable fixture.
+func (r *Recorder) save() error {
+	data, err := json.MarshalIndent(r.interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.Path), 0o755); err != nil {
+		return fmt.Errorf("failed to write fixture: %w", err)
+	}
+	if err := os.WriteFile(r.Path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write fixture: %w", err)
+	}
+	return nil
+}
+
+// sanitize drops credential headers from in and redacts secrets from the
+// rest.
+func sanitize(in *Interaction) {
+	in.Request.URL = flow.Secrets.Redact(in.Request.URL)
+	in.Request.Body = flow.Secrets.Redact(in.Request.Body)
+	in.Response.Body = flow.Secrets.Redact(in.Response.Body)
+	for _, h := range []http.Header{in.Request.Header, in.Response.Header} {
+		for name, values := range h {
+			if slices.Contains(credentialHeaders, http.CanonicalHeaderKey(name)) {
+				delete(h, name)
+				continue
+			}
+			for i, v := range values {
+				values[i] = flow.Secrets.Redact(v)
+			}
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package nodeproptest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+func TestModeFromEnv(t *testing.T) {
+	tests := []struct {
+		env  string
+		want nodeproptest.Mode
+	}{
+		{env: "", want: nodeproptest.ModeReplay},
+		{env: "record", want: nodeproptest.ModeRecord},
+		{env: "RECORD", want: nodeproptest.ModeReplay},
+		{env: "replay", want: nodeproptest.ModeReplay},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			t.Setenv("NODEPROP_VCR", tt.env)
+			if got := nodeproptest.ModeFromEnv(); got != tt.want {
+				t.Errorf("ModeFromEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecorderRoundTrip(t *testing.T) {
+	token := "ghp_" + strings.Repeat("a1B2", 9)
+	fixture := filepath.Join(t.TempDir(), "testdata", "dispatch.json")
+	ctx := context.Background()
+	// exchange dispatches once after a 502, then looks the run up.
+	exchange := func(c *flow.GitHubClient) error {
+		err := c.DispatchWorkflow(ctx, "Cdaprod/site", "deploy.yml", "main", map[string]string{"secret": token})
+		var apiErr *flow.APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway {
+			return errors.New("first dispatch did not get the 502")
+		}
+		if err := c.DispatchWorkflow(ctx, "Cdaprod/site", "deploy.yml", "main", nil); err != nil {
+			return err
+		}
+		runs, err := c.ListWorkflowRuns(ctx, "Cdaprod/site", "deploy.yml", time.Now().Add(-time.Minute))
+		if err != nil {
+			return err
+		}
+		if len(runs) != 1 {
+			return errors.New("dispatched run not listed")
+		}
+		return nil
+	}
+
+	gh := nodeproptest.NewServer()
+	gh.Token = token
+	gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+	gh.Inject(nodeproptest.Fault{Method: "POST", Status: http.StatusBadGateway, Times: 1})
+	rec, err := nodeproptest.NewRecorder(fixture, nodeproptest.ModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.Sanitize = func(in *nodeproptest.Interaction) {
+		in.Response.Header.Set("X-Sanitized", "true")
+	}
+	c := gh.Client()
+	c.Token = token
+	c.HTTPClient = rec.Client()
+	if err := exchange(c); err != nil {
+		t.Fatalf("recording: %v", err)
+	}
+	gh.Close()
+
+	data, err := os.ReadFile(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, leak := range []string{token, "Authorization"} {
+		if strings.Contains(string(data), leak) {
+			t.Errorf("fixture contains %q:\n%s", leak, data)
+		}
+	}
+
+	if !strings.Contains(string(data), "X-Sanitized") {
+		t.Error("fixture was not passed through Sanitize")
+	}
+
+	// The server is gone, so every answer must come from the fixture, in
+	// the order it was recorded, even though the run lookup's created
+	// window has moved on.
+	replay, err := nodeproptest.NewRecorder(fixture, nodeproptest.ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = flow.NewGitHubClient(token)
+	c.BaseURL = gh.URL
+	c.HTTPClient = replay.Client()
+	time.Sleep(time.Second)
+	if err := exchange(c); err != nil {
+		t.Fatalf("replaying: %v", err)
+	}
+	if unused := replay.Unused(); len(unused) != 0 {
+		t.Errorf("Unused() = %+v, want every interaction replayed", unused)
+	}
+	if err := c.DispatchWorkflow(ctx, "Cdaprod/site", "deploy.yml", "main", nil); err == nil || !strings.Contains(err.Error(), "no recorded interaction left") {
+		t.Errorf("replay past the fixture error = %v", err)
+	}
+}
+
+func TestRecorderReplay(t *testing.T) {
+	fixture := filepath.Join(t.TempDir(), "runs.json")
+	os.WriteFile(fixture, []byte(`[
+  {"request": {"method": "GET", "url": "https://api.github.com/repos/o/r/actions/runs/1?created=%3E%3D2024-01-01"}, "response": {"status_code": 502}},
+  {"request": {"method": "GET", "url": "https://api.github.com/repos/o/r/actions/runs/1?created=%3E%3D2024-03-01"}, "response": {"status_code": 200, "header": {"X-Ratelimit-Remaining": ["10"]}, "body": "{\"id\": 1}"}},
+  {"request": {"method": "POST", "url": "https://api.github.com/repos/o/r/actions/runs/1/cancel"}, "response": {"status_code": 202}}
+]`), 0o644)
+
+	tests := []struct {
+		name       string
+		ignore     []string
+		requests   []string
+		wantStatus []int
+		wantUnused int
+	}{
+		{
+			name:       "in recorded order",
+			ignore:     []string{"created"},
+			requests:   []string{"GET /repos/o/r/actions/runs/1?created=x", "GET /repos/o/r/actions/runs/1", "POST /repos/o/r/actions/runs/1/cancel"},
+			wantStatus: []int{502, 200, 202},
+		},
+		{
+			name:       "used once",
+			ignore:     []string{"created"},
+			requests:   []string{"POST /repos/o/r/actions/runs/1/cancel", "POST /repos/o/r/actions/runs/1/cancel"},
+			wantStatus: []int{202, 0},
+			wantUnused: 2,
+		},
+		{
+			name:       "query compared",
+			requests:   []string{"GET /repos/o/r/actions/runs/1?created=%3E%3D2024-03-01", "GET /repos/o/r/actions/runs/1"},
+			wantStatus: []int{200, 0},
+			wantUnused: 2,
+		},
+		{
+			name:       "method compared",
+			ignore:     []string{"created"},
+			requests:   []string{"DELETE /repos/o/r/actions/runs/1/cancel"},
+			wantStatus: []int{0},
+			wantUnused: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, err := nodeproptest.NewRecorder(fixture, nodeproptest.ModeReplay)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec.IgnoreQuery = tt.ignore
+			for i, r := range tt.requests {
+				method, path, _ := strings.Cut(r, " ")
+				req, _ := http.NewRequest(method, "https://api.github.com"+path, nil)
+				resp, err := rec.Client().Do(req)
+				if tt.wantStatus[i] == 0 {
+					if err == nil {
+						t.Errorf("%s answered %d, want no interaction", r, resp.StatusCode)
+					}
+					continue
+				}
+				if err != nil || resp.StatusCode != tt.wantStatus[i] {
+					t.Errorf("%s = %v, %v; want %d", r, resp, err, tt.wantStatus[i])
+					continue
+				}
+				resp.Body.Close()
+			}
+			if n := len(rec.Unused()); n != tt.wantUnused {
+				t.Errorf("%d interactions unused, want %d", n, tt.wantUnused)
+			}
+		})
+	}
+}
+
+func TestNewRecorderErrors(t *testing.T) {
+	dir := t.TempDir()
+	corrupt := filepath.Join(dir, "corrupt.json")
+	os.WriteFile(corrupt, []byte("{"), 0o644)
+	tests := []struct {
+		name    string
+		path    string
+		mode    nodeproptest.Mode
+		wantErr string
+	}{
+		{name: "missing fixture", path: filepath.Join(dir, "missing.json"), wantErr: "NODEPROP_VCR=record"},
+		{name: "corrupt fixture", path: corrupt, wantErr: "failed to parse fixture"},
+		{name: "recording ignores the file", path: corrupt, mode: nodeproptest.ModeRecord},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := nodeproptest.NewRecorder(tt.path, tt.mode)
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("NewRecorder() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// notifyTimeout bounds the delivery of one notification.
+const notifyTimeout = 30 * time.Second
+
+// DefaultNotifyEvents are the events sent to a Notifier that does not
+// choose its own: dispatch failures, finished runs, and dispatches awaiting
+// approval.
+var DefaultNotifyEvents = []EventType{EventFailed, EventRunCompleted, EventApprovalRequested}
+
+// Notifier delivers dispatch events to a chat channel or similar.
+type Notifier interface {
+	Notify(ctx context.Context, e Event) error
+}
+
+// Notifiers deliver an event to every notifier.
+type Notifiers []Notifier
+
+// Notify delivers e to each notifier, even if one fails, and joins their
+// errors.
+func (ns Notifiers) Notify(ctx context.Context, e Event) error {
+	var errs []error
+	for _, n := range ns {
+		if err := n.Notify(ctx, e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ForwardEvents sends every event of the given types published on bus to
+// n until ctx is cancelled. With no types, DefaultNotifyEvents are sent.
+// Delivery errors are passed to onError and do not stop forwarding.
+func ForwardEvents(ctx context.Context, bus *EventBus, n Notifier, types []EventType, onError func(error)) {
+	if len(types) == 0 {
+		types = DefaultNotifyEvents
+	}
+	want := make(map[EventType]bool, len(types))
+	for _, t := range types {
+		want[t] = true
+	}
+	events, unsubscribe := bus.Subscribe(64)
+	defer unsubscribe()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-events:
+			if !want[e.Type] {
+				continue
+			}
+			nctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+			if err := n.Notify(nctx, e); err != nil && onError != nil {
+				onError(fmt.Errorf("notify %s %s: %w", e.Type, e.Repo, err))
+			}
+			cancel()
+		}
+	}
+}
+
+// EventSummary is a one-line plain-text description of e for notifications.
+func EventSummary(e Event) string {
+	switch e.Type {
+	case EventQueued:
+		return fmt.Sprintf("%s in %s is queued", e.Workflow, e.Repo)
+	case EventDispatched:
+		return fmt.Sprintf("Dispatched %s in %s (dispatch %s)", e.Workflow, e.Repo, e.DispatchID)
+	case EventFailed:
+		return fmt.Sprintf("Failed to dispatch %s in %s: %s", e.Workflow, e.Repo, e.Error)
+	case EventRunStarted:
+		return fmt.Sprintf("%s in %s started run %d", e.Workflow, e.Repo, e.RunID)
+	case EventRunCompleted:
+		return fmt.Sprintf("%s in %s finished: %s", e.Workflow, e.Repo, e.Status)
+	case EventCancelled:
+		return fmt.Sprintf("Cancelled run %d of %s in %s", e.RunID, e.Workflow, e.Repo)
+	case EventApprovalRequested:
+		return fmt.Sprintf("%s in %s awaits approval %s (requested by %s)", e.Workflow, e.Repo, e.ApprovalID, actor(e))
+	case EventApproved:
+		return fmt.Sprintf("%s approved %s in %s (approval %s)", actor(e), e.Workflow, e.Repo, e.ApprovalID)
+	case EventRejected:
+		return fmt.Sprintf("%s rejected %s in %s (approval %s)", actor(e), e.Workflow, e.Repo, e.ApprovalID)
+	case EventFanOutCompleted:
+		if e.Error != "" {
+			return fmt.Sprintf("Fan-out of %s from %s: %s: %s", e.Actor, e.Repo, e.Status, e.Error)
+		}
+		return fmt.Sprintf("Fan-out of %s from %s: %s", e.Actor, e.Repo, e.Status)
+	case EventFlowStepFailed:
+		return fmt.Sprintf("%s of %s failed: %s", e.Status, e.Actor, e.Error)
+	}
+	return fmt.Sprintf("%s in %s: %s %s", e.Workflow, e.Repo, e.Type, e.Status)
+}
+
+func actor(e Event) string {
+	if e.Actor == "" {
+		return "anonymous"
+	}
+	return e.Actor
+}
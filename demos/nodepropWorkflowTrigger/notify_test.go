@@ -0,0 +1,147 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// notifierFunc adapts a function to Notifier.
+type notifierFunc func(ctx context.Context, e Event) error
+
+func (f notifierFunc) Notify(ctx context.Context, e Event) error { return f(ctx, e) }
+
+func TestNotifiers(t *testing.T) {
+	errA, errB := errors.New("a"), errors.New("b")
+	var calls int
+	n := func(err error) Notifier {
+		return notifierFunc(func(context.Context, Event) error { calls++; return err })
+	}
+	err := Notifiers{n(errA), n(nil), n(errB)}.Notify(context.Background(), Event{})
+	if calls != 3 || !errors.Is(err, errA) || !errors.Is(err, errB) {
+		t.Errorf("Notify() called %d notifiers and returned %v, want all three and both errors", calls, err)
+	}
+	if err := (Notifiers{}).Notify(context.Background(), Event{}); err != nil {
+		t.Errorf("Notify() with no notifiers = %v", err)
+	}
+}
+
+func TestForwardEvents(t *testing.T) {
+	tests := []struct {
+		name  string
+		types []EventType
+		want  []EventType
+	}{
+		{name: "defaults", want: []EventType{EventFailed, EventRunCompleted, EventApprovalRequested}},
+		{name: "chosen", types: []EventType{EventDispatched}, want: []EventType{EventDispatched}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := NewEventBus()
+			var (
+				mu     sync.Mutex
+				got    []EventType
+				errs   []error
+				notify = make(chan struct{}, 16)
+			)
+			n := notifierFunc(func(ctx context.Context, e Event) error {
+				if _, ok := ctx.Deadline(); !ok {
+					t.Error("Notify() context has no deadline")
+				}
+				mu.Lock()
+				got = append(got, e.Type)
+				mu.Unlock()
+				notify <- struct{}{}
+				return errors.New("offline")
+			})
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				ForwardEvents(ctx, bus, n, tt.types, func(err error) {
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+				})
+				close(done)
+			}()
+			waitForSubscriber(t, bus)
+
+			for _, typ := range []EventType{EventQueued, EventDispatched, EventFailed, EventRunStarted, EventRunCompleted, EventApprovalRequested} {
+				bus.Publish(Event{Type: typ, Repo: "o/r"})
+			}
+			for range tt.want {
+				select {
+				case <-notify:
+				case <-time.After(5 * time.Second):
+					t.Fatal("event was not forwarded")
+				}
+			}
+			cancel()
+			<-done
+
+			mu.Lock()
+			defer mu.Unlock()
+			if strings.Join(eventTypes(got), ",") != strings.Join(eventTypes(tt.want), ",") {
+				t.Errorf("forwarded %v, want %v", got, tt.want)
+			}
+			if len(errs) != len(tt.want) || !strings.Contains(errs[0].Error(), "notify "+string(tt.want[0])+" o/r: offline") {
+				t.Errorf("errors = %v, want one per forwarded event", errs)
+			}
+			if len(bus.subs) != 0 {
+				t.Error("ForwardEvents() did not unsubscribe")
+			}
+		})
+	}
+}
+
+func waitForSubscriber(t *testing.T, bus *EventBus) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		bus.mu.RLock()
+		n := len(bus.subs)
+		bus.mu.RUnlock()
+		if n > 0 {
+			return
+		}
+	}
+	t.Fatal("no subscriber")
+}
+
+func eventTypes(ts []EventType) []string {
+	s := make([]string, len(ts))
+	for i, t := range ts {
+		s[i] = string(t)
+	}
+	return s
+}
+
+func TestEventSummary(t *testing.T) {
+	tests := []struct {
+		e    Event
+		want string
+	}{
+		{e: Event{Type: EventQueued, Repo: "o/r", Workflow: "ci.yml"}, want: "ci.yml in o/r is queued"},
+		{e: Event{Type: EventDispatched, Repo: "o/r", Workflow: "ci.yml", DispatchID: "d1"}, want: "Dispatched ci.yml in o/r (dispatch d1)"},
+		{e: Event{Type: EventFailed, Repo: "o/r", Workflow: "ci.yml", Error: "404"}, want: "Failed to dispatch ci.yml in o/r: 404"},
+		{e: Event{Type: EventRunStarted, Repo: "o/r", Workflow: "ci.yml", RunID: 7}, want: "ci.yml in o/r started run 7"},
+		{e: Event{Type: EventRunCompleted, Repo: "o/r", Workflow: "ci.yml", Status: "success"}, want: "ci.yml in o/r finished: success"},
+		{e: Event{Type: EventCancelled, Repo: "o/r", Workflow: "ci.yml", RunID: 7}, want: "Cancelled run 7 of ci.yml in o/r"},
+		{e: Event{Type: EventApprovalRequested, Repo: "o/r", Workflow: "ci.yml", ApprovalID: "a1"}, want: "ci.yml in o/r awaits approval a1 (requested by anonymous)"},
+		{e: Event{Type: EventApproved, Repo: "o/r", Workflow: "ci.yml", ApprovalID: "a1", Actor: "alice"}, want: "alice approved ci.yml in o/r (approval a1)"},
+		{e: Event{Type: EventRejected, Repo: "o/r", Workflow: "ci.yml", ApprovalID: "a1", Actor: "bob"}, want: "bob rejected ci.yml in o/r (approval a1)"},
+		{e: Event{Type: EventFanOutCompleted, Repo: "o/r", Actor: "libs", Status: "3 dispatched"}, want: "Fan-out of libs from o/r: 3 dispatched"},
+		{e: Event{Type: EventFanOutCompleted, Repo: "o/r", Actor: "libs", Status: "1 failed", Error: "404"}, want: "Fan-out of libs from o/r: 1 failed: 404"},
+		{e: Event{Type: EventFlowStepFailed, Actor: "flow:release", Status: "deploy", Error: "boom"}, want: "deploy of flow:release failed: boom"},
+		{e: Event{Type: EventRunUpdated, Repo: "o/r", Workflow: "ci.yml", Status: "in_progress"}, want: "ci.yml in o/r: run_updated in_progress"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.e.Type), func(t *testing.T) {
+			if got := EventSummary(tt.e); got != tt.want {
+				t.Errorf("EventSummary() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
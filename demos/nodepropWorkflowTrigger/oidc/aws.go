@@ -0,0 +1,66 @@
+package oidc
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// AWSAudience is the audience AWS STS expects of a GitHub ID token.
+const AWSAudience = "sts.amazonaws.com"
+
+// actionsTokenRetriever gives stscreds the job's ID token, replacing the
+// one it gave before in flow.Secrets.
+type actionsTokenRetriever struct {
+	mu   sync.Mutex
+	last string
+}
+
+func (r *actionsTokenRetriever) GetIdentityToken() ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	token, err := ActionsToken(ctx, AWSAudience)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	flow.Secrets.Replace(r.last, token)
+	r.last = token
+	return []byte(token), nil
+}
+
+// AWSCredentials assumes roleARN with the job's ID token. The credentials
+// are cached and renewed before they expire.
+func AWSCredentials(cfg aws.Config, roleARN string) aws.CredentialsProvider {
+	return aws.NewCredentialsCache(stscreds.NewWebIdentityRoleProvider(sts.NewFromConfig(cfg), roleARN, &actionsTokenRetriever{},
+		func(o *stscreds.WebIdentityRoleOptions) {
+			o.RoleSessionName = os.Getenv("AWS_ROLE_SESSION_NAME")
+			if o.RoleSessionName == "" {
+				o.RoleSessionName = "nodeprop"
+			}
+		}))
+}
+
+// LoadAWSConfig is config.LoadDefaultConfig, except that in an Actions job
+// with AWS_ROLE_ARN set and no AWS_WEB_IDENTITY_TOKEN_FILE it assumes the
+// role with the job's ID token, as the SDK would with a token file.
+func LoadAWSConfig(ctx context.Context, optFns ...func(*config.LoadOptions) error) (aws.Config, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, optFns...)
+	if err != nil {
+		return cfg, err
+	}
+	role := os.Getenv("AWS_ROLE_ARN")
+	if role != "" && os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE") == "" && InActions() {
+		cfg.Credentials = AWSCredentials(cfg, role)
+	}
+	return cfg, nil
+}
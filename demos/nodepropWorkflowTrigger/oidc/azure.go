@@ -0,0 +1,99 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// AzureAudience is the audience Microsoft Entra ID expects of a GitHub ID
+// token used as a federated credential.
+const AzureAudience = "api://AzureADTokenExchange"
+
+// AzureScope is the scope Azure access tokens are requested with by
+// default: Azure Resource Manager.
+const AzureScope = "https://management.azure.com/.default"
+
+// Azure is a flow.TokenProvider for an access token of an Entra ID
+// application or managed identity with a federated credential trusting the
+// repository, from the client credentials flow with the job's ID token as
+// the client assertion.
+type Azure struct {
+	TenantID string
+	ClientID string
+	// Scope defaults to AzureScope, e.g. https://vault.azure.net/.default
+	// for Key Vault.
+	Scope string
+	// Authority overrides https://login.microsoftonline.com, e.g. for a
+	// sovereign cloud.
+	Authority  string
+	HTTPClient *http.Client
+
+	cache cache
+}
+
+// Token returns an Azure access token.
+func (a *Azure) Token(ctx context.Context) (string, error) {
+	return a.cache.get(ctx, a.fetch)
+}
+
+func (a *Azure) fetch(ctx context.Context) (_ string, _ time.Time, err error) {
+	idToken, err := ActionsToken(ctx, AzureAudience)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	// The ID token is only used here; the access token is replaced in
+	// flow.Secrets by the cache when it is renewed.
+	defer func() {
+		err = flow.RedactError(err)
+		flow.Secrets.Remove(idToken)
+	}()
+	scope, authority := a.Scope, a.Authority
+	if scope == "" {
+		scope = AzureScope
+	}
+	if authority == "" {
+		authority = "https://login.microsoftonline.com"
+	}
+	form := url.Values{
+		"client_id":             {a.ClientID},
+		"scope":                 {scope},
+		"grant_type":            {"client_credentials"},
+		"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"},
+		"client_assertion":      {idToken},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(authority, "/")+"/"+url.PathEscape(a.TenantID)+"/oauth2/v2.0/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var out struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	err = doJSON(a.HTTPClient, req, &out)
+	if err == nil && out.AccessToken == "" {
+		err = errors.New("no access token in response")
+	}
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("oidc: Azure token request for %s failed: %w", a.ClientID, err)
+	}
+	return out.AccessToken, time.Now().Add(time.Duration(out.ExpiresIn) * time.Second), nil
+}
+
+// ParseAzure builds an Azure from TENANT_ID/CLIENT_ID or
+// TENANT_ID/CLIENT_ID#SCOPE.
+func ParseAzure(arg string) (flow.TokenProvider, error) {
+	ids, scope, _ := strings.Cut(arg, "#")
+	tenant, client, ok := strings.Cut(ids, "/")
+	if !ok || tenant == "" || client == "" {
+		return nil, errors.New("oidc: want azure-oidc:TENANT_ID/CLIENT_ID#SCOPE")
+	}
+	return &Azure{TenantID: tenant, ClientID: client, Scope: scope}, nil
+}
@@ -0,0 +1,136 @@
+package oidc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// GCPScope is the scope GCP access tokens are requested with by default.
+const GCPScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// GCP is a flow.TokenProvider for a GCP access token from workload identity
+// federation: the job's ID token is exchanged at Google's STS and, if
+// ServiceAccount is set, for a token of that service account.
+type GCP struct {
+	// Provider is the workload identity provider's resource name,
+	// projects/NUMBER/locations/global/workloadIdentityPools/POOL/providers/PROVIDER.
+	Provider string
+	// ServiceAccount, if set, is the email of the service account to
+	// impersonate; without it the federated token is used directly.
+	ServiceAccount string
+	// Scopes default to GCPScope.
+	Scopes []string
+	// STSEndpoint and IAMEndpoint override https://sts.googleapis.com and
+	// https://iamcredentials.googleapis.com, e.g. for Private Google Access.
+	STSEndpoint string
+	IAMEndpoint string
+	HTTPClient  *http.Client
+
+	cache cache
+}
+
+// Token returns a GCP access token.
+func (g *GCP) Token(ctx context.Context) (string, error) {
+	return g.cache.get(ctx, g.fetch)
+}
+
+func (g *GCP) fetch(ctx context.Context) (_ string, _ time.Time, err error) {
+	audience := "//iam.googleapis.com/" + strings.TrimPrefix(g.Provider, "//iam.googleapis.com/")
+	idToken, err := ActionsToken(ctx, "https:"+audience)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	var exchanged struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	// The ID token, and the federated token when a service account is
+	// impersonated with it, are only used here; the token returned is
+	// replaced in flow.Secrets by the cache when it is renewed.
+	defer func() {
+		err = flow.RedactError(err)
+		flow.Secrets.Remove(idToken)
+		if g.ServiceAccount != "" {
+			flow.Secrets.Remove(exchanged.AccessToken)
+		}
+	}()
+	scopes := g.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{GCPScope}
+	}
+	sts := g.STSEndpoint
+	if sts == "" {
+		sts = "https://sts.googleapis.com"
+	}
+	err = g.post(ctx, strings.TrimSuffix(sts, "/")+"/v1/token", "", map[string]string{
+		"grantType":          "urn:ietf:params:oauth:grant-type:token-exchange",
+		"audience":           audience,
+		"scope":              strings.Join(scopes, " "),
+		"requestedTokenType": "urn:ietf:params:oauth:token-type:access_token",
+		"subjectTokenType":   "urn:ietf:params:oauth:token-type:jwt",
+		"subjectToken":       idToken,
+	}, &exchanged)
+	if err == nil && exchanged.AccessToken == "" {
+		err = errors.New("no access token in response")
+	}
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("oidc: GCP token exchange with %s failed: %w", g.Provider, err)
+	}
+	flow.Secrets.Add(exchanged.AccessToken)
+	if g.ServiceAccount == "" {
+		return exchanged.AccessToken, time.Now().Add(time.Duration(exchanged.ExpiresIn) * time.Second), nil
+	}
+
+	iam := g.IAMEndpoint
+	if iam == "" {
+		iam = "https://iamcredentials.googleapis.com"
+	}
+	var impersonated struct {
+		AccessToken string    `json:"accessToken"`
+		ExpireTime  time.Time `json:"expireTime"`
+	}
+	err = g.post(ctx, strings.TrimSuffix(iam, "/")+"/v1/projects/-/serviceAccounts/"+g.ServiceAccount+":generateAccessToken",
+		exchanged.AccessToken, map[string]interface{}{"scope": scopes}, &impersonated)
+	if err == nil && impersonated.AccessToken == "" {
+		err = errors.New("no access token in response")
+	}
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("oidc: failed to impersonate %s: %w", g.ServiceAccount, err)
+	}
+	return impersonated.AccessToken, impersonated.ExpireTime, nil
+}
+
+// post sends in as JSON to url, with bearer if set, and decodes the
+// response into out.
+func (g *GCP) post(ctx context.Context, url, bearer string, in, out interface{}) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	return doJSON(g.HTTPClient, req, out)
+}
+
+// ParseGCP builds a GCP from PROVIDER or PROVIDER#SERVICE_ACCOUNT.
+func ParseGCP(arg string) (flow.TokenProvider, error) {
+	provider, sa, _ := strings.Cut(arg, "#")
+	if !strings.Contains(provider, "/workloadIdentityPools/") {
+		return nil, fmt.Errorf("oidc: %q is not a workload identity provider name", provider)
+	}
+	return &GCP{Provider: provider, ServiceAccount: sa}, nil
+}
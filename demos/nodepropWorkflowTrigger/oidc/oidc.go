@@ -0,0 +1,161 @@
+// Package oidc exchanges the OIDC token GitHub Actions issues to a job
+// for short-lived AWS, GCP, and Azure credentials, so that a nodeprop
+// running in a workflow needs no static cloud keys. The job must have the
+// id-token: write permission.
+package oidc
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// ErrNoActionsToken means the process is not in a GitHub Actions job that
+// may request an ID token.
+var ErrNoActionsToken = errors.New("oidc: no GitHub Actions ID token; run in a job with permissions id-token: write")
+
+// InActions reports whether an Actions ID token can be requested.
+func InActions() bool {
+	return os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL") != "" && os.Getenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN") != ""
+}
+
+// ActionsToken requests an ID token for audience from the Actions runtime;
+// an empty audience leaves GitHub's default, the repository owner's URL.
+// The token is added to flow.Secrets, from which callers that are done with
+// it remove it.
+func ActionsToken(ctx context.Context, audience string) (string, error) {
+	if !InActions() {
+		return "", ErrNoActionsToken
+	}
+	u, err := url.Parse(os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL"))
+	if err != nil {
+		return "", fmt.Errorf("oidc: invalid ACTIONS_ID_TOKEN_REQUEST_URL: %w", err)
+	}
+	if audience != "" {
+		q := u.Query()
+		q.Set("audience", audience)
+		u.RawQuery = q.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+os.Getenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN"))
+	var out struct {
+		Value string `json:"value"`
+	}
+	if err := doJSON(nil, req, &out); err != nil {
+		return "", fmt.Errorf("oidc: failed to request an Actions ID token: %w", err)
+	}
+	if out.Value == "" {
+		return "", errors.New("oidc: empty Actions ID token")
+	}
+	flow.Secrets.Add(out.Value)
+	return out.Value, nil
+}
+
+// doJSON sends req with hc and decodes a 2xx JSON response into out.
+func doJSON(hc *http.Client, req *http.Request, out interface{}) error {
+	if hc == nil {
+		hc = flow.SharedHTTPClient()
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status code: %d: %s", resp.StatusCode, flow.Secrets.Redact(strings.TrimSpace(string(body))))
+	}
+	return json.Unmarshal(body, out)
+}
+
+// expiry reads the exp claim of a JWT without verifying it, or returns the
+// zero time.
+func expiry(jwt string) time.Time {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if json.Unmarshal(payload, &claims) != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Exp, 0)
+}
+
+// cache holds a credential until two thirds of its lifetime have passed.
+type cache struct {
+	mu        sync.Mutex
+	value     string
+	refreshAt time.Time
+}
+
+// get returns the cached value or replaces it with fetch's, which returns
+// the value and when it expires. The new value replaces the old in
+// flow.Secrets.
+func (c *cache) get(ctx context.Context, fetch func(context.Context) (string, time.Time, error)) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.value != "" && time.Now().Before(c.refreshAt) {
+		return c.value, nil
+	}
+	v, exp, err := fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	lifetime := time.Until(exp)
+	if exp.IsZero() || lifetime <= 0 {
+		lifetime = 5 * time.Minute
+	}
+	flow.Secrets.Replace(c.value, v)
+	c.value, c.refreshAt = v, time.Now().Add(lifetime*2/3)
+	return v, nil
+}
+
+// IDToken is a flow.TokenProvider for the job's Actions ID token, for
+// services that trust GitHub's issuer directly.
+type IDToken struct {
+	Audience string
+
+	cache cache
+}
+
+// Token returns an ID token for t.Audience.
+func (t *IDToken) Token(ctx context.Context) (string, error) {
+	return t.cache.get(ctx, func(ctx context.Context) (string, time.Time, error) {
+		token, err := ActionsToken(ctx, t.Audience)
+		return token, expiry(token), err
+	})
+}
+
+// Register adds the actions-oidc:AUDIENCE, gcp-oidc:PROVIDER#SERVICE_ACCOUNT,
+// and azure-oidc:TENANT/CLIENT#SCOPE token sources to flow.ParseTokenSource.
+func Register() {
+	flow.RegisterTokenSource("actions-oidc", func(arg string) (flow.TokenProvider, error) {
+		return &IDToken{Audience: arg}, nil
+	})
+	flow.RegisterTokenSource("gcp-oidc", ParseGCP)
+	flow.RegisterTokenSource("azure-oidc", ParseAzure)
+}
@@ -0,0 +1,34 @@
+package oidc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+func TestCacheReplacesRenewedSecret(t *testing.T) {
+	var c cache
+	tokens := []string{"first-access-token", "second-access-token"}
+	fetch := func(context.Context) (string, time.Time, error) {
+		v := tokens[0]
+		tokens = tokens[1:]
+		return v, time.Time{}, nil
+	}
+	defer flow.Secrets.Remove("first-access-token", "second-access-token")
+	for _, want := range []string{"first-access-token", "second-access-token"} {
+		// Due for renewal.
+		c.refreshAt = time.Time{}
+		got, err := c.get(context.Background(), fetch)
+		if err != nil || got != want {
+			t.Fatalf("get() = %q, %v; want %q", got, err, want)
+		}
+	}
+	if got := flow.Secrets.Redact("first-access-token"); got != "first-access-token" {
+		t.Errorf("renewed token is still redacted")
+	}
+	if got := flow.Secrets.Redact("second-access-token"); got != flow.Redacted {
+		t.Errorf("current token is not redacted: %q", got)
+	}
+}
@@ -0,0 +1,342 @@
+package operator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// FlowReconciler runs NodePropFlows. A run starts when the flow's
+// RunAnnotation changes or its schedule falls due, and its execution is
+// kept in the resource's status as it progresses, which is also where an
+// operator that restarted resumes it from. A flow runs once at a time:
+// a request made during a run starts another when it finishes, and a
+// scheduled run due during one is skipped. Deleting the resource cancels
+// its run.
+type FlowReconciler struct {
+	Client   client.Client
+	Registry *flow.RepositoryRegistry
+	// Runner runs the steps; it is usually a *flow.FlowRunner.
+	Runner   flow.StepRunner
+	Notifier flow.Notifier
+	Clock    flow.Clock
+	Logger   flow.Logger
+
+	mu sync.Mutex
+	// ctx is the operator's, which runs outlive reconciles under; it is
+	// set by Start.
+	ctx  context.Context
+	runs map[types.NamespacedName]*flowRun
+	wg   sync.WaitGroup
+}
+
+// flowRun is a running execution of a flow.
+type flowRun struct {
+	cancel context.CancelFunc
+}
+
+// Start implements manager.Runnable: it lets runs start, and when ctx is
+// done waits for them to stop. An interrupted run stays unfinished in its
+// resource's status and is resumed by the next operator to start.
+func (r *FlowReconciler) Start(ctx context.Context) error {
+	r.mu.Lock()
+	r.ctx = ctx
+	r.mu.Unlock()
+	<-ctx.Done()
+	r.wg.Wait()
+	return nil
+}
+
+// Reconcile implements reconcile.Reconciler.
+func (r *FlowReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	u := newObject(KindFlow)
+	if err := r.Client.Get(ctx, req.NamespacedName, u); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.cancel(req.NamespacedName)
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	if u.GetDeletionTimestamp() != nil {
+		r.cancel(req.NamespacedName)
+		return ctrl.Result{}, nil
+	}
+	r.mu.Lock()
+	started := r.ctx != nil
+	r.mu.Unlock()
+	if !started {
+		return ctrl.Result{RequeueAfter: time.Second}, nil
+	}
+
+	var before, status FlowStatus
+	if err := decodeStatus(u, &before); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := decodeStatus(u, &status); err != nil {
+		return ctrl.Result{}, err
+	}
+	changed := status.ObservedGeneration != u.GetGeneration()
+	status.ObservedGeneration = u.GetGeneration()
+	g, sched, spec, err := r.compile(u)
+	if err != nil {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{Type: ConditionReady, Status: metav1.ConditionFalse, Reason: "Invalid", Message: err.Error(), ObservedGeneration: status.ObservedGeneration})
+		status.NextRunTime = nil
+		return ctrl.Result{}, writeStatus(ctx, r.Client, u, before, status)
+	}
+	status.Digest = spec.Digest()
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{Type: ConditionReady, Status: metav1.ConditionTrue, Reason: "Valid", Message: fmt.Sprintf("flow %s (digest %s)", spec.Name, status.Digest), ObservedGeneration: status.ObservedGeneration})
+
+	now := flow.ClockOr(r.Clock).Now()
+	running := r.running(req.NamespacedName)
+	var start *flow.InboundEvent
+	var resume *flow.FlowExecution
+	switch request := u.GetAnnotations()[RunAnnotation]; {
+	case running:
+	case status.LastExecution != nil && status.LastExecution.FinishedAt.IsZero():
+		// Unfinished here but not running: the operator that ran it
+		// stopped.
+		resume = status.LastExecution
+	case request != "" && request != status.LastRunRequest:
+		status.LastRunRequest = request
+		start = &flow.InboundEvent{Type: "nodeprop_flow", Action: "requested", Delivery: request}
+	}
+
+	var result ctrl.Result
+	if sched == nil || spec.Suspend {
+		status.NextRunTime = nil
+	} else {
+		if status.NextRunTime == nil || changed {
+			status.NextRunTime = &metav1.Time{Time: sched.Next(now)}
+		}
+		if due := status.NextRunTime.Time; !due.After(now) {
+			switch {
+			case running || resume != nil || start != nil:
+				flow.LoggerOr(r.Logger).Info("skipped scheduled run of a running flow", "flow", spec.Name, "resource", req.String(), "due", due)
+			default:
+				start = &flow.InboundEvent{Type: "nodeprop_flow", Action: "scheduled", Delivery: due.UTC().Format(time.RFC3339)}
+			}
+			status.NextRunTime = &metav1.Time{Time: sched.Next(now)}
+		}
+		result.RequeueAfter = status.NextRunTime.Sub(now)
+	}
+	if start != nil || resume != nil {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{Type: ConditionRunning, Status: metav1.ConditionTrue, Reason: "Started", Message: "the flow is running", ObservedGeneration: status.ObservedGeneration})
+	}
+	if err := writeStatus(ctx, r.Client, u, before, status); err != nil {
+		return ctrl.Result{}, err
+	}
+	// The run starts only once the status records it, so that a request
+	// is never acted on twice.
+	switch {
+	case resume != nil:
+		r.start(req.NamespacedName, g, func(ctx context.Context) (*flow.FlowExecution, error) {
+			return g.Resume(ctx, resume, r.Runner)
+		})
+	case start != nil:
+		ev := *start
+		r.start(req.NamespacedName, g, func(ctx context.Context) (*flow.FlowExecution, error) {
+			return g.RunEvent(ctx, ev, r.Runner)
+		})
+	}
+	return result, nil
+}
+
+// compile decodes the spec of u and compiles its flow, whose name
+// defaults to the resource's, and its schedule, if it has one.
+func (r *FlowReconciler) compile(u *unstructured.Unstructured) (*flow.FlowGraph, *flow.CronSchedule, *FlowSpec, error) {
+	spec := &FlowSpec{}
+	if err := decodeSpec(u, spec); err != nil {
+		return nil, nil, nil, err
+	}
+	if spec.Name == "" {
+		spec.Name = u.GetName()
+	}
+	g, err := flow.CompileFlow(&spec.FlowDefinition)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	g.Registry, g.Notifier, g.Clock, g.Logger = r.Registry, r.Notifier, r.Clock, r.Logger
+	var sched *flow.CronSchedule
+	if spec.Schedule != "" {
+		if sched, err = flow.ParseCron(spec.Schedule, spec.Timezone); err != nil {
+			return nil, nil, nil, fmt.Errorf("schedule: %w", err)
+		}
+	} else if spec.Timezone != "" {
+		return nil, nil, nil, errors.New("timezone needs a schedule")
+	}
+	return g, sched, spec, nil
+}
+
+// running reports whether the flow of the resource key is running.
+func (r *FlowReconciler) running(key types.NamespacedName) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.runs[key] != nil
+}
+
+// start runs the flow of the resource key with run, keeping its execution
+// in the resource's status.
+func (r *FlowReconciler) start(key types.NamespacedName, g *flow.FlowGraph, run func(context.Context) (*flow.FlowExecution, error)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.runs == nil {
+		r.runs = map[types.NamespacedName]*flowRun{}
+	}
+	ctx, cancel := context.WithCancel(r.ctx)
+	fr := &flowRun{cancel: cancel}
+	r.runs[key] = fr
+	g.Store = &statusStore{r: r, key: key}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer cancel()
+		exec, err := run(ctx)
+		r.finish(key, fr, exec, err)
+	}()
+}
+
+// cancel stops the run of the resource key, if there is one.
+func (r *FlowReconciler) cancel(key types.NamespacedName) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if run := r.runs[key]; run != nil {
+		run.cancel()
+		delete(r.runs, key)
+		flow.LoggerOr(r.Logger).Info("cancelled the run of a deleted flow", "resource", key.String())
+	}
+}
+
+// finish records the outcome of fr, a run of the resource key, in its
+// conditions. A run stopped by the operator stopping or the resource going
+// is left as it is.
+func (r *FlowReconciler) finish(key types.NamespacedName, fr *flowRun, exec *flow.FlowExecution, err error) {
+	r.mu.Lock()
+	cancelled := r.runs[key] != fr
+	if !cancelled {
+		delete(r.runs, key)
+	}
+	ctx := r.ctx
+	r.mu.Unlock()
+	if cancelled || ctx.Err() != nil {
+		return
+	}
+	if exec == nil && err == nil {
+		err = errors.New("the flow did not run")
+	}
+	uerr := r.updateStatus(ctx, key, func(status *FlowStatus) {
+		if exec != nil {
+			status.LastExecution = exec
+		}
+		running := metav1.Condition{Type: ConditionRunning, Status: metav1.ConditionFalse, Reason: "Finished", Message: "the flow finished", ObservedGeneration: status.ObservedGeneration}
+		succeeded := metav1.Condition{Type: ConditionSucceeded, Status: metav1.ConditionTrue, Reason: "Succeeded", Message: "every step succeeded", ObservedGeneration: status.ObservedGeneration}
+		switch {
+		case exec == nil:
+			// The run never started, as when the definition changed
+			// under an execution to resume.
+			running.Reason, running.Message = "NotStarted", err.Error()
+			succeeded.Status, succeeded.Reason, succeeded.Message = metav1.ConditionFalse, "NotStarted", err.Error()
+		case exec.Status() == flow.FlowFailed:
+			msg := "the flow failed"
+			if err != nil {
+				msg = err.Error()
+			}
+			succeeded.Status, succeeded.Reason, succeeded.Message = metav1.ConditionFalse, "Failed", msg
+		}
+		meta.SetStatusCondition(&status.Conditions, running)
+		meta.SetStatusCondition(&status.Conditions, succeeded)
+		if exec == nil && status.LastExecution != nil && status.LastExecution.FinishedAt.IsZero() {
+			// Give up on it, or every reconcile would try it again.
+			status.LastExecution.FinishedAt = flow.ClockOr(r.Clock).Now()
+		}
+	})
+	if uerr != nil && !apierrors.IsNotFound(uerr) {
+		flow.LoggerOr(r.Logger).Error("failed to record the end of a flow run", "resource", key.String(), "error", uerr)
+	}
+}
+
+// updateStatus applies update to the status of the resource key, retrying
+// on conflicts with other writers.
+func (r *FlowReconciler) updateStatus(ctx context.Context, key types.NamespacedName, update func(*FlowStatus)) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		u := newObject(KindFlow)
+		if err := r.Client.Get(ctx, key, u); err != nil {
+			return err
+		}
+		var before, status FlowStatus
+		if err := decodeStatus(u, &before); err != nil {
+			return err
+		}
+		if err := decodeStatus(u, &status); err != nil {
+			return err
+		}
+		update(&status)
+		return writeStatus(ctx, r.Client, u, before, status)
+	})
+}
+
+// statusStore is the flow.FlowStore of a resource's run: the execution
+// lives in its status as LastExecution.
+type statusStore struct {
+	r   *FlowReconciler
+	key types.NamespacedName
+}
+
+func (s *statusStore) Save(exec *flow.FlowExecution) error {
+	s.r.mu.Lock()
+	ctx := s.r.ctx
+	s.r.mu.Unlock()
+	err := s.r.updateStatus(ctx, s.key, func(status *FlowStatus) { status.LastExecution = exec })
+	if apierrors.IsNotFound(err) {
+		// The resource was deleted, which cancels the run.
+		return nil
+	}
+	return err
+}
+
+func (s *statusStore) Get(id string) (*flow.FlowExecution, error) {
+	exec, err := s.last()
+	if err != nil {
+		return nil, err
+	}
+	if exec == nil || exec.ID != id {
+		return nil, fmt.Errorf("execution %s not found", id)
+	}
+	return exec, nil
+}
+
+func (s *statusStore) List() ([]flow.FlowExecution, error) {
+	exec, err := s.last()
+	if err != nil || exec == nil {
+		return nil, err
+	}
+	return []flow.FlowExecution{*exec}, nil
+}
+
+// last returns the LastExecution of the resource, or nil.
+func (s *statusStore) last() (*flow.FlowExecution, error) {
+	s.r.mu.Lock()
+	ctx := s.r.ctx
+	s.r.mu.Unlock()
+	u := newObject(KindFlow)
+	if err := s.r.Client.Get(ctx, s.key, u); err != nil {
+		return nil, err
+	}
+	var status FlowStatus
+	if err := decodeStatus(u, &status); err != nil {
+		return nil, err
+	}
+	return status.LastExecution, nil
+}
@@ -0,0 +1,82 @@
+package operator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// Operator reconciles NodePropRepos into Registry, dispatches their
+// schedules, and runs NodePropFlows against it.
+type Operator struct {
+	// Registry holds the repositories of the NodePropRepos, and what the
+	// flows' selectors and When expressions see.
+	Registry   *flow.RepositoryRegistry
+	Correlator *flow.RunCorrelator
+	// Notifier receives the events of flow steps whose OnFailure asks to
+	// notify.
+	Notifier flow.Notifier
+	Logger   flow.Logger
+}
+
+// New creates an Operator dispatching with correlator, with an empty
+// registry for NodePropRepos to fill.
+func New(correlator *flow.RunCorrelator) *Operator {
+	return &Operator{Registry: flow.NewRepositoryRegistry(), Correlator: correlator}
+}
+
+// SetupWithManager adds the controllers of both kinds and the scheduler of
+// the NodePropRepos' schedules to mgr. The scheduler and flow runs only
+// run in the leader, if mgr elects one.
+func (o *Operator) SetupWithManager(mgr ctrl.Manager) error {
+	repos := &RepoReconciler{Client: mgr.GetClient(), Registry: o.Registry, Logger: o.Logger}
+	if err := ctrl.NewControllerManagedBy(mgr).For(newObject(KindRepo)).Complete(repos); err != nil {
+		return err
+	}
+	flows := &FlowReconciler{
+		Client:   mgr.GetClient(),
+		Registry: o.Registry,
+		Runner:   &flow.FlowRunner{Correlator: o.Correlator, Registry: o.Registry},
+		Notifier: o.Notifier,
+		Clock:    o.Correlator.Clock,
+		Logger:   o.Logger,
+	}
+	if err := mgr.Add(flows); err != nil {
+		return err
+	}
+	if err := ctrl.NewControllerManagedBy(mgr).For(newObject(KindFlow)).Complete(flows); err != nil {
+		return err
+	}
+	s := flow.NewScheduler(o.Registry, o.Correlator)
+	s.OnError = func(err error) { flow.LoggerOr(o.Logger).Error("schedule failed", "error", err) }
+	return mgr.Add(manager.RunnableFunc(s.Run))
+}
+
+// writeStatus writes status as the status of u, unless it is unchanged
+// from before, so that a reconcile with nothing to report does not cause
+// another. The statuses are compared as the JSON they are stored as:
+// equality.Semantic panics on the time.Time fields of a FlowExecution.
+func writeStatus(ctx context.Context, c client.Client, u *unstructured.Unstructured, before, status interface{}) error {
+	old, err := json.Marshal(before)
+	if err != nil {
+		return err
+	}
+	now, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(old, now) {
+		return nil
+	}
+	if err := encodeStatus(u, status); err != nil {
+		return err
+	}
+	return c.Status().Update(ctx, u)
+}
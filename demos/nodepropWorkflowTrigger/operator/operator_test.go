@@ -0,0 +1,483 @@
+package operator
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+// newClient returns a fake API server client holding objs, with both kinds
+// and their status subresources.
+func newClient(objs ...client.Object) client.Client {
+	s := runtime.NewScheme()
+	for _, kind := range []string{KindRepo, KindFlow} {
+		s.AddKnownTypeWithName(GroupVersion.WithKind(kind), &unstructured.Unstructured{})
+		s.AddKnownTypeWithName(GroupVersion.WithKind(kind+"List"), &unstructured.UnstructuredList{})
+	}
+	return fake.NewClientBuilder().WithScheme(s).WithObjects(objs...).WithStatusSubresource(newObject(KindRepo), newObject(KindFlow)).Build()
+}
+
+// resource returns an object of kind in the default namespace.
+func resource(kind, name string, spec map[string]interface{}) *unstructured.Unstructured {
+	u := newObject(kind)
+	u.SetNamespace("default")
+	u.SetName(name)
+	u.Object["spec"] = spec
+	return u
+}
+
+func request(name string) ctrl.Request {
+	return ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: name}}
+}
+
+func TestRepoReconciler(t *testing.T) {
+	api := resource(KindRepo, "api", map[string]interface{}{
+		"name": "Cdaprod/api",
+		"tags": []interface{}{"prod"},
+		"schedules": []interface{}{
+			map[string]interface{}{"name": "nightly", "cron": "0 3 * * *", "workflow": "deploy.yml"},
+			map[string]interface{}{"name": "hourly", "cron": "@hourly", "workflow": "check.yml"},
+		},
+	})
+	c := newClient(api)
+	reg := flow.NewRepositoryRegistry()
+	r := &RepoReconciler{Client: c, Registry: reg}
+	ctx := context.Background()
+	reconcile := func(name string) RepoStatus {
+		t.Helper()
+		if _, err := r.Reconcile(ctx, request(name)); err != nil {
+			t.Fatalf("Reconcile(%s) error = %v", name, err)
+		}
+		u := newObject(KindRepo)
+		if err := c.Get(ctx, request(name).NamespacedName, u); err != nil {
+			t.Fatal(err)
+		}
+		var status RepoStatus
+		if err := decodeStatus(u, &status); err != nil {
+			t.Fatal(err)
+		}
+		return status
+	}
+	schedules := func() []string {
+		var names []string
+		for _, e := range reg.Schedules() {
+			names = append(names, e.Name+" "+e.Repo)
+		}
+		slices.Sort(names)
+		return names
+	}
+
+	status := reconcile("api")
+	if !meta.IsStatusConditionTrue(status.Conditions, ConditionReady) || !slices.Equal(status.Schedules, []string{"default/api/hourly", "default/api/nightly"}) {
+		t.Errorf("status = %+v, want ready with both schedules", status)
+	}
+	if e, ok := reg.Get("Cdaprod/api"); !ok || !slices.Equal(e.Tags, []string{"prod"}) {
+		t.Errorf("registry entry = %+v, %v", e, ok)
+	}
+	if got, want := schedules(), []string{"default/api/hourly Cdaprod/api", "default/api/nightly Cdaprod/api"}; !slices.Equal(got, want) {
+		t.Errorf("schedules = %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		name    string
+		spec    map[string]interface{}
+		wantErr string
+	}{
+		{name: "bare name", spec: map[string]interface{}{"name": "api"}, wantErr: `repository "api" must be owner/repo`},
+		{name: "same repository", spec: map[string]interface{}{"name": "Cdaprod/api"}, wantErr: "Cdaprod/api is already registered by default/api"},
+		{
+			name: "schedule twice",
+			spec: map[string]interface{}{"name": "Cdaprod/web", "schedules": []interface{}{
+				map[string]interface{}{"name": "nightly", "cron": "@daily", "workflow": "a.yml"},
+				map[string]interface{}{"name": "nightly", "cron": "@daily", "workflow": "b.yml"},
+			}},
+			wantErr: "schedule nightly is defined twice",
+		},
+		{
+			name: "invalid cron",
+			spec: map[string]interface{}{"name": "Cdaprod/web", "schedules": []interface{}{
+				map[string]interface{}{"name": "nightly", "cron": "at night", "workflow": "a.yml"},
+			}},
+			wantErr: "at night",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := c.Create(ctx, resource(KindRepo, "other", tt.spec)); err != nil {
+				t.Fatal(err)
+			}
+			defer c.Delete(ctx, resource(KindRepo, "other", nil))
+			status := reconcile("other")
+			cond := meta.FindStatusCondition(status.Conditions, ConditionReady)
+			if cond == nil || cond.Status != metav1.ConditionFalse || !strings.Contains(cond.Message, tt.wantErr) {
+				t.Errorf("Ready = %+v, want false with %q", cond, tt.wantErr)
+			}
+			if _, ok := reg.Get("Cdaprod/web"); ok {
+				t.Error("an invalid resource was registered")
+			}
+		})
+	}
+
+	// Dropping a schedule and renaming the repository replaces what the
+	// resource registered.
+	if err := c.Get(ctx, request("api").NamespacedName, api); err != nil {
+		t.Fatal(err)
+	}
+	api.Object["spec"] = map[string]interface{}{
+		"name":      "Cdaprod/api2",
+		"schedules": []interface{}{map[string]interface{}{"name": "nightly", "cron": "0 3 * * *", "workflow": "deploy.yml"}},
+	}
+	if err := c.Update(ctx, api); err != nil {
+		t.Fatal(err)
+	}
+	reconcile("api")
+	if _, ok := reg.Get("Cdaprod/api"); ok {
+		t.Error("the old repository is still registered")
+	}
+	if got, want := schedules(), []string{"default/api/nightly Cdaprod/api2"}; !slices.Equal(got, want) {
+		t.Errorf("schedules = %v, want %v", got, want)
+	}
+
+	if err := c.Delete(ctx, api); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, request("api")); err != nil {
+		t.Fatal(err)
+	}
+	if len(reg.Repos()) != 0 || len(reg.Schedules()) != 0 {
+		t.Errorf("registry after deletion = %+v, %+v", reg.Repos(), reg.Schedules())
+	}
+}
+
+// stepRunnerFunc is a flow.StepRunner recording the steps it ran.
+type stepRunnerFunc func(ctx context.Context, step flow.FlowStep) ([]flow.StepRun, error)
+
+func (f stepRunnerFunc) RunStep(ctx context.Context, step flow.FlowStep) ([]flow.StepRun, error) {
+	return f(ctx, step)
+}
+
+// recordSteps returns a runner recording the steps it ran and failing the
+// named ones.
+func recordSteps(fail ...string) (flow.StepRunner, func() []string) {
+	var mu sync.Mutex
+	var ran []string
+	runner := stepRunnerFunc(func(ctx context.Context, step flow.FlowStep) ([]flow.StepRun, error) {
+		mu.Lock()
+		ran = append(ran, step.Name)
+		mu.Unlock()
+		if slices.Contains(fail, step.Name) {
+			return nil, errors.New(step.Name + " failed")
+		}
+		return nil, nil
+	})
+	return runner, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), ran...)
+	}
+}
+
+// flowSpec is the spec of a NodePropFlow running build then deploy.
+func flowSpec() map[string]interface{} {
+	step := func(name string, needs ...interface{}) map[string]interface{} {
+		return map[string]interface{}{"name": name, "provider": flow.ProviderWorkflowDispatch, "repo": "Cdaprod/api", "workflow": name + ".yml", "needs": needs}
+	}
+	return map[string]interface{}{"steps": []interface{}{step("build"), step("deploy", "build")}}
+}
+
+// startFlows starts r, stopping it when the test ends.
+func startFlows(t *testing.T, r *FlowReconciler) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Start(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	for {
+		r.mu.Lock()
+		started := r.ctx != nil
+		r.mu.Unlock()
+		if started {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// flowStatus returns the status of the flow name once done reports true of
+// it.
+func flowStatus(t *testing.T, c client.Client, name string, done func(FlowStatus) bool) FlowStatus {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		u := newObject(KindFlow)
+		if err := c.Get(context.Background(), request(name).NamespacedName, u); err != nil {
+			t.Fatal(err)
+		}
+		var status FlowStatus
+		if err := decodeStatus(u, &status); err != nil {
+			t.Fatal(err)
+		}
+		if done(status) {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("status = %+v", status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// finished reports whether a run of the flow has finished.
+func finished(s FlowStatus) bool {
+	return meta.IsStatusConditionFalse(s.Conditions, ConditionRunning)
+}
+
+func TestFlowReconciler(t *testing.T) {
+	spec := flowSpec()
+	digest := func() string {
+		f := &FlowSpec{}
+		if err := decodeSpec(resource(KindFlow, "release", spec), f); err != nil {
+			t.Fatal(err)
+		}
+		f.Name = "release"
+		return f.Digest()
+	}()
+	// unfinished is an execution whose operator stopped during deploy.
+	unfinished := func(digest string) map[string]interface{} {
+		exec := &flow.FlowExecution{
+			ID: "11111111-1111-4111-8111-111111111111", Flow: "release", Digest: digest, StartedAt: time.Now(),
+			Steps: []flow.StepState{{Name: "build", Status: flow.StepSucceeded}, {Name: "deploy", Status: flow.StepRunning}},
+		}
+		u := newObject(KindFlow)
+		if err := encodeStatus(u, FlowStatus{LastExecution: exec}); err != nil {
+			t.Fatal(err)
+		}
+		return u.Object["status"].(map[string]interface{})
+	}
+	tests := []struct {
+		name       string
+		spec       map[string]interface{}
+		annotation string
+		status     map[string]interface{}
+		fail       []string
+		wantReady  string
+		wantRan    []string
+		// wantSucceeded is the Succeeded condition's reason and message.
+		wantSucceeded [2]string
+		wantID        string
+	}{
+		{name: "no request", spec: spec},
+		{
+			name:          "requested",
+			spec:          spec,
+			annotation:    "2024-03-01T12:00:00Z",
+			wantRan:       []string{"build", "deploy"},
+			wantSucceeded: [2]string{"Succeeded", "every step succeeded"},
+		},
+		{
+			name:          "failed",
+			spec:          spec,
+			annotation:    "1",
+			fail:          []string{"build"},
+			wantRan:       []string{"build"},
+			wantSucceeded: [2]string{"Failed", "step build: build failed"},
+		},
+		{
+			name:          "resumed",
+			spec:          spec,
+			status:        unfinished(digest),
+			wantRan:       []string{"deploy"},
+			wantSucceeded: [2]string{"Succeeded", "every step succeeded"},
+			wantID:        "11111111-1111-4111-8111-111111111111",
+		},
+		{
+			name:          "changed under a run",
+			spec:          spec,
+			status:        unfinished("000000000000"),
+			wantSucceeded: [2]string{"NotStarted", "started with another definition of flow release"},
+			wantID:        "11111111-1111-4111-8111-111111111111",
+		},
+		{name: "invalid", spec: map[string]interface{}{}, annotation: "1", wantReady: "flow release has no steps"},
+		{name: "timezone without schedule", spec: map[string]interface{}{"steps": spec["steps"], "timezone": "UTC"}, wantReady: "timezone needs a schedule"},
+		{name: "invalid schedule", spec: map[string]interface{}{"steps": spec["steps"], "schedule": "daily"}, wantReady: "schedule:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := resource(KindFlow, "release", tt.spec)
+			if tt.annotation != "" {
+				u.SetAnnotations(map[string]string{RunAnnotation: tt.annotation})
+			}
+			if tt.status != nil {
+				u.Object["status"] = tt.status
+			}
+			c := newClient(u)
+			runner, ran := recordSteps(tt.fail...)
+			r := &FlowReconciler{Client: c, Registry: flow.NewRepositoryRegistry(), Runner: runner}
+			startFlows(t, r)
+			if _, err := r.Reconcile(context.Background(), request("release")); err != nil {
+				t.Fatal(err)
+			}
+			status := flowStatus(t, c, "release", func(s FlowStatus) bool { return tt.wantSucceeded[0] == "" || finished(s) })
+			ready := meta.FindStatusCondition(status.Conditions, ConditionReady)
+			if tt.wantReady != "" {
+				if ready == nil || ready.Status != metav1.ConditionFalse || !strings.Contains(ready.Message, tt.wantReady) {
+					t.Errorf("Ready = %+v, want false with %q", ready, tt.wantReady)
+				}
+			} else if ready == nil || ready.Status != metav1.ConditionTrue || status.Digest != digest {
+				t.Errorf("Ready = %+v, digest %s; want true, %s", ready, status.Digest, digest)
+			}
+			if got := ran(); !slices.Equal(got, tt.wantRan) {
+				t.Errorf("ran %v, want %v", got, tt.wantRan)
+			}
+			if status.LastRunRequest != tt.annotation && tt.wantReady == "" {
+				t.Errorf("last run request = %q, want %q", status.LastRunRequest, tt.annotation)
+			}
+			succeeded := meta.FindStatusCondition(status.Conditions, ConditionSucceeded)
+			if tt.wantSucceeded[0] == "" {
+				if succeeded != nil || status.LastExecution != nil {
+					t.Errorf("status = %+v, want no run", status)
+				}
+				return
+			}
+			if succeeded == nil || succeeded.Reason != tt.wantSucceeded[0] || !strings.Contains(succeeded.Message, tt.wantSucceeded[1]) {
+				t.Errorf("Succeeded = %+v, want %v", succeeded, tt.wantSucceeded)
+			}
+			exec := status.LastExecution
+			if exec == nil || exec.FinishedAt.IsZero() || (tt.wantID != "" && exec.ID != tt.wantID) {
+				t.Fatalf("last execution = %+v, want it finished", exec)
+			}
+			if tt.annotation != "" && (exec.Event.Action != "requested" || exec.Event.Delivery != tt.annotation) {
+				t.Errorf("event = %+v, want the request", exec.Event)
+			}
+
+			// The request has been acted on.
+			if _, err := r.Reconcile(context.Background(), request("release")); err != nil {
+				t.Fatal(err)
+			}
+			flowStatus(t, c, "release", finished)
+			if got := ran(); !slices.Equal(got, tt.wantRan) {
+				t.Errorf("ran %v after another reconcile, want %v", got, tt.wantRan)
+			}
+		})
+	}
+}
+
+func TestFlowReconcilerSchedule(t *testing.T) {
+	spec := flowSpec()
+	spec["schedule"], spec["timezone"] = "0 9 * * *", "Europe/Paris"
+	c := newClient(resource(KindFlow, "release", spec))
+	clock := nodeproptest.NewClock(time.Date(2024, 3, 1, 7, 0, 0, 0, time.UTC))
+	runner, ran := recordSteps()
+	r := &FlowReconciler{Client: c, Registry: flow.NewRepositoryRegistry(), Runner: runner, Clock: clock}
+	startFlows(t, r)
+	ctx := context.Background()
+
+	// 09:00 in Paris is 08:00 UTC in March.
+	due := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	result, err := r.Reconcile(ctx, request("release"))
+	if err != nil || result.RequeueAfter != time.Hour {
+		t.Fatalf("Reconcile() = %+v, %v; want a requeue when the run is due", result, err)
+	}
+	status := flowStatus(t, c, "release", func(s FlowStatus) bool { return s.NextRunTime != nil })
+	if !status.NextRunTime.Time.Equal(due) || len(ran()) != 0 {
+		t.Fatalf("status = %+v, ran %v; want the next run at %s", status, ran(), due)
+	}
+
+	clock.Advance(time.Hour)
+	result, err = r.Reconcile(ctx, request("release"))
+	if err != nil || result.RequeueAfter != 24*time.Hour {
+		t.Fatalf("Reconcile() when due = %+v, %v", result, err)
+	}
+	status = flowStatus(t, c, "release", finished)
+	if exec := status.LastExecution; exec == nil || exec.Event.Action != "scheduled" || exec.Event.Delivery != "2024-03-01T08:00:00Z" || !exec.Succeeded() {
+		t.Errorf("last execution = %+v, want the scheduled run", exec)
+	}
+	if !status.NextRunTime.Time.Equal(due.Add(24*time.Hour)) || len(ran()) != 2 {
+		t.Errorf("status = %+v, ran %v", status, ran())
+	}
+
+	// A suspended flow is not scheduled.
+	u := newObject(KindFlow)
+	if err := c.Get(ctx, request("release").NamespacedName, u); err != nil {
+		t.Fatal(err)
+	}
+	if err := unstructured.SetNestedField(u.Object, true, "spec", "suspend"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Update(ctx, u); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := r.Reconcile(ctx, request("release")); err != nil || result.RequeueAfter != 0 {
+		t.Fatalf("Reconcile() of a suspended flow = %+v, %v", result, err)
+	}
+	if status := flowStatus(t, c, "release", func(FlowStatus) bool { return true }); status.NextRunTime != nil {
+		t.Errorf("next run of a suspended flow = %v", status.NextRunTime)
+	}
+}
+
+func TestFlowReconcilerNotStarted(t *testing.T) {
+	c := newClient(resource(KindFlow, "release", flowSpec()))
+	runner, _ := recordSteps()
+	r := &FlowReconciler{Client: c, Registry: flow.NewRepositoryRegistry(), Runner: runner}
+	if result, err := r.Reconcile(context.Background(), request("release")); err != nil || result.RequeueAfter != time.Second {
+		t.Errorf("Reconcile() before Start = %+v, %v; want a requeue", result, err)
+	}
+}
+
+func TestFlowReconcilerDeleted(t *testing.T) {
+	u := resource(KindFlow, "release", flowSpec())
+	u.SetAnnotations(map[string]string{RunAnnotation: "1"})
+	c := newClient(u)
+	started := make(chan struct{})
+	stopped := make(chan error, 1)
+	runner := stepRunnerFunc(func(ctx context.Context, step flow.FlowStep) ([]flow.StepRun, error) {
+		close(started)
+		<-ctx.Done()
+		stopped <- ctx.Err()
+		return nil, ctx.Err()
+	})
+	r := &FlowReconciler{Client: c, Registry: flow.NewRepositoryRegistry(), Runner: runner}
+	startFlows(t, r)
+	ctx := context.Background()
+	if _, err := r.Reconcile(ctx, request("release")); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if !r.running(request("release").NamespacedName) {
+		t.Fatal("the flow is not running")
+	}
+	if err := c.Delete(ctx, u); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, request("release")); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-stopped; !errors.Is(err, context.Canceled) {
+		t.Errorf("step context error = %v, want it cancelled", err)
+	}
+	if r.running(request("release").NamespacedName) {
+		t.Error("the run of a deleted flow is still running")
+	}
+}
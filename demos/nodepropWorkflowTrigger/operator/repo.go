@@ -0,0 +1,164 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// RepoReconciler keeps a NodePropRepo's entry and schedules in Registry,
+// and removes them when the resource is deleted. Two resources may not
+// register the same repository; the later one is not Ready until the
+// other goes.
+type RepoReconciler struct {
+	Client   client.Client
+	Registry *flow.RepositoryRegistry
+	Logger   flow.Logger
+
+	mu sync.Mutex
+	// owned is what each resource put in Registry.
+	owned map[types.NamespacedName]repoOwned
+}
+
+// repoOwned is a resource's repository and the names of its schedules.
+type repoOwned struct {
+	repo      string
+	schedules []string
+}
+
+// Reconcile implements reconcile.Reconciler.
+func (r *RepoReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	u := newObject(KindRepo)
+	if err := r.Client.Get(ctx, req.NamespacedName, u); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.forget(req.NamespacedName)
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	if u.GetDeletionTimestamp() != nil {
+		r.forget(req.NamespacedName)
+		return ctrl.Result{}, nil
+	}
+	var before, status RepoStatus
+	if err := decodeStatus(u, &before); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := decodeStatus(u, &status); err != nil {
+		return ctrl.Result{}, err
+	}
+	status.ObservedGeneration = u.GetGeneration()
+
+	var spec RepoSpec
+	entries, err := r.entries(u, &spec)
+	if err == nil {
+		err = r.apply(req.NamespacedName, spec.RepoEntry, entries)
+	}
+	if err != nil {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{Type: ConditionReady, Status: metav1.ConditionFalse, Reason: "Invalid", Message: err.Error(), ObservedGeneration: status.ObservedGeneration})
+	} else {
+		status.Schedules = status.Schedules[:0]
+		for _, e := range entries {
+			status.Schedules = append(status.Schedules, e.Name)
+		}
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{Type: ConditionReady, Status: metav1.ConditionTrue, Reason: "Registered", Message: "registered " + spec.Name, ObservedGeneration: status.ObservedGeneration})
+	}
+	return ctrl.Result{}, writeStatus(ctx, r.Client, u, before, status)
+}
+
+// entries decodes the spec of u into spec and returns its schedules as
+// registry entries, named <namespace>/<name>/<schedule> so that those of
+// different resources never clash.
+func (r *RepoReconciler) entries(u *unstructured.Unstructured, spec *RepoSpec) ([]flow.ScheduleEntry, error) {
+	if err := decodeSpec(u, spec); err != nil {
+		return nil, err
+	}
+	if owner, name, ok := strings.Cut(spec.Name, "/"); !ok || owner == "" || name == "" {
+		return nil, fmt.Errorf("repository %q must be owner/repo", spec.Name)
+	}
+	// A scratch registry validates the schedules before any is applied.
+	check := flow.NewRepositoryRegistry()
+	seen := map[string]bool{}
+	var out []flow.ScheduleEntry
+	for _, e := range spec.Schedules {
+		if seen[e.Name] {
+			return nil, fmt.Errorf("schedule %s is defined twice", e.Name)
+		}
+		seen[e.Name] = true
+		if e.Repo == "" {
+			e.Repo = spec.Name
+		}
+		if e.Name != "" {
+			e.Name = u.GetNamespace() + "/" + u.GetName() + "/" + e.Name
+		}
+		if err := check.SetSchedule(e); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// apply puts entry and schedules in the registry for the resource key,
+// replacing what it had put there before.
+func (r *RepoReconciler) apply(key types.NamespacedName, entry flow.RepoEntry, schedules []flow.ScheduleEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.owned == nil {
+		r.owned = map[types.NamespacedName]repoOwned{}
+	}
+	for other, o := range r.owned {
+		if other != key && o.repo == entry.Name {
+			return fmt.Errorf("%s is already registered by %s", entry.Name, other)
+		}
+	}
+	prev := r.owned[key]
+	if prev.repo != "" && prev.repo != entry.Name {
+		r.Registry.RemoveRepo(prev.repo)
+	}
+	r.Registry.SetRepo(entry)
+	keep := map[string]bool{}
+	now := repoOwned{repo: entry.Name}
+	for _, e := range schedules {
+		// Validated by entries, so SetSchedule cannot fail.
+		_ = r.Registry.SetSchedule(e)
+		keep[e.Name] = true
+		now.schedules = append(now.schedules, e.Name)
+	}
+	for _, name := range prev.schedules {
+		if !keep[name] {
+			_ = r.Registry.RemoveSchedule(name)
+		}
+	}
+	r.owned[key] = now
+	return nil
+}
+
+// forget removes what the resource key put in the registry.
+func (r *RepoReconciler) forget(key types.NamespacedName) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	o, ok := r.owned[key]
+	if !ok {
+		return
+	}
+	r.Registry.RemoveRepo(o.repo)
+	for _, name := range o.schedules {
+		_ = r.Registry.RemoveSchedule(name)
+	}
+	delete(r.owned, key)
+	flow.LoggerOr(r.Logger).Info("unregistered repository", "repo", o.repo, "resource", key.String())
+}
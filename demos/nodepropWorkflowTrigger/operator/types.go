@@ -0,0 +1,168 @@
+// Package operator is a Kubernetes controller for NodePropRepo and
+// NodePropFlow custom resources, so that repositories and flows can be
+// managed with GitOps: a NodePropRepo becomes a registry entry and its
+// schedules, and a NodePropFlow a flow run on its schedule or on request,
+// whose progress is reported in the resource's status and conditions.
+//
+// The resources are handled as unstructured objects, so the package needs
+// no generated code; crds.yaml installs their definitions.
+package operator
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// GroupVersion is the API group and version of the resources.
+var GroupVersion = schema.GroupVersion{Group: "nodeprop.cdaprod.dev", Version: "v1alpha1"}
+
+// Kinds of the resources.
+const (
+	KindRepo = "NodePropRepo"
+	KindFlow = "NodePropFlow"
+)
+
+// RunAnnotation requests a run of a NodePropFlow: setting it to a new
+// value, such as a timestamp, starts one, once.
+const RunAnnotation = "nodeprop.cdaprod.dev/run"
+
+// Condition types of the resources' status.
+const (
+	// ConditionReady is true once the spec is valid and in effect.
+	ConditionReady = "Ready"
+	// ConditionRunning is true while a NodePropFlow runs.
+	ConditionRunning = "Running"
+	// ConditionSucceeded is whether the last run of a NodePropFlow
+	// succeeded; it is absent before the first.
+	ConditionSucceeded = "Succeeded"
+)
+
+// RepoSpec is the spec of a NodePropRepo: the registry entry, by the
+// RepoEntry field names, and the schedules that dispatch its workflows.
+//
+//	apiVersion: nodeprop.cdaprod.dev/v1alpha1
+//	kind: NodePropRepo
+//	metadata:
+//	  name: api
+//	spec:
+//	  name: Cdaprod/api
+//	  workflows: [deploy.yml]
+//	  tags: [prod]
+//	  schedules:
+//	    - name: nightly
+//	      cron: "0 3 * * *"
+//	      workflow: deploy.yml
+type RepoSpec struct {
+	flow.RepoEntry `yaml:",inline"`
+	// Schedules are ScheduleEntries of the repository; Repo may be left
+	// out.
+	Schedules []flow.ScheduleEntry `yaml:"schedules,omitempty"`
+}
+
+// RepoStatus is the status of a NodePropRepo.
+type RepoStatus struct {
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+	// Schedules are the names the repository's schedules have in the
+	// registry, which are unique across resources.
+	Schedules []string `json:"schedules,omitempty"`
+}
+
+// FlowSpec is the spec of a NodePropFlow: a FlowDefinition, whose name
+// defaults to the resource's, and when to run it.
+//
+//	apiVersion: nodeprop.cdaprod.dev/v1alpha1
+//	kind: NodePropFlow
+//	metadata:
+//	  name: release
+//	spec:
+//	  schedule: "0 9 * * 1-5"
+//	  steps:
+//	    - name: build
+//	      provider: workflow_dispatch
+//	      repo: Cdaprod/api
+//	      workflow: build.yml
+type FlowSpec struct {
+	flow.FlowDefinition `yaml:",inline"`
+	// Schedule is a cron expression on which the flow runs, in Timezone,
+	// UTC if empty. Without one the flow only runs when RunAnnotation
+	// changes.
+	Schedule string `yaml:"schedule,omitempty"`
+	Timezone string `yaml:"timezone,omitempty"`
+	// Suspend stops scheduled runs; requested ones still start.
+	Suspend bool `yaml:"suspend,omitempty"`
+}
+
+// FlowStatus is the status of a NodePropFlow.
+type FlowStatus struct {
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+	// Digest is that of the definition in effect.
+	Digest      string       `json:"digest,omitempty"`
+	NextRunTime *metav1.Time `json:"nextRunTime,omitempty"`
+	// LastRunRequest is the RunAnnotation value last acted on.
+	LastRunRequest string `json:"lastRunRequest,omitempty"`
+	// LastExecution is the current or last run, updated as its steps
+	// progress.
+	LastExecution *flow.FlowExecution `json:"lastExecution,omitempty"`
+}
+
+// newObject returns an empty object of kind.
+func newObject(kind string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(GroupVersion.WithKind(kind))
+	return u
+}
+
+// decodeSpec decodes the spec of u into out. It goes through YAML, as
+// definition files do, so that durations such as 30m decode as they do
+// there.
+func decodeSpec(u *unstructured.Unstructured, out interface{}) error {
+	spec, _, err := unstructured.NestedMap(u.Object, "spec")
+	if err != nil {
+		return fmt.Errorf("invalid spec: %w", err)
+	}
+	data, err := yaml.Marshal(spec)
+	if err != nil {
+		return fmt.Errorf("invalid spec: %w", err)
+	}
+	if err := yaml.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("invalid spec: %w", err)
+	}
+	return nil
+}
+
+// decodeStatus decodes the status of u into out; a missing status leaves
+// out as it is.
+func decodeStatus(u *unstructured.Unstructured, out interface{}) error {
+	status, ok := u.Object["status"]
+	if !ok {
+		return nil
+	}
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// encodeStatus sets the status of u to status.
+func encodeStatus(u *unstructured.Unstructured, status interface{}) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	u.Object["status"] = m
+	return nil
+}
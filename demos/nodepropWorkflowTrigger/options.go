@@ -0,0 +1,75 @@
+package flow
+
+import "net/http"
+
+// Option configures a trigger made by NewGitHubWorkflowDispatch,
+// NewGitHubRepoDispatch, or NewWebhookTrigger. An option a trigger has no
+// use for, such as WithRef for a webhook, is ignored, so one list of
+// options can configure several kinds of trigger.
+type Option func(*triggerOptions)
+
+// triggerOptions collects the settings of the options given to a
+// constructor.
+type triggerOptions struct {
+	ref        string
+	baseURL    string
+	httpClient *http.Client
+	retry      RetryPolicy
+	logger     Logger
+}
+
+// WithRef sets the branch or tag a workflow runs on.
+func WithRef(ref string) Option {
+	return func(o *triggerOptions) { o.ref = ref }
+}
+
+// WithBaseURL sets the REST endpoint of a GitHub trigger, e.g. a GHES
+// instance's https://github.example.com/api/v3.
+func WithBaseURL(url string) Option {
+	return func(o *triggerOptions) { o.baseURL = url }
+}
+
+// WithHTTPClient sets the client requests are sent with.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(o *triggerOptions) { o.httpClient = hc }
+}
+
+// WithRetry retries deliveries that fail as p allows, such as
+// DefaultRetryPolicy.
+func WithRetry(p RetryPolicy) Option {
+	return func(o *triggerOptions) { o.retry = p }
+}
+
+// WithLogger sets the logger that receives each delivery's status.
+func WithLogger(l Logger) Option {
+	return func(o *triggerOptions) { o.logger = l }
+}
+
+func applyOptions(opts []Option) triggerOptions {
+	var o triggerOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// NewGitHubWorkflowDispatch returns a trigger dispatching workflowFile,
+// configured by opts.
+func NewGitHubWorkflowDispatch(workflowFile string, opts ...Option) *GitHubWorkflowDispatch {
+	o := applyOptions(opts)
+	return &GitHubWorkflowDispatch{WorkflowFile: workflowFile, Ref: o.ref, BaseURL: o.baseURL, HTTPClient: o.httpClient, Retry: o.retry, Logger: o.logger}
+}
+
+// NewGitHubRepoDispatch returns a trigger sending repository_dispatch
+// events of eventType, configured by opts.
+func NewGitHubRepoDispatch(eventType string, opts ...Option) *GitHubRepoDispatch {
+	o := applyOptions(opts)
+	return &GitHubRepoDispatch{EventType: eventType, BaseURL: o.baseURL, HTTPClient: o.httpClient, Retry: o.retry, Logger: o.logger}
+}
+
+// NewWebhookTrigger returns a trigger posting to url, configured by opts.
+// Set Secret on the result to sign its payloads.
+func NewWebhookTrigger(url string, opts ...Option) *WebhookTrigger {
+	o := applyOptions(opts)
+	return &WebhookTrigger{URL: url, HTTPClient: o.httpClient, Retry: o.retry, Logger: o.logger}
+}
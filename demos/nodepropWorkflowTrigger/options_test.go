@@ -0,0 +1,185 @@
+package flow_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+func TestOptionConstructors(t *testing.T) {
+	hc := &http.Client{}
+	retry := flow.RetryPolicy{MaxAttempts: 3}
+	opts := []flow.Option{
+		flow.WithRef("release"),
+		flow.WithBaseURL("https://ghe.example.com/api/v3"),
+		flow.WithHTTPClient(hc),
+		flow.WithRetry(retry),
+		flow.WithLogger(discardLogger),
+	}
+
+	w := flow.NewGitHubWorkflowDispatch("deploy.yml", opts...)
+	if w.WorkflowFile != "deploy.yml" || w.Ref != "release" || w.BaseURL != "https://ghe.example.com/api/v3" || w.HTTPClient != hc || w.Retry.MaxAttempts != 3 || w.Logger != discardLogger {
+		t.Errorf("NewGitHubWorkflowDispatch() = %+v", w)
+	}
+	r := flow.NewGitHubRepoDispatch("deploy", opts...)
+	if r.EventType != "deploy" || r.BaseURL != "https://ghe.example.com/api/v3" || r.HTTPClient != hc || r.Retry.MaxAttempts != 3 || r.Logger != discardLogger {
+		t.Errorf("NewGitHubRepoDispatch() = %+v", r)
+	}
+	// A webhook has no use for the ref or base URL.
+	h := flow.NewWebhookTrigger("https://hooks.example.com", opts...)
+	if h.URL != "https://hooks.example.com" || h.HTTPClient != hc || h.Retry.MaxAttempts != 3 || h.Logger != discardLogger {
+		t.Errorf("NewWebhookTrigger() = %+v", h)
+	}
+
+	// Later options win, and none leaves the zero values.
+	if w := flow.NewGitHubWorkflowDispatch("ci.yml", flow.WithRef("a"), flow.WithRef("b")); w.Ref != "b" {
+		t.Errorf("Ref = %q, want the last option's", w.Ref)
+	}
+	if w := flow.NewGitHubWorkflowDispatch("ci.yml"); w.Ref != "" || w.BaseURL != "" || w.HTTPClient != nil || w.Retry.MaxAttempts != 0 || w.Logger != nil {
+		t.Errorf("NewGitHubWorkflowDispatch() without options = %+v", w)
+	}
+}
+
+func TestTriggerRetry(t *testing.T) {
+	quick := flow.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+	tests := []struct {
+		name         string
+		retry        flow.RetryPolicy
+		fault        *nodeproptest.Fault
+		workflow     string
+		wantErr      bool
+		wantAttempts int
+	}{
+		{name: "no policy", fault: &nodeproptest.Fault{Method: "POST", Status: http.StatusBadGateway, Times: 1}, wantErr: true, wantAttempts: 1},
+		{name: "recovers", retry: quick, fault: &nodeproptest.Fault{Method: "POST", Status: http.StatusBadGateway, Times: 2}, wantAttempts: 3},
+		{name: "rate limited", retry: quick, fault: &nodeproptest.Fault{Method: "POST", Status: http.StatusTooManyRequests, Times: 1}, wantAttempts: 2},
+		{name: "exhausted", retry: quick, fault: &nodeproptest.Fault{Method: "POST", Status: http.StatusBadGateway}, wantErr: true, wantAttempts: 3},
+		{
+			name:         "class budget",
+			retry:        flow.RetryPolicy{MaxAttempts: 5, Backoff: time.Millisecond, Budgets: map[string]int{flow.ErrorServer: 2}},
+			fault:        &nodeproptest.Fault{Method: "POST", Status: http.StatusBadGateway},
+			wantErr:      true,
+			wantAttempts: 2,
+		},
+		{name: "permanent", retry: quick, workflow: "missing.yml", wantErr: true, wantAttempts: 1},
+	}
+	for _, tt := range tests {
+		triggers := map[string]func(url string) flow.ContextTrigger{
+			"workflow": func(url string) flow.ContextTrigger {
+				workflow := tt.workflow
+				if workflow == "" {
+					workflow = "deploy.yml"
+				}
+				return flow.NewGitHubWorkflowDispatch(workflow, flow.WithRef("main"), flow.WithBaseURL(url), flow.WithRetry(tt.retry), flow.WithLogger(discardLogger))
+			},
+			"repository": func(url string) flow.ContextTrigger {
+				return flow.NewGitHubRepoDispatch("deploy", flow.WithBaseURL(url), flow.WithRetry(tt.retry), flow.WithLogger(discardLogger))
+			},
+		}
+		for kind, newTrigger := range triggers {
+			if tt.workflow != "" && kind != "workflow" {
+				continue
+			}
+			t.Run(tt.name+"/"+kind, func(t *testing.T) {
+				gh := nodeproptest.NewServer()
+				defer gh.Close()
+				gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+				if tt.fault != nil {
+					gh.Inject(*tt.fault)
+				}
+				err := newTrigger(gh.URL).TriggerContext(context.Background(), "Cdaprod/site", nil, nodeproptest.DefaultToken)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("TriggerContext() error = %v, want error %v", err, tt.wantErr)
+				}
+				attempts := 0
+				for _, r := range gh.Requests() {
+					if r.Method == "POST" {
+						attempts++
+					}
+				}
+				if attempts != tt.wantAttempts {
+					t.Errorf("made %d attempts, want %d", attempts, tt.wantAttempts)
+				}
+			})
+		}
+	}
+}
+
+func TestWebhookRetryKeepsDelivery(t *testing.T) {
+	var mu sync.Mutex
+	var deliveries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p flow.WebhookPayload
+		json.NewDecoder(r.Body).Decode(&p)
+		mu.Lock()
+		defer mu.Unlock()
+		deliveries = append(deliveries, p.Delivery)
+		if len(deliveries) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	h := flow.NewWebhookTrigger(srv.URL, flow.WithRetry(flow.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}), flow.WithLogger(discardLogger))
+	if err := h.Trigger("Cdaprod/site", nil, ""); err != nil {
+		t.Fatalf("Trigger() error = %v", err)
+	}
+	if len(deliveries) != 3 || deliveries[0] == "" || deliveries[1] != deliveries[0] || deliveries[2] != deliveries[0] {
+		t.Errorf("deliveries = %q, want three attempts of one delivery", deliveries)
+	}
+}
+
+func TestTriggerRetryCancelled(t *testing.T) {
+	gh := nodeproptest.NewServer()
+	defer gh.Close()
+	gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+	gh.Inject(nodeproptest.Fault{Method: "POST", Status: http.StatusBadGateway})
+
+	// The wait before the second attempt outlasts ctx.
+	w := flow.NewGitHubWorkflowDispatch("deploy.yml", flow.WithRef("main"), flow.WithBaseURL(gh.URL), flow.WithRetry(flow.RetryPolicy{MaxAttempts: 3, Backoff: time.Hour}), flow.WithLogger(discardLogger))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := w.TriggerContext(ctx, "Cdaprod/site", nil, nodeproptest.DefaultToken)
+	var apiErr *flow.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway {
+		t.Errorf("TriggerContext() error = %v, want the last attempt's", err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("TriggerContext() returned after %v, want once ctx was done", d)
+	}
+}
+
+func TestTriggerRetryClock(t *testing.T) {
+	gh := nodeproptest.NewServer()
+	defer gh.Close()
+	gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+	gh.Inject(nodeproptest.Fault{Method: "POST", Status: http.StatusBadGateway, Times: 2})
+
+	// An hour of backoff passes on the fake clock alone.
+	clock := nodeproptest.NewClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	retry := flow.RetryPolicy{MaxAttempts: 3, Backoff: time.Hour, Clock: clock}
+	w := flow.NewGitHubWorkflowDispatch("deploy.yml", flow.WithRef("main"), flow.WithBaseURL(gh.URL), flow.WithRetry(retry), flow.WithLogger(discardLogger))
+	done := make(chan error, 1)
+	go func() { done <- w.TriggerContext(context.Background(), "Cdaprod/site", nil, nodeproptest.DefaultToken) }()
+	for _, want := range []time.Duration{time.Hour, 2 * time.Hour} {
+		clock.BlockUntil(1)
+		if d := clock.AdvanceToNext(); d != want {
+			t.Errorf("waited %v before retrying, want %v", d, want)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("TriggerContext() error = %v", err)
+	}
+	if d := gh.Dispatches(); len(d) != 1 {
+		t.Errorf("dispatches = %+v, want the third attempt's", d)
+	}
+}
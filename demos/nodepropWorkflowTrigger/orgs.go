@@ -0,0 +1,96 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Repository is the subset of a GitHub repository used by this package.
+type Repository struct {
+	FullName      string `json:"full_name"`
+	DefaultBranch string `json:"default_branch"`
+	Archived      bool   `json:"archived"`
+	Disabled      bool   `json:"disabled"`
+	Private       bool   `json:"private"`
+	// The fields below are only set by GetRepository and the list calls,
+	// not by GetRepositories.
+	Stars      int                `json:"stargazers_count"`
+	Forks      int                `json:"forks_count"`
+	OpenIssues int                `json:"open_issues_count"`
+	License    *RepositoryLicense `json:"license"`
+	Topics     []string           `json:"topics"`
+	PushedAt   time.Time          `json:"pushed_at"`
+}
+
+// RepositoryLicense is the license GitHub detected in a repository.
+type RepositoryLicense struct {
+	SPDXID string `json:"spdx_id"`
+}
+
+// GetRepository returns repo, as owner/name.
+func (c *GitHubClient) GetRepository(ctx context.Context, repo string) (*Repository, error) {
+	var r Repository
+	if err := c.do(ctx, "GET", "/repos/"+repo, nil, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// ListAccessibleRepos lists the repositories the token can reach: all of
+// the user's for a classic token, the selected ones for a fine-grained
+// token.
+func (c *GitHubClient) ListAccessibleRepos(ctx context.Context) ([]Repository, error) {
+	return c.listRepos(ctx, "/user/repos")
+}
+
+// ListInstallationRepos lists the repositories a GitHub App installation
+// token can reach, and whether the installation was granted all of the
+// account's repositories rather than selected ones.
+func (c *GitHubClient) ListInstallationRepos(ctx context.Context) ([]Repository, bool, error) {
+	const perPage = 100
+	var all []Repository
+	var selection string
+	for page := 1; ; page++ {
+		var out struct {
+			RepositorySelection string       `json:"repository_selection"`
+			Repositories        []Repository `json:"repositories"`
+		}
+		if err := c.do(ctx, "GET", fmt.Sprintf("/installation/repositories?per_page=%d&page=%d", perPage, page), nil, &out); err != nil {
+			return nil, false, err
+		}
+		selection = out.RepositorySelection
+		all = append(all, out.Repositories...)
+		if len(out.Repositories) < perPage {
+			return all, selection == "all", nil
+		}
+	}
+}
+
+// ListOwnerRepos lists every repository of an organization, or of a user if
+// owner is not an organization.
+func (c *GitHubClient) ListOwnerRepos(ctx context.Context, owner string) ([]Repository, error) {
+	repos, err := c.listRepos(ctx, "/orgs/"+owner+"/repos")
+	if IsNotFound(err) {
+		repos, err = c.listRepos(ctx, "/users/"+owner+"/repos")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list repositories of %s: %w", owner, err)
+	}
+	return repos, nil
+}
+
+func (c *GitHubClient) listRepos(ctx context.Context, path string) ([]Repository, error) {
+	const perPage = 100
+	var all []Repository
+	for page := 1; ; page++ {
+		var repos []Repository
+		if err := c.do(ctx, "GET", fmt.Sprintf("%s?per_page=%d&page=%d", path, perPage, page), nil, &repos); err != nil {
+			return nil, err
+		}
+		all = append(all, repos...)
+		if len(repos) < perPage {
+			return all, nil
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// reposServer serves n repositories of owner in pages, as an organization
+// if org is set and as a user otherwise.
+func reposServer(t *testing.T, owner string, n int, org bool) *httptest.Server {
+	t.Helper()
+	page := func(r *http.Request) []Repository {
+		p, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		per, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+		var out []Repository
+		for i := (p - 1) * per; i < min(p*per, n); i++ {
+			out = append(out, Repository{FullName: fmt.Sprintf("%s/repo-%d", owner, i)})
+		}
+		return out
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/orgs/"+owner+"/repos" && org, r.URL.Path == "/users/"+owner+"/repos" && !org, r.URL.Path == "/user/repos":
+			json.NewEncoder(w).Encode(page(r))
+		case r.URL.Path == "/installation/repositories":
+			json.NewEncoder(w).Encode(map[string]interface{}{"repository_selection": "all", "repositories": page(r)})
+		default:
+			http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestListOwnerRepos(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+		org  bool
+	}{
+		{name: "org", n: 3, org: true},
+		{name: "user", n: 3},
+		{name: "one full page", n: 100, org: true},
+		{name: "several pages", n: 250, org: true},
+		{name: "none", org: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewGitHubClient("token")
+			c.BaseURL = reposServer(t, "Cdaprod", tt.n, tt.org).URL
+			repos, err := c.ListOwnerRepos(context.Background(), "Cdaprod")
+			if err != nil {
+				t.Fatalf("ListOwnerRepos() error = %v", err)
+			}
+			if len(repos) != tt.n {
+				t.Fatalf("ListOwnerRepos() returned %d repositories, want %d", len(repos), tt.n)
+			}
+			if tt.n > 0 && repos[tt.n-1].FullName != fmt.Sprintf("Cdaprod/repo-%d", tt.n-1) {
+				t.Errorf("last repository = %s", repos[tt.n-1].FullName)
+			}
+		})
+	}
+
+	c := NewGitHubClient("token")
+	c.BaseURL = reposServer(t, "Cdaprod", 1, true).URL
+	if _, err := c.ListOwnerRepos(context.Background(), "nobody"); !IsNotFound(err) {
+		t.Errorf("ListOwnerRepos() of an unknown owner error = %v, want not found", err)
+	}
+}
+
+func TestListInstallationRepos(t *testing.T) {
+	c := NewGitHubClient("token")
+	c.BaseURL = reposServer(t, "Cdaprod", 120, true).URL
+	repos, all, err := c.ListInstallationRepos(context.Background())
+	if err != nil || len(repos) != 120 || !all {
+		t.Errorf("ListInstallationRepos() = %d repositories, %v, %v; want 120 of all", len(repos), all, err)
+	}
+	accessible, err := c.ListAccessibleRepos(context.Background())
+	if err != nil || len(accessible) != 120 {
+		t.Errorf("ListAccessibleRepos() = %d repositories, %v", len(accessible), err)
+	}
+}
@@ -0,0 +1,84 @@
+// Package pagerduty raises and resolves PagerDuty incidents for nodeprop
+// alerts through the Events API v2.
+package pagerduty
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// DefaultEventsURL is the Events API v2 endpoint.
+const DefaultEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// Events sends alerts to a PagerDuty service. An alert triggers an incident
+// and its resolution resolves it; both share a dedup key made from the
+// rule, so a rule has at most one open incident.
+type Events struct {
+	// RoutingKey is the integration key of the service.
+	RoutingKey string
+	// Severity is critical, error, warning, or info; empty means error.
+	Severity string
+	// URL overrides DefaultEventsURL.
+	URL        string
+	HTTPClient *http.Client
+}
+
+// Alert triggers or resolves the incident for a's rule.
+func (e *Events) Alert(ctx context.Context, a flow.Alert) error {
+	event := map[string]interface{}{
+		"routing_key":  e.RoutingKey,
+		"event_action": "trigger",
+		"dedup_key":    "nodeprop:" + a.Rule,
+	}
+	if a.Resolved {
+		event["event_action"] = "resolve"
+	} else {
+		severity := e.Severity
+		if severity == "" {
+			severity = "error"
+		}
+		event["payload"] = map[string]interface{}{
+			"summary":        a.Summary(),
+			"source":         "nodeprop",
+			"severity":       severity,
+			"timestamp":      a.Time.Format(time.RFC3339),
+			"class":          a.Kind,
+			"custom_details": a,
+		}
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	url := e.URL
+	if url == "" {
+		url = DefaultEventsURL
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	hc := e.HTTPClient
+	if hc == nil {
+		hc = flow.SharedHTTPClient()
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("pagerduty: unexpected status code: %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
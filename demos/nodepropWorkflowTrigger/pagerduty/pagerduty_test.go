@@ -0,0 +1,74 @@
+package pagerduty
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+func TestEvents(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	firing := flow.Alert{Rule: "dlq", Kind: flow.AlertDeadLetters, Value: 12, Threshold: 10, Time: at}
+	resolved := firing
+	resolved.Resolved = true
+	tests := []struct {
+		name         string
+		severity     string
+		alert        flow.Alert
+		status       int
+		wantAction   string
+		wantSeverity string
+		wantErr      bool
+	}{
+		{name: "trigger", alert: firing, status: http.StatusAccepted, wantAction: "trigger", wantSeverity: "error"},
+		{name: "severity", severity: "critical", alert: firing, status: http.StatusAccepted, wantAction: "trigger", wantSeverity: "critical"},
+		{name: "resolve", alert: resolved, status: http.StatusAccepted, wantAction: "resolve"},
+		{name: "invalid key", alert: firing, status: http.StatusBadRequest, wantAction: "trigger", wantSeverity: "error", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got struct {
+				RoutingKey  string `json:"routing_key"`
+				EventAction string `json:"event_action"`
+				DedupKey    string `json:"dedup_key"`
+				Payload     *struct {
+					Summary   string `json:"summary"`
+					Source    string `json:"source"`
+					Severity  string `json:"severity"`
+					Timestamp string `json:"timestamp"`
+					Class     string `json:"class"`
+				} `json:"payload"`
+			}
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewDecoder(r.Body).Decode(&got)
+				w.WriteHeader(tt.status)
+				w.Write([]byte(`{"status": "success"}`))
+			}))
+			defer ts.Close()
+			e := &Events{RoutingKey: "R0UT1NG", Severity: tt.severity, URL: ts.URL}
+
+			err := e.Alert(context.Background(), tt.alert)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Alert() error = %v", err)
+			}
+			if got.RoutingKey != "R0UT1NG" || got.EventAction != tt.wantAction || got.DedupKey != "nodeprop:dlq" {
+				t.Errorf("event = %+v", got)
+			}
+			if tt.wantSeverity == "" {
+				if got.Payload != nil {
+					t.Errorf("resolve carries a payload: %+v", got.Payload)
+				}
+				return
+			}
+			p := got.Payload
+			if p == nil || p.Severity != tt.wantSeverity || p.Summary != tt.alert.Summary() || p.Source != "nodeprop" || p.Timestamp != "2024-03-01T12:00:00Z" || p.Class != flow.AlertDeadLetters {
+				t.Errorf("payload = %+v", p)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package flow
+
+import (
+	"context"
+	"sync"
+)
+
+// Parallelism bounds the work Parallel runs at once.
+type Parallelism struct {
+	// Concurrency is the number of workers; it is 1 if less than 1.
+	Concurrency int
+	// PerHost, if positive, bounds the items in flight to any one host, so
+	// work spread over several endpoints, such as GitHub and a GHES
+	// instance or a set of webhook receivers, is not all queued behind
+	// the slowest of them.
+	PerHost int
+}
+
+// Completed is the result of the item at Index of a Parallel run.
+type Completed[R any] struct {
+	Index int
+	Value R
+}
+
+// Parallel calls do for every item on a pool of p.Concurrency workers and
+// sends each result on the returned channel as soon as it is ready, in
+// the order they finish. The channel is closed after the last result and
+// is buffered for all of them, so a caller may stop reading early. host,
+// if not nil, names the host of an item for p.PerHost; items whose host
+// is at its cap wait while items of other hosts go ahead.
+//
+// Items are started in order. do is called for every item even once ctx
+// is done, so that it can record ctx.Err() as the item's outcome.
+func Parallel[T, R any](ctx context.Context, p Parallelism, items []T, host func(T) string, do func(context.Context, T) R) <-chan Completed[R] {
+	out := make(chan Completed[R], len(items))
+	workers := max(p.Concurrency, 1)
+	workers = min(workers, len(items))
+	if workers == 0 {
+		close(out)
+		return out
+	}
+	s := &hostScheduler{perHost: p.PerHost, running: map[string]int{}}
+	s.cond = sync.NewCond(&s.mu)
+	s.pending = make([]int, len(items))
+	s.hosts = make([]string, len(items))
+	for i := range items {
+		s.pending[i] = i
+		if host != nil && p.PerHost > 0 {
+			s.hosts[i] = host(items[i])
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for range workers {
+		go func() {
+			defer wg.Done()
+			for {
+				i, ok := s.next()
+				if !ok {
+					return
+				}
+				v := do(ctx, items[i])
+				s.done(i)
+				out <- Completed[R]{Index: i, Value: v}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// ParallelSlice is Parallel returning the results in item order once all
+// are ready. progress, if not nil, is called as each finishes with the
+// number finished so far; calls are serialized.
+func ParallelSlice[T, R any](ctx context.Context, p Parallelism, items []T, host func(T) string, do func(context.Context, T) R, progress func(done int, r R)) []R {
+	results := make([]R, len(items))
+	done := 0
+	for c := range Parallel(ctx, p, items, host, do) {
+		results[c.Index] = c.Value
+		done++
+		if progress != nil {
+			progress(done, c.Value)
+		}
+	}
+	return results
+}
+
+// hostScheduler hands out the indexes of pending items in order, skipping
+// those whose host is at its cap.
+type hostScheduler struct {
+	perHost int
+	hosts   []string
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []int
+	running map[string]int
+}
+
+// next removes and returns the first pending item that may start, waiting
+// for one if all are held by their hosts' caps. It returns false once no
+// items are pending.
+func (s *hostScheduler) next() (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		if len(s.pending) == 0 {
+			return 0, false
+		}
+		for k, i := range s.pending {
+			h := s.hosts[i]
+			if h == "" || s.running[h] < s.perHost {
+				if k == 0 {
+					s.pending = s.pending[1:]
+				} else {
+					s.pending = append(s.pending[:k], s.pending[k+1:]...)
+				}
+				if h != "" {
+					s.running[h]++
+				}
+				return i, true
+			}
+		}
+		s.cond.Wait()
+	}
+}
+
+// done releases the host of item i.
+func (s *hostScheduler) done(i int) {
+	h := s.hosts[i]
+	if h == "" {
+		return
+	}
+	s.mu.Lock()
+	s.running[h]--
+	s.mu.Unlock()
+	s.cond.Broadcast()
+}
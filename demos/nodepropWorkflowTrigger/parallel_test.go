@@ -0,0 +1,150 @@
+package flow
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// concurrencyProbe tracks the most calls in flight at once, overall and
+// per host.
+type concurrencyProbe struct {
+	mu      sync.Mutex
+	running map[string]int
+	total   int
+	maxAll  int
+	maxHost map[string]int
+}
+
+func (p *concurrencyProbe) enter(host string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running[host]++
+	p.total++
+	p.maxAll = max(p.maxAll, p.total)
+	p.maxHost[host] = max(p.maxHost[host], p.running[host])
+}
+
+func (p *concurrencyProbe) leave(host string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running[host]--
+	p.total--
+}
+
+func TestParallel(t *testing.T) {
+	// Items are host/name; the first host is slow.
+	items := []string{"ghes/a", "ghes/b", "ghes/c", "ghes/d", "github/e", "github/f", "hook/g", "hook/h"}
+	tests := []struct {
+		name        string
+		p           Parallelism
+		hosts       bool
+		wantMaxAll  int
+		wantMaxHost int
+	}{
+		{name: "serial", p: Parallelism{}, wantMaxAll: 1, wantMaxHost: 1},
+		{name: "negative concurrency", p: Parallelism{Concurrency: -3}, wantMaxAll: 1, wantMaxHost: 1},
+		{name: "more workers than items", p: Parallelism{Concurrency: 100}, wantMaxAll: len(items), wantMaxHost: 4},
+		{name: "per host", p: Parallelism{Concurrency: 8, PerHost: 1}, hosts: true, wantMaxAll: 3, wantMaxHost: 1},
+		{name: "per host without hosts", p: Parallelism{Concurrency: 8, PerHost: 1}, wantMaxAll: 8, wantMaxHost: 4},
+		{name: "per host of two", p: Parallelism{Concurrency: 4, PerHost: 2}, hosts: true, wantMaxAll: 4, wantMaxHost: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probe := &concurrencyProbe{running: map[string]int{}, maxHost: map[string]int{}}
+			var host func(string) string
+			if tt.hosts {
+				host = func(item string) string { h, _, _ := strings.Cut(item, "/"); return h }
+			}
+			var order []string
+			results := ParallelSlice(context.Background(), tt.p, items, host, func(_ context.Context, item string) string {
+				h, _, _ := strings.Cut(item, "/")
+				probe.enter(h)
+				defer probe.leave(h)
+				if h == "ghes" {
+					time.Sleep(20 * time.Millisecond)
+				} else {
+					time.Sleep(5 * time.Millisecond)
+				}
+				return strings.ToUpper(item)
+			}, func(done int, r string) {
+				order = append(order, r)
+				if done != len(order) {
+					t.Errorf("progress(%d) after %d results", done, len(order)-1)
+				}
+			})
+			want := make([]string, len(items))
+			for i, item := range items {
+				want[i] = strings.ToUpper(item)
+			}
+			if !slices.Equal(results, want) {
+				t.Errorf("results = %v, want them in item order", results)
+			}
+			if len(order) != len(items) {
+				t.Errorf("progress called %d times, want %d", len(order), len(items))
+			}
+			if probe.maxAll > tt.wantMaxAll {
+				t.Errorf("%d calls at once, want at most %d", probe.maxAll, tt.wantMaxAll)
+			}
+			for h, n := range probe.maxHost {
+				if n > tt.wantMaxHost {
+					t.Errorf("%d calls at once to %s, want at most %d", n, h, tt.wantMaxHost)
+				}
+			}
+		})
+	}
+}
+
+// TestParallelPerHostGoesAround checks that items of a host at its cap do
+// not hold up the items of other hosts behind them.
+func TestParallelPerHostGoesAround(t *testing.T) {
+	items := []string{"slow/1", "slow/2", "slow/3", "fast/4"}
+	release := make(chan struct{})
+	host := func(item string) string { h, _, _ := strings.Cut(item, "/"); return h }
+	ch := Parallel(context.Background(), Parallelism{Concurrency: 2, PerHost: 1}, items, host, func(_ context.Context, item string) string {
+		if host(item) == "slow" {
+			<-release
+		}
+		return item
+	})
+	select {
+	case c := <-ch:
+		if c.Index != 3 || c.Value != "fast/4" {
+			t.Errorf("first result = %+v, want fast/4", c)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("fast/4 waited behind the slow host")
+	}
+	close(release)
+	n := 1
+	for range ch {
+		n++
+	}
+	if n != len(items) {
+		t.Errorf("%d results, want %d", n, len(items))
+	}
+}
+
+func TestParallelEmpty(t *testing.T) {
+	ch := Parallel(context.Background(), Parallelism{Concurrency: 4}, []int(nil), nil, func(context.Context, int) int {
+		t.Error("do called without items")
+		return 0
+	})
+	if _, ok := <-ch; ok {
+		t.Error("channel of no items sent a result")
+	}
+}
+
+func TestParallelCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results := ParallelSlice(ctx, Parallelism{Concurrency: 2}, []int{1, 2, 3}, nil, func(ctx context.Context, i int) error { return ctx.Err() }, nil)
+	for i, err := range results {
+		if err != context.Canceled {
+			t.Errorf("result %d = %v, want do called with the cancelled context", i, err)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package flow
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Limits on trigger params. MaxInputs and MaxInputsSize are GitHub's limits
+// on workflow_dispatch inputs; the others bound what any trigger sends.
+const (
+	MaxInputs     = 25
+	MaxInputsSize = 65535
+	MaxParamKey   = 256
+	MaxParamValue = 1 << 20
+)
+
+// inputNamePattern is what GitHub accepts as a workflow input name.
+var inputNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// ParamError is a trigger param that cannot be sent as it is. It is
+// returned before any request is made, and ErrorClass classifies it as
+// invalid, so it is not retried.
+type ParamError struct {
+	Key    string
+	Reason string
+}
+
+func (e *ParamError) Error() string {
+	if e.Key == "" {
+		return "invalid params: " + e.Reason
+	}
+	return fmt.Sprintf("invalid param %q: %s", e.Key, e.Reason)
+}
+
+// ValidateParams checks params before they are encoded for any trigger:
+// keys must be non-empty and free of control characters, and keys and
+// values valid UTF-8 without NUL bytes, as JSON encoding would otherwise
+// replace them silently, within MaxParamKey and MaxParamValue bytes.
+// Values may contain newlines, quotes, and JSON of their own; they are
+// sent as strings.
+func ValidateParams(params map[string]string) error {
+	return firstInvalid(params, checkParam)
+}
+
+// checkParam returns the reason a param is refused by ValidateParams, or
+// nil.
+func checkParam(k, v string) *ParamError {
+	switch {
+	case k == "":
+		return &ParamError{Reason: "empty key"}
+	case len(k) > MaxParamKey:
+		return &ParamError{Key: strings.ToValidUTF8(k[:32], "") + "...", Reason: fmt.Sprintf("key is longer than %d bytes", MaxParamKey)}
+	case !utf8.ValidString(k):
+		return &ParamError{Key: strings.ToValidUTF8(k, "\uFFFD"), Reason: "key is not valid UTF-8"}
+	case strings.IndexFunc(k, unicode.IsControl) >= 0:
+		return &ParamError{Key: k, Reason: "key contains a control character"}
+	case len(v) > MaxParamValue:
+		return &ParamError{Key: k, Reason: fmt.Sprintf("value is %d bytes, more than %d", len(v), MaxParamValue)}
+	case !utf8.ValidString(v):
+		return &ParamError{Key: k, Reason: "value is not valid UTF-8"}
+	case strings.IndexByte(v, 0) >= 0:
+		return &ParamError{Key: k, Reason: "value contains a NUL byte"}
+	}
+	return nil
+}
+
+// firstInvalid returns the error check finds for the smallest failing key
+// of m, so the same params always fail on the same key, or nil. Params
+// that pass, the usual case, are checked without sorting the keys.
+func firstInvalid(m map[string]string, check func(k, v string) *ParamError) error {
+	var first *ParamError
+	var firstKey string
+	for k, v := range m {
+		if first != nil && k >= firstKey {
+			continue
+		}
+		if err := check(k, v); err != nil {
+			first, firstKey = err, k
+		}
+	}
+	if first == nil {
+		return nil
+	}
+	return first
+}
+
+// ValidateInputs is ValidateParams for workflow_dispatch inputs, which
+// GitHub further limits: names of letters, digits, - and _ not starting
+// with a digit or -, at most MaxInputs of them, and at most MaxInputsSize
+// bytes of JSON in all.
+func ValidateInputs(inputs map[string]string) error {
+	if err := ValidateParams(inputs); err != nil {
+		return err
+	}
+	if len(inputs) > MaxInputs {
+		return &ParamError{Reason: fmt.Sprintf("%d inputs, more than GitHub's %d", len(inputs), MaxInputs)}
+	}
+	err := firstInvalid(inputs, func(k, _ string) *ParamError {
+		if !inputNamePattern.MatchString(k) {
+			return &ParamError{Key: k, Reason: "not a valid workflow input name"}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	buf := getBuffer()
+	defer putBuffer(buf)
+	writeInputs(buf, inputs)
+	if buf.Len() > MaxInputsSize {
+		return &ParamError{Reason: fmt.Sprintf("inputs encode to %d bytes, more than GitHub's %d", buf.Len(), MaxInputsSize)}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package flow_test
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"strings"
+	"testing"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/providertest"
+)
+
+func FuzzGitHubWorkflowDispatchParams(f *testing.F) {
+	providertest.Fuzz(f, func(t *testing.T, endpoint string) flow.Trigger {
+		return flow.NewGitHubWorkflowDispatch("fuzz.yml", flow.WithBaseURL(endpoint), flow.WithRef("main"))
+	})
+}
+
+func FuzzGitHubRepoDispatchParams(f *testing.F) {
+	providertest.Fuzz(f, func(t *testing.T, endpoint string) flow.Trigger {
+		return flow.NewGitHubRepoDispatch("fuzz", flow.WithBaseURL(endpoint))
+	})
+}
+
+func FuzzWebhookTriggerParams(f *testing.F) {
+	providertest.Fuzz(f, func(t *testing.T, endpoint string) flow.Trigger {
+		return flow.NewWebhookTrigger(endpoint)
+	})
+}
+
+// fuzzSeeds are params at the edges of what ValidateParams and
+// ValidateInputs accept.
+var fuzzSeeds = [][2]string{
+	{"env", "prod"},
+	{"", "value"},
+	{"_private", "x"},
+	{"9lives", "x"},
+	{"-flag", "x"},
+	{"with space", "x"},
+	{"tab\tkey", "x"},
+	{"key", "nul\x00"},
+	{"key", "\xff"},
+	{"\xffkey", "x"},
+	{"ключ", "値"},
+	{"json", `{"a": [1, "two"]}`},
+	{"lines", "one\r\ntwo"},
+	{strings.Repeat("k", flow.MaxParamKey), "x"},
+	{strings.Repeat("k", flow.MaxParamKey+1), "x"},
+}
+
+func FuzzValidateParams(f *testing.F) {
+	for _, s := range fuzzSeeds {
+		f.Add(s[0], s[1])
+	}
+	f.Fuzz(func(t *testing.T, key, value string) {
+		params := map[string]string{key: value}
+		err := flow.ValidateParams(params)
+		if err != nil {
+			var paramErr *flow.ParamError
+			if !errors.As(err, &paramErr) {
+				t.Fatalf("ValidateParams() error %T is not a *flow.ParamError", err)
+			}
+			if flow.ErrorClass(err) != flow.ErrorInvalid {
+				t.Errorf("ErrorClass(%v) = %s, want %s", err, flow.ErrorClass(err), flow.ErrorInvalid)
+			}
+			return
+		}
+		// Accepted params survive JSON unchanged.
+		data, err := json.Marshal(params)
+		if err != nil {
+			t.Fatalf("json.Marshal() error = %v", err)
+		}
+		var got map[string]string
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+		if !maps.Equal(got, params) {
+			t.Errorf("params %q encode as %s and decode as %q", params, data, got)
+		}
+	})
+}
+
+func FuzzValidateInputs(f *testing.F) {
+	for _, s := range fuzzSeeds {
+		f.Add(s[0], s[1])
+	}
+	f.Fuzz(func(t *testing.T, key, value string) {
+		inputs := map[string]string{key: value}
+		err := flow.ValidateInputs(inputs)
+		if err == nil {
+			if perr := flow.ValidateParams(inputs); perr != nil {
+				t.Errorf("ValidateInputs() accepted what ValidateParams refuses: %v", perr)
+			}
+			if first := key[0]; first == '-' || (first >= '0' && first <= '9') {
+				t.Errorf("ValidateInputs() accepted input name %q", key)
+			}
+			return
+		}
+		var paramErr *flow.ParamError
+		if !errors.As(err, &paramErr) {
+			t.Fatalf("ValidateInputs() error %T is not a *flow.ParamError", err)
+		}
+	})
+}
@@ -0,0 +1,120 @@
+package flow_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+func TestValidateParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  map[string]string
+		wantErr string
+	}{
+		{name: "nil"},
+		{name: "plain", params: map[string]string{"env": "prod", "-flag": "x", "with space": "y"}},
+		{name: "values kept as strings", params: map[string]string{"json": `{"a": [1]}`, "lines": "one\r\ntwo", "quoted": `"hi"`, "empty": ""}},
+		{name: "unicode", params: map[string]string{"ключ": "値 🚀"}},
+		{name: "longest key", params: map[string]string{strings.Repeat("k", flow.MaxParamKey): "x"}},
+		{name: "empty key", params: map[string]string{"": "x"}, wantErr: "invalid params: empty key"},
+		{name: "long key", params: map[string]string{strings.Repeat("k", flow.MaxParamKey+1): "x"}, wantErr: "key is longer than 256 bytes"},
+		{name: "invalid key", params: map[string]string{"\xffkey": "x"}, wantErr: `invalid param "�key": key is not valid UTF-8`},
+		{name: "control key", params: map[string]string{"tab\tkey": "x"}, wantErr: "key contains a control character"},
+		{name: "NUL key", params: map[string]string{"k\x00ey": "x"}, wantErr: "key contains a control character"},
+		{name: "long value", params: map[string]string{"big": strings.Repeat("v", flow.MaxParamValue+1)}, wantErr: "more than 1048576"},
+		{name: "invalid value", params: map[string]string{"key": "\xff"}, wantErr: `invalid param "key": value is not valid UTF-8`},
+		{name: "NUL value", params: map[string]string{"key": "nul\x00"}, wantErr: "value contains a NUL byte"},
+		{name: "smallest key first", params: map[string]string{"b": "\xff", "a": "\xff", "c": "\xff"}, wantErr: `invalid param "a"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := flow.ValidateParams(tt.params)
+			checkParamError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateInputs(t *testing.T) {
+	many := map[string]string{}
+	for i := range flow.MaxInputs + 1 {
+		many[fmt.Sprintf("input_%d", i)] = "x"
+	}
+	tests := []struct {
+		name    string
+		inputs  map[string]string
+		wantErr string
+	}{
+		{name: "valid", inputs: map[string]string{"env": "prod", "_private": "x", "dry-run": "true", "Version2": "1"}},
+		{name: "refused by ValidateParams", inputs: map[string]string{"env": "nul\x00"}, wantErr: "value contains a NUL byte"},
+		{name: "leading digit", inputs: map[string]string{"9lives": "x"}, wantErr: `invalid param "9lives": not a valid workflow input name`},
+		{name: "leading dash", inputs: map[string]string{"-flag": "x"}, wantErr: "not a valid workflow input name"},
+		{name: "space", inputs: map[string]string{"with space": "x"}, wantErr: "not a valid workflow input name"},
+		{name: "unicode", inputs: map[string]string{"ключ": "x"}, wantErr: "not a valid workflow input name"},
+		{name: "too many", inputs: many, wantErr: "26 inputs, more than GitHub's 25"},
+		{name: "too large", inputs: map[string]string{"a": strings.Repeat("v", flow.MaxInputsSize/2), "b": strings.Repeat("v", flow.MaxInputsSize/2)}, wantErr: "more than GitHub's 65535"},
+		{name: "escaping counts", inputs: map[string]string{"a": strings.Repeat(`"`, flow.MaxInputsSize/2)}, wantErr: "more than GitHub's 65535"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := flow.ValidateInputs(tt.inputs)
+			checkParamError(t, err, tt.wantErr)
+		})
+	}
+}
+
+// checkParamError fails t unless err is a *flow.ParamError containing
+// want, classified as invalid, or nil if want is empty.
+func checkParamError(t *testing.T, err error, want string) {
+	t.Helper()
+	if want == "" {
+		if err != nil {
+			t.Errorf("error = %v, want none", err)
+		}
+		return
+	}
+	var paramErr *flow.ParamError
+	if !errors.As(err, &paramErr) || !strings.Contains(err.Error(), want) {
+		t.Fatalf("error = %v, want a *flow.ParamError containing %q", err, want)
+	}
+	if class := flow.ErrorClass(err); class != flow.ErrorInvalid {
+		t.Errorf("ErrorClass() = %s, want %s", class, flow.ErrorInvalid)
+	}
+}
+
+func TestTriggersRefuseInvalidParams(t *testing.T) {
+	var sent atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	tests := []struct {
+		name    string
+		trigger flow.Trigger
+		params  map[string]string
+	}{
+		{name: "workflow dispatch", trigger: flow.NewGitHubWorkflowDispatch("d.yml", flow.WithBaseURL(srv.URL), flow.WithRef("main")), params: map[string]string{"9lives": "x"}},
+		{name: "repository dispatch", trigger: flow.NewGitHubRepoDispatch("release", flow.WithBaseURL(srv.URL)), params: map[string]string{"key": "\xff"}},
+		{name: "webhook", trigger: flow.NewWebhookTrigger(srv.URL), params: map[string]string{"": "x"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := sent.Load()
+			err := tt.trigger.Trigger("Cdaprod/site", tt.params, "token")
+			var paramErr *flow.ParamError
+			if !errors.As(err, &paramErr) {
+				t.Errorf("Trigger() error = %v, want a *flow.ParamError", err)
+			}
+			if n := sent.Load() - before; n != 0 {
+				t.Errorf("%d requests sent for refused params", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// MaxCompareFiles is the most changed files the Compare API lists; a
+// comparison listing that many may have more.
+const MaxCompareFiles = 300
+
+// ErrTooManyChangedFiles is returned by ChangedFiles when a comparison
+// changes more files than the Compare API lists.
+var ErrTooManyChangedFiles = errors.New("too many changed files to list")
+
+// nullSHA is the before or after of a push creating or deleting a branch.
+const nullSHA = "0000000000000000000000000000000000000000"
+
+// validatePaths checks the patterns of a rule's Paths.
+func validatePaths(patterns []string) error {
+	if len(patterns) > 0 && strings.HasPrefix(patterns[0], "!") {
+		return errors.New("paths: the first pattern must not be an exclusion")
+	}
+	for _, p := range patterns {
+		p = strings.TrimPrefix(p, "!")
+		if p == "" {
+			return errors.New("paths: empty pattern")
+		}
+		for _, seg := range strings.Split(p, "/") {
+			if _, err := path.Match(seg, ""); err != nil {
+				return fmt.Errorf("paths: bad pattern %q", p)
+			}
+		}
+	}
+	return nil
+}
+
+// matchesPaths reports whether a file in files is selected by patterns.
+// Patterns are globs in which ** also matches across directories, such as
+// services/api/**; one starting with ! excludes what it matches, and a
+// file is selected if the last pattern matching it is not an exclusion.
+func matchesPaths(patterns, files []string) bool {
+	for _, f := range files {
+		selected := false
+		for _, p := range patterns {
+			exclude := strings.HasPrefix(p, "!")
+			if matchPath(strings.Split(strings.TrimPrefix(p, "!"), "/"), strings.Split(f, "/")) {
+				selected = !exclude
+			}
+		}
+		if selected {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPath matches the segments of a file name against those of a
+// pattern, where a ** segment matches any number of segments.
+func matchPath(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := len(name); i >= 0; i-- {
+				if matchPath(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// ChangedFiles returns the files changed between base and head in repo,
+// by the Compare API. A renamed file is listed under both its names, so
+// that moving a file out of a directory counts as changing it. More
+// changes than the API lists are ErrTooManyChangedFiles.
+func (c *GitHubClient) ChangedFiles(ctx context.Context, repo, base, head string) ([]string, error) {
+	var out struct {
+		Files []struct {
+			Filename         string `json:"filename"`
+			PreviousFilename string `json:"previous_filename"`
+		} `json:"files"`
+	}
+	// Files are listed in full on the first page whatever its size, so
+	// one commit per page is all that is fetched besides them.
+	p := fmt.Sprintf("/repos/%s/compare/%s...%s?per_page=1", repo, url.PathEscape(base), url.PathEscape(head))
+	if err := c.do(ctx, "GET", p, nil, &out); err != nil {
+		return nil, fmt.Errorf("failed to compare %s...%s in %s: %w", base, head, repo, err)
+	}
+	if len(out.Files) >= MaxCompareFiles {
+		return nil, ErrTooManyChangedFiles
+	}
+	files := make([]string, 0, len(out.Files))
+	for _, f := range out.Files {
+		files = append(files, f.Filename)
+		if f.PreviousFilename != "" {
+			files = append(files, f.PreviousFilename)
+		}
+	}
+	return files, nil
+}
+
+// PushChangedFiles returns the files a push event changed, comparing its
+// before and after commits, or nil if they cannot be told: for events
+// other than pushes, for pushes creating or deleting a branch, and for
+// pushes changing more files than the Compare API lists.
+func (c *GitHubClient) PushChangedFiles(ctx context.Context, ev InboundEvent) ([]string, error) {
+	if ev.Type != "push" {
+		return nil, nil
+	}
+	before, _ := payloadValue(ev.Payload, "before")
+	after, _ := payloadValue(ev.Payload, "after")
+	if before == "" || after == "" || before == nullSHA || after == nullSHA {
+		return nil, nil
+	}
+	files, err := c.ChangedFiles(ctx, ev.Repo, before, after)
+	if errors.Is(err, ErrTooManyChangedFiles) {
+		return nil, nil
+	}
+	return files, err
+}
@@ -0,0 +1,140 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMatchesPaths(t *testing.T) {
+	api := []string{"services/api/**", "!services/api/docs/**"}
+	tests := []struct {
+		name     string
+		patterns []string
+		files    []string
+		want     bool
+	}{
+		{name: "directory", patterns: api, files: []string{"services/api/main.go"}, want: true},
+		{name: "nested", patterns: api, files: []string{"services/api/internal/db/db.go"}, want: true},
+		{name: "other directory", patterns: api, files: []string{"services/web/main.go"}},
+		{name: "excluded", patterns: api, files: []string{"services/api/docs/README.md"}},
+		{name: "one file selected", patterns: api, files: []string{"services/api/docs/README.md", "services/api/go.mod"}, want: true},
+		{name: "no files", patterns: api},
+		{name: "reincluded", patterns: []string{"**", "!docs/**", "docs/api.md"}, files: []string{"docs/api.md"}, want: true},
+		{name: "star stays in a directory", patterns: []string{"*.go"}, files: []string{"cmd/main.go"}},
+		{name: "star at the root", patterns: []string{"*.go"}, files: []string{"main.go"}, want: true},
+		{name: "double star in the middle", patterns: []string{"services/**/Dockerfile"}, files: []string{"services/api/build/Dockerfile"}, want: true},
+		{name: "double star matches nothing", patterns: []string{"services/**/Dockerfile"}, files: []string{"services/Dockerfile"}, want: true},
+		{name: "double star needs the rest", patterns: []string{"services/**/Dockerfile"}, files: []string{"services/api/main.go"}},
+		{name: "directory itself", patterns: []string{"services/api"}, files: []string{"services/api/main.go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchesPaths(tt.patterns, tt.files); got != tt.want {
+				t.Errorf("matchesPaths(%q, %q) = %v, want %v", tt.patterns, tt.files, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatePaths(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		wantErr  string
+	}{
+		{patterns: []string{"services/api/**", "!services/api/docs/**"}},
+		{patterns: []string{"!docs/**"}, wantErr: "the first pattern must not be an exclusion"},
+		{patterns: []string{"src/**", "!"}, wantErr: "empty pattern"},
+		{patterns: []string{"src/[a-"}, wantErr: `bad pattern "src/[a-"`},
+	}
+	for _, tt := range tests {
+		err := validatePaths(tt.patterns)
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("validatePaths(%q) error = %v, want %q", tt.patterns, err, tt.wantErr)
+		}
+	}
+}
+
+// compareServer serves the Compare API of Cdaprod/api: head "many" changes
+// MaxCompareFiles files, "broken" fails, and any other head renames
+// docs/old.md and changes main.go.
+func compareServer(t *testing.T) *GitHubClient {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		base, head, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/repos/Cdaprod/api/compare/"), "...")
+		if !ok || base == "" || r.URL.Query().Get("per_page") != "1" {
+			http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+			return
+		}
+		type file struct {
+			Filename         string `json:"filename"`
+			PreviousFilename string `json:"previous_filename,omitempty"`
+		}
+		var files []file
+		switch head {
+		case "broken":
+			http.Error(w, `{"message":"Server Error"}`, http.StatusInternalServerError)
+			return
+		case "many":
+			for i := range MaxCompareFiles {
+				files = append(files, file{Filename: fmt.Sprintf("gen/%d.go", i)})
+			}
+		default:
+			files = []file{{Filename: "docs/new.md", PreviousFilename: "docs/old.md"}, {Filename: "main.go"}}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"files": files})
+	}))
+	t.Cleanup(srv.Close)
+	c := NewGitHubClient("token")
+	c.BaseURL = srv.URL
+	return c
+}
+
+func TestChangedFiles(t *testing.T) {
+	c := compareServer(t)
+	files, err := c.ChangedFiles(context.Background(), "Cdaprod/api", "aaa", "bbb")
+	if want := []string{"docs/new.md", "docs/old.md", "main.go"}; err != nil || !reflect.DeepEqual(files, want) {
+		t.Errorf("ChangedFiles() = %q, %v; want %q", files, err, want)
+	}
+	if _, err := c.ChangedFiles(context.Background(), "Cdaprod/api", "aaa", "many"); !errors.Is(err, ErrTooManyChangedFiles) {
+		t.Errorf("ChangedFiles() of a large comparison error = %v, want ErrTooManyChangedFiles", err)
+	}
+	if _, err := c.ChangedFiles(context.Background(), "Cdaprod/api", "aaa", "broken"); err == nil || !strings.Contains(err.Error(), "failed to compare aaa...broken in Cdaprod/api") {
+		t.Errorf("ChangedFiles() of a failing comparison error = %v", err)
+	}
+}
+
+func TestPushChangedFiles(t *testing.T) {
+	c := compareServer(t)
+	push := func(before, after string) InboundEvent {
+		return InboundEvent{Type: "push", Repo: "Cdaprod/api", Payload: map[string]interface{}{"before": before, "after": after}}
+	}
+	tests := []struct {
+		name    string
+		ev      InboundEvent
+		want    []string
+		wantErr bool
+	}{
+		{name: "push", ev: push("aaa", "bbb"), want: []string{"docs/new.md", "docs/old.md", "main.go"}},
+		{name: "not a push", ev: InboundEvent{Type: "release", Repo: "Cdaprod/api", Payload: map[string]interface{}{"before": "aaa", "after": "bbb"}}},
+		{name: "branch created", ev: push(nullSHA, "bbb")},
+		{name: "branch deleted", ev: push("aaa", nullSHA)},
+		{name: "no payload", ev: InboundEvent{Type: "push", Repo: "Cdaprod/api"}},
+		{name: "too many files", ev: push("aaa", "many")},
+		{name: "comparison fails", ev: push("aaa", "broken"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.PushChangedFiles(context.Background(), tt.ev)
+			if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PushChangedFiles() = %q, %v; want %q, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package flow
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// planVersion is bumped when the plan file format changes incompatibly.
+const planVersion = 1
+
+// PlannedDispatch is one dispatch a plan will make.
+type PlannedDispatch struct {
+	Repo     string            `json:"repo" yaml:"repo"`
+	Workflow string            `json:"workflow" yaml:"workflow"`
+	Ref      string            `json:"ref" yaml:"ref"`
+	Inputs   map[string]string `json:"inputs,omitempty" yaml:"inputs,omitempty"`
+	// Source is the repo or selector in the spec that produced this dispatch.
+	Source string `json:"source,omitempty" yaml:"source,omitempty"`
+}
+
+// Plan is the exact set of dispatches resolved from a spec, saved so it can
+// be reviewed and later applied unchanged.
+type Plan struct {
+	Version    int               `json:"version" yaml:"version"`
+	CreatedAt  time.Time         `json:"created_at" yaml:"created_at"`
+	Dispatches []PlannedDispatch `json:"dispatches" yaml:"dispatches"`
+}
+
+// BuildPlan expands targets against reg. Selector targets without a workflow
+// use each matched repository's registered workflows. reg may be nil when no
+// target uses a selector. Exact duplicates are dropped.
+func BuildPlan(targets []BatchTarget, reg *RepositoryRegistry) (*Plan, error) {
+	p := &Plan{Version: planVersion, CreatedAt: time.Now().UTC()}
+	seen := make(map[string]bool)
+	add := func(d PlannedDispatch) {
+		key := dispatchKey(d)
+		if !seen[key] {
+			seen[key] = true
+			p.Dispatches = append(p.Dispatches, d)
+		}
+	}
+
+	for _, t := range targets {
+		if t.Selector == "" {
+			add(PlannedDispatch{Repo: t.Repo, Workflow: t.Workflow, Ref: t.Ref, Inputs: t.Inputs, Source: t.Repo})
+			continue
+		}
+		if reg == nil {
+			return nil, fmt.Errorf("selector %q requires a registry", t.Selector)
+		}
+		entries, err := reg.Select(t.Selector)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) == 0 {
+			return nil, fmt.Errorf("selector %q matched no repositories", t.Selector)
+		}
+		for _, e := range entries {
+			workflows := e.Workflows
+			if t.Workflow != "" {
+				workflows = []string{t.Workflow}
+			}
+			if len(workflows) == 0 {
+				return nil, fmt.Errorf("selector %q matched %s, which has no registered workflows", t.Selector, e.Name)
+			}
+			for _, wf := range workflows {
+				add(PlannedDispatch{Repo: e.Name, Workflow: wf, Ref: t.Ref, Inputs: t.Inputs, Source: t.Selector})
+			}
+		}
+	}
+	return p, nil
+}
+
+// dispatchKey identifies a dispatch by target, workflow, ref, and inputs.
+func dispatchKey(d PlannedDispatch) string {
+	keys := make([]string, 0, len(d.Inputs))
+	for k := range d.Inputs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\x00%s\x00%s", d.Repo, d.Workflow, d.Ref)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "\x00%s=%s", k, d.Inputs[k])
+	}
+	return b.String()
+}
+
+// Targets converts the plan back into batch targets for dispatching.
+func (p *Plan) Targets() []BatchTarget {
+	out := make([]BatchTarget, len(p.Dispatches))
+	for i, d := range p.Dispatches {
+		out[i] = BatchTarget{Repo: d.Repo, Workflow: d.Workflow, Ref: d.Ref, Inputs: d.Inputs}
+	}
+	return out
+}
+
+// RepoCount returns the number of distinct repositories in the plan.
+func (p *Plan) RepoCount() int {
+	repos := make(map[string]bool)
+	for _, d := range p.Dispatches {
+		repos[d.Repo] = true
+	}
+	return len(repos)
+}
+
+// LoadPlan reads a plan written by Save.
+func LoadPlan(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan: %w", err)
+	}
+	var p Plan
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse plan %s: %w", path, err)
+	}
+	if p.Version != planVersion {
+		return nil, fmt.Errorf("plan %s has version %d, want %d", path, p.Version, planVersion)
+	}
+	return &p, nil
+}
+
+// Save writes the plan as JSON.
+func (p *Plan) Save(path string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal plan: %w", err)
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,107 @@
+package flow
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildPlan(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets []BatchTarget
+		noReg   bool
+		want    []PlannedDispatch
+		wantErr string
+	}{
+		{
+			name:    "repo",
+			targets: []BatchTarget{{Repo: "o/r", Workflow: "ci.yml", Ref: "main"}},
+			want:    []PlannedDispatch{{Repo: "o/r", Workflow: "ci.yml", Ref: "main", Source: "o/r"}},
+			noReg:   true,
+		},
+		{
+			name:    "selector uses registered workflows",
+			targets: []BatchTarget{{Selector: "tag:backend", Ref: "main"}},
+			want: []PlannedDispatch{
+				{Repo: "Cdaprod/api", Workflow: "ci.yml", Ref: "main", Source: "tag:backend"},
+				{Repo: "Cdaprod/api", Workflow: "deploy.yml", Ref: "main", Source: "tag:backend"},
+			},
+		},
+		{
+			name:    "selector with a workflow",
+			targets: []BatchTarget{{Selector: "tag:infra", Workflow: "lint.yml", Ref: "main"}},
+			want: []PlannedDispatch{
+				{Repo: "Cdaprod/api", Workflow: "lint.yml", Ref: "main", Source: "tag:infra"},
+				{Repo: "Cdaprod/lib", Workflow: "lint.yml", Ref: "main", Source: "tag:infra"},
+			},
+		},
+		{
+			name: "duplicates dropped",
+			targets: []BatchTarget{
+				{Repo: "Cdaprod/web", Workflow: "ci.yml", Ref: "main", Inputs: map[string]string{"a": "1", "b": "2"}},
+				{Selector: "tag:frontend", Ref: "main", Inputs: map[string]string{"b": "2", "a": "1"}},
+				{Selector: "tag:frontend", Ref: "main", Inputs: map[string]string{"a": "1"}},
+			},
+			want: []PlannedDispatch{
+				{Repo: "Cdaprod/web", Workflow: "ci.yml", Ref: "main", Inputs: map[string]string{"a": "1", "b": "2"}, Source: "Cdaprod/web"},
+				{Repo: "Cdaprod/web", Workflow: "ci.yml", Ref: "main", Inputs: map[string]string{"a": "1"}, Source: "tag:frontend"},
+			},
+		},
+		{name: "selector without a registry", targets: []BatchTarget{{Selector: "*"}}, noReg: true, wantErr: "requires a registry"},
+		{name: "no match", targets: []BatchTarget{{Selector: "tag:missing"}}, wantErr: "matched no repositories"},
+		{name: "no workflows", targets: []BatchTarget{{Selector: "Cdaprod/lib"}}, wantErr: "has no registered workflows"},
+		{name: "invalid selector", targets: []BatchTarget{{Selector: "owner:x"}}, wantErr: "unknown selector term"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := selectorRegistry()
+			if tt.noReg {
+				reg = nil
+			}
+			p, err := BuildPlan(tt.targets, reg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("BuildPlan() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BuildPlan() error = %v", err)
+			}
+			if !reflect.DeepEqual(p.Dispatches, tt.want) {
+				t.Errorf("BuildPlan() = %+v, want %+v", p.Dispatches, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanSaveLoad(t *testing.T) {
+	p, err := BuildPlan([]BatchTarget{{Selector: "Cdaprod/*", Workflow: "ci.yml", Ref: "main"}}, selectorRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := p.RepoCount(); n != 3 {
+		t.Errorf("RepoCount() = %d, want 3", n)
+	}
+	path := filepath.Join(t.TempDir(), "plan.json")
+	if err := p.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadPlan(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Targets(), p.Targets()) || !loaded.CreatedAt.Equal(p.CreatedAt) {
+		t.Errorf("LoadPlan() = %+v, want %+v", loaded, p)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"version": 99, "dispatches": []}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadPlan(path); err == nil || !strings.Contains(err.Error(), "version 99") {
+		t.Errorf("LoadPlan() of a newer plan error = %v", err)
+	}
+}
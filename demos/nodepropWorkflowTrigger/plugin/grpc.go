@@ -0,0 +1,148 @@
+package plugin
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// providerServiceName is the gRPC service a provider binary serves. Its
+// messages are google.protobuf.Struct, so the service needs no protoc step;
+// request and response list their fields.
+const providerServiceName = "nodeprop.plugin.v1.TriggerProvider"
+
+// request is one delivery sent to the provider binary.
+type request struct {
+	Settings map[string]string
+	Target   string
+	Params   map[string]string
+	Token    string
+}
+
+// response is the outcome of a delivery; Error is empty on success.
+type response struct {
+	Error      string
+	Class      string
+	Trigger    string
+	Message    string
+	ParamKey   string
+	Method     string
+	Path       string
+	StatusCode int
+	Body       string
+}
+
+// providerService is the handler type of providerServiceDesc.
+type providerService interface {
+	trigger(ctx context.Context, req *request) *response
+}
+
+var providerServiceDesc = grpc.ServiceDesc{
+	ServiceName: providerServiceName,
+	HandlerType: (*providerService)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Trigger",
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			in := new(structpb.Struct)
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			call := func(ctx context.Context, in interface{}) (interface{}, error) {
+				return srv.(providerService).trigger(ctx, decodeRequest(in.(*structpb.Struct))).encode()
+			}
+			if interceptor == nil {
+				return call(ctx, in)
+			}
+			return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + providerServiceName + "/Trigger"}, call)
+		},
+	}},
+	Metadata: "nodeprop/plugin/v1/provider",
+}
+
+// grpcClient calls the provider binary.
+type grpcClient struct {
+	conn *grpc.ClientConn
+}
+
+func (c *grpcClient) trigger(ctx context.Context, req *request) (*response, error) {
+	in, err := req.encode()
+	if err != nil {
+		return nil, err
+	}
+	out := new(structpb.Struct)
+	if err := c.conn.Invoke(ctx, "/"+providerServiceName+"/Trigger", in, out); err != nil {
+		return nil, err
+	}
+	return decodeResponse(out), nil
+}
+
+func (r *request) encode() (*structpb.Struct, error) {
+	return structpb.NewStruct(map[string]interface{}{
+		"settings": stringMap(r.Settings),
+		"target":   r.Target,
+		"params":   stringMap(r.Params),
+		"token":    r.Token,
+	})
+}
+
+func decodeRequest(s *structpb.Struct) *request {
+	f := s.GetFields()
+	return &request{
+		Settings: fromStringMap(f["settings"]),
+		Target:   f["target"].GetStringValue(),
+		Params:   fromStringMap(f["params"]),
+		Token:    f["token"].GetStringValue(),
+	}
+}
+
+func (r *response) encode() (*structpb.Struct, error) {
+	return structpb.NewStruct(map[string]interface{}{
+		"error":       r.Error,
+		"class":       r.Class,
+		"trigger":     r.Trigger,
+		"message":     r.Message,
+		"param_key":   r.ParamKey,
+		"method":      r.Method,
+		"path":        r.Path,
+		"status_code": r.StatusCode,
+		"body":        r.Body,
+	})
+}
+
+func decodeResponse(s *structpb.Struct) *response {
+	f := s.GetFields()
+	return &response{
+		Error:      f["error"].GetStringValue(),
+		Class:      f["class"].GetStringValue(),
+		Trigger:    f["trigger"].GetStringValue(),
+		Message:    f["message"].GetStringValue(),
+		ParamKey:   f["param_key"].GetStringValue(),
+		Method:     f["method"].GetStringValue(),
+		Path:       f["path"].GetStringValue(),
+		StatusCode: int(f["status_code"].GetNumberValue()),
+		Body:       f["body"].GetStringValue(),
+	}
+}
+
+// stringMap converts m for structpb.NewStruct, which takes only
+// interface{} values.
+func stringMap(m map[string]string) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+func fromStringMap(v *structpb.Value) map[string]string {
+	fields := v.GetStructValue().GetFields()
+	if len(fields) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(fields))
+	for k, v := range fields {
+		out[k] = v.GetStringValue()
+	}
+	return out
+}
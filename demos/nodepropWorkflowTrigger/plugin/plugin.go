@@ -0,0 +1,236 @@
+// Package plugin runs trigger providers as separate binaries, so an
+// organization can ship a proprietary provider without forking the
+// dispatcher. A provider binary serves a flow.ProviderFactory:
+//
+//	func main() {
+//		plugin.Serve(func(settings map[string]string, _ ...flow.Option) (flow.Trigger, error) {
+//			return &deployer{Cluster: settings["cluster"]}, nil
+//		})
+//	}
+//
+// and the dispatcher loads it under a provider kind, after which
+// flow.NewProvider builds its triggers like the built-in ones:
+//
+//	p, err := plugin.Load("acme_deployer", "/usr/libexec/nodeprop/acme-deployer")
+//	if err != nil {
+//		return err
+//	}
+//	defer p.Kill()
+//	t, err := flow.NewProvider("acme_deployer", map[string]string{"cluster": "eu-1"})
+//
+// The two talk gRPC over a local socket managed by hashicorp/go-plugin,
+// mutually authenticated with a certificate made for each start. Every
+// delivery carries the trigger's settings, target, params, and token, and
+// the caller's cancellation; errors come back with their class, status
+// code, and body, so ErrorClass, retries, and the dead-letter queue treat
+// them as they would the package's own.
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"slices"
+
+	"github.com/hashicorp/go-hclog"
+	goplugin "github.com/hashicorp/go-plugin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// Handshake is checked by both sides before a provider binary serves, so
+// running one by hand, or loading an unrelated binary, fails at once.
+// ProtocolVersion changes only with incompatible changes to the service.
+var Handshake = goplugin.HandshakeConfig{
+	ProtocolVersion:  1,
+	MagicCookieKey:   "NODEPROP_PLUGIN",
+	MagicCookieValue: "6f1c2a7e-trigger-provider",
+}
+
+// pluginName is the name the provider is dispensed under.
+const pluginName = "provider"
+
+// Serve serves factory to the dispatcher that started the binary and
+// returns when it is killed. Options are not sent over the connection, so
+// factory is always called without any.
+func Serve(factory flow.ProviderFactory) {
+	goplugin.Serve(&goplugin.ServeConfig{
+		HandshakeConfig: Handshake,
+		Plugins:         goplugin.PluginSet{pluginName: &providerPlugin{factory: factory}},
+		GRPCServer:      goplugin.DefaultGRPCServer,
+	})
+}
+
+// Plugin is a running provider binary.
+type Plugin struct {
+	// Kind is the provider kind its triggers are built under.
+	Kind   string
+	client *goplugin.Client
+	remote *grpcClient
+}
+
+// Load starts the provider binary at path and registers it with
+// flow.RegisterProvider as kind. The binary runs until Kill; if it exits
+// early, its triggers fail with network errors, which are retried.
+func Load(kind, path string) (*Plugin, error) {
+	if slices.Contains(flow.Providers(), kind) {
+		return nil, fmt.Errorf("plugin %s: provider already registered", kind)
+	}
+	client := goplugin.NewClient(&goplugin.ClientConfig{
+		HandshakeConfig:  Handshake,
+		Plugins:          goplugin.PluginSet{pluginName: &providerPlugin{}},
+		Cmd:              exec.Command(path),
+		AllowedProtocols: []goplugin.Protocol{goplugin.ProtocolGRPC},
+		AutoMTLS:         true,
+		Logger:           hclog.New(&hclog.LoggerOptions{Name: "plugin." + kind, Level: hclog.Warn}),
+	})
+	rpc, err := client.Client()
+	if err != nil {
+		client.Kill()
+		return nil, fmt.Errorf("plugin %s: failed to start %s: %w", kind, path, err)
+	}
+	raw, err := rpc.Dispense(pluginName)
+	if err != nil {
+		client.Kill()
+		return nil, fmt.Errorf("plugin %s: %w", kind, err)
+	}
+	p := &Plugin{Kind: kind, client: client, remote: raw.(*grpcClient)}
+	flow.RegisterProvider(kind, p.factory)
+	return p, nil
+}
+
+// Kill stops the provider binary. Triggers built from it fail afterwards;
+// the kind stays registered.
+func (p *Plugin) Kill() {
+	p.client.Kill()
+}
+
+// Exited reports whether the provider binary has exited.
+func (p *Plugin) Exited() bool {
+	return p.client.Exited()
+}
+
+func (p *Plugin) factory(settings map[string]string, _ ...flow.Option) (flow.Trigger, error) {
+	return &Trigger{Kind: p.Kind, Settings: settings, remote: p.remote}, nil
+}
+
+// Trigger is a trigger built by a provider binary. Each delivery is sent
+// to the binary with the settings it was built from.
+type Trigger struct {
+	Kind     string
+	Settings map[string]string
+	remote   *grpcClient
+}
+
+// ProviderConfig returns the kind and settings t was built from.
+func (t *Trigger) ProviderConfig() flow.ProviderConfig {
+	return flow.ProviderConfig{Provider: t.Kind, Settings: t.Settings}
+}
+
+// Trigger delivers target and params through the provider binary.
+func (t *Trigger) Trigger(target string, params map[string]string, authToken string) error {
+	return t.TriggerContext(context.Background(), target, params, authToken)
+}
+
+// TriggerContext delivers target and params through the provider binary,
+// which sees ctx's cancellation and deadline.
+func (t *Trigger) TriggerContext(ctx context.Context, target string, params map[string]string, authToken string) error {
+	res, err := t.remote.trigger(ctx, &request{Settings: t.Settings, Target: target, Params: params, Token: authToken})
+	if err != nil {
+		switch {
+		case ctx.Err() != nil:
+			err = ctx.Err()
+		case status.Code(err) == codes.DeadlineExceeded:
+			// The binary shares ctx's deadline, and may end the call
+			// before ctx notices it has passed.
+			err = fmt.Errorf("%w: %w", context.DeadlineExceeded, err)
+		}
+		return &flow.DispatchError{Provider: t.Kind, Target: target, Trigger: t.Kind, Err: fmt.Errorf("plugin %s: %w", t.Kind, err)}
+	}
+	if res.Error == "" {
+		return nil
+	}
+	de := &flow.DispatchError{Provider: t.Kind, Target: target, Trigger: res.Trigger, StatusCode: res.StatusCode, Body: res.Body, Message: res.Message, Err: res.err()}
+	if de.Trigger == "" {
+		de.Trigger = t.Kind
+	}
+	return de
+}
+
+// providerPlugin is the go-plugin side of both ends: the binary serves
+// factory, and the dispatcher dispenses a client.
+type providerPlugin struct {
+	goplugin.NetRPCUnsupportedPlugin
+	factory flow.ProviderFactory
+}
+
+func (p *providerPlugin) GRPCServer(_ *goplugin.GRPCBroker, s *grpc.Server) error {
+	s.RegisterService(&providerServiceDesc, &grpcServer{factory: p.factory})
+	return nil
+}
+
+func (p *providerPlugin) GRPCClient(_ context.Context, _ *goplugin.GRPCBroker, conn *grpc.ClientConn) (interface{}, error) {
+	return &grpcClient{conn: conn}, nil
+}
+
+// grpcServer runs deliveries in the provider binary.
+type grpcServer struct {
+	factory flow.ProviderFactory
+}
+
+func (s *grpcServer) trigger(ctx context.Context, req *request) *response {
+	t, err := s.factory(req.Settings)
+	if err == nil {
+		if ct, ok := t.(flow.ContextTrigger); ok {
+			err = ct.TriggerContext(ctx, req.Target, req.Params, req.Token)
+		} else {
+			err = t.Trigger(req.Target, req.Params, req.Token)
+		}
+	} else {
+		err = &flow.ParamError{Reason: err.Error()}
+	}
+	return newResponse(err)
+}
+
+// newResponse describes err, or success if it is nil, for the dispatcher.
+func newResponse(err error) *response {
+	if err == nil {
+		return &response{}
+	}
+	res := &response{Error: err.Error(), Class: flow.ErrorClass(err)}
+	var de *flow.DispatchError
+	if errors.As(err, &de) {
+		res.Trigger, res.Message = de.Trigger, de.Message
+	}
+	var apiErr *flow.APIError
+	if errors.As(err, &apiErr) {
+		res.Method, res.Path, res.StatusCode, res.Body = apiErr.Method, apiErr.Path, apiErr.StatusCode, apiErr.Body
+	}
+	var paramErr *flow.ParamError
+	if errors.As(err, &paramErr) {
+		res.ParamKey = paramErr.Key
+		res.Error = paramErr.Reason
+	}
+	return res
+}
+
+// err rebuilds the error a response describes, so that ErrorClass gives
+// it the class it had in the provider binary.
+func (r *response) err() error {
+	if r.StatusCode != 0 {
+		return &flow.APIError{Method: r.Method, Path: r.Path, StatusCode: r.StatusCode, Body: r.Body}
+	}
+	switch r.Class {
+	case flow.ErrorInvalid:
+		return &flow.ParamError{Key: r.ParamKey, Reason: r.Error}
+	case flow.ErrorCancelled:
+		return fmt.Errorf("%s: %w", r.Error, context.Canceled)
+	case flow.ErrorNotFound:
+		return fmt.Errorf("%s: %w", r.Error, flow.ErrNotRegistered)
+	}
+	return errors.New(r.Error)
+}
@@ -0,0 +1,213 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// servePluginEnv makes the test binary serve testFactory, so the tests can
+// load it as a provider binary.
+const servePluginEnv = "NODEPROP_TEST_SERVE_PLUGIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(servePluginEnv) != "" {
+		Serve(testFactory)
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// testFactory builds triggers that fail as their mode setting says.
+func testFactory(settings map[string]string, _ ...flow.Option) (flow.Trigger, error) {
+	if settings["mode"] == "broken" {
+		return nil, errors.New("cluster is required")
+	}
+	return &testTrigger{mode: settings["mode"]}, nil
+}
+
+type testTrigger struct {
+	mode string
+}
+
+func (t *testTrigger) Trigger(target string, params map[string]string, authToken string) error {
+	return t.TriggerContext(context.Background(), target, params, authToken)
+}
+
+func (t *testTrigger) TriggerContext(ctx context.Context, target string, params map[string]string, authToken string) error {
+	switch t.mode {
+	case "not_found":
+		return &flow.DispatchError{Trigger: "deploy.yml", Message: "Not Found", Err: &flow.APIError{Method: "POST", Path: "/deploy", StatusCode: http.StatusNotFound, Body: `{"message": "Not Found"}`}}
+	case "invalid":
+		return &flow.ParamError{Key: "env", Reason: "unknown environment"}
+	case "network":
+		return errors.New("connection refused")
+	case "wait":
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	if target != "Cdaprod/site" || params["env"] != "prod" || authToken != "token" {
+		return errors.New("delivery arrived changed")
+	}
+	return nil
+}
+
+// loaded numbers the kinds load registers, which stay registered, so the
+// tests can run more than once.
+var loaded atomic.Int32
+
+// load starts the test binary as a provider of a kind starting with name.
+func load(t *testing.T, name string) *Plugin {
+	t.Helper()
+	kind := fmt.Sprintf("%s_%d", name, loaded.Add(1))
+	t.Setenv(servePluginEnv, "1")
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := Load(kind, exe)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	t.Cleanup(p.Kill)
+	return p
+}
+
+func TestPluginTriggers(t *testing.T) {
+	kind := load(t, "test_plugin").Kind
+	tests := []struct {
+		mode        string
+		wantClass   string
+		wantTrigger string
+		wantStatus  int
+		wantKey     string
+	}{
+		{mode: ""},
+		{mode: "not_found", wantClass: flow.ErrorNotFound, wantTrigger: "deploy.yml", wantStatus: http.StatusNotFound},
+		{mode: "invalid", wantClass: flow.ErrorInvalid, wantTrigger: kind, wantKey: "env"},
+		{mode: "broken", wantClass: flow.ErrorInvalid, wantTrigger: kind},
+		{mode: "network", wantClass: flow.ErrorNetwork, wantTrigger: kind},
+	}
+	for _, tt := range tests {
+		t.Run("mode "+tt.mode, func(t *testing.T) {
+			tr, err := flow.NewProvider(kind, map[string]string{"mode": tt.mode})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg := tr.(flow.ConfigurableTrigger).ProviderConfig(); cfg.Provider != kind || cfg.Settings["mode"] != tt.mode {
+				t.Errorf("ProviderConfig() = %+v", cfg)
+			}
+			err = tr.Trigger("Cdaprod/site", map[string]string{"env": "prod"}, "token")
+			if tt.wantClass == "" {
+				if err != nil {
+					t.Fatalf("Trigger() error = %v", err)
+				}
+				return
+			}
+			var de *flow.DispatchError
+			if !errors.As(err, &de) {
+				t.Fatalf("Trigger() error = %v, want a *flow.DispatchError", err)
+			}
+			if got := flow.ErrorClass(err); got != tt.wantClass {
+				t.Errorf("ErrorClass(%v) = %s, want %s", err, got, tt.wantClass)
+			}
+			if de.Provider != kind || de.Target != "Cdaprod/site" || de.Trigger != tt.wantTrigger || de.StatusCode != tt.wantStatus {
+				t.Errorf("DispatchError = %+v", de)
+			}
+			var pe *flow.ParamError
+			if tt.wantKey != "" && (!errors.As(err, &pe) || pe.Key != tt.wantKey) {
+				t.Errorf("Trigger() error = %v, want a *flow.ParamError for %s", err, tt.wantKey)
+			}
+		})
+	}
+
+	t.Run("cancelled", func(t *testing.T) {
+		tr, _ := flow.NewProvider(kind, map[string]string{"mode": "wait"})
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		err := tr.(flow.ContextTrigger).TriggerContext(ctx, "Cdaprod/site", nil, "token")
+		if got := flow.ErrorClass(err); got != flow.ErrorCancelled {
+			t.Errorf("TriggerContext() error = %v of class %s, want %s", err, got, flow.ErrorCancelled)
+		}
+	})
+}
+
+func TestPluginKill(t *testing.T) {
+	p := load(t, "test_plugin_killed")
+	tr, err := flow.NewProvider(p.Kind, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Kill()
+	if !p.Exited() {
+		t.Error("Exited() = false after Kill")
+	}
+	err = tr.Trigger("Cdaprod/site", nil, "token")
+	if got := flow.ErrorClass(err); got != flow.ErrorNetwork {
+		t.Errorf("Trigger() after Kill error = %v of class %s, want %s", err, got, flow.ErrorNetwork)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	notPlugin := filepath.Join(t.TempDir(), "not-a-plugin")
+	if err := os.WriteFile(notPlugin, []byte("#!/bin/sh\necho hello\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		kind    string
+		path    string
+		wantErr string
+	}{
+		{name: "built-in kind", kind: flow.ProviderWebhook, path: notPlugin, wantErr: "already registered"},
+		{name: "missing binary", kind: "missing_plugin", path: filepath.Join(t.TempDir(), "missing"), wantErr: "failed to start"},
+		{name: "not a plugin", kind: "not_a_plugin", path: notPlugin, wantErr: "failed to start"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(tt.kind, tt.path); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResponseRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantClass string
+	}{
+		{name: "api", err: &flow.APIError{Method: "POST", Path: "/x", StatusCode: http.StatusTooManyRequests}, wantClass: flow.ErrorRateLimited},
+		{name: "server", err: &flow.APIError{StatusCode: http.StatusBadGateway}, wantClass: flow.ErrorServer},
+		{name: "param", err: &flow.ParamError{Key: "env", Reason: "bad"}, wantClass: flow.ErrorInvalid},
+		{name: "cancelled", err: context.Canceled, wantClass: flow.ErrorCancelled},
+		{name: "not registered", err: flow.ErrNotRegistered, wantClass: flow.ErrorNotFound},
+		{name: "other", err: errors.New("boom"), wantClass: flow.ErrorNetwork},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := newResponse(tt.err)
+			got, err := res.encode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			back := decodeResponse(got).err()
+			if c := flow.ErrorClass(back); c != tt.wantClass {
+				t.Errorf("class after the round trip = %s, want %s: %v", c, tt.wantClass, back)
+			}
+		})
+	}
+	if res := newResponse(nil); res.Error != "" {
+		t.Errorf("newResponse(nil) = %+v, want success", res)
+	}
+}
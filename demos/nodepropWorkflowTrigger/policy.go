@@ -0,0 +1,258 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrPolicyDenied is wrapped by the errors of dispatches a policy refuses.
+var ErrPolicyDenied = errors.New("denied by policy")
+
+// PolicyError is a dispatch a policy refused, and why.
+type PolicyError struct {
+	// Rule is the name of the deny rule that matched; empty means no allow
+	// rule did.
+	Rule   string
+	Reason string
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrPolicyDenied, e.Reason)
+}
+
+func (e *PolicyError) Unwrap() error { return ErrPolicyDenied }
+
+// DispatchPolicy decides whether a dispatch may be made at all. Submit
+// consults it before anything else, so that nobody who can reach the
+// dispatcher triggers arbitrary workflows in arbitrary repositories.
+type DispatchPolicy interface {
+	// Check returns a *PolicyError if req must not be dispatched.
+	Check(ctx context.Context, req DispatchRequest) error
+}
+
+// DispatchPolicies allow a dispatch only if every policy does.
+type DispatchPolicies []DispatchPolicy
+
+// Check returns the first policy's refusal.
+func (ps DispatchPolicies) Check(ctx context.Context, req DispatchRequest) error {
+	for _, p := range ps {
+		if err := p.Check(ctx, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PolicyRule matches dispatches. Each field set narrows the rule: a
+// dispatch matches if it matches one pattern of every list set, and When
+// if set. Patterns are path.Match globs; orgs and repos match without
+// regard to case.
+type PolicyRule struct {
+	Name      string   `yaml:"name,omitempty" json:"name,omitempty"`
+	Orgs      []string `yaml:"orgs,omitempty" json:"orgs,omitempty"`
+	Repos     []string `yaml:"repos,omitempty" json:"repos,omitempty"`
+	Workflows []string `yaml:"workflows,omitempty" json:"workflows,omitempty"`
+	// Refs match branch and tag names with or without refs/heads/ or
+	// refs/tags/; an empty ref, meaning the default branch, matches "".
+	Refs []string `yaml:"refs,omitempty" json:"refs,omitempty"`
+	// RequestedBy matches who asked for the dispatch, e.g. key:ci,
+	// slack:*, or the local user of a command.
+	RequestedBy []string `yaml:"requested_by,omitempty" json:"requested_by,omitempty"`
+	// When is a CEL expression over repo, owner, workflow, ref,
+	// requested_by, schedule, and inputs, e.g. ref != "main" ||
+	// has(inputs.dry_run).
+	When string `yaml:"when,omitempty" json:"when,omitempty"`
+
+	program cel.Program
+}
+
+// name is how r is identified in errors.
+func (r *PolicyRule) name(kind string, i int) string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return fmt.Sprintf("%s rule %d", kind, i+1)
+}
+
+// Policy allows and denies dispatches by target and requester. A dispatch
+// matching a deny rule is refused; otherwise, if there are allow rules, it
+// must match one of them.
+//
+//	allow:
+//	  - orgs: [Cdaprod]
+//	    refs: [main, "release/*"]
+//	  - repos: [partner/docs]
+//	    workflows: [publish.yml]
+//	deny:
+//	  - name: no destroy from chat
+//	    workflows: ["*destroy*"]
+//	    requested_by: ["slack:*", "discord:*"]
+//	  - name: production from main only
+//	    when: has(inputs.environment) && inputs.environment == "production" && ref != "main"
+type Policy struct {
+	Allow []PolicyRule `yaml:"allow,omitempty" json:"allow,omitempty"`
+	Deny  []PolicyRule `yaml:"deny,omitempty" json:"deny,omitempty"`
+}
+
+// LoadPolicy reads and compiles a policy file.
+func LoadPolicy(file string) (*Policy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy: %w", err)
+	}
+	var p Policy
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse policy %s: %w", file, err)
+	}
+	if err := p.Compile(); err != nil {
+		return nil, fmt.Errorf("policy %s: %w", file, err)
+	}
+	return &p, nil
+}
+
+// policyEnv declares the variables When expressions may use.
+func policyEnv() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("repo", cel.StringType),
+		cel.Variable("owner", cel.StringType),
+		cel.Variable("workflow", cel.StringType),
+		cel.Variable("ref", cel.StringType),
+		cel.Variable("requested_by", cel.StringType),
+		cel.Variable("schedule", cel.StringType),
+		cel.Variable("inputs", cel.MapType(cel.StringType, cel.StringType)),
+	)
+}
+
+// Compile checks p's patterns and compiles its When expressions. It must
+// be called before Check on policies built in code; rules with When refuse
+// every dispatch until it is.
+func (p *Policy) Compile() error {
+	env, err := policyEnv()
+	if err != nil {
+		return err
+	}
+	for _, set := range []struct {
+		kind  string
+		rules []PolicyRule
+	}{{"allow", p.Allow}, {"deny", p.Deny}} {
+		kind := set.kind
+		for i := range set.rules {
+			r := &set.rules[i]
+			for _, patterns := range [][]string{r.Orgs, r.Repos, r.Workflows, r.Refs, r.RequestedBy} {
+				for _, pat := range patterns {
+					if _, err := path.Match(pat, ""); err != nil {
+						return fmt.Errorf("%s: invalid pattern %q", r.name(kind, i), pat)
+					}
+				}
+			}
+			if r.When == "" {
+				continue
+			}
+			ast, iss := env.Compile(r.When)
+			if iss.Err() != nil {
+				return fmt.Errorf("%s: %w", r.name(kind, i), iss.Err())
+			}
+			if !ast.OutputType().IsExactType(cel.BoolType) {
+				return fmt.Errorf("%s: when must be a boolean expression, not %v", r.name(kind, i), ast.OutputType())
+			}
+			if r.program, err = env.Program(ast); err != nil {
+				return fmt.Errorf("%s: %w", r.name(kind, i), err)
+			}
+		}
+	}
+	return nil
+}
+
+// Check refuses req if a deny rule matches it, or if no allow rule does.
+// A When expression that fails to evaluate, e.g. on a missing input,
+// counts as matching a deny rule and not matching an allow rule.
+func (p *Policy) Check(ctx context.Context, req DispatchRequest) error {
+	for i := range p.Deny {
+		r := &p.Deny[i]
+		matched, err := r.match(req)
+		if matched || err != nil {
+			reason := r.name("deny", i)
+			if err != nil {
+				reason += ": " + err.Error()
+			}
+			return &PolicyError{Rule: r.name("deny", i), Reason: fmt.Sprintf("%s %s on %s matches %s", req.Repo, req.Workflow, refOrDefault(req.Ref), reason)}
+		}
+	}
+	if len(p.Allow) == 0 {
+		return nil
+	}
+	for i := range p.Allow {
+		if matched, _ := p.Allow[i].match(req); matched {
+			return nil
+		}
+	}
+	return &PolicyError{Reason: fmt.Sprintf("%s %s on %s matches no allow rule", req.Repo, req.Workflow, refOrDefault(req.Ref))}
+}
+
+func refOrDefault(ref string) string {
+	if ref == "" {
+		return "the default branch"
+	}
+	return ref
+}
+
+// match reports whether req matches r.
+func (r *PolicyRule) match(req DispatchRequest) (bool, error) {
+	owner, _, _ := strings.Cut(req.Repo, "/")
+	ref := strings.TrimPrefix(strings.TrimPrefix(req.Ref, "refs/heads/"), "refs/tags/")
+	switch {
+	case !matchAny(r.Orgs, strings.ToLower(owner), true),
+		!matchAny(r.Repos, strings.ToLower(req.Repo), true),
+		!matchAny(r.Workflows, req.Workflow, false),
+		!matchAny(r.Refs, ref, false) && !matchAny(r.Refs, req.Ref, false),
+		!matchAny(r.RequestedBy, req.RequestedBy, false):
+		return false, nil
+	}
+	if r.When == "" {
+		return true, nil
+	}
+	if r.program == nil {
+		return false, errors.New("policy not compiled")
+	}
+	inputs := req.Inputs
+	if inputs == nil {
+		inputs = map[string]string{}
+	}
+	out, _, err := r.program.Eval(map[string]interface{}{
+		"repo":         req.Repo,
+		"owner":        owner,
+		"workflow":     req.Workflow,
+		"ref":          req.Ref,
+		"requested_by": req.RequestedBy,
+		"schedule":     req.Schedule,
+		"inputs":       inputs,
+	})
+	if err != nil {
+		return false, fmt.Errorf("when: %w", err)
+	}
+	matched, _ := out.Value().(bool)
+	return matched, nil
+}
+
+// matchAny reports whether s matches one of patterns, or patterns is empty.
+func matchAny(patterns []string, s string, fold bool) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pat := range patterns {
+		if fold {
+			pat = strings.ToLower(pat)
+		}
+		if ok, _ := path.Match(pat, s); ok {
+			return true
+		}
+	}
+	return false
+}
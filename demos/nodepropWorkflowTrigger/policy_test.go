@@ -0,0 +1,158 @@
+package flow_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+const testPolicy = `
+allow:
+  - orgs: [cdaprod]
+    refs: [main, "release/*"]
+  - repos: [partner/docs]
+    workflows: [publish.yml]
+deny:
+  - name: no destroy from chat
+    workflows: ["*destroy*"]
+    requested_by: ["slack:*", "discord:*"]
+  - name: production from main only
+    when: has(inputs.environment) && inputs.environment == "production" && ref != "main"
+`
+
+func TestPolicyCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yml")
+	if err := os.WriteFile(path, []byte(testPolicy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := flow.LoadPolicy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		req      flow.DispatchRequest
+		wantRule string
+		denied   bool
+	}{
+		{name: "org on main", req: flow.DispatchRequest{Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "main"}},
+		{name: "org case folded", req: flow.DispatchRequest{Repo: "CDAPROD/site", Workflow: "deploy.yml", Ref: "main"}},
+		{name: "full ref", req: flow.DispatchRequest{Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "refs/heads/release/1.2"}},
+		{name: "other branch", req: flow.DispatchRequest{Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "dev"}, denied: true},
+		{name: "default branch", req: flow.DispatchRequest{Repo: "Cdaprod/site", Workflow: "deploy.yml"}, denied: true},
+		{name: "partner workflow", req: flow.DispatchRequest{Repo: "partner/docs", Workflow: "publish.yml"}},
+		{name: "partner other workflow", req: flow.DispatchRequest{Repo: "partner/docs", Workflow: "deploy.yml"}, denied: true},
+		{name: "unknown org", req: flow.DispatchRequest{Repo: "evil/site", Workflow: "deploy.yml", Ref: "main"}, denied: true},
+		{
+			name: "destroy from chat", wantRule: "no destroy from chat", denied: true,
+			req: flow.DispatchRequest{Repo: "Cdaprod/infra", Workflow: "destroy-env.yml", Ref: "main", RequestedBy: "slack:U123"},
+		},
+		{name: "destroy from ci", req: flow.DispatchRequest{Repo: "Cdaprod/infra", Workflow: "destroy-env.yml", Ref: "main", RequestedBy: "key:ci"}},
+		{
+			name: "production from release", wantRule: "production from main only", denied: true,
+			req: flow.DispatchRequest{Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "release/1.2", Inputs: map[string]string{"environment": "production"}},
+		},
+		{name: "staging from release", req: flow.DispatchRequest{Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "release/1.2", Inputs: map[string]string{"environment": "staging"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.Check(context.Background(), tt.req)
+			if !tt.denied {
+				if err != nil {
+					t.Errorf("Check() = %v, want allowed", err)
+				}
+				return
+			}
+			var pe *flow.PolicyError
+			if !errors.As(err, &pe) || !errors.Is(err, flow.ErrPolicyDenied) {
+				t.Fatalf("Check() = %v, want a policy error", err)
+			}
+			if pe.Rule != tt.wantRule {
+				t.Errorf("Rule = %q, want %q", pe.Rule, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestPolicyWhenErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  flow.Policy
+		compile bool
+		denied  bool
+	}{
+		{name: "deny on missing input", policy: flow.Policy{Deny: []flow.PolicyRule{{When: `inputs.environment == "production"`}}}, compile: true, denied: true},
+		{name: "no allow on missing input", policy: flow.Policy{Allow: []flow.PolicyRule{{When: `inputs.environment == "staging"`}}}, compile: true, denied: true},
+		{name: "uncompiled deny", policy: flow.Policy{Deny: []flow.PolicyRule{{When: `ref == "dev"`}}}, denied: true},
+		{name: "uncompiled allow", policy: flow.Policy{Allow: []flow.PolicyRule{{When: `ref == "main"`}}}, denied: true},
+		{name: "compiled allow", policy: flow.Policy{Allow: []flow.PolicyRule{{When: `ref == "main" && requested_by == "" && schedule == ""`}}}, compile: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.compile {
+				if err := tt.policy.Compile(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := tt.policy.Check(context.Background(), flow.DispatchRequest{Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "main"})
+			if denied := errors.Is(err, flow.ErrPolicyDenied); denied != tt.denied {
+				t.Errorf("Check() = %v, want denied %v", err, tt.denied)
+			}
+		})
+	}
+}
+
+func TestPolicyCompile(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  flow.Policy
+		wantErr string
+	}{
+		{name: "valid", policy: flow.Policy{Allow: []flow.PolicyRule{{Refs: []string{"release/*"}, When: `owner == "Cdaprod"`}}}},
+		{name: "bad pattern", policy: flow.Policy{Deny: []flow.PolicyRule{{Name: "bad", Repos: []string{"[x"}}}}, wantErr: `bad: invalid pattern "[x"`},
+		{name: "bad expression", policy: flow.Policy{Allow: []flow.PolicyRule{{When: "ref =="}}}, wantErr: "allow rule 1"},
+		{name: "unknown variable", policy: flow.Policy{Deny: []flow.PolicyRule{{}, {When: "branch == 'main'"}}}, wantErr: "deny rule 2"},
+		{name: "not boolean", policy: flow.Policy{Allow: []flow.PolicyRule{{When: "ref"}}}, wantErr: "boolean"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Compile()
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Compile() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSubmitPolicy(t *testing.T) {
+	gh := nodeproptest.NewServer()
+	defer gh.Close()
+	gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+	c := newCorrelator(t, gh)
+	c.Actor = "slack:U123"
+	c.Policy = flow.DispatchPolicies{
+		&flow.Policy{Allow: []flow.PolicyRule{{Orgs: []string{"Cdaprod"}}}},
+		&flow.Policy{Deny: []flow.PolicyRule{{Name: "no chat", RequestedBy: []string{"slack:*"}}}},
+	}
+
+	_, err := c.Submit(context.Background(), flow.DispatchRequest{Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "main"})
+	var pe *flow.PolicyError
+	if !errors.As(err, &pe) || pe.Rule != "no chat" {
+		t.Errorf("Submit() error = %v, want denied by the actor rule", err)
+	}
+	if _, err := c.Submit(context.Background(), flow.DispatchRequest{Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "main", RequestedBy: "key:ci"}); err != nil {
+		t.Errorf("Submit() by key:ci error = %v", err)
+	}
+	if n := len(gh.Dispatches()); n != 1 {
+		t.Errorf("%d dispatches sent, want only the allowed one", n)
+	}
+	if recs, _ := c.History.List(""); len(recs) != 1 {
+		t.Errorf("history = %+v, want the refused dispatch unrecorded", recs)
+	}
+}
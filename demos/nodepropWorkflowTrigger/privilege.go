@@ -0,0 +1,247 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Token kinds, told apart by their prefixes.
+const (
+	TokenClassic      = "classic"
+	TokenOAuth        = "oauth"
+	TokenFineGrained  = "fine-grained"
+	TokenInstallation = "installation"
+	TokenAppUser      = "app-user"
+	TokenUnknown      = "unknown"
+)
+
+// TokenKind classifies a GitHub token by its prefix. Classic tokens from
+// before prefixes were introduced are 40 hex characters.
+func TokenKind(token string) string {
+	switch {
+	case strings.HasPrefix(token, "ghp_"):
+		return TokenClassic
+	case strings.HasPrefix(token, "gho_"):
+		return TokenOAuth
+	case strings.HasPrefix(token, "github_pat_"):
+		return TokenFineGrained
+	case strings.HasPrefix(token, "ghs_"):
+		return TokenInstallation
+	case strings.HasPrefix(token, "ghu_"):
+		return TokenAppUser
+	case len(token) == 40 && strings.Trim(token, "0123456789abcdef") == "":
+		return TokenClassic
+	}
+	return TokenUnknown
+}
+
+// RequiredAccess is what a set of triggers needs of a token: Scopes for a
+// classic or OAuth token, Permissions for a fine-grained or app token.
+type RequiredAccess struct {
+	Repos       []string          `json:"repos" yaml:"repos"`
+	Scopes      []string          `json:"scopes" yaml:"scopes"`
+	Permissions map[string]string `json:"permissions" yaml:"permissions"`
+}
+
+// Requirements derives the access the registry's triggers need:
+// dispatching, watching, and cancelling workflows needs actions: write, and
+// repository_dispatch events need contents: write. private says which
+// repositories are private; without any, public_repo is scope enough.
+func Requirements(reg *RepositoryRegistry, private map[string]bool) RequiredAccess {
+	req := RequiredAccess{Permissions: map[string]string{"metadata": "read"}}
+	repos := map[string]bool{}
+	for _, e := range reg.Repos() {
+		if len(e.Workflows) == 0 && len(e.Actions) == 0 {
+			continue
+		}
+		repos[e.Name] = true
+		if len(e.Workflows) > 0 {
+			req.Permissions["actions"] = "write"
+		}
+		if len(e.Actions) > 0 {
+			req.Permissions["contents"] = "write"
+		}
+	}
+	for _, s := range reg.Schedules() {
+		repos[s.Repo] = true
+		req.Permissions["actions"] = "write"
+	}
+	scope := "public_repo"
+	for repo := range repos {
+		req.Repos = append(req.Repos, repo)
+		if private[repo] {
+			scope = "repo"
+		}
+	}
+	sort.Strings(req.Repos)
+	req.Scopes = []string{scope}
+	return req
+}
+
+// impliedScopes lists the classic scopes a scope includes.
+var impliedScopes = map[string][]string{
+	"repo":             {"repo:status", "repo_deployment", "public_repo", "repo:invite", "security_events"},
+	"admin:org":        {"write:org", "read:org", "manage_runners:org"},
+	"write:org":        {"read:org"},
+	"admin:repo_hook":  {"write:repo_hook", "read:repo_hook"},
+	"write:repo_hook":  {"read:repo_hook"},
+	"admin:public_key": {"write:public_key", "read:public_key"},
+	"write:public_key": {"read:public_key"},
+	"admin:gpg_key":    {"write:gpg_key", "read:gpg_key"},
+	"write:gpg_key":    {"read:gpg_key"},
+	"write:packages":   {"read:packages"},
+	"user":             {"read:user", "user:email", "user:follow"},
+	"project":          {"read:project"},
+}
+
+// covers reports whether scope is among granted or implied by one of them.
+func covers(granted []string, scope string) bool {
+	for _, g := range granted {
+		if g == scope {
+			return true
+		}
+		for _, implied := range impliedScopes[g] {
+			if implied == scope {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PrivilegeReport compares what a token can do with what the triggers
+// need. Excess fields are privileges to remove, Missing fields ones the
+// triggers will fail without.
+type PrivilegeReport struct {
+	Kind     string         `json:"kind" yaml:"kind"`
+	Login    string         `json:"login,omitempty" yaml:"login,omitempty"`
+	Required RequiredAccess `json:"required" yaml:"required"`
+	// Scopes are the token's classic scopes; GitHub does not report the
+	// permissions of fine-grained and app tokens.
+	Scopes        []string `json:"scopes,omitempty" yaml:"scopes,omitempty"`
+	ExcessScopes  []string `json:"excess_scopes,omitempty" yaml:"excess_scopes,omitempty"`
+	MissingScopes []string `json:"missing_scopes,omitempty" yaml:"missing_scopes,omitempty"`
+	// Accessible counts the repositories the token reaches; AllRepos is set
+	// for an installation granted every repository of its account.
+	Accessible   int      `json:"accessible_repos" yaml:"accessible_repos"`
+	AllRepos     bool     `json:"all_repos,omitempty" yaml:"all_repos,omitempty"`
+	ExcessRepos  []string `json:"excess_repos,omitempty" yaml:"excess_repos,omitempty"`
+	MissingRepos []string `json:"missing_repos,omitempty" yaml:"missing_repos,omitempty"`
+	// Findings explain the report, most important first.
+	Findings []string `json:"findings" yaml:"findings"`
+}
+
+// OK reports whether the token has what the triggers need and no more that
+// the analysis can see.
+func (r *PrivilegeReport) OK() bool {
+	return len(r.ExcessScopes) == 0 && len(r.MissingScopes) == 0 && len(r.ExcessRepos) == 0 && len(r.MissingRepos) == 0 && !r.AllRepos
+}
+
+// AnalyzePrivileges compares the client's token with what the triggers in
+// reg need. It reads the registered repositories, in batched queries, to
+// learn whether each is private and reachable, and lists the repositories
+// the token reaches.
+func AnalyzePrivileges(ctx context.Context, c *GitHubClient, reg *RepositoryRegistry) (*PrivilegeReport, error) {
+	if _, err := c.token(ctx); err != nil {
+		return nil, err
+	}
+	r := &PrivilegeReport{Kind: TokenKind(c.currentToken()), Findings: []string{}}
+
+	private, reachable := map[string]bool{}, map[string]bool{}
+	names := Requirements(reg, nil).Repos
+	found, err := c.GetRepositories(ctx, names)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the registered repositories: %w", err)
+	}
+	for _, e := range names {
+		if repo, ok := found[e]; ok {
+			private[e], reachable[e] = repo.Private, true
+		} else {
+			// A private repository the token cannot see is not found.
+			private[e] = true
+		}
+	}
+	r.Required = Requirements(reg, private)
+	for _, repo := range r.Required.Repos {
+		if !reachable[repo] {
+			r.MissingRepos = append(r.MissingRepos, repo)
+		}
+	}
+
+	var repos []Repository
+	if r.Kind == TokenInstallation {
+		repos, r.AllRepos, err = c.ListInstallationRepos(ctx)
+	} else {
+		var info *TokenInfo
+		if info, err = c.TokenInfo(ctx); err != nil {
+			return nil, err
+		}
+		r.Login, r.Scopes = info.Login, info.Scopes
+		repos, err = c.ListAccessibleRepos(ctx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the repositories the token reaches: %w", err)
+	}
+	r.Accessible = len(repos)
+	required := map[string]bool{}
+	for _, repo := range r.Required.Repos {
+		required[strings.ToLower(repo)] = true
+	}
+	for _, repo := range repos {
+		if !required[strings.ToLower(repo.FullName)] {
+			r.ExcessRepos = append(r.ExcessRepos, repo.FullName)
+		}
+	}
+	sort.Strings(r.ExcessRepos)
+
+	// Only the required scope and the scopes it implies are needed.
+	if r.Scopes != nil {
+		for _, s := range r.Required.Scopes {
+			if !covers(r.Scopes, s) {
+				r.MissingScopes = append(r.MissingScopes, s)
+			}
+		}
+		for _, s := range r.Scopes {
+			if !covers(r.Required.Scopes, s) {
+				r.ExcessScopes = append(r.ExcessScopes, s)
+			}
+		}
+	}
+	r.findings()
+	return r, nil
+}
+
+// findings fills in r.Findings from the rest of the report.
+func (r *PrivilegeReport) findings() {
+	add := func(format string, args ...interface{}) {
+		r.Findings = append(r.Findings, fmt.Sprintf(format, args...))
+	}
+	if len(r.MissingRepos) > 0 {
+		add("registered repositories the token cannot reach: %s", strings.Join(r.MissingRepos, ", "))
+	}
+	if len(r.MissingScopes) > 0 {
+		add("missing scopes the triggers need: %s", strings.Join(r.MissingScopes, ", "))
+	}
+	if len(r.ExcessScopes) > 0 {
+		add("scopes the triggers do not need: %s", strings.Join(r.ExcessScopes, ", "))
+	}
+	if r.AllRepos {
+		add("the app installation reaches every repository of its account; select only the registered ones")
+	}
+	if len(r.ExcessRepos) > 0 {
+		add("repositories the token reaches that no trigger targets: %d", len(r.ExcessRepos))
+	}
+	perms := make([]string, 0, len(r.Required.Permissions))
+	for name, level := range r.Required.Permissions {
+		perms = append(perms, name+": "+level)
+	}
+	sort.Strings(perms)
+	switch r.Kind {
+	case TokenClassic, TokenOAuth:
+		add("classic tokens reach every repository their user can; a fine-grained token for the %d registered repositories with %s is least privilege", len(r.Required.Repos), strings.Join(perms, ", "))
+	case TokenFineGrained, TokenInstallation, TokenAppUser, TokenUnknown:
+		add("GitHub does not report this token's permissions; check that it has only %s", strings.Join(perms, ", "))
+	}
+}
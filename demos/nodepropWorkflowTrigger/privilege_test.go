@@ -0,0 +1,212 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenKind(t *testing.T) {
+	tests := []struct {
+		token string
+		want  string
+	}{
+		{token: "ghp_abc", want: TokenClassic},
+		{token: "gho_abc", want: TokenOAuth},
+		{token: "github_pat_abc", want: TokenFineGrained},
+		{token: "ghs_abc", want: TokenInstallation},
+		{token: "ghu_abc", want: TokenAppUser},
+		{token: strings.Repeat("0a", 20), want: TokenClassic},
+		{token: strings.Repeat("0A", 20), want: TokenUnknown},
+		{token: strings.Repeat("0a", 21), want: TokenUnknown},
+		{token: "", want: TokenUnknown},
+	}
+	for _, tt := range tests {
+		if got := TokenKind(tt.token); got != tt.want {
+			t.Errorf("TokenKind(%q) = %s, want %s", tt.token, got, tt.want)
+		}
+	}
+}
+
+func TestCovers(t *testing.T) {
+	tests := []struct {
+		granted []string
+		scope   string
+		want    bool
+	}{
+		{granted: []string{"repo"}, scope: "repo", want: true},
+		{granted: []string{"repo"}, scope: "public_repo", want: true},
+		{granted: []string{"public_repo"}, scope: "repo"},
+		{granted: []string{"admin:org"}, scope: "read:org", want: true},
+		{granted: []string{"write:org"}, scope: "admin:org"},
+		{granted: nil, scope: "public_repo"},
+	}
+	for _, tt := range tests {
+		if got := covers(tt.granted, tt.scope); got != tt.want {
+			t.Errorf("covers(%v, %s) = %v, want %v", tt.granted, tt.scope, got, tt.want)
+		}
+	}
+}
+
+func TestRequirements(t *testing.T) {
+	reg := NewRepositoryRegistry()
+	reg.RegisterRepo("Cdaprod/site", nil, []string{"deploy.yml"})
+	reg.RegisterRepo("Cdaprod/lib", []string{"release"}, nil)
+	reg.RegisterRepo("Cdaprod/docs", nil, nil)
+	if err := reg.SetSchedule(ScheduleEntry{Name: "nightly", Cron: "@daily", Repo: "Cdaprod/nightly", Workflow: "build.yml"}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		private map[string]bool
+		want    RequiredAccess
+	}{
+		{
+			name: "public",
+			want: RequiredAccess{
+				Repos:       []string{"Cdaprod/lib", "Cdaprod/nightly", "Cdaprod/site"},
+				Scopes:      []string{"public_repo"},
+				Permissions: map[string]string{"metadata": "read", "actions": "write", "contents": "write"},
+			},
+		},
+		{
+			name:    "private",
+			private: map[string]bool{"Cdaprod/lib": true},
+			want: RequiredAccess{
+				Repos:       []string{"Cdaprod/lib", "Cdaprod/nightly", "Cdaprod/site"},
+				Scopes:      []string{"repo"},
+				Permissions: map[string]string{"metadata": "read", "actions": "write", "contents": "write"},
+			},
+		},
+		{
+			name:    "private but untriggered",
+			private: map[string]bool{"Cdaprod/docs": true},
+			want: RequiredAccess{
+				Repos:       []string{"Cdaprod/lib", "Cdaprod/nightly", "Cdaprod/site"},
+				Scopes:      []string{"public_repo"},
+				Permissions: map[string]string{"metadata": "read", "actions": "write", "contents": "write"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Requirements(reg, tt.private); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Requirements() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// privilegeServer serves repos, whose absence means a repository is not
+// found, without GraphQL, and reports scopes for /user and accessible from
+// /user/repos and /installation/repositories.
+func privilegeServer(t *testing.T, repos map[string]Repository, scopes string, accessible []string, selection string) *httptest.Server {
+	t.Helper()
+	var list []Repository
+	for _, name := range accessible {
+		list = append(list, Repository{FullName: name})
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/user":
+			w.Header().Set("X-OAuth-Scopes", scopes)
+			json.NewEncoder(w).Encode(map[string]string{"login": "octocat"})
+		case r.URL.Path == "/user/repos":
+			json.NewEncoder(w).Encode(list)
+		case r.URL.Path == "/installation/repositories":
+			json.NewEncoder(w).Encode(map[string]interface{}{"repository_selection": selection, "repositories": list})
+		case strings.HasPrefix(r.URL.Path, "/repos/"):
+			if repo, ok := repos[strings.TrimPrefix(r.URL.Path, "/repos/")]; ok {
+				json.NewEncoder(w).Encode(repo)
+				return
+			}
+			fallthrough
+		default:
+			http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestAnalyzePrivileges(t *testing.T) {
+	reg := NewRepositoryRegistry()
+	reg.RegisterRepo("Cdaprod/site", nil, []string{"deploy.yml"})
+	reg.RegisterRepo("Cdaprod/lib", nil, []string{"release.yml"})
+	public := map[string]Repository{"Cdaprod/site": {FullName: "Cdaprod/site"}, "Cdaprod/lib": {FullName: "Cdaprod/lib"}}
+	registered := []string{"Cdaprod/lib", "Cdaprod/site"}
+	tests := []struct {
+		name       string
+		token      string
+		repos      map[string]Repository
+		scopes     string
+		accessible []string
+		selection  string
+		want       PrivilegeReport
+		wantOK     bool
+		finding    string
+	}{
+		{
+			name: "least privilege", token: "ghp_exact", repos: public, scopes: "public_repo", accessible: registered, wantOK: true,
+			want:    PrivilegeReport{Kind: TokenClassic, Login: "octocat", Scopes: []string{"public_repo"}, Accessible: 2},
+			finding: "a fine-grained token for the 2 registered repositories with actions: write, metadata: read",
+		},
+		{
+			name: "broad classic token", token: "ghp_broad", repos: public, scopes: "repo, admin:org", accessible: append([]string{"Cdaprod/extra"}, registered...),
+			want: PrivilegeReport{
+				Kind: TokenClassic, Login: "octocat", Scopes: []string{"repo", "admin:org"}, ExcessScopes: []string{"repo", "admin:org"},
+				Accessible: 3, ExcessRepos: []string{"Cdaprod/extra"},
+			},
+			finding: "scopes the triggers do not need: repo, admin:org",
+		},
+		{
+			name: "private repository", token: "gho_user", scopes: "public_repo", accessible: registered,
+			repos: map[string]Repository{"Cdaprod/site": {FullName: "Cdaprod/site", Private: true}, "Cdaprod/lib": {FullName: "Cdaprod/lib"}},
+			want:  PrivilegeReport{Kind: TokenOAuth, Login: "octocat", Scopes: []string{"public_repo"}, MissingScopes: []string{"repo"}, Accessible: 2},
+		},
+		{
+			name: "unreachable repository", token: "ghp_partial", scopes: "repo", accessible: []string{"Cdaprod/site"},
+			repos:   map[string]Repository{"Cdaprod/site": {FullName: "Cdaprod/site"}},
+			want:    PrivilegeReport{Kind: TokenClassic, Login: "octocat", Scopes: []string{"repo"}, Accessible: 1, MissingRepos: []string{"Cdaprod/lib"}},
+			finding: "registered repositories the token cannot reach: Cdaprod/lib",
+		},
+		{
+			name: "installation on every repository", token: "ghs_install", repos: public, accessible: registered, selection: "all",
+			want:    PrivilegeReport{Kind: TokenInstallation, Accessible: 2, AllRepos: true},
+			finding: "reaches every repository of its account",
+		},
+		{
+			name: "fine-grained", token: "github_pat_x", repos: public, accessible: registered, wantOK: true,
+			want:    PrivilegeReport{Kind: TokenFineGrained, Login: "octocat", Accessible: 2},
+			finding: "GitHub does not report this token's permissions",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewGitHubClient(tt.token)
+			c.BaseURL = privilegeServer(t, tt.repos, tt.scopes, tt.accessible, tt.selection).URL
+			r, err := AnalyzePrivileges(context.Background(), c, reg)
+			if err != nil {
+				t.Fatalf("AnalyzePrivileges() error = %v", err)
+			}
+			if r.OK() != tt.wantOK {
+				t.Errorf("OK() = %v, want %v: %+v", r.OK(), tt.wantOK, r)
+			}
+			got := *r
+			got.Required, got.Findings = RequiredAccess{}, nil
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("AnalyzePrivileges() = %+v, want %+v", got, tt.want)
+			}
+			if !reflect.DeepEqual(r.Required.Repos, registered) {
+				t.Errorf("Required.Repos = %v, want %v", r.Required.Repos, registered)
+			}
+			if tt.finding != "" && !strings.Contains(strings.Join(r.Findings, "\n"), tt.finding) {
+				t.Errorf("Findings = %q, want one containing %q", r.Findings, tt.finding)
+			}
+		})
+	}
+}
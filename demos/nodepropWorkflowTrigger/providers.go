@@ -0,0 +1,109 @@
+package flow
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ProviderFactory builds a trigger of one provider from its settings, such
+// as the workflow file and ref of a workflow dispatch, and the options of
+// the caller, which it may ignore.
+type ProviderFactory func(settings map[string]string, opts ...Option) (Trigger, error)
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]ProviderFactory{
+		ProviderGitHubWorkflow:     newWorkflowProvider,
+		ProviderGitHubRepoDispatch: newRepoDispatchProvider,
+		ProviderWebhook:            newWebhookProvider,
+	}
+)
+
+// RegisterProvider makes NewProvider build triggers of kind with factory.
+// It is meant for providers in other packages, such as those the plugin
+// package loads, and panics if kind is taken.
+func RegisterProvider(kind string, factory ProviderFactory) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	if _, dup := providers[kind]; dup || kind == "" {
+		panic("flow: provider " + kind + " registered twice")
+	}
+	providers[kind] = factory
+}
+
+// NewProvider builds a trigger of kind from settings:
+//
+//	github_workflow             workflow (required), ref, base_url
+//	github_repository_dispatch  event_type (required), base_url
+//	webhook                     url (required), secret (a token source),
+//	                            signature_header
+//
+// or one of the kinds added with RegisterProvider. opts configure the
+// package's own kinds as they do their constructors.
+func NewProvider(kind string, settings map[string]string, opts ...Option) (Trigger, error) {
+	providersMu.RLock()
+	factory, ok := providers[kind]
+	providersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown provider %q", kind)
+	}
+	t, err := factory(settings, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("provider %s: %w", kind, err)
+	}
+	return t, nil
+}
+
+// Providers lists the kinds NewProvider builds, sorted.
+func Providers() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	kinds := make([]string, 0, len(providers))
+	for kind := range providers {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+func newWorkflowProvider(settings map[string]string, opts ...Option) (Trigger, error) {
+	if settings["workflow"] == "" {
+		return nil, fmt.Errorf("workflow is required")
+	}
+	w := NewGitHubWorkflowDispatch(settings["workflow"], opts...)
+	if ref := settings["ref"]; ref != "" {
+		w.Ref = ref
+	}
+	if u := settings["base_url"]; u != "" {
+		w.BaseURL = u
+	}
+	return w, nil
+}
+
+func newRepoDispatchProvider(settings map[string]string, opts ...Option) (Trigger, error) {
+	if settings["event_type"] == "" {
+		return nil, fmt.Errorf("event_type is required")
+	}
+	r := NewGitHubRepoDispatch(settings["event_type"], opts...)
+	if u := settings["base_url"]; u != "" {
+		r.BaseURL = u
+	}
+	return r, nil
+}
+
+func newWebhookProvider(settings map[string]string, opts ...Option) (Trigger, error) {
+	if settings["url"] == "" {
+		return nil, fmt.Errorf("url is required")
+	}
+	w := NewWebhookTrigger(settings["url"], opts...)
+	w.SignatureHeader = settings["signature_header"]
+	if src := settings["secret"]; src != "" {
+		secret, err := ParseTokenSource(src)
+		if err != nil {
+			return nil, fmt.Errorf("secret: %w", err)
+		}
+		w.Secret, w.secretSource = secret, src
+	}
+	return w, nil
+}
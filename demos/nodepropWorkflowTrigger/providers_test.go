@@ -0,0 +1,116 @@
+package flow
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNewProvider(t *testing.T) {
+	hc := &http.Client{}
+	tests := []struct {
+		name     string
+		kind     string
+		settings map[string]string
+		check    func(Trigger) bool
+		wantErr  string
+	}{
+		{
+			name:     "workflow",
+			kind:     ProviderGitHubWorkflow,
+			settings: map[string]string{"workflow": "deploy.yml", "ref": "release", "base_url": "https://ghe.example.com/api/v3"},
+			check: func(t Trigger) bool {
+				w, ok := t.(*GitHubWorkflowDispatch)
+				return ok && w.WorkflowFile == "deploy.yml" && w.Ref == "release" && w.BaseURL == "https://ghe.example.com/api/v3" && w.HTTPClient == hc
+			},
+		},
+		{
+			name:     "workflow settings win over options",
+			kind:     ProviderGitHubWorkflow,
+			settings: map[string]string{"workflow": "deploy.yml"},
+			check: func(t Trigger) bool {
+				w, ok := t.(*GitHubWorkflowDispatch)
+				return ok && w.Ref == "main"
+			},
+		},
+		{name: "workflow missing", kind: ProviderGitHubWorkflow, settings: map[string]string{"ref": "main"}, wantErr: "workflow is required"},
+		{
+			name:     "repository dispatch",
+			kind:     ProviderGitHubRepoDispatch,
+			settings: map[string]string{"event_type": "deploy"},
+			check: func(t Trigger) bool {
+				r, ok := t.(*GitHubRepoDispatch)
+				return ok && r.EventType == "deploy" && r.BaseURL == "" && r.HTTPClient == hc
+			},
+		},
+		{name: "event type missing", kind: ProviderGitHubRepoDispatch, wantErr: "event_type is required"},
+		{
+			name:     "webhook",
+			kind:     ProviderWebhook,
+			settings: map[string]string{"url": "https://hooks.example.com", "secret": "env:NODEPROP_TEST_HOOK_SECRET", "signature_header": "X-Sig"},
+			check: func(t Trigger) bool {
+				w, ok := t.(*WebhookTrigger)
+				return ok && w.URL == "https://hooks.example.com" && w.SignatureHeader == "X-Sig" && w.Secret != nil && w.secretSource == "env:NODEPROP_TEST_HOOK_SECRET"
+			},
+		},
+		{name: "webhook url missing", kind: ProviderWebhook, wantErr: "url is required"},
+		{name: "webhook bad secret", kind: ProviderWebhook, settings: map[string]string{"url": "https://hooks.example.com", "secret": "vault:x"}, wantErr: "secret"},
+		{name: "unknown", kind: "jenkins", wantErr: `unknown provider "jenkins"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewProvider(tt.kind, tt.settings, WithRef("main"), WithHTTPClient(hc))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("NewProvider() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewProvider() error = %v", err)
+			}
+			if !tt.check(got) {
+				t.Errorf("NewProvider() = %+v", got)
+			}
+		})
+	}
+}
+
+func TestRegisterProvider(t *testing.T) {
+	const kind = "test_provider"
+	t.Cleanup(func() {
+		providersMu.Lock()
+		delete(providers, kind)
+		providersMu.Unlock()
+	})
+	errNoCluster := errors.New("cluster is required")
+	RegisterProvider(kind, func(settings map[string]string, _ ...Option) (Trigger, error) {
+		if settings["cluster"] == "" {
+			return nil, errNoCluster
+		}
+		return &GitHubRepoDispatch{EventType: settings["cluster"]}, nil
+	})
+
+	if got := Providers(); !slices.IsSorted(got) || !slices.Contains(got, kind) || !slices.Contains(got, ProviderWebhook) {
+		t.Errorf("Providers() = %v, want the registered kind among the built-in ones, sorted", got)
+	}
+	if tr, err := NewProvider(kind, map[string]string{"cluster": "eu-1"}); err != nil || tr.(*GitHubRepoDispatch).EventType != "eu-1" {
+		t.Errorf("NewProvider() = %v, %v", tr, err)
+	}
+	if _, err := NewProvider(kind, nil); !errors.Is(err, errNoCluster) || !strings.Contains(err.Error(), kind) {
+		t.Errorf("NewProvider() error = %v, want the factory's, naming the kind", err)
+	}
+
+	for _, k := range []string{kind, ProviderWebhook, ""} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("RegisterProvider(%q) did not panic", k)
+				}
+			}()
+			RegisterProvider(k, newWebhookProvider)
+		}()
+	}
+}
@@ -0,0 +1,30 @@
+package providertest
+
+import (
+	"maps"
+	"net/url"
+	"testing"
+)
+
+func TestFields(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		body string
+		want map[string]string
+	}{
+		{name: "json", url: "/", body: `{"event_type": "x", "client_payload": {"env": "prod", "n": 2}}`, want: map[string]string{"event_type": "x", "env": "prod"}},
+		{name: "json array", url: "/", body: `[{"a": "1"}, {"b": "2"}]`, want: map[string]string{"a": "1", "b": "2"}},
+		{name: "form", url: "/", body: "env=prod&q=a%26b", want: map[string]string{"env": "prod", "q": "a&b"}},
+		{name: "query", url: "/hook?target=o%2Fr&env=dev", want: map[string]string{"target": "o/r", "env": "dev"}},
+		{name: "body wins over query", url: "/hook?env=dev", body: `{"env": "prod"}`, want: map[string]string{"env": "prod"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, _ := url.Parse(tt.url)
+			if got := fields(request{url: u, body: []byte(tt.body)}); !maps.Equal(got, tt.want) {
+				t.Errorf("fields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
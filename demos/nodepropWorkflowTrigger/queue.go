@@ -0,0 +1,226 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Defaults of a DispatchQueue.
+const (
+	DefaultQueueCapacity = 1000
+	DefaultQueueWorkers  = 8
+)
+
+// OverflowPolicy is what a full DispatchQueue does with another job.
+type OverflowPolicy string
+
+const (
+	// OverflowBlock makes Enqueue wait for room, pushing back on the
+	// sender, e.g. by holding its webhook delivery open.
+	OverflowBlock OverflowPolicy = "block"
+	// OverflowDropOldest drops the oldest queued job to make room, for
+	// events where the latest matters most.
+	OverflowDropOldest OverflowPolicy = "drop-oldest"
+	// OverflowReject refuses the job with ErrQueueFull, so the sender can
+	// retry later.
+	OverflowReject OverflowPolicy = "reject"
+)
+
+// ParseOverflowPolicy parses block, drop-oldest, or reject. Empty means
+// OverflowBlock.
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	switch p := OverflowPolicy(s); p {
+	case "":
+		return OverflowBlock, nil
+	case OverflowBlock, OverflowDropOldest, OverflowReject:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown overflow policy %q: want block, drop-oldest, or reject", s)
+}
+
+var (
+	// ErrQueueFull is returned by Enqueue when a queue that rejects on
+	// overflow is full.
+	ErrQueueFull = errors.New("dispatch queue is full")
+	// ErrQueueClosed is returned by Enqueue once Close was called.
+	ErrQueueClosed = errors.New("dispatch queue is closed")
+)
+
+// QueueJob is work queued on a DispatchQueue, typically the dispatches
+// routed from one event.
+type QueueJob struct {
+	// Name describes the job in logs.
+	Name string
+	// Run does the work. It is called on one of the queue's workers.
+	Run func()
+	// Dropped, if set, is called instead of Run when the job is dropped
+	// for a newer one.
+	Dropped func()
+}
+
+// QueueStats counts a DispatchQueue's jobs.
+type QueueStats struct {
+	Capacity int
+	// Queued jobs wait for a worker; Running jobs have one.
+	Queued  int
+	Running int
+	// Dropped and Rejected count jobs lost to the overflow policy since
+	// the queue was created.
+	Dropped  uint64
+	Rejected uint64
+}
+
+// DispatchQueue is a bounded queue between the events that ask for
+// dispatches and a fixed pool of workers that send them, so a burst of
+// events queues up to Capacity jobs instead of starting a goroutine and a
+// round of API requests for each, and what happens beyond that is chosen
+// by its OverflowPolicy. Create it with NewDispatchQueue.
+type DispatchQueue struct {
+	capacity int
+	overflow OverflowPolicy
+
+	mu       sync.Mutex
+	jobs     []QueueJob
+	closed   bool
+	running  int
+	dropped  uint64
+	rejected uint64
+	// changed is closed and replaced whenever jobs or closed change.
+	changed chan struct{}
+	workers sync.WaitGroup
+}
+
+// NewDispatchQueue starts a queue of up to capacity jobs run by workers
+// goroutines. Values below 1 mean DefaultQueueCapacity and
+// DefaultQueueWorkers; an empty overflow means OverflowBlock.
+func NewDispatchQueue(capacity, workers int, overflow OverflowPolicy) *DispatchQueue {
+	if capacity < 1 {
+		capacity = DefaultQueueCapacity
+	}
+	if workers < 1 {
+		workers = DefaultQueueWorkers
+	}
+	if overflow == "" {
+		overflow = OverflowBlock
+	}
+	q := &DispatchQueue{capacity: capacity, overflow: overflow, changed: make(chan struct{})}
+	q.workers.Add(workers)
+	for range workers {
+		go q.work()
+	}
+	return q
+}
+
+// Overflow returns the queue's overflow policy.
+func (q *DispatchQueue) Overflow() OverflowPolicy {
+	return q.overflow
+}
+
+// Enqueue adds job to the queue. When the queue is full it waits for room
+// until ctx is done, drops the oldest job, or returns ErrQueueFull, as the
+// overflow policy says.
+func (q *DispatchQueue) Enqueue(ctx context.Context, job QueueJob) error {
+	q.mu.Lock()
+	for {
+		if q.closed {
+			q.mu.Unlock()
+			return ErrQueueClosed
+		}
+		if len(q.jobs) < q.capacity {
+			q.jobs = append(q.jobs, job)
+			q.notifyLocked()
+			q.mu.Unlock()
+			return nil
+		}
+		switch q.overflow {
+		case OverflowReject:
+			q.rejected++
+			q.mu.Unlock()
+			return ErrQueueFull
+		case OverflowDropOldest:
+			oldest := q.jobs[0]
+			q.jobs[0] = QueueJob{}
+			q.jobs = append(q.jobs[1:], job)
+			q.dropped++
+			q.notifyLocked()
+			q.mu.Unlock()
+			if oldest.Dropped != nil {
+				oldest.Dropped()
+			}
+			return nil
+		}
+		changed := q.changed
+		q.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		q.mu.Lock()
+	}
+}
+
+// Stats returns the queue's current counts.
+func (q *DispatchQueue) Stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return QueueStats{Capacity: q.capacity, Queued: len(q.jobs), Running: q.running, Dropped: q.dropped, Rejected: q.rejected}
+}
+
+// Close stops the queue accepting jobs and waits until ctx is done for
+// the workers to run those already queued.
+func (q *DispatchQueue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		q.notifyLocked()
+	}
+	q.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		q.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// work runs queued jobs until the queue is closed and empty.
+func (q *DispatchQueue) work() {
+	defer q.workers.Done()
+	q.mu.Lock()
+	for {
+		for len(q.jobs) == 0 && !q.closed {
+			changed := q.changed
+			q.mu.Unlock()
+			<-changed
+			q.mu.Lock()
+		}
+		if len(q.jobs) == 0 {
+			q.mu.Unlock()
+			return
+		}
+		job := q.jobs[0]
+		q.jobs[0] = QueueJob{}
+		q.jobs = q.jobs[1:]
+		q.running++
+		q.notifyLocked()
+		q.mu.Unlock()
+
+		job.Run()
+
+		q.mu.Lock()
+		q.running--
+	}
+}
+
+func (q *DispatchQueue) notifyLocked() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
@@ -0,0 +1,202 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseOverflowPolicy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    OverflowPolicy
+		wantErr bool
+	}{
+		{in: "", want: OverflowBlock},
+		{in: "block", want: OverflowBlock},
+		{in: "drop-oldest", want: OverflowDropOldest},
+		{in: "reject", want: OverflowReject},
+		{in: "drop-newest", wantErr: true},
+		{in: "Block", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseOverflowPolicy(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseOverflowPolicy(%q) = %q, %v; want %q, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// gatedQueue is a DispatchQueue with one worker held by a job until
+// release is called, recording the names of the jobs it runs and drops.
+type gatedQueue struct {
+	*DispatchQueue
+	release func()
+
+	mu      sync.Mutex
+	ran     []string
+	dropped []string
+}
+
+func newGatedQueue(t *testing.T, capacity int, overflow OverflowPolicy) *gatedQueue {
+	t.Helper()
+	q := &gatedQueue{DispatchQueue: NewDispatchQueue(capacity, 1, overflow)}
+	started, gate := make(chan struct{}), make(chan struct{})
+	q.release = sync.OnceFunc(func() { close(gate) })
+	t.Cleanup(q.release)
+	if err := q.Enqueue(context.Background(), QueueJob{Name: "gate", Run: func() { close(started); <-gate }}); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	return q
+}
+
+func (q *gatedQueue) job(name string) QueueJob {
+	record := func(names *[]string) func() {
+		return func() {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			*names = append(*names, name)
+		}
+	}
+	return QueueJob{Name: name, Run: record(&q.ran), Dropped: record(&q.dropped)}
+}
+
+// drain releases the gate and waits for the queued jobs to run.
+func (q *gatedQueue) drain(t *testing.T) {
+	t.Helper()
+	q.release()
+	if err := q.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDispatchQueueOverflow(t *testing.T) {
+	tests := []struct {
+		overflow    OverflowPolicy
+		wantErr     error
+		wantRan     []string
+		wantDropped []string
+		wantStats   QueueStats
+	}{
+		{
+			overflow:  OverflowBlock,
+			wantErr:   context.DeadlineExceeded,
+			wantRan:   []string{"a", "b"},
+			wantStats: QueueStats{Capacity: 2, Queued: 2, Running: 1},
+		},
+		{
+			overflow:    OverflowDropOldest,
+			wantRan:     []string{"b", "c"},
+			wantDropped: []string{"a"},
+			wantStats:   QueueStats{Capacity: 2, Queued: 2, Running: 1, Dropped: 1},
+		},
+		{
+			overflow:  OverflowReject,
+			wantErr:   ErrQueueFull,
+			wantRan:   []string{"a", "b"},
+			wantStats: QueueStats{Capacity: 2, Queued: 2, Running: 1, Rejected: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.overflow), func(t *testing.T) {
+			q := newGatedQueue(t, 2, tt.overflow)
+			ctx := context.Background()
+			for _, name := range []string{"a", "b"} {
+				if err := q.Enqueue(ctx, q.job(name)); err != nil {
+					t.Fatalf("Enqueue(%s) error = %v", name, err)
+				}
+			}
+			ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+			defer cancel()
+			if err := q.Enqueue(ctx, q.job("c")); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Enqueue() of a job that does not fit error = %v, want %v", err, tt.wantErr)
+			}
+			if got := q.Stats(); got != tt.wantStats {
+				t.Errorf("Stats() = %+v, want %+v", got, tt.wantStats)
+			}
+
+			q.drain(t)
+			if !slices.Equal(q.ran, tt.wantRan) || !slices.Equal(q.dropped, tt.wantDropped) {
+				t.Errorf("ran %v and dropped %v, want %v and %v", q.ran, q.dropped, tt.wantRan, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestDispatchQueueBlockWaitsForRoom(t *testing.T) {
+	q := newGatedQueue(t, 1, OverflowBlock)
+	if err := q.Enqueue(context.Background(), q.job("a")); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- q.Enqueue(context.Background(), q.job("b")) }()
+	select {
+	case err := <-done:
+		t.Fatalf("Enqueue() on a full queue returned %v before there was room", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	q.release()
+	if err := <-done; err != nil {
+		t.Fatalf("Enqueue() once there was room error = %v", err)
+	}
+	q.drain(t)
+	if !slices.Equal(q.ran, []string{"a", "b"}) {
+		t.Errorf("ran %v, want [a b]", q.ran)
+	}
+}
+
+func TestDispatchQueueClose(t *testing.T) {
+	q := newGatedQueue(t, 4, OverflowBlock)
+	for _, name := range []string{"a", "b"} {
+		if err := q.Enqueue(context.Background(), q.job(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The gate job holds the only worker, so Close gives up with ctx.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := q.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close() with a job still running error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if err := q.Enqueue(context.Background(), q.job("c")); err != ErrQueueClosed {
+		t.Errorf("Enqueue() after Close error = %v, want %v", err, ErrQueueClosed)
+	}
+
+	q.drain(t)
+	if !slices.Equal(q.ran, []string{"a", "b"}) {
+		t.Errorf("ran %v, want the jobs queued before Close", q.ran)
+	}
+	if got := q.Stats(); got.Queued != 0 || got.Running != 0 {
+		t.Errorf("Stats() after Close = %+v, want nothing left", got)
+	}
+}
+
+func TestNewDispatchQueueDefaults(t *testing.T) {
+	q := NewDispatchQueue(0, 0, "")
+	defer q.Close(context.Background())
+	if got := q.Stats().Capacity; got != DefaultQueueCapacity {
+		t.Errorf("Capacity = %d, want %d", got, DefaultQueueCapacity)
+	}
+	if got := q.Overflow(); got != OverflowBlock {
+		t.Errorf("Overflow() = %q, want %q", got, OverflowBlock)
+	}
+
+	// Every default worker picks up a job at once.
+	var started sync.WaitGroup
+	release := make(chan struct{})
+	started.Add(DefaultQueueWorkers)
+	for range DefaultQueueWorkers {
+		q.Enqueue(context.Background(), QueueJob{Run: func() { started.Done(); <-release }})
+	}
+	started.Wait()
+	if got := q.Stats().Running; got != DefaultQueueWorkers {
+		t.Errorf("Running = %d, want %d", got, DefaultQueueWorkers)
+	}
+	close(release)
+}
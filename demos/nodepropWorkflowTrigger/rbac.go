@@ -0,0 +1,167 @@
+package flow
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Roles granted by role bindings. Each includes the ones before it: an
+// admin may do everything, a triggerer may also view.
+const (
+	RoleViewer    = "viewer"
+	RoleTriggerer = "triggerer"
+	RoleAdmin     = "admin"
+)
+
+var roleRank = map[string]int{RoleViewer: 1, RoleTriggerer: 2, RoleAdmin: 3}
+
+// RoleIncludes reports whether role grants everything want does.
+func RoleIncludes(role, want string) bool {
+	return roleRank[role] > 0 && roleRank[role] >= roleRank[want]
+}
+
+// RoleBinding grants a role to API callers. Bindings are kept in the
+// registry file under "roles", so each tenant's registry holds its own:
+//
+//	roles:
+//	  - role: admin
+//	    subjects: [key:ops]
+//	  - role: triggerer
+//	    subjects: [key:ci, "jwt:*@example.com"]
+//	    repos: ["Cdaprod/*"]
+//	  - role: viewer
+//	    subjects: ["jwt:*"]
+type RoleBinding struct {
+	Role string `yaml:"role" json:"role"`
+	// Subjects are path.Match globs of the callers' identities, such as
+	// key:ci or jwt:alice@example.com.
+	Subjects []string `yaml:"subjects" json:"subjects"`
+	// Repos, if set, limits the binding to repositories matching these
+	// globs, without regard to case. A binding without them grants the
+	// role in every repository and over the server itself, such as its
+	// role bindings.
+	Repos []string `yaml:"repos,omitempty" json:"repos,omitempty"`
+	// Tenants, in the server's own registry, extends the binding to the
+	// tenants whose names match. It is ignored in a tenant's registry.
+	Tenants []string `yaml:"tenants,omitempty" json:"tenants,omitempty"`
+}
+
+// validate checks b's role and patterns.
+func (b RoleBinding) validate() error {
+	if roleRank[b.Role] == 0 {
+		return fmt.Errorf("unknown role %q (want viewer, triggerer, or admin)", b.Role)
+	}
+	if len(b.Subjects) == 0 {
+		return fmt.Errorf("%s binding has no subjects", b.Role)
+	}
+	for _, patterns := range [][]string{b.Subjects, b.Repos, b.Tenants} {
+		for _, pat := range patterns {
+			if _, err := path.Match(pat, ""); err != nil || pat == "" {
+				return fmt.Errorf("%s binding: invalid pattern %q", b.Role, pat)
+			}
+		}
+	}
+	return nil
+}
+
+// Grants reports whether b gives subject role in repo. An empty repo asks
+// for the role over the whole server, which only bindings without Repos
+// give.
+func (b RoleBinding) Grants(subject, role, repo string) bool {
+	if !RoleIncludes(b.Role, role) || !matchAny(b.Subjects, subject, false) {
+		return false
+	}
+	if len(b.Repos) == 0 {
+		return true
+	}
+	return repo != "" && matchAny(b.Repos, strings.ToLower(repo), true)
+}
+
+// GrantsAny reports whether b gives subject role anywhere.
+func (b RoleBinding) GrantsAny(subject, role string) bool {
+	return RoleIncludes(b.Role, role) && matchAny(b.Subjects, subject, false)
+}
+
+// AppliesTo reports whether a binding of the server's own registry extends
+// to the named tenant.
+func (b RoleBinding) AppliesTo(tenant string) bool {
+	return len(b.Tenants) > 0 && matchAny(b.Tenants, tenant, false)
+}
+
+// RoleBindings returns the registry's role bindings in file order.
+func (r *RepositoryRegistry) RoleBindings() []RoleBinding {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]RoleBinding(nil), r.roles...)
+}
+
+// SetRoleBindings replaces the registry's role bindings.
+func (r *RepositoryRegistry) SetRoleBindings(bindings []RoleBinding) error {
+	for i, b := range bindings {
+		if err := b.validate(); err != nil {
+			return fmt.Errorf("role binding %d: %w", i+1, err)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.roles = append([]RoleBinding(nil), bindings...)
+	return nil
+}
+
+// Grant adds subject to the binding of role with the same repos and
+// tenants, creating it if there is none.
+func (r *RepositoryRegistry) Grant(subject string, b RoleBinding) error {
+	b.Subjects = []string{subject}
+	if err := b.validate(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, e := range r.roles {
+		if e.Role == b.Role && slices.Equal(e.Repos, b.Repos) && slices.Equal(e.Tenants, b.Tenants) {
+			for _, s := range e.Subjects {
+				if s == subject {
+					return nil
+				}
+			}
+			r.roles[i].Subjects = append(e.Subjects, subject)
+			return nil
+		}
+	}
+	r.roles = append(r.roles, b)
+	return nil
+}
+
+// Revoke removes subject from every binding, or only from those of role if
+// it is set, dropping bindings left without subjects.
+func (r *RepositoryRegistry) Revoke(subject, role string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	found := false
+	kept := r.roles[:0]
+	for _, b := range r.roles {
+		if role == "" || b.Role == role {
+			subjects := b.Subjects[:0:0]
+			for _, s := range b.Subjects {
+				if s == subject {
+					found = true
+				} else {
+					subjects = append(subjects, s)
+				}
+			}
+			if len(subjects) == 0 {
+				continue
+			}
+			b.Subjects = subjects
+		}
+		kept = append(kept, b)
+	}
+	r.roles = kept
+	if !found {
+		return errors.New("no role is bound to " + subject)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package flow
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRoleIncludes(t *testing.T) {
+	tests := []struct {
+		role, want string
+		ok         bool
+	}{
+		{role: RoleAdmin, want: RoleViewer, ok: true},
+		{role: RoleAdmin, want: RoleAdmin, ok: true},
+		{role: RoleTriggerer, want: RoleViewer, ok: true},
+		{role: RoleTriggerer, want: RoleAdmin},
+		{role: RoleViewer, want: RoleTriggerer},
+		{role: "owner", want: RoleViewer},
+		{role: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := RoleIncludes(tt.role, tt.want); got != tt.ok {
+			t.Errorf("RoleIncludes(%q, %q) = %v, want %v", tt.role, tt.want, got, tt.ok)
+		}
+	}
+}
+
+func TestRoleBindingGrants(t *testing.T) {
+	scoped := RoleBinding{Role: RoleTriggerer, Subjects: []string{"key:ci", "jwt:*@example.com"}, Repos: []string{"Cdaprod/*"}}
+	global := RoleBinding{Role: RoleViewer, Subjects: []string{"jwt:*"}}
+	tests := []struct {
+		name    string
+		b       RoleBinding
+		subject string
+		role    string
+		repo    string
+		want    bool
+	}{
+		{name: "subject and repo", b: scoped, subject: "key:ci", role: RoleTriggerer, repo: "Cdaprod/site", want: true},
+		{name: "lesser role", b: scoped, subject: "key:ci", role: RoleViewer, repo: "Cdaprod/site", want: true},
+		{name: "greater role", b: scoped, subject: "key:ci", role: RoleAdmin, repo: "Cdaprod/site"},
+		{name: "repo case folded", b: scoped, subject: "key:ci", role: RoleTriggerer, repo: "cdaprod/SITE", want: true},
+		{name: "other repo", b: scoped, subject: "key:ci", role: RoleTriggerer, repo: "partner/docs"},
+		{name: "server-wide from scoped", b: scoped, subject: "key:ci", role: RoleTriggerer},
+		{name: "subject glob", b: scoped, subject: "jwt:alice@example.com", role: RoleTriggerer, repo: "Cdaprod/site", want: true},
+		{name: "subject glob other domain", b: scoped, subject: "jwt:alice@example.org", role: RoleTriggerer, repo: "Cdaprod/site"},
+		{name: "subject case sensitive", b: scoped, subject: "KEY:ci", role: RoleTriggerer, repo: "Cdaprod/site"},
+		{name: "global anywhere", b: global, subject: "jwt:bob", role: RoleViewer, repo: "partner/docs", want: true},
+		{name: "global server-wide", b: global, subject: "jwt:bob", role: RoleViewer, want: true},
+		{name: "glob does not cross slash", b: scoped, subject: "key:ci", role: RoleTriggerer, repo: "Cdaprod/site/extra"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.b.Grants(tt.subject, tt.role, tt.repo); got != tt.want {
+				t.Errorf("Grants() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if !scoped.GrantsAny("key:ci", RoleViewer) || scoped.GrantsAny("key:ci", RoleAdmin) || scoped.GrantsAny("key:other", RoleViewer) {
+		t.Error("GrantsAny() is wrong")
+	}
+}
+
+func TestRoleBindingAppliesTo(t *testing.T) {
+	b := RoleBinding{Role: RoleAdmin, Subjects: []string{"key:ops"}, Tenants: []string{"team-*"}}
+	if !b.AppliesTo("team-a") || b.AppliesTo("other") || (RoleBinding{Role: RoleAdmin}).AppliesTo("team-a") {
+		t.Error("AppliesTo() is wrong")
+	}
+}
+
+func TestSetRoleBindings(t *testing.T) {
+	tests := []struct {
+		name    string
+		b       RoleBinding
+		wantErr string
+	}{
+		{name: "valid", b: RoleBinding{Role: RoleViewer, Subjects: []string{"jwt:*"}, Repos: []string{"Cdaprod/*"}, Tenants: []string{"team-*"}}},
+		{name: "unknown role", b: RoleBinding{Role: "owner", Subjects: []string{"key:ops"}}, wantErr: `unknown role "owner"`},
+		{name: "no subjects", b: RoleBinding{Role: RoleAdmin}, wantErr: "no subjects"},
+		{name: "empty subject", b: RoleBinding{Role: RoleAdmin, Subjects: []string{""}}, wantErr: "invalid pattern"},
+		{name: "bad repo pattern", b: RoleBinding{Role: RoleAdmin, Subjects: []string{"key:ops"}, Repos: []string{"[x"}}, wantErr: "invalid pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRepositoryRegistry()
+			err := r.SetRoleBindings([]RoleBinding{{Role: RoleAdmin, Subjects: []string{"key:ops"}}, tt.b})
+			if tt.wantErr == "" {
+				if err != nil || len(r.RoleBindings()) != 2 {
+					t.Errorf("SetRoleBindings() = %v, bindings %+v", err, r.RoleBindings())
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), "role binding 2: ") || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("SetRoleBindings() = %v, want %q", err, tt.wantErr)
+			}
+			if len(r.RoleBindings()) != 0 {
+				t.Errorf("bindings = %+v, want none after a refused update", r.RoleBindings())
+			}
+		})
+	}
+}
+
+func TestGrantAndRevoke(t *testing.T) {
+	r := NewRepositoryRegistry()
+	site := RoleBinding{Role: RoleTriggerer, Repos: []string{"Cdaprod/site"}}
+	for _, step := range []struct {
+		subject string
+		b       RoleBinding
+	}{
+		{"key:ci", site},
+		{"key:deploy", site},
+		{"key:ci", site},
+		{"key:ci", RoleBinding{Role: RoleViewer}},
+		{"key:ops", RoleBinding{Role: RoleAdmin}},
+	} {
+		if err := r.Grant(step.subject, step.b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Grant("key:x", RoleBinding{Role: "owner"}); err == nil {
+		t.Error("Grant() of an unknown role succeeded")
+	}
+	got := r.RoleBindings()
+	if len(got) != 3 || strings.Join(got[0].Subjects, ",") != "key:ci,key:deploy" {
+		t.Fatalf("bindings = %+v, want the site subjects merged", got)
+	}
+
+	tests := []struct {
+		subject, role string
+		wantErr       bool
+		want          int
+	}{
+		{subject: "key:ci", role: RoleViewer, want: 2},
+		{subject: "key:ci", role: RoleViewer, wantErr: true, want: 2},
+		{subject: "key:ci", want: 2},
+		{subject: "key:deploy", want: 1},
+		{subject: "key:nobody", wantErr: true, want: 1},
+	}
+	for _, tt := range tests {
+		err := r.Revoke(tt.subject, tt.role)
+		if (err != nil) != tt.wantErr || len(r.RoleBindings()) != tt.want {
+			t.Errorf("Revoke(%s, %q) = %v leaving %+v; want error %v and %d bindings", tt.subject, tt.role, err, r.RoleBindings(), tt.wantErr, tt.want)
+		}
+	}
+	// RoleBindings returns a copy.
+	r.RoleBindings()[0].Role = RoleViewer
+	if r.RoleBindings()[0].Role != RoleAdmin {
+		t.Error("RoleBindings() shares the registry's slice")
+	}
+}
@@ -0,0 +1,249 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces secrets in errors, records, events, and debug dumps.
+const Redacted = "[REDACTED]"
+
+// minSecret is the length below which Redactor.Add ignores a value, since
+// redacting it would mangle ordinary text.
+const minSecret = 4
+
+// githubTokenPattern matches GitHub's token formats, so that a token is
+// redacted even if it was never configured, e.g. one echoed in an input.
+var githubTokenPattern = regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{20,}|github_pat_[A-Za-z0-9_]{20,})\b`)
+
+// maxSecrets bounds the values a Redactor holds for credentials that are
+// renewed or read again as they are used. Past it, those used least
+// recently are forgotten: credentials still in use are seen again as they
+// are used, so it is renewed and retired ones that go. Values passed to Add
+// are not counted and are kept until removed.
+const maxSecrets = 1024
+
+// Redactor removes secret values from text.
+type Redactor struct {
+	mu sync.RWMutex
+	// added holds the values of Add, which are never forgotten.
+	added map[string]bool
+	// renewed maps the values of Replace, and the tokens seen as they are
+	// used, to the count of uses when each was last seen.
+	renewed map[string]uint64
+	uses    uint64
+	// sorted is the secrets, longest first, rebuilt when they change so
+	// that Redact, which runs several times per dispatch, need not sort.
+	sorted []string
+}
+
+// Secrets are redacted from the errors Submit returns, from dispatch
+// records, events, and audit entries, and from debug dumps. GitHub tokens
+// are added whenever a GitHubClient uses them and values read through a
+// token source from ParseTokenSource as they are read; providers that renew
+// a credential replace the old value with the new. Add any other secret
+// with Secrets.Add. The values of a RunCorrelator's SecretInputs are not
+// added: they are redacted only from what is written about the dispatch
+// that sent them.
+var Secrets = &Redactor{}
+
+// Add registers values to redact until they are removed. Values shorter
+// than 4 bytes are ignored.
+func (r *Redactor) Add(values ...string) {
+	r.update(nil, values, true)
+}
+
+// Remove stops redacting values, such as a credential that was revoked.
+func (r *Redactor) Remove(values ...string) {
+	r.update(values, nil, false)
+}
+
+// Replace stops redacting old and registers current in its place, for a
+// credential that was renewed. Unlike the values of Add, those of Replace
+// are forgotten once 1024 others have been used since.
+func (r *Redactor) Replace(old, current string) {
+	if old == current {
+		r.seen(current)
+		return
+	}
+	r.update([]string{old}, []string{current}, false)
+}
+
+// seen registers v as a token in use, like Replace. A value of Add stays
+// one.
+func (r *Redactor) seen(v string) {
+	r.update(nil, []string{v}, false)
+}
+
+// update removes and adds values; added values are kept for good if keep
+// is set, and otherwise forgotten once maxSecrets others have been seen.
+func (r *Redactor) update(remove, add []string, keep bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	changed := false
+	for _, v := range remove {
+		if r.added[v] {
+			delete(r.added, v)
+			changed = true
+		}
+		if _, ok := r.renewed[v]; ok {
+			delete(r.renewed, v)
+			changed = true
+		}
+	}
+	for _, v := range add {
+		if len(v) < minSecret {
+			continue
+		}
+		_, renewed := r.renewed[v]
+		switch {
+		case keep:
+			if r.added == nil {
+				r.added = map[string]bool{}
+			}
+			changed = changed || !r.added[v] && !renewed
+			r.added[v] = true
+			delete(r.renewed, v)
+		case !r.added[v]:
+			if r.renewed == nil {
+				r.renewed = map[string]uint64{}
+			}
+			changed = changed || !renewed
+			r.uses++
+			r.renewed[v] = r.uses
+		}
+	}
+	for len(r.renewed) > maxSecrets {
+		oldest := ""
+		for v, n := range r.renewed {
+			if oldest == "" || n < r.renewed[oldest] {
+				oldest = v
+			}
+		}
+		delete(r.renewed, oldest)
+		changed = true
+	}
+	if !changed {
+		return
+	}
+	sorted := make([]string, 0, len(r.added)+len(r.renewed))
+	for v := range r.added {
+		sorted = append(sorted, v)
+	}
+	for v := range r.renewed {
+		sorted = append(sorted, v)
+	}
+	// Longer values first, so a secret containing another is removed whole.
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	r.sorted = sorted
+}
+
+// Redact returns s with every registered value, and anything shaped like a
+// GitHub token, replaced by Redacted.
+func (r *Redactor) Redact(s string) string {
+	r.mu.RLock()
+	secrets := r.sorted
+	r.mu.RUnlock()
+	for _, v := range secrets {
+		s = strings.ReplaceAll(s, v, Redacted)
+	}
+	// Every token format starts with gh or github_pat_, so text without
+	// either is spared the regexp.
+	if !strings.Contains(s, "gh") && !strings.Contains(s, "github_pat_") {
+		return s
+	}
+	return githubTokenPattern.ReplaceAllString(s, Redacted)
+}
+
+// redactedToken adds the tokens its provider returns to Secrets.
+type redactedToken struct {
+	TokenProvider
+}
+
+func (t redactedToken) Token(ctx context.Context) (string, error) {
+	token, err := t.TokenProvider.Token(ctx)
+	if err == nil {
+		Secrets.seen(token)
+	}
+	return token, err
+}
+
+// RedactError returns err with Secrets redacted from its message. The
+// result unwraps to err, so errors.Is and errors.As still see through it.
+func RedactError(err error) error {
+	return redactError(context.Background(), err)
+}
+
+// redactError is RedactError, also redacting the values ctx carries.
+func redactError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := redact(ctx, err.Error())
+	if msg == err.Error() {
+		return err
+	}
+	return &redactedError{msg: msg, err: err}
+}
+
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// RedactInputs returns inputs with the values of c.SecretInputs replaced by
+// Redacted and Secrets redacted from the rest. inputs itself is not
+// modified.
+func (c *RunCorrelator) RedactInputs(inputs map[string]string) map[string]string {
+	if len(inputs) == 0 {
+		return inputs
+	}
+	out := make(map[string]string, len(inputs))
+	for k, v := range inputs {
+		out[k] = Secrets.Redact(v)
+	}
+	for _, name := range c.SecretInputs {
+		if _, ok := out[name]; ok {
+			out[name] = Redacted
+		}
+	}
+	return out
+}
+
+type secretsKey struct{}
+
+// redact returns s with Secrets and the values ctx carries redacted.
+func redact(ctx context.Context, s string) string {
+	s = Secrets.Redact(s)
+	if r, ok := ctx.Value(secretsKey{}).(*Redactor); ok {
+		s = r.Redact(s)
+	}
+	return s
+}
+
+// withSecretInputs returns ctx carrying the values of req's secret inputs,
+// which are redacted from the errors, records, and debug dumps of req but
+// not added to Secrets, where every submitted value would stay. An input
+// already redacted, as in a record from the history, cannot be sent again.
+func (c *RunCorrelator) withSecretInputs(ctx context.Context, req DispatchRequest) (context.Context, error) {
+	for k, v := range req.Inputs {
+		if v == Redacted {
+			return ctx, fmt.Errorf("input %s was redacted when recorded; dispatch again with its value", k)
+		}
+	}
+	r := &Redactor{}
+	for _, name := range c.SecretInputs {
+		r.Add(req.Inputs[name])
+	}
+	if len(r.added) == 0 {
+		return ctx, nil
+	}
+	return context.WithValue(ctx, secretsKey{}, r), nil
+}
@@ -0,0 +1,150 @@
+package flow
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedactor(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(r *Redactor)
+		in   string
+		want string
+	}{
+		{name: "added", edit: func(r *Redactor) { r.Add("hunter22") }, in: "password hunter22", want: "password [REDACTED]"},
+		{name: "short values ignored", edit: func(r *Redactor) { r.Add("abc") }, in: "abc", want: "abc"},
+		{name: "longest first", edit: func(r *Redactor) { r.Add("secret", "secret-token") }, in: "secret-token secret", want: "[REDACTED] [REDACTED]"},
+		{name: "removed", edit: func(r *Redactor) { r.Add("hunter22"); r.Remove("hunter22") }, in: "hunter22", want: "hunter22"},
+		{name: "replaced", edit: func(r *Redactor) { r.Add("token-one"); r.Replace("token-one", "token-two") }, in: "token-one token-two", want: "token-one [REDACTED]"},
+		{name: "replaced by itself", edit: func(r *Redactor) { r.Add("token-one"); r.Replace("token-one", "token-one") }, in: "token-one", want: "[REDACTED]"},
+		{name: "github token", in: "token ghp_" + strings.Repeat("a", 36), want: "token [REDACTED]"},
+		{name: "fine-grained token", in: "github_pat_" + strings.Repeat("B", 40), want: "[REDACTED]"},
+		{name: "too short for a token", in: "ghp_abc", want: "ghp_abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Redactor{}
+			if tt.edit != nil {
+				tt.edit(r)
+			}
+			if got := r.Redact(tt.in); got != tt.want {
+				t.Errorf("Redact(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactorCap(t *testing.T) {
+	r := &Redactor{}
+	r.Add("added-secret")
+	r.Replace("", "current-credential")
+	for i := 0; i < maxSecrets; i++ {
+		r.Replace("", fmt.Sprintf("renewed-%04d", i))
+		if i%100 == 0 {
+			// Still in use, so seen again.
+			r.seen("current-credential")
+			r.seen("added-secret")
+		}
+	}
+	if n := len(r.renewed); n != maxSecrets {
+		t.Fatalf("holds %d renewed values, want %d", n, maxSecrets)
+	}
+	if got := r.Redact("renewed-0000"); got != "renewed-0000" {
+		t.Errorf("least recently used value is still redacted: %q", got)
+	}
+	for _, v := range []string{"added-secret", "current-credential", fmt.Sprintf("renewed-%04d", maxSecrets-1)} {
+		if got := r.Redact(v); got != Redacted {
+			t.Errorf("Redact(%q) = %q, want it redacted", v, got)
+		}
+	}
+
+	// Values of Add are kept however many others are used since.
+	r = &Redactor{}
+	r.Add("added-secret")
+	for i := 0; i < 2*maxSecrets; i++ {
+		r.Replace(fmt.Sprintf("renewed-%04d", i-1), fmt.Sprintf("renewed-%04d", i))
+		r.seen(fmt.Sprintf("token-%04d", i))
+	}
+	if got := r.Redact("added-secret"); got != Redacted {
+		t.Errorf("value of Add was forgotten: %q", got)
+	}
+	r.Remove("added-secret")
+	if got := r.Redact("added-secret"); got != "added-secret" {
+		t.Errorf("removed value is still redacted: %q", got)
+	}
+}
+
+func TestRedactError(t *testing.T) {
+	Secrets.Add("redact-error-secret")
+	defer Secrets.Remove("redact-error-secret")
+	base := &APIError{Method: "POST", Path: "/x", StatusCode: 422, Body: "bad"}
+	err := RedactError(fmt.Errorf("sending redact-error-secret: %w", base))
+	if strings.Contains(err.Error(), "redact-error-secret") {
+		t.Errorf("RedactError() = %q, still holds the secret", err)
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr != base {
+		t.Errorf("RedactError() does not unwrap to the original error")
+	}
+	if plain := errors.New("plain"); RedactError(plain) != plain {
+		t.Errorf("RedactError() wrapped an error with nothing to redact")
+	}
+}
+
+func TestSubmitRedactsSecretInputs(t *testing.T) {
+	const password = "correct-horse-battery"
+	// GitHub's error echoes the request body, inputs included.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprintf(w, `{"message": "unexpected inputs in %s"}`, strings.ReplaceAll(string(body), `"`, `'`))
+	}))
+	defer srv.Close()
+	client := NewGitHubClient("")
+	client.BaseURL = srv.URL
+	var dump bytes.Buffer
+	client.DebugDump = &dump
+	c := NewRunCorrelator(client, NewFileHistoryStore(filepath.Join(t.TempDir(), "history.json")))
+	c.SecretInputs = []string{"password"}
+
+	_, err := c.Submit(context.Background(), DispatchRequest{
+		Repo: "o/r", Workflow: "deploy.yml", Ref: "main",
+		Inputs: map[string]string{"password": password, "env": "prod"},
+	})
+	if err == nil {
+		t.Fatal("Submit() succeeded against a failing server")
+	}
+	if strings.Contains(err.Error(), password) || !strings.Contains(err.Error(), Redacted) {
+		t.Errorf("Submit() error %q, want the secret input redacted", err)
+	}
+	if dump.Len() == 0 || strings.Contains(dump.String(), password) {
+		t.Errorf("debug dump holds the secret input:\n%s", dump.String())
+	}
+	recs, herr := c.History.List("o/r")
+	if herr != nil || len(recs) != 1 {
+		t.Fatalf("History.List() = %v, %v; want one record", recs, herr)
+	}
+	if rec := recs[0]; rec.Inputs["password"] != Redacted || strings.Contains(rec.Error, password) {
+		t.Errorf("record keeps the secret input: %+v", rec)
+	}
+	if got := Secrets.Redact(password); got != password {
+		t.Errorf("submitted input was added to Secrets")
+	}
+
+	_, err = c.Submit(context.Background(), DispatchRequest{
+		Repo: "o/r", Workflow: "deploy.yml", Ref: "main",
+		Inputs: map[string]string{"password": Redacted},
+	})
+	if err == nil || !strings.Contains(err.Error(), "was redacted when recorded") {
+		t.Errorf("Submit() of a redacted input error = %v", err)
+	}
+}
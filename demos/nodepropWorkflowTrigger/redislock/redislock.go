@@ -0,0 +1,105 @@
+// Package redislock implements flow.Locker on Redis so that several
+// dispatcher replicas can share locks and elect a leader.
+package redislock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// DefaultPrefix namespaces lock keys.
+const DefaultPrefix = "nodeprop:lock:"
+
+// Locker takes locks with SET NX PX and only refreshes or releases a key
+// that still holds its own token, so a lock that expired and was taken by
+// another replica is never touched.
+type Locker struct {
+	Client redis.UniversalClient
+	Prefix string
+}
+
+// New creates a Locker on client with DefaultPrefix.
+func New(client redis.UniversalClient) *Locker {
+	return &Locker{Client: client, Prefix: DefaultPrefix}
+}
+
+// Open connects to the Redis server at a redis:// or rediss:// URL.
+func Open(ctx context.Context, url string) (*Locker, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	return New(client), nil
+}
+
+// Close closes the Redis client.
+func (l *Locker) Close() error {
+	return l.Client.Close()
+}
+
+// Acquire takes name for ttl.
+func (l *Locker) Acquire(ctx context.Context, name string, ttl time.Duration) (flow.Lock, error) {
+	token, err := flow.LockToken()
+	if err != nil {
+		return nil, err
+	}
+	key := l.Prefix + name
+	ok, err := l.Client.SetNX(ctx, key, token, ttl).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis: lock %s: %w", name, err)
+	}
+	if !ok {
+		return nil, flow.ErrLockHeld
+	}
+	return &lock{client: l.Client, key: key, token: token, ttl: ttl}, nil
+}
+
+var (
+	refreshScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+	releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+type lock struct {
+	client redis.UniversalClient
+	key    string
+	token  string
+	ttl    time.Duration
+}
+
+func (l *lock) Refresh(ctx context.Context) error {
+	n, err := refreshScript.Run(ctx, l.client, []string{l.key}, l.token, l.ttl.Milliseconds()).Int()
+	if err != nil {
+		return fmt.Errorf("redis: refresh %s: %w", l.key, err)
+	}
+	if n == 0 {
+		return flow.ErrLockLost
+	}
+	return nil
+}
+
+func (l *lock) Release(ctx context.Context) error {
+	err := releaseScript.Run(ctx, l.client, []string{l.key}, l.token).Err()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return fmt.Errorf("redis: release %s: %w", l.key, err)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package redislock_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/integrationtest"
+)
+
+func TestLocker(t *testing.T) {
+	l := integrationtest.RedisLocker(t)
+	ctx := context.Background()
+
+	a, err := l.Acquire(ctx, "deploy", 200*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Acquire(ctx, "deploy", time.Minute); !errors.Is(err, flow.ErrLockHeld) {
+		t.Errorf("second Acquire() error = %v, want ErrLockHeld", err)
+	}
+	if err := a.Refresh(ctx); err != nil {
+		t.Errorf("Refresh() error = %v", err)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	b, err := l.Acquire(ctx, "deploy", time.Minute)
+	if err != nil {
+		t.Fatalf("Acquire() of an expired lock error = %v", err)
+	}
+	if err := a.Refresh(ctx); !errors.Is(err, flow.ErrLockLost) {
+		t.Errorf("Refresh() of a lost lock error = %v, want ErrLockLost", err)
+	}
+	// Releasing a lost lock leaves the new holder's alone.
+	if err := a.Release(ctx); err != nil {
+		t.Errorf("Release() of a lost lock error = %v", err)
+	}
+	if _, err := l.Acquire(ctx, "deploy", time.Minute); !errors.Is(err, flow.ErrLockHeld) {
+		t.Errorf("Acquire() after a stale Release() error = %v, want ErrLockHeld", err)
+	}
+	if err := b.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Acquire(ctx, "deploy", time.Minute); err != nil {
+		t.Errorf("Acquire() after Release() error = %v", err)
+	}
+}
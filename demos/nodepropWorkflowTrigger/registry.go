@@ -0,0 +1,289 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RepoEntry describes a registered repository and the triggers it uses.
+// Workflow names double as workflow file names when dispatched directly.
+type RepoEntry struct {
+	Name      string   `yaml:"name" json:"name"`
+	Actions   []string `yaml:"actions,omitempty" json:"actions,omitempty"`
+	Workflows []string `yaml:"workflows,omitempty" json:"workflows,omitempty"`
+	Tags      []string `yaml:"tags,omitempty" json:"tags,omitempty"`
+	// RequiresApproval holds dispatches to the repository until they are
+	// approved; Approvers, if set, are the only identities that may do so.
+	RequiresApproval bool     `yaml:"requires_approval,omitempty" json:"requires_approval,omitempty"`
+	Approvers        []string `yaml:"approvers,omitempty" json:"approvers,omitempty"`
+	// DependsOn lists the repositories this one depends on, as owner/name
+	// globs, so fan-out rules can dispatch to it when they release.
+	DependsOn []string `yaml:"depends_on,omitempty" json:"depends_on,omitempty"`
+}
+
+// HasTag reports whether the entry carries tag.
+func (e RepoEntry) HasTag(tag string) bool {
+	for _, t := range e.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// RepositoryRegistry tracks which actions and workflows belong to each repository.
+type RepositoryRegistry struct {
+	mu        sync.RWMutex
+	repos     map[string]RepoEntry
+	schedules map[string]ScheduleEntry
+	roles     []RoleBinding
+	triggers  []TriggerConfig
+}
+
+// NewRepositoryRegistry creates an empty registry.
+func NewRepositoryRegistry() *RepositoryRegistry {
+	return &RepositoryRegistry{repos: make(map[string]RepoEntry), schedules: make(map[string]ScheduleEntry)}
+}
+
+// RegisterRepo adds or replaces the entry for repo.
+func (r *RepositoryRegistry) RegisterRepo(repo string, actions []string, workflows []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e := r.repos[repo]
+	e.Name, e.Actions, e.Workflows = repo, actions, workflows
+	r.repos[repo] = e
+}
+
+// SetRepo adds or replaces e, every field of it.
+func (r *RepositoryRegistry) SetRepo(e RepoEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.repos[e.Name] = e
+}
+
+// RemoveRepo deletes the entry for repo, if there is one.
+func (r *RepositoryRegistry) RemoveRepo(repo string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.repos, repo)
+}
+
+// SetTags replaces the tags of a registered repository.
+func (r *RepositoryRegistry) SetTags(repo string, tags []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.repos[repo]
+	if !ok {
+		return fmt.Errorf("repository %s not registered", repo)
+	}
+	e.Tags = tags
+	r.repos[repo] = e
+	return nil
+}
+
+// SetDependencies replaces the repositories a registered repository depends
+// on.
+func (r *RepositoryRegistry) SetDependencies(repo string, deps []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.repos[repo]
+	if !ok {
+		return fmt.Errorf("repository %s not registered", repo)
+	}
+	e.DependsOn = deps
+	r.repos[repo] = e
+	return nil
+}
+
+// Dependents returns the registered repositories other than repo that
+// depend on it.
+func (r *RepositoryRegistry) Dependents(repo string) []RepoEntry {
+	var out []RepoEntry
+	for _, e := range r.Repos() {
+		if e.Name != repo && e.DependsOnRepo(repo) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// DependsOnRepo reports whether one of the entry's dependencies matches
+// repo.
+func (e RepoEntry) DependsOnRepo(repo string) bool {
+	for _, pattern := range e.DependsOn {
+		if ok, _ := path.Match(pattern, repo); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// SetApproval sets whether dispatches to a registered repository need
+// approval, and by whom.
+func (r *RepositoryRegistry) SetApproval(repo string, required bool, approvers []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.repos[repo]
+	if !ok {
+		return fmt.Errorf("repository %s not registered", repo)
+	}
+	e.RequiresApproval, e.Approvers = required, approvers
+	r.repos[repo] = e
+	return nil
+}
+
+// ApprovalRule implements ApprovalPolicy.
+func (r *RepositoryRegistry) ApprovalRule(repo string) (bool, []string) {
+	e, ok := r.Get(repo)
+	return ok && e.RequiresApproval, e.Approvers
+}
+
+// Get returns the entry for repo.
+func (r *RepositoryRegistry) Get(repo string) (RepoEntry, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, ok := r.repos[repo]
+	return e, ok
+}
+
+// Repos returns all entries sorted by name.
+func (r *RepositoryRegistry) Repos() []RepoEntry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]RepoEntry, 0, len(r.repos))
+	for _, e := range r.repos {
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// TriggerForRepo executes every action and workflow registered for repo
+// with tm, a TriggerManager or ShardedTriggerManager.
+func (r *RepositoryRegistry) TriggerForRepo(repo string, tm TriggerExecutor, token string) error {
+	return r.TriggerForRepoContext(context.Background(), repo, tm, token)
+}
+
+// TriggerForRepoContext is TriggerForRepo, passing ctx to every execution
+// and starting no more once it is done.
+func (r *RepositoryRegistry) TriggerForRepoContext(ctx context.Context, repo string, tm TriggerExecutor, token string) error {
+	e, ok := r.Get(repo)
+	if !ok {
+		return fmt.Errorf("repository %s not registered", repo)
+	}
+	var errs []error
+	for _, name := range e.Workflows {
+		if err := ctx.Err(); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		if err := tm.ExecuteWorkflowContext(ctx, name, repo, token, nil); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, name := range e.Actions {
+		if err := ctx.Err(); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		if err := tm.ExecuteActionContext(ctx, name, repo, token, nil); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// registryFile is the on-disk registry format.
+type registryFile struct {
+	Repos     []RepoEntry     `yaml:"repos"`
+	Schedules []ScheduleEntry `yaml:"schedules,omitempty"`
+	Roles     []RoleBinding   `yaml:"roles,omitempty"`
+	Triggers  []TriggerConfig `yaml:"triggers,omitempty"`
+}
+
+// DefaultRegistryPath returns the per-user location of the registry file.
+func DefaultRegistryPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = "."
+	}
+	return filepath.Join(dir, "nodeprop", "registry.yml")
+}
+
+// LoadRegistry reads a registry file. A missing file yields an empty registry.
+func LoadRegistry(path string) (*RepositoryRegistry, error) {
+	r := NewRepositoryRegistry()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registry: %w", err)
+	}
+	var f registryFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse registry %s: %w", path, err)
+	}
+	for _, e := range f.Repos {
+		r.repos[e.Name] = e
+	}
+	for _, e := range f.Schedules {
+		if err := e.validate(); err != nil {
+			return nil, fmt.Errorf("registry %s: %w", path, err)
+		}
+		r.schedules[e.Name] = e
+	}
+	if err := r.SetRoleBindings(f.Roles); err != nil {
+		return nil, fmt.Errorf("registry %s: %w", path, err)
+	}
+	if err := r.SetTriggers(f.Triggers); err != nil {
+		return nil, fmt.Errorf("registry %s: %w", path, err)
+	}
+	return r, nil
+}
+
+// Save writes the registry to path.
+func (r *RepositoryRegistry) Save(path string) error {
+	data, err := yaml.Marshal(registryFile{Repos: r.Repos(), Schedules: r.Schedules(), Roles: r.RoleBindings(), Triggers: r.Triggers()})
+	if err != nil {
+		return fmt.Errorf("failed to marshal registry: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create registry dir: %w", err)
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// SetTriggers replaces the trigger configs kept with the registry, such as
+// those TriggerManager.Configs returns, so a program can rebuild its
+// triggers at startup with TriggerManager.Configure.
+func (r *RepositoryRegistry) SetTriggers(cfgs []TriggerConfig) error {
+	seen := make(map[string]bool, len(cfgs))
+	for _, c := range cfgs {
+		if err := c.validate(); err != nil {
+			return err
+		}
+		key := c.Type + "/" + c.Name
+		if seen[key] {
+			return fmt.Errorf("%s %s: configured twice", c.Type, c.Name)
+		}
+		seen[key] = true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.triggers = append([]TriggerConfig(nil), cfgs...)
+	return nil
+}
+
+// Triggers returns the trigger configs kept with the registry.
+func (r *RepositoryRegistry) Triggers() []TriggerConfig {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]TriggerConfig(nil), r.triggers...)
+}
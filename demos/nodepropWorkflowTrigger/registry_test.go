@@ -0,0 +1,133 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// recordingExecutor records the triggers TriggerForRepoContext runs.
+type recordingExecutor struct {
+	ran  []string
+	fail map[string]error
+}
+
+func (e *recordingExecutor) ExecuteWorkflowContext(ctx context.Context, name, repo, token string, params map[string]string) error {
+	e.ran = append(e.ran, "workflow:"+name)
+	return e.fail[name]
+}
+
+func (e *recordingExecutor) ExecuteActionContext(ctx context.Context, name, repo, token string, params map[string]string) error {
+	e.ran = append(e.ran, "action:"+name)
+	return e.fail[name]
+}
+
+func TestRegistryTriggerForRepo(t *testing.T) {
+	errBoom := errors.New("boom")
+	r := NewRepositoryRegistry()
+	r.RegisterRepo("o/r", []string{"notify"}, []string{"build", "deploy"})
+
+	e := &recordingExecutor{fail: map[string]error{"build": errBoom}}
+	err := r.TriggerForRepo("o/r", e, "token")
+	if !errors.Is(err, errBoom) {
+		t.Errorf("TriggerForRepo() error = %v, want %v", err, errBoom)
+	}
+	if want := []string{"workflow:build", "workflow:deploy", "action:notify"}; !slices.Equal(e.ran, want) {
+		t.Errorf("ran %v, want every trigger despite the failure: %v", e.ran, want)
+	}
+
+	if err := r.TriggerForRepo("o/missing", e, "token"); err == nil {
+		t.Error("TriggerForRepo() of an unregistered repository succeeded")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	e = &recordingExecutor{}
+	if err := r.TriggerForRepoContext(ctx, "o/r", e, "token"); !errors.Is(err, context.Canceled) || len(e.ran) != 0 {
+		t.Errorf("TriggerForRepoContext() with a cancelled context = %v after running %v", err, e.ran)
+	}
+}
+
+func TestRegistryEntries(t *testing.T) {
+	r := NewRepositoryRegistry()
+	r.RegisterRepo("o/web", nil, []string{"ci.yml"})
+	r.RegisterRepo("o/api", nil, []string{"ci.yml"})
+	r.SetRepo(RepoEntry{Name: "o/lib"})
+	for _, err := range []error{
+		r.SetTags("o/api", []string{"backend"}),
+		r.SetDependencies("o/api", []string{"o/lib"}),
+		r.SetDependencies("o/web", []string{"o/*"}),
+		r.SetApproval("o/web", true, []string{"alice"}),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, err := range []error{
+		r.SetTags("o/missing", nil),
+		r.SetDependencies("o/missing", nil),
+		r.SetApproval("o/missing", true, nil),
+	} {
+		if err == nil {
+			t.Error("editing an unregistered repository succeeded")
+		}
+	}
+
+	var names []string
+	for _, e := range r.Repos() {
+		names = append(names, e.Name)
+	}
+	if want := []string{"o/api", "o/lib", "o/web"}; !slices.Equal(names, want) {
+		t.Errorf("Repos() = %v, want %v", names, want)
+	}
+	// Re-registering keeps everything but the triggers.
+	r.RegisterRepo("o/api", []string{"notify"}, nil)
+	if e, _ := r.Get("o/api"); !e.HasTag("backend") || len(e.Workflows) != 0 || e.Actions[0] != "notify" {
+		t.Errorf("re-registered entry = %+v", e)
+	}
+
+	var dependents []string
+	for _, e := range r.Dependents("o/lib") {
+		dependents = append(dependents, e.Name)
+	}
+	if want := []string{"o/api", "o/web"}; !slices.Equal(dependents, want) {
+		t.Errorf("Dependents(o/lib) = %v, want %v", dependents, want)
+	}
+	if got := r.Dependents("o/web"); len(got) != 0 {
+		t.Errorf("Dependents(o/web) = %+v, want none; a repository is not its own dependent", got)
+	}
+
+	if required, approvers := r.ApprovalRule("o/web"); !required || !slices.Equal(approvers, []string{"alice"}) {
+		t.Errorf("ApprovalRule(o/web) = %v, %v", required, approvers)
+	}
+	if required, _ := r.ApprovalRule("o/missing"); required {
+		t.Error("ApprovalRule() requires approval for an unregistered repository")
+	}
+
+	r.RemoveRepo("o/lib")
+	if _, ok := r.Get("o/lib"); ok {
+		t.Error("RemoveRepo() left the entry")
+	}
+}
+
+func TestRegistrySaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nodeprop", "registry.yml")
+	if r, err := LoadRegistry(path); err != nil || len(r.Repos()) != 0 {
+		t.Fatalf("LoadRegistry() of a missing file = %v, %v", r, err)
+	}
+	r := NewRepositoryRegistry()
+	r.SetRepo(RepoEntry{Name: "o/api", Workflows: []string{"ci.yml"}, Tags: []string{"backend"}, DependsOn: []string{"o/lib"}, RequiresApproval: true})
+	if err := r.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, ok := loaded.Get("o/api")
+	if !ok || !e.HasTag("backend") || !e.DependsOnRepo("o/lib") || !e.RequiresApproval || e.Workflows[0] != "ci.yml" {
+		t.Errorf("loaded entry = %+v, %v; want what was saved", e, ok)
+	}
+}
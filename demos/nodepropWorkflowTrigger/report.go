@@ -0,0 +1,81 @@
+package flow
+
+import (
+	"sort"
+	"time"
+)
+
+// RepoReport summarises the dispatches to one repository.
+type RepoReport struct {
+	Repo           string        `json:"repo,omitempty" yaml:"repo,omitempty"`
+	Dispatches     int           `json:"dispatches" yaml:"dispatches"`
+	Succeeded      int           `json:"succeeded" yaml:"succeeded"`
+	Failed         int           `json:"failed" yaml:"failed"`
+	Pending        int           `json:"pending" yaml:"pending"`
+	MedianDuration time.Duration `json:"-" yaml:"-"`
+	MedianSeconds  float64       `json:"median_duration_seconds" yaml:"median_duration_seconds"`
+}
+
+// HistoryReport summarises dispatch history over a time window.
+type HistoryReport struct {
+	Since time.Time    `json:"since" yaml:"since"`
+	Until time.Time    `json:"until" yaml:"until"`
+	Total RepoReport   `json:"total" yaml:"total"`
+	Repos []RepoReport `json:"repos" yaml:"repos"`
+}
+
+// BuildReport summarises the records dispatched in [since, until). A run
+// counts as failed if it completed with any conclusion other than success.
+func BuildReport(recs []DispatchRecord, since, until time.Time) *HistoryReport {
+	byRepo := make(map[string][]DispatchRecord)
+	var all []DispatchRecord
+	for _, rec := range recs {
+		if rec.DispatchedAt.Before(since) || !rec.DispatchedAt.Before(until) {
+			continue
+		}
+		byRepo[rec.Repo] = append(byRepo[rec.Repo], rec)
+		all = append(all, rec)
+	}
+
+	r := &HistoryReport{Since: since, Until: until, Repos: []RepoReport{}}
+	for repo, rs := range byRepo {
+		r.Repos = append(r.Repos, summarise(repo, rs))
+	}
+	sort.Slice(r.Repos, func(i, j int) bool { return r.Repos[i].Repo < r.Repos[j].Repo })
+	r.Total = summarise("", all)
+	return r
+}
+
+func summarise(repo string, recs []DispatchRecord) RepoReport {
+	s := RepoReport{Repo: repo, Dispatches: len(recs)}
+	var durations []time.Duration
+	for i := range recs {
+		switch {
+		case !recs[i].Completed():
+			s.Pending++
+			continue
+		case recs[i].Conclusion == "success":
+			s.Succeeded++
+		default:
+			s.Failed++
+		}
+		if recs[i].RunID != 0 {
+			durations = append(durations, recs[i].Duration())
+		}
+	}
+	s.MedianDuration = median(durations)
+	s.MedianSeconds = s.MedianDuration.Seconds()
+	return s
+}
+
+func median(ds []time.Duration) time.Duration {
+	if len(ds) == 0 {
+		return 0
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	mid := len(ds) / 2
+	if len(ds)%2 == 0 {
+		return (ds[mid-1] + ds[mid]) / 2
+	}
+	return ds[mid]
+}
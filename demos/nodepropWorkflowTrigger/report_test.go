@@ -0,0 +1,47 @@
+package flow
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBuildReport(t *testing.T) {
+	since := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	until := since.Add(24 * time.Hour)
+	done := func(repo, conclusion string, at time.Time, took time.Duration) DispatchRecord {
+		return DispatchRecord{Repo: repo, DispatchedAt: at, RunID: 1, Status: "completed", Conclusion: conclusion, UpdatedAt: at.Add(took)}
+	}
+	recs := []DispatchRecord{
+		done("o/api", "success", since, time.Minute),
+		done("o/api", "success", since.Add(time.Hour), 3*time.Minute),
+		done("o/api", "failure", since.Add(2*time.Hour), 2*time.Minute),
+		done("o/web", "cancelled", since.Add(time.Hour), 4*time.Minute),
+		{Repo: "o/web", DispatchedAt: since.Add(time.Hour)},
+		{Repo: "o/web", DispatchedAt: since.Add(time.Hour), Status: "completed", Conclusion: ConclusionDispatchFailed},
+		// Outside the window.
+		done("o/api", "failure", since.Add(-time.Second), time.Hour),
+		done("o/old", "success", until, time.Hour),
+	}
+
+	r := BuildReport(recs, since, until)
+	want := []RepoReport{
+		{Repo: "o/api", Dispatches: 3, Succeeded: 2, Failed: 1, MedianDuration: 2 * time.Minute, MedianSeconds: 120},
+		{Repo: "o/web", Dispatches: 3, Failed: 2, Pending: 1, MedianDuration: 4 * time.Minute, MedianSeconds: 240},
+	}
+	if len(r.Repos) != len(want) {
+		t.Fatalf("BuildReport() repos = %+v, want %+v", r.Repos, want)
+	}
+	for i := range want {
+		if r.Repos[i] != want[i] {
+			t.Errorf("repo %d = %+v, want %+v", i, r.Repos[i], want[i])
+		}
+	}
+	total := RepoReport{Dispatches: 6, Succeeded: 2, Failed: 3, Pending: 1, MedianDuration: 150 * time.Second, MedianSeconds: 150}
+	if r.Total != total {
+		t.Errorf("Total = %+v, want %+v", r.Total, total)
+	}
+
+	if empty := BuildReport(nil, since, until); empty.Repos == nil || empty.Total.Dispatches != 0 {
+		t.Errorf("BuildReport() of no records = %+v, want an empty, non-nil Repos", empty)
+	}
+}
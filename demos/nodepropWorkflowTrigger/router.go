@@ -0,0 +1,408 @@
+package flow
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SourceRepo may be used as a target repo in a RoutingRule to mean the
+// repository the event came from.
+const SourceRepo = "."
+
+// InboundEvent is the routing view of a received webhook event.
+type InboundEvent struct {
+	Type   string // GitHub event name, e.g. push or release
+	Action string // payload action, e.g. published; empty for push
+	Repo   string // full name of the source repository
+	Branch string // branch name for push and workflow_run events
+	// Delivery is the unique delivery ID, used to make redeliveries idempotent.
+	Delivery string
+	// Payload is the decoded JSON body, used by payload matches and
+	// ${payload.*} parameters.
+	Payload map[string]interface{}
+	// ChangedFiles are the paths a push changed, for the Paths of rules;
+	// nil means they are not known.
+	ChangedFiles []string
+}
+
+// RoutingRule dispatches Targets when an event matches. Empty match fields
+// match anything; Repo and Branch are glob patterns, and Payload maps
+// dotted payload paths to glob patterns their values must match. Target
+// repo, workflow, ref, and input values may use ${event.type},
+// ${event.action}, ${event.repo}, ${event.branch}, ${event.delivery}, and
+// ${payload.<path>} to pass event data on.
+//
+//	# routes.yml
+//	- name: deploy-on-release
+//	  events: [release]
+//	  actions: [published]
+//	  repo: Cdaprod/*
+//	  payload:
+//	    release.prerelease: "false"
+//	  targets:
+//	    - repo: .
+//	      workflow: deploy.yml
+//	      inputs:
+//	        version: ${payload.release.tag_name}
+//
+// A rule may also, or instead, FanOut to the repositories that depend on
+// the event's repository.
+//
+// In a monorepo, Paths limits a rule to events changing files it selects,
+// so that each service's workflows run only when its directory changes:
+//
+//	# routes.yml
+//	- name: deploy-api
+//	  events: [push]
+//	  branch: main
+//	  paths: ["services/api/**", "!services/api/docs/**"]
+//	  targets:
+//	    - repo: .
+//	      workflow: deploy-api.yml
+//
+// An event whose changed files are not known, such as a push creating a
+// branch, matches regardless, so that no change goes undeployed.
+type RoutingRule struct {
+	Name    string            `yaml:"name" json:"name"`
+	Events  []string          `yaml:"events,omitempty" json:"events,omitempty"`
+	Actions []string          `yaml:"actions,omitempty" json:"actions,omitempty"`
+	Repo    string            `yaml:"repo,omitempty" json:"repo,omitempty"`
+	Branch  string            `yaml:"branch,omitempty" json:"branch,omitempty"`
+	Payload map[string]string `yaml:"payload,omitempty" json:"payload,omitempty"`
+	// Paths are globs of changed files, see matchesPaths.
+	Paths   []string      `yaml:"paths,omitempty" json:"paths,omitempty"`
+	Targets []BatchTarget `yaml:"targets,omitempty" json:"targets,omitempty"`
+	FanOut  *FanOut       `yaml:"fan_out,omitempty" json:"fan_out,omitempty"`
+}
+
+// Matches reports whether ev satisfies the rule.
+func (r *RoutingRule) Matches(ev InboundEvent) bool {
+	if len(r.Events) > 0 && !contains(r.Events, ev.Type) {
+		return false
+	}
+	if len(r.Actions) > 0 && !contains(r.Actions, ev.Action) {
+		return false
+	}
+	if r.Repo != "" {
+		if ok, _ := path.Match(r.Repo, ev.Repo); !ok {
+			return false
+		}
+	}
+	if r.Branch != "" {
+		if ok, _ := path.Match(r.Branch, ev.Branch); !ok {
+			return false
+		}
+	}
+	for field, pattern := range r.Payload {
+		v, ok := payloadValue(ev.Payload, field)
+		if !ok {
+			return false
+		}
+		if ok, _ := path.Match(pattern, v); !ok {
+			return false
+		}
+	}
+	if len(r.Paths) > 0 && ev.ChangedFiles != nil && !matchesPaths(r.Paths, ev.ChangedFiles) {
+		return false
+	}
+	return true
+}
+
+// payloadValue returns the scalar at the dotted path in payload as a
+// string. Objects, arrays, and null are not scalars.
+func payloadValue(payload map[string]interface{}, field string) (string, bool) {
+	var v interface{} = payload
+	for _, key := range strings.Split(field, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if v, ok = m[key]; !ok {
+			return "", false
+		}
+	}
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	}
+	return "", false
+}
+
+// paramPattern matches ${event.field} and ${payload.path} references.
+var paramPattern = regexp.MustCompile(`\$\{\s*([A-Za-z0-9_.-]+)\s*\}`)
+
+// eventFields are the fields ${event.*} may name.
+var eventFields = map[string]func(InboundEvent) string{
+	"type":     func(ev InboundEvent) string { return ev.Type },
+	"action":   func(ev InboundEvent) string { return ev.Action },
+	"repo":     func(ev InboundEvent) string { return ev.Repo },
+	"branch":   func(ev InboundEvent) string { return ev.Branch },
+	"delivery": func(ev InboundEvent) string { return ev.Delivery },
+}
+
+// checkParams reports a reference in s that can never resolve.
+func checkParams(s string) error {
+	for _, m := range paramPattern.FindAllStringSubmatch(s, -1) {
+		root, field, _ := strings.Cut(m[1], ".")
+		switch {
+		case root == "event" && eventFields[field] != nil:
+		case root == "payload" && field != "":
+		default:
+			return fmt.Errorf("unknown parameter %s", m[0])
+		}
+	}
+	return nil
+}
+
+// expandParams substitutes event references in s. A payload path that is
+// missing or not a scalar is an error, so a dispatch is never sent with a
+// parameter silently left empty.
+func expandParams(s string, ev InboundEvent) (string, error) {
+	var err error
+	out := paramPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		root, field, _ := strings.Cut(paramPattern.FindStringSubmatch(ref)[1], ".")
+		if root == "event" {
+			if get := eventFields[field]; get != nil {
+				return get(ev)
+			}
+		} else if v, ok := payloadValue(ev.Payload, field); ok {
+			return v
+		}
+		if err == nil {
+			err = fmt.Errorf("%s is not set by this %s event", ref, ev.Type)
+		}
+		return ""
+	})
+	return out, err
+}
+
+// expandTarget applies expandParams to every field of t that may carry
+// parameters.
+func expandTarget(t BatchTarget, ev InboundEvent) (BatchTarget, error) {
+	var err error
+	expand := func(s string) string {
+		if err != nil {
+			return s
+		}
+		s, err = expandParams(s, ev)
+		return s
+	}
+	t.Repo, t.Workflow, t.Ref = expand(t.Repo), expand(t.Workflow), expand(t.Ref)
+	if t.Inputs != nil {
+		inputs := make(map[string]string, len(t.Inputs))
+		for k, v := range t.Inputs {
+			inputs[k] = expand(v)
+		}
+		t.Inputs = inputs
+	}
+	return t, err
+}
+
+// EventRouter maps inbound events to dispatches.
+type EventRouter struct {
+	Rules []RoutingRule
+	// Registry resolves target selectors; it may be nil if none are used.
+	Registry *RepositoryRegistry
+}
+
+// UsesPaths reports whether a rule has Paths, and so whether events need
+// their ChangedFiles to be routed.
+func (r *EventRouter) UsesPaths() bool {
+	for _, rule := range r.Rules {
+		if len(rule.Paths) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadRoutingRules reads a YAML list of rules and validates them.
+func LoadRoutingRules(file string) ([]RoutingRule, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var rules []RoutingRule
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse routes %s: %w", file, err)
+	}
+	if err := ValidateRoutingRules(rules); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return rules, nil
+}
+
+// ValidateRoutingRules checks that every rule has a name and something to
+// dispatch, that its patterns compile, and that its targets reference only
+// parameters an event can set.
+func ValidateRoutingRules(rules []RoutingRule) error {
+	for i, r := range rules {
+		if r.Name == "" {
+			return fmt.Errorf("rule %d has no name", i)
+		}
+		if len(r.Targets) == 0 && r.FanOut == nil {
+			return fmt.Errorf("rule %s has no targets or fan_out", r.Name)
+		}
+		patterns := []string{r.Repo, r.Branch}
+		for _, pattern := range r.Payload {
+			patterns = append(patterns, pattern)
+		}
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("rule %s: bad pattern %q", r.Name, pattern)
+			}
+		}
+		if err := validatePaths(r.Paths); err != nil {
+			return fmt.Errorf("rule %s: %w", r.Name, err)
+		}
+		for j, t := range r.Targets {
+			if (t.Repo == "") == (t.Selector == "") {
+				return fmt.Errorf("rule %s target %d: set exactly one of repo or selector", r.Name, j)
+			}
+			if t.Repo != "" && t.Workflow == "" {
+				return fmt.Errorf("rule %s target %d: workflow is required", r.Name, j)
+			}
+			fields := []string{t.Repo, t.Workflow, t.Ref}
+			for _, v := range t.Inputs {
+				fields = append(fields, v)
+			}
+			for _, f := range fields {
+				if err := checkParams(f); err != nil {
+					return fmt.Errorf("rule %s target %d: %w", r.Name, j, err)
+				}
+			}
+		}
+		if f := r.FanOut; f != nil {
+			if f.Concurrency < 0 {
+				return fmt.Errorf("rule %s: fan_out concurrency must not be negative", r.Name)
+			}
+			fields := []string{f.Workflow, f.Ref}
+			for _, v := range f.Inputs {
+				fields = append(fields, v)
+			}
+			for _, v := range fields {
+				if err := checkParams(v); err != nil {
+					return fmt.Errorf("rule %s: fan_out: %w", r.Name, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// RoutedDispatch is a dispatch produced by a rule.
+type RoutedDispatch struct {
+	Rule string
+	// FanOut is set for dispatches of the rule's fan-out to how many of
+	// them may be sent at once, and is 0 for targets.
+	FanOut int
+	PlannedDispatch
+}
+
+// IdempotencyKey derives a key unique to this dispatch within the delivery,
+// so a redelivered event does not dispatch again. It is empty without a
+// delivery ID.
+func (d RoutedDispatch) IdempotencyKey(delivery string) string {
+	if delivery == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(d.Rule + "\x00" + dispatchKey(d.PlannedDispatch)))
+	return "delivery:" + delivery + ":" + hex.EncodeToString(sum[:8])
+}
+
+// Route returns the dispatches every matching rule produces for ev.
+func (r *EventRouter) Route(ev InboundEvent) ([]RoutedDispatch, error) {
+	var out []RoutedDispatch
+	for i := range r.Rules {
+		rule := &r.Rules[i]
+		if !rule.Matches(ev) {
+			continue
+		}
+		targets := make([]BatchTarget, len(rule.Targets))
+		for j, t := range rule.Targets {
+			t, err := expandTarget(t, ev)
+			if err != nil {
+				return out, fmt.Errorf("rule %s: %w", rule.Name, err)
+			}
+			if t.Repo == SourceRepo {
+				t.Repo = ev.Repo
+			}
+			if t.Ref == "" {
+				t.Ref = "main"
+			}
+			targets[j] = t
+		}
+		plan, err := BuildPlan(targets, r.Registry)
+		if err != nil {
+			return out, fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+		for _, d := range plan.Dispatches {
+			out = append(out, RoutedDispatch{Rule: rule.Name, PlannedDispatch: d})
+		}
+		if rule.FanOut != nil {
+			fanned, err := r.fanOut(rule, ev)
+			if err != nil {
+				return out, fmt.Errorf("rule %s: %w", rule.Name, err)
+			}
+			out = append(out, fanned...)
+		}
+	}
+	return out, nil
+}
+
+// fanOut expands rule's fan-out into a dispatch per workflow of each
+// repository depending on ev's. No dependents is not an error.
+func (r *EventRouter) fanOut(rule *RoutingRule, ev InboundEvent) ([]RoutedDispatch, error) {
+	if r.Registry == nil {
+		return nil, errors.New("fan_out requires a registry")
+	}
+	f := rule.FanOut
+	t, err := expandTarget(BatchTarget{Workflow: f.Workflow, Ref: f.Ref, Inputs: f.Inputs}, ev)
+	if err != nil {
+		return nil, err
+	}
+	if t.Ref == "" {
+		t.Ref = "main"
+	}
+	concurrency := f.Concurrency
+	if concurrency == 0 {
+		concurrency = DefaultFanOutConcurrency
+	}
+	var out []RoutedDispatch
+	for _, e := range r.Registry.Dependents(ev.Repo) {
+		workflows := e.Workflows
+		if t.Workflow != "" {
+			workflows = []string{t.Workflow}
+		}
+		if len(workflows) == 0 {
+			return nil, fmt.Errorf("dependent %s has no registered workflows", e.Name)
+		}
+		for _, wf := range workflows {
+			d := PlannedDispatch{Repo: e.Name, Workflow: wf, Ref: t.Ref, Inputs: t.Inputs, Source: "dependents:" + ev.Repo}
+			out = append(out, RoutedDispatch{Rule: rule.Name, FanOut: concurrency, PlannedDispatch: d})
+		}
+	}
+	return out, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
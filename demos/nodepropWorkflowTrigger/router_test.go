@@ -0,0 +1,154 @@
+package flow
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRoutingRuleMatches(t *testing.T) {
+	release := InboundEvent{
+		Type: "release", Action: "published", Repo: "Cdaprod/api",
+		Payload: map[string]interface{}{"release": map[string]interface{}{"prerelease": false, "tag_name": "v1.2.0", "assets": []interface{}{}}},
+	}
+	push := InboundEvent{Type: "push", Repo: "Cdaprod/api", Branch: "main"}
+	tests := []struct {
+		name string
+		rule RoutingRule
+		ev   InboundEvent
+		want bool
+	}{
+		{name: "empty rule", ev: push, want: true},
+		{name: "event", rule: RoutingRule{Events: []string{"push", "release"}}, ev: push, want: true},
+		{name: "other event", rule: RoutingRule{Events: []string{"release"}}, ev: push},
+		{name: "action", rule: RoutingRule{Actions: []string{"published"}}, ev: release, want: true},
+		{name: "other action", rule: RoutingRule{Actions: []string{"created"}}, ev: release},
+		{name: "repo glob", rule: RoutingRule{Repo: "Cdaprod/*"}, ev: push, want: true},
+		{name: "repo glob miss", rule: RoutingRule{Repo: "other/*"}, ev: push},
+		{name: "branch glob", rule: RoutingRule{Branch: "release/*"}, ev: InboundEvent{Branch: "release/1.2"}, want: true},
+		{name: "branch glob miss", rule: RoutingRule{Branch: "release/*"}, ev: push},
+		{name: "payload bool", rule: RoutingRule{Payload: map[string]string{"release.prerelease": "false"}}, ev: release, want: true},
+		{name: "payload glob", rule: RoutingRule{Payload: map[string]string{"release.tag_name": "v1.*"}}, ev: release, want: true},
+		{name: "payload mismatch", rule: RoutingRule{Payload: map[string]string{"release.tag_name": "v2.*"}}, ev: release},
+		{name: "payload missing", rule: RoutingRule{Payload: map[string]string{"release.draft": "*"}}, ev: release},
+		{name: "payload not a scalar", rule: RoutingRule{Payload: map[string]string{"release.assets": "*"}}, ev: release},
+		{name: "payload without a body", rule: RoutingRule{Payload: map[string]string{"release.tag_name": "*"}}, ev: push},
+		{name: "paths", rule: RoutingRule{Paths: []string{"services/api/**"}}, ev: InboundEvent{Type: "push", ChangedFiles: []string{"README.md", "services/api/main.go"}}, want: true},
+		{name: "paths miss", rule: RoutingRule{Paths: []string{"services/api/**"}}, ev: InboundEvent{Type: "push", ChangedFiles: []string{"README.md"}}},
+		{name: "paths of no changes", rule: RoutingRule{Paths: []string{"services/api/**"}}, ev: InboundEvent{Type: "push", ChangedFiles: []string{}}},
+		{name: "paths of unknown changes", rule: RoutingRule{Paths: []string{"services/api/**"}}, ev: push, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.Matches(tt.ev); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateRoutingRules(t *testing.T) {
+	target := BatchTarget{Repo: SourceRepo, Workflow: "deploy.yml"}
+	tests := []struct {
+		name    string
+		rule    RoutingRule
+		wantErr string
+	}{
+		{name: "valid", rule: RoutingRule{Name: "r", Targets: []BatchTarget{{Repo: "${event.repo}", Workflow: "deploy.yml", Inputs: map[string]string{"v": "${payload.release.tag_name}"}}}}},
+		{name: "selector", rule: RoutingRule{Name: "r", Targets: []BatchTarget{{Selector: "tag:web"}}}},
+		{name: "no name", rule: RoutingRule{Targets: []BatchTarget{target}}, wantErr: "has no name"},
+		{name: "nothing to dispatch", rule: RoutingRule{Name: "r"}, wantErr: "no targets or fan_out"},
+		{name: "bad repo pattern", rule: RoutingRule{Name: "r", Repo: "[", Targets: []BatchTarget{target}}, wantErr: "bad pattern"},
+		{name: "paths", rule: RoutingRule{Name: "r", Paths: []string{"services/api/**", "!services/api/docs/**"}, Targets: []BatchTarget{target}}},
+		{name: "bad paths", rule: RoutingRule{Name: "r", Paths: []string{"!docs/**"}, Targets: []BatchTarget{target}}, wantErr: "rule r: paths: the first pattern must not be an exclusion"},
+		{name: "bad payload pattern", rule: RoutingRule{Name: "r", Payload: map[string]string{"a": "["}, Targets: []BatchTarget{target}}, wantErr: "bad pattern"},
+		{name: "repo and selector", rule: RoutingRule{Name: "r", Targets: []BatchTarget{{Repo: "o/r", Selector: "*", Workflow: "x.yml"}}}, wantErr: "exactly one of repo or selector"},
+		{name: "no workflow", rule: RoutingRule{Name: "r", Targets: []BatchTarget{{Repo: "o/r"}}}, wantErr: "workflow is required"},
+		{name: "unknown event field", rule: RoutingRule{Name: "r", Targets: []BatchTarget{{Repo: "o/r", Workflow: "x.yml", Ref: "${event.sha}"}}}, wantErr: "unknown parameter ${event.sha}"},
+		{name: "unknown root", rule: RoutingRule{Name: "r", Targets: []BatchTarget{{Repo: "o/r", Workflow: "x.yml", Inputs: map[string]string{"a": "${env.HOME}"}}}}, wantErr: "unknown parameter"},
+		{name: "bare payload", rule: RoutingRule{Name: "r", Targets: []BatchTarget{{Repo: "o/r", Workflow: "x.yml", Inputs: map[string]string{"a": "${payload}"}}}}, wantErr: "unknown parameter"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRoutingRules([]RoutingRule{tt.rule})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateRoutingRules() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateRoutingRules() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEventRouterUsesPaths(t *testing.T) {
+	r := &EventRouter{Rules: []RoutingRule{{Name: "all"}}}
+	if r.UsesPaths() {
+		t.Error("UsesPaths() = true without paths")
+	}
+	r.Rules = append(r.Rules, RoutingRule{Name: "api", Paths: []string{"services/api/**"}})
+	if !r.UsesPaths() {
+		t.Error("UsesPaths() = false with a rule with paths")
+	}
+}
+
+func TestRoute(t *testing.T) {
+	reg := NewRepositoryRegistry()
+	reg.SetRepo(RepoEntry{Name: "Cdaprod/web", Workflows: []string{"deploy.yml"}, Tags: []string{"web"}})
+	router := &EventRouter{Registry: reg, Rules: []RoutingRule{
+		{
+			Name:    "deploy-release",
+			Events:  []string{"release"},
+			Targets: []BatchTarget{{Repo: SourceRepo, Workflow: "deploy.yml", Inputs: map[string]string{"version": "${payload.release.tag_name}", "by": "${event.delivery}"}}},
+		},
+		{
+			Name:    "web",
+			Events:  []string{"release"},
+			Targets: []BatchTarget{{Selector: "tag:web", Ref: "${payload.release.target_commitish}"}},
+		},
+		{Name: "pushes", Events: []string{"push"}, Targets: []BatchTarget{{Repo: "o/r", Workflow: "ci.yml"}}},
+	}}
+	ev := InboundEvent{
+		Type: "release", Repo: "Cdaprod/api", Delivery: "d-1",
+		Payload: map[string]interface{}{"release": map[string]interface{}{"tag_name": "v1.2.0", "target_commitish": "release"}},
+	}
+	got, err := router.Route(ev)
+	if err != nil {
+		t.Fatalf("Route() error = %v", err)
+	}
+	want := []RoutedDispatch{
+		{Rule: "deploy-release", PlannedDispatch: PlannedDispatch{Repo: "Cdaprod/api", Workflow: "deploy.yml", Ref: "main", Inputs: map[string]string{"version": "v1.2.0", "by": "d-1"}, Source: "Cdaprod/api"}},
+		{Rule: "web", PlannedDispatch: PlannedDispatch{Repo: "Cdaprod/web", Workflow: "deploy.yml", Ref: "release", Source: "tag:web"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Route() = %+v, want %+v", got, want)
+	}
+	if router.Rules[0].Targets[0].Repo != SourceRepo {
+		t.Error("Route() modified the rule")
+	}
+
+	delete(ev.Payload["release"].(map[string]interface{}), "tag_name")
+	if _, err := router.Route(ev); err == nil || !strings.Contains(err.Error(), "${payload.release.tag_name} is not set") {
+		t.Errorf("Route() with a missing payload field error = %v", err)
+	}
+}
+
+func TestRoutedDispatchIdempotencyKey(t *testing.T) {
+	d := RoutedDispatch{Rule: "r", PlannedDispatch: PlannedDispatch{Repo: "o/r", Workflow: "ci.yml", Ref: "main", Inputs: map[string]string{"a": "1"}}}
+	other := d
+	other.Rule = "s"
+	switch key := d.IdempotencyKey("d-1"); {
+	case !strings.HasPrefix(key, "delivery:d-1:"):
+		t.Errorf("IdempotencyKey() = %q", key)
+	case key != d.IdempotencyKey("d-1"):
+		t.Error("IdempotencyKey() is not stable")
+	case key == d.IdempotencyKey("d-2"), key == other.IdempotencyKey("d-1"):
+		t.Error("IdempotencyKey() is the same for different deliveries or rules")
+	}
+	if key := d.IdempotencyKey(""); key != "" {
+		t.Errorf("IdempotencyKey() without a delivery = %q, want empty", key)
+	}
+}
@@ -0,0 +1,214 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+)
+
+// WorkflowRun is the subset of a GitHub Actions run used by this package.
+type WorkflowRun struct {
+	ID           int64     `json:"id"`
+	Name         string    `json:"name"`
+	DisplayTitle string    `json:"display_title"`
+	Event        string    `json:"event"`
+	HeadBranch   string    `json:"head_branch"`
+	Status       string    `json:"status"`
+	Conclusion   string    `json:"conclusion"`
+	HTMLURL      string    `json:"html_url"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	RunStartedAt time.Time `json:"run_started_at"`
+}
+
+// Completed reports whether the run has finished.
+func (r *WorkflowRun) Completed() bool {
+	return r.Status == "completed"
+}
+
+// Workflow is the subset of a GitHub Actions workflow used by this package.
+type Workflow struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Path  string `json:"path"`
+	State string `json:"state"`
+}
+
+// GetWorkflow fetches a workflow by file name or ID.
+func (c *GitHubClient) GetWorkflow(ctx context.Context, repo, workflowFile string) (*Workflow, error) {
+	var wf Workflow
+	if err := c.do(ctx, "GET", fmt.Sprintf("/repos/%s/actions/workflows/%s", repo, url.PathEscape(workflowFile)), nil, &wf); err != nil {
+		return nil, err
+	}
+	return &wf, nil
+}
+
+// ListWorkflows lists every workflow of repo.
+func (c *GitHubClient) ListWorkflows(ctx context.Context, repo string) ([]Workflow, error) {
+	const perPage = 100
+	var all []Workflow
+	for page := 1; ; page++ {
+		var out struct {
+			Workflows []Workflow `json:"workflows"`
+		}
+		if err := c.do(ctx, "GET", fmt.Sprintf("/repos/%s/actions/workflows?per_page=%d&page=%d", repo, perPage, page), nil, &out); err != nil {
+			return nil, err
+		}
+		all = append(all, out.Workflows...)
+		if len(out.Workflows) < perPage {
+			return all, nil
+		}
+	}
+}
+
+// RepositoryDispatch sends a repository_dispatch event of eventType to
+// repo, which starts the workflows listening for it with clientPayload as
+// github.event.client_payload. The payload is encoded as it is sent, so a
+// large one is not held in memory whole.
+func (c *GitHubClient) RepositoryDispatch(ctx context.Context, repo, eventType string, clientPayload interface{}) error {
+	if eventType == "" {
+		return errors.New("repository_dispatch needs an event type")
+	}
+	payload := streamedJSON{v: struct {
+		EventType     string      `json:"event_type"`
+		ClientPayload interface{} `json:"client_payload,omitempty"`
+	}{eventType, clientPayload}}
+	if err := c.do(ctx, "POST", "/repos/"+repo+"/dispatches", payload, nil); err != nil {
+		return fmt.Errorf("failed to send repository_dispatch: %w", err)
+	}
+	return nil
+}
+
+// DispatchWorkflow sends a workflow_dispatch event for workflowFile on ref.
+// Inputs GitHub would refuse are a *ParamError, and nothing is sent.
+func (c *GitHubClient) DispatchWorkflow(ctx context.Context, repo, workflowFile, ref string, inputs map[string]string) error {
+	if err := ValidateInputs(inputs); err != nil {
+		return err
+	}
+	payload := dispatchPayload{Ref: ref, Inputs: inputs}
+	path := fmt.Sprintf("/repos/%s/actions/workflows/%s/dispatches", repo, url.PathEscape(workflowFile))
+	if err := c.do(ctx, "POST", path, payload, nil); err != nil {
+		return fmt.Errorf("failed to trigger workflow: %w", err)
+	}
+	return nil
+}
+
+// ListWorkflowRuns lists runs of a workflow file created at or after since.
+func (c *GitHubClient) ListWorkflowRuns(ctx context.Context, repo, workflowFile string, since time.Time) ([]WorkflowRun, error) {
+	q := url.Values{}
+	q.Set("event", "workflow_dispatch")
+	q.Set("per_page", "50")
+	if !since.IsZero() {
+		q.Set("created", ">="+since.UTC().Format(time.RFC3339))
+	}
+	path := fmt.Sprintf("/repos/%s/actions/workflows/%s/runs?%s", repo, url.PathEscape(workflowFile), q.Encode())
+
+	var out struct {
+		WorkflowRuns []WorkflowRun `json:"workflow_runs"`
+	}
+	if err := c.do(ctx, "GET", path, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.WorkflowRuns, nil
+}
+
+// GetWorkflowRun fetches a single run by ID.
+func (c *GitHubClient) GetWorkflowRun(ctx context.Context, repo string, runID int64) (*WorkflowRun, error) {
+	var run WorkflowRun
+	if err := c.do(ctx, "GET", fmt.Sprintf("/repos/%s/actions/runs/%d", repo, runID), nil, &run); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// CancelWorkflowRun requests cancellation of a queued or in-progress run.
+func (c *GitHubClient) CancelWorkflowRun(ctx context.Context, repo string, runID int64) error {
+	if err := c.do(ctx, "POST", fmt.Sprintf("/repos/%s/actions/runs/%d/cancel", repo, runID), nil, nil); err != nil {
+		return fmt.Errorf("failed to cancel run %d: %w", runID, err)
+	}
+	return nil
+}
+
+// WorkflowJob is the subset of a run's job used by this package.
+type WorkflowJob struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Status      string    `json:"status"`
+	Conclusion  string    `json:"conclusion"`
+	StartedAt   time.Time `json:"started_at"`
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+// ListRunJobs lists the jobs of the latest attempt of a run.
+func (c *GitHubClient) ListRunJobs(ctx context.Context, repo string, runID int64) ([]WorkflowJob, error) {
+	var out struct {
+		Jobs []WorkflowJob `json:"jobs"`
+	}
+	if err := c.do(ctx, "GET", fmt.Sprintf("/repos/%s/actions/runs/%d/jobs?per_page=100", repo, runID), nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Jobs, nil
+}
+
+// JobLogs opens the plain-text log of a job. GitHub only serves logs once the
+// job has completed. The caller must close the reader.
+func (c *GitHubClient) JobLogs(ctx context.Context, repo string, jobID int64) (io.ReadCloser, error) {
+	resp, err := c.send(ctx, "GET", fmt.Sprintf("/repos/%s/actions/jobs/%d/logs", repo, jobID), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch logs for job %d: %w", jobID, err)
+	}
+	return resp.Body, nil
+}
+
+// DownloadRunLogs copies the zip archive of every job log of a run to w as
+// it arrives and returns its size, so a large archive need not fit in
+// memory.
+func (c *GitHubClient) DownloadRunLogs(ctx context.Context, repo string, runID int64, w io.Writer) (int64, error) {
+	resp, err := c.send(ctx, "GET", fmt.Sprintf("/repos/%s/actions/runs/%d/logs", repo, runID), nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch logs for run %d: %w", runID, err)
+	}
+	defer resp.Body.Close()
+	n, err := io.Copy(w, resp.Body)
+	if err != nil {
+		return n, fmt.Errorf("failed to download logs for run %d: %w", runID, err)
+	}
+	return n, nil
+}
+
+// Artifact is the subset of a run's artifact used by this package.
+type Artifact struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	SizeInBytes int64  `json:"size_in_bytes"`
+	Expired     bool   `json:"expired"`
+}
+
+// ListRunArtifacts lists the artifacts a run uploaded.
+func (c *GitHubClient) ListRunArtifacts(ctx context.Context, repo string, runID int64) ([]Artifact, error) {
+	var out struct {
+		Artifacts []Artifact `json:"artifacts"`
+	}
+	if err := c.do(ctx, "GET", fmt.Sprintf("/repos/%s/actions/runs/%d/artifacts?per_page=100", repo, runID), nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Artifacts, nil
+}
+
+// DownloadArtifact copies the zip archive of an artifact to w and returns
+// its size.
+func (c *GitHubClient) DownloadArtifact(ctx context.Context, repo string, artifactID int64, w io.Writer) (int64, error) {
+	resp, err := c.send(ctx, "GET", fmt.Sprintf("/repos/%s/actions/artifacts/%d/zip", repo, artifactID), nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch artifact %d: %w", artifactID, err)
+	}
+	defer resp.Body.Close()
+	n, err := io.Copy(w, resp.Body)
+	if err != nil {
+		return n, fmt.Errorf("failed to download artifact %d: %w", artifactID, err)
+	}
+	return n, nil
+}
@@ -0,0 +1,72 @@
+// Package s3audit implements flow.AuditSink on Amazon S3 or a compatible
+// object store.
+package s3audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/oidc"
+)
+
+// Sink writes each entry as its own object, since objects cannot be
+// appended to. Keys sort by time:
+//
+//	<prefix>/2024/05/01/20240501T120000.000000000Z-<dispatch id>.json
+//
+// Objects are written only if absent, so entries are never replaced; enable
+// S3 Object Lock on the bucket to keep them from being deleted.
+type Sink struct {
+	Client *s3.Client
+	Bucket string
+	Prefix string
+}
+
+// Open creates a Sink for an s3://bucket/prefix URL, with credentials and
+// region from the default AWS configuration chain. AWS_ENDPOINT_URL_S3
+// selects an S3-compatible store.
+func Open(ctx context.Context, url string) (*Sink, error) {
+	rest, ok := strings.CutPrefix(url, "s3://")
+	bucket, prefix, _ := strings.Cut(rest, "/")
+	if !ok || bucket == "" {
+		return nil, fmt.Errorf("invalid S3 URL %q: want s3://bucket/prefix", url)
+	}
+	cfg, err := oidc.LoadAWSConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+	return &Sink{Client: s3.NewFromConfig(cfg), Bucket: bucket, Prefix: strings.Trim(prefix, "/")}, nil
+}
+
+// Record puts e as a new object.
+func (s *Sink) Record(ctx context.Context, e flow.AuditEntry) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	t := e.Time.UTC()
+	name := t.Format("20060102T150405.000000000Z")
+	if e.DispatchID != "" {
+		name += "-" + e.DispatchID
+	}
+	key := path.Join(s.Prefix, t.Format("2006/01/02"), name+".json")
+	_, err = s.Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.Bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/json"),
+		IfNoneMatch: aws.String("*"),
+	})
+	if err != nil {
+		return fmt.Errorf("s3: put %s: %w", key, err)
+	}
+	return nil
+}
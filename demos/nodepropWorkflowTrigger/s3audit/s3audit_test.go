@@ -0,0 +1,122 @@
+package s3audit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// bucket is an S3-compatible store that only creates objects.
+type bucket struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (b *bucket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Header.Get("If-None-Match") != "*" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if _, ok := b.objects[r.URL.Path]; ok {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		io.WriteString(w, `<Error><Code>PreconditionFailed</Code><Message>At least one of the pre-conditions you specified did not hold</Message></Error>`)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	b.objects[r.URL.Path] = body
+}
+
+// openTest opens a Sink for url on an S3-compatible store served by h.
+func openTest(t *testing.T, url string, h http.Handler) (*Sink, error) {
+	t.Helper()
+	ts := httptest.NewServer(h)
+	t.Cleanup(ts.Close)
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_ENDPOINT_URL_S3", ts.URL)
+	t.Setenv("AWS_ROLE_ARN", "")
+	return Open(context.Background(), url)
+}
+
+func TestOpen(t *testing.T) {
+	tests := []struct {
+		url, bucket, prefix string
+		wantErr             bool
+	}{
+		{url: "s3://audit/nodeprop/", bucket: "audit", prefix: "nodeprop"},
+		{url: "s3://audit", bucket: "audit"},
+		{url: "s3:///nodeprop", wantErr: true},
+		{url: "gs://audit/nodeprop", wantErr: true},
+	}
+	for _, tt := range tests {
+		s, err := openTest(t, tt.url, http.NotFoundHandler())
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Open(%q) succeeded", tt.url)
+			}
+			continue
+		}
+		if err != nil || s.Bucket != tt.bucket || s.Prefix != tt.prefix {
+			t.Errorf("Open(%q) = %+v, %v; want bucket %q and prefix %q", tt.url, s, err, tt.bucket, tt.prefix)
+		}
+	}
+}
+
+func TestRecord(t *testing.T) {
+	b := &bucket{objects: map[string][]byte{}}
+	s, err := openTest(t, "s3://audit/nodeprop", b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	e := flow.AuditEntry{Time: at, Repo: "o/r", Workflow: "ci.yml", Result: flow.AuditDispatched, DispatchID: "d1"}
+	if err := s.Record(context.Background(), e); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	// Without a dispatch ID the key is the time alone.
+	if err := s.Record(context.Background(), flow.AuditEntry{Time: at, Result: flow.AuditHeld}); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	key := "/audit/nodeprop/2024/05/01/20240501T120000.000000000Z-d1.json"
+	var got flow.AuditEntry
+	if err := json.Unmarshal(b.objects[key], &got); err != nil || got.DispatchID != "d1" || got.Repo != "o/r" {
+		t.Errorf("object %s = %s, %v; objects %v", key, b.objects[key], err, keys(b))
+	}
+	if _, ok := b.objects["/audit/nodeprop/2024/05/01/20240501T120000.000000000Z.json"]; !ok {
+		t.Errorf("objects %v, want one without a dispatch ID", keys(b))
+	}
+
+	// Entries are never replaced.
+	err = s.Record(context.Background(), e)
+	if err == nil || !strings.Contains(err.Error(), "s3: put nodeprop/2024/05/01/") {
+		t.Errorf("Record() of an existing key error = %v", err)
+	}
+}
+
+func keys(b *bucket) []string {
+	var out []string
+	for k := range b.objects {
+		out = append(out, k)
+	}
+	return out
+}
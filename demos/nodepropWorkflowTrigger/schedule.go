@@ -0,0 +1,261 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// schedulerPoll is how often a Scheduler rechecks the registry for added,
+// changed, or removed schedules.
+const schedulerPoll = time.Minute
+
+// ScheduleEntry dispatches a workflow on a cron schedule. Entries are kept
+// in the registry file under "schedules".
+type ScheduleEntry struct {
+	Name string `yaml:"name" json:"name"`
+	// Cron is a five-field cron expression or a macro such as @daily.
+	Cron string `yaml:"cron" json:"cron"`
+	// Timezone is the IANA zone Cron is evaluated in; empty means UTC.
+	Timezone string            `yaml:"timezone,omitempty" json:"timezone,omitempty"`
+	Repo     string            `yaml:"repo" json:"repo"`
+	Workflow string            `yaml:"workflow" json:"workflow"`
+	Ref      string            `yaml:"ref,omitempty" json:"ref,omitempty"`
+	Inputs   map[string]string `yaml:"inputs,omitempty" json:"inputs,omitempty"`
+	// CatchUp fires once on start if a firing was missed while no scheduler
+	// was running. Otherwise missed firings are skipped.
+	CatchUp bool `yaml:"catch_up,omitempty" json:"catch_up,omitempty"`
+}
+
+// Parse parses the entry's cron expression in its time zone.
+func (e ScheduleEntry) Parse() (*CronSchedule, error) {
+	return ParseCron(e.Cron, e.Timezone)
+}
+
+func (e ScheduleEntry) validate() error {
+	if e.Name == "" {
+		return errors.New("schedule has no name")
+	}
+	if owner, name, ok := strings.Cut(e.Repo, "/"); !ok || owner == "" || name == "" {
+		return fmt.Errorf("schedule %s: repository %q must be owner/repo", e.Name, e.Repo)
+	}
+	if e.Workflow == "" {
+		return fmt.Errorf("schedule %s: no workflow", e.Name)
+	}
+	if _, err := e.Parse(); err != nil {
+		return fmt.Errorf("schedule %s: %w", e.Name, err)
+	}
+	return nil
+}
+
+// SetSchedule adds or replaces the schedule with e's name.
+func (r *RepositoryRegistry) SetSchedule(e ScheduleEntry) error {
+	if err := e.validate(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.schedules[e.Name] = e
+	return nil
+}
+
+// RemoveSchedule deletes the named schedule.
+func (r *RepositoryRegistry) RemoveSchedule(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.schedules[name]; !ok {
+		return fmt.Errorf("schedule %s not found", name)
+	}
+	delete(r.schedules, name)
+	return nil
+}
+
+// Schedules returns all schedules sorted by name.
+func (r *RepositoryRegistry) Schedules() []ScheduleEntry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]ScheduleEntry, 0, len(r.schedules))
+	for _, e := range r.schedules {
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Scheduler dispatches the schedules in a registry as they fall due. Each
+// firing is recorded in the correlator's history with its schedule name,
+// which is also how a restarted scheduler knows when a schedule last fired.
+type Scheduler struct {
+	Registry *RepositoryRegistry
+	// RegistryPath, if set, is reloaded every minute so that schedules
+	// edited on disk take effect without a restart.
+	RegistryPath string
+	Correlator   *RunCorrelator
+	// OnError, if set, receives errors that do not stop the scheduler.
+	OnError func(error)
+	// OnFire, if set, is called after each firing with the dispatch made.
+	OnFire func(ScheduleEntry, *DispatchRecord)
+	// Clock, if set, decides when schedules fall due; nil means the
+	// correlator's Clock.
+	Clock Clock
+}
+
+// NewScheduler creates a Scheduler for the schedules in registry.
+func NewScheduler(registry *RepositoryRegistry, correlator *RunCorrelator) *Scheduler {
+	return &Scheduler{Registry: registry, Correlator: correlator}
+}
+
+// scheduled is a Scheduler's state for one schedule.
+type scheduled struct {
+	cron, timezone string
+	sched          *CronSchedule
+	due            time.Time
+}
+
+// Run fires schedules until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) error {
+	clock := s.clock()
+	state := map[string]*scheduled{}
+	for {
+		now := clock.Now()
+		wake := now.Add(schedulerPoll)
+		seen := map[string]bool{}
+		for _, e := range s.entries() {
+			seen[e.Name] = true
+			st := state[e.Name]
+			if st == nil || st.cron != e.Cron || st.timezone != e.Timezone {
+				var err error
+				if st, err = s.start(e, now); err != nil {
+					s.report(err)
+					continue
+				}
+				state[e.Name] = st
+			}
+			if st.due.IsZero() {
+				continue
+			}
+			if !st.due.After(now) {
+				s.fire(ctx, e, st.due)
+				st.due = st.sched.Next(now)
+			}
+			if !st.due.IsZero() && st.due.Before(wake) {
+				wake = st.due
+			}
+		}
+		for name := range state {
+			if !seen[name] {
+				delete(state, name)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-clock.After(wake.Sub(clock.Now())):
+		}
+	}
+}
+
+func (s *Scheduler) clock() Clock {
+	if s.Clock == nil && s.Correlator != nil {
+		return ClockOr(s.Correlator.Clock)
+	}
+	return ClockOr(s.Clock)
+}
+
+// NextFiring returns when e is next due: after its last recorded firing,
+// or after now if it has never fired or missed firings are not caught up.
+func (s *Scheduler) NextFiring(e ScheduleEntry, now time.Time) (time.Time, error) {
+	st, err := s.start(e, now)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return st.due, nil
+}
+
+func (s *Scheduler) start(e ScheduleEntry, now time.Time) (*scheduled, error) {
+	sched, err := e.Parse()
+	if err != nil {
+		return nil, fmt.Errorf("schedule %s: %w", e.Name, err)
+	}
+	st := &scheduled{cron: e.Cron, timezone: e.Timezone, sched: sched, due: sched.Next(now)}
+	last, err := s.lastFiring(e)
+	if err != nil {
+		return nil, fmt.Errorf("schedule %s: %w", e.Name, err)
+	}
+	if !last.IsZero() {
+		next := sched.Next(last)
+		if next.After(now) || e.CatchUp {
+			st.due = next
+		}
+	}
+	return st, nil
+}
+
+// lastFiring returns the time the newest recorded firing of e was due.
+func (s *Scheduler) lastFiring(e ScheduleEntry) (time.Time, error) {
+	recs, err := s.Correlator.History.List(e.Repo)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var last time.Time
+	for _, rec := range recs {
+		if rec.Schedule == e.Name && rec.ScheduledFor.After(last) {
+			last = rec.ScheduledFor
+		}
+	}
+	return last, nil
+}
+
+func (s *Scheduler) fire(ctx context.Context, e ScheduleEntry, due time.Time) {
+	ref := e.Ref
+	if ref == "" {
+		ref = "main"
+	}
+	// The key makes a firing happen once even if schedulers sharing a
+	// history race or one restarts mid-firing.
+	rec, err := s.Correlator.Submit(ctx, DispatchRequest{
+		Repo:           e.Repo,
+		Workflow:       e.Workflow,
+		Ref:            ref,
+		Inputs:         e.Inputs,
+		IdempotencyKey: fmt.Sprintf("schedule:%s:%d", e.Name, due.Unix()),
+		Schedule:       e.Name,
+		ScheduledFor:   due.UTC(),
+	})
+	if errors.Is(err, ErrAlreadyDispatched) {
+		return
+	}
+	if err != nil {
+		s.report(fmt.Errorf("schedule %s: %w", e.Name, err))
+		return
+	}
+	if s.OnFire != nil {
+		s.OnFire(e, rec)
+	}
+}
+
+// entries returns the current schedules, reloading RegistryPath if set.
+func (s *Scheduler) entries() []ScheduleEntry {
+	if s.RegistryPath != "" {
+		reg, err := LoadRegistry(s.RegistryPath)
+		if err != nil {
+			s.report(err)
+		} else {
+			s.Registry = reg
+		}
+	}
+	if s.Registry == nil {
+		return nil
+	}
+	return s.Registry.Schedules()
+}
+
+func (s *Scheduler) report(err error) {
+	if s.OnError != nil {
+		s.OnError(err)
+	}
+}
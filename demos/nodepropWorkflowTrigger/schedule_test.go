@@ -0,0 +1,118 @@
+package flow_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+func TestSetSchedule(t *testing.T) {
+	valid := flow.ScheduleEntry{Name: "nightly", Cron: "@daily", Repo: "Cdaprod/site", Workflow: "deploy.yml"}
+	tests := []struct {
+		name    string
+		edit    func(e *flow.ScheduleEntry)
+		wantErr string
+	}{
+		{name: "valid", edit: func(e *flow.ScheduleEntry) {}},
+		{name: "no name", edit: func(e *flow.ScheduleEntry) { e.Name = "" }, wantErr: "schedule has no name"},
+		{name: "bad repo", edit: func(e *flow.ScheduleEntry) { e.Repo = "site" }, wantErr: `repository "site" must be owner/repo`},
+		{name: "no workflow", edit: func(e *flow.ScheduleEntry) { e.Workflow = "" }, wantErr: "no workflow"},
+		{name: "bad cron", edit: func(e *flow.ScheduleEntry) { e.Cron = "daily" }, wantErr: "schedule nightly: invalid cron expression"},
+		{name: "bad time zone", edit: func(e *flow.ScheduleEntry) { e.Timezone = "Nowhere" }, wantErr: "invalid time zone"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := flow.NewRepositoryRegistry()
+			e := valid
+			tt.edit(&e)
+			err := reg.SetSchedule(e)
+			if tt.wantErr == "" {
+				if err != nil || len(reg.Schedules()) != 1 {
+					t.Errorf("SetSchedule() error = %v, schedules = %+v", err, reg.Schedules())
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("SetSchedule() error = %v, want %q", err, tt.wantErr)
+			}
+			if len(reg.Schedules()) != 0 {
+				t.Error("an invalid schedule was added")
+			}
+		})
+	}
+
+	reg := flow.NewRepositoryRegistry()
+	reg.SetSchedule(valid)
+	if err := reg.RemoveSchedule("nightly"); err != nil || len(reg.Schedules()) != 0 {
+		t.Errorf("RemoveSchedule() error = %v", err)
+	}
+	if err := reg.RemoveSchedule("nightly"); err == nil {
+		t.Error("RemoveSchedule() of a missing schedule succeeded")
+	}
+}
+
+func TestSchedulerRun(t *testing.T) {
+	gh := nodeproptest.NewServer()
+	defer gh.Close()
+	gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+	c := newCorrelator(t, gh)
+	clock := nodeproptest.NewClock(time.Date(2024, 3, 1, 12, 7, 0, 0, time.UTC))
+	reg := flow.NewRepositoryRegistry()
+	entry := flow.ScheduleEntry{Name: "quarterly", Cron: "*/15 * * * *", Repo: "Cdaprod/site", Workflow: "deploy.yml", Inputs: map[string]string{"env": "prod"}}
+	if err := reg.SetSchedule(entry); err != nil {
+		t.Fatal(err)
+	}
+
+	fired := make(chan *flow.DispatchRecord, 4)
+	s := flow.NewScheduler(reg, c)
+	s.Clock = clock
+	s.OnFire = func(_ flow.ScheduleEntry, rec *flow.DispatchRecord) { fired <- rec }
+	s.OnError = func(err error) { t.Errorf("scheduler error: %v", err) }
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+
+	for _, due := range []time.Time{time.Date(2024, 3, 1, 12, 15, 0, 0, time.UTC), time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)} {
+		// Run also wakes every minute to reload the registry.
+		clock.BlockUntil(1)
+		clock.Set(due)
+		select {
+		case rec := <-fired:
+			if !rec.ScheduledFor.Equal(due) || rec.Schedule != "quarterly" {
+				t.Errorf("fired %+v, want quarterly at %v", rec, due)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("schedule did not fire at %v", due)
+		}
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run() = %v", err)
+	}
+	ds := gh.Dispatches()
+	if len(ds) != 2 || ds[0].Ref != "main" || ds[0].Inputs["env"] != "prod" {
+		t.Errorf("dispatches = %+v, want two of main with the inputs", ds)
+	}
+
+	// A restarted scheduler resumes from the last firing in the history.
+	later := time.Date(2024, 3, 1, 13, 10, 0, 0, time.UTC)
+	tests := []struct {
+		catchUp bool
+		want    time.Time
+	}{
+		{catchUp: false, want: time.Date(2024, 3, 1, 13, 15, 0, 0, time.UTC)},
+		{catchUp: true, want: time.Date(2024, 3, 1, 12, 45, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		e := entry
+		e.CatchUp = tt.catchUp
+		got, err := flow.NewScheduler(reg, c).NextFiring(e, later)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("NextFiring() with catch-up %v = %v, %v; want %v", tt.catchUp, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package flow
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+var secretNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidSecretName reports whether name is acceptable to GitHub as an Actions
+// secret name.
+func ValidSecretName(name string) bool {
+	return secretNamePattern.MatchString(name) && !strings.HasPrefix(strings.ToUpper(name), "GITHUB_")
+}
+
+// RepoPublicKey is a repository's public key for encrypting Actions secrets.
+type RepoPublicKey struct {
+	KeyID string `json:"key_id"`
+	Key   string `json:"key"`
+}
+
+// RepoPublicKey fetches the key used to encrypt Actions secrets for repo.
+func (c *GitHubClient) RepoPublicKey(ctx context.Context, repo string) (*RepoPublicKey, error) {
+	var key RepoPublicKey
+	if err := c.do(ctx, "GET", fmt.Sprintf("/repos/%s/actions/secrets/public-key", repo), nil, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// SetRepoSecret encrypts value with the repository's public key and creates
+// or updates the Actions secret name.
+func (c *GitHubClient) SetRepoSecret(ctx context.Context, repo, name, value string) error {
+	key, err := c.RepoPublicKey(ctx, repo)
+	if err != nil {
+		return fmt.Errorf("failed to fetch public key: %w", err)
+	}
+	sealed, err := EncryptSecret(key.Key, value)
+	if err != nil {
+		return err
+	}
+	payload := map[string]string{"encrypted_value": sealed, "key_id": key.KeyID}
+	if err := c.do(ctx, "PUT", fmt.Sprintf("/repos/%s/actions/secrets/%s", repo, name), payload, nil); err != nil {
+		return fmt.Errorf("failed to set secret %s: %w", name, err)
+	}
+	return nil
+}
+
+// EncryptSecret seals value for a base64-encoded Curve25519 public key, as
+// the Actions secrets API requires, and returns it base64-encoded.
+func EncryptSecret(publicKey, value string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(raw) != 32 {
+		return "", fmt.Errorf("invalid repository public key")
+	}
+	var pk [32]byte
+	copy(pk[:], raw)
+	sealed, err := box.SealAnonymous(nil, []byte(value), &pk, rand.Reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt secret: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
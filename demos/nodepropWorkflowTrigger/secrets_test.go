@@ -0,0 +1,84 @@
+package flow
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+func TestValidSecretName(t *testing.T) {
+	tests := map[string]bool{
+		"DEPLOY_KEY":   true,
+		"_private":     true,
+		"key2":         true,
+		"2key":         false,
+		"with-dash":    false,
+		"":             false,
+		"GITHUB_TOKEN": false,
+		"github_x":     false,
+		"MY_GITHUB_X":  true,
+	}
+	for name, want := range tests {
+		if got := ValidSecretName(name); got != want {
+			t.Errorf("ValidSecretName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestSetRepoSecret(t *testing.T) {
+	pub, priv, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /repos/o/r/actions/secrets/public-key":
+			json.NewEncoder(w).Encode(RepoPublicKey{KeyID: "key-1", Key: base64.StdEncoding.EncodeToString(pub[:])})
+		case "PUT /repos/o/r/actions/secrets/DEPLOY_KEY":
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			if body["key_id"] != "key-1" {
+				http.Error(w, "wrong key", http.StatusUnprocessableEntity)
+				return
+			}
+			sealed, _ := base64.StdEncoding.DecodeString(body["encrypted_value"])
+			opened, ok := box.OpenAnonymous(nil, sealed, pub, priv)
+			if !ok {
+				http.Error(w, "cannot decrypt", http.StatusUnprocessableEntity)
+				return
+			}
+			got = string(opened)
+			w.WriteHeader(http.StatusCreated)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	c := NewGitHubClient("token")
+	c.BaseURL = srv.URL
+
+	if err := c.SetRepoSecret(context.Background(), "o/r", "DEPLOY_KEY", "s3cret"); err != nil {
+		t.Fatalf("SetRepoSecret() error = %v", err)
+	}
+	if got != "s3cret" {
+		t.Errorf("server decrypted %q, want the value", got)
+	}
+	if err := c.SetRepoSecret(context.Background(), "o/missing", "DEPLOY_KEY", "x"); err == nil {
+		t.Error("SetRepoSecret() on a repository without a key succeeded")
+	}
+}
+
+func TestEncryptSecretInvalidKey(t *testing.T) {
+	for _, key := range []string{"", "not base64!", base64.StdEncoding.EncodeToString(make([]byte, 16))} {
+		if _, err := EncryptSecret(key, "value"); err == nil {
+			t.Errorf("EncryptSecret(%q) succeeded", key)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package flow
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Select returns the registered repositories matching selector. A selector is
+// a comma-separated list of terms that must all match:
+//
+//	tag:NAME         repositories tagged NAME
+//	repo:PATTERN     repositories whose owner/name matches a path.Match glob
+//	dependents:REPO  repositories whose depends_on matches owner/name REPO
+//	PATTERN          shorthand for repo:PATTERN
+//	"*"              every repository
+func (r *RepositoryRegistry) Select(selector string) ([]RepoEntry, error) {
+	terms := strings.Split(selector, ",")
+	for i := range terms {
+		terms[i] = strings.TrimSpace(terms[i])
+		if terms[i] == "" {
+			return nil, fmt.Errorf("invalid selector %q: empty term", selector)
+		}
+	}
+
+	var out []RepoEntry
+	for _, e := range r.Repos() {
+		ok := true
+		for _, term := range terms {
+			m, err := matchTerm(term, e)
+			if err != nil {
+				return nil, fmt.Errorf("invalid selector %q: %w", selector, err)
+			}
+			if !m {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func matchTerm(term string, e RepoEntry) (bool, error) {
+	if term == "*" {
+		return true, nil
+	}
+	kind, arg, ok := strings.Cut(term, ":")
+	if !ok {
+		kind, arg = "repo", term
+	}
+	switch kind {
+	case "tag":
+		return e.HasTag(arg), nil
+	case "repo":
+		return path.Match(arg, e.Name)
+	case "dependents":
+		return e.Name != arg && e.DependsOnRepo(arg), nil
+	default:
+		return false, fmt.Errorf("unknown selector term %q", kind)
+	}
+}
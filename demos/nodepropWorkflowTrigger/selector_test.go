@@ -0,0 +1,58 @@
+package flow
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func selectorRegistry() *RepositoryRegistry {
+	r := NewRepositoryRegistry()
+	r.SetRepo(RepoEntry{Name: "Cdaprod/api", Workflows: []string{"ci.yml", "deploy.yml"}, Tags: []string{"backend", "infra"}, DependsOn: []string{"Cdaprod/lib"}})
+	r.SetRepo(RepoEntry{Name: "Cdaprod/web", Workflows: []string{"ci.yml"}, Tags: []string{"frontend"}, DependsOn: []string{"Cdaprod/*"}})
+	r.SetRepo(RepoEntry{Name: "Cdaprod/lib", Tags: []string{"infra"}})
+	r.SetRepo(RepoEntry{Name: "other/tool", Workflows: []string{"ci.yml"}})
+	return r
+}
+
+func TestSelect(t *testing.T) {
+	tests := []struct {
+		selector string
+		want     []string
+		wantErr  string
+	}{
+		{selector: "*", want: []string{"Cdaprod/api", "Cdaprod/lib", "Cdaprod/web", "other/tool"}},
+		{selector: "tag:infra", want: []string{"Cdaprod/api", "Cdaprod/lib"}},
+		{selector: "tag:missing"},
+		{selector: "Cdaprod/*", want: []string{"Cdaprod/api", "Cdaprod/lib", "Cdaprod/web"}},
+		{selector: "repo:*/tool", want: []string{"other/tool"}},
+		{selector: "tag:infra, Cdaprod/a*", want: []string{"Cdaprod/api"}},
+		{selector: "dependents:Cdaprod/lib", want: []string{"Cdaprod/api", "Cdaprod/web"}},
+		{selector: "dependents:Cdaprod/web", want: nil},
+		{selector: "tag:infra,", wantErr: "empty term"},
+		{selector: "owner:Cdaprod", wantErr: "unknown selector term"},
+		{selector: "repo:[", wantErr: "syntax error"},
+	}
+	r := selectorRegistry()
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			entries, err := r.Select(tt.selector)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Select() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Select() error = %v", err)
+			}
+			var got []string
+			for _, e := range entries {
+				got = append(got, e.Name)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Select() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
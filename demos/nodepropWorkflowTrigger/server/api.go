@@ -0,0 +1,290 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// maxRequestBody caps the size of a REST request body.
+const maxRequestBody = 1 << 20
+
+// TriggerRequest is the body of POST /v1/triggers.
+type TriggerRequest struct {
+	Repo           string            `json:"repo"`
+	Workflow       string            `json:"workflow"`
+	Ref            string            `json:"ref,omitempty"`
+	Inputs         map[string]string `json:"inputs,omitempty"`
+	IdempotencyKey string            `json:"idempotency_key,omitempty"`
+}
+
+// RepoRequest is the body of POST /v1/repos.
+type RepoRequest struct {
+	Name      string   `json:"name"`
+	Workflows []string `json:"workflows,omitempty"`
+	Actions   []string `json:"actions,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	// RequiresApproval and Approvers, if given, set the repository's
+	// approval policy.
+	RequiresApproval *bool    `json:"requires_approval,omitempty"`
+	Approvers        []string `json:"approvers,omitempty"`
+	DependsOn        []string `json:"depends_on,omitempty"`
+}
+
+// errorResponse is the body of every non-2xx API response.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func (s *Server) apiRoutes() {
+	// State-changing requests are verified only if an api source is configured.
+	s.mux.HandleFunc("POST /v1/triggers", s.authorize(ScopeTrigger, s.signed(SourceAPI, true, s.handleCreateTrigger)))
+	s.mux.HandleFunc("GET /v1/triggers", s.authorize(ScopeRead, s.handleListTriggers))
+	s.mux.HandleFunc("GET /v1/triggers/{id}", s.authorize(ScopeRead, s.handleGetTrigger))
+	s.mux.HandleFunc("GET /v1/events", s.authorize(ScopeRead, s.handleEvents))
+	s.mux.HandleFunc("GET /v1/repos", s.authorize(ScopeRead, s.handleListRepos))
+	s.mux.HandleFunc("POST /v1/repos", s.authorize(ScopeAdmin, s.signed(SourceAPI, true, s.handleRegisterRepo)))
+}
+
+func (s *Server) handleCreateTrigger(w http.ResponseWriter, r *http.Request) {
+	var req TriggerRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	rec, err := s.submitTrigger(r.Context(), req)
+	var rejected *requestError
+	var held *flow.ApprovalRequiredError
+	switch {
+	case errors.As(err, &rejected):
+		writeError(w, rejected.status, rejected.msg)
+	case errors.As(err, &held):
+		w.Header().Set("Location", "/v1/approvals/"+held.Approval.ID)
+		writeJSON(w, http.StatusAccepted, s.redactApproval(held.Approval))
+	case errors.Is(err, flow.ErrAlreadyDispatched):
+		writeJSON(w, http.StatusOK, rec)
+	case errors.Is(err, flow.ErrPolicyDenied):
+		writeError(w, http.StatusForbidden, err.Error())
+	case err != nil:
+		writeError(w, http.StatusBadGateway, err.Error())
+	default:
+		w.Header().Set("Location", "/v1/triggers/"+rec.ID)
+		writeJSON(w, http.StatusAccepted, rec)
+	}
+}
+
+// requestError is a request the server refuses before contacting GitHub.
+type requestError struct {
+	status int // HTTP status
+	msg    string
+}
+
+func (e *requestError) Error() string { return e.msg }
+
+// submitTrigger validates req and dispatches it, or holds it for approval.
+// It is shared by the REST and gRPC APIs.
+func (s *Server) submitTrigger(ctx context.Context, req TriggerRequest) (*flow.DispatchRecord, error) {
+	if req.Repo == "" || req.Workflow == "" {
+		return nil, &requestError{http.StatusBadRequest, "repo and workflow are required"}
+	}
+	if !s.can(ctx, ScopeTrigger, req.Repo) {
+		return nil, &requestError{http.StatusForbidden, roleError(ctx, ScopeTrigger, req.Repo).Error()}
+	}
+	// A non-empty registry is the allowlist of dispatchable repositories.
+	if len(s.Registry.Repos()) > 0 {
+		if _, ok := s.Registry.Get(req.Repo); !ok {
+			return nil, &requestError{http.StatusForbidden, fmt.Sprintf("repository %s is not registered", req.Repo)}
+		}
+	}
+	if err := flow.ValidateInputs(req.Inputs); err != nil {
+		return nil, &requestError{http.StatusBadRequest, err.Error()}
+	}
+	if req.Ref == "" {
+		req.Ref = "main"
+	}
+
+	rec, err := s.Correlator.Submit(ctx, flow.DispatchRequest{
+		Repo:           req.Repo,
+		Workflow:       req.Workflow,
+		Ref:            req.Ref,
+		Inputs:         req.Inputs,
+		IdempotencyKey: req.IdempotencyKey,
+		RequestedBy:    subject(ctx),
+	})
+	var held *flow.ApprovalRequiredError
+	if errors.As(err, &held) {
+		s.logf("api: %v", err)
+	} else if err != nil && !errors.Is(err, flow.ErrAlreadyDispatched) {
+		s.logf("api: dispatch %s %s: %v", req.Repo, req.Workflow, err)
+	}
+	return rec, err
+}
+
+func (s *Server) handleListTriggers(w http.ResponseWriter, r *http.Request) {
+	q, err := historyQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if q.Repo != "" && !s.can(r.Context(), ScopeRead, q.Repo) {
+		forbidden(w, r, ScopeRead, q.Repo)
+		return
+	}
+	recs, err := flow.QueryHistory(s.Correlator.History, q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, s.visibleRecords(r.Context(), recs))
+}
+
+// visibleRecords returns the records the caller may view, never nil.
+func (s *Server) visibleRecords(ctx context.Context, recs []flow.DispatchRecord) []flow.DispatchRecord {
+	out := []flow.DispatchRecord{}
+	for _, rec := range recs {
+		if s.can(ctx, ScopeRead, rec.Repo) {
+			out = append(out, rec)
+		}
+	}
+	return out
+}
+
+// historyQuery parses the query parameters of GET /v1/triggers.
+func historyQuery(v url.Values) (flow.HistoryQuery, error) {
+	q := flow.HistoryQuery{Repo: v.Get("repo"), Status: v.Get("status"), CorrelationID: v.Get("correlation_id")}
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{{"since", &q.Since}, {"until", &q.Until}} {
+		if v.Get(p.name) == "" {
+			continue
+		}
+		var err error
+		if *p.t, err = time.Parse(time.RFC3339, v.Get(p.name)); err != nil {
+			return q, fmt.Errorf("invalid %s: %w", p.name, err)
+		}
+	}
+	if v.Get("limit") != "" {
+		n, err := strconv.Atoi(v.Get("limit"))
+		if err != nil || n < 0 {
+			return q, fmt.Errorf("invalid limit %q", v.Get("limit"))
+		}
+		q.Limit = n
+	}
+	return q, nil
+}
+
+func (s *Server) handleGetTrigger(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	rec, ok, err := s.findTrigger(r.Context(), id)
+	switch {
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	case !ok:
+		writeError(w, http.StatusNotFound, "trigger "+id+" not found")
+	case !s.can(r.Context(), ScopeRead, rec.Repo):
+		forbidden(w, r, ScopeRead, rec.Repo)
+	default:
+		writeJSON(w, http.StatusOK, rec)
+	}
+}
+
+// findTrigger looks up a dispatch by ID and refreshes it from GitHub. A
+// failed refresh is logged and the stored record returned.
+func (s *Server) findTrigger(ctx context.Context, id string) (flow.DispatchRecord, bool, error) {
+	recs, err := flow.QueryHistory(s.Correlator.History, flow.HistoryQuery{ID: id, Limit: 1})
+	if err != nil {
+		return flow.DispatchRecord{}, false, err
+	}
+	for _, rec := range recs {
+		if rec, err = s.Correlator.Resolve(ctx, rec); err != nil {
+			s.logf("api: resolve %s: %v", id, err)
+		}
+		return rec, true, nil
+	}
+	return flow.DispatchRecord{}, false, nil
+}
+
+func (s *Server) handleListRepos(w http.ResponseWriter, r *http.Request) {
+	repos := []flow.RepoEntry{}
+	for _, e := range s.Registry.Repos() {
+		if s.can(r.Context(), ScopeRead, e.Name) {
+			repos = append(repos, e)
+		}
+	}
+	writeJSON(w, http.StatusOK, repos)
+}
+
+func (s *Server) handleRegisterRepo(w http.ResponseWriter, r *http.Request) {
+	var req RepoRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if owner, name, ok := strings.Cut(req.Name, "/"); !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+		writeError(w, http.StatusBadRequest, "name must be owner/repo")
+		return
+	}
+	if !s.can(r.Context(), ScopeAdmin, req.Name) {
+		forbidden(w, r, ScopeAdmin, req.Name)
+		return
+	}
+
+	s.regMu.Lock()
+	defer s.regMu.Unlock()
+	s.Registry.RegisterRepo(req.Name, req.Actions, req.Workflows)
+	if req.Tags != nil {
+		if err := s.Registry.SetTags(req.Name, req.Tags); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	if req.DependsOn != nil {
+		if err := s.Registry.SetDependencies(req.Name, req.DependsOn); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	if req.RequiresApproval != nil {
+		if err := s.Registry.SetApproval(req.Name, *req.RequiresApproval, req.Approvers); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	if s.RegistryPath != "" {
+		if err := s.Registry.Save(s.RegistryPath); err != nil {
+			s.logf("api: save registry: %v", err)
+			writeError(w, http.StatusInternalServerError, "registered but failed to persist the registry")
+			return
+		}
+	}
+	entry, _ := s.Registry.Get(req.Name)
+	writeJSON(w, http.StatusCreated, entry)
+}
+
+// decodeJSON decodes the request body into v, writing a 400 on failure.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, errorResponse{Error: msg})
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+func TestCreateTrigger(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		registered bool
+		wantStatus int
+		wantError  string
+	}{
+		{name: "dispatched", body: `{"repo": "Cdaprod/site", "workflow": "deploy.yml", "inputs": {"env": "prod"}}`, wantStatus: http.StatusAccepted},
+		{name: "registered", body: `{"repo": "Cdaprod/site", "workflow": "deploy.yml"}`, registered: true, wantStatus: http.StatusAccepted},
+		{name: "not registered", body: `{"repo": "Cdaprod/other", "workflow": "deploy.yml"}`, registered: true, wantStatus: http.StatusForbidden, wantError: "not registered"},
+		{name: "missing workflow", body: `{"repo": "Cdaprod/site"}`, wantStatus: http.StatusBadRequest, wantError: "repo and workflow are required"},
+		{name: "invalid input", body: `{"repo": "Cdaprod/site", "workflow": "deploy.yml", "inputs": {"-x": "1"}}`, wantStatus: http.StatusBadRequest},
+		{name: "unknown field", body: `{"repo": "Cdaprod/site", "workflow": "deploy.yml", "branch": "main"}`, wantStatus: http.StatusBadRequest, wantError: "unknown field"},
+		{name: "rejected by GitHub", body: `{"repo": "Cdaprod/site", "workflow": "missing.yml"}`, wantStatus: http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, gh := newTestServer(t)
+			if tt.registered {
+				s.Registry.RegisterRepo("Cdaprod/site", nil, []string{"deploy.yml"})
+			}
+			w := serve(s, "POST", "/v1/triggers", tt.body, nil)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusAccepted {
+				var e errorResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil || !strings.Contains(e.Error, tt.wantError) {
+					t.Errorf("body = %s, want an error containing %q", w.Body, tt.wantError)
+				}
+				return
+			}
+			var rec flow.DispatchRecord
+			if err := json.Unmarshal(w.Body.Bytes(), &rec); err != nil || rec.Ref != "main" {
+				t.Fatalf("body = %s, want a record on main", w.Body)
+			}
+			if loc := w.Header().Get("Location"); loc != "/v1/triggers/"+rec.ID {
+				t.Errorf("Location = %q", loc)
+			}
+			if n := len(gh.Dispatches()); n != 1 {
+				t.Errorf("%d dispatches sent, want 1", n)
+			}
+		})
+	}
+}
+
+func TestTriggerIdempotencyKey(t *testing.T) {
+	s, gh := newTestServer(t)
+	body := `{"repo": "Cdaprod/site", "workflow": "deploy.yml", "idempotency_key": "k-1"}`
+	first := serve(s, "POST", "/v1/triggers", body, nil)
+	again := serve(s, "POST", "/v1/triggers", body, nil)
+	if first.Code != http.StatusAccepted || again.Code != http.StatusOK {
+		t.Errorf("statuses = %d, %d; want 202 then 200", first.Code, again.Code)
+	}
+	if first.Body.String() != again.Body.String() {
+		t.Errorf("retried request returned %s, want %s", again.Body, first.Body)
+	}
+	if n := len(gh.Dispatches()); n != 1 {
+		t.Errorf("%d dispatches sent, want 1", n)
+	}
+}
+
+func TestListAndGetTriggers(t *testing.T) {
+	s, _ := newTestServer(t)
+	w := serve(s, "POST", "/v1/triggers", `{"repo": "Cdaprod/site", "workflow": "deploy.yml"}`, nil)
+	var rec flow.DispatchRecord
+	if err := json.Unmarshal(w.Body.Bytes(), &rec); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantCount  int
+	}{
+		{path: "/v1/triggers", wantStatus: http.StatusOK, wantCount: 1},
+		{path: "/v1/triggers?repo=Cdaprod/site&limit=1", wantStatus: http.StatusOK, wantCount: 1},
+		{path: "/v1/triggers?repo=Cdaprod/other", wantStatus: http.StatusOK},
+		{path: "/v1/triggers?since=2100-01-01T00:00:00Z", wantStatus: http.StatusOK},
+		{path: "/v1/triggers?status=failed", wantStatus: http.StatusOK},
+		{path: "/v1/triggers?since=yesterday", wantStatus: http.StatusBadRequest},
+		{path: "/v1/triggers?limit=-1", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := serve(s, "GET", tt.path, "", nil)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var recs []flow.DispatchRecord
+			if err := json.Unmarshal(w.Body.Bytes(), &recs); err != nil || recs == nil || len(recs) != tt.wantCount {
+				t.Errorf("body = %s, want %d records", w.Body, tt.wantCount)
+			}
+		})
+	}
+
+	if w := serve(s, "GET", "/v1/triggers/"+rec.ID, "", nil); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), rec.ID) {
+		t.Errorf("GET trigger = %d %s", w.Code, w.Body)
+	}
+	if w := serve(s, "GET", "/v1/triggers/missing", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("GET unknown trigger status = %d, want 404", w.Code)
+	}
+}
+
+func TestRegisterRepo(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "registered", body: `{"name": "Cdaprod/site", "workflows": ["deploy.yml"], "tags": ["web"], "requires_approval": true, "approvers": ["alice"], "depends_on": ["Cdaprod/lib"]}`, wantStatus: http.StatusCreated},
+		{name: "bare name", body: `{"name": "site"}`, wantStatus: http.StatusBadRequest},
+		{name: "too many slashes", body: `{"name": "Cdaprod/site/x"}`, wantStatus: http.StatusBadRequest},
+		{name: "not json", body: `name=site`, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+			s.RegistryPath = filepath.Join(t.TempDir(), "registry.yml")
+			w := serve(s, "POST", "/v1/repos", tt.body, nil)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if w.Code != http.StatusCreated {
+				return
+			}
+			saved, err := flow.LoadRegistry(s.RegistryPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			e, ok := saved.Get("Cdaprod/site")
+			if !ok || !e.HasTag("web") || !e.RequiresApproval || e.Approvers[0] != "alice" || !e.DependsOnRepo("Cdaprod/lib") {
+				t.Errorf("persisted entry = %+v, want the request's", e)
+			}
+			var repos []flow.RepoEntry
+			if w := serve(s, "GET", "/v1/repos", "", nil); json.Unmarshal(w.Body.Bytes(), &repos) != nil || len(repos) != 1 {
+				t.Errorf("GET /v1/repos = %s, want the registered repository", w.Body)
+			}
+		})
+	}
+}
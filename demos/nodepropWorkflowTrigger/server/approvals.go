@@ -0,0 +1,165 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// DecisionRequest is the optional body of POST /v1/approvals/{id}/approve
+// and /reject.
+type DecisionRequest struct {
+	Comment string `json:"comment,omitempty"`
+}
+
+// ApprovalResponse is the body of POST /v1/approvals/{id}/approve.
+type ApprovalResponse struct {
+	Approval flow.Approval        `json:"approval"`
+	Dispatch *flow.DispatchRecord `json:"dispatch,omitempty"`
+}
+
+func (s *Server) approvalRoutes() {
+	s.mux.HandleFunc("GET /v1/approvals", s.authorize(ScopeRead, s.handleListApprovals))
+	s.mux.HandleFunc("GET /v1/approvals/{id}", s.authorize(ScopeRead, s.handleGetApproval))
+	// Approving sends a dispatch on someone else's behalf, so it takes more
+	// than the trigger scope.
+	s.mux.HandleFunc("POST /v1/approvals/{id}/approve", s.authorize(ScopeAdmin, s.signed(SourceAPI, true, s.handleApprove)))
+	s.mux.HandleFunc("POST /v1/approvals/{id}/reject", s.authorize(ScopeAdmin, s.signed(SourceAPI, true, s.handleReject)))
+}
+
+// handleListApprovals lists approvals, optionally for one repo or in one
+// state (pending, approved, rejected, or expired).
+func (s *Server) handleListApprovals(w http.ResponseWriter, r *http.Request) {
+	if !s.hasApprovals(w) {
+		return
+	}
+	all, err := s.Correlator.Approvals.List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	repo, state := r.URL.Query().Get("repo"), flow.ApprovalState(r.URL.Query().Get("state"))
+	now := time.Now()
+	out := []flow.Approval{}
+	for _, a := range all {
+		a.State = a.CurrentState(now)
+		if (repo == "" || a.Repo == repo) && (state == "" || a.State == state) && s.can(r.Context(), ScopeRead, a.Repo) {
+			out = append(out, s.redactApproval(a))
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) handleGetApproval(w http.ResponseWriter, r *http.Request) {
+	if a, ok := s.findApproval(w, r, r.PathValue("id"), ScopeRead); ok {
+		a.State = a.CurrentState(time.Now())
+		writeJSON(w, http.StatusOK, s.redactApproval(a))
+	}
+}
+
+// handleApprove approves a held dispatch and sends it. It answers 202 with
+// the approval and the dispatch, or 502 if GitHub rejected the dispatch.
+func (s *Server) handleApprove(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	req, ok := s.decision(w, r, id)
+	if !ok {
+		return
+	}
+	a, rec, err := s.Correlator.Approve(r.Context(), id, approver(r), req.Comment)
+	if s.decisionFailed(w, a, err) {
+		return
+	}
+	if err != nil && !errors.Is(err, flow.ErrAlreadyDispatched) {
+		s.logf("api: dispatch approved %s: %v", id, err)
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	w.Header().Set("Location", "/v1/triggers/"+rec.ID)
+	writeJSON(w, http.StatusAccepted, ApprovalResponse{Approval: s.redactApproval(*a), Dispatch: rec})
+}
+
+func (s *Server) handleReject(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	req, ok := s.decision(w, r, id)
+	if !ok {
+		return
+	}
+	a, err := s.Correlator.Reject(r.Context(), id, approver(r), req.Comment)
+	if s.decisionFailed(w, a, err) {
+		return
+	}
+	writeJSON(w, http.StatusOK, ApprovalResponse{Approval: s.redactApproval(*a)})
+}
+
+// redactApproval hides the secret inputs the approval store keeps, so that
+// the dispatch can be sent once approved.
+func (s *Server) redactApproval(a flow.Approval) flow.Approval {
+	a.Inputs = s.Correlator.RedactInputs(a.Inputs)
+	return a
+}
+
+// decision checks that the approval exists and decodes the optional body.
+func (s *Server) decision(w http.ResponseWriter, r *http.Request, id string) (DecisionRequest, bool) {
+	var req DecisionRequest
+	if _, ok := s.findApproval(w, r, id, ScopeAdmin); !ok {
+		return req, false
+	}
+	if r.ContentLength != 0 && !decodeJSON(w, r, &req) {
+		return req, false
+	}
+	return req, true
+}
+
+// decisionFailed writes a 403 or 409 for a decision that was not allowed,
+// or a 500 if it could not be recorded, and reports whether it did. A
+// decision that was recorded returns the approval.
+func (s *Server) decisionFailed(w http.ResponseWriter, a *flow.Approval, err error) bool {
+	switch {
+	case errors.Is(err, flow.ErrNotApprover):
+		writeError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, flow.ErrApprovalDecided):
+		writeError(w, http.StatusConflict, err.Error())
+	case err != nil && a == nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		return false
+	}
+	return true
+}
+
+// approver names the caller deciding an approval in its audit trail.
+func approver(r *http.Request) string {
+	if sub := subject(r.Context()); sub != "" {
+		return sub
+	}
+	return "anonymous"
+}
+
+// findApproval looks up an approval, writing a 404 or 500 if it cannot,
+// or a 403 if the caller lacks the role scope requires in its repository.
+func (s *Server) findApproval(w http.ResponseWriter, r *http.Request, id, scope string) (flow.Approval, bool) {
+	if !s.hasApprovals(w) {
+		return flow.Approval{}, false
+	}
+	a, ok, err := flow.FindApproval(s.Correlator.Approvals, id)
+	switch {
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	case !ok:
+		writeError(w, http.StatusNotFound, "approval "+id+" not found")
+	case !s.can(r.Context(), scope, a.Repo):
+		forbidden(w, r, scope, a.Repo)
+		return a, false
+	}
+	return a, err == nil && ok
+}
+
+func (s *Server) hasApprovals(w http.ResponseWriter) bool {
+	if s.Correlator.Approvals == nil {
+		writeError(w, http.StatusNotFound, "no approval store is configured")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+func TestApprovals(t *testing.T) {
+	s, gh := newTestServer(t)
+	if w := serve(s, "GET", "/v1/approvals", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("list without a store status = %d, want 404", w.Code)
+	}
+	reg := flow.NewRepositoryRegistry()
+	reg.RegisterRepo("Cdaprod/site", nil, []string{"deploy.yml"})
+	reg.SetApproval("Cdaprod/site", true, nil)
+	s.Correlator.ApprovalPolicy = reg
+	s.Correlator.Approvals = flow.NewFileApprovalStore(filepath.Join(t.TempDir(), "approvals.json"))
+	s.Correlator.SecretInputs = []string{"token"}
+
+	var ids []string
+	for range 2 {
+		_, err := s.Correlator.Submit(t.Context(), flow.DispatchRequest{Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "main", RequestedBy: "key:ci", Inputs: map[string]string{"token": "hunter2"}})
+		var held *flow.ApprovalRequiredError
+		if !errors.As(err, &held) {
+			t.Fatalf("Submit() error = %v, want it held", err)
+		}
+		ids = append(ids, held.Approval.ID)
+	}
+
+	w := serve(s, "POST", "/v1/approvals/"+ids[0]+"/approve", `{"comment": "ship it"}`, nil)
+	var resp ApprovalResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusAccepted || resp.Dispatch == nil || w.Header().Get("Location") != "/v1/triggers/"+resp.Dispatch.ID {
+		t.Fatalf("approve = %d %+v", w.Code, resp)
+	}
+	if d := resp.Approval.Decisions; len(d) != 1 || d[0].By != "anonymous" || d[0].Comment != "ship it" || resp.Approval.Inputs["token"] == "hunter2" {
+		t.Errorf("approval = %+v, want the decision recorded and the secret redacted", resp.Approval)
+	}
+	if ds := gh.Dispatches(); len(ds) != 1 || ds[0].Inputs["token"] != "hunter2" {
+		t.Errorf("dispatches = %+v, want the held inputs sent", ds)
+	}
+	if w := serve(s, "POST", "/v1/approvals/"+ids[1]+"/reject", "", nil); w.Code != http.StatusOK {
+		t.Errorf("reject status = %d, want 200", w.Code)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		list   bool
+		count  int
+	}{
+		{name: "list", method: "GET", path: "/v1/approvals", status: 200, list: true, count: 2},
+		{name: "list approved", method: "GET", path: "/v1/approvals?state=approved", status: 200, list: true, count: 1},
+		{name: "list pending", method: "GET", path: "/v1/approvals?state=pending", status: 200, list: true, count: 0},
+		{name: "list other repo", method: "GET", path: "/v1/approvals?repo=Cdaprod/other", status: 200, list: true, count: 0},
+		{name: "get", method: "GET", path: "/v1/approvals/" + ids[1], status: 200},
+		{name: "get missing", method: "GET", path: "/v1/approvals/missing", status: 404},
+		{name: "approve decided", method: "POST", path: "/v1/approvals/" + ids[1] + "/approve", status: 409},
+		{name: "approve missing", method: "POST", path: "/v1/approvals/missing/approve", status: 404},
+		{name: "invalid body", method: "POST", path: "/v1/approvals/" + ids[0] + "/reject", body: "{", status: 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(s, tt.method, tt.path, tt.body, nil)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.list {
+				var list []flow.Approval
+				if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list) != tt.count {
+					t.Errorf("listed %d approvals, want %d", len(list), tt.count)
+				}
+			}
+		})
+	}
+
+	reg.SetApproval("Cdaprod/site", true, []string{"alice"})
+	_, err := s.Correlator.Submit(t.Context(), flow.DispatchRequest{Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "main"})
+	var held *flow.ApprovalRequiredError
+	errors.As(err, &held)
+	if w := serve(s, "POST", "/v1/approvals/"+held.Approval.ID+"/approve", "", nil); w.Code != http.StatusForbidden {
+		t.Errorf("approve by a non-approver status = %d, want 403", w.Code)
+	}
+}
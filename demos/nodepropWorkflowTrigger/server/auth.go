@@ -0,0 +1,300 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// API scopes. Each scope includes the ones before it: admin may do
+// everything, trigger may also read.
+const (
+	ScopeRead    = "read"
+	ScopeTrigger = "trigger"
+	ScopeAdmin   = "admin"
+)
+
+var scopeRank = map[string]int{ScopeRead: 1, ScopeTrigger: 2, ScopeAdmin: 3}
+
+// ErrUnauthenticated is returned by an Authenticator for credentials it
+// does not accept.
+var ErrUnauthenticated = errors.New("invalid credentials")
+
+// Principal is an authenticated API caller.
+type Principal struct {
+	Subject string
+	Scopes  []string
+	// Tenant, if set, groups the principal with others sharing its rate
+	// limits.
+	Tenant string
+}
+
+// Allows reports whether p holds scope or a scope that includes it.
+func (p *Principal) Allows(scope string) bool {
+	for _, s := range p.Scopes {
+		if scopeRank[s] >= scopeRank[scope] {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator validates a bearer credential.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (*Principal, error)
+}
+
+// Authenticators tries each authenticator in turn.
+type Authenticators []Authenticator
+
+// Authenticate returns the first principal any authenticator accepts.
+func (a Authenticators) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	err := ErrUnauthenticated
+	for _, auth := range a {
+		p, aerr := auth.Authenticate(ctx, token)
+		if aerr == nil {
+			return p, nil
+		}
+		if !errors.Is(aerr, ErrUnauthenticated) {
+			err = aerr
+		}
+	}
+	return nil, err
+}
+
+// APIKey is a static key and the scopes it grants.
+type APIKey struct {
+	Name   string
+	Key    []byte
+	Scopes []string
+	Tenant string
+}
+
+// APIKeys authenticates static API keys.
+type APIKeys []APIKey
+
+// Authenticate compares token against every key in constant time.
+func (keys APIKeys) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	var match *APIKey
+	for i := range keys {
+		if subtle.ConstantTimeCompare([]byte(token), keys[i].Key) == 1 {
+			match = &keys[i]
+		}
+	}
+	if match == nil {
+		return nil, ErrUnauthenticated
+	}
+	return &Principal{Subject: "key:" + match.Name, Scopes: match.Scopes, Tenant: match.Tenant}, nil
+}
+
+// authFile is the format of the --auth file.
+type authFile struct {
+	APIKeys []struct {
+		Name   string   `yaml:"name"`
+		Key    string   `yaml:"key"`
+		Scopes []string `yaml:"scopes"`
+		Tenant string   `yaml:"tenant"`
+	} `yaml:"api_keys"`
+	JWT *JWTAuthenticator `yaml:"jwt"`
+}
+
+// LoadAuthConfig reads an auth file. Keys use the token source syntax so
+// they are never stored inline.
+//
+//	api_keys:
+//	  - name: ci
+//	    key: env:NODEPROP_CI_KEY
+//	    scopes: [trigger]
+//	    tenant: payments
+//	jwt:
+//	  jwks_url: https://issuer.example.com/.well-known/jwks.json
+//	  issuer: https://issuer.example.com/
+//	  audience: nodeprop
+func LoadAuthConfig(ctx context.Context, path string) (Authenticators, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f authFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse auth config %s: %w", path, err)
+	}
+	var auth Authenticators
+	var keys APIKeys
+	for i, k := range f.APIKeys {
+		if k.Name == "" {
+			return nil, fmt.Errorf("%s: api key %d has no name", path, i)
+		}
+		if err := validScopes(k.Scopes); err != nil {
+			return nil, fmt.Errorf("%s: api key %s: %w", path, k.Name, err)
+		}
+		tp, err := flow.ParseTokenSource(k.Key)
+		if err != nil || k.Key == "" {
+			return nil, fmt.Errorf("%s: api key %s: key must be a token source", path, k.Name)
+		}
+		key, err := tp.Token(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: api key %s: %w", path, k.Name, err)
+		}
+		keys = append(keys, APIKey{Name: k.Name, Key: []byte(key), Scopes: k.Scopes, Tenant: k.Tenant})
+	}
+	if len(keys) > 0 {
+		auth = append(auth, keys)
+	}
+	if f.JWT != nil {
+		if f.JWT.JWKSURL == "" {
+			return nil, fmt.Errorf("%s: jwt: jwks_url is required", path)
+		}
+		if f.JWT.Issuer == "" {
+			return nil, fmt.Errorf("%s: jwt: issuer is required", path)
+		}
+		if f.JWT.Audience == "" {
+			return nil, fmt.Errorf("%s: jwt: audience is required", path)
+		}
+		auth = append(auth, f.JWT)
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("%s: no api_keys or jwt configured", path)
+	}
+	return auth, nil
+}
+
+func validScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return errors.New("no scopes")
+	}
+	for _, s := range scopes {
+		if scopeRank[s] == 0 {
+			return fmt.Errorf("unknown scope %q", s)
+		}
+	}
+	return nil
+}
+
+type principalKey struct{}
+
+// PrincipalFromContext returns the caller of an authenticated request.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// subject returns the caller's subject, or "" for unauthenticated requests.
+func subject(ctx context.Context) string {
+	if p, ok := PrincipalFromContext(ctx); ok {
+		return p.Subject
+	}
+	return ""
+}
+
+// bearerToken extracts the credential from an Authorization: Bearer or
+// X-API-Key header.
+func bearerToken(r *http.Request) string {
+	if t, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(t)
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+// authorize wraps next so it only runs for callers holding scope, and with
+// role bindings a role allowing it somewhere, who are within their rate
+// limits. Without an Authenticator every request is let
+// through, limited by the caller's address.
+func (s *Server) authorize(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.Auth == nil {
+			if s.rateLimited(w, "ip:"+remoteHost(r), s.Tenant) {
+				return
+			}
+			next(w, r)
+			return
+		}
+		p, err := s.principal(r.Context(), bearerToken(r), scope)
+		var denied *authError
+		switch {
+		case errors.As(err, &denied) && denied.forbidden:
+			writeError(w, http.StatusForbidden, err.Error())
+		case err != nil:
+			w.Header().Set("WWW-Authenticate", `Bearer realm="nodeprop"`)
+			writeError(w, http.StatusUnauthorized, err.Error())
+		case p.Tenant != "" && s.Tenant != "" && p.Tenant != s.Tenant:
+			writeError(w, http.StatusForbidden, fmt.Sprintf("%s belongs to another tenant", p.Subject))
+		case !s.canAny(p, scope):
+			writeError(w, http.StatusForbidden, fmt.Sprintf("%s has no role allowing %s", p.Subject, scope))
+		case s.rateLimited(w, p.Subject, s.tenantOf(p)):
+		default:
+			next(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+		}
+	}
+}
+
+// tenantOf returns the tenant whose limits p's calls count against: its own,
+// or when it has none the tenant it is calling.
+func (s *Server) tenantOf(p *Principal) string {
+	if p.Tenant != "" {
+		return p.Tenant
+	}
+	return s.Tenant
+}
+
+// rateLimited answers 429 if the client or its tenant is over its limit.
+func (s *Server) rateLimited(w http.ResponseWriter, client, tenant string) bool {
+	if s.RateLimiter == nil {
+		return false
+	}
+	err := s.RateLimiter.Allow(client, tenant)
+	if err == nil {
+		return false
+	}
+	var limited *RateLimitError
+	if errors.As(err, &limited) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limited.RetryAfter.Seconds()))))
+	}
+	writeError(w, http.StatusTooManyRequests, err.Error())
+	return true
+}
+
+// remoteHost is the address of the connecting client, without its port.
+func remoteHost(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// authError is an authentication or authorization failure.
+type authError struct {
+	forbidden bool
+	msg       string
+}
+
+func (e *authError) Error() string { return e.msg }
+
+// principal authenticates token and checks it grants scope.
+func (s *Server) principal(ctx context.Context, token, scope string) (*Principal, error) {
+	if token == "" {
+		return nil, &authError{msg: "missing credentials"}
+	}
+	p, err := s.Auth.Authenticate(ctx, token)
+	if err != nil {
+		if !errors.Is(err, ErrUnauthenticated) {
+			s.logf("auth: %v", err)
+		}
+		return nil, &authError{msg: "invalid credentials"}
+	}
+	if !p.Allows(scope) {
+		return nil, &authError{forbidden: true, msg: fmt.Sprintf("%s lacks the %s scope", p.Subject, scope)}
+	}
+	return p, nil
+}
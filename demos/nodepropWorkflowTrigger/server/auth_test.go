@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadAuthConfig(t *testing.T) {
+	t.Setenv("NODEPROP_TEST_KEY", "secret")
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{name: "api key", config: "api_keys:\n  - name: ci\n    key: env:NODEPROP_TEST_KEY\n    scopes: [trigger]\n"},
+		{name: "jwt", config: "jwt:\n  jwks_url: https://issuer.example.com/jwks.json\n  issuer: https://issuer.example.com/\n  audience: nodeprop\n"},
+		{name: "jwt without jwks_url", config: "jwt:\n  issuer: https://issuer.example.com/\n  audience: nodeprop\n", wantErr: "jwks_url is required"},
+		{name: "jwt without issuer", config: "jwt:\n  jwks_url: https://issuer.example.com/jwks.json\n  audience: nodeprop\n", wantErr: "issuer is required"},
+		{name: "jwt without audience", config: "jwt:\n  jwks_url: https://issuer.example.com/jwks.json\n  issuer: https://issuer.example.com/\n", wantErr: "audience is required"},
+		{name: "inline key", config: "api_keys:\n  - name: ci\n    key: secret\n    scopes: [read]\n", wantErr: "must be a token source"},
+		{name: "unset key", config: "api_keys:\n  - name: ci\n    key: env:NODEPROP_TEST_UNSET\n    scopes: [read]\n", wantErr: "api key ci"},
+		{name: "unnamed key", config: "api_keys:\n  - key: env:NODEPROP_TEST_KEY\n    scopes: [read]\n", wantErr: "has no name"},
+		{name: "no scopes", config: "api_keys:\n  - name: ci\n    key: env:NODEPROP_TEST_KEY\n", wantErr: "no scopes"},
+		{name: "unknown scope", config: "api_keys:\n  - name: ci\n    key: env:NODEPROP_TEST_KEY\n    scopes: [root]\n", wantErr: "unknown scope"},
+		{name: "empty", config: "{}\n", wantErr: "no api_keys or jwt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "auth.yml")
+			if err := os.WriteFile(path, []byte(tt.config), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			auth, err := LoadAuthConfig(context.Background(), path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadAuthConfig() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadAuthConfig() error = %v", err)
+			}
+			if len(auth) != 1 {
+				t.Fatalf("LoadAuthConfig() = %d authenticators, want 1", len(auth))
+			}
+		})
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	keys := Authenticators{APIKeys{
+		{Name: "ci", Key: []byte("ci-key"), Scopes: []string{ScopeTrigger}, Tenant: "payments"},
+		{Name: "ops", Key: []byte("ops-key"), Scopes: []string{ScopeAdmin}},
+	}}
+	tests := []struct {
+		token   string
+		subject string
+		allows  map[string]bool
+	}{
+		{token: "ci-key", subject: "key:ci", allows: map[string]bool{ScopeRead: true, ScopeTrigger: true, ScopeAdmin: false}},
+		{token: "ops-key", subject: "key:ops", allows: map[string]bool{ScopeRead: true, ScopeTrigger: true, ScopeAdmin: true}},
+		{token: "ci-ke"},
+		{token: ""},
+	}
+	for _, tt := range tests {
+		p, err := keys.Authenticate(context.Background(), tt.token)
+		if tt.subject == "" {
+			if !errors.Is(err, ErrUnauthenticated) {
+				t.Errorf("Authenticate(%q) = %+v, %v; want ErrUnauthenticated", tt.token, p, err)
+			}
+			continue
+		}
+		if err != nil || p.Subject != tt.subject {
+			t.Errorf("Authenticate(%q) = %+v, %v; want %s", tt.token, p, err, tt.subject)
+			continue
+		}
+		for scope, want := range tt.allows {
+			if got := p.Allows(scope); got != want {
+				t.Errorf("%s.Allows(%s) = %v, want %v", p.Subject, scope, got, want)
+			}
+		}
+	}
+}
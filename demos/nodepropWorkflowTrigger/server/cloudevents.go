@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// SourceCloudEvents verifies deliveries to /cloudevents.
+const SourceCloudEvents = "cloudevents"
+
+// ceHeaderPrefix marks the attributes of a binary-mode CloudEvent.
+const ceHeaderPrefix = "Ce-"
+
+// handleCloudEvent accepts a CloudEvent in the structured or binary HTTP
+// binding. The event type is the CloudEvent type, and the delivery its
+// source and id, which together are unique. repo, branch, and action come
+// from extension attributes of those names or else from the data's
+// top-level fields. The payload is the event in structured form, so rules
+// match attributes directly and the data under "data".
+func (s *Server) handleCloudEvent(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read body")
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var ce map[string]interface{}
+	switch {
+	case mediaType == "application/cloudevents-batch+json":
+		writeError(w, http.StatusUnsupportedMediaType, "batched CloudEvents are not supported")
+		return
+	case strings.HasPrefix(mediaType, "application/cloudevents"):
+		if err := json.Unmarshal(body, &ce); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid CloudEvent: "+err.Error())
+			return
+		}
+	default:
+		ce = binaryCloudEvent(r.Header, mediaType, body)
+	}
+
+	attr := func(name string) string {
+		v, _ := ce[name].(string)
+		return v
+	}
+	switch attr("specversion") {
+	case "1.0":
+	case "":
+		writeError(w, http.StatusBadRequest, "not a CloudEvent: no specversion")
+		return
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unsupported CloudEvents specversion %q", attr("specversion")))
+		return
+	}
+	for _, name := range []string{"id", "source", "type"} {
+		if attr(name) == "" {
+			writeError(w, http.StatusBadRequest, "CloudEvent has no "+name)
+			return
+		}
+	}
+	data, _ := ce["data"].(map[string]interface{})
+	field := func(name string) string {
+		if v := attr(name); v != "" {
+			return v
+		}
+		v, _ := data[name].(string)
+		return v
+	}
+	s.route(w, r, flow.InboundEvent{
+		Type:     attr("type"),
+		Action:   field("action"),
+		Repo:     field("repo"),
+		Branch:   field("branch"),
+		Delivery: attr("source") + "/" + attr("id"),
+		Payload:  ce,
+	})
+}
+
+// binaryCloudEvent assembles the structured form of a binary-mode event:
+// attributes from the ce- headers, datacontenttype from Content-Type, and
+// the body as data, decoded if it is JSON.
+func binaryCloudEvent(h http.Header, mediaType string, body []byte) map[string]interface{} {
+	ce := map[string]interface{}{}
+	for name, values := range h {
+		if attr, ok := strings.CutPrefix(name, ceHeaderPrefix); ok && len(values) > 0 {
+			ce[strings.ToLower(attr)] = values[0]
+		}
+	}
+	if ct := h.Get("Content-Type"); ct != "" {
+		ce["datacontenttype"] = ct
+	}
+	if len(body) == 0 {
+		return ce
+	}
+	var data interface{}
+	switch {
+	case (mediaType == "" || mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")) && json.Unmarshal(body, &data) == nil:
+		ce["data"] = data
+	case utf8.Valid(body):
+		ce["data"] = string(body)
+	default:
+		ce["data_base64"] = base64.StdEncoding.EncodeToString(body)
+	}
+	return ce
+}
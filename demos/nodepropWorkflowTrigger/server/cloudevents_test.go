@@ -0,0 +1,126 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+func TestCloudEvents(t *testing.T) {
+	structured := `{"specversion": "1.0", "id": "e-1", "source": "/ci", "type": "com.example.built", "data": {"repo": "Cdaprod/site", "branch": "main", "sha": "abc123"}}`
+	binary := map[string]string{
+		"Content-Type":   "application/json",
+		"Ce-Specversion": "1.0",
+		"Ce-Id":          "e-1",
+		"Ce-Source":      "/ci",
+		"Ce-Type":        "com.example.built",
+	}
+	with := func(h map[string]string, k, v string) map[string]string {
+		out := map[string]string{k: v}
+		for name, value := range h {
+			if name != k {
+				out[name] = value
+			}
+		}
+		return out
+	}
+	tests := []struct {
+		name       string
+		body       string
+		header     map[string]string
+		wantStatus int
+		wantInputs map[string]string
+	}{
+		{
+			name: "structured", body: structured,
+			header:     map[string]string{"Content-Type": "application/cloudevents+json; charset=utf-8"},
+			wantStatus: http.StatusAccepted, wantInputs: map[string]string{"sha": "abc123", "delivery": "/ci/e-1"},
+		},
+		{
+			name: "binary", body: `{"repo": "Cdaprod/site", "branch": "main", "sha": "abc123"}`, header: binary,
+			wantStatus: http.StatusAccepted, wantInputs: map[string]string{"sha": "abc123", "delivery": "/ci/e-1"},
+		},
+		{
+			name: "binary with extensions", body: `{"sha": "def456"}`,
+			header:     with(with(binary, "Ce-Repo", "Cdaprod/site"), "Ce-Branch", "main"),
+			wantStatus: http.StatusAccepted, wantInputs: map[string]string{"sha": "def456", "delivery": "/ci/e-1"},
+		},
+		{name: "other type", body: `{"repo": "Cdaprod/site"}`, header: with(binary, "Ce-Type", "com.example.tested"), wantStatus: http.StatusNoContent},
+		{name: "batch", body: "[" + structured + "]", header: map[string]string{"Content-Type": "application/cloudevents-batch+json"}, wantStatus: http.StatusUnsupportedMediaType},
+		{name: "invalid structured", body: `{`, header: map[string]string{"Content-Type": "application/cloudevents+json"}, wantStatus: http.StatusBadRequest},
+		{name: "not a CloudEvent", body: `{"repo": "Cdaprod/site"}`, header: map[string]string{"Content-Type": "application/json"}, wantStatus: http.StatusBadRequest},
+		{name: "unsupported version", body: `{}`, header: with(binary, "Ce-Specversion", "0.3"), wantStatus: http.StatusBadRequest},
+		{name: "no id", body: `{}`, header: with(binary, "Ce-Id", ""), wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, gh := newTestServer(t)
+			s.AllowUnsigned = true
+			s.Router = &flow.EventRouter{Rules: []flow.RoutingRule{{
+				Name:   "built",
+				Events: []string{"com.example.built"},
+				Branch: "main",
+				Targets: []flow.BatchTarget{{Repo: flow.SourceRepo, Workflow: "deploy.yml", Inputs: map[string]string{
+					"sha":      "${payload.data.sha}",
+					"delivery": "${event.delivery}",
+				}}},
+			}}}
+
+			w := serve(s, "POST", "/cloudevents", tt.body, tt.header)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			// The same source and id is a redelivery.
+			serve(s, "POST", "/cloudevents", tt.body, tt.header)
+			s.background.Wait()
+
+			ds := gh.Dispatches()
+			if tt.wantInputs == nil {
+				if len(ds) != 0 {
+					t.Errorf("dispatched %+v, want nothing", ds)
+				}
+				return
+			}
+			if len(ds) != 1 || ds[0].Inputs["sha"] != tt.wantInputs["sha"] || ds[0].Inputs["delivery"] != tt.wantInputs["delivery"] {
+				t.Errorf("dispatches = %+v, want one with inputs %v", ds, tt.wantInputs)
+			}
+		})
+	}
+}
+
+func TestBinaryCloudEventData(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		key         string
+		want        interface{}
+	}{
+		{name: "json", contentType: "application/json", body: `{"a": "b"}`, key: "data", want: map[string]interface{}{"a": "b"}},
+		{name: "json suffix", contentType: "application/vnd.example+json", body: `"s"`, key: "data", want: "s"},
+		{name: "invalid json", contentType: "application/json", body: `{`, key: "data", want: "{"},
+		{name: "text", contentType: "text/plain", body: "hello", key: "data", want: "hello"},
+		{name: "binary", contentType: "application/octet-stream", body: "\xff\x00", key: "data_base64", want: "/wA="},
+		{name: "empty", contentType: "text/plain", key: "data"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{"Content-Type": {tt.contentType}, "Ce-Id": {"e-1"}}
+			ce := binaryCloudEvent(h, tt.contentType, []byte(tt.body))
+			if ce["id"] != "e-1" || ce["datacontenttype"] != tt.contentType {
+				t.Errorf("attributes = %v", ce)
+			}
+			got := ce[tt.key]
+			if m, ok := tt.want.(map[string]interface{}); ok {
+				if gm, ok := got.(map[string]interface{}); !ok || gm["a"] != m["a"] {
+					t.Errorf("%s = %#v, want %#v", tt.key, got, tt.want)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("%s = %#v, want %#v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// correlated serves each request under the correlation ID in its
+// X-Correlation-ID header, or under a new one if it has none or one that
+// is not flow.ValidCorrelationID, and returns the ID in the response.
+func correlated(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(flow.CorrelationHeader)
+		if !flow.ValidCorrelationID(id) {
+			var err error
+			if id, err = flow.NewCorrelationID(); err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+		}
+		w.Header().Set(flow.CorrelationHeader, id)
+		h.ServeHTTP(w, r.WithContext(flow.WithCorrelationID(r.Context(), id)))
+	})
+}
+
+// unaryCorrelation is the gRPC counterpart of correlated, using the
+// x-correlation-id metadata entry.
+func unaryCorrelation(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	key := strings.ToLower(flow.CorrelationHeader)
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(key); len(v) > 0 && flow.ValidCorrelationID(v[0]) {
+			id = v[0]
+		}
+	}
+	if id == "" {
+		var err error
+		if id, err = flow.NewCorrelationID(); err != nil {
+			return nil, err
+		}
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(key, id))
+	return handler(flow.WithCorrelationID(ctx, id), req)
+}
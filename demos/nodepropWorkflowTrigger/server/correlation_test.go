@@ -0,0 +1,83 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+func TestCorrelatedHTTP(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{name: "generated"},
+		{name: "accepted", header: "rollout-42", want: "rollout-42"},
+		{name: "invalid replaced", header: "bad id\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+			var header map[string]string
+			if tt.header != "" {
+				header = map[string]string{flow.CorrelationHeader: tt.header}
+			}
+			w := serve(s, "POST", "/v1/triggers", `{"repo": "Cdaprod/site", "workflow": "deploy.yml"}`, header)
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			id := w.Header().Get(flow.CorrelationHeader)
+			if !flow.ValidCorrelationID(id) || tt.want != "" && id != tt.want {
+				t.Errorf("%s = %q, want %q", flow.CorrelationHeader, id, tt.want)
+			}
+			var rec flow.DispatchRecord
+			if err := json.Unmarshal(w.Body.Bytes(), &rec); err != nil || rec.CorrelationID != id {
+				t.Errorf("record correlation ID = %q, want the response's %q", rec.CorrelationID, id)
+			}
+		})
+	}
+}
+
+func TestCorrelatedGRPC(t *testing.T) {
+	tests := []struct {
+		name string
+		md   string
+		want string
+	}{
+		{name: "generated"},
+		{name: "accepted", md: "rollout-42", want: "rollout-42"},
+		{name: "invalid replaced", md: "bad id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, gh := newTestServer(t)
+			s.Auth = APIKeys{{Name: "ci", Key: []byte("key"), Scopes: []string{ScopeRead, ScopeTrigger}}}
+			conn := dialGRPC(t, s)
+			ctx := withToken("key")
+			if tt.md != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, "x-correlation-id", tt.md)
+			}
+			var md metadata.MD
+			out := dynamicpb.NewMessage(triggerMessage("Trigger"))
+			in := message("CreateTriggerRequest", map[string]string{"repo": "Cdaprod/site", "workflow": "deploy.yml"})
+			if err := conn.Invoke(ctx, "/"+triggerServiceName+"/CreateTrigger", in, out, grpc.Header(&md)); err != nil {
+				t.Fatal(err)
+			}
+			ids := md.Get("x-correlation-id")
+			if len(ids) != 1 || !flow.ValidCorrelationID(ids[0]) || tt.want != "" && ids[0] != tt.want {
+				t.Fatalf("x-correlation-id = %v, want %q", ids, tt.want)
+			}
+			recs, err := flow.QueryHistory(s.Correlator.History, flow.HistoryQuery{CorrelationID: ids[0]})
+			if err != nil || len(recs) != 1 || len(gh.Dispatches()) != 1 {
+				t.Errorf("history for %q = %+v, %v; want the dispatch", ids[0], recs, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// ReplayResponse is the body of POST /v1/deadletters/{id}/replay.
+type ReplayResponse struct {
+	DeadLetter flow.DeadLetter     `json:"dead_letter"`
+	Dispatch   flow.DispatchRecord `json:"dispatch"`
+}
+
+func (s *Server) deadLetterRoutes() {
+	s.mux.HandleFunc("GET /v1/deadletters", s.authorize(ScopeRead, s.handleListDeadLetters))
+	s.mux.HandleFunc("GET /v1/deadletters/{id}", s.authorize(ScopeRead, s.handleGetDeadLetter))
+	s.mux.HandleFunc("POST /v1/deadletters/{id}/replay", s.authorize(ScopeTrigger, s.signed(SourceAPI, true, s.handleReplayDeadLetter)))
+	s.mux.HandleFunc("DELETE /v1/deadletters/{id}", s.authorize(ScopeAdmin, s.handleDeleteDeadLetter))
+}
+
+// handleListDeadLetters lists pending dead letters, optionally for one
+// repo; ?all=true includes those already replayed.
+func (s *Server) handleListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if !s.hasDeadLetters(w) {
+		return
+	}
+	all, err := s.Correlator.DeadLetters.List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	repo, withReplayed := r.URL.Query().Get("repo"), r.URL.Query().Get("all") == "true"
+	out := []flow.DeadLetter{}
+	for _, d := range all {
+		if (repo == "" || d.Repo == repo) && (withReplayed || d.Pending()) && s.can(r.Context(), ScopeRead, d.Repo) {
+			out = append(out, s.redactDeadLetter(d))
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) handleGetDeadLetter(w http.ResponseWriter, r *http.Request) {
+	if d, ok := s.findDeadLetter(w, r, r.PathValue("id"), ScopeRead); ok {
+		writeJSON(w, http.StatusOK, s.redactDeadLetter(d))
+	}
+}
+
+// handleReplayDeadLetter dispatches a dead letter again. It answers 202
+// with the new dispatch, 200 if it was already replayed, or 502 if GitHub
+// rejected it again.
+func (s *Server) handleReplayDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, ok := s.findDeadLetter(w, r, id, ScopeTrigger); !ok {
+		return
+	}
+	rec, err := s.Correlator.ReplayDeadLetter(r.Context(), id)
+	if err != nil && !errors.Is(err, flow.ErrAlreadyDispatched) {
+		s.logf("api: replay dead letter %s: %v", id, err)
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	d, _, derr := flow.FindDeadLetter(s.Correlator.DeadLetters, id)
+	if derr != nil {
+		writeError(w, http.StatusInternalServerError, derr.Error())
+		return
+	}
+	status := http.StatusAccepted
+	if err != nil {
+		status = http.StatusOK
+	} else {
+		w.Header().Set("Location", "/v1/triggers/"+rec.ID)
+	}
+	writeJSON(w, status, ReplayResponse{DeadLetter: s.redactDeadLetter(d), Dispatch: *rec})
+}
+
+// redactDeadLetter hides the secret inputs the dead-letter store keeps, so
+// that the dispatch can be replayed.
+func (s *Server) redactDeadLetter(d flow.DeadLetter) flow.DeadLetter {
+	d.Inputs = s.Correlator.RedactInputs(d.Inputs)
+	return d
+}
+
+func (s *Server) handleDeleteDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, ok := s.findDeadLetter(w, r, id, ScopeAdmin); !ok {
+		return
+	}
+	if err := s.Correlator.DeadLetters.Remove(id); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// findDeadLetter looks up a dead letter, writing a 404 or 500 if it cannot,
+// or a 403 if the caller lacks the role scope requires in its repository.
+func (s *Server) findDeadLetter(w http.ResponseWriter, r *http.Request, id, scope string) (flow.DeadLetter, bool) {
+	if !s.hasDeadLetters(w) {
+		return flow.DeadLetter{}, false
+	}
+	d, ok, err := flow.FindDeadLetter(s.Correlator.DeadLetters, id)
+	switch {
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	case !ok:
+		writeError(w, http.StatusNotFound, "dead letter "+id+" not found")
+	case !s.can(r.Context(), scope, d.Repo):
+		forbidden(w, r, scope, d.Repo)
+		return d, false
+	}
+	return d, err == nil && ok
+}
+
+func (s *Server) hasDeadLetters(w http.ResponseWriter) bool {
+	if s.Correlator.DeadLetters == nil {
+		writeError(w, http.StatusNotFound, "no dead-letter queue is configured")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+func TestDeadLetters(t *testing.T) {
+	s, gh := newTestServer(t)
+	if w := serve(s, "GET", "/v1/deadletters", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("list without a store status = %d, want 404", w.Code)
+	}
+	store := flow.NewFileDeadLetterStore(filepath.Join(t.TempDir(), "deadletters.json"))
+	s.Correlator.DeadLetters = store
+	s.Correlator.SecretInputs = []string{"token"}
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, d := range []flow.DeadLetter{
+		{ID: "dl-1", Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "main", Inputs: map[string]string{"token": "hunter2"}, FailedAt: at},
+		{ID: "dl-2", Repo: "Cdaprod/other", Workflow: "ci.yml", Ref: "main", FailedAt: at.Add(time.Minute)},
+		{ID: "dl-3", Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "main", FailedAt: at, ReplayedAs: "d-9"},
+	} {
+		store.Add(d)
+	}
+
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{path: "/v1/deadletters", want: []string{"dl-2", "dl-1"}},
+		{path: "/v1/deadletters?repo=Cdaprod/site", want: []string{"dl-1"}},
+		{path: "/v1/deadletters?repo=Cdaprod/site&all=true", want: []string{"dl-1", "dl-3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := serve(s, "GET", tt.path, "", nil)
+			var got []flow.DeadLetter
+			json.NewDecoder(w.Body).Decode(&got)
+			var ids []string
+			for _, d := range got {
+				ids = append(ids, d.ID)
+			}
+			if w.Code != http.StatusOK || !slices.Equal(ids, tt.want) {
+				t.Errorf("list = %d %v, want %v", w.Code, ids, tt.want)
+			}
+		})
+	}
+
+	w := serve(s, "GET", "/v1/deadletters/dl-1", "", nil)
+	var d flow.DeadLetter
+	json.NewDecoder(w.Body).Decode(&d)
+	if w.Code != http.StatusOK || d.Inputs["token"] == "hunter2" {
+		t.Errorf("get = %d %+v, want the secret input redacted", w.Code, d)
+	}
+	if w := serve(s, "GET", "/v1/deadletters/missing", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("get missing status = %d, want 404", w.Code)
+	}
+
+	gh.Inject(nodeproptest.Fault{Method: "POST", Path: "/repos/*/*/actions/workflows/*/dispatches", Status: 422, Times: 1})
+	if w := serve(s, "POST", "/v1/deadletters/dl-1/replay", "", nil); w.Code != http.StatusBadGateway {
+		t.Errorf("rejected replay status = %d, want 502", w.Code)
+	}
+	w = serve(s, "POST", "/v1/deadletters/dl-1/replay", "", nil)
+	var replay ReplayResponse
+	json.NewDecoder(w.Body).Decode(&replay)
+	if w.Code != http.StatusAccepted || w.Header().Get("Location") != "/v1/triggers/"+replay.Dispatch.ID || replay.DeadLetter.ReplayedAs != replay.Dispatch.ID {
+		t.Errorf("replay = %d %+v", w.Code, replay)
+	}
+	if ds := gh.Dispatches(); len(ds) != 1 || ds[0].Inputs["token"] != "hunter2" {
+		t.Errorf("dispatches = %+v, want the original inputs sent", ds)
+	}
+	if w := serve(s, "POST", "/v1/deadletters/dl-1/replay", "", nil); w.Code != http.StatusOK {
+		t.Errorf("second replay status = %d, want 200", w.Code)
+	}
+
+	if w := serve(s, "DELETE", "/v1/deadletters/dl-2", "", nil); w.Code != http.StatusNoContent {
+		t.Errorf("delete status = %d, want 204", w.Code)
+	}
+	if w := serve(s, "DELETE", "/v1/deadletters/dl-2", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("second delete status = %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// streamBuffer is the number of events buffered per subscriber; a client
+// that falls further behind misses events.
+const streamBuffer = 256
+
+// keepaliveInterval is how often an idle SSE stream sends a comment so
+// proxies do not close it.
+const keepaliveInterval = 15 * time.Second
+
+// eventFilter selects the events sent to one stream.
+type eventFilter struct {
+	repo  string
+	id    string
+	types map[flow.EventType]bool
+	// visible reports whether the caller may view a repository's events.
+	visible func(repo string) bool
+}
+
+func (s *Server) parseEventFilter(r *http.Request) eventFilter {
+	q := r.URL.Query()
+	ctx := r.Context()
+	f := eventFilter{repo: q.Get("repo"), id: q.Get("dispatch_id"), visible: func(repo string) bool {
+		return s.can(ctx, ScopeRead, repo)
+	}}
+	if types := q.Get("types"); types != "" {
+		f.types = map[flow.EventType]bool{}
+		for _, t := range strings.Split(types, ",") {
+			f.types[flow.EventType(strings.TrimSpace(t))] = true
+		}
+	}
+	return f
+}
+
+func (f eventFilter) match(e flow.Event) bool {
+	return (f.repo == "" || e.Repo == f.repo) &&
+		(f.id == "" || e.DispatchID == f.id) &&
+		(f.types == nil || f.types[e.Type]) &&
+		f.visible(e.Repo)
+}
+
+// handleEvents streams dispatch lifecycle events as they happen. Clients
+// that send a WebSocket upgrade receive one JSON event per message; others
+// get a text/event-stream. ?repo=, ?dispatch_id=, and ?types=a,b filter
+// the stream.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if s.Correlator.Events == nil {
+		writeError(w, http.StatusServiceUnavailable, "event streaming is not enabled")
+		return
+	}
+	filter := s.parseEventFilter(r)
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		wss := websocket.Server{
+			// Browsers send an Origin that need not match; access is
+			// controlled by the API's authentication instead.
+			Handshake: func(*websocket.Config, *http.Request) error { return nil },
+			Handler:   func(ws *websocket.Conn) { s.streamWebSocket(ws, filter) },
+		}
+		wss.ServeHTTP(w, r)
+		return
+	}
+	s.streamSSE(w, r, filter)
+}
+
+func (s *Server) streamSSE(w http.ResponseWriter, r *http.Request, filter eventFilter) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	events, unsubscribe := s.Correlator.Events.Subscribe(streamBuffer)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(keepaliveInterval)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.closing:
+			return
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case e := <-events:
+			if !filter.match(e) {
+				continue
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+		}
+		flusher.Flush()
+	}
+}
+
+func (s *Server) streamWebSocket(ws *websocket.Conn, filter eventFilter) {
+	defer ws.Close()
+	events, unsubscribe := s.Correlator.Events.Subscribe(streamBuffer)
+	defer unsubscribe()
+
+	// The stream is one-way; reading only detects the client going away.
+	ctx, cancel := context.WithCancel(ws.Request().Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		var discard []byte
+		for websocket.Message.Receive(ws, &discard) == nil {
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.closing:
+			return
+		case e := <-events:
+			if !filter.match(e) {
+				continue
+			}
+			if err := websocket.JSON.Send(ws, e); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+func TestEventFilter(t *testing.T) {
+	visible := func(repo string) bool { return repo != "Cdaprod/secret" }
+	e := flow.Event{Type: flow.EventDispatched, Repo: "Cdaprod/site", DispatchID: "d-1"}
+	tests := []struct {
+		name   string
+		filter eventFilter
+		e      flow.Event
+		want   bool
+	}{
+		{name: "no filter", filter: eventFilter{visible: visible}, e: e, want: true},
+		{name: "repo", filter: eventFilter{repo: "Cdaprod/site", visible: visible}, e: e, want: true},
+		{name: "other repo", filter: eventFilter{repo: "Cdaprod/api", visible: visible}, e: e},
+		{name: "dispatch", filter: eventFilter{id: "d-1", visible: visible}, e: e, want: true},
+		{name: "other dispatch", filter: eventFilter{id: "d-2", visible: visible}, e: e},
+		{name: "types", filter: eventFilter{types: map[flow.EventType]bool{flow.EventDispatched: true}, visible: visible}, e: e, want: true},
+		{name: "other types", filter: eventFilter{types: map[flow.EventType]bool{flow.EventFailed: true}, visible: visible}, e: e},
+		{name: "not visible", filter: eventFilter{visible: visible}, e: flow.Event{Type: flow.EventDispatched, Repo: "Cdaprod/secret"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.match(tt.e); got != tt.want {
+				t.Errorf("match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventStreamSSE(t *testing.T) {
+	s, _ := newTestServer(t)
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/v1/events?repo=Cdaprod/site&types=dispatched,failed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	// The stream is subscribed once its headers are sent.
+	bus := s.Correlator.Events
+	bus.Publish(flow.Event{Type: flow.EventQueued, Repo: "Cdaprod/site"})
+	bus.Publish(flow.Event{Type: flow.EventDispatched, Repo: "Cdaprod/api"})
+	bus.Publish(flow.Event{Type: flow.EventDispatched, Repo: "Cdaprod/site", DispatchID: "d-1"})
+
+	sc := bufio.NewScanner(resp.Body)
+	var lines []string
+	for sc.Scan() && len(lines) < 2 {
+		if sc.Text() != "" {
+			lines = append(lines, sc.Text())
+		}
+	}
+	if len(lines) != 2 || lines[0] != "event: dispatched" {
+		t.Fatalf("stream = %q, want the one matching event", lines)
+	}
+	var e flow.Event
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &e); err != nil || e.DispatchID != "d-1" {
+		t.Errorf("data = %q, want dispatch d-1", lines[1])
+	}
+}
+
+func TestEventStreamWebSocket(t *testing.T) {
+	s, _ := newTestServer(t)
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/v1/events?dispatch_id=d-1", "", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	// The subscription starts after the handshake, so publish until the
+	// event arrives.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		tick := time.NewTicker(10 * time.Millisecond)
+		defer tick.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-tick.C:
+				s.Correlator.Events.Publish(flow.Event{Type: flow.EventDispatched, Repo: "Cdaprod/site", DispatchID: "d-2"})
+				s.Correlator.Events.Publish(flow.Event{Type: flow.EventRunCompleted, Repo: "Cdaprod/site", DispatchID: "d-1"})
+			}
+		}
+	}()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var e flow.Event
+	if err := websocket.JSON.Receive(ws, &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.DispatchID != "d-1" || e.Type != flow.EventRunCompleted {
+		t.Errorf("received %+v, want d-1's completion", e)
+	}
+}
@@ -0,0 +1,327 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// watchInterval is how often WatchTrigger polls GitHub for run changes.
+const watchInterval = 5 * time.Second
+
+// triggerServiceName is the full name of the gRPC TriggerService.
+const triggerServiceName = triggerProtoPackage + ".TriggerService"
+
+// triggerService is the handler type of triggerServiceDesc.
+type triggerService interface {
+	grpcCreateTrigger(ctx context.Context, in *dynamicpb.Message) (proto.Message, error)
+	grpcGetTrigger(ctx context.Context, in *dynamicpb.Message) (proto.Message, error)
+	grpcListTriggers(ctx context.Context, in *dynamicpb.Message) (proto.Message, error)
+	grpcWatchTrigger(in *dynamicpb.Message, stream grpc.ServerStream) error
+}
+
+var triggerServiceDesc = grpc.ServiceDesc{
+	ServiceName: triggerServiceName,
+	HandlerType: (*triggerService)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "CreateTrigger", Handler: unaryHandler("CreateTrigger", "CreateTriggerRequest", triggerService.grpcCreateTrigger)},
+		{MethodName: "GetTrigger", Handler: unaryHandler("GetTrigger", "GetTriggerRequest", triggerService.grpcGetTrigger)},
+		{MethodName: "ListTriggers", Handler: unaryHandler("ListTriggers", "ListTriggersRequest", triggerService.grpcListTriggers)},
+	},
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "WatchTrigger",
+		ServerStreams: true,
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			in := dynamicpb.NewMessage(triggerMessage("WatchTriggerRequest"))
+			if err := stream.RecvMsg(in); err != nil {
+				return err
+			}
+			return srv.(triggerService).grpcWatchTrigger(in, stream)
+		},
+	}},
+	Metadata: "nodeprop/trigger/v1/trigger.proto",
+}
+
+// unaryHandler adapts a triggerService method to a grpc.MethodHandler that
+// decodes requests of the named message type.
+func unaryHandler(method, request string, call func(triggerService, context.Context, *dynamicpb.Message) (proto.Message, error)) grpc.MethodHandler {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		in := dynamicpb.NewMessage(triggerMessage(request))
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return call(srv.(triggerService), ctx, in)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + triggerServiceName + "/" + method}
+		return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return call(srv.(triggerService), ctx, req.(*dynamicpb.Message))
+		})
+	}
+}
+
+// NewGRPCServer returns a gRPC server exposing the TriggerService and server
+// reflection. Every call must carry a bearer token accepted by Auth with
+// the method's scope. opts may add TLS credentials.
+func (s *Server) NewGRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	s.shareWithTenants()
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(s.unaryAuth, unaryCorrelation),
+		grpc.ChainStreamInterceptor(s.streamAuth),
+	)
+	g := grpc.NewServer(opts...)
+	g.RegisterService(&triggerServiceDesc, s)
+	// The descriptors are not in the global registry, so reflection is
+	// pointed at triggerFiles.
+	reflectionpb.RegisterServerReflectionServer(g, reflection.NewServerV1(reflection.ServerOptions{
+		Services:           g,
+		DescriptorResolver: triggerFiles,
+	}))
+	return g
+}
+
+// ServeGRPC serves g on ln until ctx is cancelled, then stops gracefully.
+func (s *Server) ServeGRPC(ctx context.Context, g *grpc.Server, ln net.Listener) error {
+	errc := make(chan error, 1)
+	go func() { errc <- g.Serve(ln) }()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	stopped := make(chan struct{})
+	go func() {
+		g.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(shutdownTimeout):
+		g.Stop()
+	}
+	return nil
+}
+
+// grpcScopes is the scope each TriggerService method requires; methods not
+// listed, including reflection, require ScopeRead.
+var grpcScopes = map[string]string{
+	"/" + triggerServiceName + "/CreateTrigger": ScopeTrigger,
+}
+
+func (s *Server) unaryAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := s.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) streamAuth(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, authedStream{ss, ctx})
+}
+
+// authedStream carries the caller in its context.
+type authedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s authedStream) Context() context.Context { return s.ctx }
+
+// authenticate checks the call's bearer token with Auth and returns a
+// context carrying the caller.
+func (s *Server) authenticate(ctx context.Context, method string) (context.Context, error) {
+	if s.Auth == nil {
+		return nil, status.Error(codes.Unauthenticated, "authentication is not configured")
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	var token string
+	for _, v := range md.Get("authorization") {
+		if t, ok := strings.CutPrefix(v, "Bearer "); ok {
+			token = t
+		}
+	}
+	scope := grpcScopes[method]
+	if scope == "" {
+		scope = ScopeRead
+	}
+	p, err := s.principal(ctx, token, scope)
+	var denied *authError
+	switch {
+	case errors.As(err, &denied) && denied.forbidden:
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if s.RateLimiter != nil {
+		if err := s.RateLimiter.Allow(p.Subject, p.Tenant); err != nil {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+	}
+	// Calls are served by the caller's tenant, if it has one.
+	srv := s
+	if t, ok := s.tenants[p.Tenant]; ok {
+		ctx, srv = context.WithValue(ctx, tenantKey{}, t), t
+	}
+	if !srv.canAny(p, scope) {
+		return nil, status.Errorf(codes.PermissionDenied, "%s has no role allowing %s", p.Subject, scope)
+	}
+	return context.WithValue(ctx, principalKey{}, p), nil
+}
+
+func (s *Server) grpcCreateTrigger(ctx context.Context, in *dynamicpb.Message) (proto.Message, error) {
+	var req TriggerRequest
+	if err := fromMessage(in, &req); err != nil {
+		return nil, err
+	}
+	rec, err := s.forCall(ctx).submitTrigger(ctx, req)
+	if err != nil && !errors.Is(err, flow.ErrAlreadyDispatched) {
+		return nil, grpcError(err)
+	}
+	return toMessage("Trigger", rec)
+}
+
+func (s *Server) grpcGetTrigger(ctx context.Context, in *dynamicpb.Message) (proto.Message, error) {
+	id := in.Get(in.Descriptor().Fields().ByName("id")).String()
+	t := s.forCall(ctx)
+	rec, ok, err := t.findTrigger(ctx, id)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "trigger %s not found", id)
+	}
+	if !t.can(ctx, ScopeRead, rec.Repo) {
+		return nil, status.Error(codes.PermissionDenied, roleError(ctx, ScopeRead, rec.Repo).Error())
+	}
+	return toMessage("Trigger", rec)
+}
+
+func (s *Server) grpcListTriggers(ctx context.Context, in *dynamicpb.Message) (proto.Message, error) {
+	repo := in.Get(in.Descriptor().Fields().ByName("repo")).String()
+	t := s.forCall(ctx)
+	recs, err := t.Correlator.History.List(repo)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return toMessage("ListTriggersResponse", struct {
+		Triggers []flow.DispatchRecord `json:"triggers"`
+	}{t.visibleRecords(ctx, recs)})
+}
+
+// grpcWatchTrigger sends the dispatch, then again whenever its run changes,
+// until the run completes or the client goes away.
+func (s *Server) grpcWatchTrigger(in *dynamicpb.Message, stream grpc.ServerStream) error {
+	ctx := stream.Context()
+	id := in.Get(in.Descriptor().Fields().ByName("id")).String()
+	var last flow.DispatchRecord
+	t := s.forCall(ctx)
+	for first := true; ; first = false {
+		rec, ok, err := t.findTrigger(ctx, id)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		if !ok {
+			return status.Errorf(codes.NotFound, "trigger %s not found", id)
+		}
+		if first && !t.can(ctx, ScopeRead, rec.Repo) {
+			return status.Error(codes.PermissionDenied, roleError(ctx, ScopeRead, rec.Repo).Error())
+		}
+		if first || rec.RunID != last.RunID || rec.Status != last.Status || rec.Conclusion != last.Conclusion {
+			m, err := toMessage("Trigger", rec)
+			if err != nil {
+				return err
+			}
+			if err := stream.SendMsg(m); err != nil {
+				return err
+			}
+			last = rec
+		}
+		if rec.Completed() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(watchInterval):
+		}
+	}
+}
+
+// grpcError maps a trigger error to a gRPC status.
+func grpcError(err error) error {
+	var rejected *requestError
+	if errors.As(err, &rejected) {
+		if rejected.status == http.StatusForbidden {
+			return status.Error(codes.PermissionDenied, rejected.msg)
+		}
+		return status.Error(codes.InvalidArgument, rejected.msg)
+	}
+	// A held dispatch has no trigger yet; the message names its approval.
+	var held *flow.ApprovalRequiredError
+	if errors.As(err, &held) {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if errors.Is(err, flow.ErrPolicyDenied) {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	var apiErr *flow.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusNotFound:
+			return status.Error(codes.NotFound, err.Error())
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return status.Error(codes.PermissionDenied, err.Error())
+		case http.StatusUnprocessableEntity:
+			return status.Error(codes.FailedPrecondition, err.Error())
+		}
+	}
+	return status.Error(codes.Unavailable, err.Error())
+}
+
+// toMessage converts v to the named message through its JSON form, which
+// uses the proto field names.
+func toMessage(name string, v interface{}) (proto.Message, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	m := dynamicpb.NewMessage(triggerMessage(name))
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(data, m); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return m, nil
+}
+
+// fromMessage converts m into v, the inverse of toMessage.
+func fromMessage(m proto.Message, v interface{}) error {
+	data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(m)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return nil
+}
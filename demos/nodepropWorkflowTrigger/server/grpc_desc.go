@@ -0,0 +1,166 @@
+package server
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// triggerProtoPackage is the package of proto/nodeprop/trigger/v1/trigger.proto.
+const triggerProtoPackage = "nodeprop.trigger.v1"
+
+// triggerFiles holds the TriggerService file descriptor. It is built here
+// rather than generated so the service needs no protoc step; it must be kept
+// in sync with trigger.proto by hand.
+var triggerFiles = func() *protoregistry.Files {
+	fd, err := protodesc.NewFile(triggerFileProto(), protoregistry.GlobalFiles)
+	if err != nil {
+		panic(fmt.Sprintf("trigger.proto descriptor: %v", err))
+	}
+	files := new(protoregistry.Files)
+	if err := files.RegisterFile(fd); err != nil {
+		panic(err)
+	}
+	return files
+}()
+
+// triggerMessage returns the descriptor of a TriggerService message.
+func triggerMessage(name string) protoreflect.MessageDescriptor {
+	d, err := triggerFiles.FindDescriptorByName(protoreflect.FullName(triggerProtoPackage + "." + name))
+	if err != nil {
+		panic(err)
+	}
+	return d.(protoreflect.MessageDescriptor)
+}
+
+func triggerFileProto() *descriptorpb.FileDescriptorProto {
+	str := descriptorpb.FieldDescriptorProto_TYPE_STRING
+	return &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("nodeprop/trigger/v1/trigger.proto"),
+		Package: proto.String(triggerProtoPackage),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("CreateTriggerRequest"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("repo", 1, str),
+					field("workflow", 2, str),
+					field("ref", 3, str),
+					mapField("CreateTriggerRequest", "inputs", 4),
+					field("idempotency_key", 5, str),
+				},
+				NestedType: []*descriptorpb.DescriptorProto{mapEntry("inputs")},
+			},
+			{Name: proto.String("GetTriggerRequest"), Field: []*descriptorpb.FieldDescriptorProto{field("id", 1, str)}},
+			{Name: proto.String("ListTriggersRequest"), Field: []*descriptorpb.FieldDescriptorProto{field("repo", 1, str)}},
+			{
+				Name: proto.String("ListTriggersResponse"),
+				Field: []*descriptorpb.FieldDescriptorProto{{
+					Name:     proto.String("triggers"),
+					JsonName: proto.String("triggers"),
+					Number:   proto.Int32(1),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum(),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+					TypeName: proto.String("." + triggerProtoPackage + ".Trigger"),
+				}},
+			},
+			{Name: proto.String("WatchTriggerRequest"), Field: []*descriptorpb.FieldDescriptorProto{field("id", 1, str)}},
+			{
+				Name: proto.String("Trigger"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("id", 1, str),
+					field("repo", 2, str),
+					field("workflow", 3, str),
+					field("ref", 4, str),
+					mapField("Trigger", "inputs", 5),
+					field("dispatched_at", 6, str),
+					field("run_id", 7, descriptorpb.FieldDescriptorProto_TYPE_INT64),
+					field("run_url", 8, str),
+					field("status", 9, str),
+					field("conclusion", 10, str),
+					field("updated_at", 11, str),
+					field("error", 12, str),
+					field("idempotency_key", 13, str),
+					field("replay_of", 14, str),
+					field("correlation_id", 15, str),
+				},
+				NestedType: []*descriptorpb.DescriptorProto{mapEntry("inputs")},
+			},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("TriggerService"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				method("CreateTrigger", "CreateTriggerRequest", "Trigger", false),
+				method("GetTrigger", "GetTriggerRequest", "Trigger", false),
+				method("ListTriggers", "ListTriggersRequest", "ListTriggersResponse", false),
+				method("WatchTrigger", "WatchTriggerRequest", "Trigger", true),
+			},
+		}},
+	}
+}
+
+func field(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+	return &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String(name),
+		JsonName: proto.String(jsonName(name)),
+		Number:   proto.Int32(number),
+		Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		Type:     typ.Enum(),
+	}
+}
+
+// mapField declares a map<string, string> field of message; its entry type
+// comes from mapEntry.
+func mapField(message, name string, number int32) *descriptorpb.FieldDescriptorProto {
+	f := field(name, number, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE)
+	f.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	f.TypeName = proto.String("." + triggerProtoPackage + "." + message + "." + entryName(name))
+	return f
+}
+
+func mapEntry(name string) *descriptorpb.DescriptorProto {
+	str := descriptorpb.FieldDescriptorProto_TYPE_STRING
+	return &descriptorpb.DescriptorProto{
+		Name:    proto.String(entryName(name)),
+		Field:   []*descriptorpb.FieldDescriptorProto{field("key", 1, str), field("value", 2, str)},
+		Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+	}
+}
+
+func method(name, in, out string, serverStreaming bool) *descriptorpb.MethodDescriptorProto {
+	return &descriptorpb.MethodDescriptorProto{
+		Name:            proto.String(name),
+		InputType:       proto.String("." + triggerProtoPackage + "." + in),
+		OutputType:      proto.String("." + triggerProtoPackage + "." + out),
+		ServerStreaming: proto.Bool(serverStreaming),
+	}
+}
+
+// entryName is the generated map entry name protoc uses, e.g. InputsEntry.
+func entryName(field string) string {
+	n := jsonName(field)
+	return string(n[0]-'a'+'A') + n[1:] + "Entry"
+}
+
+// jsonName converts a snake_case field name to lowerCamelCase.
+func jsonName(name string) string {
+	out := make([]byte, 0, len(name))
+	upper := false
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c == '_':
+			upper = true
+			continue
+		case upper && c >= 'a' && c <= 'z':
+			c -= 'a' - 'A'
+		}
+		upper = false
+		out = append(out, c)
+	}
+	return string(out)
+}
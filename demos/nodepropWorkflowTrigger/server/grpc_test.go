@@ -0,0 +1,180 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// dialGRPC serves s's TriggerService in memory and returns a connection
+// to it.
+func dialGRPC(t *testing.T, s *Server) *grpc.ClientConn {
+	t.Helper()
+	ln := bufconn.Listen(1 << 20)
+	g := s.NewGRPCServer()
+	go g.Serve(ln)
+	t.Cleanup(g.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return ln.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// message builds a TriggerService message with string fields set.
+func message(name string, fields map[string]string) *dynamicpb.Message {
+	m := dynamicpb.NewMessage(triggerMessage(name))
+	for k, v := range fields {
+		m.Set(m.Descriptor().Fields().ByName(protoreflect.Name(k)), protoreflect.ValueOfString(v))
+	}
+	return m
+}
+
+func getString(m *dynamicpb.Message, field string) string {
+	return m.Get(m.Descriptor().Fields().ByName(protoreflect.Name(field))).String()
+}
+
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func TestGRPCAuth(t *testing.T) {
+	tests := []struct {
+		name  string
+		auth  bool
+		token string
+		want  codes.Code
+	}{
+		{name: "auth not configured", token: "trigger-key", want: codes.Unauthenticated},
+		{name: "no token", auth: true, want: codes.Unauthenticated},
+		{name: "unknown token", auth: true, token: "other", want: codes.Unauthenticated},
+		{name: "read only", auth: true, token: "read-key", want: codes.PermissionDenied},
+		{name: "allowed", auth: true, token: "trigger-key", want: codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+			if tt.auth {
+				s.Auth = APIKeys{
+					{Name: "reader", Key: []byte("read-key"), Scopes: []string{ScopeRead}},
+					{Name: "ci", Key: []byte("trigger-key"), Scopes: []string{ScopeRead, ScopeTrigger}},
+				}
+			}
+			conn := dialGRPC(t, s)
+			out := dynamicpb.NewMessage(triggerMessage("Trigger"))
+			in := message("CreateTriggerRequest", map[string]string{"repo": "Cdaprod/site", "workflow": "deploy.yml"})
+			err := conn.Invoke(withToken(tt.token), "/"+triggerServiceName+"/CreateTrigger", in, out)
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("CreateTrigger() code = %v, want %v: %v", got, tt.want, err)
+			}
+		})
+	}
+}
+
+func TestGRPCTriggers(t *testing.T) {
+	s, gh := newTestServer(t)
+	s.Auth = APIKeys{{Name: "ci", Key: []byte("key"), Scopes: []string{ScopeRead, ScopeTrigger}}}
+	conn := dialGRPC(t, s)
+	ctx := withToken("key")
+
+	created := dynamicpb.NewMessage(triggerMessage("Trigger"))
+	in := message("CreateTriggerRequest", map[string]string{"repo": "Cdaprod/site", "workflow": "deploy.yml", "idempotency_key": "k-1"})
+	inputs := in.Mutable(in.Descriptor().Fields().ByName("inputs")).Map()
+	inputs.Set(protoreflect.ValueOfString("env").MapKey(), protoreflect.ValueOfString("prod"))
+	if err := conn.Invoke(ctx, "/"+triggerServiceName+"/CreateTrigger", in, created); err != nil {
+		t.Fatalf("CreateTrigger() error = %v", err)
+	}
+	id := getString(created, "id")
+	if id == "" || getString(created, "ref") != "main" {
+		t.Fatalf("CreateTrigger() = %v", created)
+	}
+	if ds := gh.Dispatches(); len(ds) != 1 || ds[0].Inputs["env"] != "prod" {
+		t.Errorf("dispatches = %+v, want one with the inputs", ds)
+	}
+	// Retrying with the same key returns the first trigger.
+	again := dynamicpb.NewMessage(triggerMessage("Trigger"))
+	if err := conn.Invoke(ctx, "/"+triggerServiceName+"/CreateTrigger", in, again); err != nil || getString(again, "id") != id {
+		t.Errorf("retried CreateTrigger() = %v, %v; want trigger %s", again, err, id)
+	}
+
+	got := dynamicpb.NewMessage(triggerMessage("Trigger"))
+	if err := conn.Invoke(ctx, "/"+triggerServiceName+"/GetTrigger", message("GetTriggerRequest", map[string]string{"id": id}), got); err != nil || getString(got, "id") != id {
+		t.Errorf("GetTrigger() = %v, %v", got, err)
+	}
+	err := conn.Invoke(ctx, "/"+triggerServiceName+"/GetTrigger", message("GetTriggerRequest", map[string]string{"id": "missing"}), got)
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("GetTrigger() of an unknown trigger error = %v, want NotFound", err)
+	}
+
+	list := dynamicpb.NewMessage(triggerMessage("ListTriggersResponse"))
+	if err := conn.Invoke(ctx, "/"+triggerServiceName+"/ListTriggers", message("ListTriggersRequest", map[string]string{"repo": "Cdaprod/site"}), list); err != nil {
+		t.Fatal(err)
+	}
+	if n := list.Get(list.Descriptor().Fields().ByName("triggers")).List().Len(); n != 1 {
+		t.Errorf("ListTriggers() returned %d triggers, want 1", n)
+	}
+
+	// The fake completes runs at once, so the watch ends after the first
+	// message.
+	stream, err := conn.NewStream(ctx, &triggerServiceDesc.Streams[0], "/"+triggerServiceName+"/WatchTrigger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.SendMsg(message("WatchTriggerRequest", map[string]string{"id": id})); err != nil {
+		t.Fatal(err)
+	}
+	stream.CloseSend()
+	var updates []*dynamicpb.Message
+	for {
+		m := dynamicpb.NewMessage(triggerMessage("Trigger"))
+		if err := stream.RecvMsg(m); err != nil {
+			if !errors.Is(err, io.EOF) {
+				t.Fatalf("WatchTrigger() error = %v", err)
+			}
+			break
+		}
+		updates = append(updates, m)
+	}
+	if len(updates) != 1 || getString(updates[0], "status") != "completed" || getString(updates[0], "conclusion") != "success" {
+		t.Errorf("WatchTrigger() sent %v, want the completed run", updates)
+	}
+}
+
+func TestGRPCError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want codes.Code
+	}{
+		{err: &requestError{http.StatusBadRequest, "bad"}, want: codes.InvalidArgument},
+		{err: &requestError{http.StatusForbidden, "no"}, want: codes.PermissionDenied},
+		{err: &flow.ApprovalRequiredError{Approval: flow.Approval{ID: "a-1"}}, want: codes.FailedPrecondition},
+		{err: flow.ErrPolicyDenied, want: codes.PermissionDenied},
+		{err: &flow.APIError{StatusCode: http.StatusNotFound}, want: codes.NotFound},
+		{err: &flow.APIError{StatusCode: http.StatusForbidden}, want: codes.PermissionDenied},
+		{err: &flow.APIError{StatusCode: http.StatusUnprocessableEntity}, want: codes.FailedPrecondition},
+		{err: &flow.APIError{StatusCode: http.StatusBadGateway}, want: codes.Unavailable},
+		{err: errors.New("connection refused"), want: codes.Unavailable},
+	}
+	for _, tt := range tests {
+		if got := status.Code(grpcError(tt.err)); got != tt.want {
+			t.Errorf("grpcError(%v) code = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
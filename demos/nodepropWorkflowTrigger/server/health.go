@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// readyTimeout bounds all readiness checks of one /readyz request.
+const readyTimeout = 5 * time.Second
+
+// checkResult is the outcome of one readiness check.
+type checkResult struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// readyResponse is the body of /readyz.
+type readyResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks"`
+}
+
+// BuildInfo is the body of /version.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Revision  string `json:"revision,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+func (s *Server) healthRoutes() {
+	s.mux.HandleFunc("GET /healthz", s.handleHealthz)
+	s.mux.HandleFunc("GET /readyz", s.handleReadyz)
+	s.mux.HandleFunc("GET /version", s.handleVersion)
+}
+
+// handleHealthz reports that the process is serving requests. It checks no
+// dependencies, so a GitHub outage does not get the pod restarted.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReadyz reports whether the server can accept triggers: the registry
+// store is readable, the token provider yields a token, and the GitHub API
+// answers. It fails once shutdown has begun so traffic drains first.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	resp := readyResponse{Status: "ok", Checks: map[string]checkResult{}}
+	run := func(name string, check func(context.Context) error) {
+		start := time.Now()
+		res := checkResult{Status: "ok"}
+		if err := check(ctx); err != nil {
+			res.Status, res.Error = "fail", err.Error()
+			resp.Status = "unavailable"
+		}
+		res.DurationMS = time.Since(start).Milliseconds()
+		resp.Checks[name] = res
+	}
+	run("shutdown", func(context.Context) error {
+		select {
+		case <-s.closing:
+			return errors.New("server is shutting down")
+		default:
+			return nil
+		}
+	})
+	run("registry", s.checkRegistry)
+	run("token", s.checkToken)
+	run("github", func(ctx context.Context) error {
+		_, err := s.Correlator.Client.Ping(ctx)
+		return err
+	})
+
+	status := http.StatusOK
+	if resp.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, resp)
+}
+
+// checkRegistry verifies the registry file can be read back and parsed. A
+// registry that was never saved is fine.
+func (s *Server) checkRegistry(context.Context) error {
+	if s.RegistryPath == "" {
+		return nil
+	}
+	if _, err := os.Stat(s.RegistryPath); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	_, err := flow.LoadRegistry(s.RegistryPath)
+	return err
+}
+
+// checkToken resolves a token from TokenProvider, falling back to the
+// client's token when none is set.
+func (s *Server) checkToken(ctx context.Context) error {
+	if s.TokenProvider == nil {
+		if s.Correlator.Client.Token == "" && s.Correlator.Client.TokenProvider == nil {
+			return errors.New("no token configured")
+		}
+		return nil
+	}
+	_, err := s.TokenProvider.Token(ctx)
+	return err
+}
+
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.buildInfo())
+}
+
+// buildInfo describes the running binary. Version defaults to the main
+// module version recorded by the Go toolchain.
+func (s *Server) buildInfo() BuildInfo {
+	info := BuildInfo{Version: s.Version, GoVersion: runtime.Version()}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		if info.Version == "" {
+			info.Version = "unknown"
+		}
+		return info
+	}
+	if info.Version == "" {
+		info.Version = bi.Main.Version
+	}
+	for _, setting := range bi.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Revision = setting.Value
+		case "vcs.time":
+			info.BuildTime = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+	return info
+}
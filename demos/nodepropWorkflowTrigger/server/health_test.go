@@ -0,0 +1,93 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+func TestReadyz(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup breaks whatever the case checks.
+		setup      func(t *testing.T, s *Server, gh *nodeproptest.Server)
+		wantFailed string
+	}{
+		{name: "ready", setup: func(*testing.T, *Server, *nodeproptest.Server) {}},
+		{
+			name: "unreadable registry",
+			setup: func(t *testing.T, s *Server, _ *nodeproptest.Server) {
+				s.RegistryPath = filepath.Join(t.TempDir(), "registry.yml")
+				os.WriteFile(s.RegistryPath, []byte("repos: {"), 0o644)
+			},
+			wantFailed: "registry",
+		},
+		{
+			name: "unsaved registry",
+			setup: func(t *testing.T, s *Server, _ *nodeproptest.Server) {
+				s.RegistryPath = filepath.Join(t.TempDir(), "registry.yml")
+			},
+			wantFailed: "",
+		},
+		{
+			name: "no token",
+			setup: func(t *testing.T, s *Server, _ *nodeproptest.Server) {
+				s.TokenProvider = flow.EnvToken{"NODEPROP_TEST_UNSET"}
+			},
+			wantFailed: "token",
+		},
+		{
+			name: "github down",
+			setup: func(t *testing.T, _ *Server, gh *nodeproptest.Server) {
+				gh.Inject(nodeproptest.Fault{Path: "/meta", Status: 503})
+			},
+			wantFailed: "github",
+		},
+		{
+			name:       "shutting down",
+			setup:      func(t *testing.T, s *Server, _ *nodeproptest.Server) { close(s.closing) },
+			wantFailed: "shutdown",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, gh := newTestServer(t)
+			tt.setup(t, s, gh)
+			w := serve(s, "GET", "/readyz", "", nil)
+			var resp readyResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			for name, c := range resp.Checks {
+				if failed := c.Status != "ok"; failed != (name == tt.wantFailed) {
+					t.Errorf("check %s = %+v", name, c)
+				}
+			}
+			wantStatus := http.StatusOK
+			if tt.wantFailed != "" {
+				wantStatus = http.StatusServiceUnavailable
+			}
+			if w.Code != wantStatus || len(resp.Checks) != 4 {
+				t.Errorf("/readyz = %d %s, want %d with four checks", w.Code, w.Body, wantStatus)
+			}
+		})
+	}
+}
+
+func TestHealthzAndVersion(t *testing.T) {
+	s, gh := newTestServer(t)
+	gh.Inject(nodeproptest.Fault{Path: "/meta", Status: 503})
+	if w := serve(s, "GET", "/healthz", "", nil); w.Code != http.StatusOK {
+		t.Errorf("/healthz = %d, want 200 whatever GitHub's state", w.Code)
+	}
+	s.Version = "v1.2.3"
+	var info BuildInfo
+	if w := serve(s, "GET", "/version", "", nil); json.Unmarshal(w.Body.Bytes(), &info) != nil || info.Version != "v1.2.3" || info.GoVersion == "" {
+		t.Errorf("/version = %s", w.Body)
+	}
+}
@@ -0,0 +1,298 @@
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// JWKS refresh bounds: keys are refetched at least this often, and an
+// unknown key ID triggers a refetch at most once per jwksMinRefresh.
+const (
+	jwksMaxAge     = time.Hour
+	jwksMinRefresh = time.Minute
+)
+
+// curveHash is the hash each ES algorithm pairs with its curve, keyed by
+// curve size, e.g. ES256 with P-256.
+var curveHash = map[int]crypto.Hash{256: crypto.SHA256, 384: crypto.SHA384, 521: crypto.SHA512}
+
+// jwtLeeway tolerates clock skew when checking exp and nbf.
+const jwtLeeway = 30 * time.Second
+
+// JWTAuthenticator validates JWTs signed with a key from a JWKS endpoint.
+// Only asymmetric algorithms (RS*, PS*, ES*) are accepted, and Issuer and
+// Audience are required: without them any token the key set's owner
+// signed, for any service, would be accepted.
+type JWTAuthenticator struct {
+	JWKSURL  string `yaml:"jwks_url"`
+	Issuer   string `yaml:"issuer"`
+	Audience string `yaml:"audience"`
+	// ScopesClaim names the claim holding the caller's scopes, either a
+	// space-separated string or a list; it defaults to "scope".
+	ScopesClaim string `yaml:"scopes_claim"`
+	// TenantClaim, if set, names the string claim holding the caller's
+	// tenant.
+	TenantClaim string       `yaml:"tenant_claim"`
+	HTTPClient  *http.Client `yaml:"-"`
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+// jwtHeader is the JOSE header of a token.
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Authenticate verifies token's signature, issuer, audience, and lifetime
+// and returns its subject and scopes.
+func (a *JWTAuthenticator) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrUnauthenticated
+	}
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrUnauthenticated
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrUnauthenticated
+	}
+	key, err := a.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyJWS(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, ErrUnauthenticated
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrUnauthenticated
+	}
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(jwtLeeway)) {
+		return nil, ErrUnauthenticated
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(jwtLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, ErrUnauthenticated
+	}
+	if a.Issuer == "" || claims["iss"] != a.Issuer {
+		return nil, ErrUnauthenticated
+	}
+	if a.Audience == "" || !claimContains(claims["aud"], a.Audience) {
+		return nil, ErrUnauthenticated
+	}
+
+	sub, _ := claims["sub"].(string)
+	p := &Principal{Subject: "jwt:" + sub}
+	if a.TenantClaim != "" {
+		p.Tenant, _ = claims[a.TenantClaim].(string)
+	}
+	claim := a.ScopesClaim
+	if claim == "" {
+		claim = "scope"
+	}
+	switch v := claims[claim].(type) {
+	case string:
+		p.Scopes = strings.Fields(v)
+	case []interface{}:
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				p.Scopes = append(p.Scopes, s)
+			}
+		}
+	}
+	return p, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func claimContains(claim interface{}, want string) bool {
+	switch v := claim.(type) {
+	case string:
+		return v == want
+	case []interface{}:
+		for _, s := range v {
+			if s == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// verifyJWS checks sig over signingInput for alg with key.
+func verifyJWS(alg string, key crypto.PublicKey, signingInput string, sig []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	var h crypto.Hash
+	switch alg[2:] {
+	case "256":
+		h = crypto.SHA256
+	case "384":
+		h = crypto.SHA384
+	case "512":
+		h = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	hasher := h.New()
+	hasher.Write([]byte(signingInput))
+	digest := hasher.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		switch alg[:2] {
+		case "RS":
+			return rsa.VerifyPKCS1v15(k, h, digest, sig)
+		case "PS":
+			return rsa.VerifyPSS(k, h, digest, sig, nil)
+		}
+	case *ecdsa.PublicKey:
+		bits := k.Curve.Params().BitSize
+		size := (bits + 7) / 8
+		if alg[:2] != "ES" || len(sig) != 2*size || curveHash[bits] != h {
+			break
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if ecdsa.Verify(k, digest, r, s) {
+			return nil
+		}
+		return errors.New("invalid signature")
+	}
+	return fmt.Errorf("algorithm %q does not match the key", alg)
+}
+
+// key returns the public key with ID kid, refreshing the key set when it
+// is stale or does not contain kid.
+func (a *JWTAuthenticator) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	age := time.Since(a.fetched)
+	if key, ok := a.keys[kid]; ok && age < jwksMaxAge {
+		return key, nil
+	}
+	if a.keys == nil || age >= jwksMinRefresh {
+		keys, err := a.fetch(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("jwks: %w", err)
+		}
+		a.keys, a.fetched = keys, time.Now()
+	}
+	if key, ok := a.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrUnauthenticated
+}
+
+// jwk is a JSON Web Key; only the fields for RSA and EC keys are decoded.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (a *JWTAuthenticator) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", a.JWKSURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	hc := a.HTTPClient
+	if hc == nil {
+		hc = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: unexpected status code: %d", a.JWKSURL, resp.StatusCode)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("failed to decode key set: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testIssuer signs tokens with an RSA and an EC key published at its JWKS
+// endpoint.
+type testIssuer struct {
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+	srv *httptest.Server
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	rk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ek, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	set := map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "use": "sig", "n": b64(rk.N.Bytes()), "e": b64(big.NewInt(int64(rk.E)).Bytes())},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ek.X.FillBytes(make([]byte, 32))), "y": b64(ek.Y.FillBytes(make([]byte, 32)))},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": b64(rk.N.Bytes()), "e": b64(big.NewInt(int64(rk.E)).Bytes())},
+	}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(srv.Close)
+	return &testIssuer{rsa: rk, ec: ek, srv: srv}
+}
+
+// sign returns a token for claims signed by the key kid with alg.
+func (i *testIssuer) sign(t *testing.T, alg, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	seg := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	input := seg(jwtHeader{Alg: alg, Kid: kid}) + "." + seg(claims)
+	digest := sha256.Sum256([]byte(input))
+	var sig []byte
+	var err error
+	switch alg {
+	case "RS256":
+		sig, err = rsa.SignPKCS1v15(rand.Reader, i.rsa, crypto.SHA256, digest[:])
+	case "PS256":
+		sig, err = rsa.SignPSS(rand.Reader, i.rsa, crypto.SHA256, digest[:], nil)
+	case "ES256":
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, i.ec, digest[:])
+		if err == nil {
+			sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		}
+	default:
+		sig = []byte("signature")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	iss := newTestIssuer(t)
+	now := time.Now().Unix()
+	claims := func(edit func(map[string]interface{})) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss":    "https://issuer.example.com/",
+			"aud":    "nodeprop",
+			"sub":    "alice",
+			"exp":    now + 300,
+			"scope":  "read trigger",
+			"tenant": "payments",
+		}
+		if edit != nil {
+			edit(c)
+		}
+		return c
+	}
+	tests := []struct {
+		name   string
+		token  string
+		auth   func(*JWTAuthenticator)
+		want   *Principal
+		reject bool
+	}{
+		{name: "RS256", token: iss.sign(t, "RS256", "rsa", claims(nil)),
+			want: &Principal{Subject: "jwt:alice", Scopes: []string{"read", "trigger"}}},
+		{name: "PS256", token: iss.sign(t, "PS256", "rsa", claims(nil)),
+			want: &Principal{Subject: "jwt:alice", Scopes: []string{"read", "trigger"}}},
+		{name: "ES256", token: iss.sign(t, "ES256", "ec", claims(nil)),
+			want: &Principal{Subject: "jwt:alice", Scopes: []string{"read", "trigger"}}},
+		{name: "audience list", token: iss.sign(t, "RS256", "rsa", claims(func(c map[string]interface{}) { c["aud"] = []string{"other", "nodeprop"} })),
+			want: &Principal{Subject: "jwt:alice", Scopes: []string{"read", "trigger"}}},
+		{name: "scopes claim and tenant",
+			token: iss.sign(t, "RS256", "rsa", claims(func(c map[string]interface{}) { c["roles"] = []string{"admin"} })),
+			auth:  func(a *JWTAuthenticator) { a.ScopesClaim, a.TenantClaim = "roles", "tenant" },
+			want:  &Principal{Subject: "jwt:alice", Scopes: []string{"admin"}, Tenant: "payments"}},
+		{name: "expired within leeway", token: iss.sign(t, "RS256", "rsa", claims(func(c map[string]interface{}) { c["exp"] = now - 10 })),
+			want: &Principal{Subject: "jwt:alice", Scopes: []string{"read", "trigger"}}},
+		{name: "expired", token: iss.sign(t, "RS256", "rsa", claims(func(c map[string]interface{}) { c["exp"] = now - 120 })), reject: true},
+		{name: "no exp", token: iss.sign(t, "RS256", "rsa", claims(func(c map[string]interface{}) { delete(c, "exp") })), reject: true},
+		{name: "not yet valid", token: iss.sign(t, "RS256", "rsa", claims(func(c map[string]interface{}) { c["nbf"] = now + 120 })), reject: true},
+		{name: "wrong issuer", token: iss.sign(t, "RS256", "rsa", claims(func(c map[string]interface{}) { c["iss"] = "https://evil.example.com/" })), reject: true},
+		{name: "wrong audience", token: iss.sign(t, "RS256", "rsa", claims(func(c map[string]interface{}) { c["aud"] = []string{"other"} })), reject: true},
+		{name: "no issuer configured", token: iss.sign(t, "RS256", "rsa", claims(nil)), auth: func(a *JWTAuthenticator) { a.Issuer = "" }, reject: true},
+		{name: "no audience configured", token: iss.sign(t, "RS256", "rsa", claims(nil)), auth: func(a *JWTAuthenticator) { a.Audience = "" }, reject: true},
+		{name: "alg none", token: iss.sign(t, "none", "rsa", claims(nil)), reject: true},
+		{name: "HS256", token: iss.sign(t, "HS256", "rsa", claims(nil)), reject: true},
+		{name: "alg does not match key", token: iss.sign(t, "ES256", "rsa", claims(nil)), reject: true},
+		{name: "unknown key", token: iss.sign(t, "RS256", "missing", claims(nil)), reject: true},
+		{name: "encryption key", token: iss.sign(t, "RS256", "enc", claims(nil)), reject: true},
+		{name: "malformed", token: "not.a-jwt", reject: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &JWTAuthenticator{JWKSURL: iss.srv.URL, Issuer: "https://issuer.example.com/", Audience: "nodeprop"}
+			if tt.auth != nil {
+				tt.auth(a)
+			}
+			p, err := a.Authenticate(context.Background(), tt.token)
+			if tt.reject {
+				if !errors.Is(err, ErrUnauthenticated) {
+					t.Fatalf("Authenticate() = %+v, %v; want ErrUnauthenticated", p, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+			if p.Subject != tt.want.Subject || p.Tenant != tt.want.Tenant || !slices.Equal(p.Scopes, tt.want.Scopes) {
+				t.Errorf("Authenticate() = %+v, want %+v", p, tt.want)
+			}
+		})
+	}
+}
+
+func TestJWTAuthenticatorTamperedSignature(t *testing.T) {
+	iss := newTestIssuer(t)
+	token := iss.sign(t, "RS256", "rsa", map[string]interface{}{
+		"iss": "i", "aud": "a", "sub": "alice", "exp": time.Now().Unix() + 300, "scope": "read",
+	})
+	forged := iss.sign(t, "RS256", "rsa", map[string]interface{}{
+		"iss": "i", "aud": "a", "sub": "alice", "exp": time.Now().Unix() + 300, "scope": "admin",
+	})
+	// Pair the forged claims with the original signature.
+	tampered := forged[:len(forged)-len(signature(forged))] + signature(token)
+	a := &JWTAuthenticator{JWKSURL: iss.srv.URL, Issuer: "i", Audience: "a"}
+	if _, err := a.Authenticate(context.Background(), tampered); !errors.Is(err, ErrUnauthenticated) {
+		t.Fatalf("Authenticate(tampered) error = %v, want ErrUnauthenticated", err)
+	}
+}
+
+// signature returns the last segment of token.
+func signature(token string) string {
+	return token[strings.LastIndex(token, ".")+1:]
+}
@@ -0,0 +1,258 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// staleDispatch is how long a queued dispatch whose outcome was never seen
+// is counted before it is forgotten.
+const staleDispatch = time.Hour
+
+// Metrics holds a server's Prometheus metrics. Set Server.Metrics before
+// serving, and serve Handler on its own listener so scrapes bypass the
+// API's authentication and rate limits.
+type Metrics struct {
+	// Registry holds the metrics, along with Go runtime and process
+	// metrics. Other collectors may be registered on it.
+	Registry *prometheus.Registry
+	// TLS, if set, is used by ListenAndServe, e.g. to require the
+	// scraper's client certificate.
+	TLS *tls.Config
+
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	queued   *prometheus.GaugeVec
+	latency  *prometheus.HistogramVec
+	github   *prometheus.Desc
+	queue    *prometheus.Desc
+	overflow *prometheus.Desc
+
+	mu      sync.Mutex
+	servers []*Server
+}
+
+// NewMetrics creates the server metrics on a new registry.
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nodeprop_http_requests_total",
+			Help: "HTTP requests served, by route, method, and status code.",
+		}, []string{"route", "method", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "nodeprop_http_request_duration_seconds",
+			Help:    "Time taken to serve HTTP requests, by route.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route"}),
+		queued: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "nodeprop_dispatch_queue_depth",
+			Help: "Dispatches queued and not yet sent or failed, by tenant.",
+		}, []string{"tenant"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "nodeprop_dispatch_latency_seconds",
+			Help:    "Time from queueing a dispatch to its outcome, retries included, by tenant and outcome.",
+			Buckets: []float64{.1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120},
+		}, []string{"tenant", "outcome"}),
+		github: prometheus.NewDesc("nodeprop_github_rate_limit_remaining",
+			"Requests left in the GitHub API rate limit, as of the last response, by tenant.",
+			[]string{"tenant"}, nil),
+		queue: prometheus.NewDesc("nodeprop_event_queue_jobs",
+			"Events whose dispatches are queued or running on the server's queue, by state.",
+			[]string{"state"}, nil),
+		overflow: prometheus.NewDesc("nodeprop_event_queue_overflow_total",
+			"Events lost to the queue's overflow policy, by outcome: dropped or rejected.",
+			[]string{"outcome"}, nil),
+	}
+	m.Registry.MustRegister(
+		m.requests, m.duration, m.queued, m.latency, rateLimitCollector{m}, queueCollector{m},
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{})
+}
+
+// ListenAndServe serves /metrics on addr until ctx is cancelled.
+func (m *Metrics) ListenAndServe(ctx context.Context, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", m.Handler())
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second, TLSConfig: m.TLS}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	if m.TLS != nil {
+		err = srv.ServeTLS(ln, "", "")
+	} else {
+		err = srv.Serve(ln)
+	}
+	if err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// instrument counts and times the requests h serves. The route is the mux
+// pattern that matched, so paths with IDs in them share a series.
+func (m *Metrics) instrument(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		h.ServeHTTP(rec, r)
+		route := "unmatched"
+		if _, path, ok := strings.Cut(r.Pattern, " "); ok {
+			route = path
+		} else if r.Pattern != "" {
+			route = r.Pattern
+		}
+		m.requests.WithLabelValues(route, r.Method, strconv.Itoa(rec.code)).Inc()
+		m.duration.WithLabelValues(route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// watch follows s's dispatch events until ctx is cancelled, tracking queue
+// depth and latency, and reports its GitHub rate limit.
+func (m *Metrics) watch(ctx context.Context, s *Server) {
+	m.mu.Lock()
+	m.servers = append(m.servers, s)
+	m.mu.Unlock()
+
+	events, unsubscribe := s.Correlator.Events.Subscribe(256)
+	go func() {
+		defer unsubscribe()
+		queued := map[string]time.Time{}
+		depth := m.queued.WithLabelValues(s.Tenant)
+		sweep := time.NewTicker(staleDispatch)
+		defer sweep.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-sweep.C:
+				for id, t := range queued {
+					if now.Sub(t) > staleDispatch {
+						delete(queued, id)
+						depth.Dec()
+					}
+				}
+			case e := <-events:
+				switch e.Type {
+				case flow.EventQueued:
+					if _, ok := queued[e.DispatchID]; !ok {
+						queued[e.DispatchID] = e.Time
+						depth.Inc()
+					}
+				case flow.EventDispatched, flow.EventFailed:
+					t, ok := queued[e.DispatchID]
+					if !ok {
+						continue
+					}
+					delete(queued, e.DispatchID)
+					depth.Dec()
+					m.latency.WithLabelValues(s.Tenant, string(e.Type)).Observe(e.Time.Sub(t).Seconds())
+				}
+			}
+		}
+	}()
+}
+
+// rateLimitCollector reports the rate limit last seen by each watched
+// server's GitHub client, without calling the API.
+type rateLimitCollector struct{ m *Metrics }
+
+func (c rateLimitCollector) Describe(ch chan<- *prometheus.Desc) { ch <- c.m.github }
+
+func (c rateLimitCollector) Collect(ch chan<- prometheus.Metric) {
+	c.m.mu.Lock()
+	servers := append([]*Server(nil), c.m.servers...)
+	c.m.mu.Unlock()
+	for _, s := range servers {
+		if s.Correlator.Client == nil {
+			continue
+		}
+		if rl, ok := s.Correlator.Client.LastRateLimit(); ok {
+			ch <- prometheus.MustNewConstMetric(c.m.github, prometheus.GaugeValue, float64(rl.Remaining), s.Tenant)
+		}
+	}
+}
+
+// queueCollector reports the queue of the watched servers.
+type queueCollector struct{ m *Metrics }
+
+func (c queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.m.queue
+	ch <- c.m.overflow
+}
+
+func (c queueCollector) Collect(ch chan<- prometheus.Metric) {
+	c.m.mu.Lock()
+	servers := append([]*Server(nil), c.m.servers...)
+	c.m.mu.Unlock()
+	// Tenants share their parent's queue, so the first one found is the
+	// server's.
+	for _, s := range servers {
+		if s.Queue == nil {
+			continue
+		}
+		st := s.Queue.Stats()
+		ch <- prometheus.MustNewConstMetric(c.m.queue, prometheus.GaugeValue, float64(st.Queued), "queued")
+		ch <- prometheus.MustNewConstMetric(c.m.queue, prometheus.GaugeValue, float64(st.Running), "running")
+		ch <- prometheus.MustNewConstMetric(c.m.overflow, prometheus.CounterValue, float64(st.Dropped), "dropped")
+		ch <- prometheus.MustNewConstMetric(c.m.overflow, prometheus.CounterValue, float64(st.Rejected), "rejected")
+		return
+	}
+}
+
+// statusRecorder remembers the status code written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Flush lets event streams flush through the recorder.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets WebSocket event streams take over the connection. A
+// hijacked connection is recorded as switching protocols.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T does not support hijacking", r.ResponseWriter)
+	}
+	r.code = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter { return r.ResponseWriter }
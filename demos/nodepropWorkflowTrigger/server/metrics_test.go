@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// scrape returns m's metrics in the exposition format.
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("scrape status = %d", w.Code)
+	}
+	return w.Body.String()
+}
+
+// waitForMetrics scrapes m until it has every line in want.
+func waitForMetrics(t *testing.T, m *Metrics, want ...string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got := scrape(t, m)
+		missing := ""
+		for _, line := range want {
+			if !strings.Contains(got, line+"\n") {
+				missing = line
+				break
+			}
+		}
+		if missing == "" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("metrics have no %s:\n%s", missing, got)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMetricsInstrument(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   string
+	}{
+		{name: "route", method: "POST", path: "/v1/triggers", body: `{"repo": "Cdaprod/site", "workflow": "deploy.yml"}`,
+			want: `nodeprop_http_requests_total{code="202",method="POST",route="/v1/triggers"} 1`},
+		{name: "route with an ID", method: "GET", path: "/v1/triggers/missing",
+			want: `nodeprop_http_requests_total{code="404",method="GET",route="/v1/triggers/{id}"} 1`},
+		{name: "unmatched", method: "GET", path: "/nope",
+			want: `nodeprop_http_requests_total{code="404",method="GET",route="unmatched"} 1`},
+		{name: "bad request", method: "POST", path: "/v1/triggers", body: `{`,
+			want: `nodeprop_http_requests_total{code="400",method="POST",route="/v1/triggers"} 1`},
+		{name: "tenant", method: "GET", path: "/t/payments/v1/triggers",
+			want: `nodeprop_http_requests_total{code="200",method="GET",route="/t/{tenant}/v1/triggers"} 1`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+			addTestTenant(t, s, "payments")
+			s.Metrics = NewMetrics()
+			serve(s, tt.method, tt.path, tt.body, nil)
+			if got := scrape(t, s.Metrics); !strings.Contains(got, tt.want+"\n") {
+				t.Errorf("metrics have no %s:\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMetricsWatch(t *testing.T) {
+	s, gh := newTestServer(t)
+	s.Queue = flow.NewDispatchQueue(1, 1, flow.OverflowReject)
+	m := NewMetrics()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m.watch(ctx, s)
+
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	events := s.Correlator.Events
+	// The metrics subscribe in watch, so these are not missed.
+	events.Publish(flow.Event{Type: flow.EventQueued, DispatchID: "a", Time: at})
+	events.Publish(flow.Event{Type: flow.EventQueued, DispatchID: "b", Time: at})
+	events.Publish(flow.Event{Type: flow.EventQueued, DispatchID: "a", Time: at.Add(time.Second)})
+	waitForMetrics(t, m, `nodeprop_dispatch_queue_depth{tenant=""} 2`)
+
+	events.Publish(flow.Event{Type: flow.EventDispatched, DispatchID: "a", Time: at.Add(2 * time.Second)})
+	events.Publish(flow.Event{Type: flow.EventFailed, DispatchID: "b", Time: at.Add(30 * time.Second)})
+	events.Publish(flow.Event{Type: flow.EventDispatched, DispatchID: "unseen", Time: at})
+	waitForMetrics(t, m,
+		`nodeprop_dispatch_queue_depth{tenant=""} 0`,
+		`nodeprop_dispatch_latency_seconds_sum{outcome="dispatched",tenant=""} 2`,
+		`nodeprop_dispatch_latency_seconds_sum{outcome="failed",tenant=""} 30`,
+	)
+
+	// The GitHub rate limit is reported once a response has been seen.
+	if got := scrape(t, m); strings.Contains(got, "nodeprop_github_rate_limit_remaining{") {
+		t.Errorf("rate limit reported before any request:\n%s", got)
+	}
+	serve(s, "POST", "/v1/triggers", `{"repo": "Cdaprod/site", "workflow": "deploy.yml"}`, nil)
+	waitForMetrics(t, m, fmt.Sprintf(`nodeprop_github_rate_limit_remaining{tenant=""} %d`, 5000-len(gh.Requests())))
+
+	// One job runs and one waits; the next is rejected.
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	s.Queue.Enqueue(ctx, flow.QueueJob{Run: func() { close(started); <-release }})
+	<-started
+	s.Queue.Enqueue(ctx, flow.QueueJob{Run: func() {}})
+	if err := s.Queue.Enqueue(ctx, flow.QueueJob{Run: func() {}}); err != flow.ErrQueueFull {
+		t.Fatalf("Enqueue() on a full queue error = %v", err)
+	}
+	waitForMetrics(t, m,
+		`nodeprop_event_queue_jobs{state="queued"} 1`,
+		`nodeprop_event_queue_jobs{state="running"} 1`,
+		`nodeprop_event_queue_overflow_total{outcome="rejected"} 1`,
+		`nodeprop_event_queue_overflow_total{outcome="dropped"} 0`,
+	)
+}
+
+func TestStatusRecorderHijack(t *testing.T) {
+	m := NewMetrics()
+	upgraded := make(chan error, 1)
+	ts := httptest.NewServer(m.instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			upgraded <- err
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		upgraded <- buf.Flush()
+	})))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if err := <-upgraded; err != nil {
+		t.Fatalf("Hijack() through the recorder error = %v", err)
+	}
+	waitForMetrics(t, m, `nodeprop_http_requests_total{code="101",method="GET",route="unmatched"} 1`)
+
+	rec := &statusRecorder{ResponseWriter: httptest.NewRecorder()}
+	if _, _, err := rec.Hijack(); err == nil {
+		t.Error("Hijack() of a writer that cannot be hijacked succeeded")
+	}
+}
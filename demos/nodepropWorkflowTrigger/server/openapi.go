@@ -0,0 +1,23 @@
+package server
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// OpenAPI is the OpenAPI 3 document describing the REST API. The client
+// package is generated from it.
+//
+//go:embed openapi.yaml
+var OpenAPI []byte
+
+func (s *Server) openAPIRoutes() {
+	s.mux.HandleFunc("GET /openapi.yaml", s.handleOpenAPI)
+}
+
+// handleOpenAPI serves the API document unauthenticated, so tooling can
+// discover the API before it has credentials.
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(OpenAPI)
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TestOpenAPI checks that the document is served without credentials and
+// that every operation it describes is routed.
+func TestOpenAPI(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.Auth = APIKeys{{Name: "ci", Key: []byte("key"), Scopes: []string{ScopeAdmin}}}
+	w := serve(s, "GET", "/openapi.yaml", "", nil)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/yaml" {
+		t.Fatalf("GET /openapi.yaml = %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	var doc struct {
+		Paths map[string]map[string]struct {
+			OperationID string `yaml:"operationId"`
+		} `yaml:"paths"`
+	}
+	if err := yaml.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Paths) == 0 {
+		t.Fatal("no paths")
+	}
+	s.Auth = nil
+	for path, ops := range doc.Paths {
+		for method, op := range ops {
+			if op.OperationID == "" {
+				t.Errorf("%s %s has no operationId", method, path)
+			}
+			if path == "/v1/events" {
+				continue // streams until the client goes away
+			}
+			w := serve(s, strings.ToUpper(method), strings.ReplaceAll(path, "{id}", "missing"), "", nil)
+			if w.Code == http.StatusMethodNotAllowed || strings.HasPrefix(w.Body.String(), "404 page not found") {
+				t.Errorf("%s %s is not routed: %d", method, path, w.Code)
+			}
+		}
+	}
+}
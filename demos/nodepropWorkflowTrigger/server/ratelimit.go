@@ -0,0 +1,260 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// sweepInterval is how often buckets that have refilled are forgotten, so
+// callers seen once do not accumulate.
+const sweepInterval = 10 * time.Minute
+
+// Rate is a number of requests per period.
+type Rate struct {
+	N   int
+	Per time.Duration
+}
+
+var ratePeriods = map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour, "d": 24 * time.Hour}
+
+// ParseRate parses a rate written as N/s, N/m, N/h, or N/d.
+func ParseRate(s string) (Rate, error) {
+	n, unit, ok := strings.Cut(strings.TrimSpace(s), "/")
+	per, known := ratePeriods[unit]
+	count, err := strconv.Atoi(n)
+	if !ok || !known || err != nil || count <= 0 {
+		return Rate{}, fmt.Errorf("invalid rate %q: want N/s, N/m, N/h, or N/d", s)
+	}
+	return Rate{N: count, Per: per}, nil
+}
+
+func (r *Rate) UnmarshalYAML(n *yaml.Node) error {
+	var s string
+	if err := n.Decode(&s); err != nil {
+		return err
+	}
+	rate, err := ParseRate(s)
+	if err != nil {
+		return err
+	}
+	*r = rate
+	return nil
+}
+
+// Limit caps a client or tenant. Rate is refilled continuously and Burst
+// requests, by default Rate.N, may be made at once; Quota is a second,
+// usually daily, allowance that must also have room.
+type Limit struct {
+	Rate  Rate `yaml:"rate"`
+	Burst int  `yaml:"burst"`
+	Quota Rate `yaml:"quota"`
+}
+
+// RateLimits configures a RateLimiter.
+type RateLimits struct {
+	// Default applies to each client without an entry in Clients.
+	Default *Limit `yaml:"default"`
+	// Clients is keyed by principal subject, e.g. key:ci or jwt:alice, or
+	// ip:ADDR when the API is unauthenticated.
+	Clients map[string]Limit `yaml:"clients"`
+	// Tenants is shared by every client of the tenant.
+	Tenants map[string]Limit `yaml:"tenants"`
+}
+
+// LoadRateLimits reads a rate limit file.
+//
+//	default: {rate: 60/m, burst: 10}
+//	clients:
+//	  key:ci: {rate: 10/m, quota: 500/d}
+//	tenants:
+//	  payments: {rate: 120/m}
+func LoadRateLimits(path string) (*RateLimiter, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var limits RateLimits
+	if err := yaml.Unmarshal(data, &limits); err != nil {
+		return nil, fmt.Errorf("failed to parse rate limits %s: %w", path, err)
+	}
+	if limits.Default != nil {
+		if err := limits.Default.validate(); err != nil {
+			return nil, fmt.Errorf("%s: default: %w", path, err)
+		}
+	}
+	for name, l := range limits.Clients {
+		if err := l.validate(); err != nil {
+			return nil, fmt.Errorf("%s: client %s: %w", path, name, err)
+		}
+	}
+	for name, l := range limits.Tenants {
+		if err := l.validate(); err != nil {
+			return nil, fmt.Errorf("%s: tenant %s: %w", path, name, err)
+		}
+	}
+	return NewRateLimiter(limits), nil
+}
+
+func (l Limit) validate() error {
+	if l.Rate.N == 0 {
+		return errors.New("no rate")
+	}
+	if l.Burst < 0 {
+		return errors.New("negative burst")
+	}
+	return nil
+}
+
+// RateLimitError reports a request refused by a RateLimiter.
+type RateLimitError struct {
+	// Key is the client or tenant whose limit was reached.
+	Key string
+	// RetryAfter is how long until a request would be allowed.
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limit exceeded for %s; retry in %s", e.Key, e.RetryAfter.Round(time.Second))
+}
+
+// RateLimiter keeps a token bucket per client and per tenant.
+type RateLimiter struct {
+	limits RateLimits
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+	now     func() time.Time
+}
+
+// NewRateLimiter creates a RateLimiter enforcing limits.
+func NewRateLimiter(limits RateLimits) *RateLimiter {
+	return &RateLimiter{limits: limits, buckets: map[string]*bucket{}, now: time.Now}
+}
+
+// SetTenantLimit sets or replaces the limit shared by tenant's clients.
+func (l *RateLimiter) SetTenantLimit(tenant string, limit Limit) error {
+	if err := limit.validate(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limits.Tenants == nil {
+		l.limits.Tenants = map[string]Limit{}
+	}
+	l.limits.Tenants[tenant] = limit
+	// A bucket sized for the old limit would outlive it.
+	delete(l.buckets, "tenant:"+tenant+" rate")
+	delete(l.buckets, "tenant:"+tenant+" quota")
+	return nil
+}
+
+// Allow takes one request from the buckets of client and, if non-empty,
+// tenant. Nothing is taken unless every bucket has room.
+func (l *RateLimiter) Allow(client, tenant string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if now.Sub(l.swept) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	var taken []*bucket
+	take := func(key string, limit Limit) error {
+		for _, b := range l.bucketsFor(key, limit) {
+			if wait := b.take(now); wait > 0 {
+				for _, t := range taken {
+					t.refund()
+				}
+				return &RateLimitError{Key: key, RetryAfter: wait}
+			}
+			taken = append(taken, b)
+		}
+		return nil
+	}
+	if limit, ok := l.limits.Clients[client]; ok {
+		if err := take(client, limit); err != nil {
+			return err
+		}
+	} else if l.limits.Default != nil {
+		if err := take(client, *l.limits.Default); err != nil {
+			return err
+		}
+	}
+	if limit, ok := l.limits.Tenants[tenant]; ok && tenant != "" {
+		if err := take("tenant:"+tenant, limit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bucketsFor returns the rate and quota buckets for key.
+func (l *RateLimiter) bucketsFor(key string, limit Limit) []*bucket {
+	burst := limit.Burst
+	if burst == 0 {
+		burst = limit.Rate.N
+	}
+	out := []*bucket{l.bucket(key+" rate", limit.Rate, burst)}
+	if limit.Quota.N > 0 {
+		out = append(out, l.bucket(key+" quota", limit.Quota, limit.Quota.N))
+	}
+	return out
+}
+
+func (l *RateLimiter) bucket(key string, rate Rate, burst int) *bucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{capacity: float64(burst), tokens: float64(burst), perSecond: float64(rate.N) / rate.Per.Seconds(), last: l.now()}
+		l.buckets[key] = b
+	}
+	return b
+}
+
+// sweep forgets buckets that are full again, which behave the same as new
+// ones.
+func (l *RateLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.refill(now); b.tokens >= b.capacity {
+			delete(l.buckets, key)
+		}
+	}
+	l.swept = now
+}
+
+// bucket is a token bucket refilled continuously up to its capacity.
+type bucket struct {
+	capacity  float64
+	tokens    float64
+	perSecond float64
+	last      time.Time
+}
+
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.capacity, b.tokens+elapsed*b.perSecond)
+		b.last = now
+	}
+}
+
+// take removes a token, or returns how long until one is available.
+func (b *bucket) take(now time.Time) time.Duration {
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.perSecond * float64(time.Second))
+}
+
+func (b *bucket) refund() {
+	b.tokens = math.Min(b.capacity, b.tokens+1)
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Rate
+		ok   bool
+	}{
+		{in: "10/s", want: Rate{N: 10, Per: time.Second}, ok: true},
+		{in: " 60/m ", want: Rate{N: 60, Per: time.Minute}, ok: true},
+		{in: "5/h", want: Rate{N: 5, Per: time.Hour}, ok: true},
+		{in: "500/d", want: Rate{N: 500, Per: 24 * time.Hour}, ok: true},
+		{in: "10"},
+		{in: "10/w"},
+		{in: "0/s"},
+		{in: "-1/s"},
+		{in: "ten/s"},
+	}
+	for _, tt := range tests {
+		got, err := ParseRate(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParseRate(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestLoadRateLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		wantErr string
+	}{
+		{name: "valid", file: "default: {rate: 60/m, burst: 10}\nclients:\n  key:ci: {rate: 10/m, quota: 500/d}\ntenants:\n  payments: {rate: 120/m}\n"},
+		{name: "bad rate", file: "default: {rate: fast}\n", wantErr: `invalid rate "fast"`},
+		{name: "no rate", file: "clients:\n  key:ci: {burst: 5}\n", wantErr: "client key:ci: no rate"},
+		{name: "negative burst", file: "tenants:\n  payments: {rate: 1/s, burst: -1}\n", wantErr: "tenant payments: negative burst"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "limits.yml")
+			os.WriteFile(path, []byte(tt.file), 0o600)
+			l, err := LoadRateLimits(path)
+			if tt.wantErr == "" {
+				if err != nil || l.limits.Clients["key:ci"].Quota.N != 500 {
+					t.Errorf("LoadRateLimits() = %+v, %v", l, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadRateLimits() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// fakeNow returns a RateLimiter whose clock is moved by advance.
+func fakeNow(limits RateLimits) (*RateLimiter, func(time.Duration)) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	l := NewRateLimiter(limits)
+	l.now = func() time.Time { return now }
+	return l, func(d time.Duration) { now = now.Add(d) }
+}
+
+// allowed makes n requests and returns how many were allowed, and the last
+// refusal.
+func allowed(l *RateLimiter, n int, client, tenant string) (int, *RateLimitError) {
+	var ok int
+	var last *RateLimitError
+	for range n {
+		err := l.Allow(client, tenant)
+		if err == nil {
+			ok++
+		} else {
+			errors.As(err, &last)
+		}
+	}
+	return ok, last
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits RateLimits
+		client string
+		tenant string
+		// then is advanced after the first n requests before the rest.
+		n, then  int
+		advance  time.Duration
+		want     int
+		wantThen int
+		wantKey  string
+	}{
+		{name: "unlimited", limits: RateLimits{}, client: "key:ci", n: 100, want: 100},
+		{name: "burst defaults to rate", limits: RateLimits{Default: &Limit{Rate: Rate{N: 3, Per: time.Minute}}}, client: "key:ci", n: 5, want: 3, wantKey: "key:ci"},
+		{name: "burst", limits: RateLimits{Default: &Limit{Rate: Rate{N: 60, Per: time.Minute}, Burst: 2}}, client: "key:ci", n: 5, want: 2, wantKey: "key:ci"},
+		{
+			name:   "refill",
+			limits: RateLimits{Default: &Limit{Rate: Rate{N: 60, Per: time.Minute}, Burst: 2}},
+			client: "key:ci", n: 3, want: 2, advance: 1500 * time.Millisecond, then: 3, wantThen: 1,
+		},
+		{
+			name:   "client overrides default",
+			limits: RateLimits{Default: &Limit{Rate: Rate{N: 1, Per: time.Minute}}, Clients: map[string]Limit{"key:ci": {Rate: Rate{N: 4, Per: time.Minute}}}},
+			client: "key:ci", n: 5, want: 4, wantKey: "key:ci",
+		},
+		{
+			name:   "quota",
+			limits: RateLimits{Clients: map[string]Limit{"key:ci": {Rate: Rate{N: 10, Per: time.Second}, Quota: Rate{N: 3, Per: 24 * time.Hour}}}},
+			client: "key:ci", n: 5, want: 3, advance: time.Minute, then: 5, wantThen: 0, wantKey: "key:ci",
+		},
+		{
+			name:   "tenant",
+			limits: RateLimits{Default: &Limit{Rate: Rate{N: 10, Per: time.Minute}}, Tenants: map[string]Limit{"payments": {Rate: Rate{N: 2, Per: time.Minute}}}},
+			client: "key:ci", tenant: "payments", n: 5, want: 2, wantKey: "tenant:payments",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, advance := fakeNow(tt.limits)
+			got, last := allowed(l, tt.n, tt.client, tt.tenant)
+			if got != tt.want {
+				t.Errorf("allowed %d of %d, want %d", got, tt.n, tt.want)
+			}
+			if tt.wantKey != "" && (last == nil || last.Key != tt.wantKey || last.RetryAfter <= 0) {
+				t.Errorf("refusal = %+v, want one for %s with a wait", last, tt.wantKey)
+			}
+			if tt.then > 0 {
+				advance(tt.advance)
+				if got, _ := allowed(l, tt.then, tt.client, tt.tenant); got != tt.wantThen {
+					t.Errorf("allowed %d of %d after %s, want %d", got, tt.then, tt.advance, tt.wantThen)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterTenantRefund(t *testing.T) {
+	l, advance := fakeNow(RateLimits{
+		Clients: map[string]Limit{"key:a": {Rate: Rate{N: 2, Per: time.Minute}}},
+		Tenants: map[string]Limit{"payments": {Rate: Rate{N: 1, Per: time.Minute}}},
+	})
+	if err := l.Allow("key:a", "payments"); err != nil {
+		t.Fatal(err)
+	}
+	// The tenant is out, so key:a's token is given back...
+	if err := l.Allow("key:a", "payments"); err == nil {
+		t.Fatal("Allow() over the tenant limit succeeded")
+	}
+	// ...and it can still spend it outside the tenant.
+	if err := l.Allow("key:a", ""); err != nil {
+		t.Errorf("Allow() after a refund error = %v", err)
+	}
+
+	// A new tenant limit takes effect at once.
+	if err := l.SetTenantLimit("payments", Limit{Rate: Rate{N: 5, Per: time.Minute}}); err != nil {
+		t.Fatal(err)
+	}
+	advance(time.Minute)
+	if got, _ := allowed(l, 5, "key:b", "payments"); got != 5 {
+		t.Errorf("allowed %d after raising the tenant limit, want 5", got)
+	}
+	if err := l.SetTenantLimit("payments", Limit{}); err == nil {
+		t.Error("SetTenantLimit() without a rate succeeded")
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	l, advance := fakeNow(RateLimits{Default: &Limit{Rate: Rate{N: 1, Per: time.Second}}})
+	for _, c := range []string{"ip:a", "ip:b", "ip:c"} {
+		l.Allow(c, "")
+	}
+	advance(sweepInterval)
+	l.Allow("ip:d", "")
+	if len(l.buckets) != 1 {
+		t.Errorf("%d buckets after a sweep, want only the new client's", len(l.buckets))
+	}
+}
+
+func TestRateLimitedRequest(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.RateLimiter, _ = fakeNow(RateLimits{Default: &Limit{Rate: Rate{N: 1, Per: time.Minute}}})
+	if w := serve(s, "GET", "/v1/triggers", "", nil); w.Code != http.StatusOK {
+		t.Fatalf("first request status = %d", w.Code)
+	}
+	w := serve(s, "GET", "/v1/triggers", "", nil)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" {
+		t.Errorf("second request = %d with Retry-After %q, want 429 and 60", w.Code, w.Header().Get("Retry-After"))
+	}
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// scopeRole is the role a caller needs for what a scope allows.
+var scopeRole = map[string]string{ScopeRead: flow.RoleViewer, ScopeTrigger: flow.RoleTriggerer, ScopeAdmin: flow.RoleAdmin}
+
+func (s *Server) rbacRoutes() {
+	s.mux.HandleFunc("GET /v1/roles", s.authorize(ScopeAdmin, s.handleListRoles))
+	s.mux.HandleFunc("PUT /v1/roles", s.authorize(ScopeAdmin, s.signed(SourceAPI, true, s.handleSetRoles)))
+}
+
+// bindings returns the role bindings in force: the registry's, and for a
+// tenant those of the server's registry that extend to it.
+func (s *Server) bindings() []flow.RoleBinding {
+	bindings := s.Registry.RoleBindings()
+	if s.parent != nil {
+		for _, b := range s.parent.Registry.RoleBindings() {
+			if b.AppliesTo(s.Tenant) {
+				bindings = append(bindings, b)
+			}
+		}
+	}
+	return bindings
+}
+
+// can reports whether the caller in ctx holds the role scope requires in
+// repo, or over the whole server if repo is empty. Without role bindings
+// the credential's scopes alone decide and every caller can.
+func (s *Server) can(ctx context.Context, scope, repo string) bool {
+	bindings := s.bindings()
+	if len(bindings) == 0 {
+		return true
+	}
+	p, ok := PrincipalFromContext(ctx)
+	if !ok {
+		return false
+	}
+	for _, b := range bindings {
+		if b.Grants(p.Subject, scopeRole[scope], repo) {
+			return true
+		}
+	}
+	return false
+}
+
+// canAny reports whether p holds the role scope requires anywhere, which
+// every API call checks before looking at repositories.
+func (s *Server) canAny(p *Principal, scope string) bool {
+	bindings := s.bindings()
+	if len(bindings) == 0 {
+		return true
+	}
+	for _, b := range bindings {
+		if b.GrantsAny(p.Subject, scopeRole[scope]) {
+			return true
+		}
+	}
+	return false
+}
+
+// forbidden writes the 403 of a caller lacking a role in repo.
+func forbidden(w http.ResponseWriter, r *http.Request, scope, repo string) {
+	writeError(w, http.StatusForbidden, roleError(r.Context(), scope, repo).Error())
+}
+
+// roleError describes a caller lacking the role scope requires in repo.
+func roleError(ctx context.Context, scope, repo string) error {
+	where := "on this server"
+	if repo != "" {
+		where = "in " + repo
+	}
+	who := subject(ctx)
+	if who == "" {
+		who = "anonymous"
+	}
+	return fmt.Errorf("%s is not a %s %s", who, scopeRole[scope], where)
+}
+
+func (s *Server) handleListRoles(w http.ResponseWriter, r *http.Request) {
+	if !s.can(r.Context(), ScopeAdmin, "") {
+		forbidden(w, r, ScopeAdmin, "")
+		return
+	}
+	writeJSON(w, http.StatusOK, nonNil(s.Registry.RoleBindings()))
+}
+
+// handleSetRoles replaces the registry's role bindings. It refuses
+// bindings that would leave the caller unable to change them back.
+func (s *Server) handleSetRoles(w http.ResponseWriter, r *http.Request) {
+	if !s.can(r.Context(), ScopeAdmin, "") {
+		forbidden(w, r, ScopeAdmin, "")
+		return
+	}
+	var bindings []flow.RoleBinding
+	if !decodeJSON(w, r, &bindings) {
+		return
+	}
+
+	s.regMu.Lock()
+	defer s.regMu.Unlock()
+	old := s.Registry.RoleBindings()
+	if err := s.Registry.SetRoleBindings(bindings); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !s.can(r.Context(), ScopeAdmin, "") {
+		s.Registry.SetRoleBindings(old)
+		writeError(w, http.StatusConflict, "the bindings would remove your own admin role")
+		return
+	}
+	if s.RegistryPath != "" {
+		if err := s.Registry.Save(s.RegistryPath); err != nil {
+			s.logf("api: save registry: %v", err)
+			writeError(w, http.StatusInternalServerError, "roles changed but failed to persist the registry")
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, nonNil(s.Registry.RoleBindings()))
+}
+
+// nonNil returns bindings, or an empty list so it encodes as [].
+func nonNil(bindings []flow.RoleBinding) []flow.RoleBinding {
+	if bindings == nil {
+		return []flow.RoleBinding{}
+	}
+	return bindings
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// newRBACServer returns a server whose keys all have the admin scope, so
+// that role bindings alone decide: ops is an admin, ci a triggerer in
+// Cdaprod/site, and reader a viewer.
+func newRBACServer(t *testing.T) *Server {
+	t.Helper()
+	s, gh := newTestServer(t)
+	gh.AddWorkflow("Cdaprod/other", "deploy.yml")
+	scopes := []string{ScopeRead, ScopeTrigger, ScopeAdmin}
+	s.Auth = APIKeys{
+		{Name: "ops", Key: []byte("ops-key"), Scopes: scopes},
+		{Name: "ci", Key: []byte("ci-key"), Scopes: scopes},
+		{Name: "reader", Key: []byte("reader-key"), Scopes: scopes},
+		{Name: "stranger", Key: []byte("stranger-key"), Scopes: scopes},
+	}
+	s.RegistryPath = filepath.Join(t.TempDir(), "registry.yml")
+	if err := s.Registry.SetRoleBindings([]flow.RoleBinding{
+		{Role: flow.RoleAdmin, Subjects: []string{"key:ops"}},
+		{Role: flow.RoleTriggerer, Subjects: []string{"key:ci"}, Repos: []string{"Cdaprod/site"}},
+		{Role: flow.RoleViewer, Subjects: []string{"key:reader"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func bearer(key string) map[string]string {
+	return map[string]string{"Authorization": "Bearer " + key}
+}
+
+func TestRBAC(t *testing.T) {
+	trigger := func(repo string) string {
+		return `{"repo": "` + repo + `", "workflow": "deploy.yml"}`
+	}
+	tests := []struct {
+		name       string
+		key        string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantError  string
+	}{
+		{name: "triggerer in its repo", key: "ci-key", method: "POST", path: "/v1/triggers", body: trigger("Cdaprod/site"), wantStatus: http.StatusAccepted},
+		{name: "triggerer elsewhere", key: "ci-key", method: "POST", path: "/v1/triggers", body: trigger("Cdaprod/other"), wantStatus: http.StatusForbidden, wantError: "key:ci is not a triggerer in Cdaprod/other"},
+		{name: "admin anywhere", key: "ops-key", method: "POST", path: "/v1/triggers", body: trigger("Cdaprod/other"), wantStatus: http.StatusAccepted},
+		{name: "viewer triggering", key: "reader-key", method: "POST", path: "/v1/triggers", body: trigger("Cdaprod/site"), wantStatus: http.StatusForbidden, wantError: "key:reader has no role allowing trigger"},
+		{name: "viewer reading", key: "reader-key", method: "GET", path: "/v1/triggers", wantStatus: http.StatusOK},
+		{name: "unbound caller", key: "stranger-key", method: "GET", path: "/v1/triggers", wantStatus: http.StatusForbidden, wantError: "key:stranger has no role allowing read"},
+		{name: "triggerer reading elsewhere", key: "ci-key", method: "GET", path: "/v1/triggers?repo=Cdaprod/other", wantStatus: http.StatusForbidden, wantError: "key:ci is not a viewer in Cdaprod/other"},
+		{name: "admin listing roles", key: "ops-key", method: "GET", path: "/v1/roles", wantStatus: http.StatusOK},
+		{name: "triggerer listing roles", key: "ci-key", method: "GET", path: "/v1/roles", wantStatus: http.StatusForbidden},
+		{name: "viewer listing roles", key: "reader-key", method: "GET", path: "/v1/roles", wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newRBACServer(t)
+			w := serve(s, tt.method, tt.path, tt.body, bearer(tt.key))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantError != "" && !strings.Contains(w.Body.String(), tt.wantError) {
+				t.Errorf("body = %s, want %q", w.Body, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestRBACVisibleRecords(t *testing.T) {
+	s := newRBACServer(t)
+	for _, repo := range []string{"Cdaprod/site", "Cdaprod/other"} {
+		if w := serve(s, "POST", "/v1/triggers", `{"repo": "`+repo+`", "workflow": "deploy.yml"}`, bearer("ops-key")); w.Code != http.StatusAccepted {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+	}
+	tests := []struct {
+		key  string
+		want int
+	}{
+		{key: "ops-key", want: 2},
+		{key: "reader-key", want: 2},
+		{key: "ci-key", want: 1},
+	}
+	for _, tt := range tests {
+		var recs []flow.DispatchRecord
+		w := serve(s, "GET", "/v1/triggers", "", bearer(tt.key))
+		if err := json.Unmarshal(w.Body.Bytes(), &recs); err != nil || len(recs) != tt.want {
+			t.Errorf("%s sees %s, want %d records", tt.key, w.Body, tt.want)
+		}
+	}
+}
+
+func TestSetRoles(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantRoles  int
+	}{
+		{name: "replaced", body: `[{"role": "admin", "subjects": ["key:ops"]}, {"role": "viewer", "subjects": ["key:ci"]}]`, wantStatus: http.StatusOK, wantRoles: 2},
+		{name: "own admin removed", body: `[{"role": "admin", "subjects": ["key:ci"]}]`, wantStatus: http.StatusConflict, wantRoles: 3},
+		{name: "own admin narrowed", body: `[{"role": "admin", "subjects": ["key:ops"], "repos": ["Cdaprod/*"]}]`, wantStatus: http.StatusConflict, wantRoles: 3},
+		{name: "invalid", body: `[{"role": "owner", "subjects": ["key:ops"]}]`, wantStatus: http.StatusBadRequest, wantRoles: 3},
+		{name: "not json", body: `roles`, wantStatus: http.StatusBadRequest, wantRoles: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newRBACServer(t)
+			w := serve(s, "PUT", "/v1/roles", tt.body, bearer("ops-key"))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if n := len(s.Registry.RoleBindings()); n != tt.wantRoles {
+				t.Errorf("%d bindings in force, want %d", n, tt.wantRoles)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			saved, err := flow.LoadRegistry(s.RegistryPath)
+			if err != nil || len(saved.RoleBindings()) != tt.wantRoles {
+				t.Errorf("persisted registry = %v, %v; want the new bindings", saved, err)
+			}
+		})
+	}
+
+	s := newRBACServer(t)
+	if w := serve(s, "PUT", "/v1/roles", `[]`, bearer("ci-key")); w.Code != http.StatusForbidden {
+		t.Errorf("PUT /v1/roles by a triggerer status = %d, want 403", w.Code)
+	}
+}
+
+func TestTenantRoleBindings(t *testing.T) {
+	s := newRBACServer(t)
+	addTestTenant(t, s, "team-a")
+	addTestTenant(t, s, "team-b")
+	if err := s.Registry.Grant("key:ci", flow.RoleBinding{Role: flow.RoleViewer, Tenants: []string{"team-a"}}); err != nil {
+		t.Fatal(err)
+	}
+	// A tenant without bindings of its own or extended to it is open to
+	// every caller, so team-b binds its own admin.
+	if err := s.tenants["team-b"].Registry.Grant("key:ops", flow.RoleBinding{Role: flow.RoleAdmin}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		key        string
+		path       string
+		wantStatus int
+	}{
+		{key: "ci-key", path: "/t/team-a/v1/triggers", wantStatus: http.StatusOK},
+		{key: "ci-key", path: "/t/team-b/v1/triggers", wantStatus: http.StatusForbidden},
+		{key: "ops-key", path: "/t/team-b/v1/triggers", wantStatus: http.StatusOK},
+		// The server's admin binding names no tenants, so it stays home.
+		{key: "ops-key", path: "/t/team-a/v1/triggers", wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if w := serve(s, "GET", tt.path, "", bearer(tt.key)); w.Code != tt.wantStatus {
+			t.Errorf("%s GET %s status = %d, want %d: %s", tt.key, tt.path, w.Code, tt.wantStatus, w.Body)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+// Package server runs the dispatcher as a long-lived HTTP service.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// shutdownTimeout bounds how long in-flight requests may take after the
+// server is asked to stop.
+const shutdownTimeout = 10 * time.Second
+
+// Server serves the dispatcher's HTTP endpoints.
+type Server struct {
+	Addr       string
+	Correlator *flow.RunCorrelator
+	Registry   *flow.RepositoryRegistry
+	// Router, if set, maps webhook events to dispatches.
+	Router *flow.EventRouter
+	// RegistryPath, if set, is where repositories registered through the
+	// API are persisted.
+	RegistryPath string
+	// Signatures holds the secrets requests are verified with, keyed by
+	// source. Deliveries from a source without an entry are rejected.
+	Signatures map[string]*SignatureSource
+	// AllowUnsigned accepts webhooks from sources without secrets. It is
+	// meant for local development only.
+	AllowUnsigned bool
+	// Auth, if set, authenticates REST callers and checks their scopes.
+	// The gRPC service always requires it.
+	Auth Authenticator
+	// RateLimiter, if set, limits REST and gRPC calls per client and
+	// tenant. Webhooks and the health endpoints are not limited.
+	RateLimiter *RateLimiter
+	// Metrics, if set, counts requests and follows dispatches for
+	// Prometheus, including those of tenants.
+	Metrics *Metrics
+	// TokenProvider, if set, is re-checked by /readyz so a token that can no
+	// longer be resolved marks the server unready.
+	TokenProvider flow.TokenProvider
+	// SLOs are the latency objectives GET /v1/slo checks dispatches
+	// against. Without them it reports latencies only.
+	SLOs []flow.SLO
+	// Version is reported by /version; empty means the module version.
+	Version string
+	// Logger receives request and webhook errors; nil means log.Default().
+	Logger *log.Logger
+	// Tenant names the tenant a server added with AddTenant serves.
+	// Callers belonging to other tenants are refused.
+	Tenant string
+	// TLS, if set, serves HTTPS, and with ClientCAs mutual TLS; see
+	// flow.TLSConfig.ServerConfig.
+	TLS *tls.Config
+	// Queue, if set, runs the dispatches routed from events, bounding how
+	// many wait and are sent at once. Tenants share it. The server does
+	// not close it. Without it every event's dispatches start at once.
+	Queue *flow.DispatchQueue
+
+	mux        *http.ServeMux
+	tenants    map[string]*Server
+	parent     *Server
+	regMu      sync.Mutex
+	background sync.WaitGroup
+	// closing is closed at shutdown to end event streams.
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+// New creates a Server listening on addr. The correlator is given an
+// EventBus if it has none, so its events can be streamed.
+func New(addr string, correlator *flow.RunCorrelator, registry *flow.RepositoryRegistry) *Server {
+	if registry == nil {
+		registry = flow.NewRepositoryRegistry()
+	}
+	if correlator.Events == nil {
+		correlator.Events = flow.NewEventBus()
+	}
+	s := &Server{Addr: addr, Correlator: correlator, Registry: registry, mux: http.NewServeMux(), closing: make(chan struct{})}
+	s.routes()
+	return s
+}
+
+func (s *Server) routes() {
+	s.mux.HandleFunc("POST /webhook", s.signed(SourceGitHub, false, s.handleWebhook))
+	s.mux.HandleFunc("POST /webhooks/{source}", s.signed("", false, s.handleGenericWebhook))
+	s.mux.HandleFunc("POST /cloudevents", s.signed(SourceCloudEvents, false, s.handleCloudEvent))
+	s.apiRoutes()
+	s.deadLetterRoutes()
+	s.approvalRoutes()
+	s.sloRoutes()
+	s.rbacRoutes()
+	s.healthRoutes()
+	s.openAPIRoutes()
+}
+
+// Handle registers an additional handler, such as a chat integration, on
+// the server's mux.
+func (s *Server) Handle(pattern string, h http.Handler) {
+	s.mux.Handle(pattern, h)
+}
+
+// Handler returns the server's HTTP handler.
+func (s *Server) Handler() http.Handler {
+	var h http.Handler = s.mux
+	if len(s.tenants) > 0 {
+		s.shareWithTenants()
+		h = http.HandlerFunc(s.routeTenant)
+	}
+	h = traced(h)
+	if s.Metrics != nil {
+		h = s.Metrics.instrument(h)
+	}
+	return correlated(h)
+}
+
+// ListenAndServe serves until ctx is cancelled, then shuts down gracefully.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve serves on ln until ctx is cancelled, then shuts down gracefully.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	srv := &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	// Event streams never go idle, so end them when shutdown begins.
+	srv.RegisterOnShutdown(func() {
+		s.closeOnce.Do(func() { close(s.closing) })
+		for _, t := range s.tenants {
+			t.closeOnce.Do(func() { close(t.closing) })
+		}
+	})
+	if s.Metrics != nil {
+		s.Metrics.watch(ctx, s)
+		for _, t := range s.tenants {
+			s.Metrics.watch(ctx, t)
+		}
+	}
+	errc := make(chan error, 1)
+	go func() {
+		if s.TLS == nil {
+			errc <- srv.Serve(ln)
+			return
+		}
+		srv.TLSConfig = s.TLS
+		errc <- srv.ServeTLS(ln, "", "")
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := srv.Shutdown(shutdownCtx)
+	// Let dispatches started by webhooks finish before returning.
+	s.background.Wait()
+	for _, t := range s.tenants {
+		t.background.Wait()
+	}
+	if err != nil {
+		return err
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	l := s.Logger
+	if l == nil {
+		l = log.Default()
+	}
+	l.Printf(format, args...)
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// Signature sources with a fixed meaning.
+const (
+	// SourceGitHub verifies deliveries to /webhook.
+	SourceGitHub = "github"
+	// SourceAPI, if configured, verifies REST requests that change state.
+	SourceAPI = "api"
+)
+
+// SignatureScheme describes how a source signs its requests: an HMAC of the
+// raw body, optionally prefixed, in a header.
+type SignatureScheme struct {
+	Header    string `yaml:"header"`
+	Prefix    string `yaml:"prefix"`
+	Algorithm string `yaml:"algorithm"` // sha256 (default), sha1, or sha512
+	Encoding  string `yaml:"encoding"`  // hex (default) or base64
+}
+
+// GitHubScheme is the scheme GitHub uses for webhook deliveries.
+var GitHubScheme = SignatureScheme{Header: "X-Hub-Signature-256", Prefix: "sha256=", Algorithm: "sha256", Encoding: "hex"}
+
+// SignatureSource is a scheme with the secrets accepted for it. Several
+// secrets may be listed so they can be rotated without downtime.
+type SignatureSource struct {
+	Scheme  SignatureScheme
+	Secrets [][]byte
+}
+
+// sourceConfig is one entry of a signatures file.
+type sourceConfig struct {
+	SignatureScheme `yaml:",inline"`
+	Secrets         []string `yaml:"secrets"`
+}
+
+// LoadSignatureSources reads a signatures file. Secrets use the token source
+// syntax (env:VAR, file:PATH, command:CMD) so they are never stored inline.
+// Sources without a header use the GitHub scheme.
+//
+//	sources:
+//	  github:
+//	    secrets: [env:GITHUB_WEBHOOK_SECRET]
+//	  jenkins:
+//	    header: X-Jenkins-Signature
+//	    encoding: base64
+//	    secrets: [file:/run/secrets/jenkins]
+func LoadSignatureSources(ctx context.Context, path string) (map[string]*SignatureSource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Sources map[string]sourceConfig `yaml:"sources"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse signatures %s: %w", path, err)
+	}
+	out := make(map[string]*SignatureSource, len(file.Sources))
+	for name, cfg := range file.Sources {
+		scheme := cfg.SignatureScheme
+		if scheme.Header == "" {
+			scheme = GitHubScheme
+		}
+		src, err := NewSignatureSource(ctx, scheme, cfg.Secrets...)
+		if err != nil {
+			return nil, fmt.Errorf("%s: source %s: %w", path, name, err)
+		}
+		out[name] = src
+	}
+	return out, nil
+}
+
+// NewSignatureSource resolves secret sources and validates scheme.
+func NewSignatureSource(ctx context.Context, scheme SignatureScheme, secretSources ...string) (*SignatureSource, error) {
+	if _, err := scheme.hash(); err != nil {
+		return nil, err
+	}
+	if scheme.Encoding != "" && scheme.Encoding != "hex" && scheme.Encoding != "base64" {
+		return nil, fmt.Errorf("unknown encoding %q", scheme.Encoding)
+	}
+	if len(secretSources) == 0 {
+		return nil, fmt.Errorf("no secrets configured")
+	}
+	src := &SignatureSource{Scheme: scheme}
+	for _, s := range secretSources {
+		tp, err := flow.ParseTokenSource(s)
+		if err != nil {
+			return nil, err
+		}
+		secret, err := tp.Token(ctx)
+		if err != nil {
+			return nil, err
+		}
+		src.Secrets = append(src.Secrets, []byte(secret))
+	}
+	return src, nil
+}
+
+func (s SignatureScheme) hash() (func() hash.Hash, error) {
+	switch s.Algorithm {
+	case "", "sha256":
+		return sha256.New, nil
+	case "sha512":
+		return sha512.New, nil
+	case "sha1":
+		return sha1.New, nil
+	}
+	return nil, fmt.Errorf("unknown algorithm %q", s.Algorithm)
+}
+
+// Verify reports whether header carries a valid signature of body for any
+// of the source's secrets. Comparisons are constant-time.
+func (src *SignatureSource) Verify(header string, body []byte) bool {
+	sig, ok := strings.CutPrefix(header, src.Scheme.Prefix)
+	if !ok || sig == "" {
+		return false
+	}
+	var got []byte
+	var err error
+	if src.Scheme.Encoding == "base64" {
+		got, err = base64.StdEncoding.DecodeString(sig)
+	} else {
+		got, err = hex.DecodeString(sig)
+	}
+	if err != nil {
+		return false
+	}
+	newHash, _ := src.Scheme.hash()
+	valid := false
+	for _, secret := range src.Secrets {
+		mac := hmac.New(newHash, secret)
+		mac.Write(body)
+		// Check every secret so timing does not reveal which one matched.
+		if hmac.Equal(got, mac.Sum(nil)) {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// signed wraps next so it only runs for requests signed for source. If
+// source is empty it is taken from the {source} path segment. Requests for
+// unconfigured sources are rejected unless AllowUnsigned is set; if optional
+// is set they are let through instead.
+func (s *Server) signed(source string, optional bool, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := source
+		if name == "" {
+			name = r.PathValue("source")
+		}
+		if s.checkSignature(w, r, name, optional) {
+			next(w, r)
+		}
+	}
+}
+
+// checkSignature verifies r against the named source, writing an error
+// response and returning false if it fails. The verified body is restored
+// for the next handler.
+func (s *Server) checkSignature(w http.ResponseWriter, r *http.Request, name string, optional bool) bool {
+	src := s.Signatures[name]
+	if src == nil {
+		if optional || s.AllowUnsigned {
+			return true
+		}
+		writeError(w, http.StatusUnauthorized, "no signature secret configured for source "+name)
+		return false
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+		return false
+	}
+	if !src.Verify(r.Header.Get(src.Scheme.Header), body) {
+		s.logf("rejected request to %s with a bad %s signature from %s", r.URL.Path, name, r.RemoteAddr)
+		writeError(w, http.StatusUnauthorized, "invalid signature")
+		return false
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return true
+}
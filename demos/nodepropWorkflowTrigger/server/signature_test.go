@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func sign(newHash func() hash.Hash, secret string, body []byte) []byte {
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+func TestSignatureSourceVerify(t *testing.T) {
+	body := []byte(`{"action": "built"}`)
+	github := &SignatureSource{Scheme: GitHubScheme, Secrets: [][]byte{[]byte("old"), []byte("new")}}
+	tests := []struct {
+		name   string
+		src    *SignatureSource
+		header string
+		want   bool
+	}{
+		{name: "github", src: github, header: "sha256=" + hmacHex("new", string(body)), want: true},
+		{name: "rotated secret", src: github, header: "sha256=" + hmacHex("old", string(body)), want: true},
+		{name: "unknown secret", src: github, header: "sha256=" + hmacHex("other", string(body))},
+		{name: "other body", src: github, header: "sha256=" + hmacHex("new", "{}")},
+		{name: "missing prefix", src: github, header: hmacHex("new", string(body))},
+		{name: "empty signature", src: github, header: "sha256="},
+		{name: "no header", src: github},
+		{name: "not hex", src: github, header: "sha256=zz"},
+		{name: "truncated", src: github, header: "sha256=" + hmacHex("new", string(body))[:32]},
+		{
+			name:   "sha1",
+			src:    &SignatureSource{Scheme: SignatureScheme{Header: "X-Hub-Signature", Prefix: "sha1=", Algorithm: "sha1"}, Secrets: [][]byte{[]byte("s")}},
+			header: "sha1=" + hex.EncodeToString(sign(sha1.New, "s", body)),
+			want:   true,
+		},
+		{
+			name:   "sha512 base64",
+			src:    &SignatureSource{Scheme: SignatureScheme{Header: "X-Sig", Algorithm: "sha512", Encoding: "base64"}, Secrets: [][]byte{[]byte("s")}},
+			header: base64.StdEncoding.EncodeToString(sign(sha512.New, "s", body)),
+			want:   true,
+		},
+		{
+			name:   "wrong algorithm",
+			src:    &SignatureSource{Scheme: SignatureScheme{Header: "X-Sig", Algorithm: "sha512"}, Secrets: [][]byte{[]byte("s")}},
+			header: hmacHex("s", string(body)),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.src.Verify(tt.header, body); got != tt.want {
+				t.Errorf("Verify(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewSignatureSource(t *testing.T) {
+	t.Setenv("NODEPROP_TEST_SECRET", "s3cret")
+	tests := []struct {
+		name    string
+		scheme  SignatureScheme
+		secrets []string
+		wantErr string
+	}{
+		{name: "github", scheme: GitHubScheme, secrets: []string{"env:NODEPROP_TEST_SECRET"}},
+		{name: "unknown algorithm", scheme: SignatureScheme{Header: "X", Algorithm: "md5"}, secrets: []string{"env:NODEPROP_TEST_SECRET"}, wantErr: `unknown algorithm "md5"`},
+		{name: "unknown encoding", scheme: SignatureScheme{Header: "X", Encoding: "base32"}, secrets: []string{"env:NODEPROP_TEST_SECRET"}, wantErr: `unknown encoding "base32"`},
+		{name: "no secrets", scheme: GitHubScheme, wantErr: "no secrets"},
+		{name: "inline secret", scheme: GitHubScheme, secrets: []string{"s3cret"}, wantErr: "invalid token source"},
+		{name: "unset secret", scheme: GitHubScheme, secrets: []string{"env:NODEPROP_TEST_UNSET"}, wantErr: "is set"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := NewSignatureSource(context.Background(), tt.scheme, tt.secrets...)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("NewSignatureSource() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || string(src.Secrets[0]) != "s3cret" {
+				t.Errorf("NewSignatureSource() = %+v, %v", src, err)
+			}
+		})
+	}
+}
+
+func TestLoadSignatureSources(t *testing.T) {
+	t.Setenv("NODEPROP_TEST_SECRET", "s3cret")
+	path := filepath.Join(t.TempDir(), "signatures.yml")
+	config := `sources:
+  github:
+    secrets: [env:NODEPROP_TEST_SECRET]
+  jenkins:
+    header: X-Jenkins-Signature
+    encoding: base64
+    secrets: [env:NODEPROP_TEST_SECRET]
+`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	sources, err := LoadSignatureSources(context.Background(), path)
+	if err != nil {
+		t.Fatalf("LoadSignatureSources() error = %v", err)
+	}
+	if got := sources["github"].Scheme; got != GitHubScheme {
+		t.Errorf("github scheme = %+v, want the GitHub scheme", got)
+	}
+	if got := sources["jenkins"].Scheme; got.Header != "X-Jenkins-Signature" || got.Encoding != "base64" {
+		t.Errorf("jenkins scheme = %+v", got)
+	}
+
+	if err := os.WriteFile(path, []byte("sources:\n  x:\n    algorithm: md5\n    header: X\n    secrets: [env:NODEPROP_TEST_SECRET]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSignatureSources(context.Background(), path); err == nil || !strings.Contains(err.Error(), "source x") {
+		t.Errorf("LoadSignatureSources() of a bad source error = %v", err)
+	}
+}
+
+func TestSignedRequests(t *testing.T) {
+	body := `{"repo": "Cdaprod/site", "workflow": "deploy.yml"}`
+	tests := []struct {
+		name       string
+		path       string
+		header     map[string]string
+		api        bool
+		wantStatus int
+	}{
+		{name: "webhook signed", path: "/webhook", header: map[string]string{"X-GitHub-Event": "ping", "X-Hub-Signature-256": "sha256=" + hmacHex("s3cret", body)}, wantStatus: http.StatusNoContent},
+		{name: "webhook unsigned", path: "/webhook", header: map[string]string{"X-GitHub-Event": "ping"}, wantStatus: http.StatusUnauthorized},
+		{name: "webhook badly signed", path: "/webhook", header: map[string]string{"X-GitHub-Event": "ping", "X-Hub-Signature-256": "sha256=" + hmacHex("wrong", body)}, wantStatus: http.StatusUnauthorized},
+		{name: "api unsigned without a source", path: "/v1/triggers", wantStatus: http.StatusAccepted},
+		{name: "api unsigned with a source", path: "/v1/triggers", api: true, wantStatus: http.StatusUnauthorized},
+		{name: "api signed", path: "/v1/triggers", api: true, header: map[string]string{"X-Hub-Signature-256": "sha256=" + hmacHex("s3cret", body)}, wantStatus: http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+			s.Signatures = map[string]*SignatureSource{SourceGitHub: {Scheme: GitHubScheme, Secrets: [][]byte{[]byte("s3cret")}}}
+			if tt.api {
+				s.Signatures[SourceAPI] = s.Signatures[SourceGitHub]
+			}
+			if w := serve(s, "POST", tt.path, body, tt.header); w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+		})
+	}
+
+	s, _ := newTestServer(t)
+	s.Signatures = map[string]*SignatureSource{SourceGitHub: {Scheme: GitHubScheme, Secrets: [][]byte{[]byte("s3cret")}}}
+	big := strings.Repeat("x", maxWebhookBody+1)
+	if w := serve(s, "POST", "/webhook", big, map[string]string{"X-GitHub-Event": "ping"}); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized delivery status = %d, want 413", w.Code)
+	}
+}
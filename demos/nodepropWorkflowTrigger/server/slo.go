@@ -0,0 +1,53 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// defaultSLOWindow is how far back GET /v1/slo looks without ?since.
+const defaultSLOWindow = 24 * time.Hour
+
+func (s *Server) sloRoutes() {
+	s.mux.HandleFunc("GET /v1/slo", s.authorize(ScopeRead, s.handleSLO))
+}
+
+// handleSLO reports dispatch latencies per workflow and their compliance
+// with s.SLOs. It takes the repo, since, and until parameters of GET
+// /v1/triggers, and workflow to report on one workflow.
+func (s *Server) handleSLO(w http.ResponseWriter, r *http.Request) {
+	q, err := historyQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if q.Until.IsZero() {
+		q.Until = time.Now()
+	}
+	if q.Since.IsZero() {
+		q.Since = q.Until.Add(-defaultSLOWindow)
+	}
+	q.Status, q.Limit = "", 0
+	if q.Repo != "" && !s.can(r.Context(), ScopeRead, q.Repo) {
+		forbidden(w, r, ScopeRead, q.Repo)
+		return
+	}
+	recs, err := flow.QueryHistory(s.Correlator.History, q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	report := flow.BuildLatencyReport(s.visibleRecords(r.Context(), recs), s.SLOs, q.Since, q.Until)
+	if workflow := r.URL.Query().Get("workflow"); workflow != "" {
+		var only []flow.WorkflowLatency
+		for _, wl := range report.Workflows {
+			if wl.Workflow == workflow {
+				only = append(only, wl)
+			}
+		}
+		report.Workflows = append([]flow.WorkflowLatency{}, only...)
+	}
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+func TestHandleSLO(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.SLOs = []flow.SLO{{Name: "fast-start", StartLatency: time.Minute}}
+	at := time.Now().Add(-time.Hour).UTC()
+	for i, rec := range []flow.DispatchRecord{
+		{Repo: "Cdaprod/site", Workflow: "deploy.yml", RunStartedAt: at.Add(10 * time.Second)},
+		{Repo: "Cdaprod/site", Workflow: "deploy.yml", RunStartedAt: at.Add(5 * time.Minute)},
+		{Repo: "Cdaprod/site", Workflow: "test.yml", RunStartedAt: at.Add(10 * time.Second)},
+		{Repo: "Cdaprod/other", Workflow: "deploy.yml", RunStartedAt: at.Add(10 * time.Second)},
+		{Repo: "Cdaprod/site", Workflow: "deploy.yml", DispatchedAt: at.Add(-48 * time.Hour), RunStartedAt: at.Add(-47 * time.Hour)},
+	} {
+		rec.ID = string(rune('a' + i))
+		if rec.DispatchedAt.IsZero() {
+			rec.DispatchedAt = at
+		}
+		if err := s.Correlator.History.Append(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		want       map[string]int
+		wantOK     bool
+	}{
+		{path: "/v1/slo", wantStatus: http.StatusOK, want: map[string]int{"deploy.yml": 3, "test.yml": 1}},
+		{path: "/v1/slo?repo=Cdaprod/site", wantStatus: http.StatusOK, want: map[string]int{"deploy.yml": 2, "test.yml": 1}},
+		{path: "/v1/slo?workflow=test.yml", wantStatus: http.StatusOK, want: map[string]int{"test.yml": 1}, wantOK: true},
+		{path: "/v1/slo?workflow=missing.yml", wantStatus: http.StatusOK, want: map[string]int{}, wantOK: true},
+		{path: "/v1/slo?since=" + at.Add(-72*time.Hour).Format(time.RFC3339), wantStatus: http.StatusOK, want: map[string]int{"deploy.yml": 4, "test.yml": 1}},
+		{path: "/v1/slo?since=yesterday", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := serve(s, "GET", tt.path, "", nil)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var report flow.LatencyReport
+			if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil || report.Workflows == nil {
+				t.Fatalf("body = %s, %v", w.Body, err)
+			}
+			got := map[string]int{}
+			for _, wl := range report.Workflows {
+				got[wl.Workflow] = wl.Dispatches
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("workflows = %v, want %v", got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("workflows = %v, want %v", got, tt.want)
+				}
+			}
+			if report.OK() != tt.wantOK {
+				t.Errorf("OK() = %v, want %v", report.OK(), tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// tenantPrefix selects a tenant by path, as in /t/payments/v1/triggers.
+const tenantPrefix = "/t/"
+
+// AddTenant adds a tenant with its own correlator and registry, served
+// under /t/{name}/ and to callers whose credentials name the tenant. The
+// returned Server holds the tenant's RegistryPath, Router, Signatures, and
+// TokenProvider; it shares Auth, RateLimiter, AllowUnsigned, Version, and
+// Logger with s.
+func (s *Server) AddTenant(name string, correlator *flow.RunCorrelator, registry *flow.RepositoryRegistry) *Server {
+	t := New(s.Addr, correlator, registry)
+	t.Tenant = name
+	t.parent = s
+	if s.tenants == nil {
+		s.tenants = map[string]*Server{}
+	}
+	s.tenants[name] = t
+	return t
+}
+
+// shareWithTenants copies the settings tenants inherit, which may have been
+// changed since AddTenant.
+func (s *Server) shareWithTenants() {
+	for _, t := range s.tenants {
+		t.Auth = s.Auth
+		t.RateLimiter = s.RateLimiter
+		t.AllowUnsigned = s.AllowUnsigned
+		t.Version = s.Version
+		t.Queue = s.Queue
+		if t.SLOs == nil {
+			t.SLOs = s.SLOs
+		}
+		t.Logger = s.Logger
+	}
+}
+
+// routeTenant serves a request with the tenant named by its path prefix or
+// its credentials, and with s otherwise.
+func (s *Server) routeTenant(w http.ResponseWriter, r *http.Request) {
+	if rest, ok := strings.CutPrefix(r.URL.Path, tenantPrefix); ok {
+		name, _, _ := strings.Cut(rest, "/")
+		t, ok := s.tenants[name]
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("unknown tenant %q", name))
+			return
+		}
+		tr := r.Clone(r.Context())
+		tr.URL.Path = strings.TrimPrefix(r.URL.Path, tenantPrefix+name)
+		tr.URL.RawPath = ""
+		t.mux.ServeHTTP(w, tr)
+		// Report the tenant's route without its name.
+		if method, pattern, ok := strings.Cut(tr.Pattern, " "); ok {
+			r.Pattern = method + " " + tenantPrefix + "{tenant}" + pattern
+		}
+		return
+	}
+	if t := s.tenantFor(r.Context(), bearerToken(r)); t != nil {
+		t.mux.ServeHTTP(w, r)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// tenantFor returns the tenant token's principal belongs to, or nil. Bad
+// credentials are rejected later by the handler.
+func (s *Server) tenantFor(ctx context.Context, token string) *Server {
+	if s.Auth == nil || token == "" {
+		return nil
+	}
+	p, err := s.Auth.Authenticate(ctx, token)
+	if err != nil || p.Tenant == "" {
+		return nil
+	}
+	return s.tenants[p.Tenant]
+}
+
+type tenantKey struct{}
+
+// forCall returns the tenant serving a gRPC call, or s.
+func (s *Server) forCall(ctx context.Context) *Server {
+	if t, ok := ctx.Value(tenantKey{}).(*Server); ok {
+		return t
+	}
+	return s
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+// addTestTenant adds a tenant dispatching to its own fake GitHub.
+func addTestTenant(t *testing.T, s *Server, name string) *nodeproptest.Server {
+	t.Helper()
+	gh := nodeproptest.NewServer()
+	t.Cleanup(gh.Close)
+	gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+	c := flow.NewRunCorrelator(gh.Client(), flow.NewFileHistoryStore(filepath.Join(t.TempDir(), name+".json")))
+	c.Logger = slogDiscard
+	s.AddTenant(name, c, nil)
+	return gh
+}
+
+func TestTenantRouting(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		key        string
+		wantStatus int
+		// dispatchedBy is the tenant whose GitHub got the dispatch, "" for
+		// the server's own.
+		dispatchedBy string
+	}{
+		{name: "default", path: "/v1/triggers", key: "ops-key", wantStatus: http.StatusAccepted},
+		{name: "by path", path: "/t/payments/v1/triggers", key: "ops-key", wantStatus: http.StatusAccepted, dispatchedBy: "payments"},
+		{name: "by credentials", path: "/v1/triggers", key: "ci-key", wantStatus: http.StatusAccepted, dispatchedBy: "payments"},
+		{name: "own tenant by path", path: "/t/payments/v1/triggers", key: "ci-key", wantStatus: http.StatusAccepted, dispatchedBy: "payments"},
+		{name: "another tenant", path: "/t/billing/v1/triggers", key: "ci-key", wantStatus: http.StatusForbidden},
+		{name: "unknown tenant", path: "/t/nobody/v1/triggers", key: "ops-key", wantStatus: http.StatusNotFound},
+		{name: "unauthenticated", path: "/t/payments/v1/triggers", wantStatus: http.StatusUnauthorized},
+		{name: "bad credentials", path: "/v1/triggers", key: "ci-ke", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, gh := newTestServer(t)
+			s.Auth = APIKeys{
+				{Name: "ci", Key: []byte("ci-key"), Scopes: []string{ScopeTrigger}, Tenant: "payments"},
+				{Name: "ops", Key: []byte("ops-key"), Scopes: []string{ScopeAdmin}},
+			}
+			fakes := map[string]*nodeproptest.Server{
+				"":         gh,
+				"payments": addTestTenant(t, s, "payments"),
+				"billing":  addTestTenant(t, s, "billing"),
+			}
+
+			var header map[string]string
+			if tt.key != "" {
+				header = map[string]string{"X-API-Key": tt.key}
+			}
+			w := serve(s, "POST", tt.path, `{"repo": "Cdaprod/site", "workflow": "deploy.yml"}`, header)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			for name, fake := range fakes {
+				want := 0
+				if w.Code == http.StatusAccepted && name == tt.dispatchedBy {
+					want = 1
+				}
+				if n := len(fake.Dispatches()); n != want {
+					t.Errorf("tenant %q got %d dispatches, want %d", name, n, want)
+				}
+			}
+		})
+	}
+}
+
+func TestTenantSharesSettings(t *testing.T) {
+	s, _ := newTestServer(t)
+	addTestTenant(t, s, "payments")
+	// Set after AddTenant, so the tenant only sees it through Handler.
+	s.RateLimiter = NewRateLimiter(RateLimits{Tenants: map[string]Limit{"payments": {Rate: Rate{N: 1, Per: time.Hour}}}})
+
+	if w := serve(s, "GET", "/t/payments/v1/triggers", "", nil); w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	if w := serve(s, "GET", "/t/payments/v1/triggers", "", nil); w.Code != http.StatusTooManyRequests {
+		t.Errorf("status over the tenant's limit = %d, want 429", w.Code)
+	}
+	if w := serve(s, "GET", "/v1/triggers", "", nil); w.Code != http.StatusOK {
+		t.Errorf("status outside the tenant = %d, want 200", w.Code)
+	}
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTraced(t *testing.T) {
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	tests := []struct {
+		name       string
+		body       string
+		parent     bool
+		wantName   string
+		wantStatus codes.Code
+	}{
+		{name: "dispatched", body: `{"repo": "Cdaprod/site", "workflow": "deploy.yml"}`, wantName: "POST /v1/triggers"},
+		{name: "continues the caller's trace", body: `{"repo": "Cdaprod/site", "workflow": "deploy.yml"}`, parent: true, wantName: "POST /v1/triggers"},
+		{name: "server error", body: `{"repo": "Cdaprod/site", "workflow": "missing.yml"}`, wantName: "POST /v1/triggers", wantStatus: codes.Error},
+	}
+	oldProvider, oldPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	defer func() {
+		otel.SetTracerProvider(oldProvider)
+		otel.SetTextMapPropagator(oldPropagator)
+	}()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spans := tracetest.NewInMemoryExporter()
+			otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(spans)))
+			s, _ := newTestServer(t)
+			var header map[string]string
+			if tt.parent {
+				header = map[string]string{"traceparent": "00-" + traceID + "-00f067aa0ba902b7-01"}
+			}
+			w := serve(s, "POST", "/v1/triggers", tt.body, header)
+
+			var server sdktrace.ReadOnlySpan
+			var submits int
+			all := spans.GetSpans().Snapshots()
+			for _, s := range all {
+				if s.Name() == tt.wantName {
+					server = s
+				}
+			}
+			if server == nil {
+				t.Fatalf("no %s span among %d", tt.wantName, len(all))
+			}
+			for _, s := range all {
+				if s.Name() == "nodeprop.submit" && s.Parent().SpanID() == server.SpanContext().SpanID() {
+					submits++
+				}
+			}
+			if submits != 1 {
+				t.Errorf("server span has %d submit children, want 1", submits)
+			}
+			if got := server.SpanContext().TraceID().String(); tt.parent != (got == traceID) {
+				t.Errorf("trace ID = %s, continuing the caller's: %v", got, tt.parent)
+			}
+			if server.Status().Code != tt.wantStatus {
+				t.Errorf("span status = %v, want %v", server.Status(), tt.wantStatus)
+			}
+			var code int
+			for _, kv := range server.Attributes() {
+				if kv.Key == "http.response.status_code" {
+					code = int(kv.Value.AsInt64())
+				}
+			}
+			if code != w.Code {
+				t.Errorf("span status code = %d, response %d", code, w.Code)
+			}
+			if tt.wantStatus != codes.Error && w.Code != http.StatusAccepted {
+				t.Errorf("response status = %d", w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// maxWebhookBody caps the size of an accepted webhook payload.
+const maxWebhookBody = 5 << 20
+
+// routeTimeout bounds the dispatches started by a single delivery.
+const routeTimeout = 5 * time.Minute
+
+// queueRetryAfter is how long senders refused by a full Queue are asked to
+// wait.
+const queueRetryAfter = 30 * time.Second
+
+// webhookEvent is the subset of GitHub webhook payloads used here.
+type webhookEvent struct {
+	Action      string           `json:"action"`
+	Ref         string           `json:"ref"`
+	Branch      string           `json:"branch"`
+	WorkflowRun flow.WorkflowRun `json:"workflow_run"`
+	Repository  struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+}
+
+// routedResult is one entry of the webhook response body.
+type routedResult struct {
+	Rule     string `json:"rule"`
+	Repo     string `json:"repo"`
+	Workflow string `json:"workflow"`
+	Ref      string `json:"ref"`
+	FanOut   bool   `json:"fan_out,omitempty"`
+}
+
+// handleWebhook accepts GitHub webhook deliveries. workflow_run events for
+// runs started by nodeprop refresh the matching dispatch records; the payload
+// is only used to find the record and its state is re-read from the API.
+// Every event is then matched against the Router's rules and the resulting
+// dispatches run in the background.
+func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	eventType := r.Header.Get("X-GitHub-Event")
+	if eventType == "ping" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	var payload webhookEvent
+	if err := json.Unmarshal(body, &payload); err != nil {
+		http.Error(w, "invalid "+eventType+" payload", http.StatusBadRequest)
+		return
+	}
+
+	ev := flow.InboundEvent{
+		Type:     eventType,
+		Action:   payload.Action,
+		Repo:     payload.Repository.FullName,
+		Delivery: r.Header.Get("X-GitHub-Delivery"),
+	}
+	// The body already decoded above, so this cannot fail.
+	json.Unmarshal(body, &ev.Payload)
+	switch eventType {
+	case "push":
+		if b, ok := strings.CutPrefix(payload.Ref, "refs/heads/"); ok {
+			ev.Branch = b
+		}
+		// Rules with paths need the files the push changed. Without them
+		// those rules match, so a failed comparison dispatches too much
+		// rather than too little.
+		if s.Router != nil && s.Router.UsesPaths() && s.Correlator != nil {
+			files, err := s.Correlator.Client.PushChangedFiles(r.Context(), ev)
+			if err != nil {
+				s.logf("webhook: %s push %s: %v", ev.Repo, ev.Delivery, err)
+			}
+			ev.ChangedFiles = files
+		}
+	case "workflow_run":
+		ev.Branch = payload.WorkflowRun.HeadBranch
+		if err := s.refreshRun(r, payload); err != nil {
+			s.logf("webhook: %s run %d: %v", ev.Repo, payload.WorkflowRun.ID, err)
+		}
+	case "repository_dispatch":
+		ev.Branch = payload.Branch
+	}
+
+	s.route(w, r, ev)
+}
+
+// handleGenericWebhook accepts signed events from sources other than GitHub.
+// The event type is the source name, so routing rules match it with events;
+// the optional top-level "repo", "branch", and "action" fields fill in the
+// rest of the event, and the whole body is available to payload matches.
+func (s *Server) handleGenericWebhook(w http.ResponseWriter, r *http.Request) {
+	var payload map[string]interface{}
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxWebhookBody)).Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid payload: "+err.Error())
+		return
+	}
+	delivery := r.Header.Get("X-Delivery-ID")
+	if delivery == "" {
+		delivery = r.Header.Get("X-Request-ID")
+	}
+	field := func(name string) string {
+		v, _ := payload[name].(string)
+		return v
+	}
+	s.route(w, r, flow.InboundEvent{
+		Type:     r.PathValue("source"),
+		Action:   field("action"),
+		Repo:     field("repo"),
+		Branch:   field("branch"),
+		Delivery: delivery,
+		Payload:  payload,
+	})
+}
+
+// route matches ev against the Router's rules, responds with the resulting
+// dispatches and performs them in the background, on the Queue if there is
+// one. A delivery the Queue has no room for is answered 503.
+func (s *Server) route(w http.ResponseWriter, r *http.Request, ev flow.InboundEvent) {
+	if s.Router == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	routed, err := s.Router.Route(ev)
+	if err != nil {
+		s.logf("webhook: routing %s from %s: %v", ev.Type, ev.Repo, err)
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if len(routed) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	results := make([]routedResult, len(routed))
+	for i, d := range routed {
+		results[i] = routedResult{Rule: d.Rule, Repo: d.Repo, Workflow: d.Workflow, Ref: d.Ref, FanOut: d.FanOut > 0}
+	}
+	base := context.WithoutCancel(r.Context())
+	run := func() {
+		defer s.background.Done()
+		ctx, cancel := context.WithTimeout(base, routeTimeout)
+		defer cancel()
+		s.dispatchRouted(ctx, ev, routed)
+	}
+	s.background.Add(1)
+	if s.Queue == nil {
+		go run()
+		writeJSON(w, http.StatusAccepted, results)
+		return
+	}
+	err = s.Queue.Enqueue(r.Context(), flow.QueueJob{
+		Name: ev.Type + " from " + ev.Repo,
+		Run:  run,
+		Dropped: func() {
+			defer s.background.Done()
+			s.logf("webhook: queue full, dropped %s delivery %s from %s", ev.Type, ev.Delivery, ev.Repo)
+		},
+	})
+	if err != nil {
+		s.background.Done()
+		s.logf("webhook: queueing %s delivery %s from %s: %v", ev.Type, ev.Delivery, ev.Repo, err)
+		w.Header().Set("Retry-After", strconv.Itoa(int(queueRetryAfter.Seconds())))
+		writeError(w, http.StatusServiceUnavailable, "dispatch queue is full, retry later")
+		return
+	}
+	writeJSON(w, http.StatusAccepted, results)
+}
+
+// dispatchRouted performs routed dispatches. Each carries an idempotency key
+// derived from the delivery, so redeliveries are not dispatched twice.
+// Targets are dispatched concurrently, then each rule's fan-out.
+func (s *Server) dispatchRouted(ctx context.Context, ev flow.InboundEvent, routed []flow.RoutedDispatch) {
+	var rules []string
+	var targets []flow.DispatchRequest
+	fanOuts := map[string][]flow.DispatchRequest{}
+	concurrency := map[string]int{}
+	for _, d := range routed {
+		req := flow.DispatchRequest{
+			Repo:           d.Repo,
+			Workflow:       d.Workflow,
+			Ref:            d.Ref,
+			Inputs:         d.Inputs,
+			IdempotencyKey: d.IdempotencyKey(ev.Delivery),
+			RequestedBy:    "rule:" + d.Rule,
+		}
+		if d.FanOut > 0 {
+			if fanOuts[d.Rule] == nil {
+				rules = append(rules, d.Rule)
+			}
+			fanOuts[d.Rule] = append(fanOuts[d.Rule], req)
+			concurrency[d.Rule] = d.FanOut
+			continue
+		}
+		targets = append(targets, req)
+	}
+	for res := range s.Correlator.SubmitAll(ctx, flow.Parallelism{Concurrency: flow.DefaultFanOutConcurrency}, targets) {
+		req, err := res.Value.Request, res.Value.Err
+		if err != nil && !errors.Is(err, flow.ErrAlreadyDispatched) {
+			s.logf("webhook: rule %s: dispatch %s %s: %v", strings.TrimPrefix(req.RequestedBy, "rule:"), req.Repo, req.Workflow, err)
+		}
+	}
+	for _, rule := range rules {
+		res := s.Correlator.FanOut(ctx, rule, ev.Repo, fanOuts[rule], concurrency[rule])
+		if err := res.Err(); err != nil {
+			s.logf("webhook: rule %s: fan-out from %s: %s: %v", rule, ev.Repo, res.Summary(), err)
+		} else {
+			s.logf("webhook: rule %s: fan-out from %s: %s", rule, ev.Repo, res.Summary())
+		}
+	}
+}
+
+func (s *Server) refreshRun(r *http.Request, ev webhookEvent) error {
+	repo := ev.Repository.FullName
+	if s.Registry != nil && len(s.Registry.Repos()) > 0 {
+		if _, ok := s.Registry.Get(repo); !ok {
+			return nil
+		}
+	}
+	recs, err := s.Correlator.History.List(repo)
+	if err != nil {
+		return err
+	}
+	run := ev.WorkflowRun
+	for _, rec := range recs {
+		if rec.Completed() {
+			continue
+		}
+		if rec.RunID == run.ID || (rec.RunID == 0 && (strings.Contains(run.DisplayTitle, rec.ID) || strings.Contains(run.Name, rec.ID))) {
+			_, err := s.Correlator.Resolve(r.Context(), rec)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+// newTestServer returns a Server whose correlator dispatches to a fake
+// GitHub with Cdaprod/site's deploy.yml.
+func newTestServer(t *testing.T) (*Server, *nodeproptest.Server) {
+	t.Helper()
+	gh := nodeproptest.NewServer()
+	t.Cleanup(gh.Close)
+	gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+	c := flow.NewRunCorrelator(gh.Client(), flow.NewFileHistoryStore(filepath.Join(t.TempDir(), "history.json")))
+	c.Logger = slogDiscard
+	s := New("127.0.0.1:0", c, nil)
+	s.Logger = log.New(io.Discard, "", 0)
+	return s, gh
+}
+
+// slogDiscard keeps expected dispatch failures out of test output.
+var slogDiscard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// hmacHex signs body the way SignatureScheme's defaults expect.
+func hmacHex(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// serve sends a request to s and returns the recorded response.
+func serve(s *Server, method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, req)
+	return w
+}
+
+func TestWebhookRouting(t *testing.T) {
+	push := `{"ref": "refs/heads/main", "repository": {"full_name": "Cdaprod/site"}, "head_commit": {"id": "abc123"}}`
+	tests := []struct {
+		name       string
+		event      string
+		body       string
+		unsigned   bool
+		wantStatus int
+		wantInputs map[string]string
+	}{
+		{name: "ping", event: "ping", body: `{}`, wantStatus: http.StatusNoContent},
+		{name: "routed", event: "push", body: push, wantStatus: http.StatusAccepted, wantInputs: map[string]string{"sha": "abc123"}},
+		{name: "other branch", event: "push", body: strings.Replace(push, "main", "dev", 1), wantStatus: http.StatusNoContent},
+		{name: "unrouted event", event: "issues", body: `{"action": "opened", "repository": {"full_name": "Cdaprod/site"}}`, wantStatus: http.StatusNoContent},
+		{name: "invalid payload", event: "push", body: `{`, wantStatus: http.StatusBadRequest},
+		{name: "unsigned", event: "push", body: push, unsigned: true, wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, gh := newTestServer(t)
+			s.AllowUnsigned = !tt.unsigned
+			s.Router = &flow.EventRouter{Rules: []flow.RoutingRule{{
+				Name:    "deploy-main",
+				Events:  []string{"push"},
+				Branch:  "main",
+				Targets: []flow.BatchTarget{{Repo: flow.SourceRepo, Workflow: "deploy.yml", Ref: "${event.branch}", Inputs: map[string]string{"sha": "${payload.head_commit.id}"}}},
+			}}}
+
+			header := map[string]string{"X-GitHub-Event": tt.event, "X-GitHub-Delivery": "d-1"}
+			w := serve(s, "POST", "/webhook", tt.body, header)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			// A redelivery must not dispatch again.
+			serve(s, "POST", "/webhook", tt.body, header)
+			s.background.Wait()
+
+			ds := gh.Dispatches()
+			if tt.wantInputs == nil {
+				if len(ds) != 0 {
+					t.Errorf("dispatched %+v, want nothing", ds)
+				}
+				return
+			}
+			var results []routedResult
+			if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil || len(results) != 1 || results[0].Rule != "deploy-main" || results[0].Ref != "main" {
+				t.Errorf("response = %s, want the routed dispatch", w.Body)
+			}
+			if len(ds) != 1 || ds[0].Ref != "main" || ds[0].Inputs["sha"] != tt.wantInputs["sha"] {
+				t.Errorf("dispatches = %+v, want one with inputs %v", ds, tt.wantInputs)
+			}
+		})
+	}
+}
+
+func TestWebhookPaths(t *testing.T) {
+	tests := []struct {
+		name         string
+		before       string
+		after        string
+		wantDispatch bool
+	}{
+		{name: "selected file changed", before: "aaa", after: "api", wantDispatch: true},
+		{name: "excluded file changed", before: "aaa", after: "docs"},
+		{name: "branch created", before: "0000000000000000000000000000000000000000", after: "docs", wantDispatch: true},
+		{name: "comparison fails", before: "aaa", after: "broken", wantDispatch: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, gh := newTestServer(t)
+			s.AllowUnsigned = true
+			s.Router = &flow.EventRouter{Rules: []flow.RoutingRule{{
+				Name:    "deploy-api",
+				Events:  []string{"push"},
+				Paths:   []string{"services/api/**", "!services/api/docs/**"},
+				Targets: []flow.BatchTarget{{Repo: flow.SourceRepo, Workflow: "deploy.yml"}},
+			}}}
+			// The fake has no Compare API: it is served here, and the rest
+			// passed on to the fake.
+			target, err := url.Parse(gh.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mux := http.NewServeMux()
+			mux.Handle("/", httputil.NewSingleHostReverseProxy(target))
+			mux.HandleFunc("/repos/Cdaprod/site/compare/", func(w http.ResponseWriter, r *http.Request) {
+				file := map[string]string{
+					"aaa...api":  "services/api/main.go",
+					"aaa...docs": "services/api/docs/README.md",
+				}[strings.TrimPrefix(r.URL.Path, "/repos/Cdaprod/site/compare/")]
+				if file == "" {
+					http.Error(w, `{"message":"Server Error"}`, http.StatusInternalServerError)
+					return
+				}
+				fmt.Fprintf(w, `{"files": [{"filename": %q}]}`, file)
+			})
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+			s.Correlator.Client.BaseURL = srv.URL
+
+			body := fmt.Sprintf(`{"ref": "refs/heads/main", "before": %q, "after": %q, "repository": {"full_name": "Cdaprod/site"}}`, tt.before, tt.after)
+			w := serve(s, "POST", "/webhook", body, map[string]string{"X-GitHub-Event": "push", "X-GitHub-Delivery": "d-1"})
+			s.background.Wait()
+			if want := map[bool]int{true: http.StatusAccepted, false: http.StatusNoContent}[tt.wantDispatch]; w.Code != want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, want, w.Body)
+			}
+			if ds := gh.Dispatches(); (len(ds) == 1) != tt.wantDispatch || len(ds) > 1 {
+				t.Errorf("dispatches = %+v, want dispatched %v", ds, tt.wantDispatch)
+			}
+		})
+	}
+}
+
+func TestGenericWebhook(t *testing.T) {
+	s, gh := newTestServer(t)
+	secret := "jenkins-secret"
+	s.Signatures = map[string]*SignatureSource{"jenkins": {
+		Scheme:  SignatureScheme{Header: "X-Jenkins-Signature"},
+		Secrets: [][]byte{[]byte(secret)},
+	}}
+	s.Router = &flow.EventRouter{Rules: []flow.RoutingRule{{
+		Name:    "jenkins-deploy",
+		Events:  []string{"jenkins"},
+		Actions: []string{"built"},
+		Targets: []flow.BatchTarget{{Repo: "${event.repo}", Workflow: "deploy.yml", Ref: "${event.branch}", Inputs: map[string]string{"build": "${payload.build.number}"}}},
+	}}}
+
+	body := `{"action": "built", "repo": "Cdaprod/site", "branch": "main", "build": {"number": "42"}}`
+	if w := serve(s, "POST", "/webhooks/jenkins", body, map[string]string{"X-Jenkins-Signature": "00"}); w.Code != http.StatusUnauthorized {
+		t.Errorf("badly signed delivery status = %d, want 401", w.Code)
+	}
+	if w := serve(s, "POST", "/webhooks/travis", body, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("delivery from an unconfigured source status = %d, want 401", w.Code)
+	}
+	sig := map[string]string{"X-Jenkins-Signature": hmacHex(secret, body), "X-Delivery-ID": "j-1"}
+	if w := serve(s, "POST", "/webhooks/jenkins", body, sig); w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202: %s", w.Code, w.Body)
+	}
+	s.background.Wait()
+	if ds := gh.Dispatches(); len(ds) != 1 || ds[0].Ref != "main" || ds[0].Inputs["build"] != "42" {
+		t.Errorf("dispatches = %+v, want one for build 42", ds)
+	}
+}
+
+func TestWebhookRefreshesRuns(t *testing.T) {
+	s, gh := newTestServer(t)
+	s.AllowUnsigned = true
+	gh.SetOutcome("Cdaprod/site", "deploy.yml", nodeproptest.Outcome{Duration: time.Hour})
+	ctx := context.Background()
+	rec, err := s.Correlator.Submit(ctx, flow.DispatchRequest{Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolved, err := s.Correlator.Resolve(ctx, *rec)
+	if err != nil || resolved.RunID == 0 {
+		t.Fatalf("Resolve() = %+v, %v", resolved, err)
+	}
+	if err := gh.Complete(resolved.RunID, "success"); err != nil {
+		t.Fatal(err)
+	}
+
+	body := fmt.Sprintf(`{"action": "completed", "workflow_run": {"id": %d, "head_branch": "main"}, "repository": {"full_name": "Cdaprod/site"}}`, resolved.RunID)
+	if w := serve(s, "POST", "/webhook", body, map[string]string{"X-GitHub-Event": "workflow_run"}); w.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want 204: %s", w.Code, w.Body)
+	}
+	recs, err := s.Correlator.History.List("Cdaprod/site")
+	if err != nil || len(recs) != 1 || !recs[0].Completed() || recs[0].Conclusion != "success" {
+		t.Errorf("history = %+v, %v; want the run refreshed from the API", recs, err)
+	}
+}
+
+func TestWebhookQueueOverflow(t *testing.T) {
+	tests := []struct {
+		overflow    flow.OverflowPolicy
+		wantStatus  int
+		wantFromSHA string
+	}{
+		{overflow: flow.OverflowReject, wantStatus: http.StatusServiceUnavailable, wantFromSHA: "first"},
+		{overflow: flow.OverflowDropOldest, wantStatus: http.StatusAccepted, wantFromSHA: "second"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.overflow), func(t *testing.T) {
+			s, gh := newTestServer(t)
+			s.AllowUnsigned = true
+			s.Router = &flow.EventRouter{Rules: []flow.RoutingRule{{
+				Name:    "deploy",
+				Events:  []string{"push"},
+				Targets: []flow.BatchTarget{{Repo: flow.SourceRepo, Workflow: "deploy.yml", Ref: "main", Inputs: map[string]string{"sha": "${payload.head_commit.id}"}}},
+			}}}
+			// The only worker is busy, so one delivery fits in the queue.
+			s.Queue = flow.NewDispatchQueue(1, 1, tt.overflow)
+			started, release := make(chan struct{}), make(chan struct{})
+			s.Queue.Enqueue(context.Background(), flow.QueueJob{Run: func() { close(started); <-release }})
+			<-started
+
+			push := func(delivery, sha string) *httptest.ResponseRecorder {
+				body := fmt.Sprintf(`{"ref": "refs/heads/main", "repository": {"full_name": "Cdaprod/site"}, "head_commit": {"id": %q}}`, sha)
+				return serve(s, "POST", "/webhook", body, map[string]string{"X-GitHub-Event": "push", "X-GitHub-Delivery": delivery})
+			}
+			if w := push("d-1", "first"); w.Code != http.StatusAccepted {
+				t.Fatalf("queued delivery status = %d, want 202: %s", w.Code, w.Body)
+			}
+			w := push("d-2", "second")
+			if w.Code != tt.wantStatus {
+				t.Errorf("overflowing delivery status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if retry := w.Header().Get("Retry-After"); (w.Code == http.StatusServiceUnavailable) != (retry == "30") {
+				t.Errorf("Retry-After = %q with status %d", retry, w.Code)
+			}
+
+			close(release)
+			// A dropped or refused delivery must not leave background work
+			// behind for shutdown to wait on.
+			s.background.Wait()
+			if ds := gh.Dispatches(); len(ds) != 1 || ds[0].Inputs["sha"] != tt.wantFromSHA {
+				t.Errorf("dispatches = %+v, want one from the %s delivery", ds, tt.wantFromSHA)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package flow
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// TriggerExecutor runs registered triggers by name until ctx is done.
+// *TriggerManager and *ShardedTriggerManager implement it.
+type TriggerExecutor interface {
+	ExecuteActionContext(ctx context.Context, name, target, token string, params map[string]string) error
+	ExecuteWorkflowContext(ctx context.Context, name, target, token string, params map[string]string) error
+}
+
+// ShardByOwner is the default shard of a ShardedTriggerManager: the owner
+// of an owner/name target.
+func ShardByOwner(target string) string {
+	owner, _, _ := strings.Cut(target, "/")
+	return owner
+}
+
+// ShardedTriggerManager routes executions to one TriggerManager per shard,
+// e.g. per organization or per GitHub instance, so each shard has its own
+// triggers, tokens, and logger, and one that is failing or rate limited
+// holds up only its own executions. The zero value shards by owner and
+// creates empty managers.
+type ShardedTriggerManager struct {
+	// Shard names the shard of a target; nil means ShardByOwner.
+	Shard func(target string) string
+	// New creates the manager of a shard the first time it is used, e.g.
+	// with that organization's triggers registered. Nil means an empty
+	// manager; shards may also be added with SetShard.
+	New func(shard string) *TriggerManager
+	// Concurrency, if positive, bounds the executions in flight per shard.
+	// Further executions of a shard wait; other shards are not affected.
+	Concurrency int
+
+	mu     sync.Mutex
+	shards map[string]*shard
+}
+
+type shard struct {
+	tm  *TriggerManager
+	sem chan struct{}
+}
+
+// SetShard makes tm the manager of shard name.
+func (s *ShardedTriggerManager) SetShard(name string, tm *TriggerManager) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shards == nil {
+		s.shards = map[string]*shard{}
+	}
+	s.shards[name] = s.newShard(tm)
+}
+
+// Manager returns the manager of shard name, creating it if needed.
+func (s *ShardedTriggerManager) Manager(name string) *TriggerManager {
+	return s.shard(name).tm
+}
+
+// Shards returns the names of the shards created so far, sorted.
+func (s *ShardedTriggerManager) Shards() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.shards))
+	for name := range s.shards {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// ExecuteAction executes the action name of target's shard.
+func (s *ShardedTriggerManager) ExecuteAction(name, target, token string, params map[string]string) error {
+	return s.ExecuteActionContext(context.Background(), name, target, token, params)
+}
+
+// ExecuteActionContext executes the action name of target's shard. While
+// the shard is at its Concurrency it waits for a slot until ctx is done.
+func (s *ShardedTriggerManager) ExecuteActionContext(ctx context.Context, name, target, token string, params map[string]string) error {
+	sh := s.shardOf(target)
+	release, err := sh.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return sh.tm.ExecuteActionContext(ctx, name, target, token, params)
+}
+
+// ExecuteWorkflow executes the workflow name of target's shard.
+func (s *ShardedTriggerManager) ExecuteWorkflow(name, target, token string, params map[string]string) error {
+	return s.ExecuteWorkflowContext(context.Background(), name, target, token, params)
+}
+
+// ExecuteWorkflowContext executes the workflow name of target's shard,
+// waiting for a slot as ExecuteActionContext does.
+func (s *ShardedTriggerManager) ExecuteWorkflowContext(ctx context.Context, name, target, token string, params map[string]string) error {
+	sh := s.shardOf(target)
+	release, err := sh.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return sh.tm.ExecuteWorkflowContext(ctx, name, target, token, params)
+}
+
+func (s *ShardedTriggerManager) shardOf(target string) *shard {
+	key := ShardByOwner
+	if s.Shard != nil {
+		key = s.Shard
+	}
+	return s.shard(key(target))
+}
+
+func (s *ShardedTriggerManager) shard(name string) *shard {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sh := s.shards[name]; sh != nil {
+		return sh
+	}
+	var tm *TriggerManager
+	if s.New != nil {
+		tm = s.New(name)
+	}
+	if tm == nil {
+		tm = NewTriggerManager()
+	}
+	if s.shards == nil {
+		s.shards = map[string]*shard{}
+	}
+	sh := s.newShard(tm)
+	s.shards[name] = sh
+	return sh
+}
+
+func (s *ShardedTriggerManager) newShard(tm *TriggerManager) *shard {
+	sh := &shard{tm: tm}
+	if s.Concurrency > 0 {
+		sh.sem = make(chan struct{}, s.Concurrency)
+	}
+	return sh
+}
+
+// acquire takes one of the shard's execution slots, waiting until ctx is
+// done, and returns its release.
+func (sh *shard) acquire(ctx context.Context) (func(), error) {
+	if sh.sem == nil {
+		return func() {}, nil
+	}
+	select {
+	case sh.sem <- struct{}{}:
+		return func() { <-sh.sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
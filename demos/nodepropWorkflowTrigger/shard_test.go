@@ -0,0 +1,146 @@
+package flow_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+func TestShardByOwner(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{target: "Cdaprod/site", want: "Cdaprod"},
+		{target: "Cdaprod/site/sub", want: "Cdaprod"},
+		{target: "site", want: "site"},
+		{target: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := flow.ShardByOwner(tt.target); got != tt.want {
+			t.Errorf("ShardByOwner(%q) = %q, want %q", tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestShardedTriggerManagerRouting(t *testing.T) {
+	// Only the acme and Cdaprod shards have triggers registered.
+	mocks := map[string]*nodeproptest.MockTrigger{"acme": {}, "Cdaprod": {}}
+	s := &flow.ShardedTriggerManager{New: func(shard string) *flow.TriggerManager {
+		m, ok := mocks[shard]
+		if !ok {
+			return nil
+		}
+		tm := flow.NewTriggerManager()
+		tm.RegisterWorkflow("deploy", m)
+		tm.RegisterAction("notify", m)
+		return tm
+	}}
+
+	tests := []struct {
+		target    string
+		action    bool
+		wantShard string
+		wantErr   error
+	}{
+		{target: "acme/web", wantShard: "acme"},
+		{target: "acme/api", action: true, wantShard: "acme"},
+		{target: "Cdaprod/site", wantShard: "Cdaprod"},
+		{target: "other/app", wantErr: flow.ErrNotRegistered},
+	}
+	for _, tt := range tests {
+		var err error
+		if tt.action {
+			err = s.ExecuteAction("notify", tt.target, "token", nil)
+		} else {
+			err = s.ExecuteWorkflow("deploy", tt.target, "token", nil)
+		}
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("executing on %s error = %v, want %v", tt.target, err, tt.wantErr)
+		}
+		if tt.wantShard != "" && len(mocks[tt.wantShard].CallsTo(tt.target)) != 1 {
+			t.Errorf("%s was not run by the %s shard", tt.target, tt.wantShard)
+		}
+	}
+	if got, want := s.Shards(), []string{"Cdaprod", "acme", "other"}; !slices.Equal(got, want) {
+		t.Errorf("Shards() = %v, want %v", got, want)
+	}
+	if s.Manager("acme") != s.Manager("acme") {
+		t.Error("Manager() created a shard's manager twice")
+	}
+}
+
+func TestShardedTriggerManagerSetShard(t *testing.T) {
+	ghes, public := &nodeproptest.MockTrigger{}, &nodeproptest.MockTrigger{}
+	s := &flow.ShardedTriggerManager{Shard: func(target string) string {
+		if slices.Contains([]string{"corp/billing", "corp/ledger"}, target) {
+			return "ghes"
+		}
+		return "github.com"
+	}}
+	for name, m := range map[string]*nodeproptest.MockTrigger{"ghes": ghes, "github.com": public} {
+		tm := flow.NewTriggerManager()
+		tm.RegisterWorkflow("deploy", m)
+		s.SetShard(name, tm)
+	}
+
+	for _, target := range []string{"corp/billing", "corp/site", "corp/ledger"} {
+		if err := s.ExecuteWorkflow("deploy", target, "token", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ghes.AssertCallCount(t, 2)
+	public.AssertCalled(t, "corp/site", nil)
+	public.AssertCallCount(t, 1)
+}
+
+func TestShardedTriggerManagerConcurrency(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := map[string]chan struct{}{"acme/web": make(chan struct{}), "Cdaprod/site": make(chan struct{})}
+	slow := &nodeproptest.MockTrigger{Fail: func(c nodeproptest.Call) error {
+		started <- struct{}{}
+		<-release[c.Target]
+		return nil
+	}}
+	s := &flow.ShardedTriggerManager{Concurrency: 1, New: func(string) *flow.TriggerManager {
+		tm := flow.NewTriggerManager()
+		tm.RegisterWorkflow("deploy", slow)
+		return tm
+	}}
+
+	done := make(chan error, 1)
+	go func() { done <- s.ExecuteWorkflow("deploy", "acme/web", "token", nil) }()
+	<-started
+
+	// acme is at its Concurrency, so another of its executions waits.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.ExecuteWorkflowContext(ctx, "deploy", "acme/api", "token", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("execution on a busy shard error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if err := s.ExecuteActionContext(ctx, "deploy", "acme/api", "token", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("action on a busy shard error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// Other shards are not held up.
+	other := make(chan error, 1)
+	go func() { other <- s.ExecuteWorkflow("deploy", "Cdaprod/site", "token", nil) }()
+	<-started
+	close(release["Cdaprod/site"])
+	if err := <-other; err != nil {
+		t.Errorf("execution on another shard error = %v", err)
+	}
+
+	close(release["acme/web"])
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if got := len(slow.CallsTo("acme/api")); got != 0 {
+		t.Errorf("the waiting execution ran %d times", got)
+	}
+}
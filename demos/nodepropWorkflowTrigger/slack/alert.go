@@ -0,0 +1,23 @@
+package slack
+
+import (
+	"context"
+	"net/http"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// AlertWebhook posts alerts to a Slack incoming webhook.
+type AlertWebhook struct {
+	URL        string
+	HTTPClient *http.Client
+}
+
+// Alert posts a's summary to the webhook's channel.
+func (w *AlertWebhook) Alert(ctx context.Context, a flow.Alert) error {
+	icon := ":rotating_light:"
+	if a.Resolved {
+		icon = ":white_check_mark:"
+	}
+	return post(ctx, w.HTTPClient, w.URL, "", Message{Text: icon + " " + a.Summary()}, nil)
+}
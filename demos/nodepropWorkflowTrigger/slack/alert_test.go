@@ -0,0 +1,38 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+func TestAlertWebhook(t *testing.T) {
+	a := flow.Alert{Rule: "dlq", Kind: flow.AlertDeadLetters, Value: 3, Threshold: 2}
+	resolved := a
+	resolved.Resolved = true
+	tests := []struct {
+		alert flow.Alert
+		want  string
+	}{
+		{alert: a, want: ":rotating_light: " + a.Summary()},
+		{alert: resolved, want: ":white_check_mark: " + resolved.Summary()},
+	}
+	for _, tt := range tests {
+		var got Message
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&got)
+		}))
+		w := &AlertWebhook{URL: ts.URL}
+		if err := w.Alert(context.Background(), tt.alert); err != nil {
+			t.Errorf("Alert() error = %v", err)
+		}
+		ts.Close()
+		if got.Text != tt.want {
+			t.Errorf("posted %q, want %q", got.Text, tt.want)
+		}
+	}
+}
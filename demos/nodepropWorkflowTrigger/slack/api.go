@@ -0,0 +1,115 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// DefaultAPIBaseURL is the Slack Web API endpoint.
+const DefaultAPIBaseURL = "https://slack.com/api"
+
+// Message is a Slack message body for chat.postMessage, response URLs, and
+// slash command replies.
+type Message struct {
+	Channel         string        `json:"channel,omitempty"`
+	ThreadTS        string        `json:"thread_ts,omitempty"`
+	ResponseType    string        `json:"response_type,omitempty"` // ephemeral or in_channel
+	ReplaceOriginal bool          `json:"replace_original,omitempty"`
+	Text            string        `json:"text"`
+	Blocks          []interface{} `json:"blocks,omitempty"`
+}
+
+// postMessage sends msg with chat.postMessage and returns its timestamp,
+// which identifies it as a thread parent.
+func (i *Integration) postMessage(ctx context.Context, msg Message) (string, error) {
+	base := i.APIBaseURL
+	if base == "" {
+		base = DefaultAPIBaseURL
+	}
+	var out struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+		TS    string `json:"ts"`
+	}
+	if err := i.post(ctx, strings.TrimRight(base, "/")+"/chat.postMessage", "Bearer "+i.BotToken, msg, &out); err != nil {
+		return "", err
+	}
+	if !out.OK {
+		return "", fmt.Errorf("chat.postMessage: %s", out.Error)
+	}
+	return out.TS, nil
+}
+
+// respond posts msg to an interaction's response URL.
+func (i *Integration) respond(ctx context.Context, responseURL string, msg Message) error {
+	return i.post(ctx, responseURL, "", msg, nil)
+}
+
+func (i *Integration) post(ctx context.Context, url, auth string, in, out interface{}) error {
+	return post(ctx, i.HTTPClient, url, auth, in, out)
+}
+
+func post(ctx context.Context, hc *http.Client, url, auth string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	if hc == nil {
+		hc = flow.SharedHTTPClient()
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("POST %s: unexpected status code: %d: %s", url, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// section is a Block Kit section with markdown text.
+func section(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "section",
+		"text": map[string]string{"type": "mrkdwn", "text": text},
+	}
+}
+
+// button is a Block Kit button; style may be empty, primary, or danger.
+func button(text, actionID, value, style string) map[string]interface{} {
+	b := map[string]interface{}{
+		"type":      "button",
+		"text":      map[string]string{"type": "plain_text", "text": text},
+		"action_id": actionID,
+		"value":     value,
+	}
+	if style != "" {
+		b["style"] = style
+	}
+	return b
+}
+
+// escape escapes text for Slack's mrkdwn.
+func escape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
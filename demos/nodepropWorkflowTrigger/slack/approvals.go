@@ -0,0 +1,108 @@
+package slack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// Action IDs of the buttons on approval requests.
+const (
+	actionApprove = "nodeprop_approve"
+	actionReject  = "nodeprop_reject"
+)
+
+// Notify posts dispatches awaiting approval to ApprovalChannel with Approve
+// and Reject buttons, so the Integration can be passed to
+// flow.ForwardEvents for flow.EventApprovalRequested. Other events are
+// ignored.
+func (i *Integration) Notify(ctx context.Context, e flow.Event) error {
+	if e.Type != flow.EventApprovalRequested || i.ApprovalChannel == "" {
+		return nil
+	}
+	if i.BotToken == "" {
+		return errors.New("slack: posting approval requests needs a bot token")
+	}
+	a, ok, err := flow.FindApproval(i.Correlator.Approvals, e.ApprovalID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("slack: approval %s not found", e.ApprovalID)
+	}
+	text := fmt.Sprintf("%s requested %s. It needs approval (`%s`).", mention(a.RequestedBy), describeApproval(a), a.ID)
+	if len(a.Approvers) > 0 {
+		names := make([]string, len(a.Approvers))
+		for n, ap := range a.Approvers {
+			names[n] = mention(ap)
+		}
+		text += " Approvers: " + strings.Join(names, ", ") + "."
+	}
+	_, err = i.postMessage(ctx, Message{
+		Channel: i.ApprovalChannel,
+		Text:    text,
+		Blocks: []interface{}{
+			section(text),
+			map[string]interface{}{
+				"type": "actions",
+				"elements": []interface{}{
+					button("Approve", actionApprove, a.ID, "primary"),
+					button("Reject", actionReject, a.ID, "danger"),
+				},
+			},
+		},
+	})
+	return err
+}
+
+// decide records a press of Approve or Reject. The request is replaced by
+// the outcome; a decision that was refused is shown only to the presser.
+func (i *Integration) decide(ctx context.Context, user, actionID, id, responseURL string) {
+	by := "slack:" + user
+	var (
+		a    *flow.Approval
+		rec  *flow.DispatchRecord
+		err  error
+		verb = "rejected"
+	)
+	if actionID == actionApprove {
+		verb = "approved"
+		a, rec, err = i.Correlator.Approve(ctx, id, by, "")
+	} else {
+		a, err = i.Correlator.Reject(ctx, id, by, "")
+	}
+	// Other errors come from a dispatch made after the decision was recorded.
+	if a == nil || errors.Is(err, flow.ErrNotApprover) || errors.Is(err, flow.ErrApprovalDecided) {
+		if rerr := i.respond(ctx, responseURL, Message{ResponseType: "ephemeral", Text: "Could not decide approval `" + escape(id) + "`: " + escape(err.Error())}); rerr != nil {
+			i.logf("slack: respond: %v", rerr)
+		}
+		return
+	}
+	text := fmt.Sprintf("<@%s> %s %s (approval `%s`).", user, verb, describeApproval(*a), a.ID)
+	switch {
+	case err != nil:
+		text += " The dispatch failed: " + escape(err.Error())
+	case rec != nil:
+		text += fmt.Sprintf(" Dispatched `%s`.", rec.ID)
+	}
+	i.reply(ctx, responseURL, text)
+}
+
+// describeApproval formats a held dispatch for a message.
+func describeApproval(a flow.Approval) string {
+	return describe(flow.ChatCommand{Repo: a.Repo, Workflow: a.Workflow, Ref: a.Ref, Inputs: a.Inputs})
+}
+
+// mention formats an approval identity, mentioning Slack users.
+func mention(id string) string {
+	if user, ok := strings.CutPrefix(id, "slack:"); ok {
+		return "<@" + user + ">"
+	}
+	if id == "" {
+		return "Someone"
+	}
+	return "`" + escape(id) + "`"
+}
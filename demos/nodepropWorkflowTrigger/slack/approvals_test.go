@@ -0,0 +1,108 @@
+package slack
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+func TestApprovals(t *testing.T) {
+	i, gh, resp, hooks := newIntegration(t)
+	reg := flow.NewRepositoryRegistry()
+	reg.RegisterRepo("Cdaprod/api", nil, []string{"deploy.yml"})
+	reg.SetApproval("Cdaprod/api", true, []string{"slack:U2"})
+	i.Correlator.ApprovalPolicy = reg
+	i.Correlator.Approvals = flow.NewFileApprovalStore(filepath.Join(t.TempDir(), "approvals.json"))
+
+	var (
+		mu     sync.Mutex
+		posted []Message
+	)
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(posted)
+	}
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m Message
+		json.NewDecoder(r.Body).Decode(&m)
+		if r.URL.Path != "/chat.postMessage" || r.Header.Get("Authorization") != "Bearer xoxb-test" {
+			t.Errorf("posted to %s with %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		mu.Lock()
+		posted = append(posted, m)
+		mu.Unlock()
+		w.Write([]byte(`{"ok": true, "ts": "1.0"}`))
+	}))
+	defer api.Close()
+	i.APIBaseURL = api.URL
+
+	hold := func() flow.Approval {
+		t.Helper()
+		_, err := i.Correlator.Submit(t.Context(), flow.DispatchRequest{Repo: "Cdaprod/api", Workflow: "deploy.yml", Ref: "main", RequestedBy: "slack:U1"})
+		var held *flow.ApprovalRequiredError
+		if !errors.As(err, &held) {
+			t.Fatalf("Submit() error = %v, want it held", err)
+		}
+		return held.Approval
+	}
+	a := hold()
+	e := flow.Event{Type: flow.EventApprovalRequested, ApprovalID: a.ID, Repo: a.Repo}
+
+	if err := i.Notify(t.Context(), e); err != nil || count() != 0 {
+		t.Errorf("Notify() without a channel = %v, posted %d", err, count())
+	}
+	i.ApprovalChannel = "C-approvals"
+	if err := i.Notify(t.Context(), e); err == nil {
+		t.Error("Notify() without a bot token succeeded")
+	}
+	i.BotToken = "xoxb-test"
+	if err := i.Notify(t.Context(), flow.Event{Type: flow.EventDispatched}); err != nil || count() != 0 {
+		t.Errorf("Notify() of another event = %v, posted %d", err, count())
+	}
+	if err := i.Notify(t.Context(), e); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	got := slices.Clone(posted)
+	mu.Unlock()
+	if len(got) != 1 || got[0].Channel != "C-approvals" || !strings.Contains(got[0].Text, "<@U1> requested `deploy.yml` in `Cdaprod/api`") || !strings.Contains(got[0].Text, "Approvers: <@U2>.") {
+		t.Fatalf("posted %+v", got)
+	}
+
+	tests := []struct {
+		name   string
+		user   string
+		action string
+		want   string
+	}{
+		{name: "requester", user: "U1", action: actionApprove, want: "Could not decide approval"},
+		{name: "approved", user: "U2", action: actionApprove, want: "<@U2> approved `deploy.yml` in `Cdaprod/api` at `main` (approval `" + a.ID + "`). Dispatched `"},
+		{name: "already decided", user: "U2", action: actionReject, want: "is approved"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			press(t, i, tt.user, tt.action, a.ID, hooks.URL)
+			if m := resp.next(t); !strings.Contains(m.Text, tt.want) {
+				t.Errorf("replied %q, want %q", m.Text, tt.want)
+			}
+		})
+	}
+	if n := len(gh.Dispatches()); n != 1 {
+		t.Errorf("%d dispatches, want the approved one", n)
+	}
+
+	b := hold()
+	press(t, i, "U2", actionReject, b.ID, hooks.URL)
+	if m := resp.next(t); !m.ReplaceOriginal || !strings.HasPrefix(m.Text, "<@U2> rejected") {
+		t.Errorf("reject replied %+v", m)
+	}
+}
@@ -0,0 +1,379 @@
+// Package slack lets Slack users trigger workflows with a slash command.
+//
+// "/nodeprop trigger owner/repo workflow.yml [ref] [key=value ...]" replies
+// with a confirmation only the caller sees; pressing Trigger dispatches the
+// workflow and posts the dispatch, and later the run's result, back to the
+// channel. Dispatches held for approval can be approved or rejected with
+// buttons posted to an approval channel.
+package slack
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// Action IDs of the confirmation buttons.
+const (
+	actionConfirm = "nodeprop_confirm"
+	actionCancel  = "nodeprop_cancel"
+)
+
+const (
+	// maxBody caps the size of a Slack request.
+	maxBody = 1 << 20
+	// confirmTTL is how long a confirmation can still be pressed.
+	confirmTTL = 10 * time.Minute
+	// pollInterval is how often a dispatched run is checked for completion.
+	pollInterval = 15 * time.Second
+	// watchTimeout gives up on reporting a run's result.
+	watchTimeout = 24 * time.Hour
+	// DefaultResponseURLPrefix is where Slack's response URLs point.
+	DefaultResponseURLPrefix = "https://hooks.slack.com/"
+)
+
+// Integration serves Slack's slash command and interactivity endpoints.
+type Integration struct {
+	// SigningSecret verifies that requests come from Slack.
+	SigningSecret []byte
+	// BotToken, if set, is used to post dispatch notices to the channel and
+	// thread run results under them. Without it, results are sent to the
+	// command's response URL, which Slack expires after 30 minutes.
+	BotToken string
+	// ApprovalChannel, if set, is where Notify posts dispatches awaiting
+	// approval. It needs BotToken.
+	ApprovalChannel string
+	Correlator      *flow.RunCorrelator
+	// Registry, if non-empty, is the allowlist of repositories that may be
+	// triggered.
+	Registry *flow.RepositoryRegistry
+	// APIBaseURL overrides DefaultAPIBaseURL.
+	APIBaseURL string
+	// ResponseURLPrefix overrides DefaultResponseURLPrefix; response URLs
+	// elsewhere are refused.
+	ResponseURLPrefix string
+	HTTPClient        *http.Client
+	// Logger receives errors; nil means log.Default().
+	Logger *log.Logger
+
+	mu      sync.Mutex
+	pending map[string]pendingTrigger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// pendingTrigger is a command awaiting confirmation.
+type pendingTrigger struct {
+	cmd     flow.ChatCommand
+	user    string
+	channel string
+	expires time.Time
+}
+
+// New creates an Integration. Call Close to stop reporting run results.
+func New(signingSecret []byte, correlator *flow.RunCorrelator, registry *flow.RepositoryRegistry) *Integration {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Integration{
+		SigningSecret: signingSecret,
+		Correlator:    correlator,
+		Registry:      registry,
+		pending:       map[string]pendingTrigger{},
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+}
+
+// Handler serves POST /slack/commands (the slash command request URL) and
+// POST /slack/interactions (the interactivity request URL).
+func (i *Integration) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /slack/commands", i.verified(i.handleCommand))
+	mux.HandleFunc("POST /slack/interactions", i.verified(i.handleInteraction))
+	return mux
+}
+
+// Close stops watching dispatched runs and waits for pending notices.
+func (i *Integration) Close() {
+	i.cancel()
+	i.wg.Wait()
+}
+
+// verified rejects requests without a valid Slack signature and parses the
+// form body of the rest.
+func (i *Integration) verified(next func(http.ResponseWriter, *http.Request, url.Values)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+		if err != nil {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err := VerifyRequest(i.SigningSecret, r.Header, body, time.Now()); err != nil {
+			i.logf("slack: rejected request from %s: %v", r.RemoteAddr, err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			http.Error(w, "invalid form body", http.StatusBadRequest)
+			return
+		}
+		next(w, r, form)
+	}
+}
+
+func (i *Integration) handleCommand(w http.ResponseWriter, r *http.Request, form url.Values) {
+	cmd, err := flow.ParseChatCommand(form.Get("text"))
+	if err != nil {
+		writeMessage(w, Message{ResponseType: "ephemeral", Text: err.Error()})
+		return
+	}
+	if cmd.Name == "help" {
+		writeMessage(w, Message{ResponseType: "ephemeral", Text: "Usage: `" + escape(form.Get("command")+" "+flow.ChatUsage) + "`"})
+		return
+	}
+	if i.Registry != nil && len(i.Registry.Repos()) > 0 {
+		if _, ok := i.Registry.Get(cmd.Repo); !ok {
+			writeMessage(w, Message{ResponseType: "ephemeral", Text: fmt.Sprintf("Repository %s is not registered.", cmd.Repo)})
+			return
+		}
+	}
+	if cmd.Ref == "" {
+		cmd.Ref = "main"
+	}
+
+	token, err := newToken()
+	if err != nil {
+		writeMessage(w, Message{ResponseType: "ephemeral", Text: "Failed to create a confirmation: " + err.Error()})
+		return
+	}
+	i.mu.Lock()
+	now := time.Now()
+	for k, p := range i.pending {
+		if now.After(p.expires) {
+			delete(i.pending, k)
+		}
+	}
+	i.pending[token] = pendingTrigger{cmd: *cmd, user: form.Get("user_id"), channel: form.Get("channel_id"), expires: now.Add(confirmTTL)}
+	i.mu.Unlock()
+
+	summary := describe(*cmd)
+	writeMessage(w, Message{
+		ResponseType: "ephemeral",
+		Text:         "Trigger " + summary + "?",
+		Blocks: []interface{}{
+			section("Trigger " + summary + "?"),
+			map[string]interface{}{
+				"type": "actions",
+				"elements": []interface{}{
+					button("Trigger", actionConfirm, token, "primary"),
+					button("Cancel", actionCancel, token, ""),
+				},
+			},
+		},
+	})
+}
+
+// interaction is the subset of a block_actions payload used here.
+type interaction struct {
+	Type string `json:"type"`
+	User struct {
+		ID string `json:"id"`
+	} `json:"user"`
+	ResponseURL string `json:"response_url"`
+	Actions     []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+}
+
+func (i *Integration) handleInteraction(w http.ResponseWriter, r *http.Request, form url.Values) {
+	var in interaction
+	if err := json.Unmarshal([]byte(form.Get("payload")), &in); err != nil || in.Type != "block_actions" || len(in.Actions) == 0 {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	prefix := i.ResponseURLPrefix
+	if prefix == "" {
+		prefix = DefaultResponseURLPrefix
+	}
+	if !strings.HasPrefix(in.ResponseURL, prefix) {
+		i.logf("slack: refusing response URL %q", in.ResponseURL)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	action := in.Actions[0]
+	if action.ActionID == actionApprove || action.ActionID == actionReject {
+		w.WriteHeader(http.StatusOK)
+		i.wg.Add(1)
+		go func() {
+			defer i.wg.Done()
+			i.decide(i.ctx, in.User.ID, action.ActionID, action.Value, in.ResponseURL)
+		}()
+		return
+	}
+
+	i.mu.Lock()
+	p, ok := i.pending[action.Value]
+	if ok && p.user == in.User.ID {
+		delete(i.pending, action.Value)
+	}
+	i.mu.Unlock()
+
+	// Slack wants an answer within three seconds, so the rest happens in
+	// the background.
+	w.WriteHeader(http.StatusOK)
+	i.wg.Add(1)
+	go func() {
+		defer i.wg.Done()
+		ctx := i.ctx
+		switch {
+		case !ok || time.Now().After(p.expires):
+			i.reply(ctx, in.ResponseURL, "This confirmation has expired or was already used; run the command again.")
+		case p.user != in.User.ID:
+			i.reply(ctx, in.ResponseURL, "Only the person who ran the command can confirm it.")
+		case action.ActionID == actionCancel:
+			i.reply(ctx, in.ResponseURL, "Cancelled "+describe(p.cmd)+".")
+		case action.ActionID == actionConfirm:
+			i.dispatch(ctx, action.Value, p, in.ResponseURL)
+		}
+	}()
+}
+
+// dispatch performs a confirmed command and reports the run's result.
+func (i *Integration) dispatch(ctx context.Context, token string, p pendingTrigger, responseURL string) {
+	rec, err := i.Correlator.Submit(ctx, flow.DispatchRequest{
+		Repo:           p.cmd.Repo,
+		Workflow:       p.cmd.Workflow,
+		Ref:            p.cmd.Ref,
+		Inputs:         p.cmd.Inputs,
+		IdempotencyKey: "slack:" + token,
+		RequestedBy:    "slack:" + p.user,
+	})
+	var held *flow.ApprovalRequiredError
+	if errors.As(err, &held) {
+		i.reply(ctx, responseURL, fmt.Sprintf("%s needs approval (`%s`); it will be dispatched once approved.", describe(p.cmd), held.Approval.ID))
+		return
+	}
+	if err != nil {
+		i.reply(ctx, responseURL, fmt.Sprintf("Failed to trigger %s: %s", describe(p.cmd), escape(err.Error())))
+		return
+	}
+	i.reply(ctx, responseURL, "Triggered "+describe(p.cmd)+".")
+
+	notice := fmt.Sprintf("<@%s> triggered %s (dispatch `%s`).", p.user, describe(p.cmd), rec.ID)
+	var threadTS string
+	if i.BotToken != "" {
+		if threadTS, err = i.postMessage(ctx, Message{Channel: p.channel, Text: notice}); err != nil {
+			i.logf("slack: post to %s: %v", p.channel, err)
+		}
+	} else if err := i.respond(ctx, responseURL, Message{ResponseType: "in_channel", Text: notice}); err != nil {
+		i.logf("slack: respond: %v", err)
+	}
+
+	final, err := i.wait(ctx, *rec)
+	if err != nil {
+		if ctx.Err() == nil {
+			i.logf("slack: watch %s: %v", rec.ID, err)
+		}
+		return
+	}
+	result := completion(final)
+	if i.BotToken != "" && threadTS != "" {
+		_, err = i.postMessage(ctx, Message{Channel: p.channel, ThreadTS: threadTS, Text: result})
+	} else {
+		err = i.respond(ctx, responseURL, Message{ResponseType: "in_channel", Text: result})
+	}
+	if err != nil {
+		i.logf("slack: report %s: %v", rec.ID, err)
+	}
+}
+
+// wait polls rec until its run completes.
+func (i *Integration) wait(ctx context.Context, rec flow.DispatchRecord) (flow.DispatchRecord, error) {
+	ctx, cancel := context.WithTimeout(ctx, watchTimeout)
+	defer cancel()
+	for {
+		select {
+		case <-ctx.Done():
+			return rec, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+		next, err := i.Correlator.Resolve(ctx, rec)
+		if err != nil {
+			i.logf("slack: resolve %s: %v", rec.ID, err)
+			continue
+		}
+		if rec = next; rec.Completed() {
+			return rec, nil
+		}
+	}
+}
+
+func (i *Integration) reply(ctx context.Context, responseURL, text string) {
+	if err := i.respond(ctx, responseURL, Message{ReplaceOriginal: true, Text: text}); err != nil {
+		i.logf("slack: respond: %v", err)
+	}
+}
+
+// describe formats a command for a message.
+func describe(c flow.ChatCommand) string {
+	s := fmt.Sprintf("`%s` in `%s` at `%s`", escape(c.Workflow), escape(c.Repo), escape(c.Ref))
+	if len(c.Inputs) > 0 {
+		pairs := make([]string, 0, len(c.Inputs))
+		for k, v := range c.Inputs {
+			pairs = append(pairs, escape(k+"="+v))
+		}
+		sort.Strings(pairs)
+		s += " with `" + strings.Join(pairs, " ") + "`"
+	}
+	return s
+}
+
+// completion formats the result of a finished run.
+func completion(rec flow.DispatchRecord) string {
+	icon := ":x:"
+	if rec.Conclusion == "success" {
+		icon = ":white_check_mark:"
+	}
+	s := fmt.Sprintf("%s `%s` in `%s` finished: *%s*", icon, escape(rec.Workflow), escape(rec.Repo), rec.Conclusion)
+	if rec.RunURL != "" {
+		s += fmt.Sprintf(" (<%s|run %d>)", rec.RunURL, rec.RunID)
+	}
+	return s
+}
+
+func writeMessage(w http.ResponseWriter, msg Message) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(msg)
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (i *Integration) logf(format string, args ...interface{}) {
+	l := i.Logger
+	if l == nil {
+		l = log.Default()
+	}
+	l.Printf(format, args...)
+}
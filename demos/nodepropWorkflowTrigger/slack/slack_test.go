@@ -0,0 +1,261 @@
+package slack
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+var secret = []byte("signing-secret")
+
+// signedHeader signs body as Slack does at time at.
+func signedHeader(body string, at time.Time) http.Header {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("v0:" + ts + ":" + body))
+	h := http.Header{}
+	h.Set("X-Slack-Request-Timestamp", ts)
+	h.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return h
+}
+
+func TestVerifyRequest(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte("text=help")
+	tests := []struct {
+		name    string
+		header  func() http.Header
+		wantErr string
+	}{
+		{name: "valid", header: func() http.Header { return signedHeader(string(body), now) }},
+		{name: "slightly ahead", header: func() http.Header { return signedHeader(string(body), now.Add(time.Minute)) }},
+		{name: "too old", header: func() http.Header { return signedHeader(string(body), now.Add(-6*time.Minute)) }, wantErr: "too old"},
+		{name: "too far ahead", header: func() http.Header { return signedHeader(string(body), now.Add(6*time.Minute)) }, wantErr: "too old"},
+		{name: "no timestamp", header: func() http.Header { return http.Header{} }, wantErr: "invalid request timestamp"},
+		{
+			name: "no signature",
+			header: func() http.Header {
+				h := signedHeader(string(body), now)
+				h.Del("X-Slack-Signature")
+				return h
+			},
+			wantErr: "missing signature",
+		},
+		{
+			name: "not hex",
+			header: func() http.Header {
+				h := signedHeader(string(body), now)
+				h.Set("X-Slack-Signature", "v0=zz")
+				return h
+			},
+			wantErr: "invalid signature",
+		},
+		{name: "other body", header: func() http.Header { return signedHeader("text=trigger", now) }, wantErr: "invalid signature"},
+		{
+			name: "timestamp replaced",
+			header: func() http.Header {
+				h := signedHeader(string(body), now.Add(-time.Minute))
+				h.Set("X-Slack-Request-Timestamp", strconv.FormatInt(now.Unix(), 10))
+				return h
+			},
+			wantErr: "invalid signature",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyRequest(secret, tt.header(), body, now)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("VerifyRequest() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("VerifyRequest() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// responses records the messages posted to response URLs.
+type responses struct {
+	mu   sync.Mutex
+	msgs []Message
+	got  chan struct{}
+}
+
+func (r *responses) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var m Message
+	json.NewDecoder(req.Body).Decode(&m)
+	r.mu.Lock()
+	r.msgs = append(r.msgs, m)
+	r.mu.Unlock()
+	r.got <- struct{}{}
+}
+
+// next waits for the next posted message.
+func (r *responses) next(t *testing.T) Message {
+	t.Helper()
+	select {
+	case <-r.got:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message was posted")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.msgs[len(r.msgs)-1]
+}
+
+func newIntegration(t *testing.T) (*Integration, *nodeproptest.Server, *responses, *httptest.Server) {
+	t.Helper()
+	gh := nodeproptest.NewServer()
+	t.Cleanup(gh.Close)
+	gh.AddWorkflow("Cdaprod/api", "deploy.yml")
+	c := flow.NewRunCorrelator(gh.Client(), flow.NewFileHistoryStore(filepath.Join(t.TempDir(), "history.json")))
+	i := New(secret, c, nil)
+	i.Logger = log.New(io.Discard, "", 0)
+	t.Cleanup(i.Close)
+	resp := &responses{got: make(chan struct{}, 16)}
+	hooks := httptest.NewServer(resp)
+	t.Cleanup(hooks.Close)
+	i.ResponseURLPrefix = hooks.URL
+	return i, gh, resp, hooks
+}
+
+func send(t *testing.T, h http.Handler, path string, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	body := form.Encode()
+	req := httptest.NewRequest("POST", path, strings.NewReader(body))
+	req.Header = signedHeader(body, time.Now())
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func press(t *testing.T, i *Integration, user, actionID, value, responseURL string) *httptest.ResponseRecorder {
+	t.Helper()
+	payload := fmt.Sprintf(`{"type": "block_actions", "user": {"id": %q}, "response_url": %q, "actions": [{"action_id": %q, "value": %q}]}`, user, responseURL, actionID, value)
+	return send(t, i.Handler(), "/slack/interactions", url.Values{"payload": {payload}})
+}
+
+// confirmToken returns the value of the confirmation's Trigger button.
+func confirmToken(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var m struct {
+		Blocks []struct {
+			Elements []struct {
+				ActionID string `json:"action_id"`
+				Value    string `json:"value"`
+			} `json:"elements"`
+		} `json:"blocks"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &m); err != nil || len(m.Blocks) != 2 || len(m.Blocks[1].Elements) != 2 {
+		t.Fatalf("confirmation = %s", w.Body)
+	}
+	return m.Blocks[1].Elements[0].Value
+}
+
+func TestCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		registry bool
+		want     string
+	}{
+		{name: "help", text: "help", want: "Usage: `/nodeprop trigger"},
+		{name: "invalid", text: "trigger api", want: "usage:"},
+		{name: "confirm", text: "trigger Cdaprod/api deploy.yml env=prod", want: "Trigger `deploy.yml` in `Cdaprod/api` at `main` with `env=prod`?"},
+		{name: "not registered", text: "trigger Cdaprod/web deploy.yml", registry: true, want: "Repository Cdaprod/web is not registered."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i, _, _, _ := newIntegration(t)
+			if tt.registry {
+				i.Registry = flow.NewRepositoryRegistry()
+				i.Registry.RegisterRepo("Cdaprod/api", nil, []string{"deploy.yml"})
+			}
+			w := send(t, i.Handler(), "/slack/commands", url.Values{"command": {"/nodeprop"}, "text": {tt.text}, "user_id": {"U1"}})
+			var m Message
+			if err := json.Unmarshal(w.Body.Bytes(), &m); err != nil || m.ResponseType != "ephemeral" || !strings.Contains(m.Text, tt.want) {
+				t.Errorf("reply = %s, want an ephemeral %q", w.Body, tt.want)
+			}
+		})
+	}
+
+	i, _, _, _ := newIntegration(t)
+	req := httptest.NewRequest("POST", "/slack/commands", strings.NewReader("text=help"))
+	req.Header = signedHeader("text=other", time.Now())
+	w := httptest.NewRecorder()
+	i.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("unsigned command status = %d, want 401", w.Code)
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	i, gh, resp, hooks := newIntegration(t)
+	w := send(t, i.Handler(), "/slack/commands", url.Values{"text": {"trigger Cdaprod/api deploy.yml env=prod"}, "user_id": {"U1"}, "channel_id": {"C1"}})
+	token := confirmToken(t, w)
+
+	if w := press(t, i, "U1", actionConfirm, token, "https://evil.example.com/"); w.Code != http.StatusBadRequest {
+		t.Errorf("response URL elsewhere status = %d, want 400", w.Code)
+	}
+	press(t, i, "U2", actionConfirm, token, hooks.URL)
+	if m := resp.next(t); !strings.Contains(m.Text, "Only the person who ran the command") {
+		t.Errorf("another user's press replied %q", m.Text)
+	}
+	press(t, i, "U1", actionConfirm, token, hooks.URL)
+	if m := resp.next(t); !m.ReplaceOriginal || !strings.HasPrefix(m.Text, "Triggered `deploy.yml`") {
+		t.Errorf("confirmation replied %+v", m)
+	}
+	if m := resp.next(t); m.ResponseType != "in_channel" || !strings.Contains(m.Text, "<@U1> triggered") {
+		t.Errorf("notice = %+v, want it posted to the channel", m)
+	}
+	if ds := gh.Dispatches(); len(ds) != 1 || ds[0].Inputs["env"] != "prod" {
+		t.Errorf("dispatches = %+v, want one with env=prod", ds)
+	}
+	press(t, i, "U1", actionConfirm, token, hooks.URL)
+	if m := resp.next(t); !strings.Contains(m.Text, "expired or was already used") {
+		t.Errorf("second press replied %q", m.Text)
+	}
+
+	w = send(t, i.Handler(), "/slack/commands", url.Values{"text": {"trigger Cdaprod/api deploy.yml"}, "user_id": {"U1"}})
+	press(t, i, "U1", actionCancel, confirmToken(t, w), hooks.URL)
+	if m := resp.next(t); !strings.HasPrefix(m.Text, "Cancelled") {
+		t.Errorf("cancel replied %q", m.Text)
+	}
+	if n := len(gh.Dispatches()); n != 1 {
+		t.Errorf("%d dispatches after a cancel, want 1", n)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	tests := []struct {
+		rec  flow.DispatchRecord
+		want string
+	}{
+		{rec: flow.DispatchRecord{Repo: "o/r", Workflow: "ci.yml", Conclusion: "success", RunID: 7, RunURL: "https://github.com/o/r/actions/runs/7"}, want: ":white_check_mark: `ci.yml` in `o/r` finished: *success* (<https://github.com/o/r/actions/runs/7|run 7>)"},
+		{rec: flow.DispatchRecord{Repo: "o/r", Workflow: "<ci>.yml", Conclusion: "failure"}, want: ":x: `&lt;ci&gt;.yml` in `o/r` finished: *failure*"},
+	}
+	for _, tt := range tests {
+		if got := completion(tt.rec); got != tt.want {
+			t.Errorf("completion() = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package slack
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRequestAge rejects signed requests older than this, as Slack
+// recommends, so captured requests cannot be replayed later.
+const maxRequestAge = 5 * time.Minute
+
+// VerifyRequest checks the X-Slack-Signature of a request body against the
+// app's signing secret, in constant time.
+func VerifyRequest(secret []byte, h http.Header, body []byte, now time.Time) error {
+	ts := h.Get("X-Slack-Request-Timestamp")
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return errors.New("missing or invalid request timestamp")
+	}
+	if age := now.Sub(time.Unix(sec, 0)); age > maxRequestAge || age < -maxRequestAge {
+		return errors.New("request timestamp is too old")
+	}
+	sig, ok := strings.CutPrefix(h.Get("X-Slack-Signature"), "v0=")
+	if !ok {
+		return errors.New("missing signature")
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return errors.New("invalid signature")
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("v0:" + ts + ":"))
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package flow
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// DefaultSLOObjective is the fraction of dispatches an SLO without an
+// Objective expects to meet its thresholds.
+const DefaultSLOObjective = 0.95
+
+// SLO is a latency objective for a workflow's dispatches: at least
+// Objective of them start a run within StartLatency and finish it within
+// RunDuration. Each SLO sets one or both thresholds.
+type SLO struct {
+	Name string `yaml:"name" json:"name"`
+	// Workflow, if set, limits the SLO to one workflow file; empty means
+	// every workflow.
+	Workflow string `yaml:"workflow,omitempty" json:"workflow,omitempty"`
+	// StartLatency is the longest a run may take to start after dispatch.
+	StartLatency time.Duration `yaml:"start_latency,omitempty" json:"start_latency,omitempty"`
+	// RunDuration is the longest a run may take from start to finish.
+	RunDuration time.Duration `yaml:"run_duration,omitempty" json:"run_duration,omitempty"`
+	// Objective is between 0 and 1; 0 means DefaultSLOObjective.
+	Objective float64 `yaml:"objective,omitempty" json:"objective,omitempty"`
+}
+
+// Validate checks that o is named and sets a threshold.
+func (o SLO) Validate() error {
+	switch {
+	case o.Name == "":
+		return errors.New("SLO has no name")
+	case o.StartLatency < 0 || o.RunDuration < 0:
+		return fmt.Errorf("SLO %s: thresholds must not be negative", o.Name)
+	case o.StartLatency == 0 && o.RunDuration == 0:
+		return fmt.Errorf("SLO %s: set start_latency, run_duration, or both", o.Name)
+	case o.Objective < 0 || o.Objective > 1:
+		return fmt.Errorf("SLO %s: objective must be between 0 and 1", o.Name)
+	}
+	return nil
+}
+
+func (o SLO) objective() float64 {
+	if o.Objective == 0 {
+		return DefaultSLOObjective
+	}
+	return o.Objective
+}
+
+// evaluate reports whether rec's outcome against o is known at now, and if
+// so whether it met o. A run that has not started or finished yet is known
+// to miss once it is past the threshold.
+func (o SLO) evaluate(rec DispatchRecord, now time.Time) (known, met bool) {
+	// Runs resolved before start times were recorded cannot be judged.
+	if rec.Completed() && rec.RunStartedAt.IsZero() {
+		return false, false
+	}
+	if o.StartLatency > 0 {
+		if rec.RunStartedAt.IsZero() {
+			return now.Sub(rec.DispatchedAt) > o.StartLatency, false
+		}
+		if rec.StartLatency() > o.StartLatency {
+			return true, false
+		}
+	}
+	if o.RunDuration > 0 {
+		switch {
+		case rec.RunStartedAt.IsZero():
+			return now.Sub(rec.DispatchedAt) > o.RunDuration, false
+		case !rec.Completed():
+			return now.Sub(rec.RunStartedAt) > o.RunDuration, false
+		case rec.RunDuration() > o.RunDuration:
+			return true, false
+		}
+	}
+	return true, true
+}
+
+// Percentiles summarises a set of latencies. The Seconds fields repeat the
+// durations for JSON and YAML.
+type Percentiles struct {
+	Count      int           `json:"count" yaml:"count"`
+	P50        time.Duration `json:"-" yaml:"-"`
+	P95        time.Duration `json:"-" yaml:"-"`
+	P99        time.Duration `json:"-" yaml:"-"`
+	P50Seconds float64       `json:"p50_seconds" yaml:"p50_seconds"`
+	P95Seconds float64       `json:"p95_seconds" yaml:"p95_seconds"`
+	P99Seconds float64       `json:"p99_seconds" yaml:"p99_seconds"`
+}
+
+func percentiles(ds []time.Duration) Percentiles {
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	p := Percentiles{Count: len(ds), P50: percentile(ds, 50), P95: percentile(ds, 95), P99: percentile(ds, 99)}
+	p.P50Seconds, p.P95Seconds, p.P99Seconds = p.P50.Seconds(), p.P95.Seconds(), p.P99.Seconds()
+	return p
+}
+
+// percentile is the nearest-rank pth percentile of the sorted ds.
+func percentile(ds []time.Duration, p int) time.Duration {
+	if len(ds) == 0 {
+		return 0
+	}
+	rank := (p*len(ds) + 99) / 100
+	return ds[max(rank, 1)-1]
+}
+
+// SLOResult is how a workflow's dispatches fared against one SLO.
+type SLOResult struct {
+	SLO SLO `json:"-" yaml:"-"`
+	// Name, Objective, and the Seconds fields repeat the SLO for JSON and
+	// YAML; a threshold of 0 is not checked.
+	Name                string  `json:"name" yaml:"name"`
+	Objective           float64 `json:"objective" yaml:"objective"`
+	StartLatencySeconds float64 `json:"start_latency_seconds" yaml:"start_latency_seconds"`
+	RunDurationSeconds  float64 `json:"run_duration_seconds" yaml:"run_duration_seconds"`
+	// Eligible counts the dispatches whose outcome is known, and Met those
+	// that met the SLO. Dispatches GitHub rejected are not counted; alert
+	// on them with a failure rate instead.
+	Eligible int `json:"eligible" yaml:"eligible"`
+	Met      int `json:"met" yaml:"met"`
+	// Compliance is Met over Eligible, or 1 with no eligible dispatches.
+	Compliance float64 `json:"compliance" yaml:"compliance"`
+	// OK reports whether Compliance reaches the SLO's objective.
+	OK bool `json:"ok" yaml:"ok"`
+}
+
+// WorkflowLatency summarises the latencies of one workflow's dispatches
+// across repositories.
+type WorkflowLatency struct {
+	Workflow   string `json:"workflow" yaml:"workflow"`
+	Dispatches int    `json:"dispatches" yaml:"dispatches"`
+	// StartLatency is from dispatch until the run started, and RunDuration
+	// from then until it finished.
+	StartLatency Percentiles `json:"start_latency" yaml:"start_latency"`
+	RunDuration  Percentiles `json:"run_duration" yaml:"run_duration"`
+	SLOs         []SLOResult `json:"slos,omitempty" yaml:"slos,omitempty"`
+}
+
+// LatencyReport summarises dispatch latencies per workflow over a time
+// window.
+type LatencyReport struct {
+	Since     time.Time         `json:"since" yaml:"since"`
+	Until     time.Time         `json:"until" yaml:"until"`
+	Workflows []WorkflowLatency `json:"workflows" yaml:"workflows"`
+}
+
+// OK reports whether every SLO in r reaches its objective.
+func (r *LatencyReport) OK() bool {
+	for _, w := range r.Workflows {
+		for _, s := range w.SLOs {
+			if !s.OK {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// BuildLatencyReport summarises the records dispatched in [since, until)
+// per workflow and checks them against slos. Runs still in progress are
+// judged as of until, or now if that is earlier.
+func BuildLatencyReport(recs []DispatchRecord, slos []SLO, since, until time.Time) *LatencyReport {
+	now := time.Now()
+	if until.Before(now) {
+		now = until
+	}
+	byWorkflow := make(map[string][]DispatchRecord)
+	for _, rec := range recs {
+		if rec.DispatchedAt.Before(since) || !rec.DispatchedAt.Before(until) {
+			continue
+		}
+		byWorkflow[rec.Workflow] = append(byWorkflow[rec.Workflow], rec)
+	}
+
+	r := &LatencyReport{Since: since, Until: until, Workflows: []WorkflowLatency{}}
+	for workflow, rs := range byWorkflow {
+		w := WorkflowLatency{Workflow: workflow, Dispatches: len(rs)}
+		var starts, runs []time.Duration
+		for i := range rs {
+			if rs[i].RunStartedAt.IsZero() {
+				continue
+			}
+			starts = append(starts, rs[i].StartLatency())
+			if rs[i].Completed() {
+				runs = append(runs, rs[i].RunDuration())
+			}
+		}
+		w.StartLatency, w.RunDuration = percentiles(starts), percentiles(runs)
+		for _, o := range slos {
+			if o.Workflow != "" && o.Workflow != workflow {
+				continue
+			}
+			res := SLOResult{
+				SLO:                 o,
+				Name:                o.Name,
+				Objective:           o.objective(),
+				StartLatencySeconds: o.StartLatency.Seconds(),
+				RunDurationSeconds:  o.RunDuration.Seconds(),
+				Compliance:          1,
+			}
+			for _, rec := range rs {
+				if rec.Conclusion == ConclusionDispatchFailed {
+					continue
+				}
+				known, met := o.evaluate(rec, now)
+				if !known {
+					continue
+				}
+				res.Eligible++
+				if met {
+					res.Met++
+				}
+			}
+			if res.Eligible > 0 {
+				res.Compliance = float64(res.Met) / float64(res.Eligible)
+			}
+			res.OK = res.Compliance >= res.Objective
+			w.SLOs = append(w.SLOs, res)
+		}
+		r.Workflows = append(r.Workflows, w)
+	}
+	sort.Slice(r.Workflows, func(i, j int) bool { return r.Workflows[i].Workflow < r.Workflows[j].Workflow })
+	return r
+}
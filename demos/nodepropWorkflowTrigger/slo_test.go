@@ -0,0 +1,159 @@
+package flow
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSLOValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		slo     SLO
+		wantErr string
+	}{
+		{name: "start latency", slo: SLO{Name: "fast", StartLatency: time.Minute}},
+		{name: "both with objective", slo: SLO{Name: "fast", StartLatency: time.Minute, RunDuration: time.Hour, Objective: 1}},
+		{name: "unnamed", slo: SLO{StartLatency: time.Minute}, wantErr: "no name"},
+		{name: "no threshold", slo: SLO{Name: "fast"}, wantErr: "set start_latency"},
+		{name: "negative", slo: SLO{Name: "fast", RunDuration: -time.Minute}, wantErr: "negative"},
+		{name: "objective above 1", slo: SLO{Name: "fast", StartLatency: time.Minute, Objective: 1.5}, wantErr: "between 0 and 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.slo.Validate()
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Validate() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// sloRecord returns a record dispatched at at whose run started after
+// start and, if run is not negative, finished run later.
+func sloRecord(workflow string, at time.Time, start, run time.Duration) DispatchRecord {
+	rec := DispatchRecord{Repo: "o/r", Workflow: workflow, DispatchedAt: at}
+	if start >= 0 {
+		rec.RunStartedAt = at.Add(start)
+	}
+	if run >= 0 {
+		rec.Status, rec.Conclusion, rec.RunID = "completed", "success", 1
+		rec.UpdatedAt = rec.RunStartedAt.Add(run)
+	}
+	return rec
+}
+
+func TestSLOEvaluate(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	start := SLO{Name: "start", StartLatency: time.Minute}
+	run := SLO{Name: "run", RunDuration: 10 * time.Minute}
+	both := SLO{Name: "both", StartLatency: time.Minute, RunDuration: 10 * time.Minute}
+	tests := []struct {
+		name      string
+		slo       SLO
+		rec       DispatchRecord
+		now       time.Time
+		wantKnown bool
+		wantMet   bool
+	}{
+		{name: "started in time", slo: start, rec: sloRecord("d", at, 30*time.Second, -1), wantKnown: true, wantMet: true},
+		{name: "started late", slo: start, rec: sloRecord("d", at, 2*time.Minute, -1), wantKnown: true},
+		{name: "waiting within threshold", slo: start, rec: sloRecord("d", at, -1, -1), now: at.Add(30 * time.Second)},
+		{name: "waiting past threshold", slo: start, rec: sloRecord("d", at, -1, -1), now: at.Add(2 * time.Minute), wantKnown: true},
+		{name: "finished in time", slo: run, rec: sloRecord("d", at, time.Minute, 5*time.Minute), wantKnown: true, wantMet: true},
+		{name: "finished late", slo: run, rec: sloRecord("d", at, time.Minute, 20*time.Minute), wantKnown: true},
+		{name: "running within threshold", slo: run, rec: sloRecord("d", at, time.Minute, -1), now: at.Add(5 * time.Minute)},
+		{name: "running past threshold", slo: run, rec: sloRecord("d", at, time.Minute, -1), now: at.Add(20 * time.Minute), wantKnown: true},
+		{name: "both met", slo: both, rec: sloRecord("d", at, 30*time.Second, 5*time.Minute), wantKnown: true, wantMet: true},
+		{name: "both start missed", slo: both, rec: sloRecord("d", at, 2*time.Minute, 5*time.Minute), wantKnown: true},
+		{
+			name: "completed without start time", slo: start,
+			rec: DispatchRecord{DispatchedAt: at, Status: "completed", Conclusion: "success", UpdatedAt: at.Add(time.Hour)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			known, met := tt.slo.evaluate(tt.rec, tt.now)
+			if known != tt.wantKnown || met != tt.wantMet {
+				t.Errorf("evaluate() = %v, %v; want %v, %v", known, met, tt.wantKnown, tt.wantMet)
+			}
+		})
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	ds := make([]time.Duration, 100)
+	for i := range ds {
+		ds[i] = time.Duration(i+1) * time.Second
+	}
+	tests := []struct {
+		ds   []time.Duration
+		p    int
+		want time.Duration
+	}{
+		{ds: nil, p: 50},
+		{ds: ds[:1], p: 99, want: time.Second},
+		{ds: ds, p: 50, want: 50 * time.Second},
+		{ds: ds, p: 95, want: 95 * time.Second},
+		{ds: ds, p: 99, want: 99 * time.Second},
+		{ds: ds[:10], p: 95, want: 10 * time.Second},
+		{ds: ds[:10], p: 0, want: time.Second},
+	}
+	for _, tt := range tests {
+		if got := percentile(tt.ds, tt.p); got != tt.want {
+			t.Errorf("percentile(%d durations, %d) = %v, want %v", len(tt.ds), tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestBuildLatencyReport(t *testing.T) {
+	since := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	until := since.Add(24 * time.Hour)
+	at := since.Add(time.Hour)
+	recs := []DispatchRecord{
+		sloRecord("deploy.yml", at, 10*time.Second, time.Minute),
+		sloRecord("deploy.yml", at, 20*time.Second, 2*time.Minute),
+		sloRecord("deploy.yml", at, 5*time.Minute, 3*time.Minute),
+		{Repo: "o/r", Workflow: "deploy.yml", DispatchedAt: at, Status: "completed", Conclusion: ConclusionDispatchFailed, UpdatedAt: at},
+		sloRecord("test.yml", at, 10*time.Second, time.Minute),
+		sloRecord("deploy.yml", since.Add(-time.Minute), time.Hour, time.Hour),
+		sloRecord("deploy.yml", until, time.Hour, time.Hour),
+	}
+	slos := []SLO{
+		{Name: "deploy-start", Workflow: "deploy.yml", StartLatency: time.Minute, Objective: 0.6},
+		{Name: "all-run", RunDuration: 5 * time.Minute},
+	}
+
+	r := BuildLatencyReport(recs, slos, since, until)
+	if len(r.Workflows) != 2 || r.Workflows[0].Workflow != "deploy.yml" || r.Workflows[1].Workflow != "test.yml" {
+		t.Fatalf("Workflows = %+v, want deploy.yml then test.yml", r.Workflows)
+	}
+	deploy, test := r.Workflows[0], r.Workflows[1]
+	if deploy.Dispatches != 4 || deploy.StartLatency.Count != 3 || deploy.StartLatency.P50 != 20*time.Second || deploy.RunDuration.P99 != 3*time.Minute {
+		t.Errorf("deploy.yml = %+v", deploy)
+	}
+	if deploy.StartLatency.P50Seconds != 20 {
+		t.Errorf("P50Seconds = %v, want 20", deploy.StartLatency.P50Seconds)
+	}
+	if len(deploy.SLOs) != 2 || len(test.SLOs) != 1 || test.SLOs[0].Name != "all-run" {
+		t.Fatalf("SLOs = %+v and %+v, want workflow SLOs only where they apply", deploy.SLOs, test.SLOs)
+	}
+	start := deploy.SLOs[0]
+	if start.Eligible != 3 || start.Met != 2 || start.Compliance != 2.0/3 || !start.OK || start.StartLatencySeconds != 60 {
+		t.Errorf("deploy-start = %+v, want 2 of 3 met against 0.6", start)
+	}
+	if run := deploy.SLOs[1]; run.Met != 3 || run.Objective != DefaultSLOObjective || !run.OK {
+		t.Errorf("all-run = %+v, want all met", run)
+	}
+	if !r.OK() {
+		t.Error("OK() = false, want true")
+	}
+
+	slos[0].Objective = 0.9
+	if r := BuildLatencyReport(recs, slos, since, until); r.OK() || r.Workflows[0].SLOs[0].OK {
+		t.Error("OK() = true with 2 of 3 met against 0.9")
+	}
+	if r := BuildLatencyReport(nil, slos, since, until); len(r.Workflows) != 0 || r.Workflows == nil || !r.OK() {
+		t.Errorf("BuildLatencyReport(nil) = %+v, want an empty, passing report", r)
+	}
+}
@@ -0,0 +1,72 @@
+package sqlitestore
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// auditSchema creates the audit table and the triggers that refuse to
+// change or delete its rows.
+const auditSchema = `
+CREATE TABLE IF NOT EXISTS audit_log (
+	seq               INTEGER PRIMARY KEY AUTOINCREMENT,
+	time              TEXT NOT NULL,
+	actor             TEXT NOT NULL,
+	repo              TEXT NOT NULL,
+	workflow          TEXT NOT NULL,
+	ref               TEXT NOT NULL,
+	params_hash       TEXT NOT NULL,
+	result            TEXT NOT NULL,
+	error             TEXT NOT NULL,
+	dispatch_id       TEXT NOT NULL,
+	attempts          INTEGER NOT NULL,
+	token_fingerprint TEXT NOT NULL,
+	idempotency_key   TEXT NOT NULL,
+	approval          TEXT NOT NULL,
+	replay_of         TEXT NOT NULL,
+	schedule          TEXT NOT NULL,
+	correlation_id    TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS audit_log_repo_time ON audit_log (repo, time);
+CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END;
+CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END;
+`
+
+// AuditSink appends audit entries to the audit_log table. Triggers make
+// the table append-only for every client of the database.
+type AuditSink struct {
+	db *sql.DB
+}
+
+// OpenAuditSink opens or creates the database at path.
+func OpenAuditSink(path string) (*AuditSink, error) {
+	db, err := open(path, auditSchema)
+	if err != nil {
+		return nil, err
+	}
+	if err := addColumn(db, "audit_log", "correlation_id", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &AuditSink{db: db}, nil
+}
+
+// Close closes the database.
+func (s *AuditSink) Close() error {
+	return s.db.Close()
+}
+
+// Record inserts e.
+func (s *AuditSink) Record(ctx context.Context, e flow.AuditEntry) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO audit_log
+		(time, actor, repo, workflow, ref, params_hash, result, error, dispatch_id, attempts, token_fingerprint, idempotency_key, approval, replay_of, schedule, correlation_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.Time.UTC().Format(time.RFC3339Nano), e.Actor, e.Repo, e.Workflow, e.Ref, e.ParamsHash, e.Result, e.Error,
+		e.DispatchID, e.Attempts, e.TokenFingerprint, e.IdempotencyKey, e.Approval, e.ReplayOf, e.Schedule, e.CorrelationID)
+	return err
+}
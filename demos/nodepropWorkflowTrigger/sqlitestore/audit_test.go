@@ -0,0 +1,72 @@
+package sqlitestore
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+func TestAuditSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nodeprop.db")
+	s, err := OpenAuditSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.FixedZone("EST", -5*3600))
+	e := flow.AuditEntry{Time: at, Actor: "key:ci", Repo: "o/r", Workflow: "ci.yml", Ref: "main", ParamsHash: flow.ParamsHash("main", nil), Result: flow.AuditDispatched, DispatchID: "a", Attempts: 2, CorrelationID: "op"}
+	if err := s.Record(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+
+	var when, actor, correlationID string
+	var attempts int
+	if err := s.db.QueryRow("SELECT time, actor, attempts, correlation_id FROM audit_log WHERE dispatch_id = 'a'").Scan(&when, &actor, &attempts, &correlationID); err != nil {
+		t.Fatal(err)
+	}
+	if when != "2024-03-01T17:00:00Z" || actor != "key:ci" || attempts != 2 || correlationID != "op" {
+		t.Errorf("row = %s %s %d %s", when, actor, attempts, correlationID)
+	}
+
+	tests := []struct {
+		name string
+		stmt string
+	}{
+		{name: "update", stmt: "UPDATE audit_log SET result = 'failed'"},
+		{name: "delete", stmt: "DELETE FROM audit_log"},
+	}
+	for _, tt := range tests {
+		if _, err := s.db.Exec(tt.stmt); err == nil || !strings.Contains(err.Error(), "append-only") {
+			t.Errorf("%s error = %v, want the table to refuse it", tt.name, err)
+		}
+	}
+}
+
+func TestAuditSinkAddsCorrelationID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nodeprop.db")
+	// A database from before correlation IDs were audited.
+	old := strings.Replace(auditSchema, ",\n\tcorrelation_id    TEXT NOT NULL DEFAULT ''", "", 1)
+	if old == auditSchema {
+		t.Fatal("the schema has no correlation_id column to remove")
+	}
+	db, err := open(path, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	for range 2 {
+		s, err := OpenAuditSink(path)
+		if err != nil {
+			t.Fatalf("OpenAuditSink() of an old database error = %v", err)
+		}
+		if err := s.Record(context.Background(), flow.AuditEntry{Repo: "o/r", CorrelationID: "op"}); err != nil {
+			t.Errorf("Record() error = %v", err)
+		}
+		s.Close()
+	}
+}
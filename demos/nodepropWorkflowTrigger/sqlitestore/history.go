@@ -0,0 +1,185 @@
+package sqlitestore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// historySchema keeps each record as JSON alongside the columns queries
+// filter on. dispatched_at is in Unix nanoseconds so it sorts numerically.
+const historySchema = `
+CREATE TABLE IF NOT EXISTS dispatches (
+	id            TEXT PRIMARY KEY,
+	repo          TEXT NOT NULL,
+	dispatched_at INTEGER NOT NULL,
+	completed     INTEGER NOT NULL,
+	failed        INTEGER NOT NULL,
+	conclusion    TEXT NOT NULL,
+	record        TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS dispatches_repo_time ON dispatches (repo, dispatched_at);
+CREATE INDEX IF NOT EXISTS dispatches_time ON dispatches (dispatched_at);
+`
+
+// historyCorrelation indexes correlation_id, which addColumn adds since the
+// first tables were created without it.
+const historyCorrelation = `CREATE INDEX IF NOT EXISTS dispatches_correlation ON dispatches (correlation_id)`
+
+// HistoryStore is a flow.HistoryStore and flow.HistoryQuerier in the
+// dispatches table.
+type HistoryStore struct {
+	db *sql.DB
+}
+
+// OpenHistoryStore opens or creates the database at path.
+func OpenHistoryStore(path string) (*HistoryStore, error) {
+	db, err := open(path, historySchema)
+	if err != nil {
+		return nil, err
+	}
+	if err := addColumn(db, "dispatches", "correlation_id", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if _, err := db.Exec(historyCorrelation); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialise %s: %w", path, err)
+	}
+	return &HistoryStore{db: db}, nil
+}
+
+// Close closes the database.
+func (s *HistoryStore) Close() error {
+	return s.db.Close()
+}
+
+// Append adds rec to the store.
+func (s *HistoryStore) Append(rec flow.DispatchRecord) error {
+	return s.insert(s.db, "INSERT", rec)
+}
+
+// Import adds recs in one transaction, skipping records whose ID is
+// already stored. It is used to carry over a flow.FileHistoryStore.
+func (s *HistoryStore) Import(recs []flow.DispatchRecord) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, rec := range recs {
+		if err := s.insert(tx, "INSERT OR IGNORE", rec); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *HistoryStore) insert(db interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}, verb string, rec flow.DispatchRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dispatch %s: %w", rec.ID, err)
+	}
+	_, err = db.Exec(verb+` INTO dispatches (id, repo, dispatched_at, completed, failed, conclusion, correlation_id, record)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		rec.ID, rec.Repo, rec.DispatchedAt.UnixNano(), rec.Completed(), rec.Failed(), rec.Conclusion, rec.CorrelationID, string(data))
+	if err != nil {
+		return fmt.Errorf("failed to record dispatch %s: %w", rec.ID, err)
+	}
+	return nil
+}
+
+// Update replaces the record with the same ID.
+func (s *HistoryStore) Update(rec flow.DispatchRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dispatch %s: %w", rec.ID, err)
+	}
+	res, err := s.db.Exec(`UPDATE dispatches
+		SET repo = ?, dispatched_at = ?, completed = ?, failed = ?, conclusion = ?, correlation_id = ?, record = ?
+		WHERE id = ?`,
+		rec.Repo, rec.DispatchedAt.UnixNano(), rec.Completed(), rec.Failed(), rec.Conclusion, rec.CorrelationID, string(data), rec.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update dispatch %s: %w", rec.ID, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("dispatch %s not found", rec.ID)
+	}
+	return nil
+}
+
+// List returns the records for repo, newest first. An empty repo lists all
+// records.
+func (s *HistoryStore) List(repo string) ([]flow.DispatchRecord, error) {
+	return s.Query(flow.HistoryQuery{Repo: repo})
+}
+
+// Query returns the records matching q, newest first.
+func (s *HistoryStore) Query(q flow.HistoryQuery) ([]flow.DispatchRecord, error) {
+	var where []string
+	var args []interface{}
+	add := func(cond string, arg ...interface{}) {
+		where = append(where, cond)
+		args = append(args, arg...)
+	}
+	if q.Repo != "" {
+		add("repo = ?", q.Repo)
+	}
+	if q.ID != "" {
+		add("id = ?", q.ID)
+	}
+	if q.CorrelationID != "" {
+		add("correlation_id = ?", q.CorrelationID)
+	}
+	if !q.Since.IsZero() {
+		add("dispatched_at >= ?", q.Since.UnixNano())
+	}
+	if !q.Until.IsZero() {
+		add("dispatched_at < ?", q.Until.UnixNano())
+	}
+	switch q.Status {
+	case "":
+	case flow.HistoryPending:
+		add("completed = 0")
+	case flow.HistoryCompleted:
+		add("completed = 1")
+	case flow.HistoryFailed:
+		add("failed = 1")
+	default:
+		add("completed = 1 AND conclusion = ?", q.Status)
+	}
+	query := "SELECT record FROM dispatches"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	// Ties keep the order the records were appended in, as in
+	// flow.FileHistoryStore.
+	query += " ORDER BY dispatched_at DESC, rowid ASC"
+	if q.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", q.Limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query history: %w", err)
+	}
+	defer rows.Close()
+	var out []flow.DispatchRecord
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var rec flow.DispatchRecord
+		if err := json.Unmarshal([]byte(data), &rec); err != nil {
+			return nil, fmt.Errorf("failed to parse dispatch record: %w", err)
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
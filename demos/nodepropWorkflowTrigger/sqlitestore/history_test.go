@@ -0,0 +1,147 @@
+package sqlitestore
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+func openHistory(t *testing.T) *HistoryStore {
+	t.Helper()
+	s, err := OpenHistoryStore(filepath.Join(t.TempDir(), "nodeprop.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func ids(recs []flow.DispatchRecord) string {
+	var out []string
+	for _, rec := range recs {
+		out = append(out, rec.ID)
+	}
+	return strings.Join(out, ",")
+}
+
+// TestHistoryQueryParity checks Query returns what flow.FileHistoryStore
+// does for the same records.
+func TestHistoryQueryParity(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	recs := []flow.DispatchRecord{
+		{ID: "a", Repo: "o/r", DispatchedAt: at, CorrelationID: "op"},
+		{ID: "b", Repo: "o/r", DispatchedAt: at.Add(time.Minute), Status: "completed", Conclusion: "success", CorrelationID: "op"},
+		{ID: "c", Repo: "o/other", DispatchedAt: at.Add(time.Minute), Status: "completed", Conclusion: flow.ConclusionDispatchFailed},
+		{ID: "d", Repo: "o/r", DispatchedAt: at.Add(2 * time.Minute), Status: "completed", Conclusion: "cancelled"},
+		{ID: "e", Repo: "o/r", DispatchedAt: at.Add(3 * time.Minute), Status: "in_progress"},
+		{ID: "f", Repo: "o/other", DispatchedAt: at.Add(3 * time.Minute), Status: "completed", Conclusion: "failure"},
+	}
+	tests := []struct {
+		q    flow.HistoryQuery
+		want string
+	}{
+		{q: flow.HistoryQuery{}, want: "e,f,d,b,c,a"},
+		{q: flow.HistoryQuery{Repo: "o/r"}, want: "e,d,b,a"},
+		{q: flow.HistoryQuery{ID: "c"}, want: "c"},
+		{q: flow.HistoryQuery{CorrelationID: "op"}, want: "b,a"},
+		{q: flow.HistoryQuery{Since: at.Add(time.Minute), Until: at.Add(3 * time.Minute)}, want: "d,b,c"},
+		{q: flow.HistoryQuery{Status: flow.HistoryPending}, want: "e,a"},
+		{q: flow.HistoryQuery{Status: flow.HistoryCompleted, Repo: "o/r"}, want: "d,b"},
+		{q: flow.HistoryQuery{Status: flow.HistoryFailed}, want: "f,c"},
+		{q: flow.HistoryQuery{Status: "cancelled"}, want: "d"},
+		{q: flow.HistoryQuery{Status: "in_progress"}},
+		{q: flow.HistoryQuery{Limit: 2}, want: "e,f"},
+		{q: flow.HistoryQuery{Repo: "o/none"}},
+	}
+	s := openHistory(t)
+	file := flow.NewFileHistoryStore(filepath.Join(t.TempDir(), "history.json"))
+	for _, rec := range recs {
+		if err := s.Append(rec); err != nil {
+			t.Fatal(err)
+		}
+		if err := file.Append(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tt := range tests {
+		got, err := s.Query(tt.q)
+		if err != nil {
+			t.Fatalf("Query(%+v) error = %v", tt.q, err)
+		}
+		want, err := flow.QueryHistory(file, tt.q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids(got) != tt.want || ids(want) != tt.want {
+			t.Errorf("Query(%+v) = %s, file store %s; want %s", tt.q, ids(got), ids(want), tt.want)
+		}
+	}
+}
+
+func TestHistoryStore(t *testing.T) {
+	s := openHistory(t)
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	rec := flow.DispatchRecord{ID: "a", Repo: "o/r", Workflow: "ci.yml", DispatchedAt: at, Inputs: map[string]string{"env": "prod"}}
+	if err := s.Append(rec); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Append(rec); err == nil {
+		t.Error("Append() of a stored ID succeeded")
+	}
+
+	rec.Status, rec.Conclusion, rec.RunID = "completed", "failure", 42
+	if err := s.Update(rec); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Update(flow.DispatchRecord{ID: "missing"}); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Update() of a missing record error = %v", err)
+	}
+	got, err := s.List("o/r")
+	if err != nil || len(got) != 1 || got[0].RunID != 42 || !got[0].Failed() || got[0].Inputs["env"] != "prod" || !got[0].DispatchedAt.Equal(at) {
+		t.Errorf("List() = %+v, %v; want the updated record", got, err)
+	}
+
+	// Import skips what is already stored.
+	err = s.Import([]flow.DispatchRecord{{ID: "a", Repo: "o/r"}, {ID: "b", Repo: "o/r", DispatchedAt: at.Add(time.Minute)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ = s.List("")
+	if ids(got) != "b,a" || got[1].RunID != 42 {
+		t.Errorf("List() after Import = %+v", got)
+	}
+}
+
+func TestHistoryStoreAddsCorrelationID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nodeprop.db")
+	db, err := open(path, historySchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A record from before correlation IDs were stored.
+	if _, err := db.Exec(`INSERT INTO dispatches VALUES ('old', 'o/r', 0, 0, 0, '', '{"id": "old", "repo": "o/r"}')`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	s, err := OpenHistoryStore(path)
+	if err != nil {
+		t.Fatalf("OpenHistoryStore() of an old database error = %v", err)
+	}
+	defer s.Close()
+	if err := s.Append(flow.DispatchRecord{ID: "new", Repo: "o/r", CorrelationID: "op", DispatchedAt: time.Unix(1, 0)}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Query(flow.HistoryQuery{CorrelationID: "op"})
+	if err != nil || ids(got) != "new" {
+		t.Errorf("Query() by correlation ID = %+v, %v", got, err)
+	}
+	all, _ := s.List("o/r")
+	if !slices.ContainsFunc(all, func(r flow.DispatchRecord) bool { return r.ID == "old" }) {
+		t.Errorf("List() = %+v, want the old record kept", all)
+	}
+}
@@ -0,0 +1,51 @@
+// Package sqlitestore keeps nodeprop's records in a SQLite database.
+package sqlitestore
+
+import (
+	"database/sql"
+	"fmt"
+
+	// Registers the pure-Go "sqlite" driver.
+	_ "modernc.org/sqlite"
+)
+
+// open opens the database at path, waiting on locks held by other
+// processes rather than failing at once, and applies schema.
+func open(path, schema string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialise %s: %w", path, err)
+	}
+	return db, nil
+}
+
+// addColumn adds column to table unless it is already there, for databases
+// created before the column was.
+func addColumn(db *sql.DB, table, column, decl string) error {
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	if _, err := db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + decl); err != nil {
+		return fmt.Errorf("failed to add %s.%s: %w", table, column, err)
+	}
+	return nil
+}
@@ -0,0 +1,448 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultMailboxSize is the mailbox size of an ActorSystem that sets none.
+const DefaultMailboxSize = 100
+
+// DefaultRestartPolicy restarts an actor after a panic or three failures
+// in a row, waiting a second at first and doubling up to a minute, and
+// stops it after ten restarts within ten minutes.
+var DefaultRestartPolicy = RestartPolicy{
+	MaxFailures:    3,
+	InitialBackoff: time.Second,
+	MaxBackoff:     time.Minute,
+	MaxRestarts:    10,
+	Window:         10 * time.Minute,
+}
+
+var (
+	// ErrMailboxFull is returned for a message sent to an actor whose
+	// mailbox is full.
+	ErrMailboxFull = errors.New("actor mailbox is full")
+	// ErrActorStopped is returned for messages to an actor that was
+	// restarted too often, or to a stopped ActorSystem.
+	ErrActorStopped = errors.New("actor stopped")
+)
+
+// RestartPolicy says when a supervised actor is replaced with a new one.
+// A panic always restarts it; errors do once MaxFailures happen in a row,
+// not counting cancelled messages. Restarts wait InitialBackoff, doubling
+// with each restart up to MaxBackoff, while messages stay queued.
+type RestartPolicy struct {
+	MaxFailures    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// MaxRestarts within Window stops the actor for good, failing its
+	// messages with ErrActorStopped. Zero allows any number.
+	MaxRestarts int
+	Window      time.Duration
+}
+
+// backoff returns the wait before the nth restart, counting from 1.
+func (p RestartPolicy) backoff(n int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < n && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// ActorStats describes one supervised actor.
+type ActorStats struct {
+	Repo string
+	// Mailbox is the number of messages waiting, and OldestMessage how
+	// long the first of them has waited.
+	Mailbox       int
+	OldestMessage time.Duration
+	Restarts      int
+	// Failures counts failures since the last restart or success.
+	Failures  int
+	LastError string
+	// Restarting is set while the actor waits out its backoff; Stopped
+	// once it was restarted too often.
+	Restarting bool
+	Stopped    bool
+}
+
+// ActorSystem runs one long-lived Actor per repository, each reading its
+// own mailbox, and supervises them: an actor that panics, or fails as
+// often as its RestartPolicy allows, is replaced with a new one after a
+// backoff. It is itself an Actor, so it can stand in for
+// one; its methods send a message to the repository's actor and wait for
+// the result or for ctx. Create it with NewActorSystem.
+type ActorSystem struct {
+	newActor func(repo string) Actor
+	policy   RestartPolicy
+	// MailboxSize bounds each actor's waiting messages; 0 means
+	// DefaultMailboxSize.
+	MailboxSize int
+	// Clock times backoffs and message ages; nil means SystemClock.
+	Clock Clock
+	// Logger receives restarts; nil means slog.Default().
+	Logger Logger
+
+	mu      sync.Mutex
+	actors  map[string]*supervisedActor
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+// NewActorSystem returns an ActorSystem making each repository's actor
+// with newActor, such as
+//
+//	func(string) flow.Actor { return flow.NewActor(facade) }
+//
+// and restarting it as policy says.
+func NewActorSystem(newActor func(repo string) Actor, policy RestartPolicy) *ActorSystem {
+	return &ActorSystem{newActor: newActor, policy: policy, actors: map[string]*supervisedActor{}}
+}
+
+// RegisterRepo registers repo through its actor.
+func (s *ActorSystem) RegisterRepo(ctx context.Context, repo string, actions []string, workflows []string) error {
+	return s.send(ctx, repo, func(ctx context.Context, a Actor) error {
+		return a.RegisterRepo(ctx, repo, actions, workflows)
+	})
+}
+
+// RunRepoFlows runs repo's flows through its actor.
+func (s *ActorSystem) RunRepoFlows(ctx context.Context, repo string, token string) error {
+	return s.send(ctx, repo, func(ctx context.Context, a Actor) error {
+		return a.RunRepoFlows(ctx, repo, token)
+	})
+}
+
+// RunCustomFlow runs one flow of repo through its actor.
+func (s *ActorSystem) RunCustomFlow(ctx context.Context, repo string, flowType string, name string, token string, params map[string]string) error {
+	return s.send(ctx, repo, func(ctx context.Context, a Actor) error {
+		return a.RunCustomFlow(ctx, repo, flowType, name, token, params)
+	})
+}
+
+// Stats describes every actor, sorted by repository.
+func (s *ActorSystem) Stats() []ActorStats {
+	s.mu.Lock()
+	actors := make([]*supervisedActor, 0, len(s.actors))
+	for _, a := range s.actors {
+		actors = append(actors, a)
+	}
+	s.mu.Unlock()
+	now := ClockOr(s.Clock).Now()
+	stats := make([]ActorStats, 0, len(actors))
+	for _, a := range actors {
+		stats = append(stats, a.stats(now))
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Repo < stats[j].Repo })
+	return stats
+}
+
+// Stop fails the messages still waiting with ErrActorStopped, refuses new
+// ones, and waits until ctx is done for the actors to finish the messages
+// they are handling.
+func (s *ActorSystem) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	s.stopped = true
+	for _, a := range s.actors {
+		a.stop()
+	}
+	s.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// send queues fn for repo's actor, starting the actor if needed, and
+// waits for its result.
+func (s *ActorSystem) send(ctx context.Context, repo string, fn func(context.Context, Actor) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return ErrActorStopped
+	}
+	a := s.actors[repo]
+	if a == nil {
+		a = &supervisedActor{sys: s, repo: repo, changed: make(chan struct{}), quit: make(chan struct{})}
+		s.actors[repo] = a
+		s.wg.Add(1)
+		go a.run()
+	}
+	s.mu.Unlock()
+	m := &actorMessage{ctx: ctx, fn: fn, sent: ClockOr(s.Clock).Now(), reply: make(chan error, 1)}
+	if err := a.enqueue(m); err != nil {
+		return err
+	}
+	select {
+	case err := <-m.reply:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// actorMessage is a call waiting in a mailbox.
+type actorMessage struct {
+	ctx   context.Context
+	fn    func(context.Context, Actor) error
+	sent  time.Time
+	reply chan error
+}
+
+// supervisedActor is one repository's mailbox and the goroutine reading
+// it.
+type supervisedActor struct {
+	sys  *ActorSystem
+	repo string
+
+	mu      sync.Mutex
+	mailbox []*actorMessage
+	changed chan struct{}
+	// quit is closed, and done set, once the system stops.
+	quit       chan struct{}
+	done       bool
+	restarts   []time.Time
+	restarted  int
+	failures   int
+	lastErr    error
+	restarting bool
+	stopped    bool
+}
+
+func (a *supervisedActor) enqueue(m *actorMessage) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	size := a.sys.MailboxSize
+	if size <= 0 {
+		size = DefaultMailboxSize
+	}
+	switch {
+	case a.stopped || a.done:
+		return ErrActorStopped
+	case len(a.mailbox) >= size:
+		return fmt.Errorf("%s: %w", a.repo, ErrMailboxFull)
+	}
+	a.mailbox = append(a.mailbox, m)
+	a.notifyLocked()
+	return nil
+}
+
+// stop fails the waiting messages and ends the actor once it is idle.
+func (a *supervisedActor) stop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.done {
+		a.done = true
+		close(a.quit)
+	}
+	a.failLocked(ErrActorStopped)
+	a.notifyLocked()
+}
+
+func (a *supervisedActor) failLocked(err error) {
+	for _, m := range a.mailbox {
+		m.reply <- err
+	}
+	a.mailbox = nil
+}
+
+func (a *supervisedActor) notifyLocked() {
+	close(a.changed)
+	a.changed = make(chan struct{})
+}
+
+func (a *supervisedActor) stats(now time.Time) ActorStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	st := ActorStats{Repo: a.repo, Mailbox: len(a.mailbox), Restarts: a.restarted, Failures: a.failures, Restarting: a.restarting, Stopped: a.stopped}
+	if len(a.mailbox) > 0 {
+		st.OldestMessage = now.Sub(a.mailbox[0].sent)
+	}
+	if a.lastErr != nil {
+		st.LastError = a.lastErr.Error()
+	}
+	return st
+}
+
+// run handles messages until the system stops, replacing the actor as the
+// restart policy says.
+func (a *supervisedActor) run() {
+	defer a.sys.wg.Done()
+	actor := a.sys.newActor(a.repo)
+	for {
+		m, ok := a.next()
+		if !ok {
+			return
+		}
+		if err := m.ctx.Err(); err != nil {
+			m.reply <- err
+			continue
+		}
+		err := a.call(actor, m)
+		m.reply <- err
+		if !a.failed(err) {
+			continue
+		}
+		if !a.restart() {
+			return
+		}
+		actor = a.sys.newActor(a.repo)
+	}
+}
+
+// next waits for a message, or reports false once the actor is done.
+func (a *supervisedActor) next() (*actorMessage, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for len(a.mailbox) == 0 {
+		if a.done {
+			return nil, false
+		}
+		changed := a.changed
+		a.mu.Unlock()
+		<-changed
+		a.mu.Lock()
+	}
+	m := a.mailbox[0]
+	a.mailbox[0] = nil
+	a.mailbox = a.mailbox[1:]
+	return m, true
+}
+
+// actorPanic is the error of a message whose actor panicked.
+type actorPanic struct {
+	repo  string
+	value interface{}
+}
+
+func (p *actorPanic) Error() string {
+	return fmt.Sprintf("actor %s panicked: %v", p.repo, p.value)
+}
+
+// call runs m on actor, turning a panic into an *actorPanic.
+func (a *supervisedActor) call(actor Actor, m *actorMessage) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &actorPanic{repo: a.repo, value: r}
+		}
+	}()
+	return m.fn(m.ctx, actor)
+}
+
+// failed records the outcome of a message and reports whether the actor
+// must be restarted.
+func (a *supervisedActor) failed(err error) bool {
+	var p *actorPanic
+	panicked := errors.As(err, &p)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch {
+	case err == nil:
+		a.failures = 0
+		return false
+	case !panicked && ErrorClass(err) == ErrorCancelled:
+		return false
+	}
+	a.failures++
+	a.lastErr = err
+	return panicked || a.sys.policy.MaxFailures > 0 && a.failures >= a.sys.policy.MaxFailures
+}
+
+// restart waits out the backoff before the next actor, or stops the actor
+// for good if it was restarted too often, and reports whether to go on.
+func (a *supervisedActor) restart() bool {
+	p := a.sys.policy
+	clock := ClockOr(a.sys.Clock)
+	now := clock.Now()
+	a.mu.Lock()
+	kept := a.restarts[:0]
+	for _, t := range a.restarts {
+		if p.Window <= 0 || now.Sub(t) < p.Window {
+			kept = append(kept, t)
+		}
+	}
+	a.restarts = append(kept, now)
+	a.restarted++
+	if p.MaxRestarts > 0 && len(a.restarts) > p.MaxRestarts {
+		a.stopped = true
+		a.failLocked(ErrActorStopped)
+		a.mu.Unlock()
+		LoggerOr(a.sys.Logger).Error("actor stopped after too many restarts", "repo", a.repo, "restarts", len(a.restarts), "error", a.lastErr)
+		return false
+	}
+	a.restarting = true
+	wait := p.backoff(len(a.restarts))
+	a.mu.Unlock()
+	LoggerOr(a.sys.Logger).Warn("restarting actor", "repo", a.repo, "backoff", wait, "error", a.lastErr)
+	select {
+	case <-clock.After(wait):
+	case <-a.quit:
+	}
+	a.mu.Lock()
+	a.restarting = false
+	a.failures = 0
+	a.mu.Unlock()
+	return true
+}
+
+// Collector reports the actors' mailboxes and restarts to Prometheus:
+// nodeprop_actor_mailbox_messages, nodeprop_actor_mailbox_oldest_seconds,
+// and nodeprop_actor_restarts_total, labelled by repo, and
+// nodeprop_actor_stopped, 1 for an actor restarted too often.
+func (s *ActorSystem) Collector() prometheus.Collector {
+	return actorCollector{s}
+}
+
+var (
+	actorMailboxDesc = prometheus.NewDesc("nodeprop_actor_mailbox_messages",
+		"Messages waiting in a supervised actor's mailbox, by repo.", []string{"repo"}, nil)
+	actorOldestDesc = prometheus.NewDesc("nodeprop_actor_mailbox_oldest_seconds",
+		"How long the oldest message in a supervised actor's mailbox has waited, by repo.", []string{"repo"}, nil)
+	actorRestartsDesc = prometheus.NewDesc("nodeprop_actor_restarts_total",
+		"Times a supervised actor was restarted after panicking or failing, by repo.", []string{"repo"}, nil)
+	actorStoppedDesc = prometheus.NewDesc("nodeprop_actor_stopped",
+		"1 for a supervised actor stopped after too many restarts, by repo.", []string{"repo"}, nil)
+)
+
+type actorCollector struct{ s *ActorSystem }
+
+func (c actorCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- actorMailboxDesc
+	ch <- actorOldestDesc
+	ch <- actorRestartsDesc
+	ch <- actorStoppedDesc
+}
+
+func (c actorCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, st := range c.s.Stats() {
+		stopped := 0.0
+		if st.Stopped {
+			stopped = 1
+		}
+		ch <- prometheus.MustNewConstMetric(actorMailboxDesc, prometheus.GaugeValue, float64(st.Mailbox), st.Repo)
+		ch <- prometheus.MustNewConstMetric(actorOldestDesc, prometheus.GaugeValue, st.OldestMessage.Seconds(), st.Repo)
+		ch <- prometheus.MustNewConstMetric(actorRestartsDesc, prometheus.CounterValue, float64(st.Restarts), st.Repo)
+		ch <- prometheus.MustNewConstMetric(actorStoppedDesc, prometheus.GaugeValue, stopped, st.Repo)
+	}
+}
@@ -0,0 +1,265 @@
+package flow_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+// scriptedActor does what each message's token says: "ok" succeeds,
+// "fail" and "cancel" return an error, "panic" panics, and "block" waits
+// for release after closing started.
+type scriptedActor struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (a *scriptedActor) RegisterRepo(ctx context.Context, repo string, actions []string, workflows []string) error {
+	return nil
+}
+
+func (a *scriptedActor) RunRepoFlows(ctx context.Context, repo string, token string) error {
+	switch token {
+	case "fail":
+		return errors.New("dispatch failed")
+	case "cancel":
+		return context.Canceled
+	case "panic":
+		panic("boom")
+	case "block":
+		close(a.started)
+		<-a.release
+	}
+	return nil
+}
+
+func (a *scriptedActor) RunCustomFlow(ctx context.Context, repo string, flowType string, name string, token string, params map[string]string) error {
+	return a.RunRepoFlows(ctx, repo, token)
+}
+
+// newScriptedSystem returns an ActorSystem of scriptedActors on a fake
+// clock, and a count of the actors it made.
+func newScriptedSystem(t *testing.T, policy flow.RestartPolicy, actor *scriptedActor) (*flow.ActorSystem, *nodeproptest.Clock, *atomic.Int32) {
+	t.Helper()
+	var made atomic.Int32
+	sys := flow.NewActorSystem(func(string) flow.Actor {
+		made.Add(1)
+		return actor
+	}, policy)
+	clock := nodeproptest.NewClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	sys.Clock = clock
+	sys.Logger = discardLogger
+	t.Cleanup(func() { sys.Stop(context.Background()) })
+	return sys, clock, &made
+}
+
+func TestActorSystemRestart(t *testing.T) {
+	policy := flow.RestartPolicy{MaxFailures: 3, InitialBackoff: time.Second, MaxBackoff: 3 * time.Second}
+	type step struct {
+		token string
+		// backoff is the wait before the restart the message causes, if
+		// it causes one.
+		backoff time.Duration
+	}
+	tests := []struct {
+		name       string
+		policy     flow.RestartPolicy
+		steps      []step
+		wantActors int32
+	}{
+		{name: "panic restarts", policy: policy, steps: []step{{token: "panic", backoff: time.Second}}, wantActors: 2},
+		{name: "failures in a row", policy: policy, steps: []step{{token: "fail"}, {token: "fail"}, {token: "fail", backoff: time.Second}}, wantActors: 2},
+		{name: "success resets failures", policy: policy, steps: []step{{token: "fail"}, {token: "fail"}, {token: "ok"}, {token: "fail"}, {token: "fail"}}, wantActors: 1},
+		{name: "cancelled not counted", policy: policy, steps: []step{{token: "fail"}, {token: "fail"}, {token: "cancel"}, {token: "fail", backoff: time.Second}}, wantActors: 2},
+		{name: "restart resets failures", policy: policy, steps: []step{{token: "fail"}, {token: "fail"}, {token: "fail", backoff: time.Second}, {token: "fail"}, {token: "fail"}}, wantActors: 2},
+		{
+			name:   "backoff doubles up to max",
+			policy: policy,
+			steps: []step{
+				{token: "panic", backoff: time.Second},
+				{token: "panic", backoff: 2 * time.Second},
+				{token: "panic", backoff: 3 * time.Second},
+				{token: "panic", backoff: 3 * time.Second},
+			},
+			wantActors: 5,
+		},
+		{name: "no max failures", policy: flow.RestartPolicy{InitialBackoff: time.Second}, steps: []step{{token: "fail"}, {token: "fail"}, {token: "fail"}, {token: "fail"}}, wantActors: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sys, clock, made := newScriptedSystem(t, tt.policy, &scriptedActor{})
+			ctx := context.Background()
+			var restarts int
+			for i, s := range tt.steps {
+				err := sys.RunRepoFlows(ctx, "Cdaprod/site", s.token)
+				switch s.token {
+				case "ok":
+					if err != nil {
+						t.Fatalf("step %d error = %v", i, err)
+					}
+				case "panic":
+					if err == nil || !strings.Contains(err.Error(), "actor Cdaprod/site panicked: boom") {
+						t.Fatalf("step %d error = %v, want the panic", i, err)
+					}
+				default:
+					if err == nil {
+						t.Fatalf("step %d succeeded, want an error", i)
+					}
+				}
+				if s.backoff == 0 {
+					continue
+				}
+				restarts++
+				clock.BlockUntil(1)
+				if st := sys.Stats(); len(st) != 1 || !st[0].Restarting || st[0].LastError != err.Error() {
+					t.Errorf("step %d stats while restarting = %+v", i, st)
+				}
+				if d := clock.AdvanceToNext(); d != s.backoff {
+					t.Errorf("step %d backoff = %v, want %v", i, d, s.backoff)
+				}
+			}
+			// A restart the table does not expect would hold this message
+			// on the fake clock.
+			last, cancel := context.WithTimeout(ctx, 5*time.Second)
+			defer cancel()
+			if err := sys.RunRepoFlows(last, "Cdaprod/site", "ok"); err != nil {
+				t.Fatalf("final message error = %v", err)
+			}
+			if n := made.Load(); n != tt.wantActors {
+				t.Errorf("%d actors made, want %d", n, tt.wantActors)
+			}
+			st := sys.Stats()
+			if len(st) != 1 || st[0].Restarts != restarts || st[0].Failures != 0 || st[0].Restarting || st[0].Stopped {
+				t.Errorf("Stats() = %+v, want %d restarts", st, restarts)
+			}
+		})
+	}
+}
+
+func TestActorSystemMaxRestarts(t *testing.T) {
+	tests := []struct {
+		name string
+		// gap is how long passes between the two panics.
+		gap         time.Duration
+		wantStopped bool
+	}{
+		{name: "within window", wantStopped: true},
+		{name: "outside window", gap: 2 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := flow.RestartPolicy{InitialBackoff: time.Second, MaxRestarts: 1, Window: time.Minute}
+			sys, clock, _ := newScriptedSystem(t, policy, &scriptedActor{})
+			reg := prometheus.NewRegistry()
+			reg.MustRegister(sys.Collector())
+			ctx := context.Background()
+
+			sys.RunRepoFlows(ctx, "Cdaprod/site", "panic")
+			clock.BlockUntil(1)
+			clock.Advance(tt.gap)
+			clock.AdvanceToNext()
+			if err := sys.RunRepoFlows(ctx, "Cdaprod/site", "panic"); err == nil || errors.Is(err, flow.ErrActorStopped) {
+				t.Fatalf("second panic error = %v, want the panic", err)
+			}
+			if !tt.wantStopped {
+				clock.BlockUntil(1)
+				clock.AdvanceToNext()
+			}
+			err := sys.RunRepoFlows(ctx, "Cdaprod/site", "ok")
+			if got := errors.Is(err, flow.ErrActorStopped); got != tt.wantStopped {
+				t.Fatalf("message after the restarts error = %v, want stopped %v", err, tt.wantStopped)
+			}
+			st := sys.Stats()
+			if len(st) != 1 || st[0].Stopped != tt.wantStopped || st[0].Restarts != 2 {
+				t.Errorf("Stats() = %+v", st)
+			}
+			wantStopped := 0.0
+			if tt.wantStopped {
+				wantStopped = 1
+			}
+			if v := metricValue(t, reg, "nodeprop_actor_stopped", "repo", "Cdaprod/site"); v != wantStopped {
+				t.Errorf("nodeprop_actor_stopped = %v, want %v", v, wantStopped)
+			}
+			if v := metricValue(t, reg, "nodeprop_actor_restarts_total", "repo", "Cdaprod/site"); v != 2 {
+				t.Errorf("nodeprop_actor_restarts_total = %v, want 2", v)
+			}
+		})
+	}
+}
+
+func TestActorSystemMailbox(t *testing.T) {
+	actor := &scriptedActor{started: make(chan struct{}), release: make(chan struct{})}
+	sys, clock, _ := newScriptedSystem(t, flow.DefaultRestartPolicy, actor)
+	sys.MailboxSize = 1
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(sys.Collector())
+	ctx := context.Background()
+
+	handled := make(chan error, 1)
+	go func() { handled <- sys.RunRepoFlows(ctx, "Cdaprod/site", "block") }()
+	<-actor.started
+	queued := make(chan error, 1)
+	go func() { queued <- sys.RunCustomFlow(ctx, "Cdaprod/site", "deploy", "prod", "ok", nil) }()
+	for sys.Stats()[0].Mailbox != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := sys.RunRepoFlows(ctx, "Cdaprod/site", "ok"); !errors.Is(err, flow.ErrMailboxFull) {
+		t.Errorf("message to a full mailbox error = %v, want ErrMailboxFull", err)
+	}
+	// Another repository has its own actor and mailbox.
+	if err := sys.RegisterRepo(ctx, "Cdaprod/api", nil, nil); err != nil {
+		t.Errorf("RegisterRepo() error = %v", err)
+	}
+
+	clock.Advance(5 * time.Second)
+	st := sys.Stats()
+	if len(st) != 2 || st[0].Repo != "Cdaprod/api" || st[1].Repo != "Cdaprod/site" || st[1].Mailbox != 1 || st[1].OldestMessage != 5*time.Second {
+		t.Errorf("Stats() = %+v", st)
+	}
+	if v := metricValue(t, reg, "nodeprop_actor_mailbox_messages", "repo", "Cdaprod/site"); v != 1 {
+		t.Errorf("nodeprop_actor_mailbox_messages = %v, want 1", v)
+	}
+	if v := metricValue(t, reg, "nodeprop_actor_mailbox_oldest_seconds", "repo", "Cdaprod/site"); v != 5 {
+		t.Errorf("nodeprop_actor_mailbox_oldest_seconds = %v, want 5", v)
+	}
+
+	// Stop fails the queued message and waits for the one being handled.
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := sys.Stop(cancelled); !errors.Is(err, context.Canceled) {
+		t.Errorf("Stop() while a message is handled error = %v, want the context's", err)
+	}
+	if err := <-queued; !errors.Is(err, flow.ErrActorStopped) {
+		t.Errorf("queued message error = %v, want ErrActorStopped", err)
+	}
+	if err := sys.RunRepoFlows(ctx, "Cdaprod/api", "ok"); !errors.Is(err, flow.ErrActorStopped) {
+		t.Errorf("message after Stop() error = %v, want ErrActorStopped", err)
+	}
+	close(actor.release)
+	if err := <-handled; err != nil {
+		t.Errorf("handled message error = %v", err)
+	}
+	if err := sys.Stop(ctx); err != nil {
+		t.Errorf("Stop() error = %v", err)
+	}
+}
+
+func TestActorSystemCancelledMessage(t *testing.T) {
+	sys, _, made := newScriptedSystem(t, flow.DefaultRestartPolicy, &scriptedActor{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := sys.RunRepoFlows(ctx, "Cdaprod/site", "panic"); !errors.Is(err, context.Canceled) {
+		t.Errorf("RunRepoFlows() with a cancelled context error = %v", err)
+	}
+	if n := made.Load(); n != 0 {
+		t.Errorf("%d actors made for a cancelled message, want 0", n)
+	}
+}
@@ -0,0 +1,225 @@
+// Package teams posts dispatch results to Microsoft Teams and accepts
+// trigger commands from a Teams outgoing webhook.
+package teams
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// replyTimeout keeps a dispatch inside the time Teams waits for an
+// outgoing webhook to answer.
+const replyTimeout = 4 * time.Second
+
+// maxBody caps the size of an outgoing webhook request.
+const maxBody = 1 << 20
+
+// Webhook posts events to a Teams channel as Adaptive Cards. URL is an
+// incoming webhook or a Workflows "post to a channel when a webhook request
+// is received" URL.
+type Webhook struct {
+	URL        string
+	HTTPClient *http.Client
+}
+
+// Notify posts e as an Adaptive Card.
+func (w *Webhook) Notify(ctx context.Context, e flow.Event) error {
+	color := "Accent"
+	switch {
+	case e.Type == flow.EventFailed || (e.Type == flow.EventRunCompleted && e.Status != "success"):
+		color = "Attention"
+	case e.Type == flow.EventRunCompleted:
+		color = "Good"
+	}
+	card := map[string]interface{}{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"body": []interface{}{
+			map[string]interface{}{"type": "TextBlock", "text": flow.EventSummary(e), "weight": "Bolder", "color": color, "wrap": true},
+			map[string]interface{}{"type": "FactSet", "facts": facts(e)},
+		},
+	}
+	if e.RunURL != "" {
+		card["actions"] = []interface{}{
+			map[string]string{"type": "Action.OpenUrl", "title": "View run", "url": e.RunURL},
+		}
+	}
+	msg := map[string]interface{}{
+		"type": "message",
+		"attachments": []interface{}{map[string]interface{}{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content":     card,
+		}},
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	hc := w.HTTPClient
+	if hc == nil {
+		hc = flow.SharedHTTPClient()
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("POST webhook: unexpected status code: %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func facts(e flow.Event) []map[string]string {
+	f := []map[string]string{{"title": "Repository", "value": e.Repo}}
+	if e.Workflow != "" {
+		f = append(f, map[string]string{"title": "Workflow", "value": e.Workflow})
+	}
+	if e.DispatchID != "" {
+		f = append(f, map[string]string{"title": "Dispatch", "value": e.DispatchID})
+	}
+	return f
+}
+
+// OutgoingWebhook serves a Teams outgoing webhook. Mentioning the webhook
+// with "trigger owner/repo deploy.yml main env=prod" dispatches the
+// workflow and replies in the thread.
+type OutgoingWebhook struct {
+	// Secret is the decoded security token Teams shows when the outgoing
+	// webhook is created.
+	Secret     []byte
+	Correlator *flow.RunCorrelator
+	// Registry, if non-empty, is the allowlist of repositories that may be
+	// triggered.
+	Registry *flow.RepositoryRegistry
+}
+
+// NewOutgoingWebhook creates an OutgoingWebhook from the base64 security
+// token Teams issues.
+func NewOutgoingWebhook(token string, correlator *flow.RunCorrelator, registry *flow.RepositoryRegistry) (*OutgoingWebhook, error) {
+	secret, err := base64.StdEncoding.DecodeString(strings.TrimSpace(token))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Teams security token: %w", err)
+	}
+	return &OutgoingWebhook{Secret: secret, Correlator: correlator, Registry: registry}, nil
+}
+
+// activity is the subset of a Bot Framework activity used here.
+type activity struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+	From struct {
+		Name string `json:"name"`
+	} `json:"from"`
+}
+
+var (
+	mentionPattern = regexp.MustCompile(`(?s)<at>.*?</at>`)
+	tagPattern     = regexp.MustCompile(`<[^>]*>`)
+)
+
+func (o *OutgoingWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+	if err != nil {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if !o.verify(r.Header.Get("Authorization"), body) {
+		http.Error(w, "invalid request signature", http.StatusUnauthorized)
+		return
+	}
+	var a activity
+	if err := json.Unmarshal(body, &a); err != nil || a.Type != "message" {
+		http.Error(w, "invalid activity", http.StatusBadRequest)
+		return
+	}
+	// Teams sends the message as HTML with the webhook's own mention.
+	text := mentionPattern.ReplaceAllString(a.Text, " ")
+	text = html.UnescapeString(tagPattern.ReplaceAllString(text, " "))
+	text = strings.ReplaceAll(text, "\u00a0", " ")
+	reply(w, o.run(r.Context(), text, a.From.Name))
+}
+
+// verify checks the "HMAC <base64>" Authorization header in constant time.
+func (o *OutgoingWebhook) verify(auth string, body []byte) bool {
+	sig, ok := strings.CutPrefix(auth, "HMAC ")
+	if !ok {
+		return false
+	}
+	got, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, o.Secret)
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// run performs the command in text and describes the outcome.
+func (o *OutgoingWebhook) run(ctx context.Context, text, user string) string {
+	cmd, err := flow.ParseChatCommand(text)
+	if err != nil {
+		return err.Error()
+	}
+	if cmd.Name == "help" {
+		return "Usage: " + flow.ChatUsage
+	}
+	if o.Registry != nil && len(o.Registry.Repos()) > 0 {
+		if _, ok := o.Registry.Get(cmd.Repo); !ok {
+			return fmt.Sprintf("Repository %s is not registered.", cmd.Repo)
+		}
+	}
+	if cmd.Ref == "" {
+		cmd.Ref = "main"
+	}
+	ctx, cancel := context.WithTimeout(ctx, replyTimeout)
+	defer cancel()
+	req := flow.DispatchRequest{
+		Repo:     cmd.Repo,
+		Workflow: cmd.Workflow,
+		Ref:      cmd.Ref,
+		Inputs:   cmd.Inputs,
+	}
+	if user != "" {
+		req.RequestedBy = "teams:" + user
+	}
+	rec, err := o.Correlator.Submit(ctx, req)
+	var held *flow.ApprovalRequiredError
+	if errors.As(err, &held) {
+		return fmt.Sprintf("%s in %s needs approval %s; it will be dispatched once approved.", cmd.Workflow, cmd.Repo, held.Approval.ID)
+	}
+	if err != nil {
+		return fmt.Sprintf("Failed to trigger %s in %s: %v", cmd.Workflow, cmd.Repo, err)
+	}
+	by := ""
+	if user != "" {
+		by = " for " + user
+	}
+	return fmt.Sprintf("Triggered %s in %s at %s%s (dispatch %s).", cmd.Workflow, cmd.Repo, cmd.Ref, by, rec.ID)
+}
+
+func reply(w http.ResponseWriter, text string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"type": "message", "text": text})
+}
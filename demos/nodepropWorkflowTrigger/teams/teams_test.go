@@ -0,0 +1,133 @@
+package teams
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+func TestWebhookNotify(t *testing.T) {
+	tests := []struct {
+		name    string
+		e       flow.Event
+		color   string
+		actions int
+		facts   int
+	}{
+		{name: "success", e: flow.Event{Type: flow.EventRunCompleted, Status: "success", RunURL: "https://github.com/o/r/actions/runs/1"}, color: "Good", actions: 1, facts: 2},
+		{name: "failed run", e: flow.Event{Type: flow.EventRunCompleted, Status: "cancelled"}, color: "Attention", facts: 2},
+		{name: "failed dispatch", e: flow.Event{Type: flow.EventFailed, DispatchID: "d1"}, color: "Attention", facts: 3},
+		{name: "approval", e: flow.Event{Type: flow.EventApprovalRequested}, color: "Accent", facts: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got struct {
+				Attachments []struct {
+					Content struct {
+						Body []struct {
+							Text  string `json:"text"`
+							Color string `json:"color"`
+							Facts []struct {
+								Title string `json:"title"`
+							} `json:"facts"`
+						} `json:"body"`
+						Actions []json.RawMessage `json:"actions"`
+					} `json:"content"`
+				} `json:"attachments"`
+			}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewDecoder(r.Body).Decode(&got)
+			}))
+			defer srv.Close()
+			tt.e.Repo, tt.e.Workflow = "o/r", "ci.yml"
+
+			if err := (&Webhook{URL: srv.URL}).Notify(t.Context(), tt.e); err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Attachments) != 1 || len(got.Attachments[0].Content.Body) != 2 {
+				t.Fatalf("message = %+v, want one card", got)
+			}
+			card := got.Attachments[0].Content
+			if card.Body[0].Color != tt.color || card.Body[0].Text != flow.EventSummary(tt.e) || len(card.Actions) != tt.actions {
+				t.Errorf("card = %+v, want colour %s and %d actions", card, tt.color, tt.actions)
+			}
+			if len(card.Body[1].Facts) != tt.facts {
+				t.Errorf("facts = %+v, want %d", card.Body[1].Facts, tt.facts)
+			}
+		})
+	}
+}
+
+func TestNewOutgoingWebhook(t *testing.T) {
+	if _, err := NewOutgoingWebhook("not base64!", nil, nil); err == nil {
+		t.Error("NewOutgoingWebhook() accepted an invalid token")
+	}
+	o, err := NewOutgoingWebhook(" "+base64.StdEncoding.EncodeToString([]byte("secret"))+"\n", nil, nil)
+	if err != nil || string(o.Secret) != "secret" {
+		t.Errorf("NewOutgoingWebhook() = %+v, %v", o, err)
+	}
+}
+
+func TestOutgoingWebhook(t *testing.T) {
+	gh := nodeproptest.NewServer()
+	defer gh.Close()
+	gh.AddWorkflow("Cdaprod/api", "deploy.yml")
+	c := flow.NewRunCorrelator(gh.Client(), flow.NewFileHistoryStore(filepath.Join(t.TempDir(), "history.json")))
+	reg := flow.NewRepositoryRegistry()
+	reg.RegisterRepo("Cdaprod/api", nil, []string{"deploy.yml"})
+	o := &OutgoingWebhook{Secret: []byte("secret"), Correlator: c, Registry: reg}
+
+	sign := func(body string) string {
+		mac := hmac.New(sha256.New, o.Secret)
+		mac.Write([]byte(body))
+		return "HMAC " + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+	activity := func(text string) string {
+		data, _ := json.Marshal(map[string]interface{}{"type": "message", "text": text, "from": map[string]string{"name": "Ada"}})
+		return string(data)
+	}
+	tests := []struct {
+		name   string
+		body   string
+		auth   func(body string) string
+		status int
+		want   string
+	}{
+		{name: "unsigned", body: activity("help"), auth: func(string) string { return "" }, status: 401},
+		{name: "wrong secret", body: activity("help"), auth: func(b string) string { return sign(b + " ") }, status: 401},
+		{name: "not base64", body: activity("help"), auth: func(string) string { return "HMAC %%%" }, status: 401},
+		{name: "not a message", body: `{"type": "conversationUpdate"}`, auth: sign, status: 400},
+		{name: "help", body: activity("<at>nodeprop</at> help"), auth: sign, status: 200, want: "Usage: "},
+		{name: "not registered", body: activity("<at>nodeprop</at> trigger Cdaprod/web deploy.yml"), auth: sign, status: 200, want: "Repository Cdaprod/web is not registered."},
+		{
+			name:   "trigger",
+			body:   activity("<at>nodeprop</at>&nbsp;<p>trigger Cdaprod/api deploy.yml env=a&amp;b</p>"),
+			auth:   sign,
+			status: 200,
+			want:   "Triggered deploy.yml in Cdaprod/api at main for Ada (dispatch ",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/teams", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", tt.auth(tt.body))
+			w := httptest.NewRecorder()
+			o.ServeHTTP(w, req)
+			if w.Code != tt.status || !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("response = %d %s, want %d %q", w.Code, w.Body, tt.status, tt.want)
+			}
+		})
+	}
+	if ds := gh.Dispatches(); len(ds) != 1 || ds[0].Inputs["env"] != "a&b" {
+		t.Errorf("dispatches = %+v, want one with the unescaped input", ds)
+	}
+}
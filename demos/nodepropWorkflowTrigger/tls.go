@@ -0,0 +1,169 @@
+package flow
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLSConfig is the certificates of one side of a connection: an outbound
+// client presenting a client certificate to an internal system, or a
+// listener terminating mutual TLS.
+//
+//	tls:
+//	  ca: /etc/nodeprop/tls/internal-ca.pem
+//	  cert: /etc/nodeprop/tls/client.pem
+//	  key: /etc/nodeprop/tls/client-key.pem
+type TLSConfig struct {
+	// CA is a PEM file of certificate authorities. A client trusts them
+	// instead of the system's to sign the server's certificate; a listener
+	// requires clients to present a certificate they signed.
+	CA string `yaml:"ca,omitempty" json:"ca,omitempty"`
+	// Cert and Key are PEM files of this side's certificate and private
+	// key. They are read again when either file changes, so certificates
+	// renewed on disk are used without a restart.
+	Cert string `yaml:"cert,omitempty" json:"cert,omitempty"`
+	Key  string `yaml:"key,omitempty" json:"key,omitempty"`
+	// ServerName, if set, is the name a client verifies the server's
+	// certificate against instead of the host it dials.
+	ServerName string `yaml:"server_name,omitempty" json:"server_name,omitempty"`
+	// ClientAuth is what a listener with a CA asks of clients: require, the
+	// default, or verify, which accepts clients without a certificate but
+	// verifies those that present one.
+	ClientAuth string `yaml:"client_auth,omitempty" json:"client_auth,omitempty"`
+}
+
+// IsZero reports whether t configures nothing.
+func (t *TLSConfig) IsZero() bool {
+	return t == nil || *t == TLSConfig{}
+}
+
+// ClientConfig returns the tls.Config of a client presenting t's
+// certificate, if any, and trusting t's CA, if any.
+func (t *TLSConfig) ClientConfig() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: t.ServerName}
+	if t.CA != "" {
+		pool, err := loadCertPool(t.CA)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	if t.Cert != "" || t.Key != "" {
+		kp, err := newKeyPair(t.Cert, t.Key)
+		if err != nil {
+			return nil, err
+		}
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return kp.get()
+		}
+	}
+	return cfg, nil
+}
+
+// ServerConfig returns the tls.Config of a listener serving t's
+// certificate and, with a CA, verifying clients' certificates.
+func (t *TLSConfig) ServerConfig() (*tls.Config, error) {
+	if t.Cert == "" || t.Key == "" {
+		return nil, errors.New("tls: a listener needs both cert and key")
+	}
+	kp, err := newKeyPair(t.Cert, t.Key)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return kp.get() },
+	}
+	switch t.ClientAuth {
+	case "", "require":
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	case "verify":
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	default:
+		return nil, fmt.Errorf("tls: unknown client_auth %q (want require or verify)", t.ClientAuth)
+	}
+	if t.CA == "" {
+		cfg.ClientAuth = tls.NoClientCert
+		return cfg, nil
+	}
+	if cfg.ClientCAs, err = loadCertPool(t.CA); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// HTTPClient returns an HTTP client whose connections use t's
+// ClientConfig and otherwise the settings of DefaultHTTPConfig, or
+// SharedHTTPClient if t configures nothing.
+func (t *TLSConfig) HTTPClient() (*http.Client, error) {
+	if t.IsZero() {
+		return SharedHTTPClient(), nil
+	}
+	return HTTPConfig{}.Client(t)
+}
+
+// loadCertPool reads a PEM file of certificates.
+func loadCertPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("tls: failed to read CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("tls: no certificates in %s", file)
+	}
+	return pool, nil
+}
+
+// keyPair is a certificate and key loaded from files, reloaded when their
+// modification times change.
+type keyPair struct {
+	cert, key string
+
+	mu      sync.Mutex
+	modTime [2]time.Time
+	pair    *tls.Certificate
+}
+
+// newKeyPair loads cert and key, failing early on bad files.
+func newKeyPair(cert, key string) (*keyPair, error) {
+	if cert == "" || key == "" {
+		return nil, errors.New("tls: cert and key must be set together")
+	}
+	kp := &keyPair{cert: cert, key: key}
+	if _, err := kp.get(); err != nil {
+		return nil, err
+	}
+	return kp, nil
+}
+
+// get returns the pair, reloading it if either file changed. A reload
+// that fails, e.g. halfway through a renewal, keeps the previous pair.
+func (kp *keyPair) get() (*tls.Certificate, error) {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+	var mod [2]time.Time
+	for i, f := range []string{kp.cert, kp.key} {
+		if fi, err := os.Stat(f); err == nil {
+			mod[i] = fi.ModTime()
+		}
+	}
+	if kp.pair != nil && mod == kp.modTime {
+		return kp.pair, nil
+	}
+	pair, err := tls.LoadX509KeyPair(kp.cert, kp.key)
+	if err != nil {
+		if kp.pair != nil {
+			return kp.pair, nil
+		}
+		return nil, fmt.Errorf("tls: %w", err)
+	}
+	kp.pair, kp.modTime = &pair, mod
+	return kp.pair, nil
+}
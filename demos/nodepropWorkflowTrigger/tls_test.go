@@ -0,0 +1,257 @@
+package flow
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCA issues certificates for TLS tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	// file is the CA certificate's PEM file.
+	file string
+}
+
+func newTestCA(t *testing.T, dir string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	ca := &testCA{cert: cert, key: key, file: filepath.Join(dir, "ca.pem")}
+	writePEM(t, ca.file, "CERTIFICATE", der)
+	return ca
+}
+
+// issue writes a certificate for name and its key to dir/name.pem and
+// dir/name-key.pem and returns their paths.
+func (ca *testCA) issue(t *testing.T, dir, name string) (cert, key string) {
+	t.Helper()
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &k.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, key = filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem")
+	writePEM(t, cert, "CERTIFICATE", der)
+	writePEM(t, key, "EC PRIVATE KEY", keyDER)
+	return cert, key
+}
+
+func writePEM(t *testing.T, file, typ string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir)
+	cert, key := ca.issue(t, dir, "server")
+	garbage := filepath.Join(dir, "garbage.pem")
+	if err := os.WriteFile(garbage, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		cfg     TLSConfig
+		server  bool
+		wantErr string
+	}{
+		{name: "client zero", cfg: TLSConfig{}},
+		{name: "client ca", cfg: TLSConfig{CA: ca.file}},
+		{name: "client missing ca", cfg: TLSConfig{CA: filepath.Join(dir, "missing.pem")}, wantErr: "failed to read CA"},
+		{name: "client bad ca", cfg: TLSConfig{CA: garbage}, wantErr: "no certificates"},
+		{name: "client cert without key", cfg: TLSConfig{Cert: cert}, wantErr: "set together"},
+		{name: "client mismatched pair", cfg: TLSConfig{Cert: cert, Key: garbage}, wantErr: "tls:"},
+		{name: "server", cfg: TLSConfig{Cert: cert, Key: key}, server: true},
+		{name: "server without key", cfg: TLSConfig{Cert: cert}, server: true, wantErr: "both cert and key"},
+		{name: "server bad client auth", cfg: TLSConfig{Cert: cert, Key: key, CA: ca.file, ClientAuth: "optional"}, server: true, wantErr: "unknown client_auth"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			if tt.server {
+				_, err = tt.cfg.ServerConfig()
+			} else {
+				_, err = tt.cfg.ClientConfig()
+			}
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServerConfigClientAuth(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir)
+	cert, key := ca.issue(t, dir, "server")
+	tests := []struct {
+		cfg  TLSConfig
+		want tls.ClientAuthType
+	}{
+		{cfg: TLSConfig{Cert: cert, Key: key}, want: tls.NoClientCert},
+		{cfg: TLSConfig{Cert: cert, Key: key, ClientAuth: "verify"}, want: tls.NoClientCert},
+		{cfg: TLSConfig{Cert: cert, Key: key, CA: ca.file}, want: tls.RequireAndVerifyClientCert},
+		{cfg: TLSConfig{Cert: cert, Key: key, CA: ca.file, ClientAuth: "require"}, want: tls.RequireAndVerifyClientCert},
+		{cfg: TLSConfig{Cert: cert, Key: key, CA: ca.file, ClientAuth: "verify"}, want: tls.VerifyClientCertIfGiven},
+	}
+	for _, tt := range tests {
+		cfg, err := tt.cfg.ServerConfig()
+		if err != nil || cfg.ClientAuth != tt.want || cfg.MinVersion != tls.VersionTLS12 {
+			t.Errorf("ServerConfig(%+v) = %v, %v; want %v", tt.cfg, cfg.ClientAuth, err, tt.want)
+		}
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir)
+	other := newTestCA(t, t.TempDir())
+	serverCert, serverKey := ca.issue(t, dir, "server")
+	clientCert, clientKey := ca.issue(t, dir, "client")
+	strangerCert, strangerKey := other.issue(t, t.TempDir(), "stranger")
+
+	tests := []struct {
+		name       string
+		clientAuth string
+		client     TLSConfig
+		wantErr    bool
+	}{
+		{name: "client certificate", client: TLSConfig{CA: ca.file, Cert: clientCert, Key: clientKey}},
+		{name: "server name", client: TLSConfig{CA: ca.file, Cert: clientCert, Key: clientKey, ServerName: "server"}},
+		{name: "no client certificate", client: TLSConfig{CA: ca.file}, wantErr: true},
+		{name: "optional client certificate", clientAuth: "verify", client: TLSConfig{CA: ca.file}},
+		{name: "untrusted client", clientAuth: "verify", client: TLSConfig{CA: ca.file, Cert: strangerCert, Key: strangerKey}, wantErr: true},
+		{name: "untrusted server", client: TLSConfig{CA: other.file, Cert: clientCert, Key: clientKey}, wantErr: true},
+		{name: "wrong server name", client: TLSConfig{CA: ca.file, Cert: clientCert, Key: clientKey, ServerName: "elsewhere"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srvCfg, err := (&TLSConfig{CA: ca.file, Cert: serverCert, Key: serverKey, ClientAuth: tt.clientAuth}).ServerConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// StartTLS would install httptest's own certificate, so the
+			// listener is wrapped directly.
+			srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			srv.Listener = tls.NewListener(srv.Listener, srvCfg)
+			srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+			srv.Start()
+			defer srv.Close()
+
+			hc, err := tt.client.HTTPClient()
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := hc.Get("https://" + srv.Listener.Addr().String())
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GET error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKeyPairReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir)
+	cert, key := ca.issue(t, dir, "client")
+	kp, err := newKeyPair(cert, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := kp.get()
+	if again, _ := kp.get(); again != first {
+		t.Error("get() reloaded unchanged files")
+	}
+
+	// A renewal halfway written keeps the previous pair.
+	later := time.Now().Add(time.Minute)
+	if err := os.WriteFile(cert, []byte("partial"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(cert, later, later)
+	if got, err := kp.get(); err != nil || got != first {
+		t.Errorf("get() during a renewal = %p, %v; want the previous pair", got, err)
+	}
+
+	renewDir := t.TempDir()
+	newCert, newKey := ca.issue(t, renewDir, "client")
+	for _, f := range [][2]string{{newCert, cert}, {newKey, key}} {
+		data, _ := os.ReadFile(f[0])
+		if err := os.WriteFile(f[1], data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		later = later.Add(time.Minute)
+		os.Chtimes(f[1], later, later)
+	}
+	got, err := kp.get()
+	if err != nil || got == first || string(got.Certificate[0]) == string(first.Certificate[0]) {
+		t.Errorf("get() after renewal = %v; want the new pair", err)
+	}
+}
+
+func TestTLSConfigIsZero(t *testing.T) {
+	var nilCfg *TLSConfig
+	if !nilCfg.IsZero() || !(&TLSConfig{}).IsZero() || (&TLSConfig{ServerName: "x"}).IsZero() {
+		t.Error("IsZero() is wrong")
+	}
+	hc, err := nilCfg.HTTPClient()
+	if err != nil || hc != SharedHTTPClient() {
+		t.Errorf("HTTPClient() of a zero config = %v, %v; want the shared client", hc, err)
+	}
+}
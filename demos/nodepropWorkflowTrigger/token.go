@@ -0,0 +1,134 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// TokenProvider supplies GitHub tokens on demand.
+type TokenProvider interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// StaticToken is a TokenProvider that always returns the same token.
+type StaticToken string
+
+// Token returns t.
+func (t StaticToken) Token(ctx context.Context) (string, error) {
+	if t == "" {
+		return "", fmt.Errorf("empty token")
+	}
+	return string(t), nil
+}
+
+// EnvToken reads the first non-empty environment variable from the list.
+type EnvToken []string
+
+// Token returns the value of the first set variable.
+func (e EnvToken) Token(ctx context.Context) (string, error) {
+	for _, key := range e {
+		if v := os.Getenv(key); v != "" {
+			return v, nil
+		}
+	}
+	return "", fmt.Errorf("none of %s is set", strings.Join(e, ", "))
+}
+
+// FileToken reads a token from a file.
+type FileToken string
+
+// Token returns the trimmed file contents.
+func (f FileToken) Token(ctx context.Context) (string, error) {
+	data, err := os.ReadFile(string(f))
+	if err != nil {
+		return "", fmt.Errorf("failed to read token file: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty", f)
+	}
+	return token, nil
+}
+
+// CommandToken runs a command and uses its output as the token, e.g.
+// `gh auth token --hostname ghe.example.com`.
+type CommandToken []string
+
+// Token runs the command and returns its trimmed stdout.
+func (c CommandToken) Token(ctx context.Context) (string, error) {
+	if len(c) == 0 {
+		return "", fmt.Errorf("empty token command")
+	}
+	out, err := exec.CommandContext(ctx, c[0], c[1:]...).Output()
+	if err != nil {
+		return "", fmt.Errorf("token command %q failed: %w", c[0], err)
+	}
+	token := strings.TrimSpace(string(out))
+	if token == "" {
+		return "", fmt.Errorf("token command %q printed nothing", c[0])
+	}
+	return token, nil
+}
+
+// DefaultTokenProvider reads GITHUB_TOKEN, then GH_TOKEN.
+var DefaultTokenProvider TokenProvider = EnvToken{"GITHUB_TOKEN", "GH_TOKEN"}
+
+var (
+	sourcesMu    sync.RWMutex
+	tokenSources = map[string]func(arg string) (TokenProvider, error){}
+)
+
+// RegisterTokenSource makes ParseTokenSource accept sources of the form
+// kind:ARG, built by parse from ARG. It is meant for providers in other
+// packages, such as a secret manager's, and panics if kind is taken.
+func RegisterTokenSource(kind string, parse func(arg string) (TokenProvider, error)) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	switch _, dup := tokenSources[kind]; {
+	case kind == "env", kind == "file", kind == "command", dup:
+		panic("flow: token source " + kind + " registered twice")
+	}
+	tokenSources[kind] = parse
+}
+
+// ParseTokenSource builds a TokenProvider from a source string:
+//
+//	env:NAME          environment variable
+//	file:PATH         file containing the token
+//	command:CMD ARGS  command printing the token
+//
+// or one of the kinds added with RegisterTokenSource. An empty source
+// yields DefaultTokenProvider. The values the other sources read are added
+// to Secrets.
+func ParseTokenSource(source string) (TokenProvider, error) {
+	if source == "" {
+		return DefaultTokenProvider, nil
+	}
+	kind, arg, ok := strings.Cut(source, ":")
+	if !ok || arg == "" {
+		return nil, fmt.Errorf("invalid token source %q", source)
+	}
+	switch kind {
+	case "env":
+		return redactedToken{EnvToken{arg}}, nil
+	case "file":
+		return redactedToken{FileToken(arg)}, nil
+	case "command":
+		return redactedToken{CommandToken(strings.Fields(arg))}, nil
+	}
+	sourcesMu.RLock()
+	parse, ok := tokenSources[kind]
+	sourcesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown token source type %q", kind)
+	}
+	tp, err := parse(arg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token source %q: %w", source, err)
+	}
+	return redactedToken{tp}, nil
+}
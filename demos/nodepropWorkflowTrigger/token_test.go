@@ -0,0 +1,111 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// registerTestSource keeps -count above 1 from registering twice.
+var registerTestSource sync.Once
+
+func TestParseTokenSource(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenFile, []byte("token-from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	emptyFile := filepath.Join(dir, "empty")
+	if err := os.WriteFile(emptyFile, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("NODEPROP_TEST_TOKEN", "token-from-env")
+	registerTestSource.Do(func() {
+		RegisterTokenSource("test-static", func(arg string) (TokenProvider, error) {
+			if arg == "bad" {
+				return nil, errors.New("bad argument")
+			}
+			return StaticToken("token-" + arg), nil
+		})
+	})
+
+	tests := []struct {
+		source   string
+		want     string
+		parseErr string
+		tokenErr string
+	}{
+		{source: "env:NODEPROP_TEST_TOKEN", want: "token-from-env"},
+		{source: "env:NODEPROP_TEST_UNSET", tokenErr: "none of NODEPROP_TEST_UNSET is set"},
+		{source: "file:" + tokenFile, want: "token-from-file"},
+		{source: "file:" + emptyFile, tokenErr: "is empty"},
+		{source: "file:" + filepath.Join(dir, "missing"), tokenErr: "failed to read token file"},
+		{source: "command:echo token-from-command", want: "token-from-command"},
+		{source: "command:true", tokenErr: "printed nothing"},
+		{source: "command:false", tokenErr: "failed"},
+		{source: "test-static:registered", want: "token-registered"},
+		{source: "test-static:bad", parseErr: "bad argument"},
+		{source: "env:", parseErr: "invalid token source"},
+		{source: "GITHUB_TOKEN", parseErr: "invalid token source"},
+		{source: "vault:secret/token", parseErr: "unknown token source type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			tp, err := ParseTokenSource(tt.source)
+			if tt.parseErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.parseErr) {
+					t.Fatalf("ParseTokenSource() error = %v, want %q", err, tt.parseErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTokenSource() error = %v", err)
+			}
+			got, err := tp.Token(context.Background())
+			if tt.tokenErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.tokenErr) {
+					t.Errorf("Token() error = %v, want %q", err, tt.tokenErr)
+				}
+				return
+			}
+			defer Secrets.Remove(got)
+			if err != nil || got != tt.want {
+				t.Fatalf("Token() = %q, %v; want %q", got, err, tt.want)
+			}
+			if Secrets.Redact(got) != Redacted {
+				t.Errorf("Token() did not add %q to Secrets", got)
+			}
+		})
+	}
+
+	if tp, err := ParseTokenSource(""); err != nil || !reflect.DeepEqual(tp, DefaultTokenProvider) {
+		t.Errorf("ParseTokenSource(\"\") = %v, %v; want DefaultTokenProvider", tp, err)
+	}
+}
+
+func TestRegisterTokenSourceTwice(t *testing.T) {
+	for _, kind := range []string{"env", "file", "command"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("RegisterTokenSource(%q) did not panic", kind)
+				}
+			}()
+			RegisterTokenSource(kind, nil)
+		}()
+	}
+}
+
+func TestStaticToken(t *testing.T) {
+	if got, err := StaticToken("abc").Token(context.Background()); err != nil || got != "abc" {
+		t.Errorf("Token() = %q, %v", got, err)
+	}
+	if _, err := StaticToken("").Token(context.Background()); err == nil {
+		t.Error("empty StaticToken returned no error")
+	}
+}
@@ -0,0 +1,48 @@
+package flow
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the instrumentation name of the library's spans.
+const TracerName = "github.com/Cdaprod/nodeprop-action"
+
+// tracer returns the library's tracer from tp, or from the global provider
+// if tp is nil.
+func tracer(tp trace.TracerProvider) trace.Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(TracerName)
+}
+
+// startSpan starts a span named name with the attributes of req.
+func startSpan(ctx context.Context, tp trace.TracerProvider, name string, req DispatchRequest, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs,
+		attribute.String("nodeprop.repo", req.Repo),
+		attribute.String("nodeprop.workflow", req.Workflow),
+	)
+	if req.Ref != "" {
+		attrs = append(attrs, attribute.String("nodeprop.ref", req.Ref))
+	}
+	if req.CorrelationID != "" {
+		attrs = append(attrs, attribute.String("nodeprop.correlation_id", req.CorrelationID))
+	}
+	return tracer(tp).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan marks span failed if err is set, and ends it. A repeated
+// idempotency key is not a failure.
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, ErrAlreadyDispatched) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,147 @@
+package flow_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+)
+
+// spanAttr returns the value of span's attribute key, or "".
+func spanAttr(span sdktrace.ReadOnlySpan, key string) string {
+	for _, kv := range span.Attributes() {
+		if string(kv.Key) == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestSubmitSpans(t *testing.T) {
+	tests := []struct {
+		name       string
+		fault      *nodeproptest.Fault
+		key        bool
+		wantStatus codes.Code
+		// github is the status code recorded on the API request's span.
+		github string
+	}{
+		{name: "dispatched", wantStatus: codes.Unset, github: "204"},
+		{name: "rejected", fault: &nodeproptest.Fault{Status: 422}, wantStatus: codes.Error, github: "422"},
+		{name: "already dispatched", key: true, wantStatus: codes.Unset},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := nodeproptest.NewServer()
+			defer gh.Close()
+			gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+			if tt.fault != nil {
+				f := *tt.fault
+				f.Path = "/repos/*/*/actions/workflows/*/dispatches"
+				gh.Inject(f)
+			}
+			spans := tracetest.NewInMemoryExporter()
+			c := newCorrelator(t, gh)
+			c.TracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSyncer(spans))
+			c.Client.TracerProvider = c.TracerProvider
+			req := flow.DispatchRequest{Repo: "Cdaprod/site", Workflow: "deploy.yml", Ref: "main"}
+			if tt.key {
+				req.IdempotencyKey = "delivery-1"
+				if _, err := c.Submit(context.Background(), req); err != nil {
+					t.Fatal(err)
+				}
+				spans.Reset()
+			}
+
+			rec, err := c.Submit(context.Background(), req)
+			if tt.key && !errors.Is(err, flow.ErrAlreadyDispatched) {
+				t.Fatalf("Submit() error = %v, want ErrAlreadyDispatched", err)
+			}
+			var submit, dispatch, github sdktrace.ReadOnlySpan
+			for _, s := range spans.GetSpans().Snapshots() {
+				switch s.Name() {
+				case "nodeprop.submit":
+					submit = s
+				case "nodeprop.dispatch":
+					dispatch = s
+				case "github POST":
+					github = s
+				}
+			}
+			if submit == nil {
+				t.Fatal("no nodeprop.submit span")
+			}
+			if submit.Status().Code != tt.wantStatus {
+				t.Errorf("submit span status = %v, want %v", submit.Status(), tt.wantStatus)
+			}
+			if spanAttr(submit, "nodeprop.repo") != "Cdaprod/site" || spanAttr(submit, "nodeprop.ref") != "main" || spanAttr(submit, "nodeprop.correlation_id") == "" {
+				t.Errorf("submit span attributes = %v", submit.Attributes())
+			}
+			if rec != nil && spanAttr(submit, "nodeprop.dispatch_id") != rec.ID {
+				t.Errorf("submit span dispatch_id = %q, want %s", spanAttr(submit, "nodeprop.dispatch_id"), rec.ID)
+			}
+			if tt.github == "" {
+				if github != nil {
+					t.Error("a repeated idempotency key reached the API")
+				}
+				return
+			}
+			if dispatch == nil || dispatch.Parent().SpanID() != submit.SpanContext().SpanID() || spanAttr(dispatch, "nodeprop.attempt") != "1" {
+				t.Fatal("no nodeprop.dispatch span for the first attempt under the submit span")
+			}
+			if github == nil || github.Parent().SpanID() != dispatch.SpanContext().SpanID() {
+				t.Fatal("the API request's span is not a child of the dispatch span")
+			}
+			if got := spanAttr(github, "http.response.status_code"); got != tt.github {
+				t.Errorf("github span status code = %s, want %s", got, tt.github)
+			}
+		})
+	}
+}
+
+func TestFanOutSpan(t *testing.T) {
+	gh := nodeproptest.NewServer()
+	defer gh.Close()
+	gh.AddWorkflow("Cdaprod/api", "bump.yml")
+	spans := tracetest.NewInMemoryExporter()
+	c := newCorrelator(t, gh)
+	c.TracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSyncer(spans))
+
+	c.FanOut(context.Background(), "bump", "Cdaprod/lib", []flow.DispatchRequest{
+		{Repo: "Cdaprod/api", Workflow: "bump.yml", Ref: "main"},
+		{Repo: "Cdaprod/missing", Workflow: "bump.yml", Ref: "main"},
+	}, 2)
+
+	var fanOut sdktrace.ReadOnlySpan
+	var children int
+	all := spans.GetSpans().Snapshots()
+	for _, s := range all {
+		if s.Name() == "nodeprop.fanout" {
+			fanOut = s
+		}
+	}
+	if fanOut == nil {
+		t.Fatal("no nodeprop.fanout span")
+	}
+	for _, s := range all {
+		if s.Name() == "nodeprop.submit" && s.Parent().SpanID() == fanOut.SpanContext().SpanID() {
+			children++
+		}
+	}
+	if children != 2 {
+		t.Errorf("fan-out span has %d submit children, want 2", children)
+	}
+	if fanOut.Status().Code != codes.Error || spanAttr(fanOut, "nodeprop.summary") != "1 dispatched, 0 held, 1 failed" {
+		t.Errorf("fan-out span status %v, attributes %v", fanOut.Status(), fanOut.Attributes())
+	}
+	if got := spanAttr(fanOut, "nodeprop.dispatches"); got != attribute.IntValue(2).Emit() {
+		t.Errorf("fan-out span dispatches = %s", got)
+	}
+}
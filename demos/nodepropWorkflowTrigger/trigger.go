@@ -1,75 +1,150 @@
 package flow
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 )
 
-// WorkflowTrigger defines the interface for triggering workflows.
-type WorkflowTrigger interface {
-	TriggerWorkflow(target string, params map[string]string, authToken string) error
+// Trigger starts work on target, typically an owner/name repository, with
+// params, authenticating with authToken. TriggerManager runs its actions
+// and workflows through it; GitHubWorkflowDispatch, GitHubRepoDispatch,
+// and WebhookTrigger implement it.
+type Trigger interface {
+	Trigger(target string, params map[string]string, authToken string) error
 }
 
-// TriggerWorkflowSystem provides a generic way to execute a workflow through a WorkflowTrigger.
-func TriggerWorkflowSystem(trigger WorkflowTrigger, target string, params map[string]string, token string) error {
-	return trigger.TriggerWorkflow(target, params, token)
+// ContextTrigger is a Trigger whose deliveries can be cancelled.
+type ContextTrigger interface {
+	Trigger
+	TriggerContext(ctx context.Context, target string, params map[string]string, authToken string) error
 }
 
-// GitHubWorkflowTrigger implements the WorkflowTrigger interface for GitHub Actions.
-type GitHubWorkflowTrigger struct{}
+// GitHubWorkflowDispatch starts WorkflowFile of the target repository on
+// Ref with a workflow_dispatch event, passing params as its inputs.
+type GitHubWorkflowDispatch struct {
+	WorkflowFile string
+	// Ref is the branch or tag to run the workflow on.
+	Ref string
+	// BaseURL is the REST endpoint; empty means DefaultAPIBaseURL.
+	BaseURL    string
+	HTTPClient *http.Client
+	// Retry is applied to dispatches that fail with transient errors. The
+	// zero value makes one attempt.
+	Retry RetryPolicy
+	// Logger receives each dispatch's status; nil means slog.Default().
+	Logger Logger
+}
 
-// TriggerWorkflow triggers a GitHub Actions workflow in the specified repository.
-func (g *GitHubWorkflowTrigger) TriggerWorkflow(target string, params map[string]string, authToken string) error {
-	// Construct the URL for the GitHub API
-	url := fmt.Sprintf("https://api.github.com/repos/%s/actions/workflows/%s/dispatches", target, params["workflow_id"])
+// Trigger dispatches the workflow on target.
+func (w *GitHubWorkflowDispatch) Trigger(target string, params map[string]string, authToken string) error {
+	return w.TriggerContext(context.Background(), target, params, authToken)
+}
+
+// TriggerContext is Trigger, giving up when ctx is done. Failures are a
+// *DispatchError; inputs GitHub would refuse are also a *ParamError, and
+// nothing is sent.
+func (w *GitHubWorkflowDispatch) TriggerContext(ctx context.Context, target string, params map[string]string, authToken string) error {
+	c := dispatchClient(w.BaseURL, w.HTTPClient, authToken, w.Logger)
+	err := w.Retry.run(ctx, w.Logger, func() error {
+		return c.DispatchWorkflow(ctx, target, w.WorkflowFile, w.Ref, params)
+	})
+	LoggerOr(w.Logger).Debug("workflow dispatch", "repo", target, "workflow", w.WorkflowFile, "ref", w.Ref, "error", err)
+	return dispatchError(ProviderGitHubWorkflow, target, w.WorkflowFile, err)
+}
 
-	// Prepare the payload for the API request
-	payload := map[string]interface{}{
-		"ref":    params["ref"],
-		"inputs": params["inputs"],
+// GitHubRepoDispatch sends a repository_dispatch event of EventType to the
+// target repository, passing params as its client_payload, which starts
+// every workflow of the repository listening for that event type.
+type GitHubRepoDispatch struct {
+	EventType string
+	// BaseURL is the REST endpoint; empty means DefaultAPIBaseURL.
+	BaseURL    string
+	HTTPClient *http.Client
+	// Retry is applied to dispatches that fail with transient errors. The
+	// zero value makes one attempt.
+	Retry RetryPolicy
+	// Logger receives each dispatch's status; nil means slog.Default().
+	Logger Logger
+}
+
+// Trigger sends the event to target.
+func (r *GitHubRepoDispatch) Trigger(target string, params map[string]string, authToken string) error {
+	return r.TriggerContext(context.Background(), target, params, authToken)
+}
+
+// TriggerContext is Trigger, giving up when ctx is done. Failures are a
+// *DispatchError; params JSON cannot carry are also a *ParamError, and
+// nothing is sent.
+func (r *GitHubRepoDispatch) TriggerContext(ctx context.Context, target string, params map[string]string, authToken string) error {
+	if err := ValidateParams(params); err != nil {
+		return dispatchError(ProviderGitHubRepoDispatch, target, r.EventType, err)
 	}
-	body, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("failed to marshal payload: %v", err)
+	var payload interface{}
+	if len(params) > 0 {
+		payload = params
 	}
+	c := dispatchClient(r.BaseURL, r.HTTPClient, authToken, r.Logger)
+	err := r.Retry.run(ctx, r.Logger, func() error {
+		return c.RepositoryDispatch(ctx, target, r.EventType, payload)
+	})
+	LoggerOr(r.Logger).Debug("repository dispatch", "repo", target, "event_type", r.EventType, "error", err)
+	return dispatchError(ProviderGitHubRepoDispatch, target, r.EventType, err)
+}
 
-	// Build the HTTP request
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
+// dispatchClient returns a client sending one dispatch with authToken.
+func dispatchClient(baseURL string, hc *http.Client, authToken string, log Logger) *GitHubClient {
+	c := &GitHubClient{BaseURL: baseURL, Token: authToken, HTTPClient: hc, Logger: log}
+	if c.BaseURL == "" {
+		c.BaseURL = DefaultAPIBaseURL
 	}
-	req.Header.Set("Authorization", "Bearer "+authToken)
-	req.Header.Set("Content-Type", "application/json")
+	return c
+}
 
-	// Send the request
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to trigger workflow: %v", err)
-	}
-	defer resp.Body.Close()
+// WorkflowTrigger is the former name of Trigger.
+//
+// Deprecated: Use Trigger. The WorkflowTrigger struct is now
+// GitHubWorkflowDispatch, with the same fields.
+type WorkflowTrigger = Trigger
 
-	// Check the response status
-	if resp.StatusCode != 204 {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
+// ActionTrigger is the former name of GitHubRepoDispatch, which sends the
+// event to the target rather than to ActionName.
+//
+// Deprecated: Use GitHubRepoDispatch.
+type ActionTrigger = GitHubRepoDispatch
 
-	return nil
+// TriggerWorkflowSystem runs trigger on target.
+//
+// Deprecated: Call trigger.Trigger.
+func TriggerWorkflowSystem(trigger Trigger, target string, params map[string]string, token string) error {
+	return trigger.Trigger(target, params, token)
 }
 
-// triggerNodeProp is a concrete implementation for triggering the NodeProp workflow on GitHub.
-func triggerNodeProp(repo string, token string) error {
-	// Create an instance of the GitHubWorkflowTrigger
-	trigger := &GitHubWorkflowTrigger{}
+// GitHubWorkflowTrigger dispatches the workflow named by the workflow_id
+// param on the ref param, with the inputs param, a JSON object of strings,
+// as its inputs.
+//
+// Deprecated: Use GitHubWorkflowDispatch, which takes the workflow and ref
+// as fields and params as the inputs.
+type GitHubWorkflowTrigger struct {
+	// Logger receives each dispatch's status; nil means slog.Default().
+	Logger Logger
+}
 
-	// Define the parameters for the workflow
-	params := map[string]string{
-		"workflow_id": "nodeprop-action.yml", // The workflow ID or filename
-		"ref":         "main",               // Branch or tag to trigger on
-		"inputs":      "{}",                 // Workflow-specific inputs in JSON format
-	}
+// Trigger is TriggerWorkflow.
+func (g *GitHubWorkflowTrigger) Trigger(target string, params map[string]string, authToken string) error {
+	return g.TriggerWorkflow(target, params, authToken)
+}
 
-	// Trigger the workflow
-	return trigger.TriggerWorkflow(repo, params, token)
-}
\ No newline at end of file
+// TriggerWorkflow dispatches the workflow params describe on target.
+func (g *GitHubWorkflowTrigger) TriggerWorkflow(target string, params map[string]string, authToken string) error {
+	var inputs map[string]string
+	if s := params["inputs"]; s != "" {
+		if err := json.Unmarshal([]byte(s), &inputs); err != nil {
+			return fmt.Errorf("invalid inputs param: %w", err)
+		}
+	}
+	w := &GitHubWorkflowDispatch{WorkflowFile: params["workflow_id"], Ref: params["ref"], Logger: g.Logger}
+	return w.Trigger(target, inputs, authToken)
+}
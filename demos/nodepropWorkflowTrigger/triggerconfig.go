@@ -0,0 +1,140 @@
+package flow
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Kinds of TriggerConfig.
+const (
+	TriggerTypeAction   = "action"
+	TriggerTypeWorkflow = "workflow"
+)
+
+// ProviderConfig is what a trigger is built from: a provider kind and its
+// settings, as NewProvider takes them.
+type ProviderConfig struct {
+	Provider string            `yaml:"provider" json:"provider"`
+	Settings map[string]string `yaml:"settings,omitempty" json:"settings,omitempty"`
+}
+
+// Build returns the trigger c describes, configured by opts.
+func (c ProviderConfig) Build(opts ...Option) (Trigger, error) {
+	return NewProvider(c.Provider, c.Settings, opts...)
+}
+
+// ConfigurableTrigger is a Trigger that can report the ProviderConfig it
+// is built from, so it can be saved and rebuilt. The package's triggers
+// implement it, as do those loaded by the plugin package.
+type ConfigurableTrigger interface {
+	Trigger
+	ProviderConfig() ProviderConfig
+}
+
+// TriggerConfig is a trigger registered with a TriggerManager, in the form
+// kept in the registry file:
+//
+//	triggers:
+//	  - name: deploy
+//	    type: workflow
+//	    provider: github_workflow
+//	    settings: {workflow: deploy.yml, ref: main}
+type TriggerConfig struct {
+	Name string `yaml:"name" json:"name"`
+	// Type is TriggerTypeAction or TriggerTypeWorkflow.
+	Type           string `yaml:"type" json:"type"`
+	ProviderConfig `yaml:",inline"`
+}
+
+// validate checks that c names a trigger of a known type.
+func (c TriggerConfig) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("trigger has no name")
+	}
+	if c.Type != TriggerTypeAction && c.Type != TriggerTypeWorkflow {
+		return fmt.Errorf("trigger %s: unknown type %q", c.Name, c.Type)
+	}
+	if c.Provider == "" {
+		return fmt.Errorf("trigger %s: provider is required", c.Name)
+	}
+	return nil
+}
+
+// Configs returns the registrations of tm, sorted by type and name, for
+// saving with RepositoryRegistry.SetTriggers. It fails if a trigger is not
+// a ConfigurableTrigger.
+func (tm *TriggerManager) Configs() ([]TriggerConfig, error) {
+	s := tm.snapshot()
+	cfgs := make([]TriggerConfig, 0, len(s.actions)+len(s.workflows))
+	for typ, m := range map[string]map[string]Trigger{TriggerTypeAction: s.actions, TriggerTypeWorkflow: s.workflows} {
+		for name, t := range m {
+			ct, ok := t.(ConfigurableTrigger)
+			if !ok {
+				return nil, fmt.Errorf("%s %s: %s cannot be saved", typ, name, providerOf(t))
+			}
+			cfgs = append(cfgs, TriggerConfig{Name: name, Type: typ, ProviderConfig: ct.ProviderConfig()})
+		}
+	}
+	sort.Slice(cfgs, func(i, j int) bool {
+		if cfgs[i].Type != cfgs[j].Type {
+			return cfgs[i].Type < cfgs[j].Type
+		}
+		return cfgs[i].Name < cfgs[j].Name
+	})
+	return cfgs, nil
+}
+
+// Configure builds each of cfgs with NewProvider and registers it with tm,
+// replacing a trigger of the same type and name. Nothing is registered if
+// any of them fails to build.
+func (tm *TriggerManager) Configure(cfgs []TriggerConfig, opts ...Option) error {
+	built := make([]Trigger, len(cfgs))
+	for i, c := range cfgs {
+		if err := c.validate(); err != nil {
+			return err
+		}
+		t, err := c.Build(opts...)
+		if err != nil {
+			return fmt.Errorf("trigger %s: %w", c.Name, err)
+		}
+		built[i] = t
+	}
+	tm.update(func(s *triggerSet) {
+		for i, c := range cfgs {
+			if c.Type == TriggerTypeAction {
+				s.actions[c.Name] = built[i]
+			} else {
+				s.workflows[c.Name] = built[i]
+			}
+		}
+	})
+	return nil
+}
+
+// ProviderConfig returns the github_workflow config of w.
+func (w *GitHubWorkflowDispatch) ProviderConfig() ProviderConfig {
+	return ProviderConfig{Provider: ProviderGitHubWorkflow, Settings: settings("workflow", w.WorkflowFile, "ref", w.Ref, "base_url", w.BaseURL)}
+}
+
+// ProviderConfig returns the github_repository_dispatch config of r.
+func (r *GitHubRepoDispatch) ProviderConfig() ProviderConfig {
+	return ProviderConfig{Provider: ProviderGitHubRepoDispatch, Settings: settings("event_type", r.EventType, "base_url", r.BaseURL)}
+}
+
+// ProviderConfig returns the webhook config of w. Its secret is included
+// only if w was built by NewProvider from a secret token source; a Secret
+// set directly is a value, which is never written out.
+func (w *WebhookTrigger) ProviderConfig() ProviderConfig {
+	return ProviderConfig{Provider: ProviderWebhook, Settings: settings("url", w.URL, "secret", w.secretSource, "signature_header", w.SignatureHeader)}
+}
+
+// settings returns the non-empty values of kv, a list of keys and values.
+func settings(kv ...string) map[string]string {
+	m := make(map[string]string, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i+1] != "" {
+			m[kv[i]] = kv[i+1]
+		}
+	}
+	return m
+}
@@ -0,0 +1,159 @@
+package flow
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// plainTrigger is a Trigger that cannot report its config.
+type plainTrigger struct{}
+
+func (plainTrigger) Trigger(target string, params map[string]string, authToken string) error {
+	return nil
+}
+
+func TestTriggerConfigRoundTrip(t *testing.T) {
+	tm := NewTriggerManager()
+	tm.RegisterWorkflow("deploy", NewGitHubWorkflowDispatch("deploy.yml", WithRef("main"), WithBaseURL("https://ghe.example.com/api/v3")))
+	tm.RegisterAction("ping", NewGitHubRepoDispatch("ping"))
+	hook, err := NewProvider(ProviderWebhook, map[string]string{"url": "https://hooks.example.com", "secret": "env:NODEPROP_HOOK_SECRET"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tm.RegisterAction("alert", hook)
+	// A secret set directly is a value, which is never written out.
+	signed := NewWebhookTrigger("https://hooks.example.com/signed")
+	signed.Secret = StaticToken("s3cret")
+	tm.RegisterAction("signed", signed)
+
+	cfgs, err := tm.Configs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []TriggerConfig{
+		{Name: "alert", Type: TriggerTypeAction, ProviderConfig: ProviderConfig{Provider: ProviderWebhook, Settings: map[string]string{"url": "https://hooks.example.com", "secret": "env:NODEPROP_HOOK_SECRET"}}},
+		{Name: "ping", Type: TriggerTypeAction, ProviderConfig: ProviderConfig{Provider: ProviderGitHubRepoDispatch, Settings: map[string]string{"event_type": "ping"}}},
+		{Name: "signed", Type: TriggerTypeAction, ProviderConfig: ProviderConfig{Provider: ProviderWebhook, Settings: map[string]string{"url": "https://hooks.example.com/signed"}}},
+		{Name: "deploy", Type: TriggerTypeWorkflow, ProviderConfig: ProviderConfig{Provider: ProviderGitHubWorkflow, Settings: map[string]string{"workflow": "deploy.yml", "ref": "main", "base_url": "https://ghe.example.com/api/v3"}}},
+	}
+	if !reflect.DeepEqual(cfgs, want) {
+		t.Fatalf("Configs() = %+v, want %+v", cfgs, want)
+	}
+
+	path := filepath.Join(t.TempDir(), "registry.yml")
+	reg := NewRepositoryRegistry()
+	if err := reg.SetTriggers(cfgs); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "s3cret") {
+		t.Errorf("saved registry has the secret:\n%s", data)
+	}
+	loaded, err := LoadRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rebuilt := NewTriggerManager()
+	if err := rebuilt.Configure(loaded.Triggers()); err != nil {
+		t.Fatal(err)
+	}
+	again, err := rebuilt.Configs()
+	if err != nil || !reflect.DeepEqual(again, want) {
+		t.Errorf("Configs() after Configure = %+v, %v; want %+v", again, err, want)
+	}
+	if w, ok := rebuilt.Workflow("deploy"); !ok || w.(*GitHubWorkflowDispatch).Ref != "main" {
+		t.Errorf("rebuilt deploy = %+v", w)
+	}
+}
+
+func TestConfigsNotConfigurable(t *testing.T) {
+	tm := NewTriggerManager()
+	tm.RegisterWorkflow("custom", plainTrigger{})
+	if _, err := tm.Configs(); err == nil || !strings.Contains(err.Error(), "workflow custom: flow.plainTrigger cannot be saved") {
+		t.Errorf("Configs() error = %v", err)
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	valid := TriggerConfig{Name: "deploy", Type: TriggerTypeWorkflow, ProviderConfig: ProviderConfig{Provider: ProviderGitHubWorkflow, Settings: map[string]string{"workflow": "deploy.yml"}}}
+	tests := []struct {
+		name    string
+		cfg     TriggerConfig
+		wantErr string
+	}{
+		{name: "no name", cfg: TriggerConfig{Type: TriggerTypeWorkflow, ProviderConfig: valid.ProviderConfig}, wantErr: "trigger has no name"},
+		{name: "unknown type", cfg: TriggerConfig{Name: "x", Type: "job", ProviderConfig: valid.ProviderConfig}, wantErr: `unknown type "job"`},
+		{name: "no provider", cfg: TriggerConfig{Name: "x", Type: TriggerTypeAction}, wantErr: "provider is required"},
+		{name: "unknown provider", cfg: TriggerConfig{Name: "x", Type: TriggerTypeAction, ProviderConfig: ProviderConfig{Provider: "jenkins"}}, wantErr: `trigger x: unknown provider "jenkins"`},
+		{name: "bad settings", cfg: TriggerConfig{Name: "x", Type: TriggerTypeAction, ProviderConfig: ProviderConfig{Provider: ProviderWebhook}}, wantErr: "url is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm := NewTriggerManager()
+			old := NewGitHubWorkflowDispatch("old.yml")
+			tm.RegisterWorkflow("deploy", old)
+			// The valid config is not registered either.
+			err := tm.Configure([]TriggerConfig{valid, tt.cfg})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Configure() error = %v, want one containing %q", err, tt.wantErr)
+			}
+			if w, _ := tm.Workflow("deploy"); w != Trigger(old) {
+				t.Errorf("Configure() replaced deploy with %+v despite failing", w)
+			}
+		})
+	}
+
+	tm := NewTriggerManager()
+	tm.RegisterWorkflow("deploy", NewGitHubWorkflowDispatch("old.yml"))
+	if err := tm.Configure([]TriggerConfig{valid}, WithRef("main")); err != nil {
+		t.Fatal(err)
+	}
+	if w, _ := tm.Workflow("deploy"); w.(*GitHubWorkflowDispatch).WorkflowFile != "deploy.yml" || w.(*GitHubWorkflowDispatch).Ref != "main" {
+		t.Errorf("Configure() left deploy as %+v, want it replaced and given the options", w)
+	}
+}
+
+func TestSetTriggers(t *testing.T) {
+	pc := ProviderConfig{Provider: ProviderGitHubRepoDispatch, Settings: map[string]string{"event_type": "ping"}}
+	tests := []struct {
+		name    string
+		cfgs    []TriggerConfig
+		wantErr string
+	}{
+		{name: "none"},
+		{name: "same name, other type", cfgs: []TriggerConfig{{Name: "ping", Type: TriggerTypeAction, ProviderConfig: pc}, {Name: "ping", Type: TriggerTypeWorkflow, ProviderConfig: pc}}},
+		{name: "twice", cfgs: []TriggerConfig{{Name: "ping", Type: TriggerTypeAction, ProviderConfig: pc}, {Name: "ping", Type: TriggerTypeAction, ProviderConfig: pc}}, wantErr: "action ping: configured twice"},
+		{name: "invalid", cfgs: []TriggerConfig{{Name: "ping", Type: "job", ProviderConfig: pc}}, wantErr: "unknown type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRepositoryRegistry()
+			err := r.SetTriggers(tt.cfgs)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("SetTriggers() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				if len(r.Triggers()) != 0 {
+					t.Errorf("Triggers() = %v after a failed SetTriggers", r.Triggers())
+				}
+				return
+			}
+			if err != nil || len(r.Triggers()) != len(tt.cfgs) {
+				t.Errorf("SetTriggers() = %v, Triggers() = %v", err, r.Triggers())
+			}
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "registry.yml")
+	os.WriteFile(path, []byte("repos: []\ntriggers:\n  - name: ping\n    type: job\n    provider: webhook\n"), 0o644)
+	if _, err := LoadRegistry(path); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("LoadRegistry() of an invalid trigger error = %v, want one naming the file", err)
+	}
+}
@@ -0,0 +1,347 @@
+// Package vault reads GitHub tokens and other secrets, such as GitHub App
+// private keys, from HashiCorp Vault, so that they need not be kept on
+// disk. It speaks Vault's HTTP API directly.
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// DefaultTTL is how long a secret without a lease, such as a KV entry, is
+// cached before it is read again.
+const DefaultTTL = 5 * time.Minute
+
+// DefaultKubernetesTokenPath is where Kubernetes mounts a pod's service
+// account token.
+const DefaultKubernetesTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// Config says where Vault is and how to log in: with Token if set, else
+// with AppRole if RoleID is set, else with Kubernetes auth if
+// KubernetesRole is set.
+type Config struct {
+	// Addr is Vault's address, e.g. https://vault.example.com:8200.
+	Addr string
+	// Namespace, if set, is sent with every request (Vault Enterprise).
+	Namespace string
+	Token     string
+	// RoleID and SecretID log in at AppRoleMount, by default approle.
+	RoleID       string
+	SecretID     string
+	AppRoleMount string
+	// KubernetesRole logs in at KubernetesMount, by default kubernetes,
+	// with the service account token at KubernetesTokenPath, by default
+	// DefaultKubernetesTokenPath.
+	KubernetesRole      string
+	KubernetesMount     string
+	KubernetesTokenPath string
+	// TLS, if set, configures the connection to Vault, e.g. a private CA
+	// or a client certificate for Vault's cert auth or an mTLS proxy. It
+	// is ignored if HTTPClient is set.
+	TLS        flow.TLSConfig
+	HTTPClient *http.Client
+}
+
+// ConfigFromEnv reads VAULT_ADDR, VAULT_NAMESPACE, VAULT_TOKEN,
+// VAULT_ROLE_ID, VAULT_SECRET_ID, VAULT_KUBERNETES_ROLE, and VAULT_CACERT,
+// VAULT_CLIENT_CERT, VAULT_CLIENT_KEY, and VAULT_TLS_SERVER_NAME.
+func ConfigFromEnv() Config {
+	return Config{
+		Addr:           os.Getenv("VAULT_ADDR"),
+		Namespace:      os.Getenv("VAULT_NAMESPACE"),
+		Token:          os.Getenv("VAULT_TOKEN"),
+		RoleID:         os.Getenv("VAULT_ROLE_ID"),
+		SecretID:       os.Getenv("VAULT_SECRET_ID"),
+		KubernetesRole: os.Getenv("VAULT_KUBERNETES_ROLE"),
+		TLS: flow.TLSConfig{
+			CA:         os.Getenv("VAULT_CACERT"),
+			Cert:       os.Getenv("VAULT_CLIENT_CERT"),
+			Key:        os.Getenv("VAULT_CLIENT_KEY"),
+			ServerName: os.Getenv("VAULT_TLS_SERVER_NAME"),
+		},
+	}
+}
+
+// Client is a Vault client. A token it logs in for is cached and replaced
+// when two thirds of its TTL have passed or Vault refuses it.
+type Client struct {
+	cfg Config
+
+	mu        sync.Mutex
+	token     string
+	refreshAt time.Time
+}
+
+// New creates a Client for cfg.
+func New(cfg Config) (*Client, error) {
+	switch {
+	case cfg.Addr == "":
+		return nil, errors.New("vault: no address; set VAULT_ADDR")
+	case cfg.Token == "" && cfg.RoleID == "" && cfg.KubernetesRole == "":
+		return nil, errors.New("vault: no credentials; set VAULT_TOKEN, VAULT_ROLE_ID and VAULT_SECRET_ID, or VAULT_KUBERNETES_ROLE")
+	}
+	if cfg.HTTPClient == nil {
+		hc, err := cfg.TLS.HTTPClient()
+		if err != nil {
+			return nil, fmt.Errorf("vault: %w", err)
+		}
+		cfg.HTTPClient = hc
+	}
+	return &Client{cfg: cfg}, nil
+}
+
+// response is the envelope of Vault's responses.
+type response struct {
+	LeaseID       string                 `json:"lease_id"`
+	LeaseDuration int                    `json:"lease_duration"`
+	Renewable     bool                   `json:"renewable"`
+	Data          map[string]interface{} `json:"data"`
+	Auth          *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+	} `json:"auth"`
+	Errors []string `json:"errors"`
+}
+
+// errForbidden is a 403, which means the token expired or was revoked.
+var errForbidden = errors.New("permission denied")
+
+// do sends a request to /v1/path with token and decodes the response.
+func (c *Client) do(ctx context.Context, method, path, token string, in interface{}) (*response, error) {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.cfg.Addr, "/")+"/v1/"+strings.TrimPrefix(path, "/"), body)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if c.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.cfg.Namespace)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	hc := c.cfg.HTTPClient
+	if hc == nil {
+		hc = flow.SharedHTTPClient()
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var out response
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&out); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("unexpected response: %d", resp.StatusCode)
+	}
+	switch {
+	case resp.StatusCode == http.StatusForbidden:
+		return nil, errForbidden
+	case resp.StatusCode/100 != 2:
+		return nil, fmt.Errorf("unexpected status code: %d: %s", resp.StatusCode, strings.Join(out.Errors, "; "))
+	}
+	return &out, nil
+}
+
+// authToken returns a Vault token, logging in if the cached one is due
+// for replacement.
+func (c *Client) authToken(ctx context.Context) (string, error) {
+	if c.cfg.Token != "" {
+		return c.cfg.Token, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Now().Before(c.refreshAt) {
+		return c.token, nil
+	}
+	mount, login := c.cfg.AppRoleMount, map[string]string{"role_id": c.cfg.RoleID, "secret_id": c.cfg.SecretID}
+	if mount == "" {
+		mount = "approle"
+	}
+	if c.cfg.RoleID == "" {
+		path := c.cfg.KubernetesTokenPath
+		if path == "" {
+			path = DefaultKubernetesTokenPath
+		}
+		jwt, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("vault: failed to read service account token: %w", err)
+		}
+		if mount = c.cfg.KubernetesMount; mount == "" {
+			mount = "kubernetes"
+		}
+		login = map[string]string{"role": c.cfg.KubernetesRole, "jwt": strings.TrimSpace(string(jwt))}
+	}
+	resp, err := c.do(ctx, "POST", "auth/"+mount+"/login", "", login)
+	if err == nil && (resp.Auth == nil || resp.Auth.ClientToken == "") {
+		err = errors.New("no token in response")
+	}
+	if err != nil {
+		return "", fmt.Errorf("vault: failed to log in with %s: %w", mount, err)
+	}
+	flow.Secrets.Replace(c.token, resp.Auth.ClientToken)
+	c.token, c.refreshAt = resp.Auth.ClientToken, refreshTime(resp.Auth.LeaseDuration, DefaultTTL)
+	return c.token, nil
+}
+
+// forget drops a logged-in token Vault refused.
+func (c *Client) forget(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token == token {
+		flow.Secrets.Remove(token)
+		c.token = ""
+	}
+}
+
+// call is do with the client's token, logging in again once if Vault
+// refuses a token it logged in for.
+func (c *Client) call(ctx context.Context, method, path string, in interface{}) (*response, error) {
+	token, err := c.authToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(ctx, method, path, token, in)
+	if errors.Is(err, errForbidden) && c.cfg.Token == "" {
+		c.forget(token)
+		if token, err = c.authToken(ctx); err != nil {
+			return nil, err
+		}
+		resp, err = c.do(ctx, method, path, token, in)
+	}
+	return resp, err
+}
+
+// refreshTime is when a value leased for seconds, or cached for fallback
+// without a lease, should be replaced: after two thirds of its lifetime.
+func refreshTime(seconds int, fallback time.Duration) time.Time {
+	ttl := time.Duration(seconds) * time.Second
+	if ttl <= 0 {
+		ttl = fallback
+	}
+	return time.Now().Add(ttl * 2 / 3)
+}
+
+// Secret is a flow.TokenProvider for one field of a Vault secret. It works
+// with KV version 1 and 2 and with engines that lease dynamic secrets,
+// such as a GitHub token engine: a renewable lease is renewed when two
+// thirds of it have passed, and the secret is read again once it cannot be.
+type Secret struct {
+	Client *Client
+	// Path is the API path after /v1/, e.g. secret/data/nodeprop for KV
+	// version 2 or github/token/nodeprop for a dynamic token.
+	Path string
+	// Field is the key of the value in the secret's data; empty means token.
+	Field string
+	// TTL overrides DefaultTTL for secrets without a lease.
+	TTL time.Duration
+
+	mu        sync.Mutex
+	value     string
+	leaseID   string
+	lease     int
+	renewable bool
+	refreshAt time.Time
+}
+
+// Token returns the secret's value, reading or renewing it as needed.
+func (s *Secret) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.value != "" && time.Now().Before(s.refreshAt) {
+		return s.value, nil
+	}
+	if s.value != "" && s.renewable && s.renew(ctx) {
+		return s.value, nil
+	}
+	resp, err := s.Client.call(ctx, "GET", s.Path, nil)
+	if err != nil {
+		return "", fmt.Errorf("vault: failed to read %s: %w", s.Path, err)
+	}
+	value, err := s.field(resp.Data)
+	if err != nil {
+		return "", err
+	}
+	ttl := s.TTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	s.value, s.leaseID, s.lease, s.renewable = value, resp.LeaseID, resp.LeaseDuration, resp.Renewable && resp.LeaseID != ""
+	s.refreshAt = refreshTime(resp.LeaseDuration, ttl)
+	return s.value, nil
+}
+
+// renew extends the secret's lease by its original duration. It reports
+// false if Vault refused or granted less than a third of it, as it does
+// when the lease nears its maximum TTL, so the secret is read afresh.
+func (s *Secret) renew(ctx context.Context) bool {
+	resp, err := s.Client.call(ctx, "PUT", "sys/leases/renew", map[string]interface{}{"lease_id": s.leaseID, "increment": s.lease})
+	if err != nil || resp.LeaseDuration*3 < s.lease {
+		return false
+	}
+	s.refreshAt = refreshTime(resp.LeaseDuration, 0)
+	return true
+}
+
+// field extracts s.Field from data, looking inside the nested data of a
+// KV version 2 secret.
+func (s *Secret) field(data map[string]interface{}) (string, error) {
+	name := s.Field
+	if name == "" {
+		name = "token"
+	}
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, direct := data[name]; !direct {
+			data = inner
+		}
+	}
+	v, ok := data[name].(string)
+	if !ok || v == "" {
+		return "", fmt.Errorf("vault: %s has no field %q", s.Path, name)
+	}
+	return v, nil
+}
+
+var (
+	defaultOnce   sync.Once
+	defaultClient *Client
+	defaultErr    error
+)
+
+// ParseSource builds a Secret from PATH or PATH#FIELD with a client
+// configured by ConfigFromEnv, which every source shares.
+func ParseSource(arg string) (flow.TokenProvider, error) {
+	path, field, _ := strings.Cut(arg, "#")
+	if path == "" {
+		return nil, errors.New("vault: missing secret path")
+	}
+	defaultOnce.Do(func() { defaultClient, defaultErr = New(ConfigFromEnv()) })
+	if defaultErr != nil {
+		return nil, defaultErr
+	}
+	return &Secret{Client: defaultClient, Path: path, Field: field}, nil
+}
+
+// Register adds the vault:PATH#FIELD token source to flow.ParseTokenSource.
+func Register() {
+	flow.RegisterTokenSource("vault", ParseSource)
+}
@@ -0,0 +1,260 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeVault serves logins, one secret, and lease renewals.
+type fakeVault struct {
+	*httptest.Server
+
+	mu sync.Mutex
+	// secret is the response to reading the secret.
+	secret map[string]interface{}
+	// renewLease is the duration granted by a renewal.
+	renewLease int
+	// valid holds the tokens Vault accepts.
+	valid    map[string]bool
+	logins   []map[string]string
+	reads    int
+	renews   int
+	lastNS   string
+	loginSeq int
+}
+
+func newFakeVault(t *testing.T) *fakeVault {
+	f := &fakeVault{valid: map[string]bool{"root-token": true}}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeVault) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lastNS = r.Header.Get("X-Vault-Namespace")
+	if strings.HasSuffix(r.URL.Path, "/login") {
+		var login map[string]string
+		json.NewDecoder(r.Body).Decode(&login)
+		f.logins = append(f.logins, login)
+		if login["secret_id"] == "wrong" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"invalid secret id"}})
+			return
+		}
+		f.loginSeq++
+		token := "login-token-" + string(rune('0'+f.loginSeq))
+		f.valid[token] = true
+		json.NewEncoder(w).Encode(map[string]interface{}{"auth": map[string]interface{}{"client_token": token, "lease_duration": 3600}})
+		return
+	}
+	if !f.valid[r.Header.Get("X-Vault-Token")] {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"permission denied"}})
+		return
+	}
+	switch r.URL.Path {
+	case "/v1/sys/leases/renew":
+		f.renews++
+		json.NewEncoder(w).Encode(map[string]interface{}{"lease_id": "lease-1", "lease_duration": f.renewLease, "renewable": true})
+	case "/v1/secret/data/nodeprop":
+		f.reads++
+		json.NewEncoder(w).Encode(f.secret)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{}})
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{name: "token", cfg: Config{Addr: "http://vault", Token: "t"}},
+		{name: "approle", cfg: Config{Addr: "http://vault", RoleID: "r", SecretID: "s"}},
+		{name: "kubernetes", cfg: Config{Addr: "http://vault", KubernetesRole: "nodeprop"}},
+		{name: "no address", cfg: Config{Token: "t"}, wantErr: "VAULT_ADDR"},
+		{name: "no credentials", cfg: Config{Addr: "http://vault"}, wantErr: "no credentials"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.cfg)
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("New() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSecretField(t *testing.T) {
+	tests := []struct {
+		name  string
+		field string
+		data  map[string]interface{}
+		want  string
+	}{
+		{name: "kv1", data: map[string]interface{}{"token": "v1"}, want: "v1"},
+		{name: "kv2", data: map[string]interface{}{"data": map[string]interface{}{"token": "v2"}, "metadata": map[string]interface{}{}}, want: "v2"},
+		{name: "named field", field: "key", data: map[string]interface{}{"data": map[string]interface{}{"key": "pem"}}, want: "pem"},
+		{name: "field beside data", field: "data", data: map[string]interface{}{"data": "direct"}, want: "direct"},
+		{name: "missing", data: map[string]interface{}{"data": map[string]interface{}{"other": "x"}}},
+		{name: "empty", data: map[string]interface{}{"token": ""}},
+		{name: "not a string", data: map[string]interface{}{"token": 42.0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Secret{Path: "secret/data/nodeprop", Field: tt.field}
+			got, err := s.field(tt.data)
+			if got != tt.want || (err != nil) != (tt.want == "") {
+				t.Errorf("field() = %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSecretToken(t *testing.T) {
+	jwt := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(jwt, []byte("sa-jwt\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		cfg        Config
+		wantLogin  map[string]string
+		wantErr    string
+		wantLogins int
+	}{
+		{name: "static token", cfg: Config{Token: "root-token", Namespace: "team"}},
+		{name: "approle", cfg: Config{RoleID: "role", SecretID: "secret"}, wantLogin: map[string]string{"role_id": "role", "secret_id": "secret"}, wantLogins: 1},
+		{name: "approle refused", cfg: Config{RoleID: "role", SecretID: "wrong"}, wantErr: "failed to log in with approle: unexpected status code: 400: invalid secret id", wantLogins: 1},
+		{name: "kubernetes", cfg: Config{KubernetesRole: "nodeprop", KubernetesTokenPath: jwt}, wantLogin: map[string]string{"role": "nodeprop", "jwt": "sa-jwt"}, wantLogins: 1},
+		{name: "kubernetes without token", cfg: Config{KubernetesRole: "nodeprop", KubernetesTokenPath: jwt + ".missing"}, wantErr: "service account token"},
+		{name: "unknown static token", cfg: Config{Token: "other"}, wantErr: "permission denied"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeVault(t)
+			f.secret = map[string]interface{}{"data": map[string]interface{}{"data": map[string]interface{}{"token": "ghp-from-vault"}}}
+			tt.cfg.Addr = f.URL + "/"
+			c, err := New(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := &Secret{Client: c, Path: "secret/data/nodeprop"}
+			for i := 0; i < 2; i++ {
+				got, err := s.Token(context.Background())
+				if tt.wantErr != "" {
+					if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+						t.Fatalf("Token() error = %v, want %q", err, tt.wantErr)
+					}
+					continue
+				}
+				if err != nil || got != "ghp-from-vault" {
+					t.Fatalf("Token() = %q, %v", got, err)
+				}
+			}
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			if len(f.logins) != tt.wantLogins && tt.wantErr == "" {
+				t.Errorf("logged in %d times, want %d", len(f.logins), tt.wantLogins)
+			}
+			if tt.wantLogin != nil && !equal(f.logins[0], tt.wantLogin) {
+				t.Errorf("login = %v, want %v", f.logins[0], tt.wantLogin)
+			}
+			if tt.wantErr == "" && f.reads != 1 {
+				t.Errorf("read the secret %d times, want 1 with caching", f.reads)
+			}
+			if f.lastNS != tt.cfg.Namespace {
+				t.Errorf("namespace = %q, want %q", f.lastNS, tt.cfg.Namespace)
+			}
+		})
+	}
+}
+
+func equal(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRevokedLoginToken(t *testing.T) {
+	f := newFakeVault(t)
+	f.secret = map[string]interface{}{"data": map[string]interface{}{"token": "ghp-from-vault"}}
+	c, err := New(Config{Addr: f.URL, RoleID: "role", SecretID: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Secret{Client: c, Path: "secret/data/nodeprop"}
+	if _, err := s.Token(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	f.mu.Lock()
+	f.valid = map[string]bool{}
+	f.mu.Unlock()
+	s.refreshAt = time.Time{}
+	if got, err := s.Token(context.Background()); err != nil || got != "ghp-from-vault" {
+		t.Fatalf("Token() after revocation = %q, %v", got, err)
+	}
+	if len(f.logins) != 2 || c.token != "login-token-2" {
+		t.Errorf("logged in %d times with token %q, want a second login", len(f.logins), c.token)
+	}
+}
+
+func TestSecretLeaseRenewal(t *testing.T) {
+	tests := []struct {
+		name       string
+		renewLease int
+		wantReads  int
+	}{
+		{name: "renewed", renewLease: 3600, wantReads: 1},
+		{name: "near max ttl", renewLease: 600, wantReads: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeVault(t)
+			f.secret = map[string]interface{}{"lease_id": "lease-1", "lease_duration": 3600, "renewable": true, "data": map[string]interface{}{"token": "ghs-dynamic"}}
+			f.renewLease = tt.renewLease
+			c, err := New(Config{Addr: f.URL, Token: "root-token"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := &Secret{Client: c, Path: "secret/data/nodeprop"}
+			if _, err := s.Token(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if time.Until(s.refreshAt) < 39*time.Minute {
+				t.Errorf("refresh in %v, want two thirds of the hour lease", time.Until(s.refreshAt))
+			}
+			s.refreshAt = time.Now().Add(-time.Second)
+			if got, err := s.Token(context.Background()); err != nil || got != "ghs-dynamic" {
+				t.Fatalf("Token() = %q, %v", got, err)
+			}
+			if f.renews != 1 || f.reads != tt.wantReads {
+				t.Errorf("renews = %d, reads = %d; want 1 and %d", f.renews, f.reads, tt.wantReads)
+			}
+		})
+	}
+}
+
+func TestParseSource(t *testing.T) {
+	if _, err := ParseSource("#token"); err == nil {
+		t.Error("ParseSource() of an empty path succeeded")
+	}
+}
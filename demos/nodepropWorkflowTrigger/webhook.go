@@ -0,0 +1,139 @@
+package flow
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultWebhookSignatureHeader carries WebhookTrigger signatures unless
+// SignatureHeader says otherwise.
+const DefaultWebhookSignatureHeader = "X-Nodeprop-Signature-256"
+
+// webhookTimeout bounds a delivery.
+const webhookTimeout = 30 * time.Second
+
+// WebhookPayload is the JSON body WebhookTrigger posts. Delivery and SentAt
+// are covered by the signature, so a receiver can refuse replays.
+type WebhookPayload struct {
+	Delivery string            `json:"delivery"`
+	SentAt   time.Time         `json:"sent_at"`
+	Target   string            `json:"target"`
+	Params   map[string]string `json:"params,omitempty"`
+}
+
+// WebhookTrigger posts a WebhookPayload to URL, for systems other than
+// GitHub that start work on a webhook, such as Jenkins or an internal
+// deployer. It is used like the other triggers of a TriggerManager: target
+// and params go in the payload, and authToken, if set, is sent as a bearer
+// token.
+type WebhookTrigger struct {
+	URL string
+	// Secret, if set, signs each payload so the receiver can verify that it
+	// came from this dispatcher: the header carries sha256= and the hex
+	// HMAC-SHA256 of the body keyed with the secret, as GitHub signs its
+	// webhooks. It is read for every delivery, so a rotated key is used at
+	// once.
+	Secret TokenProvider
+	// SignatureHeader defaults to DefaultWebhookSignatureHeader.
+	SignatureHeader string
+	HTTPClient      *http.Client
+	// Retry is applied to deliveries that fail with transient errors, each
+	// attempt carrying the same delivery ID. The zero value makes one
+	// attempt.
+	Retry RetryPolicy
+	// Logger receives each delivery's status; nil means slog.Default().
+	Logger Logger
+	// secretSource is the token source Secret was parsed from by
+	// NewProvider, for ProviderConfig.
+	secretSource string
+}
+
+// Trigger delivers target and params to w.URL.
+func (w *WebhookTrigger) Trigger(target string, params map[string]string, authToken string) error {
+	return w.TriggerContext(context.Background(), target, params, authToken)
+}
+
+// TriggerContext is Trigger, giving up when ctx is done. Failures are a
+// *DispatchError, and a response other than 2xx is also an *APIError, so
+// ErrorClass classifies it as it does GitHub's.
+func (w *WebhookTrigger) TriggerContext(ctx context.Context, target string, params map[string]string, authToken string) error {
+	return dispatchError(ProviderWebhook, target, w.URL, w.trigger(ctx, target, params, authToken))
+}
+
+func (w *WebhookTrigger) trigger(ctx context.Context, target string, params map[string]string, authToken string) error {
+	if err := ValidateParams(params); err != nil {
+		return err
+	}
+	delivery, err := newDispatchID()
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(WebhookPayload{Delivery: delivery, SentAt: time.Now().UTC(), Target: target, Params: params})
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	return w.Retry.run(ctx, w.Logger, func() error {
+		return w.deliver(ctx, target, delivery, body, authToken)
+	})
+}
+
+// deliver makes one attempt at posting body.
+func (w *WebhookTrigger) deliver(ctx context.Context, target, delivery string, body []byte, authToken string) error {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", w.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "nodeprop")
+	if authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+authToken)
+	}
+	if w.Secret != nil {
+		secret, err := w.Secret.Token(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read webhook secret: %w", err)
+		}
+		header := w.SignatureHeader
+		if header == "" {
+			header = DefaultWebhookSignatureHeader
+		}
+		req.Header.Set(header, SignWebhook([]byte(secret), body))
+	}
+
+	resp, err := httpClientOr(w.HTTPClient).Do(req)
+	if err != nil {
+		return RedactError(fmt.Errorf("failed to deliver webhook: %w", err))
+	}
+	defer resp.Body.Close()
+	LoggerOr(w.Logger).Debug("webhook delivery", "url", w.URL, "target", target, "delivery", delivery, "status", resp.StatusCode)
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &APIError{Method: "POST", Path: w.URL, StatusCode: resp.StatusCode, Body: Secrets.Redact(strings.TrimSpace(string(msg)))}
+	}
+	return nil
+}
+
+// SignWebhook returns the signature header value for body keyed with
+// secret: sha256= and the hex HMAC-SHA256.
+func SignWebhook(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook reports whether header is a valid signature of body for
+// secret, in constant time. Receivers written in Go can use it as is.
+func VerifyWebhook(secret []byte, header string, body []byte) bool {
+	return hmac.Equal([]byte(header), []byte(SignWebhook(secret, body)))
+}
@@ -0,0 +1,182 @@
+package flow_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	flow "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+func TestSignAndVerifyWebhook(t *testing.T) {
+	secret, body := []byte("s3cret"), []byte(`{"target": "deploy"}`)
+	sig := flow.SignWebhook(secret, body)
+	tests := []struct {
+		name   string
+		secret []byte
+		header string
+		body   []byte
+		want   bool
+	}{
+		{name: "valid", secret: secret, header: sig, body: body, want: true},
+		{name: "known vector", secret: []byte("key"), header: "sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8", body: []byte("The quick brown fox jumps over the lazy dog"), want: true},
+		{name: "other secret", secret: []byte("other"), header: sig, body: body},
+		{name: "tampered body", secret: secret, header: sig, body: []byte(`{"target": "destroy"}`)},
+		{name: "no prefix", secret: secret, header: sig[len("sha256="):], body: body},
+		{name: "upper case hex", secret: secret, header: "sha256=" + upper(sig[len("sha256="):]), body: body},
+		{name: "empty header", secret: secret, body: body},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := flow.VerifyWebhook(tt.secret, tt.header, tt.body); got != tt.want {
+				t.Errorf("VerifyWebhook() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func upper(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c >= 'a' && c <= 'f' {
+			b[i] = c - 'a' + 'A'
+		}
+	}
+	return string(b)
+}
+
+// webhookReceiver records deliveries and answers with statuses in turn,
+// then 204.
+type webhookReceiver struct {
+	mu         sync.Mutex
+	statuses   []int
+	deliveries []*http.Request
+	bodies     [][]byte
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	body, _ := io.ReadAll(req.Body)
+	r.deliveries = append(r.deliveries, req)
+	r.bodies = append(r.bodies, body)
+	status := http.StatusNoContent
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func TestWebhookTrigger(t *testing.T) {
+	tests := []struct {
+		name       string
+		secret     flow.TokenProvider
+		header     string
+		statuses   []int
+		retry      flow.RetryPolicy
+		wantErr    string
+		wantPosts  int
+		wantHeader string
+	}{
+		{name: "unsigned", wantPosts: 1},
+		{name: "signed", secret: flow.StaticToken("s3cret"), wantPosts: 1, wantHeader: flow.DefaultWebhookSignatureHeader},
+		{name: "custom header", secret: flow.StaticToken("s3cret"), header: "X-Jenkins-Signature", wantPosts: 1, wantHeader: "X-Jenkins-Signature"},
+		{name: "rejected", statuses: []int{http.StatusUnauthorized}, wantErr: flow.ErrorUnauthorized, wantPosts: 1},
+		{
+			name: "retried", secret: flow.StaticToken("s3cret"), statuses: []int{http.StatusBadGateway}, wantPosts: 2, wantHeader: flow.DefaultWebhookSignatureHeader,
+			retry: flow.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond},
+		},
+		{name: "not retried by default", statuses: []int{http.StatusBadGateway}, wantErr: flow.ErrorServer, wantPosts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rcv := &webhookReceiver{statuses: tt.statuses}
+			srv := httptest.NewServer(rcv)
+			defer srv.Close()
+			w := &flow.WebhookTrigger{URL: srv.URL, Secret: tt.secret, SignatureHeader: tt.header, Retry: tt.retry, Logger: discardLogger}
+
+			err := w.TriggerContext(context.Background(), "deploy", map[string]string{"env": "prod"}, "bearer-token")
+			if tt.wantErr != "" {
+				var de *flow.DispatchError
+				if !errors.As(err, &de) || flow.ErrorClass(err) != tt.wantErr {
+					t.Errorf("TriggerContext() error = %v, want a %s dispatch error", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("TriggerContext() error = %v", err)
+			}
+
+			rcv.mu.Lock()
+			defer rcv.mu.Unlock()
+			if len(rcv.deliveries) != tt.wantPosts {
+				t.Fatalf("%d deliveries, want %d", len(rcv.deliveries), tt.wantPosts)
+			}
+			var first flow.WebhookPayload
+			for i, req := range rcv.deliveries {
+				var p flow.WebhookPayload
+				if err := json.Unmarshal(rcv.bodies[i], &p); err != nil {
+					t.Fatal(err)
+				}
+				if p.Target != "deploy" || p.Params["env"] != "prod" || p.Delivery == "" || p.SentAt.IsZero() {
+					t.Errorf("payload = %+v", p)
+				}
+				if i == 0 {
+					first = p
+				} else if p.Delivery != first.Delivery {
+					t.Errorf("retry delivery ID = %s, want %s", p.Delivery, first.Delivery)
+				}
+				if req.Header.Get("Authorization") != "Bearer bearer-token" {
+					t.Errorf("Authorization = %q", req.Header.Get("Authorization"))
+				}
+				if tt.wantHeader == "" {
+					continue
+				}
+				if sig := req.Header.Get(tt.wantHeader); !flow.VerifyWebhook([]byte("s3cret"), sig, rcv.bodies[i]) {
+					t.Errorf("%s = %q does not verify", tt.wantHeader, sig)
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookTriggerErrors(t *testing.T) {
+	rcv := &webhookReceiver{}
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+	failing := failingToken{errors.New("vault sealed")}
+	tests := []struct {
+		name    string
+		w       *flow.WebhookTrigger
+		params  map[string]string
+		wantErr string
+	}{
+		{name: "secret unavailable", w: &flow.WebhookTrigger{URL: srv.URL, Secret: failing}, wantErr: "failed to read webhook secret: vault sealed"},
+		{name: "invalid params", w: &flow.WebhookTrigger{URL: srv.URL}, params: map[string]string{"bad\x00key": "1"}, wantErr: flow.ErrorInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.w.Trigger("deploy", tt.params, "")
+			if err == nil || !containsOrClass(err, tt.wantErr) {
+				t.Errorf("Trigger() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+	if len(rcv.deliveries) != 0 {
+		t.Errorf("%d deliveries, want none", len(rcv.deliveries))
+	}
+}
+
+// failingToken is a TokenProvider that always fails.
+type failingToken struct{ err error }
+
+func (f failingToken) Token(context.Context) (string, error) { return "", f.err }
+
+func containsOrClass(err error, want string) bool {
+	return flow.ErrorClass(err) == want || strings.Contains(err.Error(), want)
+}
@@ -1 +0,0 @@
-"""Test package for nodeprop-action."""
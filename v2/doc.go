@@ -0,0 +1,17 @@
+// Package v2 is the root of the importable NodeProp packages, the module
+// github.com/Cdaprod/nodeprop-action/v2. Other projects can depend on them
+// instead of copying the demo sources.
+//
+//   - trigger: the Trigger interface and the GitHub and webhook triggers
+//   - registry: the repository registry and its YAML file
+//   - flow: the trigger manager, facade, and actor
+//   - github: the GitHub REST client and its metadata cache
+//   - nodeprop: the generated .nodeprop.yml config
+//
+// Within v2 the import paths and the names they export are kept: none is
+// removed or renamed, and each keeps naming the same type, function, or
+// value. Many of the types are aliases of the implementation in
+// demos/nodepropWorkflowTrigger, whose tagged release v2 requires; their
+// fields and methods are covered all the same, and a release of v2 only
+// moves to an implementation release that keeps them compatible.
+package v2
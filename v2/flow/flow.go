@@ -0,0 +1,151 @@
+// Package flow runs the actions and workflows of registered repositories
+// through a trigger manager, and offers the facade and actor layers above
+// it.
+package flow
+
+import (
+	"context"
+
+	impl "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+	"github.com/Cdaprod/nodeprop-action/v2/registry"
+)
+
+// TriggerManager holds named action and workflow triggers and runs them.
+type TriggerManager = impl.TriggerManager
+
+// Facade registers repositories and triggers their flows.
+type Facade = impl.FlowFacade
+
+// Actor runs flows on behalf of a caller through a Facade.
+type Actor = impl.Actor
+
+// ActorSystem supervises one Actor per repository, restarting those that
+// panic or keep failing as a RestartPolicy says.
+type (
+	ActorSystem   = impl.ActorSystem
+	ActorStats    = impl.ActorStats
+	RestartPolicy = impl.RestartPolicy
+)
+
+// DefaultRestartPolicy is the RestartPolicy most systems want.
+var DefaultRestartPolicy = impl.DefaultRestartPolicy
+
+// Errors of an ActorSystem.
+var (
+	ErrMailboxFull  = impl.ErrMailboxFull
+	ErrActorStopped = impl.ErrActorStopped
+)
+
+// Builder assembles registry entries, routing rules, and triggers in one
+// chain; RepoBuilder configures one repository of it.
+type (
+	Builder     = impl.Builder
+	RepoBuilder = impl.RepoBuilder
+	Setup       = impl.Setup
+)
+
+// Definition is a flow of steps loaded from YAML; Graph is one compiled
+// for running, and Execution the outcome of a run. Runner runs steps
+// against GitHub, and StepRunner is what Graph.Run needs of one.
+type (
+	Definition = impl.FlowDefinition
+	Step       = impl.FlowStep
+	StepRetry  = impl.StepRetry
+	StepFanOut = impl.StepFanOut
+	// StepFailure is what a step does once it has failed for good.
+	StepFailure = impl.StepFailure
+	// StepOutputs collects the outputs of a step's run for later steps.
+	StepOutputs = impl.StepOutputs
+	StepRun     = impl.StepRun
+	Graph       = impl.FlowGraph
+	Execution   = impl.FlowExecution
+	StepState   = impl.StepState
+	StepRunner  = impl.StepRunner
+	Runner      = impl.FlowRunner
+)
+
+// RunCanceler is a StepRunner that can cancel the runs of a step, as a
+// flow with cancel_runs needs once its timeout passes.
+type RunCanceler = impl.RunCanceler
+
+// ConditionEnv is what step When expressions see.
+type ConditionEnv = impl.ConditionEnv
+
+// Store persists executions so that Graph.Resume can continue one that
+// was interrupted; FileStore keeps them in a JSON file.
+type (
+	Store     = impl.FlowStore
+	FileStore = impl.FileFlowStore
+)
+
+// Query selects executions from a Store by flow, version, time, and
+// status.
+type Query = impl.FlowQuery
+
+// Statuses of an Execution.
+const (
+	StatusUnfinished = impl.FlowUnfinished
+	StatusSucceeded  = impl.FlowSucceeded
+	StatusFailed     = impl.FlowFailed
+)
+
+// Statuses of a StepState.
+const (
+	StepPending   = impl.StepPending
+	StepRunning   = impl.StepRunning
+	StepSucceeded = impl.StepSucceeded
+	StepFailed    = impl.StepFailed
+	StepSkipped   = impl.StepSkipped
+	StepOmitted   = impl.StepOmitted
+)
+
+// Formats of Graph.ExportGraph.
+const (
+	GraphDOT     = impl.GraphDOT
+	GraphMermaid = impl.GraphMermaid
+)
+
+// Fan-in modes of a StepFanOut.
+const (
+	FanInAll    = impl.FanInAll
+	FanInAny    = impl.FanInAny
+	FanInQuorum = impl.FanInQuorum
+)
+
+// LoadDefinition reads and validates a flow definition file.
+func LoadDefinition(path string) (*Definition, error) { return impl.LoadFlowDefinition(path) }
+
+// Compile validates a Definition and returns its Graph.
+func Compile(def *Definition) (*Graph, error) { return impl.CompileFlow(def) }
+
+// NewFileStore returns a FileStore backed by path.
+func NewFileStore(path string) *FileStore { return impl.NewFileFlowStore(path) }
+
+// Unfinished returns the executions of flow in s that can be resumed.
+func Unfinished(s Store, flow string) ([]Execution, error) { return impl.UnfinishedFlows(s, flow) }
+
+// QueryExecutions returns the executions in s matching q, newest first.
+func QueryExecutions(s Store, q Query) ([]Execution, error) { return impl.QueryFlows(s, q) }
+
+// StepKey returns the idempotency key of the step attempt running with ctx.
+func StepKey(ctx context.Context) string { return impl.StepKey(ctx) }
+
+// New returns an empty Builder.
+func New() *Builder { return impl.New() }
+
+// NewTriggerManager returns an empty TriggerManager.
+func NewTriggerManager() *TriggerManager { return impl.NewTriggerManager() }
+
+// NewFacade returns a Facade over a trigger manager and a registry.
+func NewFacade(triggerManager *TriggerManager, repoRegistry *registry.Registry) Facade {
+	return impl.NewFlowFacade(triggerManager, repoRegistry)
+}
+
+// NewActor returns an Actor using facade.
+func NewActor(facade Facade) Actor { return impl.NewActor(facade) }
+
+// NewActorSystem returns an ActorSystem making the actor of a repository
+// with newActor.
+func NewActorSystem(newActor func(repo string) Actor, policy RestartPolicy) *ActorSystem {
+	return impl.NewActorSystem(newActor, policy)
+}
@@ -0,0 +1,74 @@
+package flow_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+	"github.com/Cdaprod/nodeprop-action/v2/flow"
+	"github.com/Cdaprod/nodeprop-action/v2/registry"
+	"github.com/Cdaprod/nodeprop-action/v2/trigger"
+)
+
+func TestFacade(t *testing.T) {
+	deploy, notify := &nodeproptest.MockTrigger{}, &nodeproptest.MockTrigger{}
+	tm := flow.NewTriggerManager()
+	tm.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	tm.RegisterWorkflow("deploy.yml", deploy)
+	tm.RegisterAction("notify", notify)
+	var f flow.Facade = flow.NewFacade(tm, registry.New())
+	ctx := context.Background()
+	if err := f.RegisterRepo(ctx, "Cdaprod/site", []string{"notify"}, []string{"deploy.yml"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		run      func() error
+		wantErr  bool
+		wantRuns int
+	}{
+		{name: "repo flows", run: func() error { return f.TriggerRepoFlows(ctx, "Cdaprod/site", "token") }, wantRuns: 2},
+		{name: "custom workflow", run: func() error {
+			return f.TriggerCustomFlow(ctx, "Cdaprod/site", "workflow", "deploy.yml", "token", map[string]string{"env": "prod"})
+		}, wantRuns: 1},
+		{name: "unregistered repository", run: func() error { return f.TriggerRepoFlows(ctx, "Cdaprod/other", "token") }, wantErr: true},
+		{name: "unknown flow type", run: func() error { return f.TriggerCustomFlow(ctx, "Cdaprod/site", "job", "x", "token", nil) }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deploy.Reset()
+			notify.Reset()
+			err := tt.run()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			var de *trigger.DispatchError
+			if tt.name == "unknown flow type" && !errors.As(err, &de) {
+				t.Errorf("error = %v, want a *trigger.DispatchError", err)
+			}
+			if n := len(deploy.Calls()) + len(notify.Calls()); n != tt.wantRuns {
+				t.Errorf("ran %d triggers, want %d", n, tt.wantRuns)
+			}
+		})
+	}
+}
+
+func TestCompile(t *testing.T) {
+	g, err := flow.Compile(&flow.Definition{Name: "release", Steps: []flow.Step{
+		{Name: "build", Provider: "workflow_dispatch", Repo: "Cdaprod/lib", Workflow: "build.yml"},
+		{Name: "deploy", Provider: "workflow_dispatch", Repo: "Cdaprod/site", Workflow: "deploy.yml", Needs: []string{"build"}},
+	}})
+	if err != nil || g == nil {
+		t.Fatalf("Compile() = %v, %v", g, err)
+	}
+	if _, err := flow.Compile(&flow.Definition{Name: "cycle", Steps: []flow.Step{
+		{Name: "a", Provider: "workflow_dispatch", Repo: "o/a", Workflow: "a.yml", Needs: []string{"b"}},
+		{Name: "b", Provider: "workflow_dispatch", Repo: "o/b", Workflow: "b.yml", Needs: []string{"a"}},
+	}}); err == nil {
+		t.Error("Compile() of a cycle succeeded")
+	}
+}
@@ -0,0 +1,39 @@
+// Package github is the GitHub REST client flows dispatch through, with a
+// TTL cache of repository metadata.
+package github
+
+import impl "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+
+// DefaultAPIBaseURL is the REST endpoint of github.com.
+const DefaultAPIBaseURL = impl.DefaultAPIBaseURL
+
+// Client calls the GitHub REST API.
+type Client = impl.GitHubClient
+
+// APIError is a non-2xx response from the API.
+type APIError = impl.APIError
+
+// TokenInfo describes the token a Client authenticates with.
+type TokenInfo = impl.TokenInfo
+
+// RateLimit is the rate-limit state GitHub reported.
+type RateLimit = impl.RateLimit
+
+// Repository is the metadata of a repository.
+type Repository = impl.Repository
+
+// Workflow is a workflow defined in a repository.
+type Workflow = impl.Workflow
+
+// MetadataCache caches repository lookups, default branches, and workflow
+// lists.
+type MetadataCache = impl.MetadataCache
+
+// NewClient returns a Client authenticating with token.
+func NewClient(token string) *Client { return impl.NewGitHubClient(token) }
+
+// NewMetadataCache returns a MetadataCache reading through client.
+func NewMetadataCache(client *Client) *MetadataCache { return impl.NewMetadataCache(client) }
+
+// IsNotFound reports whether err is a 404 from the API.
+func IsNotFound(err error) bool { return impl.IsNotFound(err) }
@@ -0,0 +1,46 @@
+package github_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+	"github.com/Cdaprod/nodeprop-action/v2/github"
+)
+
+func TestClient(t *testing.T) {
+	gh := nodeproptest.NewServer()
+	defer gh.Close()
+	gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+	var c *github.Client = github.NewClient(nodeproptest.DefaultToken)
+	c.BaseURL = gh.URL
+	cache := github.NewMetadataCache(c)
+	ctx := context.Background()
+
+	tests := []struct {
+		repo         string
+		wantNotFound bool
+	}{
+		{repo: "Cdaprod/site"},
+		{repo: "Cdaprod/missing", wantNotFound: true},
+	}
+	for _, tt := range tests {
+		var r *github.Repository
+		r, err := cache.Repository(ctx, tt.repo)
+		if github.IsNotFound(err) != tt.wantNotFound {
+			t.Errorf("Repository(%s) error = %v, want not found %v", tt.repo, err, tt.wantNotFound)
+		}
+		var apiErr *github.APIError
+		if tt.wantNotFound && (!errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound) {
+			t.Errorf("Repository(%s) error = %v, want a *github.APIError", tt.repo, err)
+		}
+		if !tt.wantNotFound && (err != nil || r.FullName != tt.repo) {
+			t.Errorf("Repository(%s) = %+v, %v", tt.repo, r, err)
+		}
+	}
+	if github.DefaultAPIBaseURL != "https://api.github.com" {
+		t.Errorf("DefaultAPIBaseURL = %s", github.DefaultAPIBaseURL)
+	}
+}
@@ -0,0 +1,35 @@
+// Package nodeprop reads, merges, and compares the .nodeprop.yml config the
+// NodeProp action generates in a repository.
+package nodeprop
+
+import impl "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+
+// DefaultConfigFile is the file the action generates in a repository.
+const DefaultConfigFile = impl.DefaultConfigFile
+
+// Kinds of ConfigChange.
+const (
+	ChangeAdded   = impl.ChangeAdded
+	ChangeRemoved = impl.ChangeRemoved
+	ChangeChanged = impl.ChangeChanged
+)
+
+// ConfigChange is one difference found by DiffConfig.
+type ConfigChange = impl.ConfigChange
+
+// ParseConfig decodes a generated config or a spec file.
+func ParseConfig(data []byte) (map[string]interface{}, error) { return impl.ParseNodeConfig(data) }
+
+// LoadConfig reads a generated config or a spec file.
+func LoadConfig(path string) (map[string]interface{}, error) { return impl.LoadNodeConfig(path) }
+
+// MergeSpec merges spec into base the way the action does.
+func MergeSpec(base, spec map[string]interface{}) map[string]interface{} {
+	return impl.MergeSpec(base, spec)
+}
+
+// DiffConfig lists the changes from old to new.
+func DiffConfig(old, new map[string]interface{}) []ConfigChange { return impl.DiffConfig(old, new) }
+
+// FormatValue renders a config value for display.
+func FormatValue(v interface{}) string { return impl.FormatConfigValue(v) }
@@ -0,0 +1,45 @@
+package nodeprop_test
+
+import (
+	"testing"
+
+	"github.com/Cdaprod/nodeprop-action/v2/nodeprop"
+)
+
+func TestMergeAndDiff(t *testing.T) {
+	base, err := nodeprop.ParseConfig([]byte("name: site\nci:\n  runner: ubuntu\n  cache: true\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec, err := nodeprop.ParseConfig([]byte("ci:\n  runner: self-hosted\nowner: web\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged := nodeprop.MergeSpec(base, spec)
+
+	tests := []struct {
+		path string
+		kind string
+	}{
+		{path: "ci.runner", kind: nodeprop.ChangeChanged},
+		{path: "owner", kind: nodeprop.ChangeAdded},
+	}
+	var changes []nodeprop.ConfigChange = nodeprop.DiffConfig(base, merged)
+	if len(changes) != len(tests) {
+		t.Fatalf("DiffConfig() = %+v, want %d changes", changes, len(tests))
+	}
+	for i, tt := range tests {
+		if changes[i].Path != tt.path || changes[i].Kind != tt.kind {
+			t.Errorf("change %d = %+v, want %s %s", i, changes[i], tt.kind, tt.path)
+		}
+	}
+	if removed := nodeprop.DiffConfig(merged, base); len(removed) != 2 || removed[1].Kind != nodeprop.ChangeRemoved {
+		t.Errorf("DiffConfig() back = %+v, want owner removed", removed)
+	}
+	if got := nodeprop.FormatValue(merged["ci"]); got == "" {
+		t.Error("FormatValue() is empty")
+	}
+	if _, err := nodeprop.ParseConfig([]byte("name: [")); err == nil {
+		t.Error("ParseConfig() of invalid YAML succeeded")
+	}
+}
@@ -0,0 +1,25 @@
+// Package registry records the repositories flows may trigger, with their
+// actions, workflows, tags, and dependencies, and reads and writes them as
+// YAML.
+package registry
+
+import impl "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+
+// Registry holds the registered repositories. It is safe for concurrent
+// use.
+type Registry = impl.RepositoryRegistry
+
+// Entry describes a registered repository and the triggers it uses.
+type Entry = impl.RepoEntry
+
+// Executor runs the actions and workflows of a repository.
+type Executor = impl.TriggerExecutor
+
+// New returns an empty Registry.
+func New() *Registry { return impl.NewRepositoryRegistry() }
+
+// Load reads a registry file; a missing file is an empty Registry.
+func Load(path string) (*Registry, error) { return impl.LoadRegistry(path) }
+
+// DefaultPath returns the registry file used when none is given.
+func DefaultPath() string { return impl.DefaultRegistryPath() }
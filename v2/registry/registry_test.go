@@ -0,0 +1,35 @@
+package registry_test
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/Cdaprod/nodeprop-action/v2/registry"
+)
+
+func TestLoadAndSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.yml")
+	empty, err := registry.Load(path)
+	if err != nil || len(empty.Repos()) != 0 {
+		t.Fatalf("Load() of a missing file = %v, %v; want an empty registry", empty.Repos(), err)
+	}
+
+	r := registry.New()
+	r.RegisterRepo("Cdaprod/site", []string{"notify"}, []string{"deploy.yml"})
+	if err := r.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := registry.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e registry.Entry
+	e, ok := loaded.Get("Cdaprod/site")
+	if !ok || !slices.Equal(e.Workflows, []string{"deploy.yml"}) || !slices.Equal(e.Actions, []string{"notify"}) {
+		t.Errorf("loaded entry = %+v, want the saved one", e)
+	}
+	if registry.DefaultPath() == "" {
+		t.Error("DefaultPath() is empty")
+	}
+}
@@ -0,0 +1,141 @@
+// Package trigger starts GitHub workflows, repository_dispatch events, and
+// webhooks on behalf of flows.
+package trigger
+
+import (
+	"context"
+	"net/http"
+
+	impl "github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger"
+)
+
+// Trigger starts work on target, typically an owner/name repository, with
+// params, authenticating with authToken.
+type Trigger = impl.Trigger
+
+// ContextTrigger is a Trigger whose deliveries can be cancelled.
+type ContextTrigger = impl.ContextTrigger
+
+// GitHubWorkflowDispatch starts a workflow with a workflow_dispatch event.
+type GitHubWorkflowDispatch = impl.GitHubWorkflowDispatch
+
+// GitHubRepoDispatch sends a repository_dispatch event.
+type GitHubRepoDispatch = impl.GitHubRepoDispatch
+
+// WebhookTrigger posts a signed WebhookPayload to a URL.
+type WebhookTrigger = impl.WebhookTrigger
+
+// WebhookPayload is the body a WebhookTrigger sends.
+type WebhookPayload = impl.WebhookPayload
+
+// Option configures the triggers made by the New functions.
+type Option = impl.Option
+
+// Logger is the structured logger triggers write to; *slog.Logger is one.
+type Logger = impl.Logger
+
+// RetryPolicy says how often and how long a trigger retries transient
+// failures.
+type RetryPolicy = impl.RetryPolicy
+
+// DispatchError reports a dispatch that failed, with its target and the
+// trigger that made it.
+type DispatchError = impl.DispatchError
+
+// ParamError reports a param or input GitHub would refuse.
+type ParamError = impl.ParamError
+
+// ProviderFactory builds a trigger of one provider kind from its settings.
+type ProviderFactory = impl.ProviderFactory
+
+// ProviderConfig is the provider kind and settings a trigger is built
+// from.
+type ProviderConfig = impl.ProviderConfig
+
+// ConfigurableTrigger is a Trigger that reports its ProviderConfig.
+type ConfigurableTrigger = impl.ConfigurableTrigger
+
+// Config is a named action or workflow trigger as the registry saves it.
+type Config = impl.TriggerConfig
+
+// Types of Config.
+const (
+	TypeAction   = impl.TriggerTypeAction
+	TypeWorkflow = impl.TriggerTypeWorkflow
+)
+
+// DefaultRetryPolicy is the policy WithRetry falls back to.
+var DefaultRetryPolicy = impl.DefaultRetryPolicy
+
+// NewGitHubWorkflowDispatch returns a trigger dispatching workflowFile.
+func NewGitHubWorkflowDispatch(workflowFile string, opts ...Option) *GitHubWorkflowDispatch {
+	return impl.NewGitHubWorkflowDispatch(workflowFile, opts...)
+}
+
+// NewGitHubRepoDispatch returns a trigger sending repository_dispatch
+// events of eventType.
+func NewGitHubRepoDispatch(eventType string, opts ...Option) *GitHubRepoDispatch {
+	return impl.NewGitHubRepoDispatch(eventType, opts...)
+}
+
+// NewWebhookTrigger returns a trigger posting to url.
+func NewWebhookTrigger(url string, opts ...Option) *WebhookTrigger {
+	return impl.NewWebhookTrigger(url, opts...)
+}
+
+// WithRef sets the git ref workflows are dispatched on.
+func WithRef(ref string) Option { return impl.WithRef(ref) }
+
+// WithBaseURL sets the API endpoint, as for GitHub Enterprise Server.
+func WithBaseURL(url string) Option { return impl.WithBaseURL(url) }
+
+// WithHTTPClient sets the HTTP client requests are made with.
+func WithHTTPClient(hc *http.Client) Option { return impl.WithHTTPClient(hc) }
+
+// WithRetry sets how transient failures are retried.
+func WithRetry(p RetryPolicy) Option { return impl.WithRetry(p) }
+
+// WithLogger sets the logger of the trigger.
+func WithLogger(l Logger) Option { return impl.WithLogger(l) }
+
+// NewProvider builds a trigger of the provider kind from its settings.
+func NewProvider(kind string, settings map[string]string, opts ...Option) (Trigger, error) {
+	return impl.NewProvider(kind, settings, opts...)
+}
+
+// RegisterProvider makes the provider kind available to NewProvider.
+func RegisterProvider(kind string, factory ProviderFactory) { impl.RegisterProvider(kind, factory) }
+
+// Providers returns the registered provider kinds, including those loaded
+// from plugins.
+func Providers() []string { return impl.Providers() }
+
+// EncodeInputs encodes v, a struct, as workflow inputs.
+func EncodeInputs(v interface{}) (map[string]string, error) { return impl.EncodeInputs(v) }
+
+// ValidateParams checks params for what GitHub would refuse.
+func ValidateParams(params map[string]string) error { return impl.ValidateParams(params) }
+
+// ValidateInputs checks workflow_dispatch inputs for what GitHub would
+// refuse.
+func ValidateInputs(inputs map[string]string) error { return impl.ValidateInputs(inputs) }
+
+// SignWebhook returns the signature header value of body.
+func SignWebhook(secret, body []byte) string { return impl.SignWebhook(secret, body) }
+
+// VerifyWebhook reports whether header is a valid signature of body.
+func VerifyWebhook(secret []byte, header string, body []byte) bool {
+	return impl.VerifyWebhook(secret, header, body)
+}
+
+// ErrorClass classifies err, such as a rate limit or a cancellation.
+func ErrorClass(err error) string { return impl.ErrorClass(err) }
+
+// Transient reports whether errors of class are worth retrying.
+func Transient(class string) bool { return impl.Transient(class) }
+
+// Dispatch runs trigger on target with inputs, a struct, encoded by
+// EncodeInputs as its params.
+func Dispatch[T any](ctx context.Context, trigger Trigger, target string, inputs T, token string) error {
+	return impl.Dispatch(ctx, trigger, target, inputs, token)
+}
@@ -0,0 +1,81 @@
+package trigger_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/Cdaprod/nodeprop-action/demos/nodepropWorkflowTrigger/nodeproptest"
+	"github.com/Cdaprod/nodeprop-action/v2/trigger"
+)
+
+type deploy struct {
+	Environment string `input:"environment,required"`
+	DryRun      bool
+}
+
+func TestTriggers(t *testing.T) {
+	gh := nodeproptest.NewServer()
+	defer gh.Close()
+	gh.AddWorkflow("Cdaprod/site", "deploy.yml")
+
+	tests := []struct {
+		name       string
+		trigger    trigger.Trigger
+		target     string
+		inputs     deploy
+		wantClass  string
+		wantStatus int
+	}{
+		{name: "workflow", trigger: trigger.NewGitHubWorkflowDispatch("deploy.yml", trigger.WithRef("main"), trigger.WithBaseURL(gh.URL)), target: "Cdaprod/site", inputs: deploy{Environment: "prod"}},
+		{name: "repository dispatch", trigger: trigger.NewGitHubRepoDispatch("deploy", trigger.WithBaseURL(gh.URL)), target: "Cdaprod/site", inputs: deploy{Environment: "prod"}},
+		{name: "unknown workflow", trigger: trigger.NewGitHubWorkflowDispatch("missing.yml", trigger.WithRef("main"), trigger.WithBaseURL(gh.URL)), target: "Cdaprod/site", inputs: deploy{Environment: "prod"}, wantClass: "not_found", wantStatus: http.StatusNotFound},
+		{name: "required input empty", trigger: trigger.NewGitHubRepoDispatch("deploy", trigger.WithBaseURL(gh.URL)), target: "Cdaprod/site", wantClass: "invalid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := trigger.Dispatch(context.Background(), tt.trigger, tt.target, tt.inputs, nodeproptest.DefaultToken)
+			if tt.wantClass == "" {
+				if err != nil {
+					t.Fatalf("Dispatch() error = %v", err)
+				}
+				return
+			}
+			if got := trigger.ErrorClass(err); got != tt.wantClass {
+				t.Errorf("ErrorClass(%v) = %s, want %s", err, got, tt.wantClass)
+			}
+			var de *trigger.DispatchError
+			var pe *trigger.ParamError
+			switch {
+			case tt.wantStatus != 0 && (!errors.As(err, &de) || de.StatusCode != tt.wantStatus):
+				t.Errorf("Dispatch() error = %v, want a *trigger.DispatchError with status %d", err, tt.wantStatus)
+			case tt.wantStatus == 0 && !errors.As(err, &pe):
+				t.Errorf("Dispatch() error = %v, want a *trigger.ParamError", err)
+			}
+		})
+	}
+	if n := len(gh.Dispatches()); n != 2 {
+		t.Errorf("%d dispatches sent, want 2", n)
+	}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	secret, body := []byte("s3cret"), []byte(`{"target": "Cdaprod/site"}`)
+	sig := trigger.SignWebhook(secret, body)
+	tests := []struct {
+		name   string
+		secret []byte
+		body   []byte
+		want   bool
+	}{
+		{name: "valid", secret: secret, body: body, want: true},
+		{name: "other secret", secret: []byte("other"), body: body},
+		{name: "tampered", secret: secret, body: []byte(`{"target": "Cdaprod/other"}`)},
+	}
+	for _, tt := range tests {
+		if got := trigger.VerifyWebhook(tt.secret, sig, tt.body); got != tt.want {
+			t.Errorf("%s: VerifyWebhook() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}